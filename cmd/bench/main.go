@@ -0,0 +1,426 @@
+// bench 多模型基准测试工具
+//
+// 通过 GET /v1/models 列出实例当前可见的模型（或用 -models 指定），对每个模型
+// 以固定并发发送流式 /v1/chat/completions 请求，统计成功率、首字节时间（TTFB）
+// 和输出速度（tokens/s），输出 Markdown 或 JSON 报告。每次发布后运行一次即可
+// 确认各服务商的调用链路没有退化。
+//
+// 用法:
+//
+//	go run ./cmd/bench -url http://localhost:7860 -requests 10 -concurrency 4 -o bench.md
+//	go run ./cmd/bench -models gpt-5.1-codex,claude-haiku-4-5-20251001 -format json -o bench.json
+//
+// 任一模型的成功率低于 -min-success 时以状态码 1 退出，便于在发布流程中使用。
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// result 单个请求的结果
+type result struct {
+	status       int
+	ttfb         time.Duration
+	latency      time.Duration
+	outputTokens int
+	estimated    bool // 响应没有 usage，输出 token 数按内容块数估算
+	err          error
+}
+
+// modelReport 单个模型的统计
+type modelReport struct {
+	Model           string         `json:"model"`
+	Requests        int            `json:"requests"`
+	Success         int            `json:"success"`
+	SuccessRate     float64        `json:"success_rate"`
+	TTFBP50Ms       int64          `json:"ttfb_p50_ms"`
+	TTFBP95Ms       int64          `json:"ttfb_p95_ms"`
+	LatencyP50Ms    int64          `json:"latency_p50_ms"`
+	TokensPerSecond float64        `json:"tokens_per_second"`
+	EstimatedTokens bool           `json:"estimated_tokens,omitempty"`
+	Errors          map[string]int `json:"errors,omitempty"`
+}
+
+// benchReport 完整报告
+type benchReport struct {
+	URL         string        `json:"url"`
+	StartedAt   time.Time     `json:"started_at"`
+	Duration    string        `json:"duration"`
+	Concurrency int           `json:"concurrency"`
+	Requests    int           `json:"requests_per_model"`
+	MaxTokens   int           `json:"max_tokens"`
+	Models      []modelReport `json:"models"`
+}
+
+type config struct {
+	baseURL     string
+	apiKey      string
+	prompt      string
+	maxTokens   int
+	requests    int
+	concurrency int
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:7860", "zencoder2api 实例地址")
+	apiKey := flag.String("key", os.Getenv("AUTH_TOKEN"), "API 访问密钥 (默认读取 AUTH_TOKEN)")
+	models := flag.String("models", "", "逗号分隔的模型列表，为空时测试 /v1/models 返回的全部模型")
+	requests := flag.Int("requests", 5, "每个模型的请求数")
+	concurrency := flag.Int("concurrency", 2, "每个模型的最大并发请求数")
+	maxTokens := flag.Int("max-tokens", 128, "每个请求的 max_tokens")
+	prompt := flag.String("prompt", "Count from 1 to 20, separated by spaces.", "请求使用的提示词")
+	timeout := flag.Duration("timeout", 2*time.Minute, "单个请求超时")
+	format := flag.String("format", "markdown", "报告格式: markdown 或 json")
+	output := flag.String("o", "", "报告输出文件，为空时输出到标准输出")
+	minSuccess := flag.Float64("min-success", 0, "任一模型成功率低于该值 (0-1) 时以状态码 1 退出，0 表示不检查")
+	flag.Parse()
+
+	if *requests <= 0 || *concurrency <= 0 || *maxTokens <= 0 {
+		log.Fatal("requests、concurrency 和 max-tokens 必须大于0")
+	}
+	if *format != "markdown" && *format != "json" {
+		log.Fatalf("不支持的报告格式: %s", *format)
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	cfg := config{
+		baseURL:     strings.TrimRight(*baseURL, "/"),
+		apiKey:      *apiKey,
+		prompt:      *prompt,
+		maxTokens:   *maxTokens,
+		requests:    *requests,
+		concurrency: *concurrency,
+	}
+
+	modelIDs := splitModels(*models)
+	if len(modelIDs) == 0 {
+		var err error
+		if modelIDs, err = fetchModels(client, cfg.baseURL, cfg.apiKey); err != nil {
+			log.Fatalf("[Bench] 读取模型列表失败: %v", err)
+		}
+	}
+	if len(modelIDs) == 0 {
+		log.Fatal("[Bench] 没有可测试的模型")
+	}
+
+	rep := benchReport{
+		URL:         cfg.baseURL,
+		StartedAt:   time.Now().UTC(),
+		Concurrency: cfg.concurrency,
+		Requests:    cfg.requests,
+		MaxTokens:   cfg.maxTokens,
+	}
+	for _, modelID := range modelIDs {
+		log.Printf("[Bench] 测试模型: %s 请求数=%d 并发=%d", modelID, cfg.requests, cfg.concurrency)
+		m := summarize(modelID, runModel(client, cfg, modelID))
+		log.Printf("[Bench] %s 成功率=%.1f%% TTFB P50=%dms tokens/s=%.1f", modelID, m.SuccessRate*100, m.TTFBP50Ms, m.TokensPerSecond)
+		rep.Models = append(rep.Models, m)
+	}
+	rep.Duration = time.Since(rep.StartedAt).Round(time.Second).String()
+
+	var out []byte
+	if *format == "json" {
+		out, _ = json.MarshalIndent(rep, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out = []byte(renderMarkdown(rep))
+	}
+	if *output == "" {
+		os.Stdout.Write(out)
+	} else if err := os.WriteFile(*output, out, 0o644); err != nil {
+		log.Fatalf("[Bench] 写入报告失败: %v", err)
+	} else {
+		log.Printf("[Bench] 报告已写入 %s", *output)
+	}
+
+	if failed := belowMinSuccess(rep.Models, *minSuccess); len(failed) > 0 {
+		log.Printf("[Bench] 成功率低于 %.2f 的模型: %s", *minSuccess, strings.Join(failed, ", "))
+		os.Exit(1)
+	}
+}
+
+func splitModels(raw string) []string {
+	var ids []string
+	for _, id := range strings.Split(raw, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// fetchModels 读取 /v1/models 返回的模型 ID
+func fetchModels(client *http.Client, baseURL, apiKey string) ([]string, error) {
+	req, err := http.NewRequest("GET", baseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("/v1/models returned %d", resp.StatusCode)
+	}
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// runModel 以 cfg.concurrency 的并发对一个模型发送 cfg.requests 个请求
+func runModel(client *http.Client, cfg config, modelID string) []result {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      modelID,
+		"max_tokens": cfg.maxTokens,
+		"stream":     true,
+		"messages":   []map[string]string{{"role": "user", "content": cfg.prompt}},
+	})
+
+	results := make([]result, cfg.requests)
+	sem := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = sendOnce(client, cfg.baseURL+"/v1/chat/completions", cfg.apiKey, body)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func sendOnce(client *http.Client, url, apiKey string, body []byte) result {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return result{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{err: err, latency: time.Since(start)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return result{status: resp.StatusCode, latency: time.Since(start)}
+	}
+
+	r := readStream(resp.Body, start)
+	r.status = resp.StatusCode
+	return r
+}
+
+// readStream 读取 SSE 流：TTFB 取第一个带内容的数据块，输出 token 数优先取 usage.completion_tokens，
+// 没有 usage 时按带内容的数据块数估算；流中出现 error 或没有 [DONE] 时记为失败
+func readStream(body io.Reader, start time.Time) result {
+	var r result
+	chunks, done := 0, false
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content          string `json:"content"`
+					ReasoningContent string `json:"reasoning_content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			r.err = fmt.Errorf("stream error: %s", chunk.Error.Message)
+			break
+		}
+		if chunk.Usage != nil && chunk.Usage.CompletionTokens > 0 {
+			r.outputTokens = chunk.Usage.CompletionTokens
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content == "" && c.Delta.ReasoningContent == "" {
+				continue
+			}
+			if chunks == 0 {
+				r.ttfb = time.Since(start)
+			}
+			chunks++
+		}
+	}
+	r.latency = time.Since(start)
+	if r.err == nil {
+		if err := scanner.Err(); err != nil {
+			r.err = err
+		} else if !done {
+			r.err = fmt.Errorf("stream ended without [DONE]")
+		}
+	}
+	if r.outputTokens == 0 && chunks > 0 {
+		r.outputTokens = chunks
+		r.estimated = true
+	}
+	return r
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// errorKey 失败请求的分类：HTTP 状态码或错误信息
+func errorKey(r result) string {
+	if r.err != nil {
+		if r.status == 0 {
+			return "network"
+		}
+		return "stream"
+	}
+	return fmt.Sprintf("HTTP %d", r.status)
+}
+
+// summarize 汇总一个模型的结果；tokens/s 为成功请求的输出 token 总数除以首字节之后的生成时间总和
+func summarize(modelID string, results []result) modelReport {
+	m := modelReport{Model: modelID, Requests: len(results)}
+	var ttfbs, latencies []time.Duration
+	var tokens int
+	var generation time.Duration
+	for _, r := range results {
+		if r.err != nil || r.status != http.StatusOK {
+			if m.Errors == nil {
+				m.Errors = make(map[string]int)
+			}
+			m.Errors[errorKey(r)]++
+			continue
+		}
+		m.Success++
+		ttfbs = append(ttfbs, r.ttfb)
+		latencies = append(latencies, r.latency)
+		if r.outputTokens > 0 && r.latency > r.ttfb {
+			tokens += r.outputTokens
+			generation += r.latency - r.ttfb
+		}
+		if r.estimated {
+			m.EstimatedTokens = true
+		}
+	}
+	if m.Requests > 0 {
+		m.SuccessRate = float64(m.Success) / float64(m.Requests)
+	}
+	sort.Slice(ttfbs, func(i, j int) bool { return ttfbs[i] < ttfbs[j] })
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	m.TTFBP50Ms = percentile(ttfbs, 50).Milliseconds()
+	m.TTFBP95Ms = percentile(ttfbs, 95).Milliseconds()
+	m.LatencyP50Ms = percentile(latencies, 50).Milliseconds()
+	if generation > 0 {
+		m.TokensPerSecond = math.Round(float64(tokens)/generation.Seconds()*10) / 10
+	}
+	return m
+}
+
+func belowMinSuccess(models []modelReport, min float64) []string {
+	var failed []string
+	if min <= 0 {
+		return nil
+	}
+	for _, m := range models {
+		if m.SuccessRate < min {
+			failed = append(failed, m.Model)
+		}
+	}
+	return failed
+}
+
+func renderMarkdown(rep benchReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# zencoder2api 基准测试报告\n\n")
+	fmt.Fprintf(&b, "- 实例: %s\n- 开始时间: %s\n- 耗时: %s\n- 每个模型: %d 个请求，并发 %d，max_tokens %d\n\n",
+		rep.URL, rep.StartedAt.Format(time.RFC3339), rep.Duration, rep.Requests, rep.Concurrency, rep.MaxTokens)
+	b.WriteString("| 模型 | 成功率 | TTFB P50 | TTFB P95 | 延迟 P50 | tokens/s | 失败 |\n")
+	b.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, m := range rep.Models {
+		tps := fmt.Sprintf("%.1f", m.TokensPerSecond)
+		if m.EstimatedTokens {
+			tps += "*"
+		}
+		fmt.Fprintf(&b, "| %s | %.1f%% (%d/%d) | %dms | %dms | %dms | %s | %s |\n",
+			m.Model, m.SuccessRate*100, m.Success, m.Requests, m.TTFBP50Ms, m.TTFBP95Ms, m.LatencyP50Ms, tps, formatErrors(m.Errors))
+	}
+	for _, m := range rep.Models {
+		if m.EstimatedTokens {
+			b.WriteString("\n\\* 响应没有 usage，输出 token 数按内容块数估算\n")
+			break
+		}
+	}
+	return b.String()
+}
+
+func formatErrors(errors map[string]int) string {
+	if len(errors) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(errors))
+	for k := range errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s×%d", k, errors[k]))
+	}
+	return strings.Join(parts, ", ")
+}
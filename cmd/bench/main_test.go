@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"choices":[{"delta":{"role":"assistant"}}]}`,
+		`data: {"choices":[{"delta":{"content":"1 2"}}]}`,
+		`data: {"choices":[{"delta":{"content":" 3"}}]}`,
+		`data: {"choices":[],"usage":{"completion_tokens":7}}`,
+		`data: [DONE]`,
+	}, "\n\n")
+	r := readStream(strings.NewReader(stream), time.Now())
+	if r.err != nil || r.outputTokens != 7 || r.estimated {
+		t.Errorf("result = %+v", r)
+	}
+
+	// 没有 usage 时按内容块估算
+	r = readStream(strings.NewReader(`data: {"choices":[{"delta":{"content":"a"}}]}`+"\n\ndata: [DONE]\n\n"), time.Now())
+	if r.err != nil || r.outputTokens != 1 || !r.estimated {
+		t.Errorf("estimated result = %+v", r)
+	}
+
+	r = readStream(strings.NewReader(`data: {"error":{"message":"overloaded"}}`+"\n\n"), time.Now())
+	if r.err == nil || !strings.Contains(r.err.Error(), "overloaded") {
+		t.Errorf("stream error = %v", r.err)
+	}
+
+	r = readStream(strings.NewReader(`data: {"choices":[{"delta":{"content":"a"}}]}`+"\n\n"), time.Now())
+	if r.err == nil {
+		t.Error("truncated stream accepted")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []result{
+		{status: http.StatusOK, ttfb: 100 * time.Millisecond, latency: 1100 * time.Millisecond, outputTokens: 50},
+		{status: http.StatusOK, ttfb: 300 * time.Millisecond, latency: 1300 * time.Millisecond, outputTokens: 30, estimated: true},
+		{status: http.StatusTooManyRequests},
+		{err: fmt.Errorf("timeout")},
+	}
+	m := summarize("m", results)
+	if m.Success != 2 || m.SuccessRate != 0.5 || m.TTFBP50Ms != 100 || m.TTFBP95Ms != 300 {
+		t.Errorf("report = %+v", m)
+	}
+	if m.TokensPerSecond != 40 || !m.EstimatedTokens {
+		t.Errorf("tokens/s = %v estimated = %v", m.TokensPerSecond, m.EstimatedTokens)
+	}
+	if m.Errors["HTTP 429"] != 1 || m.Errors["network"] != 1 {
+		t.Errorf("errors = %v", m.Errors)
+	}
+	if failed := belowMinSuccess([]modelReport{m}, 0.9); len(failed) != 1 {
+		t.Errorf("failed = %v", failed)
+	}
+	if !strings.Contains(renderMarkdown(benchReport{Models: []modelReport{m}}), "| m | 50.0% (2/4) |") {
+		t.Error("markdown row missing")
+	}
+}
+
+func TestRunModelAgainstServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.Write([]byte(`{"object":"list","data":[{"id":"a"},{"id":"b"}]}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	ids, err := fetchModels(server.Client(), server.URL, "k")
+	if err != nil || strings.Join(ids, ",") != "a,b" {
+		t.Fatalf("models = %v, err = %v", ids, err)
+	}
+	cfg := config{baseURL: server.URL, apiKey: "k", prompt: "hi", maxTokens: 8, requests: 3, concurrency: 2}
+	m := summarize("a", runModel(server.Client(), cfg, "a"))
+	if m.Success != 3 {
+		t.Errorf("report = %+v", m)
+	}
+}
@@ -0,0 +1,89 @@
+// migrate 数据库迁移工具
+//
+// 服务启动时会自动执行尚未执行的迁移；回滚到旧版本前，先用新版本的本工具回滚
+// 旧版本不认识的迁移。数据库连接与服务相同，读取 .env 中的 DB_TYPE / DATABASE_URL / DB_PATH。
+//
+// 用法:
+//
+//	go run ./cmd/migrate status           # 列出所有迁移及执行时间
+//	go run ./cmd/migrate up               # 建表并执行尚未执行的迁移
+//	go run ./cmd/migrate down -steps 1    # 回滚最近执行的迁移
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/service"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate status | up | down [-steps n]")
+	os.Exit(2)
+}
+
+func main() {
+	godotenv.Load()
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	dbType := os.Getenv("DB_TYPE")
+	dsn := service.GetSecret("DATABASE_URL")
+	// 与服务相同的向后兼容：未设置 DB_TYPE 和 DATABASE_URL 时使用 DB_PATH
+	if dbType == "" && dsn == "" {
+		dbType = "sqlite"
+		dsn = os.Getenv("DB_PATH")
+		if dsn == "" {
+			dsn = "data.db"
+		}
+	}
+
+	switch cmd := os.Args[1]; cmd {
+	case "status":
+		db, err := database.Open(dbType, dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		states, err := database.GetMigrationStatus(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s  %-19s  %s\n", s.Version, applied, s.Name)
+		}
+	case "up":
+		if err := database.Init(dbType, dsn); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("all migrations applied")
+	case "down":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		fs.Parse(os.Args[2:])
+		if *steps < 1 {
+			usage()
+		}
+		db, err := database.Open(dbType, dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rolledBack, err := database.Rollback(db, *steps)
+		for _, v := range rolledBack {
+			fmt.Printf("rolled back %s\n", v)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		usage()
+	}
+}
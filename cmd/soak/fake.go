@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/handler"
+	"zencoder2api/internal/middleware"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+// startFakeInstance 启动模拟上游，并在进程内启动一个指向它的实例
+// 实例使用临时 SQLite 数据库和真实的号池调度，只有上游是模拟的
+func startFakeInstance(accounts int, latency time.Duration, rate429 float64) (string, func(), error) {
+	upstream := httptest.NewServer(fakeUpstreamHandler(latency, rate429))
+
+	dir, err := os.MkdirTemp("", "zencoder-soak-")
+	if err != nil {
+		upstream.Close()
+		return "", nil, err
+	}
+	cleanupAll := func() {
+		upstream.Close()
+		os.RemoveAll(dir)
+	}
+
+	if err := database.Init("sqlite", filepath.Join(dir, "soak.db")); err != nil {
+		cleanupAll()
+		return "", nil, err
+	}
+	if err := seedFakeAccounts(accounts); err != nil {
+		cleanupAll()
+		return "", nil, err
+	}
+
+	service.SetUpstreamBase(upstream.URL)
+	service.InitAccountPool()
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	anthropicHandler := handler.NewAnthropicHandler()
+	openaiHandler := handler.NewOpenAIHandler()
+	tokenHandler := handler.NewTokenHandler()
+	r.POST("/v1/messages", middleware.LoggerMiddleware(), anthropicHandler.Messages)
+	r.POST("/v1/chat/completions", middleware.LoggerMiddleware(), openaiHandler.ChatCompletions)
+	r.GET("/api/tokens/pool-status", tokenHandler.GetPoolStatus)
+
+	instance := httptest.NewServer(r)
+	return instance.URL, func() {
+		instance.Close()
+		cleanupAll()
+	}, nil
+}
+
+// seedFakeAccounts 写入可直接调度的模拟账号
+func seedFakeAccounts(n int) error {
+	accounts := make([]model.Account, n)
+	for i := range accounts {
+		accounts[i] = model.Account{
+			ClientID:     fmt.Sprintf("soak-%d", i+1),
+			ClientSecret: "soak",
+			Email:        fmt.Sprintf("soak-%d@example.com", i+1),
+			Status:       "normal",
+			PlanType:     model.PlanMax,
+			AccessToken:  fmt.Sprintf("soak-token-%d", i+1),
+			TokenExpiry:  time.Now().Add(24 * time.Hour),
+			IsActive:     true,
+		}
+	}
+	return database.GetDB().Create(&accounts).Error
+}
+
+// fakeUpstreamHandler 模拟各服务商的非流式响应
+func fakeUpstreamHandler(latency time.Duration, rate429 float64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if rate429 > 0 && rand.Float64() < rate429 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"type":  "error",
+				"error": map[string]string{"type": "rate_limit_error", "message": "rate limited, see https://docs.claude.com/en/api/rate-limits"},
+			})
+			return
+		}
+
+		var resp interface{}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/anthropic/"):
+			resp = map[string]interface{}{
+				"id": "msg_soak", "type": "message", "role": "assistant", "model": "soak",
+				"content":     []map[string]string{{"type": "text", "text": "ok"}},
+				"stop_reason": "end_turn",
+				"usage":       map[string]int{"input_tokens": 10, "output_tokens": 1},
+			}
+		case strings.HasPrefix(r.URL.Path, "/openai/"):
+			resp = map[string]interface{}{
+				"id": "resp_soak", "object": "response", "status": "completed", "model": "soak",
+				"output": []map[string]interface{}{{
+					"type": "message", "role": "assistant",
+					"content": []map[string]string{{"type": "output_text", "text": "ok"}},
+				}},
+				"usage": map[string]int{"input_tokens": 10, "output_tokens": 1, "total_tokens": 11},
+			}
+		case strings.HasPrefix(r.URL.Path, "/gemini/"):
+			resp = map[string]interface{}{
+				"candidates": []map[string]interface{}{{
+					"content":      map[string]interface{}{"role": "model", "parts": []map[string]string{{"text": "ok"}}},
+					"finishReason": "STOP",
+				}},
+			}
+		default:
+			resp = map[string]interface{}{
+				"id": "chatcmpl-soak", "object": "chat.completion", "model": "soak",
+				"choices": []map[string]interface{}{{
+					"index": 0, "finish_reason": "stop",
+					"message": map[string]string{"role": "assistant", "content": "ok"},
+				}},
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,385 @@
+// soak 号池容量压测工具
+//
+// 以固定或逐级递增的 RPS 向 zencoder2api 实例发送合成请求，统计每一档的
+// 成功率、延迟分布以及号池饱和（没有可用token）比例。递增模式下以首个
+// 饱和档位之前的最大成功吞吐作为可持续容量，据此估算支撑目标负载所需的
+// 账号数和代理数。
+//
+// 用法:
+//
+//	go run ./cmd/soak -url http://localhost:7860 -model claude-haiku-4-5-20251001 -rps 1 -max-rps 10 -ramp-step 1 -duration 1m -target-rps 20
+//
+// 加 -fake-upstream 时在进程内启动模拟上游和实例，无需真实账号即可验证号池调度开销:
+//
+//	go run ./cmd/soak -fake-upstream -fake-accounts 20 -fake-latency 2s -rps 2 -max-rps 20 -ramp-step 2 -duration 30s
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type result struct {
+	status    int
+	latency   time.Duration
+	saturated bool
+	err       error
+}
+
+// stepResult 单个 RPS 档位的压测结果
+type stepResult struct {
+	targetRPS float64
+	results   []result
+	dropped   int
+	elapsed   time.Duration
+}
+
+type poolStatus struct {
+	TotalAccounts   int64 `json:"total_accounts"`
+	NormalAccounts  int64 `json:"normal_accounts"`
+	CoolingAccounts int64 `json:"cooling_accounts"`
+	ProxyCount      int   `json:"proxy_count"`
+}
+
+type config struct {
+	baseURL   string
+	apiKey    string
+	api       string
+	endpoint  string
+	body      []byte
+	conc      int
+	duration  time.Duration
+	threshold float64
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:7860", "zencoder2api 实例地址")
+	apiKey := flag.String("key", os.Getenv("AUTH_TOKEN"), "API 访问密钥 (默认读取 AUTH_TOKEN)")
+	adminPassword := flag.String("admin", os.Getenv("ADMIN_PASSWORD"), "管理密码，用于读取号池状态 (默认读取 ADMIN_PASSWORD)")
+	modelID := flag.String("model", "claude-haiku-4-5-20251001", "压测使用的模型")
+	api := flag.String("api", "anthropic", "请求格式: anthropic 或 openai")
+	rps := flag.Float64("rps", 1, "起始每秒请求数")
+	maxRPS := flag.Float64("max-rps", 0, "递增压测的最大RPS，0 表示只压测 -rps 一档")
+	rampStep := flag.Float64("ramp-step", 1, "递增压测每档增加的RPS")
+	targetRPS := flag.Float64("target-rps", 0, "需要支撑的业务RPS，用于估算账号/代理数 (默认取最高档)")
+	threshold := flag.Float64("saturation", 0.01, "失败(饱和/丢弃/错误)比例超过该值即视为该档饱和")
+	proxyRPS := flag.Float64("proxy-rps", 0, "单个代理出口可持续的RPS（上游按IP限流的经验值），0 表示不估算代理数")
+	concurrency := flag.Int("concurrency", 10, "最大并发请求数")
+	duration := flag.Duration("duration", time.Minute, "每档压测持续时间")
+	maxTokens := flag.Int("max-tokens", 16, "每个请求的 max_tokens")
+	timeout := flag.Duration("timeout", 2*time.Minute, "单个请求超时")
+	fakeUpstream := flag.Bool("fake-upstream", false, "在进程内启动模拟上游和实例（忽略 -url）")
+	fakeAccounts := flag.Int("fake-accounts", 10, "模拟模式下的账号数")
+	fakeLatency := flag.Duration("fake-latency", time.Second, "模拟上游的响应延迟")
+	fake429 := flag.Float64("fake-429", 0, "模拟上游返回429的比例 (0-1)")
+	flag.Parse()
+
+	if *rps <= 0 || *concurrency <= 0 || *rampStep <= 0 {
+		log.Fatal("rps、ramp-step 和 concurrency 必须大于0")
+	}
+
+	if *fakeUpstream {
+		url, cleanup, err := startFakeInstance(*fakeAccounts, *fakeLatency, *fake429)
+		if err != nil {
+			log.Fatalf("[Soak] 启动模拟实例失败: %v", err)
+		}
+		defer cleanup()
+		*baseURL = url
+		*adminPassword = ""
+		log.Printf("[Soak] 模拟模式: 实例=%s 账号=%d 上游延迟=%s 429比例=%.2f", url, *fakeAccounts, *fakeLatency, *fake429)
+	}
+
+	endpoint, body := buildRequest(*api, *modelID, *maxTokens)
+	client := &http.Client{Timeout: *timeout}
+	cfg := config{
+		baseURL:   *baseURL,
+		apiKey:    *apiKey,
+		api:       *api,
+		endpoint:  endpoint,
+		body:      body,
+		conc:      *concurrency,
+		duration:  *duration,
+		threshold: *threshold,
+	}
+
+	before, beforeErr := fetchPoolStatus(client, *baseURL, *adminPassword)
+
+	var steps []stepResult
+	for _, stepRPS := range rampSteps(*rps, *maxRPS, *rampStep) {
+		log.Printf("[Soak] 压测档位: %s %s 模型=%s rps=%.2f 并发=%d 时长=%s",
+			*api, endpoint, *modelID, stepRPS, *concurrency, *duration)
+		step := runStep(client, cfg, stepRPS)
+		steps = append(steps, step)
+		report(step)
+		if failureRatio(step) > *threshold {
+			log.Printf("[Soak] rps=%.2f 已饱和，停止递增", stepRPS)
+			break
+		}
+	}
+
+	after, afterErr := fetchPoolStatus(client, *baseURL, *adminPassword)
+
+	if *targetRPS <= 0 {
+		*targetRPS = steps[len(steps)-1].targetRPS
+	}
+	sustainable, saturated := sustainableRPS(steps, *threshold)
+	fmt.Println("========== 容量估算 ==========")
+	if sustainable == 0 {
+		fmt.Println("最低档位已饱和，请降低 -rps 后重试")
+		return
+	}
+	if saturated {
+		fmt.Printf("饱和点前最大可持续成功吞吐: %.2f req/s\n", sustainable)
+	} else {
+		fmt.Printf("未达到饱和，可持续成功吞吐至少 %.2f req/s（可提高 -max-rps 继续探测）\n", sustainable)
+	}
+
+	if beforeErr == nil && afterErr == nil {
+		reportPool(sustainable, saturated, *targetRPS, *proxyRPS, before, after)
+	} else {
+		log.Printf("[Soak] 无法读取号池状态，跳过账号/代理数估算（需要 -admin）")
+	}
+}
+
+// rampSteps 生成递增压测的 RPS 档位
+func rampSteps(start, max, step float64) []float64 {
+	steps := []float64{start}
+	for next := start + step; next <= max+1e-9; next += step {
+		steps = append(steps, next)
+	}
+	return steps
+}
+
+func runStep(client *http.Client, cfg config, rps float64) stepResult {
+	results := make(chan result, 1024)
+	sem := make(chan struct{}, cfg.conc)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rps))
+	deadline := time.After(cfg.duration)
+	start := time.Now()
+	dropped := 0
+
+	var collected []result
+	done := make(chan struct{})
+	go func() {
+		for r := range results {
+			collected = append(collected, r)
+		}
+		close(done)
+	}()
+
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+			select {
+			case sem <- struct{}{}:
+			default:
+				// 并发已满，说明实例处理不过来
+				dropped++
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results <- sendOnce(client, cfg.baseURL+cfg.endpoint, cfg.api, cfg.apiKey, cfg.body)
+			}()
+		}
+	}
+	ticker.Stop()
+	wg.Wait()
+	close(results)
+	<-done
+
+	return stepResult{targetRPS: rps, results: collected, dropped: dropped, elapsed: time.Since(start)}
+}
+
+func buildRequest(api, modelID string, maxTokens int) (string, []byte) {
+	// 两种格式的最小请求体相同，只有路径不同
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      modelID,
+		"max_tokens": maxTokens,
+		"messages":   []map[string]string{{"role": "user", "content": "Reply with the single word: ok"}},
+	})
+	if api == "openai" {
+		return "/v1/chat/completions", body
+	}
+	return "/v1/messages", body
+}
+
+func sendOnce(client *http.Client, url, api, apiKey string, body []byte) result {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return result{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		if api == "openai" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		} else {
+			req.Header.Set("x-api-key", apiKey)
+		}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{err: err, latency: time.Since(start)}
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	return result{
+		status:  resp.StatusCode,
+		latency: time.Since(start),
+		// 号池耗尽时处理器返回 503 "没有可用token"
+		saturated: resp.StatusCode == http.StatusServiceUnavailable && strings.Contains(string(respBody), "没有可用token"),
+	}
+}
+
+func fetchPoolStatus(client *http.Client, baseURL, adminPassword string) (poolStatus, error) {
+	var status poolStatus
+	req, err := http.NewRequest("GET", baseURL+"/api/tokens/pool-status", nil)
+	if err != nil {
+		return status, err
+	}
+	if adminPassword != "" {
+		req.Header.Set("X-Admin-Password", adminPassword)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("pool-status returned %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	return status, err
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func successCount(step stepResult) int {
+	success := 0
+	for _, r := range step.results {
+		if r.err == nil && r.status == http.StatusOK {
+			success++
+		}
+	}
+	return success
+}
+
+// failureRatio 该档位中未成功（含并发已满被丢弃）的请求比例
+func failureRatio(step stepResult) float64 {
+	attempted := len(step.results) + step.dropped
+	if attempted == 0 {
+		return 0
+	}
+	return float64(attempted-successCount(step)) / float64(attempted)
+}
+
+// sustainableRPS 返回首个饱和档位之前的最大成功吞吐，以及是否观察到饱和
+func sustainableRPS(steps []stepResult, threshold float64) (float64, bool) {
+	best := 0.0
+	for _, step := range steps {
+		if failureRatio(step) > threshold {
+			return best, true
+		}
+		if rps := float64(successCount(step)) / step.elapsed.Seconds(); rps > best {
+			best = rps
+		}
+	}
+	return best, false
+}
+
+func report(step stepResult) {
+	codes := make(map[int]int)
+	var latencies []time.Duration
+	saturated, netErrs := 0, 0
+
+	for _, r := range step.results {
+		if r.err != nil {
+			netErrs++
+			continue
+		}
+		codes[r.status]++
+		if r.saturated {
+			saturated++
+		}
+		if r.status == http.StatusOK {
+			latencies = append(latencies, r.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	total := len(step.results)
+	success := successCount(step)
+	elapsed := step.elapsed
+	fmt.Printf("========== rps=%.2f ==========\n", step.targetRPS)
+	fmt.Printf("持续时间: %s  实际发送RPS: %.2f  成功RPS: %.2f  失败比例: %.2f%%\n",
+		elapsed.Round(time.Second), float64(total)/elapsed.Seconds(), float64(success)/elapsed.Seconds(), failureRatio(step)*100)
+	fmt.Printf("请求数: %d  成功: %d  号池饱和(503): %d  网络错误: %d  并发已满丢弃: %d\n", total, success, saturated, netErrs, step.dropped)
+	fmt.Printf("延迟 P50: %s  P95: %s  P99: %s\n",
+		percentile(latencies, 50).Round(time.Millisecond),
+		percentile(latencies, 95).Round(time.Millisecond),
+		percentile(latencies, 99).Round(time.Millisecond))
+
+	statuses := make([]int, 0, len(codes))
+	for code := range codes {
+		statuses = append(statuses, code)
+	}
+	sort.Ints(statuses)
+	for _, code := range statuses {
+		fmt.Printf("  HTTP %d: %d\n", code, codes[code])
+	}
+}
+
+func reportPool(sustainable float64, saturated bool, targetRPS, proxyRPS float64, before, after poolStatus) {
+	fmt.Printf("号池: 正常账号 %d -> %d，冷却账号 %d -> %d，代理 %d\n",
+		before.NormalAccounts, after.NormalAccounts, before.CoolingAccounts, after.CoolingAccounts, before.ProxyCount)
+
+	accounts := before.NormalAccounts
+	if accounts == 0 {
+		fmt.Println("没有正常账号，无法估算容量")
+		return
+	}
+
+	perAccount := sustainable / float64(accounts)
+	neededAccounts := int(math.Ceil(targetRPS / perAccount))
+	fmt.Printf("单账号可持续吞吐: %.3f req/s\n", perAccount)
+	if saturated {
+		fmt.Printf("支撑 %.2f RPS 预计需要约 %d 个正常账号（当前 %d）\n", targetRPS, neededAccounts, accounts)
+	} else {
+		fmt.Printf("支撑 %.2f RPS 最多需要 %d 个正常账号（当前 %d，未饱和时为保守估算）\n", targetRPS, neededAccounts, accounts)
+	}
+
+	if proxyRPS > 0 {
+		neededProxies := int(math.Ceil(targetRPS / proxyRPS))
+		fmt.Printf("按单代理 %.2f RPS 计算，支撑 %.2f RPS 需要约 %d 个代理（当前 %d）\n", proxyRPS, targetRPS, neededProxies, before.ProxyCount)
+	}
+}
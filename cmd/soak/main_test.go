@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func fakeStep(rps float64, ok, saturated, dropped int) stepResult {
+	step := stepResult{targetRPS: rps, dropped: dropped, elapsed: 10 * time.Second}
+	for i := 0; i < ok; i++ {
+		step.results = append(step.results, result{status: http.StatusOK})
+	}
+	for i := 0; i < saturated; i++ {
+		step.results = append(step.results, result{status: http.StatusServiceUnavailable, saturated: true})
+	}
+	return step
+}
+
+func TestRampSteps(t *testing.T) {
+	got := rampSteps(1, 2, 0.5)
+	want := []float64{1, 1.5, 2}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if got := rampSteps(3, 0, 1); len(got) != 1 || got[0] != 3 {
+		t.Errorf("single step: got %v", got)
+	}
+}
+
+func TestSustainableRPS(t *testing.T) {
+	steps := []stepResult{
+		fakeStep(2, 20, 0, 0),
+		fakeStep(4, 40, 0, 0),
+		fakeStep(6, 45, 10, 5),
+	}
+
+	rps, saturated := sustainableRPS(steps, 0.01)
+	if !saturated || rps != 4 {
+		t.Errorf("got %.2f saturated=%v, want 4 saturated=true", rps, saturated)
+	}
+
+	rps, saturated = sustainableRPS(steps[:2], 0.01)
+	if saturated || rps != 4 {
+		t.Errorf("got %.2f saturated=%v, want 4 saturated=false", rps, saturated)
+	}
+
+	rps, saturated = sustainableRPS(steps[2:], 0.01)
+	if !saturated || rps != 0 {
+		t.Errorf("first step saturated: got %.2f saturated=%v", rps, saturated)
+	}
+}
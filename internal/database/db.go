@@ -15,10 +15,10 @@ import (
 
 var DB *gorm.DB
 
-// Init 初始化数据库连接
+// Open 只打开数据库连接，不建表也不执行迁移
 // dbType: sqlite, postgres, mysql
 // dsn: 数据库连接字符串
-func Init(dbType, dsn string) error {
+func Open(dbType, dsn string) (*gorm.DB, error) {
 	var dialector gorm.Dialector
 
 	switch strings.ToLower(dbType) {
@@ -29,24 +29,84 @@ func Init(dbType, dsn string) error {
 	case "sqlite", "":
 		dialector = sqlite.Open(dsn)
 	default:
-		return fmt.Errorf("unsupported database type: %s", dbType)
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
 
-	var err error
-	DB, err = gorm.Open(dialector, &gorm.Config{
+	return gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
+}
+
+// Init 初始化数据库连接，建表并执行尚未执行的迁移
+func Init(dbType, dsn string) error {
+	db, err := Prepare(dbType, dsn)
 	if err != nil {
 		return err
 	}
+	DB = db
+	// 重新连接时按顺序写入中断期间暂存的操作
+	healthy.Store(true)
+	replayQueue()
+	return nil
+}
 
-	return DB.AutoMigrate(
+// Prepare 打开数据库连接，建表并执行尚未执行的迁移，不替换全局连接
+func Prepare(dbType, dsn string) (*gorm.DB, error) {
+	db, err := Open(dbType, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.AutoMigrate(
 		&model.Account{},
 		&model.TokenRecord{},
 		&model.GenerationTask{},
-	)
+		&model.BatchJob{},
+		&model.BatchRequest{},
+		&model.AdminJob{},
+		&model.AccountUsageDaily{},
+		&model.PoolRejectionDaily{},
+		&model.IdempotencyRecord{},
+		&model.APIKey{},
+		&model.ModelAlias{},
+		&model.ModelRecord{},
+		&model.RequestLog{},
+		&model.DeadLetter{},
+		&model.Setting{},
+		&model.PoolProxy{},
+	); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	if err := Migrate(db); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close 关闭数据库连接并清空暂存的写操作，之后 Healthy 返回 false、Exec 返回 ErrUnavailable
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	healthy.Store(false)
+	resetQueue()
+	db := DB
+	DB = nil
+	return closeDB(db)
+}
+
+// closeDB 关闭 gorm 连接的底层连接池
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
+// GetDB 返回数据库连接，未初始化时为 nil；请求路径中先用 Healthy 判断，写操作使用 Exec
 func GetDB() *gorm.DB {
 	return DB
 }
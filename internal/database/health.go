@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnavailable 数据库未初始化或连接中断
+var ErrUnavailable = errors.New("database unavailable")
+
+const (
+	// execRetries 写入失败时的重试次数（不含首次）
+	execRetries = 2
+	// execRetryDelay 首次重试的等待时间，之后每次翻倍
+	execRetryDelay = 100 * time.Millisecond
+	// defaultMaxQueued 降级期间最多缓存的写操作数，超出时丢弃最早的
+	defaultMaxQueued = 10000
+)
+
+type queuedMutation struct {
+	desc string
+	fn   func(*gorm.DB) error
+}
+
+// HealthStatus 数据库健康状态
+type HealthStatus struct {
+	Healthy          bool      `json:"healthy"`
+	Since            time.Time `json:"since"`                  // 进入当前状态的时间
+	LastError        string    `json:"last_error,omitempty"`   // 最近一次连接失败的原因
+	QueuedMutations  int       `json:"queued_mutations"`       // 等待恢复后写入的操作数
+	DroppedMutations uint64    `json:"dropped_mutations"`      // 因队列已满丢弃的操作数
+	ReadReplica      *bool     `json:"read_replica,omitempty"` // 只读副本是否可用，未配置副本时省略
+}
+
+var (
+	healthy atomic.Bool
+
+	healthMu  sync.Mutex
+	since     = time.Now()
+	lastError string
+	queue     []queuedMutation
+	dropped   uint64
+	// replayMu 回放时独占，保证回放期间的新写入排在队尾
+	replayMu sync.RWMutex
+
+	monitorOnce sync.Once
+)
+
+// Healthy 数据库是否可用，未初始化时返回 false
+func Healthy() bool {
+	return DB != nil && healthy.Load()
+}
+
+// GetHealth 返回数据库健康状态
+func GetHealth() HealthStatus {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return HealthStatus{
+		Healthy:          Healthy(),
+		Since:            since,
+		LastError:        lastError,
+		QueuedMutations:  len(queue),
+		DroppedMutations: dropped,
+		ReadReplica:      readReplicaStatus(),
+	}
+}
+
+func readReplicaStatus() *bool {
+	if ReadDB == nil {
+		return nil
+	}
+	ok := replicaHealthy.Load()
+	return &ok
+}
+
+// Ping 检查数据库连接
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return ErrUnavailable
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// InitWithRetry 初始化数据库，失败时按 DB_INIT_RETRIES（默认 5 次）重试，间隔逐次翻倍
+func InitWithRetry(dbType, dsn string) error {
+	retries := envInt("DB_INIT_RETRIES", 5)
+	delay := time.Second
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = Init(dbType, dsn); err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return err
+		}
+		log.Printf("[WARN] [Database] 初始化失败，%s 后重试 (%d/%d): %v", delay, attempt+1, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// HealthCheckInterval 连接检查间隔，读取 DB_HEALTH_INTERVAL（秒，默认 10）
+func HealthCheckInterval() time.Duration {
+	if seconds := envInt("DB_HEALTH_INTERVAL", 10); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// StartHealthMonitor 定期检查连接，中断时进入降级模式，恢复后回放缓存的写操作
+func StartHealthMonitor() {
+	monitorOnce.Do(func() {
+		interval := HealthCheckInterval()
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				checkHealth()
+			}
+		}()
+	})
+}
+
+func checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	checkReplicaHealth(ctx)
+	if err := Ping(ctx); err != nil {
+		markUnhealthy(err)
+		return
+	}
+	markHealthy()
+}
+
+func markUnhealthy(err error) {
+	healthMu.Lock()
+	lastError = err.Error()
+	if healthy.Swap(false) {
+		since = time.Now()
+		log.Printf("[Database] 连接中断，进入降级模式（号池使用内存快照，写操作暂存）: %v", err)
+	}
+	healthMu.Unlock()
+}
+
+func markHealthy() {
+	if DB == nil {
+		return
+	}
+	if !healthy.Load() {
+		healthMu.Lock()
+		since = time.Now()
+		healthMu.Unlock()
+		log.Printf("[Database] 连接已恢复")
+	}
+	healthy.Store(true)
+	replayQueue()
+}
+
+// replayQueue 按提交顺序回放降级期间缓存的写操作，失败时重新进入降级模式并保留剩余操作
+func replayQueue() {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	replayed := 0
+	for {
+		healthMu.Lock()
+		if len(queue) == 0 {
+			healthMu.Unlock()
+			break
+		}
+		m := queue[0]
+		healthMu.Unlock()
+
+		if err := m.fn(DB); err != nil && isConnectionError(err) {
+			markUnhealthy(err)
+			return
+		} else if err != nil {
+			log.Printf("[WARN] [Database] 回放写操作失败，已丢弃 (%s): %v", m.desc, err)
+		}
+
+		healthMu.Lock()
+		queue = queue[1:]
+		healthMu.Unlock()
+		replayed++
+	}
+	if replayed > 0 {
+		log.Printf("[Database] 已回放 %d 个降级期间缓存的写操作", replayed)
+	}
+}
+
+// resetQueue 关闭连接时丢弃暂存的写操作
+func resetQueue() {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	if len(queue) > 0 {
+		log.Printf("[Database] 丢弃 %d 个未写入的暂存操作", len(queue))
+	}
+	queue = nil
+	since = time.Now()
+	lastError = ""
+}
+
+func enqueue(desc string, fn func(*gorm.DB) error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	if max := envInt("DB_QUEUE_MAX", defaultMaxQueued); max > 0 && len(queue) >= max {
+		log.Printf("[Database] 写操作队列已满，丢弃最早的操作: %s", queue[0].desc)
+		queue = queue[1:]
+		dropped++
+	}
+	queue = append(queue, queuedMutation{desc: desc, fn: fn})
+}
+
+// Exec 执行写操作；连接错误时短暂重试，仍失败则进入降级模式并暂存该操作，恢复后按顺序写入
+// 返回 nil 表示已写入或已暂存，数据库未初始化时返回 ErrUnavailable 且不暂存，其余错误（如约束冲突）原样返回
+func Exec(desc string, fn func(*gorm.DB) error) error {
+	if DB == nil {
+		return ErrUnavailable
+	}
+	if !Healthy() {
+		enqueue(desc, fn)
+		return nil
+	}
+
+	// 回放未完成时排队，保证写入顺序
+	replayMu.RLock()
+	healthMu.Lock()
+	pending := len(queue) > 0
+	healthMu.Unlock()
+	if pending {
+		replayMu.RUnlock()
+		enqueue(desc, fn)
+		return nil
+	}
+	defer replayMu.RUnlock()
+
+	delay := execRetryDelay
+	var err error
+	for attempt := 0; attempt <= execRetries; attempt++ {
+		if err = fn(DB); err == nil || !isConnectionError(err) {
+			return err
+		}
+		if attempt < execRetries {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	markUnhealthy(err)
+	enqueue(desc, fn)
+	return nil
+}
+
+// isConnectionError 错误是否由连接问题引起：查询本身的错误（记录不存在、约束冲突等）不重试
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return Ping(ctx) != nil
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestExecQueuesWritesWhileUnavailable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "health.db")
+	if err := Init("sqlite", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Create(&model.Account{ClientID: "a", Email: "a@example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 关闭底层连接模拟数据库中断
+	sqlDB, _ := DB.DB()
+	sqlDB.Close()
+	rename := func(email string) func(*gorm.DB) error {
+		return func(db *gorm.DB) error {
+			return db.Model(&model.Account{}).Where("client_id = ?", "a").Update("email", email).Error
+		}
+	}
+	if err := Exec("rename", rename("b@example.com")); err != nil {
+		t.Fatalf("Exec = %v, want queued", err)
+	}
+	if Healthy() {
+		t.Fatal("database should be marked unavailable after a connection error")
+	}
+	if err := Exec("rename", rename("c@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetHealth().QueuedMutations; got != 2 {
+		t.Fatalf("queued = %d, want 2", got)
+	}
+
+	// 重新连接后按顺序回放
+	if err := Init("sqlite", path); err != nil {
+		t.Fatal(err)
+	}
+	checkHealth()
+	if got := GetHealth(); !got.Healthy || got.QueuedMutations != 0 {
+		t.Fatalf("health = %+v, want healthy with empty queue", got)
+	}
+	var acc model.Account
+	DB.Where("client_id = ?", "a").First(&acc)
+	if acc.Email != "c@example.com" {
+		t.Errorf("email = %q, want the last queued write", acc.Email)
+	}
+}
+
+func TestExecReturnsQueryErrors(t *testing.T) {
+	if err := Init("sqlite", filepath.Join(t.TempDir(), "health.db")); err != nil {
+		t.Fatal(err)
+	}
+	err := Exec("bad", func(db *gorm.DB) error {
+		return db.Exec("UPDATE no_such_table SET x = 1").Error
+	})
+	if err == nil {
+		t.Fatal("query error should be returned, not queued")
+	}
+	if !Healthy() || GetHealth().QueuedMutations != 0 {
+		t.Errorf("health = %+v, want healthy with empty queue", GetHealth())
+	}
+}
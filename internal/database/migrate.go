@@ -0,0 +1,137 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一次版本化的数据库变更
+// AutoMigrate 只负责建表和新增列，数据修正、删列、改类型等需要精确执行一次的变更写成迁移
+type Migration struct {
+	Version string // 按字典序执行，使用 YYYYMMDDNN 格式
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // 为 nil 表示不可回滚
+}
+
+// MigrationState 迁移及其执行状态
+type MigrationState struct {
+	Version   string     `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Migrate 按版本顺序执行尚未执行的迁移，每个迁移与其执行记录在同一事务中提交
+func Migrate(db *gorm.DB) error {
+	return runMigrations(db, migrations)
+}
+
+// Rollback 按执行顺序倒序回滚最近 steps 个迁移，返回已回滚的版本
+func Rollback(db *gorm.DB, steps int) ([]string, error) {
+	return rollbackMigrations(db, migrations, steps)
+}
+
+// GetMigrationStatus 返回所有迁移及执行时间，未执行的 AppliedAt 为 nil
+func GetMigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		result[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			appliedAt := record.AppliedAt
+			result[i].AppliedAt = &appliedAt
+		}
+	}
+	return result, nil
+}
+
+func appliedMigrations(db *gorm.DB) (map[string]model.SchemaMigration, error) {
+	if err := db.AutoMigrate(&model.SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var records []model.SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[string]model.SchemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func runMigrations(db *gorm.DB, list []Migration) error {
+	if err := validateMigrations(list); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&model.SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("迁移 %s (%s) 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("[Migrate] 已执行迁移 %s: %s", m.Version, m.Name)
+	}
+	return nil
+}
+
+func rollbackMigrations(db *gorm.DB, list []Migration, steps int) ([]string, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var rolledBack []string
+	for i := len(list) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+		m := list[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return rolledBack, fmt.Errorf("迁移 %s (%s) 不可回滚", m.Version, m.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&model.SchemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("回滚 %s (%s) 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("[Migrate] 已回滚迁移 %s: %s", m.Version, m.Name)
+		rolledBack = append(rolledBack, m.Version)
+	}
+	return rolledBack, nil
+}
+
+// validateMigrations 版本必须唯一且递增，避免合并分支后执行顺序不确定
+func validateMigrations(list []Migration) error {
+	for i, m := range list {
+		if m.Version == "" || m.Up == nil {
+			return fmt.Errorf("迁移 %q 缺少版本号或 Up", m.Name)
+		}
+		if i > 0 && m.Version <= list[i-1].Version {
+			return fmt.Errorf("迁移版本 %s 必须大于 %s", m.Version, list[i-1].Version)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestInitRecordsMigrations(t *testing.T) {
+	if err := Init("sqlite", filepath.Join(t.TempDir(), "migrate.db")); err != nil {
+		t.Fatal(err)
+	}
+	states, err := GetMigrationStatus(DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %s not applied by Init", s.Version)
+		}
+	}
+}
+
+func TestMigrationsApplyOnceAndRollBack(t *testing.T) {
+	db, err := Open("sqlite", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.Account{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ups, downs := map[string]int{}, map[string]int{}
+	step := func(version string) Migration {
+		return Migration{
+			Version: version,
+			Name:    "insert " + version,
+			Up: func(tx *gorm.DB) error {
+				ups[version]++
+				return tx.Create(&model.Account{ClientID: version}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				downs[version]++
+				return tx.Where("client_id = ?", version).Delete(&model.Account{}).Error
+			},
+		}
+	}
+	list := []Migration{step("2025010101"), step("2025010102")}
+
+	for i := 0; i < 2; i++ {
+		if err := runMigrations(db, list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ups["2025010101"] != 1 || ups["2025010102"] != 1 {
+		t.Fatalf("ups = %v, want each once", ups)
+	}
+
+	rolledBack, err := rollbackMigrations(db, list, 1)
+	if err != nil || len(rolledBack) != 1 || rolledBack[0] != "2025010102" {
+		t.Fatalf("rollback = %v, %v", rolledBack, err)
+	}
+	var count int64
+	db.Model(&model.Account{}).Where("client_id = ?", "2025010102").Count(&count)
+	if count != 0 || downs["2025010102"] != 1 {
+		t.Errorf("down not applied: count=%d downs=%v", count, downs)
+	}
+
+	// 回滚后再次执行只重新执行被回滚的迁移
+	if err := runMigrations(db, list); err != nil {
+		t.Fatal(err)
+	}
+	if ups["2025010101"] != 1 || ups["2025010102"] != 2 {
+		t.Errorf("ups after re-run = %v", ups)
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	db, err := Open("sqlite", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.Account{}); err != nil {
+		t.Fatal(err)
+	}
+	list := []Migration{{
+		Version: "2025010101",
+		Name:    "half done",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Create(&model.Account{ClientID: "partial"}).Error; err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	}}
+	if err := runMigrations(db, list); err == nil {
+		t.Fatal("expected error")
+	}
+
+	var accounts, records int64
+	db.Model(&model.Account{}).Count(&accounts)
+	db.Model(&model.SchemaMigration{}).Count(&records)
+	if accounts != 0 || records != 0 {
+		t.Errorf("accounts=%d records=%d, want transaction rolled back", accounts, records)
+	}
+	if _, err := rollbackMigrations(db, list, 1); err != nil {
+		t.Errorf("rollback of unapplied migration: %v", err)
+	}
+}
+
+func TestValidateMigrationsOrder(t *testing.T) {
+	noop := func(*gorm.DB) error { return nil }
+	if err := validateMigrations(migrations); err != nil {
+		t.Fatalf("registered migrations invalid: %v", err)
+	}
+	if err := validateMigrations([]Migration{{Version: "2", Up: noop}, {Version: "1", Up: noop}}); err == nil {
+		t.Error("out-of-order versions accepted")
+	}
+}
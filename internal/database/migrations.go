@@ -0,0 +1,40 @@
+package database
+
+import (
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// migrations 按版本顺序排列的全部迁移，新迁移追加在末尾，已发布的迁移不要修改
+var migrations = []Migration{
+	{
+		// 原先每次启动都执行的状态迁移：把 is_active / is_cooling / category 等旧字段折算为 status
+		Version: "2025010101",
+		Name:    "account status from legacy fields",
+		Up: func(tx *gorm.DB) error {
+			steps := []struct {
+				query  string
+				args   []interface{}
+				status string
+			}{
+				{"status = '' OR status IS NULL", nil, "normal"},
+				{"is_cooling = ?", []interface{}{true}, "cooling"},
+				{"is_active = ? AND error_count >= ?", []interface{}{false, model.MaxAccountErrors}, "error"},
+				{"is_active = ? AND is_cooling = ? AND error_count < ?", []interface{}{false, false, model.MaxAccountErrors}, "disabled"},
+				{"category = ?", []interface{}{"banned"}, "banned"},
+				{"category = ?", []interface{}{"error"}, "error"},
+				{"category = ?", []interface{}{"cooling"}, "cooling"},
+				{"category = ?", []interface{}{"abnormal"}, "cooling"},
+			}
+			for _, s := range steps {
+				if err := tx.Model(&model.Account{}).Where(s.query, s.args...).Update("status", s.status).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// 旧字段未改动，回滚到旧版本时无需处理
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// ReadDB 只读副本连接，未配置 DATABASE_READ_URL 时为 nil
+var ReadDB *gorm.DB
+
+var replicaHealthy atomic.Bool
+
+// InitReadReplica 打开只读副本，只用于后台列表和统计查询，不建表也不执行迁移；
+// 副本与主库使用同一种数据库类型，SQLite 不支持
+func InitReadReplica(dbType, dsn string) error {
+	switch strings.ToLower(dbType) {
+	case "sqlite", "":
+		log.Printf("[Database] SQLite 不支持只读副本，已忽略 DATABASE_READ_URL")
+		return nil
+	}
+	db, err := Open(dbType, dsn)
+	if err != nil {
+		return err
+	}
+	ReadDB = db
+	replicaHealthy.Store(true)
+	log.Printf("[Database] 已启用只读副本，后台列表和统计查询从副本读取")
+	return nil
+}
+
+// GetReadDB 返回用于后台列表和统计查询的连接：副本可用时为副本，否则为主库。
+// 副本有复制延迟，刚写入的数据可能稍后才能查到；请求路径和先写后读的操作使用 GetDB
+func GetReadDB() *gorm.DB {
+	if ReadDB != nil && replicaHealthy.Load() {
+		return ReadDB
+	}
+	return DB
+}
+
+// ReadReplicaHealthy 副本是否可用，未配置副本时返回 false
+func ReadReplicaHealthy() bool {
+	return ReadDB != nil && replicaHealthy.Load()
+}
+
+// checkReplicaHealth 检查副本连接，中断时读取回退到主库，恢复后重新使用副本
+func checkReplicaHealth(ctx context.Context) {
+	if ReadDB == nil {
+		return
+	}
+	sqlDB, err := ReadDB.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		if replicaHealthy.Swap(false) {
+			log.Printf("[Database] 只读副本连接中断，后台查询回退到主库: %v", err)
+		}
+		return
+	}
+	if !replicaHealthy.Swap(true) {
+		log.Printf("[Database] 只读副本连接已恢复")
+	}
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetReadDBFallsBackToPrimary(t *testing.T) {
+	if err := Init("sqlite", filepath.Join(t.TempDir(), "primary.db")); err != nil {
+		t.Fatal(err)
+	}
+	if GetReadDB() != DB || GetHealth().ReadReplica != nil {
+		t.Fatal("without a replica reads should use the primary")
+	}
+
+	replica, err := Open("sqlite", filepath.Join(t.TempDir(), "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ReadDB = replica
+	replicaHealthy.Store(true)
+	t.Cleanup(func() { ReadDB = nil })
+	if GetReadDB() != replica {
+		t.Fatal("healthy replica should serve reads")
+	}
+
+	// 副本中断时回退到主库
+	sqlDB, _ := replica.DB()
+	sqlDB.Close()
+	checkReplicaHealth(context.Background())
+	if GetReadDB() != DB || *GetHealth().ReadReplica {
+		t.Error("unavailable replica should fall back to the primary")
+	}
+}
+
+func TestInitReadReplicaIgnoresSQLite(t *testing.T) {
+	if err := InitReadReplica("sqlite", "replica.db"); err != nil || ReadDB != nil {
+		t.Errorf("InitReadReplica(sqlite) = %v, ReadDB = %v; want ignored", err, ReadDB)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"zencoder2api/internal/database"
 	"zencoder2api/internal/model"
 	"zencoder2api/internal/service"
+	"zencoder2api/internal/service/provider"
 )
 
 type AccountHandler struct{}
@@ -45,7 +46,7 @@ func (h *AccountHandler) List(c *gin.Context) {
 	var accounts []model.Account
 	var total int64
 
-	query := database.GetDB().Model(&model.Account{})
+	query := database.GetReadDB().Model(&model.Account{})
 	if status != "all" {
 		query = query.Where("status = ?", status)
 	}
@@ -73,6 +74,10 @@ func (h *AccountHandler) List(c *gin.Context) {
 		}
 	}
 
+	for i := range accounts {
+		accounts[i].ProxyHealth = service.AccountProxyHealth(&accounts[i])
+	}
+
 	// Calculate Stats
 	var stats struct {
 		TotalAccounts  int64   `json:"total_accounts"`
@@ -85,7 +90,7 @@ func (h *AccountHandler) List(c *gin.Context) {
 		TotalUsage     float64 `json:"total_usage"`
 	}
 
-	db := database.GetDB()
+	db := database.GetReadDB()
 
 	db.Model(&model.Account{}).Count(&stats.TotalAccounts)
 	db.Model(&model.Account{}).Where("status = ?", "normal").Count(&stats.NormalAccounts)
@@ -194,35 +199,19 @@ func (h *AccountHandler) BatchMoveAll(c *gin.Context) {
 		return
 	}
 
-	updates := map[string]interface{}{
-		"status": req.ToStatus,
-		// 兼容旧字段
-		"category": req.ToStatus,
+	updates, ok := service.MoveStatusUpdates(req.ToStatus)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to_status"})
+		return
 	}
 
-	// 根据目标状态设置相应的标志
-	switch req.ToStatus {
-	case "normal":
-		updates["is_active"] = true
-		updates["is_cooling"] = false
-		updates["error_count"] = 0
-		updates["ban_reason"] = ""
-	case "cooling":
-		updates["is_active"] = false
-		updates["is_cooling"] = true
-		updates["ban_reason"] = ""
-	case "disabled":
-		updates["is_active"] = false
-		updates["is_cooling"] = false
-		updates["ban_reason"] = ""
-	case "banned":
-		updates["is_active"] = false
-		updates["is_cooling"] = false
-	case "error":
-		updates["is_active"] = false
-		updates["is_cooling"] = false
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to_status"})
+	// 账号较多时转为后台任务
+	var ids []uint
+	if err := database.GetDB().Model(&model.Account{}).Where("status = ?", req.FromStatus).Order("id").Pluck("id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if startAdminJob(c, model.AdminJobMove, ids, req.FromStatus, req.ToStatus) {
 		return
 	}
 
@@ -262,18 +251,6 @@ func (h *AccountHandler) BatchRefreshToken(c *gin.Context) {
 		return
 	}
 
-	// 设置流式响应头
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no")
-
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "流式传输不支持"})
-		return
-	}
-
 	var accounts []model.Account
 	var err error
 
@@ -304,6 +281,27 @@ func (h *AccountHandler) BatchRefreshToken(c *gin.Context) {
 		return
 	}
 
+	// 账号较多时转为后台任务，避免长时间的流式响应超过 HTTP 超时
+	ids := make([]uint, len(accounts))
+	for i := range accounts {
+		ids[i] = accounts[i].ID
+	}
+	if startAdminJob(c, model.AdminJobRefreshToken, ids, "", "") {
+		return
+	}
+
+	// 设置流式响应头（放在校验之后，出错时仍按 JSON 返回）
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "流式传输不支持"})
+		return
+	}
+
 	// 发送开始消息
 	fmt.Fprintf(c.Writer, "data: {\"type\":\"start\",\"total\":%d}\n\n", len(accounts))
 	flusher.Flush()
@@ -325,7 +323,7 @@ func (h *AccountHandler) BatchRefreshToken(c *gin.Context) {
 				errMsg = fmt.Sprintf("账号被锁定已自动标记为封禁: %s", lockoutErr.Body)
 				log.Printf("[批量刷新Token] 第 %d/%d 个账号被锁定: %s - %s", i+1, len(accounts), account.ClientID, lockoutErr.Body)
 			} else {
-				log.Printf("[批量刷新Token] 第 %d/%d 个账号刷新失败: %s - %v", i+1, len(accounts), account.ClientID, err)
+				log.Printf("[WARN] [批量刷新Token] 第 %d/%d 个账号刷新失败: %s - %v", i+1, len(accounts), account.ClientID, err)
 			}
 			
 			fmt.Fprintf(c.Writer, "data: {\"type\":\"error\",\"index\":%d,\"account_id\":\"%s\",\"message\":\"%s\"}\n\n", i+1, account.ClientID, errMsg)
@@ -398,6 +396,7 @@ func (h *AccountHandler) Create(c *gin.Context) {
 			ClientID:     cred.ClientID,
 			ClientSecret: cred.Secret,
 			Proxy:        req.Proxy,
+			ProxyRegion:  provider.NormalizeProxyRegion(req.ProxyRegion),
 			IsActive:     true,
 			Status:       "normal",
 		}
@@ -449,6 +448,9 @@ func (h *AccountHandler) Create(c *gin.Context) {
 			if account.Proxy != "" {
 				existing.Proxy = account.Proxy
 			}
+			if account.ProxyRegion != "" {
+				existing.ProxyRegion = account.ProxyRegion
+			}
 
 			if err := database.GetDB().Save(&existing).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("更新失败: %v", err)})
@@ -472,9 +474,10 @@ func (h *AccountHandler) Create(c *gin.Context) {
 
 	// 原有的单个账号添加逻辑 - 现在使用 refresh_token
 	account := model.Account{
-		Proxy:    req.Proxy,
-		IsActive: true,
-		Status:   "normal",
+		Proxy:       req.Proxy,
+		ProxyRegion: provider.NormalizeProxyRegion(req.ProxyRegion),
+		IsActive:    true,
+		Status:      "normal",
 	}
 
 	// 优先使用 access_token，如果同时提供了两个字段则不使用 refresh_token
@@ -566,7 +569,7 @@ func (h *AccountHandler) Create(c *gin.Context) {
 			log.Printf("[凭证模式-RefreshToken] 解析JWT成功: ClientID=%s, Email=%s, Plan=%s",
 				account.ClientID, account.Email, account.PlanType)
 		} else {
-			log.Printf("[凭证模式-RefreshToken] 解析JWT失败: %v", err)
+			log.Printf("[WARN] [凭证模式-RefreshToken] 解析JWT失败: %v", err)
 			// 如果JWT解析失败，使用 tokenResp 中的信息
 			if tokenResp.UserID != "" {
 				account.ClientID = tokenResp.UserID
@@ -642,6 +645,9 @@ func (h *AccountHandler) Create(c *gin.Context) {
 		if account.Proxy != "" {
 			existing.Proxy = account.Proxy
 		}
+		if account.ProxyRegion != "" {
+			existing.ProxyRegion = account.ProxyRegion
+		}
 		// If secret was provided manually, update it. If placeholder, keep existing.
 		if account.ClientSecret != "jwt-login" && account.ClientSecret != "refresh-token-login" {
 			existing.ClientSecret = account.ClientSecret
@@ -663,6 +669,42 @@ func (h *AccountHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, account)
 }
 
+// accountUpdates 把修改请求转换为要更新的列，省略的字段不修改
+func accountUpdates(req model.AccountUpdateRequest) (map[string]interface{}, error) {
+	updates := make(map[string]interface{})
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if email == "" {
+			return nil, fmt.Errorf("email must not be empty")
+		}
+		updates["email"] = email
+	}
+	if req.PlanType != nil {
+		if _, ok := model.PlanLimits[*req.PlanType]; !ok {
+			return nil, fmt.Errorf("unknown plan_type %q", *req.PlanType)
+		}
+		updates["plan_type"] = *req.PlanType
+	}
+	if req.Proxy != nil {
+		proxy := strings.TrimSpace(*req.Proxy)
+		// 空字符串表示清除账号代理
+		if proxy != "" {
+			if _, err := provider.ParseProxyURL(proxy); err != nil {
+				return nil, fmt.Errorf("invalid proxy url: %v", err)
+			}
+		}
+		updates["proxy"] = proxy
+	}
+	if req.ProxyRegion != nil {
+		updates["proxy_region"] = provider.NormalizeProxyRegion(*req.ProxyRegion)
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("at least one of email, plan_type, proxy, proxy_region is required")
+	}
+	return updates, nil
+}
+
+// Update 处理 PATCH/PUT /api/accounts/:id，只修改请求体中出现的字段
 func (h *AccountHandler) Update(c *gin.Context) {
 	id := c.Param("id")
 	var account model.Account
@@ -671,17 +713,18 @@ func (h *AccountHandler) Update(c *gin.Context) {
 		return
 	}
 
-	var req model.AccountRequest
+	var req model.AccountUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	updates, err := accountUpdates(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	account.Email = req.Email
-	account.PlanType = req.PlanType
-	account.Proxy = req.Proxy
-
-	if err := database.GetDB().Save(&account).Error; err != nil {
+	if err := database.GetDB().Model(&account).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -698,6 +741,7 @@ func (h *AccountHandler) BatchDelete(c *gin.Context) {
 	}
 
 	var deletedCount int64
+	var revokingCount int
 
 	if req.DeleteAll {
 		// 删除指定分类的所有账号
@@ -706,14 +750,24 @@ func (h *AccountHandler) BatchDelete(c *gin.Context) {
 			return
 		}
 
+		// 账号较多时转为后台任务
+		var ids []uint
+		if err := database.GetDB().Model(&model.Account{}).Where("status = ?", req.Status).Order("id").Pluck("id", &ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if startAdminJob(c, model.AdminJobDelete, ids, req.Status, "") {
+			return
+		}
+
 		// 执行删除操作
-		result := database.GetDB().Where("status = ?", req.Status).Delete(&model.Account{})
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		deleted, revoking, err := service.DeleteAccounts(ids, req.Status)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		deletedCount = result.RowsAffected
+		deletedCount, revokingCount = deleted, revoking
 		log.Printf("[批量删除] 删除分类 %s 的所有账号，共删除 %d 个", req.Status, deletedCount)
 
 	} else {
@@ -723,30 +777,83 @@ func (h *AccountHandler) BatchDelete(c *gin.Context) {
 			return
 		}
 
+		if startAdminJob(c, model.AdminJobDelete, req.IDs, "", "") {
+			return
+		}
+
 		// 执行删除操作
-		result := database.GetDB().Where("id IN ?", req.IDs).Delete(&model.Account{})
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		deleted, revoking, err := service.DeleteAccounts(req.IDs, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		deletedCount = result.RowsAffected
+		deletedCount, revokingCount = deleted, revoking
 		log.Printf("[批量删除] 删除选中的 %d 个账号，实际删除 %d 个", len(req.IDs), deletedCount)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "批量删除成功",
-		"deleted_count": deletedCount,
+		"message":              "批量删除成功",
+		"deleted_count":        deletedCount,
+		"revoking_credentials": revokingCount, // 后台吊销上游凭证的数量
 	})
 }
 
+// Delete 删除账号，client 凭证账号的上游凭证在后台吊销
 func (h *AccountHandler) Delete(c *gin.Context) {
-	id := c.Param("id")
-	if err := database.GetDB().Delete(&model.Account{}, id).Error; err != nil {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	_, revoking, err := service.DeleteAccounts([]uint{uint(id)}, "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+	c.JSON(http.StatusOK, gin.H{"message": "deleted", "revoking_credentials": revoking})
+}
+
+type RotateCredentialRequest struct {
+	Token        string `json:"token"`         // 生成新凭证使用的 access_token，为空时使用同邮箱的 Token 记录
+	RefreshToken string `json:"refresh_token"` // 未提供 token 时用于换取 access_token
+}
+
+// RotateCredential 为账号生成并验证新的 client 凭证，替换后吊销旧凭证
+func (h *AccountHandler) RotateCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req RotateCredentialRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	masterToken := req.Token
+	if masterToken == "" && req.RefreshToken != "" {
+		tokenResp, err := service.RefreshAccessToken(req.RefreshToken, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "RefreshToken 无效: " + err.Error()})
+			return
+		}
+		masterToken = tokenResp.AccessToken
+	}
+
+	result, err := service.RotateAccountCredential(uint(id), masterToken)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == service.ErrCredentialRotationBusy {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
 }
 
 func (h *AccountHandler) Toggle(c *gin.Context) {
@@ -772,3 +879,100 @@ func (h *AccountHandler) Toggle(c *gin.Context) {
 
 	c.JSON(http.StatusOK, account)
 }
+
+// maxDrainWait 排空接口最长等待时间
+const maxDrainWait = 5 * time.Minute
+
+// Drain 停止向账号调度新请求，进行中的请求和流正常结束；?wait=秒 时等待排空完成后返回。
+// 响应中 safe 为 true 时可以安全地刷新、修改代理或删除账号
+func (h *AccountHandler) Drain(c *gin.Context) {
+	id, ok := existingAccountID(c)
+	if !ok {
+		return
+	}
+	wait := 0
+	if raw := c.Query("wait"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wait 必须是非负整数（秒）"})
+			return
+		}
+		wait = n
+	}
+
+	status := service.DrainAccount(id, time.Now())
+	log.Printf("[Drain] 账号 %d 开始排空，进行中的请求: %d，响应: %d", id, status.ActiveRequests, status.OpenResponses)
+	if wait > 0 && !status.Safe {
+		timeout := time.Duration(wait) * time.Second
+		if timeout > maxDrainWait {
+			timeout = maxDrainWait
+		}
+		status = service.WaitAccountDrained(c.Request.Context(), id, timeout)
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// DrainStatus 获取账号的排空状态
+func (h *AccountHandler) DrainStatus(c *gin.Context) {
+	id, ok := existingAccountID(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.GetAccountDrainStatus(id))
+}
+
+// Resume 取消排空，账号重新参与调度
+func (h *AccountHandler) Resume(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	status := service.ResumeAccount(uint(id))
+	log.Printf("[Drain] 账号 %d 已恢复调度", id)
+	c.JSON(http.StatusOK, status)
+}
+
+// existingAccountID 解析路径中的账号 ID，账号不存在时返回 404
+func existingAccountID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	var count int64
+	if err := database.GetDB().Model(&model.Account{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// IdentityProbe 立即探测所有正常账号的凭证身份，返回本轮的告警
+func (h *AccountHandler) IdentityProbe(c *gin.Context) {
+	result, err := service.RunIdentityProbe()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// IdentityAlerts 返回最近的身份不一致告警，最新的在前
+func (h *AccountHandler) IdentityAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"alerts": service.ListIdentityAlerts()})
+}
+
+// UsageAnomalies 返回最近的账号用量异常事件，最新的在前
+func (h *AccountHandler) UsageAnomalies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"anomalies": service.ListUsageAnomalies()})
+}
+
+// ProxyHealthCheck 立即检查账号代理和代理池，返回各代理的状态
+func (h *AccountHandler) ProxyHealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"proxies": service.RunProxyHealthCheck()})
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"zencoder2api/internal/model"
+)
+
+func TestAccountUpdatesOnlyTouchesGivenFields(t *testing.T) {
+	var req model.AccountUpdateRequest
+	if err := json.Unmarshal([]byte(`{"plan_type":"Core","proxy":"","proxy_region":" US-East "}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	updates, err := accountUpdates(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 3 || updates["plan_type"] != model.PlanCore || updates["proxy"] != "" || updates["proxy_region"] != "us-east" {
+		t.Errorf("updates = %v", updates)
+	}
+	if _, ok := updates["email"]; ok {
+		t.Error("omitted email updated")
+	}
+
+	req = model.AccountUpdateRequest{}
+	if err := json.Unmarshal([]byte(`{"proxy":" socks5://1.2.3.4:1080 "}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if updates, err = accountUpdates(req); err != nil || updates["proxy"] != "socks5://1.2.3.4:1080" {
+		t.Errorf("updates = %v, err = %v", updates, err)
+	}
+
+	for _, body := range []string{`{}`, `{"email":"  "}`, `{"plan_type":"Pro"}`, `{"tags":["a"]}`, `{"proxy":"ftp://1.2.3.4:21"}`, `{"proxy":"not a proxy"}`} {
+		var req model.AccountUpdateRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := accountUpdates(req); err == nil {
+			t.Errorf("%s accepted", body)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+const adminJobListLimit = 50
+
+type AdminJobHandler struct{}
+
+func NewAdminJobHandler() *AdminJobHandler {
+	return &AdminJobHandler{}
+}
+
+// List 列出最近的后台任务，未结束的在前
+func (h *AdminJobHandler) List(c *gin.Context) {
+	limit := adminJobListLimit
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 && n < limit {
+		limit = n
+	}
+	jobs, err := service.ListAdminJobs(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// Get 获取任务进度，管理面板轮询该接口
+func (h *AdminJobHandler) Get(c *gin.Context) {
+	job, err := service.GetAdminJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// Cancel 取消任务，已处理的账号不回滚
+func (h *AdminJobHandler) Cancel(c *gin.Context) {
+	job, err := service.CancelAdminJob(c.Param("id"))
+	if errors.Is(err, service.ErrAdminJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// startAdminJob 账号数超过阈值时转为后台任务并返回 202，未转换时返回 false
+func startAdminJob(c *gin.Context, jobType string, accountIDs []uint, fromStatus, toStatus string) bool {
+	if len(accountIDs) <= service.GetAdminJobConfig().Threshold {
+		return false
+	}
+	job, err := service.CreateAdminJob(jobType, accountIDs, fromStatus, toStatus)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "账号较多，已转为后台任务",
+		"job":     job,
+	})
+	return true
+}
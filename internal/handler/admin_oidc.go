@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// oidcLoginTTL 从跳转到服务商到回调的最长时间
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcLogin 一次 OIDC 登录的 state 对应的校验参数
+type oidcLogin struct {
+	Nonce        string
+	CodeVerifier string
+	RedirectURL  string
+	CreatedAt    time.Time
+}
+
+type OIDCHandler struct {
+	mu     sync.Mutex
+	logins map[string]*oidcLogin
+}
+
+func NewOIDCHandler() *OIDCHandler {
+	return &OIDCHandler{logins: make(map[string]*oidcLogin)}
+}
+
+// Config 管理面板据此决定是否显示 SSO 登录按钮
+func (h *OIDCHandler) Config(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": service.GetOIDCConfig().Enabled()})
+}
+
+// Login 跳转到 OIDC 服务商登录
+func (h *OIDCHandler) Login(c *gin.Context) {
+	cfg := service.GetOIDCConfig()
+	if !cfg.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC 登录未启用"})
+		return
+	}
+
+	state, err1 := generateSessionID()
+	nonce, err2 := generateSessionID()
+	verifier, err3 := generateCodeVerifier(64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成登录参数失败"})
+		return
+	}
+	redirectURL := cfg.RedirectURL
+	if redirectURL == "" {
+		scheme := c.GetHeader("X-Forwarded-Proto")
+		if scheme == "" {
+			scheme = "http"
+			if c.Request.TLS != nil {
+				scheme = "https"
+			}
+		}
+		redirectURL = fmt.Sprintf("%s://%s/api/admin/oidc/callback", scheme, c.Request.Host)
+	}
+
+	authURL, err := service.OIDCAuthURL(c.Request.Context(), cfg, redirectURL, state, nonce, generateCodeChallenge(verifier))
+	if err != nil {
+		log.Printf("[WARN] [OIDC] 获取服务商配置失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	for id, login := range h.logins {
+		if now.Sub(login.CreatedAt) > oidcLoginTTL {
+			delete(h.logins, id)
+		}
+	}
+	h.logins[state] = &oidcLogin{Nonce: nonce, CodeVerifier: verifier, RedirectURL: redirectURL, CreatedAt: now}
+	h.mu.Unlock()
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 校验服务商返回的授权码，按邮箱和组映射角色后签发管理会话
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	state := c.Query("state")
+	h.mu.Lock()
+	login, ok := h.logins[state]
+	delete(h.logins, state)
+	h.mu.Unlock()
+	if !ok || time.Since(login.CreatedAt) > oidcLoginTTL {
+		h.renderResult(c, http.StatusBadRequest, "", "登录已过期，请重新登录")
+		return
+	}
+	if errMsg := c.Query("error"); errMsg != "" {
+		h.renderResult(c, http.StatusUnauthorized, "", "服务商拒绝登录: "+errMsg)
+		return
+	}
+
+	cfg := service.GetOIDCConfig()
+	identity, err := service.ExchangeOIDCCode(c.Request.Context(), cfg, c.Query("code"), login.RedirectURL, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("[WARN] [OIDC] 登录失败: %v", err)
+		h.renderResult(c, http.StatusUnauthorized, "", "登录失败: "+err.Error())
+		return
+	}
+	role, ok := service.OIDCRole(cfg, identity)
+	if !ok {
+		log.Printf("[OIDC] %s 不在允许的邮箱或组中，拒绝登录", identity.Email)
+		h.renderResult(c, http.StatusForbidden, "", "该账号没有管理面板的访问权限")
+		return
+	}
+
+	token, err := service.IssueAdminSession(role, identity.Email, time.Now())
+	if err != nil {
+		h.renderResult(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	log.Printf("[OIDC] %s 以 %s 角色登录管理面板", identity.Email, role)
+	h.renderResult(c, http.StatusOK, token, "")
+}
+
+// renderResult 登录成功时把会话令牌存入管理面板使用的 localStorage 并返回首页
+func (h *OIDCHandler) renderResult(c *gin.Context, status int, token, errMsg string) {
+	body := `<!DOCTYPE html><html lang="zh-CN"><head><meta charset="UTF-8"><title>管理面板登录</title></head><body>`
+	if token != "" {
+		tokenJSON, _ := json.Marshal(token)
+		body += fmt.Sprintf(`<p>登录成功，正在进入管理面板...</p>
+<script>localStorage.setItem('zencoder_admin_pass', %s); window.location.replace('/');</script>`, tokenJSON)
+	} else {
+		body += fmt.Sprintf(`<p>%s</p><p><a href="/">返回管理面板</a></p>`, html.EscapeString(errMsg))
+	}
+	body += `</body></html>`
+	c.Data(status, "text/html; charset=utf-8", []byte(body))
+}
@@ -2,12 +2,13 @@ package handler
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 
 	"zencoder2api/internal/service"
 
@@ -15,43 +16,141 @@ import (
 )
 
 type AnthropicHandler struct {
-	svc *service.AnthropicService
+	svc anthropicProxy
 }
 
 func NewAnthropicHandler() *AnthropicHandler {
-	return &AnthropicHandler{svc: service.NewAnthropicService()}
+	return NewAnthropicHandlerWithDeps(service.DefaultDependencies())
 }
 
-// generateTraceID 生成一个随机的 trace ID
-func generateAnthropicTraceID() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+// NewAnthropicHandlerWithDeps 使用指定依赖构建上游服务
+func NewAnthropicHandlerWithDeps(deps service.Dependencies) *AnthropicHandler {
+	return &AnthropicHandler{svc: service.NewAnthropicServiceWithDeps(deps)}
 }
 
 // Messages 处理 POST /v1/messages
 func (h *AnthropicHandler) Messages(c *gin.Context) {
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeAnthropicError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// 传递原始请求头给service层，用于错误日志记录
 	ctx := context.WithValue(c.Request.Context(), "originalHeaders", c.Request.Header)
+	ctx = service.WithRequestBytes(ctx, len(body))
+	ctx = service.WithAnthropicBeta(ctx, c.Request.Header.Values("anthropic-beta"))
 	
 	if err := h.svc.MessagesProxy(ctx, c.Writer, body); err != nil {
-		h.handleError(c, err)
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.Unmarshal(body, &req)
+		h.handleError(c, err, req.Model)
 	}
 }
 
-// handleError 统一处理错误，特别是没有可用账号的错误
-func (h *AnthropicHandler) handleError(c *gin.Context, err error) {
+// CountTokens 处理 POST /v1/messages/count_tokens，上游无法计数时返回本地估算值并带 X-Token-Count-Estimated 头
+func (h *AnthropicHandler) CountTokens(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeAnthropicError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.svc.CountTokens(c.Request.Context(), body)
+	if err != nil {
+		h.handleError(c, err, "")
+		return
+	}
+	if result.Estimated {
+		c.Header(service.CountTokensEstimatedHeader, "true")
+	}
+	c.JSON(http.StatusOK, gin.H{"input_tokens": result.InputTokens})
+}
+
+// writeAnthropicError 以 Anthropic 原生错误对象响应，错误类型由状态码决定
+func writeAnthropicError(c *gin.Context, status int, message string) {
+	c.Data(status, "application/json", service.AnthropicErrorBody(service.AnthropicErrorType(status), message))
+}
+
+// Models 处理 GET /anthropic/v1/models，以 Anthropic 格式列出 anthropic 服务商的模型
+func (h *AnthropicHandler) Models(c *gin.Context) {
+	writeAnthropicModels(c)
+}
+
+// writeAnthropicModels 按 limit / before_id / after_id 查询参数输出 Anthropic 格式的模型列表
+func writeAnthropicModels(c *gin.Context) {
+	limit := service.AnthropicModelsDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > service.AnthropicModelsMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    "invalid_request_error",
+					"message": fmt.Sprintf("limit: must be between 1 and %d", service.AnthropicModelsMaxLimit),
+				},
+			})
+			return
+		}
+		limit = n
+	}
+	c.JSON(http.StatusOK, service.ListAnthropicModels(limit, c.Query("before_id"), c.Query("after_id")))
+}
+
+// handleError 统一处理错误，所有错误都以 Anthropic 错误对象返回
+// 没有可用账号时按号池中最早可用的时间设置 Retry-After
+func (h *AnthropicHandler) handleError(c *gin.Context, err error, modelID string) {
+	if errors.Is(err, service.ErrClientDisconnected) {
+		// 客户端已断开，已记录到请求日志，无需再写响应
+		return
+	}
 	if errors.Is(err, service.ErrNoAvailableAccount) || errors.Is(err, service.ErrNoPermission) {
-		traceID := generateAnthropicTraceID()
-		errMsg := fmt.Sprintf("没有可用token（traceid: %s）", traceID)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMsg})
+		if forwardOverflow(c) {
+			return
+		}
+		traceID := service.ErrorTraceID(c.Request.Context())
+		if wait := service.GetModelAvailability(modelID).EstimatedWaitSeconds; wait != nil && *wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(*wait))
+		}
+		writeAnthropicError(c, http.StatusServiceUnavailable, fmt.Sprintf("没有可用token（traceid: %s）", traceID))
+		return
+	}
+	if errors.Is(err, service.ErrUpstreamUnreachable) {
+		// 重试耗尽的内部细节只写日志，不返回给客户端
+		traceID := service.ErrorTraceID(c.Request.Context())
+		service.LogEvent(c.Request.Context(), slog.LevelWarn, "Anthropic", "上游不可达",
+			slog.String("trace_id", traceID), slog.Int("status", http.StatusBadGateway), slog.Any("error", err))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    "api_error",
+				"code":    "upstream_unreachable",
+				"message": fmt.Sprintf("上游服务暂时无法连接（traceid: %s）", traceID),
+			},
+		})
+		return
+	}
+	if errors.Is(err, service.ErrLatencyBudgetExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    "api_error",
+				"code":    "budget_exceeded",
+				"message": "换号重试后仍未在延迟预算内收到上游响应",
+			},
+		})
+		return
+	}
+	var invalid *service.InvalidRequestError
+	if errors.As(err, &invalid) {
+		writeAnthropicError(c, http.StatusBadRequest, invalid.Message)
 		return
 	}
-	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 其余错误可能包含重试和账号细节，只写日志
+	traceID := service.ErrorTraceID(c.Request.Context())
+	service.LogEvent(c.Request.Context(), slog.LevelError, "Anthropic", "请求失败",
+		slog.String("trace_id", traceID), slog.Int("status", http.StatusInternalServerError), slog.Any("error", err))
+	writeAnthropicError(c, http.StatusInternalServerError, fmt.Sprintf("内部错误（traceid: %s）", traceID))
 }
@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/middleware"
+	"zencoder2api/internal/service"
+)
+
+const testAnthropicBody = `{"model":"claude-sonnet-4-5-20250929","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+
+func TestAnthropicMessagesSuccess(t *testing.T) {
+	accounts, credits := newFakeAccounts(2), &fakeCredits{}
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: credits, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages", testAnthropicBody, h.Messages)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"text":"ok"`) {
+		t.Errorf("body = %s", rec.Body)
+	}
+	if accounts.acquired != 1 || accounts.released != 1 || accounts.reset != 1 {
+		t.Errorf("acquired=%d released=%d reset=%d", accounts.acquired, accounts.released, accounts.reset)
+	}
+	if credits.updates != 1 {
+		t.Errorf("credit updates = %d", credits.updates)
+	}
+	if paths := upstream.seen(); len(paths) != 1 || paths[0] != "/anthropic/v1/messages" {
+		t.Errorf("upstream paths = %v", paths)
+	}
+}
+
+func TestAnthropicMessagesNoAccount(t *testing.T) {
+	accounts := newFakeAccounts(0)
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages", testAnthropicBody, h.Messages)
+
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "没有可用token") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if e := decodeAnthropicError(t, rec.Body.Bytes()); e.Error.Type != "overloaded_error" {
+		t.Errorf("error type = %q", e.Error.Type)
+	}
+	if len(upstream.seen()) != 0 {
+		t.Errorf("upstream should not be called")
+	}
+}
+
+func TestAnthropicMessagesWrapsNonAnthropicUpstreamError(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte("request body too large"))
+	})
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages", testAnthropicBody, h.Messages)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	e := decodeAnthropicError(t, rec.Body.Bytes())
+	if e.Error.Type != "request_too_large" || e.Error.Message != "request body too large" {
+		t.Errorf("body = %s", rec.Body)
+	}
+}
+
+// decodeAnthropicError 解析并校验 Anthropic 错误对象
+func decodeAnthropicError(t *testing.T, body []byte) (e struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}) {
+	t.Helper()
+	if err := json.Unmarshal(body, &e); err != nil || e.Type != "error" || e.Error.Type == "" || e.Error.Message == "" {
+		t.Fatalf("not an Anthropic error object: %s", body)
+	}
+	return e
+}
+
+func TestAnthropicMessagesUpstreamUnreachable(t *testing.T) {
+	accounts := newFakeAccounts(3)
+	upstream, srv := newFakeUpstream(t, anthropicOK)
+	srv.Close()
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages", testAnthropicBody, h.Messages)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Type != "error" || resp.Error.Code != "upstream_unreachable" {
+		t.Errorf("body = %s", rec.Body)
+	}
+	if accounts.acquired != service.MaxRetries || accounts.released != service.MaxRetries {
+		t.Errorf("acquired=%d released=%d, want %d", accounts.acquired, accounts.released, service.MaxRetries)
+	}
+}
+
+func TestAnthropicMessagesUpstreamRejectsAllAccounts(t *testing.T) {
+	accounts := newFakeAccounts(3)
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid token"}}`))
+	})
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages", testAnthropicBody, h.Messages)
+
+	// 上游有响应但所有账号都被拒绝，属于号池问题而不是上游不可达
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "没有可用token") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := len(upstream.seen()); got != service.MaxRetries {
+		t.Errorf("upstream calls = %d, want %d", got, service.MaxRetries)
+	}
+}
+
+func TestAnthropicErrorTraceIsRetrievable(t *testing.T) {
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/messages", middleware.LoggerMiddleware(), h.Messages)
+	r.GET("/api/debug/traces/:id", NewDebugHandler().GetTrace)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(testAnthropicBody)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	m := regexp.MustCompile(`traceid: ([0-9a-f]+)`).FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("no traceid in %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/debug/traces/"+m[1], nil))
+	var trace service.Trace
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &trace) != nil || trace.ID != m[1] {
+		t.Fatalf("trace lookup status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(trace.Logs) == 0 {
+		t.Error("trace has no logs")
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/debug/traces/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown trace status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAnthropicMessagesInvalidTool(t *testing.T) {
+	accounts := newFakeAccounts(1)
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","max_tokens":16,"messages":[{"role":"user","content":"hi"}],"tools":[{"name":"bad name","input_schema":{"type":"object"}}]}`
+	rec := serve(t, "POST", "/v1/messages", body, h.Messages)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "tools[0].name") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAnthropicHandleErrorHidesInternalDetails(t *testing.T) {
+	h := &AnthropicHandler{}
+	rec := serve(t, "POST", "/v1/messages", testAnthropicBody, func(c *gin.Context) {
+		h.handleError(c, errors.New("账号 alice@example.com (ID:12) 第 3 次重试失败"), "claude-sonnet-4-5-20250929")
+	})
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	e := decodeAnthropicError(t, rec.Body.Bytes())
+	if strings.Contains(e.Error.Message, "alice") || strings.Contains(e.Error.Message, "重试") || !strings.Contains(e.Error.Message, "traceid") {
+		t.Errorf("message = %q, want generic message with traceid", e.Error.Message)
+	}
+}
+
+func TestMessagesThinkingGuardRetriesWithSmallerBudget(t *testing.T) {
+	const modelID = "claude-sonnet-4-5-20250929"
+	if err := service.SetThinkingTokenLimit(modelID, 10); err != nil {
+		t.Fatal(err)
+	}
+	defer service.SetThinkingTokenLimit(modelID, 0)
+
+	var mu sync.Mutex
+	var budgets []float64
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Thinking struct {
+				BudgetTokens float64 `json:"budget_tokens"`
+			} `json:"thinking"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		budgets = append(budgets, req.Thinking.BudgetTokens)
+		attempt := len(budgets)
+		mu.Unlock()
+
+		thinking := strings.Repeat("hmm ", 50)
+		if attempt > 1 {
+			thinking = "short"
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"message_start","message":{"id":"msg_test","usage":{"input_tokens":3}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"` + thinking + `"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"answer"}}`,
+			`{"type":"message_stop"}`,
+		} {
+			io.WriteString(w, "data: "+event+"\n\n")
+		}
+	})
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"` + modelID + `","max_tokens":8000,"stream":true,"thinking":{"type":"enabled","budget_tokens":4000},"messages":[{"role":"user","content":"hi"}]}`
+	rec := serve(t, "POST", "/v1/messages", body, h.Messages)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(budgets) != 2 || budgets[1] > 1024 {
+		t.Fatalf("upstream budgets = %v, want a retry with budget <= 1024", budgets)
+	}
+	if rec.Header().Get(service.ThinkingGuardHeader) != "1024" || rec.Header().Get("Warning") == "" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	if out := rec.Body.String(); strings.Contains(out, "hmm") || !strings.Contains(out, "short") || !strings.Contains(out, "answer") {
+		t.Errorf("body = %s", out)
+	}
+}
+
+func TestAnthropicCountTokensProxiesThroughPool(t *testing.T) {
+	accounts := newFakeAccounts(1)
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"input_tokens":42}`)
+	})
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages/count_tokens", testAnthropicBody, h.CountTokens)
+
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"input_tokens":42}` {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get(service.CountTokensEstimatedHeader) != "" {
+		t.Error("upstream count should not be marked as estimated")
+	}
+	if paths := upstream.seen(); len(paths) != 1 || paths[0] != "/anthropic/v1/messages/count_tokens" {
+		t.Errorf("upstream paths = %v", paths)
+	}
+	if accounts.acquired != 1 || accounts.released != 1 {
+		t.Errorf("acquired=%d released=%d", accounts.acquired, accounts.released)
+	}
+}
+
+func TestAnthropicCountTokensFallsBackToEstimate(t *testing.T) {
+	notFound := func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }
+	for _, n := range []int{0, 1} {
+		upstream, _ := newFakeUpstream(t, notFound)
+		h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(n), Credits: &fakeCredits{}, Upstream: upstream})
+
+		rec := serve(t, "POST", "/v1/messages/count_tokens", testAnthropicBody, h.CountTokens)
+
+		var got struct {
+			InputTokens int `json:"input_tokens"`
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.InputTokens <= 0 {
+			t.Fatalf("accounts=%d: status = %d, body = %s", n, rec.Code, rec.Body)
+		}
+		if rec.Header().Get(service.CountTokensEstimatedHeader) != "true" {
+			t.Errorf("accounts=%d: estimate should be marked", n)
+		}
+	}
+}
+
+func TestAnthropicCountTokensInvalidRequest(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"type":"error","error":{"type":"invalid_request_error","message":"messages: roles must alternate"}}`)
+	})
+	h := NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/messages/count_tokens", testAnthropicBody, h.CountTokens)
+	if e := decodeAnthropicError(t, rec.Body.Bytes()); rec.Code != http.StatusBadRequest || e.Error.Message != "messages: roles must alternate" {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(t, "POST", "/v1/messages/count_tokens", `{"messages":[]}`, h.CountTokens)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing model: status = %d", rec.Code)
+	}
+}
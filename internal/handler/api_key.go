@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+type APIKeyHandler struct{}
+
+func NewAPIKeyHandler() *APIKeyHandler {
+	return &APIKeyHandler{}
+}
+
+// List 列出全部 API Key，不含明文
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := service.ListAPIKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// Create 创建 API Key，响应中的 key 为明文，之后无法再次查看
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req model.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key, plain, err := service.CreateAPIKey(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[APIKey] 创建 API Key %d (%s): %s", key.ID, key.Name, key.Prefix)
+	c.JSON(http.StatusOK, gin.H{"key": plain, "api_key": key})
+}
+
+// Update 修改 API Key 的名称、启用状态、额度、允许的模型和过期时间
+func (h *APIKeyHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req model.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key, err := service.UpdateAPIKey(uint(id), req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[APIKey] 修改 API Key %d (%s): enabled=%v, quota=%g", key.ID, key.Name, key.Enabled, key.CreditQuota)
+	c.JSON(http.StatusOK, key)
+}
+
+// Delete 删除 API Key
+func (h *APIKeyHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := service.DeleteAPIKey(uint(id)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[APIKey] 删除 API Key %d", id)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// Reservations 号池容量、各 Key 的预留及当前占用
+func (h *APIKeyHandler) Reservations(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetPoolReservationStatus())
+}
+
+// SetReservation 修改 Key 预留的号池并发数，0 表示取消预留
+func (h *APIKeyHandler) SetReservation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		ReservedSlots int `json:"reserved_slots"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key, err := service.SetAPIKeyReservation(uint(id), req.ReservedSlots)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[APIKey] API Key %d (%s) 预留号池并发数: %d", key.ID, key.Name, key.ReservedSlots)
+	c.JSON(http.StatusOK, key)
+}
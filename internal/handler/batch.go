@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+// BatchHandler 离峰批处理 /v1/batch-lite
+type BatchHandler struct {
+	// exec 执行单个请求的路由，批处理请求与普通请求经过相同的中间件和转换逻辑
+	exec http.Handler
+}
+
+func NewBatchHandler(exec http.Handler) *BatchHandler {
+	return &BatchHandler{exec: exec}
+}
+
+// Execute 以提交者的 API Key 和来源 IP 在进程内调用 /v1/chat/completions
+func (h *BatchHandler) Execute(ctx context.Context, job *model.BatchJob, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if job.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+job.APIKey)
+	}
+	req.RemoteAddr = net.JoinHostPort(job.ClientIP, "0")
+
+	rec := httptest.NewRecorder()
+	h.exec.ServeHTTP(rec, req)
+	if ctx.Err() != nil {
+		return rec.Code, rec.Body.Bytes(), ctx.Err()
+	}
+	return rec.Code, rec.Body.Bytes(), nil
+}
+
+type CreateBatchRequest struct {
+	Requests []service.BatchItem `json:"requests"`
+	Deadline time.Time           `json:"deadline"` // 为空时默认 24 小时后
+}
+
+// batchResponse 任务信息及按状态统计的请求数
+func batchResponse(job *model.BatchJob) gin.H {
+	return gin.H{
+		"id":          job.ID,
+		"object":      "batch_lite",
+		"status":      job.Status,
+		"deadline":    job.Deadline,
+		"created_at":  job.CreatedAt,
+		"finished_at": job.FinishedAt,
+		"request_counts": gin.H{
+			"total":     job.Total,
+			"completed": job.Completed,
+			"failed":    job.Failed,
+		},
+	}
+}
+
+func batchError(c *gin.Context, err error) {
+	var invalid *service.InvalidRequestError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": invalid.Message, "type": "invalid_request_error"}})
+	case errors.Is(err, service.ErrBatchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": "batch not found", "type": "invalid_request_error"}})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Create 处理 POST /v1/batch-lite，保存请求后立即返回，由调度器在号池空闲时执行
+func (h *BatchHandler) Create(c *gin.Context) {
+	var req CreateBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error(), "type": "invalid_request_error"}})
+		return
+	}
+
+	job, err := service.CreateBatch(service.GetAPIKey(c.Request.Context()), c.ClientIP(), req.Requests, req.Deadline)
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batchResponse(job))
+}
+
+// Get 处理 GET /v1/batch-lite/:id
+func (h *BatchHandler) Get(c *gin.Context) {
+	job, err := service.GetBatch(c.Param("id"), service.GetAPIKey(c.Request.Context()))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batchResponse(job))
+}
+
+// Results 处理 GET /v1/batch-lite/:id/results，以 JSONL 返回已结束请求的结果
+func (h *BatchHandler) Results(c *gin.Context) {
+	job, err := service.GetBatch(c.Param("id"), service.GetAPIKey(c.Request.Context()))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	requests, err := service.ListBatchRequests(job.ID)
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range requests {
+		if r.Status == model.BatchRequestPending {
+			continue
+		}
+		line := gin.H{"custom_id": r.CustomID, "status": r.Status}
+		if r.StatusCode != 0 {
+			line["status_code"] = r.StatusCode
+		}
+		if json.Valid([]byte(r.Response)) {
+			line["response"] = json.RawMessage(r.Response)
+		}
+		if r.Error != "" {
+			line["error"] = r.Error
+		}
+		enc.Encode(line)
+	}
+	c.Header("Content-Disposition", "attachment; filename=\""+job.ID+".jsonl\"")
+	c.Data(http.StatusOK, "application/x-ndjson", buf.Bytes())
+}
+
+// Cancel 处理 POST /v1/batch-lite/:id/cancel，未执行的请求不再执行
+func (h *BatchHandler) Cancel(c *gin.Context) {
+	job, err := service.CancelBatch(c.Param("id"), service.GetAPIKey(c.Request.Context()))
+	if err != nil {
+		batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batchResponse(job))
+}
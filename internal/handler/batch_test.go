@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/middleware"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+func TestBatchExecuteRunsThroughChatRoute(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	var seenKey string
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", middleware.AuthMiddleware(), func(c *gin.Context) {
+		seenKey = service.GetAPIKey(c.Request.Context())
+		h.ChatCompletions(c)
+	})
+
+	batch := NewBatchHandler(r)
+	status, body, err := batch.Execute(context.Background(), &model.BatchJob{APIKey: "sk-batch", ClientIP: "10.0.0.1"}, []byte(testChatBody))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("status = %d err = %v body = %s", status, err, body)
+	}
+	if !strings.Contains(string(body), `"chat.completion"`) {
+		t.Errorf("body = %s", body)
+	}
+	if seenKey != "sk-batch" {
+		t.Errorf("api key = %q", seenKey)
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/service"
+)
+
+type BootstrapHandler struct{}
+
+func NewBootstrapHandler() *BootstrapHandler {
+	return &BootstrapHandler{}
+}
+
+// Status 管理面板据此决定是否显示初始化向导
+func (h *BootstrapHandler) Status(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"required": service.BootstrapRequired()})
+}
+
+// Bootstrap 首次部署时设置管理密码、API Key、数据库和全局限制，已有管理员时返回 403
+func (h *BootstrapHandler) Bootstrap(c *gin.Context) {
+	var req service.BootstrapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := service.Bootstrap(req)
+	if err != nil {
+		var invalid *service.InvalidRequestError
+		switch {
+		case errors.Is(err, service.ErrAlreadyBootstrapped):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Message, "param": invalid.Param})
+		case errors.Is(err, database.ErrUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// DashboardHandler 管理面板的实时状态，只读内存数据，数据库不可用时同样可用
+type DashboardHandler struct{}
+
+func NewDashboardHandler() *DashboardHandler {
+	return &DashboardHandler{}
+}
+
+// Overview 处理 GET /api/dashboard，返回使用中或冻结中的账号、进行中的流、代理和最近的上游失败
+func (h *DashboardHandler) Overview(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetDashboardSnapshot(time.Now()))
+}
+
+// Accounts 处理 GET /api/dashboard/accounts?state=in_use|frozen|busy，state 为空时返回全部账号
+func (h *DashboardHandler) Accounts(c *gin.Context) {
+	state := c.Query("state")
+	switch state {
+	case "", service.DashboardFilterInUse, service.DashboardFilterFrozen, service.DashboardFilterBusy:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state 只能是 in_use、frozen 或 busy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"max_concurrent_per_account": service.GetAccountConcurrency(),
+		"accounts":                   service.GetDashboardAccounts(state, time.Now()),
+	})
+}
+
+// Streams 处理 GET /api/dashboard/streams，返回进行中的流式请求
+func (h *DashboardHandler) Streams(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"streams": service.ListActiveStreams()})
+}
+
+// Proxies 处理 GET /api/dashboard/proxies，返回代理池和账号单独配置的代理
+func (h *DashboardHandler) Proxies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"proxies": service.GetDashboardProxies()})
+}
+
+// Errors 处理 GET /api/dashboard/errors，返回最近的上游失败，最新的在前
+func (h *DashboardHandler) Errors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"errors": service.RecentUpstreamErrors()})
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"zencoder2api/internal/service"
+)
+
+// DeadLetterHandler 重试用尽后仍失败的请求 /api/dead-letters
+type DeadLetterHandler struct {
+	// exec 重放时执行请求的路由，与普通请求经过相同的中间件和转换逻辑
+	exec http.Handler
+}
+
+func NewDeadLetterHandler(exec http.Handler) *DeadLetterHandler {
+	return &DeadLetterHandler{exec: exec}
+}
+
+// List 按模型、账号和时间筛选最近的 dead letter
+func (h *DeadLetterHandler) List(c *gin.Context) {
+	filter := service.DeadLetterFilter{Model: c.Query("model")}
+	if raw := c.Query("account_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account_id"})
+			return
+		}
+		filter.AccountID = uint(id)
+	}
+	if raw := c.Query("since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since, expected RFC3339"})
+			return
+		}
+		filter.Since = since
+	}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	letters, err := service.ListDeadLetters(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dead_letters": letters})
+}
+
+// Get 查询单条 dead letter
+func (h *DeadLetterHandler) Get(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+	letter, err := service.GetDeadLetter(id)
+	if err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, letter)
+}
+
+// Replay 以 AUTH_TOKEN 在进程内重新发送保存的请求体，请求体被截断的记录不能重放
+func (h *DeadLetterHandler) Replay(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+	letter, err := service.GetDeadLetter(id)
+	if err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	if letter.PayloadTruncated {
+		c.JSON(http.StatusConflict, gin.H{"error": "payload was truncated when captured and cannot be replayed"})
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), letter.Method, letter.Path, bytes.NewReader([]byte(letter.Payload)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := service.GetSecret("AUTH_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	rec := httptest.NewRecorder()
+	h.exec.ServeHTTP(rec, req)
+	if err := service.MarkDeadLetterReplayed(id, rec.Code, time.Now()); err != nil {
+		log.Printf("[WARN] [DeadLetter] 记录重放结果失败: %v", err)
+	}
+	log.Printf("[DeadLetter] 重放 dead letter %d (%s %s): status=%d", id, letter.Method, letter.Path, rec.Code)
+	c.JSON(http.StatusOK, gin.H{"status": rec.Code, "body": rec.Body.String()})
+}
+
+// Delete 删除 dead letter
+func (h *DeadLetterHandler) Delete(c *gin.Context) {
+	id, ok := deadLetterID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteDeadLetter(id); err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+func deadLetterID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func deadLetterError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dead letter not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+type DebugHandler struct{}
+
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{}
+}
+
+// GetTrace 按用户反馈的 traceid 查询该请求的完整日志
+func (h *DebugHandler) GetTrace(c *gin.Context) {
+	trace, ok := service.GetTrace(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trace not found or expired"})
+		return
+	}
+	c.JSON(http.StatusOK, trace)
+}
@@ -112,7 +112,7 @@ func (h *ExternalHandler) SubmitTokens(c *gin.Context) {
 		
 		if _, err := service.RefreshToken(&account); err != nil {
 			lastErr = err
-			log.Printf("[外部API] 第 %d 次获取token失败: %v", attempt, err)
+			log.Printf("[WARN] [外部API] 第 %d 次获取token失败: %v", attempt, err)
 			
 			if attempt < maxRetries {
 				log.Printf("[外部API] 等待 %v 后重试", retryDelay)
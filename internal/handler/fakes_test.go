@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+// fakeAccounts 内存号池，记录获取/释放次数
+type fakeAccounts struct {
+	mu       sync.Mutex
+	accounts []*model.Account
+	next     int
+	err      error
+	acquired int
+	released int
+	errored  int
+	reset    int
+}
+
+func newFakeAccounts(n int) *fakeAccounts {
+	f := &fakeAccounts{}
+	for i := 0; i < n; i++ {
+		f.accounts = append(f.accounts, &model.Account{ID: uint(i + 1), Email: "fake@example.com", AccessToken: "fake-token", PlanType: model.PlanMax})
+	}
+	return f
+}
+
+func (f *fakeAccounts) GetNextAccountForModel(modelID string) (*model.Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.accounts) == 0 {
+		return nil, service.ErrNoAvailableAccount
+	}
+	acc := f.accounts[f.next%len(f.accounts)]
+	f.next++
+	f.acquired++
+	return acc, nil
+}
+
+func (f *fakeAccounts) ReleaseAccount(account *model.Account) {
+	f.mu.Lock()
+	f.released++
+	f.mu.Unlock()
+}
+
+func (f *fakeAccounts) MarkAccountError(account *model.Account) {
+	f.mu.Lock()
+	f.errored++
+	f.mu.Unlock()
+}
+
+func (f *fakeAccounts) ResetAccountError(account *model.Account) {
+	f.mu.Lock()
+	f.reset++
+	f.mu.Unlock()
+}
+
+func (f *fakeAccounts) MarkAccountRateLimitedShort(account *model.Account, cooling time.Duration) {
+	f.ReleaseAccount(account)
+}
+
+func (f *fakeAccounts) MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Response, cooling time.Duration) {
+	f.ReleaseAccount(account)
+}
+
+func (f *fakeAccounts) FreezeAccount(account *model.Account, duration time.Duration) {
+	f.ReleaseAccount(account)
+}
+
+// fakeCredits 记录积分更新次数
+type fakeCredits struct {
+	mu      sync.Mutex
+	updates int
+}
+
+func (f *fakeCredits) UseCredit(account *model.Account, multiplier float64) {}
+
+func (f *fakeCredits) UpdateAccountCreditsFromResponse(account *model.Account, resp *http.Response, modelMultiplier float64) {
+	f.mu.Lock()
+	f.updates++
+	f.mu.Unlock()
+}
+
+// fakeUpstream 把所有上游请求改写到 httptest 服务器
+type fakeUpstream struct {
+	target *url.URL
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func newFakeUpstream(t *testing.T, h http.HandlerFunc) (*fakeUpstream, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return &fakeUpstream{target: u}, srv
+}
+
+func (f *fakeUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.paths = append(f.paths, req.URL.Path)
+	f.mu.Unlock()
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme = f.target.Scheme
+	out.URL.Host = f.target.Host
+	out.Host = f.target.Host
+	return http.DefaultTransport.RoundTrip(out)
+}
+
+func (f *fakeUpstream) Client(proxy string, zenModel model.ZenModel) *http.Client {
+	return &http.Client{Transport: f, Timeout: 5 * time.Second}
+}
+
+func (f *fakeUpstream) ProxyClient(proxyURL string, zenModel model.ZenModel) (*http.Client, error) {
+	return f.Client(proxyURL, zenModel), nil
+}
+
+func (f *fakeUpstream) seen() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.paths...)
+}
+
+// anthropicOK 返回最小的 Anthropic 非流式响应
+func anthropicOK(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id": "msg_test", "type": "message", "role": "assistant", "model": "test",
+		"content":     []map[string]string{{"type": "text", "text": "ok"}},
+		"stop_reason": "end_turn",
+	})
+}
+
+func serve(t *testing.T, method, path, body string, h gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, path, h)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(rec, req)
+	return rec
+}
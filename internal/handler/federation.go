@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// forwardOverflow 号池饱和时把请求转发给对等实例，已由对等实例响应时返回 true
+func forwardOverflow(c *gin.Context) bool {
+	if c.Writer.Written() {
+		return false
+	}
+	return service.ForwardToPeer(c.Request.Context(), c.Writer)
+}
@@ -1,12 +1,12 @@
 package handler
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -14,18 +14,16 @@ import (
 )
 
 type GeminiHandler struct {
-	svc *service.GeminiService
+	svc geminiProxy
 }
 
 func NewGeminiHandler() *GeminiHandler {
-	return &GeminiHandler{svc: service.NewGeminiService()}
+	return NewGeminiHandlerWithDeps(service.DefaultDependencies())
 }
 
-// generateTraceID 生成一个随机的 trace ID
-func generateGeminiTraceID() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+// NewGeminiHandlerWithDeps 使用指定依赖构建上游服务
+func NewGeminiHandlerWithDeps(deps service.Dependencies) *GeminiHandler {
+	return &GeminiHandler{svc: service.NewGeminiServiceWithDeps(deps)}
 }
 
 // HandleRequest 处理 POST /v1beta/models/*path
@@ -60,18 +58,103 @@ func (h *GeminiHandler) HandleRequest(c *gin.Context) {
 		if err := h.svc.StreamGenerateContentProxy(c.Request.Context(), c.Writer, modelName, body); err != nil {
 			h.handleError(c, err)
 		}
+	case "countTokens":
+		h.countTokens(c, modelName, body)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported action: " + action})
 	}
 }
 
+// countTokens 处理 :countTokens，在本地估算，不转发上游
+func (h *GeminiHandler) countTokens(c *gin.Context, modelName string, body []byte) {
+	if _, ok := service.GetGeminiModel(modelName); !ok {
+		writeGeminiError(c, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("models/%s is not found", modelName))
+		return
+	}
+	tokens, err := service.EstimateGeminiTokens(body)
+	if err != nil {
+		writeGeminiError(c, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"totalTokens": tokens})
+}
+
+// Models 处理 GET /v1beta/models，只列出 gemini 服务商的模型
+func (h *GeminiHandler) Models(c *gin.Context) {
+	pageSize := service.GeminiModelsDefaultPageSize
+	if raw := c.Query("pageSize"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeGeminiError(c, http.StatusBadRequest, "INVALID_ARGUMENT", "pageSize must be a non-negative integer")
+			return
+		}
+		pageSize = n
+	}
+	c.JSON(http.StatusOK, service.ListGeminiModels(pageSize, c.Query("pageToken")))
+}
+
+// Model 处理 GET /v1beta/models/*path
+func (h *GeminiHandler) Model(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("path"), "/")
+	info, ok := service.GetGeminiModel(name)
+	if !ok {
+		writeGeminiError(c, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("models/%s is not found", name))
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// writeGeminiError 以 Google API 错误格式返回
+func writeGeminiError(c *gin.Context, code int, status, message string) {
+	c.JSON(code, gin.H{
+		"error": gin.H{
+			"code":    code,
+			"message": message,
+			"status":  status,
+		},
+	})
+}
+
 // handleError 统一处理错误，特别是没有可用账号的错误
 func (h *GeminiHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrClientDisconnected) {
+		// 客户端已断开，已记录到请求日志，无需再写响应
+		return
+	}
 	if errors.Is(err, service.ErrNoAvailableAccount) || errors.Is(err, service.ErrNoPermission) {
-		traceID := generateGeminiTraceID()
+		if forwardOverflow(c) {
+			return
+		}
+		traceID := service.ErrorTraceID(c.Request.Context())
 		errMsg := fmt.Sprintf("没有可用token（traceid: %s）", traceID)
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMsg})
 		return
 	}
+	if errors.Is(err, service.ErrUpstreamUnreachable) {
+		// 重试耗尽的内部细节只写日志，不返回给客户端
+		traceID := service.ErrorTraceID(c.Request.Context())
+		service.LogEvent(c.Request.Context(), slog.LevelWarn, "Gemini", "上游不可达",
+			slog.String("trace_id", traceID), slog.Int("status", http.StatusBadGateway), slog.Any("error", err))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"code":    http.StatusBadGateway,
+				"message": fmt.Sprintf("上游服务暂时无法连接（traceid: %s）", traceID),
+				"status":  "UNAVAILABLE",
+				"reason":  "upstream_unreachable",
+			},
+		})
+		return
+	}
+	if errors.Is(err, service.ErrLatencyBudgetExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": gin.H{
+				"code":    http.StatusGatewayTimeout,
+				"message": "换号重试后仍未在延迟预算内收到上游响应",
+				"status":  "DEADLINE_EXCEEDED",
+				"reason":  "budget_exceeded",
+			},
+		})
+		return
+	}
 	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
@@ -1,11 +1,10 @@
 package handler
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 
 	"zencoder2api/internal/service"
@@ -14,18 +13,16 @@ import (
 )
 
 type GrokHandler struct {
-	svc *service.GrokService
+	svc grokProxy
 }
 
 func NewGrokHandler() *GrokHandler {
-	return &GrokHandler{svc: service.NewGrokService()}
+	return NewGrokHandlerWithDeps(service.DefaultDependencies())
 }
 
-// generateTraceID 生成一个随机的 trace ID
-func generateGrokTraceID() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+// NewGrokHandlerWithDeps 使用指定依赖构建上游服务
+func NewGrokHandlerWithDeps(deps service.Dependencies) *GrokHandler {
+	return &GrokHandler{svc: service.NewGrokServiceWithDeps(deps)}
 }
 
 // ChatCompletions 处理 POST /v1/chat/completions (xAI)
@@ -43,11 +40,42 @@ func (h *GrokHandler) ChatCompletions(c *gin.Context) {
 
 // handleError 统一处理错误，特别是没有可用账号的错误
 func (h *GrokHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrClientDisconnected) {
+		// 客户端已断开，已记录到请求日志，无需再写响应
+		return
+	}
 	if errors.Is(err, service.ErrNoAvailableAccount) || errors.Is(err, service.ErrNoPermission) {
-		traceID := generateGrokTraceID()
+		if forwardOverflow(c) {
+			return
+		}
+		traceID := service.ErrorTraceID(c.Request.Context())
 		errMsg := fmt.Sprintf("没有可用token（traceid: %s）", traceID)
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMsg})
 		return
 	}
+	if errors.Is(err, service.ErrUpstreamUnreachable) {
+		// 重试耗尽的内部细节只写日志，不返回给客户端
+		traceID := service.ErrorTraceID(c.Request.Context())
+		service.LogEvent(c.Request.Context(), slog.LevelWarn, "Grok", "上游不可达",
+			slog.String("trace_id", traceID), slog.Int("status", http.StatusBadGateway), slog.Any("error", err))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("上游服务暂时无法连接（traceid: %s）", traceID),
+				"type":    "upstream_error",
+				"code":    "upstream_unreachable",
+			},
+		})
+		return
+	}
+	if errors.Is(err, service.ErrLatencyBudgetExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": gin.H{
+				"message": "换号重试后仍未在延迟预算内收到上游响应",
+				"type":    "upstream_error",
+				"code":    "budget_exceeded",
+			},
+		})
+		return
+	}
 	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+type MetricsHandler struct{}
+
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{}
+}
+
+// Metrics 处理 GET /metrics，输出 OpenMetrics 格式的号池指标
+func (h *MetricsHandler) Metrics(c *gin.Context) {
+	var accounts []model.Account
+	if !database.Healthy() {
+		// 降级模式下只有号池快照中的可用账号
+		accounts = service.PoolAccounts()
+	} else if err := database.GetReadDB().Order("id").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", service.OpenMetricsContentType)
+	c.Status(http.StatusOK)
+	service.WriteMetrics(c.Writer, accounts, service.PerAccountMetricsEnabled(), time.Now())
+}
+
+// UpstreamErrors 处理 GET /api/upstream-errors，返回按模型和账号分类的上游失败次数及校验错误率告警
+func (h *MetricsHandler) UpstreamErrors(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetUpstreamErrorStats())
+}
+
+// ActiveStreams 处理 GET /api/streams/active，返回进行中的流式请求及其估算积分
+func (h *MetricsHandler) ActiveStreams(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"streams": service.ListActiveStreams()})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+type ModelAliasHandler struct{}
+
+func NewModelAliasHandler() *ModelAliasHandler {
+	return &ModelAliasHandler{}
+}
+
+// List 列出全部模型别名
+func (h *ModelAliasHandler) List(c *gin.Context) {
+	aliases, err := service.ListModelAliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"aliases": aliases})
+}
+
+// Create 创建模型别名，立即对新请求生效
+func (h *ModelAliasHandler) Create(c *gin.Context) {
+	var req model.ModelAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	alias, err := service.CreateModelAlias(req)
+	if err != nil {
+		c.JSON(modelAliasErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelAlias] 创建模型别名 %d: %s -> %s", alias.ID, alias.Alias, alias.Target)
+	c.JSON(http.StatusOK, alias)
+}
+
+// Update 修改模型别名的名称、目标模型和启用状态
+func (h *ModelAliasHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req model.ModelAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	alias, err := service.UpdateModelAlias(uint(id), req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model alias not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(modelAliasErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelAlias] 修改模型别名 %d: %s -> %s, enabled=%v", alias.ID, alias.Alias, alias.Target, alias.Enabled)
+	c.JSON(http.StatusOK, alias)
+}
+
+// Delete 删除模型别名
+func (h *ModelAliasHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := service.DeleteModelAlias(uint(id)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelAlias] 删除模型别名 %d", id)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// modelAliasErrorStatus 校验失败返回 400，其余为数据库错误
+func modelAliasErrorStatus(err error) int {
+	var invalid *service.InvalidRequestError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
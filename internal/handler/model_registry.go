@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+type ModelRegistryHandler struct{}
+
+func NewModelRegistryHandler() *ModelRegistryHandler {
+	return &ModelRegistryHandler{}
+}
+
+// List 列出模型注册表，source 为 database 或 default（数据库中没有记录，使用编译时的默认模型表）
+func (h *ModelRegistryHandler) List(c *gin.Context) {
+	entries, source, err := service.ListModelRegistry()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"source": source, "models": entries})
+}
+
+// Create 向模型注册表添加模型，立即对新请求生效
+func (h *ModelRegistryHandler) Create(c *gin.Context) {
+	var req model.ModelRegistryEntry
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.CreateModelRegistryEntry(req); err != nil {
+		c.JSON(modelRegistryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelRegistry] 添加模型 %s (%s, %s)", req.Name, req.ProviderID, req.Model)
+	h.respondEntry(c, req.Name)
+}
+
+// Update 整体替换模型配置，模型名取自路径
+func (h *ModelRegistryHandler) Update(c *gin.Context) {
+	var req model.ModelRegistryEntry
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := c.Param("id")
+	if err := service.UpdateModelRegistryEntry(name, req); err != nil {
+		c.JSON(modelRegistryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelRegistry] 修改模型 %s", name)
+	h.respondEntry(c, name)
+}
+
+// Delete 从模型注册表删除模型
+func (h *ModelRegistryHandler) Delete(c *gin.Context) {
+	name := c.Param("id")
+	if err := service.DeleteModelRegistryEntry(name); err != nil {
+		c.JSON(modelRegistryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelRegistry] 删除模型 %s", name)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// Reload 重新从数据库加载模型注册表，用于多实例部署或直接修改了数据库的情况
+func (h *ModelRegistryHandler) Reload(c *gin.Context) {
+	if err := service.LoadModelRegistry(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.List(c)
+}
+
+// respondEntry 返回模型当前生效的配置（含同步后的超时、弃用计划和参数覆盖）
+func (h *ModelRegistryHandler) respondEntry(c *gin.Context, name string) {
+	zenModel, _ := model.GetZenModel(name)
+	c.JSON(http.StatusOK, model.ModelRegistryEntry{Name: name, ZenModel: zenModel})
+}
+
+// modelRegistryErrorStatus 校验失败返回 400，模型不存在返回 404，其余为数据库错误
+func modelRegistryErrorStatus(err error) int {
+	var invalid *service.InvalidRequestError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
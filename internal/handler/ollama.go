@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+// OllamaHandler Ollama 兼容接口（/api/chat、/api/generate、/api/tags）
+// Chat / Generate 把请求转换为 OpenAI Chat Completions 格式后交给后续的 /v1/chat/completions 处理链，
+// 并把 OpenAI 响应改写为 Ollama 的 JSON / JSON Lines 格式
+type OllamaHandler struct{}
+
+func NewOllamaHandler() *OllamaHandler {
+	return &OllamaHandler{}
+}
+
+type ollamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature"`
+	TopP        *float64 `json:"top_p"`
+	NumPredict  int      `json:"num_predict"`
+	Stop        []string `json:"stop"`
+	Seed        *int     `json:"seed"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Prompt   string          `json:"prompt"`
+	System   string          `json:"system"`
+	Images   []string        `json:"images"`
+	Stream   *bool           `json:"stream"` // Ollama 默认流式
+	Format   json.RawMessage `json:"format"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+// Chat 处理 POST /api/chat
+func (h *OllamaHandler) Chat(c *gin.Context) {
+	h.bridge(c, false)
+}
+
+// Generate 处理 POST /api/generate，prompt / system 转换为单轮对话
+func (h *OllamaHandler) Generate(c *gin.Context) {
+	h.bridge(c, true)
+}
+
+func (h *OllamaHandler) bridge(c *gin.Context, generate bool) {
+	var req ollamaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	messages := req.Messages
+	if generate {
+		if req.Prompt == "" {
+			// 空 prompt 在 Ollama 中表示预加载模型，网关无需加载，直接返回完成
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{
+				"model":       req.Model,
+				"created_at":  time.Now().UTC().Format(time.RFC3339Nano),
+				"response":    "",
+				"done":        true,
+				"done_reason": "load",
+			})
+			return
+		}
+		messages = nil
+		if req.System != "" {
+			messages = append(messages, ollamaMessage{Role: "system", Content: req.System})
+		}
+		messages = append(messages, ollamaMessage{Role: "user", Content: req.Prompt, Images: req.Images})
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	body, err := ollamaToOpenAI(service.ResolveOllamaModel(req.Model), messages, req.Options, req.Format, stream)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+
+	w := &ollamaWriter{ResponseWriter: c.Writer, model: req.Model, generate: generate, start: time.Now()}
+	c.Writer = w
+	c.Next()
+	w.finish()
+	c.Writer = w.ResponseWriter
+}
+
+// ollamaToOpenAI 构造 OpenAI Chat Completions 请求体，images 转换为 image_url 内容块
+func ollamaToOpenAI(modelID string, messages []ollamaMessage, opts ollamaOptions, format json.RawMessage, stream bool) ([]byte, error) {
+	converted := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		if len(msg.Images) == 0 {
+			converted = append(converted, map[string]interface{}{"role": msg.Role, "content": msg.Content})
+			continue
+		}
+		parts := []map[string]interface{}{{"type": "text", "text": msg.Content}}
+		for i, img := range msg.Images {
+			data, err := base64.StdEncoding.DecodeString(img)
+			if err != nil {
+				return nil, fmt.Errorf("images[%d]: invalid base64 data", i)
+			}
+			url := fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(data), img)
+			parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]string{"url": url}})
+		}
+		converted = append(converted, map[string]interface{}{"role": msg.Role, "content": parts})
+	}
+
+	body := map[string]interface{}{
+		"model":    modelID,
+		"messages": converted,
+		"stream":   stream,
+	}
+	if opts.Temperature != nil {
+		body["temperature"] = *opts.Temperature
+	}
+	if opts.TopP != nil {
+		body["top_p"] = *opts.TopP
+	}
+	if opts.NumPredict > 0 {
+		body["max_tokens"] = opts.NumPredict
+	}
+	if len(opts.Stop) > 0 {
+		body["stop"] = opts.Stop
+	}
+	if opts.Seed != nil {
+		body["seed"] = *opts.Seed
+	}
+
+	// format 为 "json" 或 JSON Schema
+	if trimmed := bytes.TrimSpace(format); len(trimmed) > 0 && string(trimmed) != "null" && string(trimmed) != `""` {
+		if string(trimmed) == `"json"` {
+			body["response_format"] = map[string]string{"type": "json_object"}
+		} else if trimmed[0] == '{' {
+			body["response_format"] = map[string]interface{}{
+				"type":        "json_schema",
+				"json_schema": map[string]interface{}{"name": "response", "schema": json.RawMessage(trimmed)},
+			}
+		} else {
+			return nil, fmt.Errorf("format: must be \"json\" or a JSON schema")
+		}
+	}
+	return json.Marshal(body)
+}
+
+// ollamaWriter 把 OpenAI 格式的响应改写为 Ollama 格式
+// SSE 响应逐行转换为 JSON Lines；非流式和错误响应先缓冲，处理链结束后在 finish 中一次写出
+type ollamaWriter struct {
+	gin.ResponseWriter
+	model    string
+	generate bool
+	start    time.Time
+
+	status    int
+	streaming bool
+	buffered  bool
+	buf       bytes.Buffer // 非流式时为完整响应，流式时为未结束的行
+	done      bool
+
+	doneReason   string
+	promptTokens int
+	evalTokens   int
+}
+
+func (w *ollamaWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+// WriteHeaderNow 状态码在决定输出方式后才写出
+func (w *ollamaWriter) WriteHeaderNow() {}
+
+func (w *ollamaWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *ollamaWriter) Written() bool {
+	return w.streaming || w.buffered
+}
+
+func (w *ollamaWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ollamaWriter) Write(p []byte) (int, error) {
+	if !w.streaming && !w.buffered {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if w.status < http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+			w.streaming = true
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusOK)
+		} else {
+			w.buffered = true
+		}
+	}
+	w.buf.Write(p)
+	if w.buffered {
+		return len(p), nil
+	}
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// 未结束的行放回缓冲区
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		if err := w.handleLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *ollamaWriter) Flush() {
+	if w.streaming {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// handleLine 转换一行 SSE 数据
+func (w *ollamaWriter) handleLine(line string) error {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok || w.done {
+		return nil
+	}
+	data = strings.TrimSpace(data)
+	if data == "[DONE]" {
+		return w.writeDone()
+	}
+
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *model.Usage    `json:"usage"`
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return nil
+	}
+	if len(chunk.Error) > 0 {
+		w.done = true
+		return w.writeLine(gin.H{"error": ollamaErrorMessage([]byte(data))})
+	}
+	if chunk.Usage != nil {
+		w.promptTokens = chunk.Usage.PromptTokens
+		w.evalTokens = chunk.Usage.CompletionTokens
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.doneReason = *choice.FinishReason
+		}
+		if choice.Delta.Content != "" {
+			if err := w.writeLine(w.response(choice.Delta.Content, false)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *ollamaWriter) writeDone() error {
+	w.done = true
+	return w.writeLine(w.response("", true))
+}
+
+func (w *ollamaWriter) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := w.ResponseWriter.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// response 构造 Ollama 响应对象，done 时附带结束原因、耗时和 token 数
+func (w *ollamaWriter) response(content string, done bool) gin.H {
+	resp := gin.H{
+		"model":      w.model,
+		"created_at": time.Now().UTC().Format(time.RFC3339Nano),
+		"done":       done,
+	}
+	if w.generate {
+		resp["response"] = content
+	} else {
+		resp["message"] = gin.H{"role": "assistant", "content": content}
+	}
+	if done {
+		resp["done_reason"] = "stop"
+		if w.doneReason == "length" {
+			resp["done_reason"] = "length"
+		}
+		resp["total_duration"] = time.Since(w.start).Nanoseconds()
+		if w.promptTokens > 0 || w.evalTokens > 0 {
+			resp["prompt_eval_count"] = w.promptTokens
+			resp["eval_count"] = w.evalTokens
+		}
+	}
+	return resp
+}
+
+// finish 处理链结束后写出缓冲的响应，流式响应缺少 [DONE] 时补上结束行
+func (w *ollamaWriter) finish() {
+	switch {
+	case w.streaming:
+		if w.buf.Len() > 0 {
+			w.handleLine(w.buf.String())
+			w.buf.Reset()
+		}
+		if !w.done {
+			w.writeDone()
+		}
+	case w.buffered:
+		w.Header().Del("Content-Length")
+		if w.status >= http.StatusBadRequest {
+			w.writeJSON(w.status, gin.H{"error": ollamaErrorMessage(w.buf.Bytes())})
+			return
+		}
+		var resp model.ChatCompletionResponse
+		if err := json.Unmarshal(w.buf.Bytes(), &resp); err != nil || len(resp.Choices) == 0 {
+			w.writeJSON(http.StatusBadGateway, gin.H{"error": "invalid upstream response"})
+			return
+		}
+		w.doneReason = resp.Choices[0].FinishReason
+		w.promptTokens = resp.Usage.PromptTokens
+		w.evalTokens = resp.Usage.CompletionTokens
+		out := w.response(resp.Choices[0].Message.Content, true)
+		w.writeJSON(http.StatusOK, out)
+	}
+}
+
+func (w *ollamaWriter) writeJSON(status int, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(data)
+}
+
+// ollamaErrorMessage 从 OpenAI / Anthropic / 网关错误响应中取出错误信息
+func ollamaErrorMessage(body []byte) string {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		var text string
+		if json.Unmarshal(parsed.Error, &text) == nil && text != "" {
+			return text
+		}
+		var obj struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(parsed.Error, &obj) == nil && obj.Message != "" {
+			return obj.Message
+		}
+		if parsed.Message != "" {
+			return parsed.Message
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// Tags 处理 GET /api/tags，列出可见模型和 OLLAMA_MODEL_ALIASES 中的映射名
+func (h *OllamaHandler) Tags(c *gin.Context) {
+	names := service.ListOllamaModelNames()
+	models := make([]gin.H, 0, len(names))
+	modifiedAt := time.Unix(0, 0).UTC().Format(time.RFC3339)
+	for _, name := range names {
+		family := ""
+		if zenModel, ok := model.GetZenModel(service.ResolveOllamaModel(name)); ok {
+			family = zenModel.ProviderID
+		}
+		models = append(models, gin.H{
+			"name":        name,
+			"model":       name,
+			"modified_at": modifiedAt,
+			"size":        0,
+			"digest":      "",
+			"details":     gin.H{"format": "api", "family": family},
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"zencoder2api/internal/service"
+)
+
+// anthropicStream 返回逐字输出 text 的 Anthropic 流式响应
+func anthropicStream(text ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, t := range text {
+			fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":%q}}\n\n", t)
+		}
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}
+}
+
+func serveOllama(t *testing.T, path, body string, upstream http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	fake, _ := newFakeUpstream(t, upstream)
+	openai := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: fake})
+	h := NewOllamaHandler()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/chat", h.Chat, openai.ChatCompletions)
+	r.POST("/api/generate", h.Generate, openai.ChatCompletions)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", path, strings.NewReader(body)))
+	return rec
+}
+
+func TestOllamaChatStreamsJSONLines(t *testing.T) {
+	rec := serveOllama(t, "/api/chat", `{"model":"claude-sonnet-4-5-20250929:latest","messages":[{"role":"user","content":"hi"}]}`, anthropicStream("Hel", "lo"))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status = %d, content-type = %q, body = %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("lines = %v", lines)
+	}
+	var content string
+	for _, line := range lines[:2] {
+		content += line["message"].(map[string]interface{})["content"].(string)
+	}
+	last := lines[2]
+	if content != "Hello" || last["done"] != true || last["done_reason"] != "stop" || last["model"] != "claude-sonnet-4-5-20250929:latest" {
+		t.Errorf("content = %q, last = %v", content, last)
+	}
+}
+
+func TestOllamaGenerateNonStream(t *testing.T) {
+	rec := serveOllama(t, "/api/generate", `{"model":"claude-sonnet-4-5-20250929","prompt":"hi","system":"be brief","stream":false}`, anthropicOK)
+
+	var resp map[string]interface{}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if resp["response"] != "ok" || resp["done"] != true {
+		t.Errorf("response = %v", resp)
+	}
+}
+
+func TestOllamaChatErrorFormat(t *testing.T) {
+	rec := serveOllama(t, "/api/chat", `{"model":"no-such-model","messages":[{"role":"user","content":"hi"}],"stream":false}`, anthropicOK)
+
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if rec.Code != http.StatusServiceUnavailable || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || !strings.Contains(resp.Error, "traceid") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
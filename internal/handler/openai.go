@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -18,18 +19,23 @@ import (
 )
 
 type OpenAIHandler struct {
-	svc         *service.OpenAIService
-	grokSvc     *service.GrokService
-	geminiSvc   *service.GeminiService
-	anthropicSvc *service.AnthropicService
+	svc          openAIProxy
+	grokSvc      grokProxy
+	geminiSvc    geminiGenerator
+	anthropicSvc anthropicMessenger
 }
 
 func NewOpenAIHandler() *OpenAIHandler {
+	return NewOpenAIHandlerWithDeps(service.DefaultDependencies())
+}
+
+// NewOpenAIHandlerWithDeps 使用指定依赖构建各上游服务
+func NewOpenAIHandlerWithDeps(deps service.Dependencies) *OpenAIHandler {
 	return &OpenAIHandler{
-		svc:         service.NewOpenAIService(),
-		grokSvc:     service.NewGrokService(),
-		geminiSvc:   service.NewGeminiService(),
-		anthropicSvc: service.NewAnthropicService(),
+		svc:          service.NewOpenAIServiceWithDeps(deps),
+		grokSvc:      service.NewGrokServiceWithDeps(deps),
+		geminiSvc:    service.NewGeminiServiceWithDeps(deps),
+		anthropicSvc: service.NewAnthropicServiceWithDeps(deps),
 	}
 }
 
@@ -70,6 +76,16 @@ func (h *OpenAIHandler) ChatCompletions(c *gin.Context) {
 		return
 	}
 
+	// 按模型的参数策略删除或拒绝上游不接受的参数
+	body, dropped, err := service.ApplyChatParameterPolicy(zenModel, body)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	if len(dropped) > 0 {
+		c.Header(service.DroppedParametersHeader, strings.Join(dropped, ", "))
+	}
+
 	switch zenModel.ProviderID {
 	case "xai":
 		// Grok 模型使用 xAI 服务
@@ -94,7 +110,14 @@ func (h *OpenAIHandler) ChatCompletions(c *gin.Context) {
 	}
 }
 
-// Responses 处理 POST /v1/responses
+// Realtime 处理 GET /v1/realtime 的 WebSocket 升级请求，连接关闭前不会返回
+func (h *OpenAIHandler) Realtime(c *gin.Context) {
+	if err := h.svc.RealtimeProxy(c.Request.Context(), c.Writer, c.Request); err != nil {
+		h.handleError(c, err)
+	}
+}
+
+// Responses 处理 POST /v1/responses，Claude / Gemini / Grok 模型转换为 Chat Completions 处理
 func (h *OpenAIHandler) Responses(c *gin.Context) {
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -102,30 +125,136 @@ func (h *OpenAIHandler) Responses(c *gin.Context) {
 		return
 	}
 
+	if h.bridgeResponses(c, body) {
+		return
+	}
 	if err := h.svc.ResponsesProxy(c.Request.Context(), c.Writer, body); err != nil {
 		h.handleError(c, err)
 	}
 }
 
+// Embeddings 处理 POST /v1/embeddings
+func (h *OpenAIHandler) Embeddings(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.svc.EmbeddingsProxy(c.Request.Context(), c.Writer, body); err != nil {
+		h.handleError(c, err)
+	}
+}
+
 // Models 处理 GET /v1/models
+// Anthropic SDK 会发送 anthropic-version 头，此时返回 Anthropic 格式的列表
 func (h *OpenAIHandler) Models(c *gin.Context) {
+	if c.GetHeader("anthropic-version") != "" {
+		writeAnthropicModels(c)
+		return
+	}
 	c.JSON(http.StatusOK, h.svc.ListModels())
 }
 
+// Model 处理 GET /v1/models/:id
+func (h *OpenAIHandler) Model(c *gin.Context) {
+	modelID := c.Param("id")
+	info, ok := h.svc.GetModel(modelID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("The model '%s' does not exist", modelID),
+				"type":    "invalid_request_error",
+				"param":   "model",
+				"code":    "model_not_found",
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
 // ModelSyncStatus 处理 GET /v1/models/status
 func (h *OpenAIHandler) ModelSyncStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, h.svc.GetModelSyncStatus())
 }
 
+// ModelAvailability 处理 GET /v1/models/:id/availability
+// 返回模型当前是否有可调度账号、预估等待时间和限流情况，不会占用账号
+func (h *OpenAIHandler) ModelAvailability(c *gin.Context) {
+	modelID := c.Param("id")
+	if _, ok := model.GetZenModel(modelID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("The model '%s' does not exist", modelID),
+				"type":    "invalid_request_error",
+				"code":    "model_not_found",
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, service.GetModelAvailability(modelID))
+}
+
 // handleError 统一处理错误，特别是没有可用账号的错误
 func (h *OpenAIHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrClientDisconnected) {
+		// 客户端已断开，已记录到请求日志，无需再写响应
+		return
+	}
 	if errors.Is(err, service.ErrNoAvailableAccount) || errors.Is(err, service.ErrNoPermission) {
-		traceID := generateTraceID()
+		if forwardOverflow(c) {
+			return
+		}
+		traceID := service.ErrorTraceID(c.Request.Context())
 		errMsg := fmt.Sprintf("没有可用token（traceid: %s）", traceID)
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMsg})
 		return
 	}
-	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if errors.Is(err, service.ErrUpstreamUnreachable) {
+		// 重试耗尽的内部细节只写日志，不返回给客户端
+		traceID := service.ErrorTraceID(c.Request.Context())
+		service.LogEvent(c.Request.Context(), slog.LevelWarn, "OpenAI", "上游不可达",
+			slog.String("trace_id", traceID), slog.Int("status", http.StatusBadGateway), slog.Any("error", err))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("上游服务暂时无法连接（traceid: %s）", traceID),
+				"type":    "upstream_error",
+				"code":    "upstream_unreachable",
+			},
+		})
+		return
+	}
+	if errors.Is(err, service.ErrLatencyBudgetExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": gin.H{
+				"message": "换号重试后仍未在延迟预算内收到上游响应",
+				"type":    "upstream_error",
+				"code":    "budget_exceeded",
+			},
+		})
+		return
+	}
+	var invalid *service.InvalidRequestError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": invalid.Message,
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	// 其余错误可能包含重试和账号细节，只写日志
+	traceID := service.ErrorTraceID(c.Request.Context())
+	service.LogEvent(c.Request.Context(), slog.LevelError, "OpenAI", "请求失败",
+		slog.String("trace_id", traceID), slog.Int("status", http.StatusInternalServerError), slog.Any("error", err))
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"message": fmt.Sprintf("内部错误（traceid: %s）", traceID),
+			"type":    "api_error",
+		},
+	})
 }
 
 // handleGeminiChatCompletions 处理通过 /v1/chat/completions 发送的 Gemini 模型请求
@@ -146,7 +275,7 @@ func (h *OpenAIHandler) handleGeminiChatCompletions(c *gin.Context, modelName st
 
 	// 转换为 Gemini 格式
 	geminiContents := make([]map[string]interface{}, 0)
-	for _, msg := range req.Messages {
+	for i, msg := range req.Messages {
 		role := msg.Role
 		if role == "assistant" {
 			role = "model"
@@ -159,12 +288,9 @@ func (h *OpenAIHandler) handleGeminiChatCompletions(c *gin.Context, modelName st
 		case string:
 			parts = []map[string]interface{}{{"text": content}}
 		case []interface{}:
-			for _, part := range content {
-				if partMap, ok := part.(map[string]interface{}); ok {
-					if partMap["type"] == "text" {
-						parts = append(parts, map[string]interface{}{"text": partMap["text"]})
-					}
-				}
+			var err error
+			if parts, err = openAIContentToGeminiParts(c.Request.Context(), i, content); err != nil {
+				return err
 			}
 		}
 
@@ -274,11 +400,12 @@ func (h *OpenAIHandler) streamGeminiToOpenAI(c *gin.Context, modelName string, b
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.WriteHeader(http.StatusOK)
 
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
+	if _, ok := c.Writer.(http.Flusher); !ok {
 		return fmt.Errorf("streaming not supported")
 	}
 
+	sse := service.NewSSEWriter(c.Request.Context(), c.Writer)
+	defer sse.KeepAlive()()
 	reader := bufio.NewReader(resp.Body)
 	timestamp := time.Now().Unix()
 	id := fmt.Sprintf("chatcmpl-%d", timestamp)
@@ -304,11 +431,14 @@ func (h *OpenAIHandler) streamGeminiToOpenAI(c *gin.Context, modelName string, b
 						},
 					}
 					finishBytes, _ := json.Marshal(finishChunk)
-					fmt.Fprintf(c.Writer, "data: %s\n\n", string(finishBytes))
+					if err := sse.Printf("data: %s\n\n", string(finishBytes)); err != nil {
+						return err
+					}
+				}
+				if err := sse.Printf("data: [DONE]\n\n"); err != nil {
+					return err
 				}
-				fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
-				flusher.Flush()
-				return nil
+				return sse.Flush()
 			}
 			return err
 		}
@@ -320,9 +450,10 @@ func (h *OpenAIHandler) streamGeminiToOpenAI(c *gin.Context, modelName string, b
 
 		data := strings.TrimSpace(strings.TrimPrefix(trimmedLine, "data:"))
 		if data == "[DONE]" {
-			fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
-			flusher.Flush()
-			return nil
+			if err := sse.Printf("data: [DONE]\n\n"); err != nil {
+				return err
+			}
+			return sse.Flush()
 		}
 
 		// 解析 Gemini SSE 数据
@@ -366,8 +497,12 @@ func (h *OpenAIHandler) streamGeminiToOpenAI(c *gin.Context, modelName string, b
 			}
 
 			chunkBytes, _ := json.Marshal(chunk)
-			fmt.Fprintf(c.Writer, "data: %s\n\n", string(chunkBytes))
-			flusher.Flush()
+			if err := sse.Printf("data: %s\n\n", string(chunkBytes)); err != nil {
+				return err
+			}
+			if err := sse.Flush(); err != nil {
+				return err
+			}
 			sentFirstChunk = true
 		}
 	}
@@ -378,28 +513,68 @@ func (h *OpenAIHandler) handleAnthropicChatCompletions(c *gin.Context, modelName
 	// 解析 OpenAI 格式请求
 	var req struct {
 		Messages []struct {
-			Role    string      `json:"role"`
-			Content interface{} `json:"content"`
+			Role         string           `json:"role"`
+			Content      interface{}      `json:"content"`
+			ToolCalls    []model.ToolCall `json:"tool_calls"`
+			ToolCallID   string           `json:"tool_call_id"`
+			CacheControl interface{}      `json:"cache_control"`
 		} `json:"messages"`
-		Stream      bool    `json:"stream"`
-		MaxTokens   int     `json:"max_tokens"`
-		Temperature float64 `json:"temperature"`
+		Stream            bool         `json:"stream"`
+		MaxTokens         int          `json:"max_tokens"`
+		Temperature       float64      `json:"temperature"`
+		Stop              interface{}  `json:"stop"`
+		Tools             []openAITool `json:"tools"`
+		ToolChoice        interface{}  `json:"tool_choice"`
+		ParallelToolCalls *bool        `json:"parallel_tool_calls"`
+		// OpenAI SDK 的 extra_body 会合并到请求顶层，直接发送 HTTP 请求时也可以嵌套在 extra_body 中
+		Anthropic map[string]interface{} `json:"anthropic"`
+		ExtraBody struct {
+			Anthropic map[string]interface{} `json:"anthropic"`
+		} `json:"extra_body"`
 	}
 	if err := json.Unmarshal(body, &req); err != nil {
 		return fmt.Errorf("invalid request body: %w", err)
 	}
+	c.Request = c.Request.WithContext(service.WithAnthropicBeta(c.Request.Context(), c.Request.Header.Values("anthropic-beta")))
 
-	// 转换为 Anthropic 格式
-	var systemPrompt string
+	// 转换为 Anthropic 格式，各处的 cache_control 原样保留，客户端设置的 prompt 缓存断点不会丢失
+	var systemBlocks []interface{}
 	anthropicMessages := make([]map[string]interface{}, 0)
+	// 连续的 role=tool 消息合并到同一条 user 消息中
+	var toolResults map[string]interface{}
 
-	for _, msg := range req.Messages {
+	for i, msg := range req.Messages {
 		if msg.Role == "system" {
 			// Anthropic 使用单独的 system 参数
-			switch content := msg.Content.(type) {
-			case string:
-				systemPrompt = content
+			blocks, _ := withMessageCacheControl(openAISystemToAnthropic(msg.Content), msg.CacheControl).([]interface{})
+			systemBlocks = append(systemBlocks, blocks...)
+			continue
+		}
+
+		if msg.Role == "tool" {
+			block := openAIToolResultToAnthropic(msg.ToolCallID, msg.Content)
+			if msg.CacheControl != nil {
+				block["cache_control"] = msg.CacheControl
+			}
+			if toolResults != nil {
+				toolResults["content"] = append(toolResults["content"].([]interface{}), block)
+				continue
 			}
+			toolResults = map[string]interface{}{"role": "user", "content": []interface{}{block}}
+			anthropicMessages = append(anthropicMessages, toolResults)
+			continue
+		}
+		toolResults = nil
+
+		if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+			blocks, err := openAIToolCallsToAnthropic(i, msg.Content, msg.ToolCalls)
+			if err != nil {
+				return err
+			}
+			anthropicMessages = append(anthropicMessages, map[string]interface{}{
+				"role":    msg.Role,
+				"content": withMessageCacheControl(blocks, msg.CacheControl),
+			})
 			continue
 		}
 
@@ -408,15 +583,19 @@ func (h *OpenAIHandler) handleAnthropicChatCompletions(c *gin.Context, modelName
 		case string:
 			contentValue = content
 		case []interface{}:
-			// 保持数组格式
-			contentValue = content
+			// 保持数组格式，image_url 转为 image 块
+			blocks, err := openAIContentToAnthropic(c.Request.Context(), i, content)
+			if err != nil {
+				return err
+			}
+			contentValue = blocks
 		default:
 			contentValue = msg.Content
 		}
 
 		anthropicMessages = append(anthropicMessages, map[string]interface{}{
 			"role":    msg.Role,
-			"content": contentValue,
+			"content": withMessageCacheControl(contentValue, msg.CacheControl),
 		})
 	}
 
@@ -426,8 +605,8 @@ func (h *OpenAIHandler) handleAnthropicChatCompletions(c *gin.Context, modelName
 		"stream":   req.Stream,
 	}
 
-	if systemPrompt != "" {
-		anthropicBody["system"] = systemPrompt
+	if system := anthropicSystem(systemBlocks); system != nil {
+		anthropicBody["system"] = system
 	}
 	if req.MaxTokens > 0 {
 		anthropicBody["max_tokens"] = req.MaxTokens
@@ -437,6 +616,32 @@ func (h *OpenAIHandler) handleAnthropicChatCompletions(c *gin.Context, modelName
 	if req.Temperature > 0 {
 		anthropicBody["temperature"] = req.Temperature
 	}
+	stopSequences, err := openAIStopSequences(req.Stop)
+	if err != nil {
+		return err
+	}
+	if len(stopSequences) > 0 {
+		anthropicBody["stop_sequences"] = stopSequences
+	}
+	if len(req.Tools) > 0 {
+		tools, err := openAIToolsToAnthropic(req.Tools)
+		if err != nil {
+			return err
+		}
+		anthropicBody["tools"] = tools
+	}
+	toolChoice, err := openAIToolChoiceToAnthropic(req.ToolChoice, req.ParallelToolCalls)
+	if err != nil {
+		return err
+	}
+	if toolChoice != nil && len(req.Tools) > 0 {
+		anthropicBody["tool_choice"] = toolChoice
+	}
+	for _, extra := range []map[string]interface{}{req.ExtraBody.Anthropic, req.Anthropic} {
+		if err := mergeAnthropicPassthrough(anthropicBody, extra); err != nil {
+			return err
+		}
+	}
 
 	anthropicBodyBytes, err := json.Marshal(anthropicBody)
 	if err != nil {
@@ -450,6 +655,46 @@ func (h *OpenAIHandler) handleAnthropicChatCompletions(c *gin.Context, modelName
 	return h.nonStreamAnthropicToOpenAI(c, modelName, anthropicBodyBytes)
 }
 
+// openAIStopSequences 把 OpenAI 的 stop（字符串或字符串数组）转换为 Anthropic 的 stop_sequences
+func openAIStopSequences(stop interface{}) ([]string, error) {
+	switch v := stop.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case []interface{}:
+		sequences := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, &service.InvalidRequestError{Message: "stop: must be a string or an array of strings"}
+			}
+			if str != "" {
+				sequences = append(sequences, str)
+			}
+		}
+		return sequences, nil
+	}
+	return nil, &service.InvalidRequestError{Message: "stop: must be a string or an array of strings"}
+}
+
+// anthropicBridgeFields 由桥接逻辑生成的字段，不允许通过透传覆盖
+var anthropicBridgeFields = map[string]bool{"model": true, "messages": true, "stream": true}
+
+// mergeAnthropicPassthrough 把 anthropic 透传对象中的参数（如 top_k、metadata）合并到 Anthropic 请求，同名参数以透传为准
+func mergeAnthropicPassthrough(anthropicBody, extra map[string]interface{}) error {
+	for key, value := range extra {
+		if anthropicBridgeFields[key] {
+			return &service.InvalidRequestError{Message: fmt.Sprintf("anthropic.%s: cannot be overridden", key)}
+		}
+		anthropicBody[key] = value
+	}
+	return nil
+}
+
 // nonStreamAnthropicToOpenAI 非流式 Anthropic 响应转换为 OpenAI 格式
 func (h *OpenAIHandler) nonStreamAnthropicToOpenAI(c *gin.Context, modelName string, body []byte) error {
 	resp, err := h.anthropicSvc.Messages(c.Request.Context(), body, false)
@@ -466,8 +711,11 @@ func (h *OpenAIHandler) nonStreamAnthropicToOpenAI(c *gin.Context, modelName str
 	// 解析 Anthropic 响应
 	var anthropicResp struct {
 		Content []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
 		} `json:"content"`
 		StopReason string `json:"stop_reason"`
 	}
@@ -477,11 +725,23 @@ func (h *OpenAIHandler) nonStreamAnthropicToOpenAI(c *gin.Context, modelName str
 		return nil
 	}
 
-	// 提取文本内容
+	// 提取文本内容和工具调用
 	var content string
+	var toolCalls []model.ToolCall
 	for _, block := range anthropicResp.Content {
-		if block.Type == "text" {
+		switch block.Type {
+		case "text":
 			content += block.Text
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			toolCalls = append(toolCalls, model.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: model.ToolCallFunction{Name: block.Name, Arguments: arguments},
+			})
 		}
 	}
 
@@ -495,10 +755,11 @@ func (h *OpenAIHandler) nonStreamAnthropicToOpenAI(c *gin.Context, modelName str
 			{
 				Index: 0,
 				Message: model.ChatMessage{
-					Role:    "assistant",
-					Content: content,
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
 				},
-				FinishReason: "stop",
+				FinishReason: anthropicFinishReason(anthropicResp.StopReason),
 			},
 		},
 	}
@@ -508,6 +769,7 @@ func (h *OpenAIHandler) nonStreamAnthropicToOpenAI(c *gin.Context, modelName str
 }
 
 // streamAnthropicToOpenAI 流式 Anthropic 响应转换为 OpenAI 格式
+// 文本增量转为 content，tool_use 块的开始和 input_json_delta 转为 tool_calls 增量
 func (h *OpenAIHandler) streamAnthropicToOpenAI(c *gin.Context, modelName string, body []byte) error {
 	resp, err := h.anthropicSvc.Messages(c.Request.Context(), body, true)
 	if err != nil {
@@ -521,15 +783,45 @@ func (h *OpenAIHandler) streamAnthropicToOpenAI(c *gin.Context, modelName string
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.WriteHeader(http.StatusOK)
 
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
+	if _, ok := c.Writer.(http.Flusher); !ok {
 		return fmt.Errorf("streaming not supported")
 	}
 
+	sse := service.NewSSEWriter(c.Request.Context(), c.Writer)
+	defer sse.KeepAlive()()
 	reader := bufio.NewReader(resp.Body)
 	timestamp := time.Now().Unix()
 	id := fmt.Sprintf("chatcmpl-%d", timestamp)
 	sentFirstChunk := false
+	finishReason := "stop"
+	// Anthropic 内容块下标到 OpenAI tool_calls 下标的映射
+	toolIndexes := make(map[int]int)
+
+	writeDelta := func(delta model.ChatMessage, finish *string) error {
+		if !sentFirstChunk {
+			delta.Role = "assistant"
+		}
+		chunk := model.ChatCompletionChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: timestamp,
+			Model:   modelName,
+			Choices: []model.StreamChoice{
+				{
+					Index:        0,
+					Delta:        delta,
+					FinishReason: finish,
+				},
+			},
+		}
+
+		chunkBytes, _ := json.Marshal(chunk)
+		if err := sse.Printf("data: %s\n\n", string(chunkBytes)); err != nil {
+			return err
+		}
+		sentFirstChunk = true
+		return sse.Flush()
+	}
 
 	for {
 		line, err := reader.ReadString('\n')
@@ -537,25 +829,14 @@ func (h *OpenAIHandler) streamAnthropicToOpenAI(c *gin.Context, modelName string
 			if err == io.EOF {
 				// 发送结束标记
 				if sentFirstChunk {
-					finishChunk := model.ChatCompletionChunk{
-						ID:      id,
-						Object:  "chat.completion.chunk",
-						Created: timestamp,
-						Model:   modelName,
-						Choices: []model.StreamChoice{
-							{
-								Index:        0,
-								Delta:        model.ChatMessage{},
-								FinishReason: stringPtr("stop"),
-							},
-						},
+					if err := writeDelta(model.ChatMessage{}, stringPtr(finishReason)); err != nil {
+						return err
 					}
-					finishBytes, _ := json.Marshal(finishChunk)
-					fmt.Fprintf(c.Writer, "data: %s\n\n", string(finishBytes))
 				}
-				fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
-				flusher.Flush()
-				return nil
+				if err := sse.Printf("data: [DONE]\n\n"); err != nil {
+					return err
+				}
+				return sse.Flush()
 			}
 			return err
 		}
@@ -576,48 +857,62 @@ func (h *OpenAIHandler) streamAnthropicToOpenAI(c *gin.Context, modelName string
 		// 解析 Anthropic SSE 数据
 		var anthropicEvent struct {
 			Type  string `json:"type"`
+			Index int    `json:"index"`
 			Delta struct {
-				Type string `json:"type"`
-				Text string `json:"text"`
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
 			} `json:"delta"`
 			ContentBlock struct {
 				Type string `json:"type"`
 				Text string `json:"text"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
 			} `json:"content_block"`
 		}
 		if err := json.Unmarshal([]byte(data), &anthropicEvent); err != nil {
 			continue
 		}
 
-		var text string
-		if anthropicEvent.Type == "content_block_delta" && anthropicEvent.Delta.Type == "text_delta" {
-			text = anthropicEvent.Delta.Text
-		}
-
-		if text != "" {
-			delta := model.ChatMessage{Content: text}
-			if !sentFirstChunk {
-				delta.Role = "assistant"
+		var delta *model.ChatMessage
+		switch anthropicEvent.Type {
+		case "content_block_start":
+			if anthropicEvent.ContentBlock.Type == "tool_use" {
+				index := len(toolIndexes)
+				toolIndexes[anthropicEvent.Index] = index
+				delta = &model.ChatMessage{ToolCalls: []model.ToolCall{{
+					Index:    &index,
+					ID:       anthropicEvent.ContentBlock.ID,
+					Type:     "function",
+					Function: model.ToolCallFunction{Name: anthropicEvent.ContentBlock.Name},
+				}}}
 			}
-
-			chunk := model.ChatCompletionChunk{
-				ID:      id,
-				Object:  "chat.completion.chunk",
-				Created: timestamp,
-				Model:   modelName,
-				Choices: []model.StreamChoice{
-					{
-						Index:        0,
-						Delta:        delta,
-						FinishReason: nil,
-					},
-				},
+		case "content_block_delta":
+			switch anthropicEvent.Delta.Type {
+			case "text_delta":
+				if anthropicEvent.Delta.Text != "" {
+					delta = &model.ChatMessage{Content: anthropicEvent.Delta.Text}
+				}
+			case "input_json_delta":
+				index, ok := toolIndexes[anthropicEvent.Index]
+				if ok && anthropicEvent.Delta.PartialJSON != "" {
+					delta = &model.ChatMessage{ToolCalls: []model.ToolCall{{
+						Index:    &index,
+						Function: model.ToolCallFunction{Arguments: anthropicEvent.Delta.PartialJSON},
+					}}}
+				}
 			}
+		case "message_delta":
+			if anthropicEvent.Delta.StopReason != "" {
+				finishReason = anthropicFinishReason(anthropicEvent.Delta.StopReason)
+			}
+		}
 
-			chunkBytes, _ := json.Marshal(chunk)
-			fmt.Fprintf(c.Writer, "data: %s\n\n", string(chunkBytes))
-			flusher.Flush()
-			sentFirstChunk = true
+		if delta != nil {
+			if err := writeDelta(*delta, nil); err != nil {
+				return err
+			}
 		}
 	}
 }
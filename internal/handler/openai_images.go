@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"zencoder2api/internal/service"
+)
+
+// openAIImageURL 取出 image_url 片段中的地址，兼容字符串和 {"url": ...} 两种写法
+func openAIImageURL(part map[string]interface{}) string {
+	switch v := part["image_url"].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		url, _ := v["url"].(string)
+		return url
+	}
+	return ""
+}
+
+// imagePartError 给图片错误加上所在的消息和片段位置
+func imagePartError(msgIndex, partIndex int, err error) error {
+	if e, ok := err.(*service.InvalidRequestError); ok {
+		return &service.InvalidRequestError{Message: fmt.Sprintf("messages[%d].content[%d].image_url: %s", msgIndex, partIndex, e.Message)}
+	}
+	return err
+}
+
+// openAIContentToAnthropic 转换消息的内容片段：image_url 转为 Anthropic image 块（base64 或 url 来源），
+// 其他片段（text 及已是 Anthropic 格式的块）原样保留
+func openAIContentToAnthropic(ctx context.Context, msgIndex int, content []interface{}) ([]interface{}, error) {
+	blocks := make([]interface{}, 0, len(content))
+	for i, part := range content {
+		partMap, ok := part.(map[string]interface{})
+		if !ok || partMap["type"] != "image_url" {
+			blocks = append(blocks, part)
+			continue
+		}
+
+		image, err := service.ParseImageURL(ctx, openAIImageURL(partMap), false)
+		if err != nil {
+			return nil, imagePartError(msgIndex, i, err)
+		}
+		source := map[string]interface{}{"type": "url", "url": image.URL}
+		if image.URL == "" {
+			source = map[string]interface{}{"type": "base64", "media_type": image.MediaType, "data": image.Data}
+		}
+		block := map[string]interface{}{"type": "image", "source": source}
+		if cacheControl, ok := partMap["cache_control"]; ok {
+			block["cache_control"] = cacheControl
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// openAIContentToGeminiParts 转换消息的内容片段：text 转为 text part，image_url 转为 inlineData（远程图片先下载）
+func openAIContentToGeminiParts(ctx context.Context, msgIndex int, content []interface{}) ([]map[string]interface{}, error) {
+	var parts []map[string]interface{}
+	for i, part := range content {
+		partMap, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch partMap["type"] {
+		case "text":
+			parts = append(parts, map[string]interface{}{"text": partMap["text"]})
+		case "image_url":
+			image, err := service.ParseImageURL(ctx, openAIImageURL(partMap), true)
+			if err != nil {
+				return nil, imagePartError(msgIndex, i, err)
+			}
+			parts = append(parts, map[string]interface{}{
+				"inlineData": map[string]interface{}{"mimeType": image.MediaType, "data": image.Data},
+			})
+		}
+	}
+	return parts, nil
+}
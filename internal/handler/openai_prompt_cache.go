@@ -0,0 +1,69 @@
+package handler
+
+import "strings"
+
+// openAISystemToAnthropic 把 system 消息转换为 Anthropic system 文本块，片段上的 cache_control 原样保留
+func openAISystemToAnthropic(content interface{}) []interface{} {
+	switch v := content.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"type": "text", "text": v}}
+	case []interface{}:
+		blocks := make([]interface{}, 0, len(v))
+		for _, part := range v {
+			partMap, ok := part.(map[string]interface{})
+			if !ok || partMap["type"] != "text" {
+				continue
+			}
+			block := map[string]interface{}{"type": "text", "text": partMap["text"]}
+			if cacheControl, ok := partMap["cache_control"]; ok {
+				block["cache_control"] = cacheControl
+			}
+			blocks = append(blocks, block)
+		}
+		return blocks
+	}
+	return nil
+}
+
+// anthropicSystem 合并后的 system 参数：有缓存断点时使用块数组，否则拼接为字符串
+func anthropicSystem(blocks []interface{}) interface{} {
+	if len(blocks) == 0 {
+		return nil
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		blockMap := block.(map[string]interface{})
+		if _, ok := blockMap["cache_control"]; ok {
+			return blocks
+		}
+		text, _ := blockMap["text"].(string)
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// withMessageCacheControl 消息级别的 cache_control（LiteLLM 等客户端的写法）放到转换后内容的最后一个块上，
+// 字符串内容先转为文本块；cacheControl 为 nil 时原样返回
+func withMessageCacheControl(content interface{}, cacheControl interface{}) interface{} {
+	if cacheControl == nil {
+		return content
+	}
+	switch v := content.(type) {
+	case string:
+		return []interface{}{map[string]interface{}{"type": "text", "text": v, "cache_control": cacheControl}}
+	case []interface{}:
+		if len(v) == 0 {
+			return v
+		}
+		if last, ok := v[len(v)-1].(map[string]interface{}); ok {
+			if _, exists := last["cache_control"]; !exists {
+				last["cache_control"] = cacheControl
+			}
+		}
+		return v
+	}
+	return content
+}
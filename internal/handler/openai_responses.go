@@ -0,0 +1,659 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/model"
+)
+
+// responsesBridgeProviders 没有 Responses 接口的上游，/v1/responses 请求经 Chat Completions 转换
+var responsesBridgeProviders = map[string]bool{"anthropic": true, "gemini": true, "xai": true}
+
+type responsesRequest struct {
+	Model              string            `json:"model"`
+	Instructions       string            `json:"instructions"`
+	Input              json.RawMessage   `json:"input"`
+	Stream             bool              `json:"stream"`
+	MaxOutputTokens    int               `json:"max_output_tokens"`
+	Temperature        *float64          `json:"temperature"`
+	TopP               *float64          `json:"top_p"`
+	Tools              []json.RawMessage `json:"tools"`
+	ToolChoice         json.RawMessage   `json:"tool_choice"`
+	ParallelToolCalls  *bool             `json:"parallel_tool_calls"`
+	PreviousResponseID string            `json:"previous_response_id"`
+	Text               struct {
+		Format json.RawMessage `json:"format"`
+	} `json:"text"`
+}
+
+// responsesInputItem input 数组中的一项：消息、函数调用、函数调用结果或推理摘要
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallID    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+// bridgeResponses Anthropic / Gemini / xAI 模型的 Responses 请求转换为 Chat Completions 交给 ChatCompletions 处理，
+// 并把输出改写为 Responses 格式；其他模型返回 false，由调用方原样透传
+func (h *OpenAIHandler) bridgeResponses(c *gin.Context, body []byte) bool {
+	var req responsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return false
+	}
+	zenModel, ok := model.GetZenModel(req.Model)
+	if !ok || !responsesBridgeProviders[zenModel.ProviderID] {
+		return false
+	}
+
+	chatBody, err := responsesToChat(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": err.Error(), "type": "invalid_request_error"},
+		})
+		return true
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(chatBody))
+	c.Request.ContentLength = int64(len(chatBody))
+
+	w := &responsesWriter{
+		ResponseWriter: c.Writer,
+		model:          req.Model,
+		id:             "resp_" + generateTraceID(),
+		created:        time.Now().Unix(),
+		toolItems:      make(map[int]*responsesItem),
+	}
+	c.Writer = w
+	h.ChatCompletions(c)
+	w.finish()
+	c.Writer = w.ResponseWriter
+	return true
+}
+
+// responsesToChat 构造 Chat Completions 请求体：instructions 和 developer 消息转为 system 消息，
+// function_call / function_call_output 转为 tool_calls 和 role=tool 消息，推理摘要丢弃
+func responsesToChat(req responsesRequest) ([]byte, error) {
+	if req.PreviousResponseID != "" {
+		return nil, fmt.Errorf("previous_response_id is not supported for %s; send the full conversation in input", req.Model)
+	}
+
+	var messages []map[string]interface{}
+	if req.Instructions != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": req.Instructions})
+	}
+
+	var text string
+	if err := json.Unmarshal(req.Input, &text); err == nil {
+		messages = append(messages, map[string]interface{}{"role": "user", "content": text})
+	} else {
+		var items []responsesInputItem
+		if err := json.Unmarshal(req.Input, &items); err != nil {
+			return nil, fmt.Errorf("input: must be a string or an array of items")
+		}
+		for i, item := range items {
+			switch item.Type {
+			case "", "message":
+				msg, err := responsesMessageToChat(i, item)
+				if err != nil {
+					return nil, err
+				}
+				messages = append(messages, msg)
+			case "function_call":
+				call := model.ToolCall{
+					ID:       item.CallID,
+					Type:     "function",
+					Function: model.ToolCallFunction{Name: item.Name, Arguments: item.Arguments},
+				}
+				// 连续的函数调用合并到同一条 assistant 消息
+				if n := len(messages); n > 0 && messages[n-1]["role"] == "assistant" {
+					calls, _ := messages[n-1]["tool_calls"].([]model.ToolCall)
+					messages[n-1]["tool_calls"] = append(calls, call)
+					continue
+				}
+				messages = append(messages, map[string]interface{}{"role": "assistant", "content": "", "tool_calls": []model.ToolCall{call}})
+			case "function_call_output":
+				output := string(item.Output)
+				var s string
+				if json.Unmarshal(item.Output, &s) == nil {
+					output = s
+				}
+				messages = append(messages, map[string]interface{}{"role": "tool", "tool_call_id": item.CallID, "content": output})
+			case "reasoning":
+				continue
+			default:
+				return nil, fmt.Errorf("input[%d]: item type %q is not supported for %s", i, item.Type, req.Model)
+			}
+		}
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("input is required")
+	}
+
+	body := map[string]interface{}{
+		"model":    req.Model,
+		"messages": messages,
+		"stream":   req.Stream,
+	}
+	if req.Stream {
+		body["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if req.MaxOutputTokens > 0 {
+		body["max_tokens"] = req.MaxOutputTokens
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		body["top_p"] = *req.TopP
+	}
+	if req.ParallelToolCalls != nil {
+		body["parallel_tool_calls"] = *req.ParallelToolCalls
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, 0, len(req.Tools))
+		for i, raw := range req.Tools {
+			var tool struct {
+				Type        string          `json:"type"`
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Parameters  json.RawMessage `json:"parameters"`
+			}
+			if err := json.Unmarshal(raw, &tool); err != nil || tool.Type != "function" {
+				return nil, fmt.Errorf("tools[%d]: only function tools are supported for %s", i, req.Model)
+			}
+			function := map[string]interface{}{"name": tool.Name}
+			if tool.Description != "" {
+				function["description"] = tool.Description
+			}
+			if len(tool.Parameters) > 0 {
+				function["parameters"] = tool.Parameters
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+		body["tools"] = tools
+	}
+
+	if len(req.ToolChoice) > 0 && string(req.ToolChoice) != "null" {
+		var choice string
+		var named struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		switch {
+		case json.Unmarshal(req.ToolChoice, &choice) == nil:
+			body["tool_choice"] = choice
+		case json.Unmarshal(req.ToolChoice, &named) == nil && named.Type == "function" && named.Name != "":
+			body["tool_choice"] = map[string]interface{}{"type": "function", "function": map[string]string{"name": named.Name}}
+		default:
+			return nil, fmt.Errorf("tool_choice: must be auto, none, required or a function")
+		}
+	}
+
+	// text.format 对应 response_format，json_schema 的 name / schema / strict 在 Responses 中位于顶层
+	if len(req.Text.Format) > 0 {
+		var format struct {
+			Type   string          `json:"type"`
+			Name   string          `json:"name"`
+			Schema json.RawMessage `json:"schema"`
+			Strict *bool           `json:"strict"`
+		}
+		if err := json.Unmarshal(req.Text.Format, &format); err != nil {
+			return nil, fmt.Errorf("text.format: %v", err)
+		}
+		switch format.Type {
+		case "", "text":
+		case "json_object":
+			body["response_format"] = map[string]string{"type": "json_object"}
+		case "json_schema":
+			schema := map[string]interface{}{"name": format.Name, "schema": format.Schema}
+			if format.Strict != nil {
+				schema["strict"] = *format.Strict
+			}
+			body["response_format"] = map[string]interface{}{"type": "json_schema", "json_schema": schema}
+		default:
+			return nil, fmt.Errorf("text.format: type %q is not supported", format.Type)
+		}
+	}
+	return json.Marshal(body)
+}
+
+// responsesMessageToChat 转换一条消息：input_text / output_text 转为 text 片段，input_image 转为 image_url 片段
+func responsesMessageToChat(index int, item responsesInputItem) (map[string]interface{}, error) {
+	role := item.Role
+	if role == "developer" {
+		role = "system"
+	}
+	var text string
+	if err := json.Unmarshal(item.Content, &text); err == nil {
+		return map[string]interface{}{"role": role, "content": text}, nil
+	}
+
+	var parts []struct {
+		Type     string          `json:"type"`
+		Text     string          `json:"text"`
+		ImageURL json.RawMessage `json:"image_url"`
+	}
+	if err := json.Unmarshal(item.Content, &parts); err != nil {
+		return nil, fmt.Errorf("input[%d].content: must be a string or an array of content parts", index)
+	}
+	converted := make([]map[string]interface{}, 0, len(parts))
+	texts := make([]string, 0, len(parts))
+	for j, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			converted = append(converted, map[string]interface{}{"type": "text", "text": part.Text})
+			texts = append(texts, part.Text)
+		case "input_image":
+			var url string
+			if json.Unmarshal(part.ImageURL, &url) != nil || url == "" {
+				return nil, fmt.Errorf("input[%d].content[%d]: input_image requires image_url", index, j)
+			}
+			converted = append(converted, map[string]interface{}{"type": "image_url", "image_url": map[string]string{"url": url}})
+		default:
+			return nil, fmt.Errorf("input[%d].content[%d]: content type %q is not supported", index, j, part.Type)
+		}
+	}
+	// assistant 和 system 消息只有文本，拼接为字符串
+	if role != "user" && len(texts) == len(converted) {
+		return map[string]interface{}{"role": role, "content": strings.Join(texts, "")}, nil
+	}
+	return map[string]interface{}{"role": role, "content": converted}, nil
+}
+
+// responsesItem 一个输出项：assistant 文本消息或函数调用
+type responsesItem struct {
+	id          string
+	outputIndex int
+	function    bool
+	callID      string
+	name        string
+	content     strings.Builder // 文本或调用参数
+	done        bool
+}
+
+// object 输出项的 Responses 表示
+func (item *responsesItem) object() gin.H {
+	status := "in_progress"
+	if item.done {
+		status = "completed"
+	}
+	if item.function {
+		return gin.H{
+			"id":        item.id,
+			"type":      "function_call",
+			"status":    status,
+			"call_id":   item.callID,
+			"name":      item.name,
+			"arguments": item.content.String(),
+		}
+	}
+	content := []gin.H{}
+	if item.done {
+		content = append(content, gin.H{"type": "output_text", "text": item.content.String(), "annotations": []interface{}{}})
+	}
+	return gin.H{"id": item.id, "type": "message", "status": status, "role": "assistant", "content": content}
+}
+
+// responsesWriter 把 Chat Completions 格式的响应改写为 Responses 格式
+// SSE 响应逐行转换为 Responses 事件；非流式和错误响应先缓冲，处理链结束后在 finish 中一次写出
+type responsesWriter struct {
+	gin.ResponseWriter
+	model   string
+	id      string
+	created int64
+
+	status    int
+	streaming bool
+	buffered  bool
+	buf       bytes.Buffer // 非流式时为完整响应，流式时为未结束的行
+	done      bool
+	sequence  int
+
+	items        []*responsesItem
+	text         *responsesItem         // 正在输出的文本消息
+	toolItems    map[int]*responsesItem // tool_calls 下标到输出项
+	finishReason string
+	usage        *model.Usage
+}
+
+func (w *responsesWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+// WriteHeaderNow 状态码在决定输出方式后才写出
+func (w *responsesWriter) WriteHeaderNow() {}
+
+func (w *responsesWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *responsesWriter) Written() bool {
+	return w.streaming || w.buffered
+}
+
+func (w *responsesWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesWriter) Write(p []byte) (int, error) {
+	if !w.streaming && !w.buffered {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if w.status < http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+			w.streaming = true
+			w.Header().Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusOK)
+			if err := w.writeEvent("response.created", gin.H{"response": w.response("in_progress")}); err != nil {
+				return 0, err
+			}
+			if err := w.writeEvent("response.in_progress", gin.H{"response": w.response("in_progress")}); err != nil {
+				return 0, err
+			}
+		} else {
+			w.buffered = true
+		}
+	}
+	w.buf.Write(p)
+	if w.buffered {
+		return len(p), nil
+	}
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// 未结束的行放回缓冲区
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		if err := w.handleLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *responsesWriter) Flush() {
+	if w.streaming {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// handleLine 转换一行 SSE 数据
+func (w *responsesWriter) handleLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, ":") && !w.done {
+		// keep-alive 注释帧原样转发
+		if _, err := io.WriteString(w.ResponseWriter, trimmed+"\n\n"); err != nil {
+			return err
+		}
+		w.ResponseWriter.Flush()
+		return nil
+	}
+	data, ok := strings.CutPrefix(trimmed, "data:")
+	if !ok || w.done {
+		return nil
+	}
+	data = strings.TrimSpace(data)
+	if data == "[DONE]" {
+		return w.complete()
+	}
+
+	var chunk struct {
+		Choices []struct {
+			Delta        model.ChatMessage `json:"delta"`
+			FinishReason *string           `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *model.Usage    `json:"usage"`
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return nil
+	}
+	if len(chunk.Error) > 0 {
+		w.done = true
+		return w.writeEvent("error", gin.H{"code": "upstream_error", "message": ollamaErrorMessage([]byte(data))})
+	}
+	if chunk.Usage != nil {
+		w.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+		if choice.Delta.Content != "" {
+			if err := w.textDelta(choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			if err := w.toolCallDelta(call); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// textDelta 输出文本增量，需要时先开始新的消息项
+func (w *responsesWriter) textDelta(delta string) error {
+	if w.text == nil {
+		w.text = w.addItem(&responsesItem{id: "msg_" + generateTraceID()})
+		if err := w.writeEvent("response.output_item.added", gin.H{"output_index": w.text.outputIndex, "item": w.text.object()}); err != nil {
+			return err
+		}
+		if err := w.writeEvent("response.content_part.added", gin.H{
+			"item_id":       w.text.id,
+			"output_index":  w.text.outputIndex,
+			"content_index": 0,
+			"part":          gin.H{"type": "output_text", "text": "", "annotations": []interface{}{}},
+		}); err != nil {
+			return err
+		}
+	}
+	w.text.content.WriteString(delta)
+	return w.writeEvent("response.output_text.delta", gin.H{
+		"item_id":       w.text.id,
+		"output_index":  w.text.outputIndex,
+		"content_index": 0,
+		"delta":         delta,
+	})
+}
+
+// toolCallDelta 带 id 的增量开始新的函数调用项（此前的文本消息随之结束），之后的增量追加参数
+func (w *responsesWriter) toolCallDelta(call model.ToolCall) error {
+	index := 0
+	if call.Index != nil {
+		index = *call.Index
+	}
+	item := w.toolItems[index]
+	if item == nil {
+		if w.text != nil {
+			if err := w.finishItem(w.text); err != nil {
+				return err
+			}
+			w.text = nil
+		}
+		item = w.addItem(&responsesItem{id: "fc_" + generateTraceID(), function: true, callID: call.ID, name: call.Function.Name})
+		w.toolItems[index] = item
+		if err := w.writeEvent("response.output_item.added", gin.H{"output_index": item.outputIndex, "item": item.object()}); err != nil {
+			return err
+		}
+	}
+	if call.Function.Arguments == "" {
+		return nil
+	}
+	item.content.WriteString(call.Function.Arguments)
+	return w.writeEvent("response.function_call_arguments.delta", gin.H{
+		"item_id":      item.id,
+		"output_index": item.outputIndex,
+		"delta":        call.Function.Arguments,
+	})
+}
+
+func (w *responsesWriter) addItem(item *responsesItem) *responsesItem {
+	item.outputIndex = len(w.items)
+	w.items = append(w.items, item)
+	return item
+}
+
+// finishItem 输出项的结束事件
+func (w *responsesWriter) finishItem(item *responsesItem) error {
+	if item.done {
+		return nil
+	}
+	item.done = true
+	if item.function {
+		if err := w.writeEvent("response.function_call_arguments.done", gin.H{
+			"item_id":      item.id,
+			"output_index": item.outputIndex,
+			"arguments":    item.content.String(),
+		}); err != nil {
+			return err
+		}
+	} else {
+		part := gin.H{"type": "output_text", "text": item.content.String(), "annotations": []interface{}{}}
+		if err := w.writeEvent("response.output_text.done", gin.H{
+			"item_id":       item.id,
+			"output_index":  item.outputIndex,
+			"content_index": 0,
+			"text":          item.content.String(),
+		}); err != nil {
+			return err
+		}
+		if err := w.writeEvent("response.content_part.done", gin.H{
+			"item_id":       item.id,
+			"output_index":  item.outputIndex,
+			"content_index": 0,
+			"part":          part,
+		}); err != nil {
+			return err
+		}
+	}
+	return w.writeEvent("response.output_item.done", gin.H{"output_index": item.outputIndex, "item": item.object()})
+}
+
+// complete 结束所有输出项并发送 response.completed，达到 max_output_tokens 时为 response.incomplete
+func (w *responsesWriter) complete() error {
+	w.done = true
+	for _, item := range w.items {
+		if err := w.finishItem(item); err != nil {
+			return err
+		}
+	}
+	status := w.responseStatus()
+	return w.writeEvent("response."+status, gin.H{"response": w.response(status)})
+}
+
+func (w *responsesWriter) responseStatus() string {
+	if w.finishReason == "length" {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+// writeEvent 写出一个 Responses SSE 事件，sequence_number 依次递增
+func (w *responsesWriter) writeEvent(eventType string, fields gin.H) error {
+	fields["type"] = eventType
+	fields["sequence_number"] = w.sequence
+	w.sequence++
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", eventType, data); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// response 构造 Responses 响应对象
+func (w *responsesWriter) response(status string) gin.H {
+	output := make([]gin.H, 0, len(w.items))
+	for _, item := range w.items {
+		output = append(output, item.object())
+	}
+	resp := gin.H{
+		"id":                 w.id,
+		"object":             "response",
+		"created_at":         w.created,
+		"status":             status,
+		"model":              w.model,
+		"output":             output,
+		"error":              nil,
+		"incomplete_details": nil,
+		"usage":              nil,
+	}
+	if status == "incomplete" {
+		resp["incomplete_details"] = gin.H{"reason": "max_output_tokens"}
+	}
+	if w.usage != nil {
+		resp["usage"] = gin.H{
+			"input_tokens":  w.usage.PromptTokens,
+			"output_tokens": w.usage.CompletionTokens,
+			"total_tokens":  w.usage.TotalTokens,
+		}
+	}
+	return resp
+}
+
+// finish 处理链结束后写出缓冲的响应，流式响应缺少 [DONE] 时补上结束事件
+func (w *responsesWriter) finish() {
+	switch {
+	case w.streaming:
+		if w.buf.Len() > 0 {
+			w.handleLine(w.buf.String())
+			w.buf.Reset()
+		}
+		if !w.done {
+			w.complete()
+		}
+	case w.buffered:
+		w.Header().Del("Content-Length")
+		if w.status >= http.StatusBadRequest {
+			w.writeJSON(w.status, gin.H{"error": gin.H{"message": ollamaErrorMessage(w.buf.Bytes()), "type": "upstream_error"}})
+			return
+		}
+		var resp model.ChatCompletionResponse
+		if err := json.Unmarshal(w.buf.Bytes(), &resp); err != nil || len(resp.Choices) == 0 {
+			w.writeJSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": "invalid upstream response", "type": "upstream_error"}})
+			return
+		}
+		message := resp.Choices[0].Message
+		if message.Content != "" {
+			item := w.addItem(&responsesItem{id: "msg_" + generateTraceID(), done: true})
+			item.content.WriteString(message.Content)
+		}
+		for _, call := range message.ToolCalls {
+			item := w.addItem(&responsesItem{id: "fc_" + generateTraceID(), function: true, callID: call.ID, name: call.Function.Name, done: true})
+			item.content.WriteString(call.Function.Arguments)
+		}
+		w.finishReason = resp.Choices[0].FinishReason
+		if resp.Usage != (model.Usage{}) {
+			w.usage = &resp.Usage
+		}
+		w.writeJSON(http.StatusOK, w.response(w.responseStatus()))
+	}
+}
+
+func (w *responsesWriter) writeJSON(status int, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,763 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+const testChatBody = `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"hi"}]}`
+
+func TestOpenAIChatCompletionsBridgesToAnthropic(t *testing.T) {
+	accounts, credits := newFakeAccounts(1), &fakeCredits{}
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: credits, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/chat/completions", testChatBody, h.ChatCompletions)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var resp model.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body)
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "ok" {
+		t.Errorf("response = %+v", resp)
+	}
+	if paths := upstream.seen(); len(paths) != 1 || paths[0] != "/anthropic/v1/messages" {
+		t.Errorf("upstream paths = %v", paths)
+	}
+	if accounts.released != 1 || credits.updates != 1 {
+		t.Errorf("released=%d credit updates=%d", accounts.released, credits.updates)
+	}
+}
+
+func TestOpenAIChatCompletionsBridgesStopAndPassthrough(t *testing.T) {
+	var sent map[string]interface{}
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		anthropicOK(w, r)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"hi"}],` +
+		`"stop":["END","STOP"],"anthropic":{"top_k":5},"extra_body":{"anthropic":{"top_k":1,"metadata":{"user_id":"u1"}}}}`
+	rec := serve(t, "POST", "/v1/chat/completions", body, h.ChatCompletions)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	stops, _ := sent["stop_sequences"].([]interface{})
+	if len(stops) != 2 || stops[0] != "END" || stops[1] != "STOP" {
+		t.Errorf("stop_sequences = %v", sent["stop_sequences"])
+	}
+	// 顶层 anthropic 对象（OpenAI SDK extra_body 合并后的形式）优先
+	if sent["top_k"] != float64(5) {
+		t.Errorf("top_k = %v", sent["top_k"])
+	}
+	if meta, _ := sent["metadata"].(map[string]interface{}); meta["user_id"] != "u1" {
+		t.Errorf("metadata = %v", sent["metadata"])
+	}
+	if _, leaked := sent["anthropic"]; leaked {
+		t.Error("passthrough object forwarded verbatim")
+	}
+}
+
+func TestOpenAIChatCompletionsBridgePreservesCacheControl(t *testing.T) {
+	var sent map[string]interface{}
+	var beta string
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		beta = r.Header.Get("anthropic-beta")
+		anthropicOK(w, r)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","messages":[` +
+		`{"role":"system","content":[{"type":"text","text":"long rules","cache_control":{"type":"ephemeral"}}]},` +
+		`{"role":"user","content":"big document","cache_control":{"type":"ephemeral","ttl":"1h"}},` +
+		`{"role":"user","content":"question"}],` +
+		`"tools":[{"type":"function","function":{"name":"lookup"},"cache_control":{"type":"ephemeral"}}]}`
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", h.ChatCompletions)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-beta", "prompt-caching-2024-07-31")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	system, _ := sent["system"].([]interface{})
+	if len(system) != 1 || system[0].(map[string]interface{})["cache_control"] == nil {
+		t.Errorf("system = %#v", sent["system"])
+	}
+	messages := sent["messages"].([]interface{})
+	first, _ := messages[0].(map[string]interface{})["content"].([]interface{})
+	if len(first) != 1 {
+		t.Fatalf("first message content = %#v", messages[0])
+	}
+	if cc, _ := first[0].(map[string]interface{})["cache_control"].(map[string]interface{}); cc["ttl"] != "1h" {
+		t.Errorf("message cache_control = %#v", first[0])
+	}
+	if messages[1].(map[string]interface{})["content"] != "question" {
+		t.Errorf("message without cache_control changed: %#v", messages[1])
+	}
+	if tool := sent["tools"].([]interface{})[0].(map[string]interface{}); tool["cache_control"] == nil {
+		t.Errorf("tool = %#v", tool)
+	}
+	if !strings.Contains(beta, "prompt-caching-2024-07-31") {
+		t.Errorf("anthropic-beta = %q", beta)
+	}
+}
+
+func TestOpenAIChatCompletionsPassthroughCannotOverrideModel(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"hi"}],"anthropic":{"model":"claude-opus-4-1-20250805"}}`
+	rec := serve(t, "POST", "/v1/chat/completions", body, h.ChatCompletions)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(upstream.seen()) != 0 {
+		t.Error("request forwarded upstream")
+	}
+}
+
+func TestOpenAIChatCompletionsUpstreamUnreachable(t *testing.T) {
+	upstream, srv := newFakeUpstream(t, anthropicOK)
+	srv.Close()
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/chat/completions", testChatBody, h.ChatCompletions)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error.Code != "upstream_unreachable" {
+		t.Errorf("body = %s", rec.Body)
+	}
+}
+
+func TestOpenAIChatCompletionsNoAccount(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/chat/completions", testChatBody, h.ChatCompletions)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOpenAIModels(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "GET", "/v1/models", "", h.Models)
+
+	var resp model.ModelListResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || len(resp.Data) == 0 {
+		t.Fatalf("status = %d, body = %.200s", rec.Code, rec.Body)
+	}
+}
+
+func TestModelsAnthropicFormatWithVersionHeader(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}, Upstream: upstream})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/models", h.Models)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v1/models?limit=2", nil)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	r.ServeHTTP(rec, req)
+
+	var resp service.AnthropicModelList
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || len(resp.Data) != 2 || !resp.HasMore {
+		t.Fatalf("status = %d, body = %.300s", rec.Code, rec.Body)
+	}
+	for _, m := range resp.Data {
+		if zenModel, _ := model.GetZenModel(m.ID); zenModel.ProviderID != "anthropic" {
+			t.Errorf("non-anthropic model listed: %s", m.ID)
+		}
+	}
+
+	r.GET("/anthropic/v1/models", NewAnthropicHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}, Upstream: upstream}).Models)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/anthropic/v1/models?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit status = %d", rec.Code)
+	}
+}
+
+func TestOpenAIChatCompletionsBridgeAppliesServiceTier(t *testing.T) {
+	defer service.SetServiceTierRule("vip", service.ServiceTierRule{})
+	if err := service.SetServiceTierRule("vip", service.ServiceTierRule{Override: "standard_only"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var sentTier string
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ServiceTier string `json:"service_tier"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		sentTier = req.ServiceTier
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1,"service_tier":"standard"}}`))
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	logger := service.NewRequestLogger()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", h.ChatCompletions)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(testChatBody))
+	ctx := service.WithAPIKey(service.WithLogger(context.Background(), logger), "vip")
+	req = req.WithContext(ctx)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if sentTier != "standard_only" {
+		t.Errorf("upstream service_tier = %q, want standard_only", sentTier)
+	}
+	if got := logger.ServiceTier(); got != "standard" {
+		t.Errorf("recorded served tier = %q, want standard", got)
+	}
+}
+
+func TestOpenAIModelAvailability(t *testing.T) {
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/models/status", h.ModelSyncStatus)
+	r.GET("/v1/models/:id/availability", h.ModelAvailability)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models/claude-sonnet-4-5-20250929-thinking/availability", nil))
+	var resp service.ModelAvailability
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if resp.ID != "claude-sonnet-4-5-20250929-thinking" || resp.Available || resp.Status != service.AvailabilityUnavailable {
+		t.Errorf("empty pool availability = %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models/no-such-model/availability", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown model status = %d, want 404", rec.Code)
+	}
+}
+
+func TestOpenAIModelsHideHiddenAndRetrieveByID(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(0), Credits: &fakeCredits{}, Upstream: upstream})
+
+	rec := serve(t, "GET", "/v1/models", "", h.Models)
+	var list model.ModelListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v (%.200s)", err, rec.Body)
+	}
+	for _, m := range list.Data {
+		zenModel, ok := model.GetZenModel(m.ID)
+		if !ok || zenModel.IsHidden {
+			t.Errorf("unexpected model listed: %s", m.ID)
+		}
+		if m.Metadata == nil || m.Metadata.Provider != zenModel.ProviderID || m.Metadata.Multiplier != zenModel.Multiplier {
+			t.Errorf("metadata for %s = %+v", m.ID, m.Metadata)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/models/:id", h.Model)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models/claude-sonnet-4-5-20250929", nil))
+	var info model.ModelInfo
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &info) != nil || info.ID != "claude-sonnet-4-5-20250929" || info.Object != "model" {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models/no-such-model", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "model_not_found") {
+		t.Errorf("unknown model status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOpenAIChatCompletionsBridgesToolCalls(t *testing.T) {
+	var sent map[string]interface{}
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_test","type":"message","role":"assistant","model":"test",`+
+			`"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_2","name":"get_weather","input":{"city":"Paris"}}],`+
+			`"stop_reason":"tool_use"}`)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","messages":[` +
+		`{"role":"user","content":"weather?"},` +
+		`{"role":"assistant","content":null,"tool_calls":[` +
+		`{"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Oslo\"}"}},` +
+		`{"id":"call_b","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},` +
+		`{"role":"tool","tool_call_id":"call_a","content":"cold"},` +
+		`{"role":"tool","tool_call_id":"call_b","content":"warm"}],` +
+		`"tools":[{"type":"function","function":{"name":"get_weather","description":"Get weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}],` +
+		`"tool_choice":"required","parallel_tool_calls":false}`
+	rec := serve(t, "POST", "/v1/chat/completions", body, h.ChatCompletions)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	tools, _ := sent["tools"].([]interface{})
+	if len(tools) != 1 || tools[0].(map[string]interface{})["input_schema"] == nil {
+		t.Errorf("tools = %v", sent["tools"])
+	}
+	if choice, _ := sent["tool_choice"].(map[string]interface{}); choice["type"] != "any" || choice["disable_parallel_tool_use"] != true {
+		t.Errorf("tool_choice = %v", sent["tool_choice"])
+	}
+	messages, _ := sent["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("messages = %v", sent["messages"])
+	}
+	assistant := messages[1].(map[string]interface{})["content"].([]interface{})
+	if len(assistant) != 2 || assistant[0].(map[string]interface{})["type"] != "tool_use" {
+		t.Errorf("assistant content = %v", assistant)
+	}
+	// 连续的工具结果合并到同一条 user 消息
+	results := messages[2].(map[string]interface{})["content"].([]interface{})
+	if len(results) != 2 || results[1].(map[string]interface{})["tool_use_id"] != "call_b" {
+		t.Errorf("tool results = %v", results)
+	}
+
+	var resp model.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "checking" || len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("choice = %+v", choice)
+	}
+	if call := choice.Message.ToolCalls[0]; call.ID != "toolu_2" || call.Function.Name != "get_weather" || call.Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+}
+
+func TestOpenAIChatCompletionsStreamsToolCallDeltas(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"message_start","message":{"id":"msg_test"}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`,
+			`{"type":"message_stop"}`,
+		} {
+			io.WriteString(w, "data: "+event+"\n\n")
+		}
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","stream":true,"messages":[{"role":"user","content":"weather?"}],` +
+		`"tools":[{"type":"function","function":{"name":"get_weather"}}]}`
+	rec := serve(t, "POST", "/v1/chat/completions", body, h.ChatCompletions)
+
+	var arguments, name, finish string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data := strings.TrimPrefix(line, "data: ")
+		if data == line || data == "[DONE]" {
+			continue
+		}
+		var chunk model.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		delta := chunk.Choices[0].Delta
+		for _, call := range delta.ToolCalls {
+			if call.Index == nil || *call.Index != 0 {
+				t.Errorf("tool call index = %v", call.Index)
+			}
+			name += call.Function.Name
+			arguments += call.Function.Arguments
+		}
+		if f := chunk.Choices[0].FinishReason; f != nil {
+			finish = *f
+		}
+	}
+	if name != "get_weather" || arguments != `{"city":"Paris"}` || finish != "tool_calls" {
+		t.Errorf("name=%q arguments=%q finish=%q\n%s", name, arguments, finish, rec.Body)
+	}
+}
+
+func TestOpenAIChatCompletionsBridgesImagesToAnthropic(t *testing.T) {
+	var sent map[string]interface{}
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		anthropicOK(w, r)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	png := "iVBORw0KGgoAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	body := `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":[` +
+		`{"type":"text","text":"what is this?"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,` + png + `"}},` +
+		`{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"high"}}]}]}`
+	rec := serve(t, "POST", "/v1/chat/completions", body, h.ChatCompletions)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	messages, _ := sent["messages"].([]interface{})
+	content := messages[0].(map[string]interface{})["content"].([]interface{})
+	if len(content) != 3 || content[0].(map[string]interface{})["type"] != "text" {
+		t.Fatalf("content = %v", content)
+	}
+	inline := content[1].(map[string]interface{})["source"].(map[string]interface{})
+	if inline["type"] != "base64" || inline["media_type"] != "image/png" || inline["data"] != png {
+		t.Errorf("inline image source = %v", inline)
+	}
+	remote := content[2].(map[string]interface{})["source"].(map[string]interface{})
+	if remote["type"] != "url" || remote["url"] != "https://example.com/cat.png" {
+		t.Errorf("remote image source = %v", remote)
+	}
+
+	bad := `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,aGVsbG8="}}]}]}`
+	rec = serve(t, "POST", "/v1/chat/completions", bad, h.ChatCompletions)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "messages[0].content[0].image_url") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOpenAIEmbeddingsRoutesThroughPool(t *testing.T) {
+	accounts, credits := newFakeAccounts(1), &fakeCredits{}
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Zen-Request-Cost", "0.1")
+		io.WriteString(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small","usage":{"prompt_tokens":2,"total_tokens":2}}`)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: credits, Upstream: upstream})
+
+	rec := serve(t, "POST", "/v1/embeddings", `{"model":"text-embedding-3-small","input":["hello"]}`, h.Embeddings)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"embedding":[0.1,0.2]`) {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if paths := upstream.seen(); len(paths) != 1 || paths[0] != "/openai/v1/embeddings" {
+		t.Errorf("upstream paths = %v", paths)
+	}
+	if accounts.acquired != 1 || accounts.released != 1 || credits.updates != 1 {
+		t.Errorf("acquired=%d released=%d credit updates=%d", accounts.acquired, accounts.released, credits.updates)
+	}
+}
+
+func TestOpenAIEmbeddingsRejectsInvalidRequests(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"Invalid 'input': empty string","type":"invalid_request_error"}}`)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	cases := []struct {
+		body string
+		want string
+	}{
+		{`{"model":"claude-sonnet-4-5-20250929","input":"hi"}`, "not an embedding model"},
+		{`{"model":"text-embedding-3-small"}`, "input is required"},
+		// 上游的参数错误原样返回，不换号重试
+		{`{"model":"text-embedding-3-small","input":""}`, "Invalid 'input'"},
+	}
+	for _, tc := range cases {
+		rec := serve(t, "POST", "/v1/embeddings", tc.body, h.Embeddings)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%s: status = %d, body = %s", tc.body, rec.Code, rec.Body)
+		}
+	}
+	if paths := upstream.seen(); len(paths) != 1 {
+		t.Errorf("upstream paths = %v", paths)
+	}
+}
+
+func TestOpenAIResponsesBridgesToAnthropic(t *testing.T) {
+	var sent map[string]interface{}
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_test","type":"message","role":"assistant","model":"test",`+
+			`"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_2","name":"get_weather","input":{"city":"Paris"}}],`+
+			`"stop_reason":"tool_use"}`)
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","instructions":"be brief","max_output_tokens":100,"input":[` +
+		`{"role":"developer","content":"use tools"},` +
+		`{"role":"user","content":[{"type":"input_text","text":"weather?"}]},` +
+		`{"type":"reasoning","summary":[]},` +
+		`{"type":"function_call","call_id":"call_a","name":"get_weather","arguments":"{\"city\":\"Oslo\"}"},` +
+		`{"type":"function_call_output","call_id":"call_a","output":"cold"}],` +
+		`"tools":[{"type":"function","name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}],` +
+		`"tool_choice":{"type":"function","name":"get_weather"}}`
+	rec := serve(t, "POST", "/v1/responses", body, h.Responses)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if paths := upstream.seen(); len(paths) != 1 || paths[0] != "/anthropic/v1/messages" {
+		t.Errorf("upstream paths = %v", paths)
+	}
+	if sent["system"] != "be brief\n\nuse tools" || sent["max_tokens"] != float64(100) {
+		t.Errorf("system = %v, max_tokens = %v", sent["system"], sent["max_tokens"])
+	}
+	if choice, _ := sent["tool_choice"].(map[string]interface{}); choice["type"] != "tool" || choice["name"] != "get_weather" {
+		t.Errorf("tool_choice = %v", sent["tool_choice"])
+	}
+	if messages, _ := sent["messages"].([]interface{}); len(messages) != 3 {
+		t.Errorf("messages = %v", sent["messages"])
+	}
+
+	var resp struct {
+		Object string `json:"object"`
+		Status string `json:"status"`
+		Output []struct {
+			Type      string `json:"type"`
+			CallID    string `json:"call_id"`
+			Arguments string `json:"arguments"`
+			Content   []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body)
+	}
+	if resp.Object != "response" || resp.Status != "completed" || len(resp.Output) != 2 {
+		t.Fatalf("response = %s", rec.Body)
+	}
+	if resp.Output[0].Type != "message" || resp.Output[0].Content[0].Text != "checking" {
+		t.Errorf("message = %+v", resp.Output[0])
+	}
+	if call := resp.Output[1]; call.Type != "function_call" || call.CallID != "toolu_2" || call.Arguments != `{"city":"Paris"}` {
+		t.Errorf("function call = %+v", call)
+	}
+}
+
+func TestOpenAIResponsesStreamsAnthropicAsEvents(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"message_start","message":{"id":"msg_test"}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`,
+			`{"type":"message_stop"}`,
+		} {
+			io.WriteString(w, "data: "+event+"\n\n")
+		}
+	})
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	body := `{"model":"claude-sonnet-4-5-20250929","stream":true,"input":"weather?","tools":[{"type":"function","name":"get_weather"}]}`
+	rec := serve(t, "POST", "/v1/responses", body, h.Responses)
+
+	var types []string
+	var text, arguments string
+	var completed struct {
+		Output []struct {
+			Type string `json:"type"`
+		} `json:"output"`
+	}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type     string          `json:"type"`
+			Delta    string          `json:"delta"`
+			Response json.RawMessage `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		types = append(types, event.Type)
+		switch event.Type {
+		case "response.output_text.delta":
+			text += event.Delta
+		case "response.function_call_arguments.delta":
+			arguments += event.Delta
+		case "response.completed":
+			json.Unmarshal(event.Response, &completed)
+		}
+	}
+	want := []string{
+		"response.created", "response.in_progress",
+		"response.output_item.added", "response.content_part.added", "response.output_text.delta",
+		"response.output_text.done", "response.content_part.done", "response.output_item.done",
+		"response.output_item.added", "response.function_call_arguments.delta", "response.function_call_arguments.delta",
+		"response.function_call_arguments.done", "response.output_item.done",
+		"response.completed",
+	}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v", types)
+	}
+	if text != "hi" || arguments != `{"city":"Paris"}` || len(completed.Output) != 2 || completed.Output[1].Type != "function_call" {
+		t.Errorf("text=%q arguments=%q completed=%+v", text, arguments, completed)
+	}
+}
+
+func TestOpenAIResponsesBridgeRejectsUnsupportedInput(t *testing.T) {
+	upstream, _ := newFakeUpstream(t, anthropicOK)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: newFakeAccounts(1), Credits: &fakeCredits{}, Upstream: upstream})
+
+	for _, body := range []string{
+		`{"model":"claude-sonnet-4-5-20250929","input":"hi","previous_response_id":"resp_1"}`,
+		`{"model":"claude-sonnet-4-5-20250929","input":"hi","tools":[{"type":"web_search"}]}`,
+		`{"model":"claude-sonnet-4-5-20250929","input":[{"type":"file_search_call"}]}`,
+	} {
+		rec := serve(t, "POST", "/v1/responses", body, h.Responses)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_request_error") {
+			t.Errorf("%s: status = %d, body = %s", body, rec.Code, rec.Body)
+		}
+	}
+	if paths := upstream.seen(); len(paths) != 0 {
+		t.Errorf("upstream paths = %v", paths)
+	}
+}
+
+func TestOpenAIRealtimeProxiesWebSocket(t *testing.T) {
+	var handshake http.Header
+	upstream, _ := newFakeUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		handshake = r.Header.Clone()
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Accept: test\r\n\r\n")
+		buf.Flush()
+		// 回显一行后关闭
+		line, _ := buf.ReadString('\n')
+		conn.Write([]byte("echo:" + line))
+	})
+	accounts := newFakeAccounts(1)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}, Upstream: upstream})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/realtime", h.Realtime)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /v1/realtime?model=claude-sonnet-4-5-20250929&key=client-key HTTP/1.1\r\nHost: test\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Key: dGVzdA==\r\nSec-WebSocket-Version: 13\r\nAuthorization: Bearer client-key\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "test" {
+		t.Fatalf("status = %d, headers = %v", resp.StatusCode, resp.Header)
+	}
+
+	// 连接期间账号保持占用
+	accounts.mu.Lock()
+	acquired, released := accounts.acquired, accounts.released
+	accounts.mu.Unlock()
+	if acquired != 1 || released != 0 {
+		t.Errorf("during socket: acquired=%d released=%d", acquired, released)
+	}
+
+	io.WriteString(conn, "hello\n")
+	if line, _ := reader.ReadString('\n'); line != "echo:hello\n" {
+		t.Errorf("echo = %q", line)
+	}
+	if paths := upstream.seen(); len(paths) != 1 || paths[0] != "/openai/v1/realtime" {
+		t.Errorf("upstream paths = %v", paths)
+	}
+	if handshake.Get("Authorization") != "Bearer fake-token" || handshake.Get("zen-model-id") == "" || handshake.Get("Sec-WebSocket-Key") != "dGVzdA==" {
+		t.Errorf("handshake headers = %v", handshake)
+	}
+
+	// 连接关闭后释放账号
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		accounts.mu.Lock()
+		released = accounts.released
+		accounts.mu.Unlock()
+		if released == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if released != 1 {
+		t.Errorf("after close: released=%d", released)
+	}
+}
+
+func TestOpenAIRealtimeRequiresUpgrade(t *testing.T) {
+	accounts := newFakeAccounts(1)
+	h := NewOpenAIHandlerWithDeps(service.Dependencies{Accounts: accounts, Credits: &fakeCredits{}})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/realtime", h.Realtime)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/realtime?model=claude-sonnet-4-5-20250929", nil))
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "WebSocket upgrade") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if accounts.acquired != 0 {
+		t.Errorf("acquired = %d", accounts.acquired)
+	}
+}
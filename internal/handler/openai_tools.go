@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+// openAITool OpenAI Chat Completions 的工具定义
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+	CacheControl interface{} `json:"cache_control"` // 转发给 Anthropic 的 prompt 缓存断点
+}
+
+// openAIToolsToAnthropic 把 OpenAI 的 function 工具转换为 Anthropic 工具，parameters 即 input_schema
+func openAIToolsToAnthropic(tools []openAITool) ([]map[string]interface{}, error) {
+	result := make([]map[string]interface{}, 0, len(tools))
+	for i, tool := range tools {
+		if tool.Type != "" && tool.Type != "function" {
+			return nil, &service.InvalidRequestError{Message: fmt.Sprintf("tools[%d].type: only function tools are supported", i)}
+		}
+		schema := tool.Function.Parameters
+		if schema == nil {
+			// Anthropic 要求 input_schema，无参数的函数使用空对象
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		converted := map[string]interface{}{
+			"name":         tool.Function.Name,
+			"input_schema": schema,
+		}
+		if tool.Function.Description != "" {
+			converted["description"] = tool.Function.Description
+		}
+		if tool.CacheControl != nil {
+			converted["cache_control"] = tool.CacheControl
+		}
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+// openAIToolChoiceToAnthropic 转换 tool_choice：auto/none/required 或指定函数，
+// parallel_tool_calls 为 false 时禁止并行调用；都未指定时返回 nil
+func openAIToolChoiceToAnthropic(choice interface{}, parallel *bool) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	switch v := choice.(type) {
+	case nil:
+	case string:
+		switch v {
+		case "auto":
+			result = map[string]interface{}{"type": "auto"}
+		case "none":
+			result = map[string]interface{}{"type": "none"}
+		case "required":
+			result = map[string]interface{}{"type": "any"}
+		default:
+			return nil, &service.InvalidRequestError{Message: "tool_choice: must be auto, none, required or a function"}
+		}
+	case map[string]interface{}:
+		function, _ := v["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		if name == "" {
+			return nil, &service.InvalidRequestError{Message: "tool_choice.function.name: is required"}
+		}
+		result = map[string]interface{}{"type": "tool", "name": name}
+	default:
+		return nil, &service.InvalidRequestError{Message: "tool_choice: must be auto, none, required or a function"}
+	}
+
+	if parallel != nil && !*parallel {
+		if result == nil {
+			result = map[string]interface{}{"type": "auto"}
+		}
+		if result["type"] != "none" {
+			result["disable_parallel_tool_use"] = true
+		}
+	}
+	return result, nil
+}
+
+// openAIToolCallsToAnthropic 把助手消息的文本和 tool_calls 转换为 Anthropic 的 text / tool_use 块
+func openAIToolCallsToAnthropic(msgIndex int, content interface{}, calls []model.ToolCall) ([]interface{}, error) {
+	blocks := make([]interface{}, 0, len(calls)+1)
+	switch v := content.(type) {
+	case string:
+		if v != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": v})
+		}
+	case []interface{}:
+		blocks = append(blocks, v...)
+	}
+
+	for i, call := range calls {
+		input := map[string]interface{}{}
+		if strings.TrimSpace(call.Function.Arguments) != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &input); err != nil {
+				return nil, &service.InvalidRequestError{Message: fmt.Sprintf("messages[%d].tool_calls[%d].function.arguments: must be a JSON object", msgIndex, i)}
+			}
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Function.Name,
+			"input": input,
+		})
+	}
+	return blocks, nil
+}
+
+// openAIToolResultToAnthropic 把 role=tool 的消息转换为 tool_result 块，文本片段数组与 Anthropic 格式兼容
+func openAIToolResultToAnthropic(toolCallID string, content interface{}) map[string]interface{} {
+	if content == nil {
+		content = ""
+	}
+	return map[string]interface{}{
+		"type":        "tool_result",
+		"tool_use_id": toolCallID,
+		"content":     content,
+	}
+}
+
+// anthropicFinishReason 把 Anthropic 的 stop_reason 转换为 OpenAI 的 finish_reason
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	}
+	return "stop"
+}
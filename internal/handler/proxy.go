@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+type ProxyHandler struct{}
+
+func NewProxyHandler() *ProxyHandler {
+	return &ProxyHandler{}
+}
+
+// List 列出 SOCKS_PROXY_POOL 和运行时添加的代理
+func (h *ProxyHandler) List(c *gin.Context) {
+	proxies, err := service.ListPoolProxies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"proxies": proxies})
+}
+
+// Create 添加代理，立即加入代理池
+func (h *ProxyHandler) Create(c *gin.Context) {
+	var req model.PoolProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	proxy, err := service.CreatePoolProxy(req)
+	if err != nil {
+		c.JSON(proxyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ProxyPool] 添加代理 %d: %s, region=%s", proxy.ID, proxy.URL, proxy.Region)
+	c.JSON(http.StatusOK, proxy)
+}
+
+// Delete 删除运行时添加的代理，SOCKS_PROXY_POOL 中的代理不能删除
+func (h *ProxyHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := service.DeletePoolProxy(uint(id)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ProxyPool] 删除代理 %d", id)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// Test 立即检查代理：{"id": 3} 检查已添加的代理，{"url": "..."} 检查尚未添加的代理
+func (h *ProxyHandler) Test(c *gin.Context) {
+	var req struct {
+		ID  uint   `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	health, err := service.TestPoolProxy(req.ID, req.URL)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "proxy not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(proxyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, health)
+}
+
+// proxyErrorStatus 校验失败返回 400，其余为数据库错误
+func proxyErrorStatus(err error) int {
+	var invalid *service.InvalidRequestError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+type ReportHandler struct{}
+
+func NewReportHandler() *ReportHandler {
+	return &ReportHandler{}
+}
+
+// Usage 处理 GET /api/reports/usage?days=7&format=csv
+// 返回按利用率排序的账号和各模型的饱和拒绝次数，用于规划需要补充的账号和套餐
+func (h *ReportHandler) Usage(c *gin.Context) {
+	days := service.UsageReportDefaultDays
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > service.UsageReportMaxDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(service.UsageReportMaxDays)})
+			return
+		}
+		days = n
+	}
+
+	report, err := service.BuildUsageReport(days, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	var buf bytes.Buffer
+	if err := service.WriteUsageReportCSV(&buf, report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=\"usage-"+report.From+"-"+report.To+".csv\"")
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// UsageSummary 处理 GET /api/usage?group_by=model&days=7
+// 按日期、模型、账号或 API Key 归集请求日志中的请求数、失败数、Zen-Request-Cost 和平均耗时
+func (h *ReportHandler) UsageSummary(c *gin.Context) {
+	days := service.UsageReportDefaultDays
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > service.UsageReportMaxDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(service.UsageReportMaxDays)})
+			return
+		}
+		days = n
+	}
+
+	summary, err := service.AggregateRequestLogs(c.DefaultQuery("group_by", service.UsageGroupDay), days, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// RequestSizes 处理 GET /api/usage/sizes?group_by=model&days=7
+// 按模型或账号返回请求体、响应体大小和流持续时间的 P50/P95，用于配置超时和找出发送异常请求体的客户端
+func (h *ReportHandler) RequestSizes(c *gin.Context) {
+	days := service.UsageReportDefaultDays
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > service.UsageReportMaxDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(service.UsageReportMaxDays)})
+			return
+		}
+		days = n
+	}
+
+	stats, err := service.AggregateRequestSizes(c.DefaultQuery("group_by", service.UsageGroupModel), days, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// RequestLogs 处理 GET /api/usage/logs?model=&account_id=&errors=true&limit=100，返回最近的请求日志
+func (h *ReportHandler) RequestLogs(c *gin.Context) {
+	filter := service.RequestLogFilter{
+		Model:      c.Query("model"),
+		ErrorsOnly: c.Query("errors") == "true",
+	}
+	if raw := c.Query("account_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account_id"})
+			return
+		}
+		filter.AccountID = uint(id)
+	}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	logs, err := service.ListRequestLogs(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"logs": logs})
+}
+
+// Simulate 处理 POST /api/admin/simulate，按假设的账号数和请求速率推演号池的饱和时刻和 429 比例
+func (h *ReportHandler) Simulate(c *gin.Context) {
+	var req service.SimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := service.SimulatePool(req, time.Now())
+	if err != nil {
+		var invalid *service.InvalidRequestError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
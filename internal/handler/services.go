@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+// 处理器只依赖各上游服务中实际调用的方法，便于在测试中替换
+
+// anthropicProxy 直接透传 Anthropic Messages 请求
+type anthropicProxy interface {
+	MessagesProxy(ctx context.Context, w http.ResponseWriter, body []byte) error
+	CountTokens(ctx context.Context, body []byte) (*service.CountTokensResult, error)
+}
+
+// anthropicMessenger OpenAI 格式桥接到 Anthropic 时使用
+type anthropicMessenger interface {
+	Messages(ctx context.Context, body []byte, isStream bool) (*http.Response, error)
+}
+
+// openAIProxy OpenAI 兼容接口
+type openAIProxy interface {
+	ListModels() model.ModelListResponse
+	GetModel(id string) (model.ModelInfo, bool)
+	GetModelSyncStatus() model.ModelSyncStatus
+	ChatCompletionsProxy(ctx context.Context, w http.ResponseWriter, body []byte) error
+	ResponsesProxy(ctx context.Context, w http.ResponseWriter, body []byte) error
+	EmbeddingsProxy(ctx context.Context, w http.ResponseWriter, body []byte) error
+	RealtimeProxy(ctx context.Context, w http.ResponseWriter, r *http.Request) error
+}
+
+// grokProxy xAI Chat Completions 透传
+type grokProxy interface {
+	ChatCompletionsProxy(ctx context.Context, w http.ResponseWriter, body []byte) error
+}
+
+// geminiProxy Gemini 原生接口透传
+type geminiProxy interface {
+	GenerateContentProxy(ctx context.Context, w http.ResponseWriter, modelName string, body []byte) error
+	StreamGenerateContentProxy(ctx context.Context, w http.ResponseWriter, modelName string, body []byte) error
+}
+
+// geminiGenerator OpenAI 格式桥接到 Gemini 时使用
+type geminiGenerator interface {
+	GenerateContent(ctx context.Context, modelName string, body []byte) (*http.Response, error)
+	StreamGenerateContent(ctx context.Context, modelName string, body []byte) (*http.Response, error)
+}
@@ -0,0 +1,864 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+type SettingsHandler struct{}
+
+func NewSettingsHandler() *SettingsHandler {
+	return &SettingsHandler{}
+}
+
+// GetTimeouts 获取服务商默认超时及各模型的超时覆盖
+func (h *SettingsHandler) GetTimeouts(c *gin.Context) {
+	modelTimeouts := make(map[string]*model.TimeoutConfig)
+	for _, m := range model.ListZenModels() {
+		if m.Timeouts != nil {
+			modelTimeouts[m.Model] = m.Timeouts
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers": service.GetProviderTimeouts(),
+		"models":    modelTimeouts,
+	})
+}
+
+type UpdateTimeoutsRequest struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	model.TimeoutConfig
+}
+
+// UpdateTimeouts 修改服务商默认超时或单个模型的超时（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateTimeouts(c *gin.Context) {
+	var req UpdateTimeoutsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Provider = strings.TrimSpace(req.Provider)
+	req.Model = strings.TrimSpace(req.Model)
+	if (req.Provider == "") == (req.Model == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of provider or model is required"})
+		return
+	}
+	if req.ConnectSeconds < 0 || req.TTFBSeconds < 0 || req.TotalSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeouts must not be negative"})
+		return
+	}
+
+	var err error
+	if req.Model != "" {
+		err = service.SetModelTimeouts(req.Model, req.TimeoutConfig)
+	} else {
+		err = service.SetProviderTimeouts(req.Provider, req.TimeoutConfig)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetTimeouts(c)
+}
+
+// GetServiceTier 获取 Anthropic service_tier 全局及按 API Key 的规则
+func (h *SettingsHandler) GetServiceTier(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetServiceTierSettings())
+}
+
+type UpdateServiceTierRequest struct {
+	Key string `json:"key"` // 为空时修改全局规则
+	service.ServiceTierRule
+}
+
+// UpdateServiceTier 修改 service_tier 规则（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateServiceTier(c *gin.Context) {
+	var req UpdateServiceTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Default = strings.TrimSpace(req.Default)
+	req.Override = strings.TrimSpace(req.Override)
+	if err := service.SetServiceTierRule(strings.TrimSpace(req.Key), req.ServiceTierRule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetServiceTier(c)
+}
+
+// GetPremiumReserve 获取预留给 PremiumOnly 模型（如 Opus）的 Max 账号数
+func (h *SettingsHandler) GetPremiumReserve(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"reserved": service.GetPremiumReserve()})
+}
+
+type UpdatePremiumReserveRequest struct {
+	Reserved int `json:"reserved"`
+}
+
+// UpdatePremiumReserve 修改预留账号数（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdatePremiumReserve(c *gin.Context) {
+	var req UpdatePremiumReserveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetPremiumReserve(req.Reserved); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetPremiumReserve(c)
+}
+
+// GetAccountConcurrency 获取每个账号同时处理的请求数上限
+func (h *SettingsHandler) GetAccountConcurrency(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"max_concurrent": service.GetAccountConcurrency()})
+}
+
+type UpdateAccountConcurrencyRequest struct {
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+// UpdateAccountConcurrency 修改每个账号的并发上限（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateAccountConcurrency(c *gin.Context) {
+	var req UpdateAccountConcurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetAccountConcurrency(req.MaxConcurrent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetAccountConcurrency(c)
+}
+
+// GetRetryPolicy 获取默认重试策略、服务商覆盖及各服务商实际生效的策略
+func (h *SettingsHandler) GetRetryPolicy(c *gin.Context) {
+	settings := service.GetRetryPolicySettings()
+	c.JSON(http.StatusOK, gin.H{
+		"default":   settings.Default,
+		"providers": settings.Providers,
+		"effective": service.EffectiveRetryPolicies(),
+	})
+}
+
+type UpdateRetryPolicyRequest struct {
+	Provider string `json:"provider"` // 为空时修改默认策略
+	service.RetryPolicy
+}
+
+// UpdateRetryPolicy 修改默认重试策略或服务商覆盖，保存到数据库，重启后仍然生效
+func (h *SettingsHandler) UpdateRetryPolicy(c *gin.Context) {
+	var req UpdateRetryPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetRetryPolicy(req.Provider, req.RetryPolicy); err != nil {
+		var invalid *service.InvalidRequestError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetRetryPolicy(c)
+}
+
+// GetStreamCreditCap 获取流式请求的积分上限和估算参数
+func (h *SettingsHandler) GetStreamCreditCap(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetStreamCreditSettings())
+}
+
+// UpdateStreamCreditCap 修改流式请求的积分上限（仅内存生效，只影响之后开始的流）
+func (h *SettingsHandler) UpdateStreamCreditCap(c *gin.Context) {
+	req := service.GetStreamCreditSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetStreamCreditSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetStreamCreditCap(c)
+}
+
+// GetRequestLimits 获取请求体大小和 Anthropic 输入 token 上限
+func (h *SettingsHandler) GetRequestLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetRequestLimitSettings())
+}
+
+// UpdateRequestLimits 修改请求限制（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateRequestLimits(c *gin.Context) {
+	req := service.GetRequestLimitSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetRequestLimitSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetRequestLimits(c)
+}
+
+// GetStreamFailover 获取流式响应中途失败时的续传设置
+func (h *SettingsHandler) GetStreamFailover(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetStreamFailoverSettings())
+}
+
+// UpdateStreamFailover 修改流式续传设置（仅内存生效，只影响之后开始的流）
+func (h *SettingsHandler) UpdateStreamFailover(c *gin.Context) {
+	req := service.GetStreamFailoverSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetStreamFailoverSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetStreamFailover(c)
+}
+
+// GetStreamBackpressure 获取流式响应的慢客户端处理设置
+func (h *SettingsHandler) GetStreamBackpressure(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetStreamBackpressureSettings())
+}
+
+// UpdateStreamBackpressure 修改慢客户端处理设置（仅内存生效，只影响之后开始的流）
+func (h *SettingsHandler) UpdateStreamBackpressure(c *gin.Context) {
+	req := service.GetStreamBackpressureSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetStreamBackpressureSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetStreamBackpressure(c)
+}
+
+// GetStreamKeepAlive 获取流式响应的 keep-alive 间隔
+func (h *SettingsHandler) GetStreamKeepAlive(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetStreamKeepAliveSettings())
+}
+
+// UpdateStreamKeepAlive 修改 keep-alive 间隔（仅内存生效，只影响之后开始的流）
+func (h *SettingsHandler) UpdateStreamKeepAlive(c *gin.Context) {
+	req := service.GetStreamKeepAliveSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetStreamKeepAliveSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetStreamKeepAlive(c)
+}
+
+// GetStreamPacing 获取流式文本增量的平滑输出规则
+func (h *SettingsHandler) GetStreamPacing(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetStreamPacingSettings())
+}
+
+type UpdateStreamPacingRequest struct {
+	Key   string `json:"key"`   // 非空时修改该 API Key 的规则
+	Model string `json:"model"` // 非空时修改该模型的规则，Key 和模型都为空时修改全局规则
+	service.StreamPacingRule
+}
+
+// UpdateStreamPacing 修改平滑输出规则（仅内存生效，只影响之后开始的流）
+func (h *SettingsHandler) UpdateStreamPacing(c *gin.Context) {
+	var req UpdateStreamPacingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetStreamPacingRule(strings.TrimSpace(req.Key), strings.TrimSpace(req.Model), req.StreamPacingRule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetStreamPacing(c)
+}
+
+// GetModeration 获取内容审核接口地址及全局、按 API Key 的规则
+func (h *SettingsHandler) GetModeration(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetModerationSettings())
+}
+
+type UpdateModerationRequest struct {
+	Key string  `json:"key"` // 为空时修改全局规则
+	URL *string `json:"url"` // 不为 null 时同时修改审核接口地址
+	service.ModerationRule
+}
+
+// UpdateModeration 修改内容审核设置（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateModeration(c *gin.Context) {
+	var req UpdateModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Key = strings.TrimSpace(req.Key)
+	req.Scope = strings.ToLower(strings.TrimSpace(req.Scope))
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	if req.URL != nil {
+		if err := service.SetModerationURL(*req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// 只修改地址时保留全局规则
+	if req.Key != "" || req.Scope != "" || req.Action != "" || req.URL == nil {
+		if err := service.SetModerationRule(req.Key, req.ModerationRule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	h.GetModeration(c)
+}
+
+// GetKeyGuard 获取 API Key 的 IP 绑定、暂停中的 Key 及最近的异常告警
+func (h *SettingsHandler) GetKeyGuard(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetKeyGuardSettings())
+}
+
+type UpdateKeyGuardRequest struct {
+	Key        string    `json:"key"`
+	AllowedIPs *[]string `json:"allowedIps"` // 不为 null 时替换该 Key 的 IP/CIDR 绑定，空数组解除绑定
+	Resume     bool      `json:"resume"`     // 立即解除暂停
+}
+
+// UpdateKeyGuard 修改 API Key 的 IP 绑定或解除暂停（仅内存生效）
+func (h *SettingsHandler) UpdateKeyGuard(c *gin.Context) {
+	var req UpdateKeyGuardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Key = strings.TrimSpace(req.Key)
+	if req.Key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+		return
+	}
+	if req.AllowedIPs != nil {
+		if err := service.SetAPIKeyAllowedIPs(req.Key, *req.AllowedIPs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Resume {
+		service.ResumeAPIKey(req.Key)
+		log.Printf("[KeyGuard] API Key %s 已手动解除暂停", service.MaskAPIKey(req.Key))
+	}
+
+	h.GetKeyGuard(c)
+}
+
+// GetTransport 获取按服务商和模型配置的上游发送方式及各模型实际生效的方式
+func (h *SettingsHandler) GetTransport(c *gin.Context) {
+	resolved := make(map[string]string)
+	ids := model.ListZenModelIDs()
+	for i, m := range model.ListZenModels() {
+		resolved[ids[i]] = service.ResolveTransport(m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"configured": service.GetUpstreamTransports(),
+		"models":     resolved,
+	})
+}
+
+type UpdateTransportRequest struct {
+	Key       string `json:"key"`       // 服务商或上游模型名
+	Transport string `json:"transport"` // http / sdk，为空时删除该配置
+}
+
+// UpdateTransport 修改服务商或模型的上游发送方式（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateTransport(c *gin.Context) {
+	var req UpdateTransportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetUpstreamTransport(req.Key, req.Transport); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[Transport] %s 的上游发送方式已调整为 %q", req.Key, req.Transport)
+
+	h.GetTransport(c)
+}
+
+// GetEndUserLimit 获取终端用户限流配置及请求数最多的终端用户，可用 ?key= 只看某个 API Key
+func (h *SettingsHandler) GetEndUserLimit(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetEndUserLimitSettings(strings.TrimSpace(c.Query("key"))))
+}
+
+type UpdateEndUserLimitRequest struct {
+	Key               string `json:"key"`               // 为空时修改默认限制
+	RequestsPerMinute *int   `json:"requestsPerMinute"` // 0 表示不限制；指定 Key 时负数撤销该 Key 的覆盖
+}
+
+// UpdateEndUserLimit 修改终端用户每分钟请求数限制（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateEndUserLimit(c *gin.Context) {
+	var req UpdateEndUserLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RequestsPerMinute == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "requestsPerMinute is required"})
+		return
+	}
+
+	req.Key = strings.TrimSpace(req.Key)
+	service.SetEndUserRateLimit(req.Key, *req.RequestsPerMinute)
+	if req.Key == "" {
+		log.Printf("[EndUser] 终端用户限流已调整为 %d 次/分钟", *req.RequestsPerMinute)
+	} else {
+		log.Printf("[EndUser] API Key %s 的终端用户限流已调整为 %d 次/分钟", service.MaskAPIKey(req.Key), *req.RequestsPerMinute)
+	}
+
+	c.JSON(http.StatusOK, service.GetEndUserLimitSettings(req.Key))
+}
+
+// GetEmailRedaction 获取日志中邮箱的脱敏方式
+func (h *SettingsHandler) GetEmailRedaction(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"mode": service.GetEmailRedaction()})
+}
+
+type UpdateEmailRedactionRequest struct {
+	Mode string `json:"mode"`
+}
+
+// UpdateEmailRedaction 修改日志中邮箱的脱敏方式（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateEmailRedaction(c *gin.Context) {
+	var req UpdateEmailRedactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetEmailRedaction(req.Mode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetEmailRedaction(c)
+}
+
+// GetRequestValidation 获取请求校验模式
+func (h *SettingsHandler) GetRequestValidation(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"mode": service.GetRequestValidation()})
+}
+
+type UpdateRequestValidationRequest struct {
+	Mode string `json:"mode"`
+}
+
+// UpdateRequestValidation 修改请求校验模式（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateRequestValidation(c *gin.Context) {
+	var req UpdateRequestValidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetRequestValidation(req.Mode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetRequestValidation(c)
+}
+
+// GetFederation 获取联邦对等实例及号池饱和时的转发统计
+func (h *SettingsHandler) GetFederation(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"peers": service.GetFederationStatus()})
+}
+
+// GetResponseHeaders 获取上游响应头的全局及按 API Key 的转发策略
+func (h *SettingsHandler) GetResponseHeaders(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetResponseHeaderSettings())
+}
+
+type UpdateResponseHeadersRequest struct {
+	Key    string `json:"key"` // 为空时修改全局策略
+	Policy string `json:"policy"`
+}
+
+// UpdateResponseHeaders 修改上游响应头的转发策略（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateResponseHeaders(c *gin.Context) {
+	var req UpdateResponseHeadersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Key = strings.TrimSpace(req.Key)
+	if err := service.SetResponseHeaderPolicy(req.Key, req.Policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Key == "" {
+		log.Printf("[ResponseHeaders] 全局响应头策略已调整为 %s", req.Policy)
+	} else {
+		log.Printf("[ResponseHeaders] API Key %s 的响应头策略已调整为 %q", service.MaskAPIKey(req.Key), req.Policy)
+	}
+
+	h.GetResponseHeaders(c)
+}
+
+// GetModelOverride 获取模型生效中的参数覆盖及叠加后的实际参数
+func (h *SettingsHandler) GetModelOverride(c *gin.Context) {
+	modelID := c.Param("id")
+	zenModel, ok := model.GetZenModel(modelID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown model: " + modelID})
+		return
+	}
+
+	var override *model.ParameterOverride
+	if o, active := model.GetParameterOverride(modelID); active {
+		override = &o
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"model":      modelID,
+		"override":   override,
+		"parameters": zenModel.Parameters,
+	})
+}
+
+type UpdateModelOverrideRequest struct {
+	model.ParameterOverride
+	TTLSeconds int `json:"ttlSeconds"` // 与 expiresAt 二选一
+}
+
+// UpdateModelOverride 临时覆盖模型参数（仅内存生效），到期后自动恢复，便于调参时无需改代码重新部署
+func (h *SettingsHandler) UpdateModelOverride(c *gin.Context) {
+	var req UpdateModelOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.TTLSeconds < 0 || (req.TTLSeconds > 0) == !req.ExpiresAt.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of ttlSeconds or expiresAt is required"})
+		return
+	}
+	if req.TTLSeconds > 0 {
+		req.ExpiresAt = time.Now().Add(time.Duration(req.TTLSeconds) * time.Second)
+	}
+	req.ReasoningEffort = strings.ToLower(strings.TrimSpace(req.ReasoningEffort))
+
+	modelID := c.Param("id")
+	if err := model.SetParameterOverride(modelID, req.ParameterOverride); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelOverride] 模型 %s 参数覆盖已设置，%s 到期", modelID, req.ExpiresAt.Format(time.RFC3339))
+
+	h.GetModelOverride(c)
+}
+
+// DeleteModelOverride 立即撤销模型的参数覆盖
+func (h *SettingsHandler) DeleteModelOverride(c *gin.Context) {
+	modelID := c.Param("id")
+	if model.ClearParameterOverride(modelID) {
+		log.Printf("[ModelOverride] 模型 %s 参数覆盖已撤销", modelID)
+	}
+
+	h.GetModelOverride(c)
+}
+
+// ListModelDeprecations 列出带弃用计划的模型，即将下线的在前，便于提前迁移客户端
+func (h *SettingsHandler) ListModelDeprecations(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": service.ListModelDeprecations(time.Now())})
+}
+
+// UpdateModelDeprecation 设置模型的弃用计划（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateModelDeprecation(c *gin.Context) {
+	var req model.ModelDeprecation
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.ReplacementModel = strings.TrimSpace(req.ReplacementModel)
+
+	modelID := c.Param("id")
+	if err := service.SetModelDeprecation(modelID, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelDeprecation] 模型 %s 弃用计划已设置，替代模型 %q", modelID, req.ReplacementModel)
+
+	h.ListModelDeprecations(c)
+}
+
+// DeleteModelDeprecation 撤销模型的弃用计划
+func (h *SettingsHandler) DeleteModelDeprecation(c *gin.Context) {
+	modelID := c.Param("id")
+	if err := service.SetModelDeprecation(modelID, nil); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelDeprecation] 模型 %s 弃用计划已撤销", modelID)
+
+	h.ListModelDeprecations(c)
+}
+
+// ListModelCanaries 列出金丝雀分流及原模型与新模型的错误率、平均耗时对比
+func (h *SettingsHandler) ListModelCanaries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": service.ListModelCanaries()})
+}
+
+// UpdateModelCanary 把模型的一部分流量切给新模型（仅内存生效），可多次调用逐步放量
+func (h *SettingsHandler) UpdateModelCanary(c *gin.Context) {
+	var req service.ModelCanary
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Target = strings.TrimSpace(req.Target)
+
+	modelID := c.Param("id")
+	status, err := service.SetModelCanary(modelID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ModelCanary] 模型 %s 的 %d%% 流量分流到 %s", modelID, req.Percent, req.Target)
+
+	c.JSON(http.StatusOK, status)
+}
+
+// DeleteModelCanary 立即回滚金丝雀分流，全部流量回到原模型，返回回滚前的统计
+func (h *SettingsHandler) DeleteModelCanary(c *gin.Context) {
+	modelID := c.Param("id")
+	status, err := service.SetModelCanary(modelID, nil)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if status == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no canary for model: " + modelID})
+		return
+	}
+	log.Printf("[ModelCanary] 模型 %s 的金丝雀分流已回滚", modelID)
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetThinkingDisable 获取客户端关闭 thinking 而模型强制开启时的处理方式
+func (h *SettingsHandler) GetThinkingDisable(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"policy": service.GetThinkingDisablePolicy()})
+}
+
+type UpdateThinkingDisableRequest struct {
+	Policy string `json:"policy"`
+}
+
+// UpdateThinkingDisable 修改客户端关闭 thinking 时的处理方式（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateThinkingDisable(c *gin.Context) {
+	var req UpdateThinkingDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetThinkingDisablePolicy(req.Policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetThinkingDisable(c)
+}
+
+// GetIdentityProbe 获取账号身份探测配置
+func (h *SettingsHandler) GetIdentityProbe(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetIdentityProbeSettings())
+}
+
+// UpdateIdentityProbe 修改账号身份探测配置（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateIdentityProbe(c *gin.Context) {
+	req := service.GetIdentityProbeSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetIdentityProbeSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetIdentityProbe(c)
+}
+
+// GetProxyHealth 获取代理健康检查配置
+func (h *SettingsHandler) GetProxyHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetProxyHealthSettings())
+}
+
+// UpdateProxyHealth 修改代理健康检查配置（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateProxyHealth(c *gin.Context) {
+	req := service.GetProxyHealthSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetProxyHealthSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetProxyHealth(c)
+}
+
+// GetUsageAnomaly 获取账号用量异常检测配置
+func (h *SettingsHandler) GetUsageAnomaly(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetUsageAnomalySettings())
+}
+
+// UpdateUsageAnomaly 修改账号用量异常检测配置（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateUsageAnomaly(c *gin.Context) {
+	req := service.GetUsageAnomalySettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetUsageAnomalySettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetUsageAnomaly(c)
+}
+
+// GetAnthropicBeta 获取客户端 anthropic-beta 请求头中允许转发的 beta 功能
+func (h *SettingsHandler) GetAnthropicBeta(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetAnthropicBetaSettings())
+}
+
+// UpdateAnthropicBeta 修改允许转发的 beta 功能（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateAnthropicBeta(c *gin.Context) {
+	req := service.GetAnthropicBetaSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetAnthropicBetaSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetAnthropicBeta(c)
+}
+
+// GetModelRouter 获取伪模型的路由规则
+func (h *SettingsHandler) GetModelRouter(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetModelRouterSettings())
+}
+
+// UpdateModelRouter 修改伪模型的路由规则（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateModelRouter(c *gin.Context) {
+	req := service.GetModelRouterSettings()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.SetModelRouterSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.GetModelRouter(c)
+}
+
+// GetThinkingGuard 获取按模型配置的最大思考 token 数
+func (h *SettingsHandler) GetThinkingGuard(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"limits": service.GetThinkingTokenLimits()})
+}
+
+type UpdateThinkingGuardRequest struct {
+	Model string `json:"model"`
+	Limit int    `json:"limit"` // 0 表示删除该模型的限制
+}
+
+// UpdateThinkingGuard 修改模型的最大思考 token 数（仅内存生效，重启后以环境变量为准）
+func (h *SettingsHandler) UpdateThinkingGuard(c *gin.Context) {
+	var req UpdateThinkingGuardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Model = strings.TrimSpace(req.Model)
+	if err := service.SetThinkingTokenLimit(req.Model, req.Limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ThinkingGuard] 模型 %s 的最大思考 token 数已调整为 %d", req.Model, req.Limit)
+
+	h.GetThinkingGuard(c)
+}
+
+// ExportConfig 导出运行时配置（模型表、全局设置、超时、发送方式、弃用计划、参数覆盖、金丝雀、思考长度限制、Ollama 映射，
+// 按 API Key 的规则已脱敏），可保存到 git 中审阅或导入到其他实例
+func (h *SettingsHandler) ExportConfig(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, service.ExportConfig())
+}
+
+// ImportConfig 导入 ExportConfig 导出的文档，只应用与当前配置不同的部分（仅内存生效）
+// ?dry_run=true 时只返回差异，不修改配置
+func (h *SettingsHandler) ImportConfig(c *gin.Context) {
+	var doc service.ConfigDocument
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	changes, err := service.ImportConfig(doc, dryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	failed := 0
+	for _, change := range changes {
+		if change.Error != "" {
+			failed++
+		}
+	}
+	if !dryRun {
+		log.Printf("[Config] 已导入配置：%d 处差异，%d 处失败", len(changes), failed)
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": dryRun, "changes": changes, "failed": failed})
+}
@@ -10,6 +10,7 @@ import (
 	"zencoder2api/internal/database"
 	"zencoder2api/internal/model"
 	"zencoder2api/internal/service"
+	"zencoder2api/internal/service/provider"
 )
 
 type TokenHandler struct{}
@@ -185,7 +186,7 @@ func (h *TokenHandler) TriggerGeneration(c *gin.Context) {
 
 // GetPoolStatus 获取号池状态
 func (h *TokenHandler) GetPoolStatus(c *gin.Context) {
-	db := database.GetDB()
+	db := database.GetReadDB()
 	
 	var stats struct {
 		TotalAccounts   int64 `json:"total_accounts"`
@@ -196,6 +197,7 @@ func (h *TokenHandler) GetPoolStatus(c *gin.Context) {
 		DisabledAccounts int64 `json:"disabled_accounts"`
 		ActiveTokens    int64 `json:"active_tokens"`
 		RunningTasks    int64 `json:"running_tasks"`
+		ProxyCount      int   `json:"proxy_count"`
 	}
 
 	// 统计账号状态
@@ -212,6 +214,9 @@ func (h *TokenHandler) GetPoolStatus(c *gin.Context) {
 	// 统计运行中的任务
 	db.Model(&model.GenerationTask{}).Where("status = ?", "running").Count(&stats.RunningTasks)
 
+	// 代理池大小，用于容量规划
+	stats.ProxyCount = provider.GetProxyPool().Count()
+
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// authenticateManagedKey 用数据库中的 API Key 鉴权：检查启用状态、过期时间、额度和允许的模型，
+// 注入 Key 的系统提示词模板，请求成功后累计用量。Key 不在数据库中时返回 false，由 AuthMiddleware 继续检查 AUTH_TOKEN
+func authenticateManagedKey(c *gin.Context, provided string) bool {
+	key, err := service.LookupAPIKey(provided, time.Now())
+	if key == nil {
+		if err != nil {
+			log.Printf("[WARN] [APIKey] 查询 API Key 失败: %v", err)
+		}
+		return false
+	}
+	// 别名按目标模型检查允许列表和计费
+	modelID := requestModel(c)
+	if target, ok := service.ResolveModelAlias(modelID); ok {
+		modelID = target
+	}
+	if err == nil {
+		err = service.CheckAPIKeyModel(key, modelID)
+	}
+	if err != nil {
+		status, errType := http.StatusForbidden, "permission_error"
+		if denied, ok := err.(*service.APIKeyDeniedError); ok && denied.QuotaExceeded {
+			status, errType = http.StatusTooManyRequests, "insufficient_quota"
+		}
+		service.DebugLog(c.Request.Context(), "[APIKey] 拒绝 Key %s: %v", key.Prefix, err)
+		c.AbortWithStatusJSON(status, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    errType,
+			},
+		})
+		return true
+	}
+
+	setRequestAPIKey(c, provided)
+	optOut := strings.EqualFold(c.GetHeader(service.SystemPromptOptOutHeader), "off")
+	c.Request = c.Request.WithContext(service.WithSystemPromptTemplate(c.Request.Context(), key, optOut))
+	c.Next()
+	if c.Writer.Status() < http.StatusBadRequest {
+		service.ChargeAPIKey(key.ID, modelID, time.Now())
+	}
+	return true
+}
+
+// requestModel 取出请求的模型：Gemini 在路径中，GET 请求（WebSocket 握手）在查询参数 model，其余协议在 JSON 请求体的 model 字段
+func requestModel(c *gin.Context) string {
+	if path := c.Param("path"); path != "" {
+		modelID, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+		return modelID
+	}
+	if c.Request.Method == http.MethodGet {
+		return c.Query("model")
+	}
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Model
+}
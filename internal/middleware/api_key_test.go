@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+func TestAuthRequiresManagedKeyOnceCreated(t *testing.T) {
+	if err := database.Init("sqlite", filepath.Join(t.TempDir(), "keys.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	t.Setenv("AUTH_TOKEN", "")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/messages", AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	send := func(key string) int {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		if key != "" {
+			req.Header.Set("x-api-key", key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// 未设置 AUTH_TOKEN 且没有 Key 时不鉴权
+	if code := send(""); code != http.StatusOK {
+		t.Fatalf("open gateway status = %d", code)
+	}
+
+	_, plain, err := service.CreateAPIKey(model.APIKeyRequest{Name: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := send(""); code != http.StatusUnauthorized {
+		t.Errorf("missing key status = %d, want 401", code)
+	}
+	if code := send("sk-zen-unknown"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key status = %d, want 401", code)
+	}
+	if code := send(plain); code != http.StatusOK {
+		t.Errorf("managed key status = %d, want 200", code)
+	}
+}
@@ -2,8 +2,8 @@ package middleware
 
 import (
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"zencoder2api/internal/service"
@@ -15,6 +15,7 @@ func LoggerMiddleware() gin.HandlerFunc {
 		logger := service.NewRequestLogger()
 		ctx := service.WithLogger(c.Request.Context(), logger)
 		c.Request = c.Request.WithContext(ctx)
+		c.Header(service.TraceIDHeader, logger.TraceID())
 		
 		c.Next()
 		
@@ -23,14 +24,27 @@ func LoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AuthMiddleware 客户端鉴权：接受后台创建的 API Key 或 AUTH_TOKEN
 func AuthMiddleware() gin.HandlerFunc {
-	// 从环境变量获取全局 Token
-	token := os.Getenv("AUTH_TOKEN")
-
 	return func(c *gin.Context) {
-		// 如果没有配置全局 Token，则跳过鉴权
+		markResponseHeaderDebug(c)
+		// 全局 Token 每次读取，外部密钥来源轮换后立即生效
+		token := service.GetSecret("AUTH_TOKEN")
+
+		// 后台创建的 API Key 优先，按 Key 检查额度、模型和过期时间
+		if authenticateManagedKey(c, requestAPIKey(c)) {
+			return
+		}
+
+		// 如果没有配置全局 Token 且没有后台创建的 Key，则跳过鉴权；
+		// 创建过 Key 后必须携带有效的 Key，避免不带 Key 绕过额度和模型限制
 		if token == "" {
-			c.Next()
+			if !service.HasAPIKeys() {
+				setRequestAPIKey(c, requestAPIKey(c))
+				c.Next()
+				return
+			}
+			authenticationFailed(c)
 			return
 		}
 
@@ -39,6 +53,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		if authHeader != "" {
 			parts := strings.SplitN(authHeader, " ", 2)
 			if len(parts) == 2 && parts[0] == "Bearer" && parts[1] == token {
+				setRequestAPIKey(c, token)
 				c.Next()
 				return
 			}
@@ -46,38 +61,83 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// 2. 检查 Anthropic 格式: x-api-key: <token>
 		if c.GetHeader("x-api-key") == token {
+			setRequestAPIKey(c, token)
 			c.Next()
 			return
 		}
 
 		// 3. 检查 Gemini 格式: x-goog-api-key: <token> 或 query param key=<token>
 		if c.GetHeader("x-goog-api-key") == token {
+			setRequestAPIKey(c, token)
 			c.Next()
 			return
 		}
 		if c.Query("key") == token {
+			setRequestAPIKey(c, token)
 			c.Next()
 			return
 		}
 
-		// 鉴权失败
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"error": gin.H{
-				"message": "Invalid authentication token",
-				"type":    "authentication_error",
-			},
-		})
+		authenticationFailed(c)
 	}
 }
 
+// authenticationFailed 鉴权失败，顶层 type 使 Anthropic SDK 也能解析
+func authenticationFailed(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"message": "Invalid authentication token",
+			"type":    "authentication_error",
+		},
+	})
+}
+
+// requestAPIKey 提取客户端提供的 API Key（OpenAI/Anthropic/Gemini 三种格式）
+func requestAPIKey(c *gin.Context) string {
+	if parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2); len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1]
+	}
+	if key := c.GetHeader("x-api-key"); key != "" {
+		return key
+	}
+	if key := c.GetHeader("x-goog-api-key"); key != "" {
+		return key
+	}
+	return c.Query("key")
+}
+
+// setRequestAPIKey 把 API Key 写入请求 context，供按 Key 生效的设置使用
+func setRequestAPIKey(c *gin.Context, key string) {
+	if key == "" {
+		return
+	}
+	c.Request = c.Request.WithContext(service.WithAPIKey(c.Request.Context(), key))
+}
+
+// ResponseHeaderDebugHeader 请求带该头且 X-Admin-Password 正确时原样返回上游响应头，便于管理员排查
+const ResponseHeaderDebugHeader = "X-Debug-Upstream-Headers"
+
+// markResponseHeaderDebug 管理员调试请求不过滤上游响应头，未配置管理密码时不生效
+func markResponseHeaderDebug(c *gin.Context) {
+	if c.GetHeader(ResponseHeaderDebugHeader) == "" {
+		return
+	}
+	if !service.CheckAdminPassword(c.GetHeader("X-Admin-Password")) {
+		return
+	}
+	c.Request = c.Request.WithContext(service.WithResponseHeaderDebug(c.Request.Context()))
+}
+
 // AdminAuthMiddleware 后台管理密码验证中间件
 func AdminAuthMiddleware() gin.HandlerFunc {
-	// 从环境变量获取后台管理密码
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
+	// 管理密码来自 ADMIN_PASSWORD 或初始化向导（见 service.CheckAdminPassword），ADMIN_VIEWER_PASSWORD 为只读管理员密码
+	// 启用 OIDC 登录后即使未配置管理密码也需要鉴权
+	oidcEnabled := service.GetOIDCConfig().Enabled()
 
 	return func(c *gin.Context) {
-		// 如果没有配置管理密码，则跳过鉴权
-		if adminPassword == "" {
+		// 如果没有配置管理密码，则跳过鉴权（初始化向导设置密码后立即生效）
+		if !oidcEnabled && !service.AdminPasswordConfigured() {
 			c.Next()
 			return
 		}
@@ -110,13 +170,28 @@ func AdminAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 验证密码
-		if providedPassword == adminPassword {
+		if service.CheckAdminPassword(providedPassword) {
+			c.Next()
+			return
+		}
+		if viewerPassword := service.GetSecret("ADMIN_VIEWER_PASSWORD"); viewerPassword != "" && providedPassword == viewerPassword {
+			serveViewer(c)
+			return
+		}
+
+		// OIDC 登录签发的会话令牌，按角色处理
+		if session, ok := service.VerifyAdminSession(providedPassword, time.Now()); ok {
+			if session.Role == service.AdminRoleViewer {
+				serveViewer(c)
+				return
+			}
 			c.Next()
 			return
 		}
 
-		// 鉴权失败
+		// 鉴权失败，顶层 type 使 Anthropic SDK 也能解析
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"type": "error",
 			"error": gin.H{
 				"message": "Invalid admin password",
 				"type":    "authentication_error",
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// ModelCanaryHeader 请求被金丝雀分流到新模型时为新模型
+const ModelCanaryHeader = "X-Model-Canary"
+
+// ModelCanaryMiddleware 按金丝雀比例把原模型的请求改写为新模型，请求结束后记录两组的错误率和耗时
+func ModelCanaryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Gemini 的模型在路径中: /v1beta/models/<model>:<action>
+		if path := c.Param("path"); path != "" {
+			modelID, action, ok := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+			if !ok {
+				c.Next()
+				return
+			}
+			d, ok := service.PickModelCanary(modelID)
+			if !ok {
+				c.Next()
+				return
+			}
+			if d.Resolved() != modelID {
+				for i := range c.Params {
+					if c.Params[i].Key == "path" {
+						c.Params[i].Value = "/" + d.Resolved() + ":" + action
+					}
+				}
+			}
+			serveCanary(c, d)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var req map[string]json.RawMessage
+		var modelID string
+		if json.Unmarshal(body, &req) != nil || json.Unmarshal(req["model"], &modelID) != nil || modelID == "" {
+			c.Next()
+			return
+		}
+		d, ok := service.PickModelCanary(modelID)
+		if !ok {
+			c.Next()
+			return
+		}
+		if d.Resolved() != modelID {
+			req["model"], _ = json.Marshal(d.Resolved())
+			if rewritten, err := json.Marshal(req); err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+				c.Request.ContentLength = int64(len(rewritten))
+			}
+		}
+		serveCanary(c, d)
+	}
+}
+
+// serveCanary 处理请求并记录所在分组的结果
+func serveCanary(c *gin.Context, d service.CanaryDecision) {
+	if d.Arm == service.CanaryArmCanary {
+		c.Header(ModelCanaryHeader, d.Target)
+		log.Printf("[ModelCanary] 模型 %s 的请求分流到 %s", d.Model, d.Target)
+	}
+
+	start := time.Now()
+	c.Next()
+	service.RecordModelCanaryResult(d, c.Writer.Status(), time.Since(start))
+}
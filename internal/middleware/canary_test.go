@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestModelCanaryMiddlewareRoutesAndRecords(t *testing.T) {
+	const old, next = "gpt-5.1-codex", "gpt-5.2-codex"
+	if _, err := service.SetModelCanary(old, &service.ModelCanary{Target: next, Percent: 100}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.SetModelCanary(old, nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var seenModel, seenPath string
+	r.POST("/v1/responses", ModelCanaryMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		c.ShouldBindJSON(&req)
+		seenModel = req.Model
+		c.Status(http.StatusBadGateway)
+	})
+	r.POST("/v1beta/models/*path", ModelCanaryMiddleware(), func(c *gin.Context) {
+		seenPath = c.Param("path")
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(`{"model":"`+old+`","input":"hi"}`)))
+	if seenModel != next {
+		t.Errorf("handler saw model %q, want %q", seenModel, next)
+	}
+	if rec.Header().Get(ModelCanaryHeader) != next {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1beta/models/"+old+":generateContent", strings.NewReader(`{}`)))
+	if seenPath != "/"+next+":generateContent" {
+		t.Errorf("gemini path = %q", seenPath)
+	}
+
+	list := service.ListModelCanaries()
+	if len(list) != 1 || list[0].Canary.Requests != 2 || list[0].Canary.Errors != 1 || list[0].Control.Requests != 0 {
+		t.Errorf("canaries = %+v", list)
+	}
+
+	// 回滚后请求原样转发
+	service.SetModelCanary(old, nil)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/responses", strings.NewReader(`{"model":"`+old+`"}`)))
+	if seenModel != old || rec.Header().Get(ModelCanaryHeader) != "" {
+		t.Errorf("after rollback model = %q, headers = %v", seenModel, rec.Header())
+	}
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// CoalescedHeader 共享了相同请求结果的响应带此头
+const CoalescedHeader = "X-Coalesced"
+
+// maxCoalesceBytes 可共享响应的最大大小，超出后不再共享
+const maxCoalesceBytes = 8 << 20
+
+// inflightCall 正在执行的请求，完成后保存响应供等待者复用
+type inflightCall struct {
+	done   chan struct{}
+	ok     bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// recordingWriter 正常写给客户端的同时记录响应，超过 limit 后不再记录
+type recordingWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recordingWriter) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buf = bytes.Buffer{}
+		return
+	}
+	w.buf.Write(data)
+}
+
+// coalescer 按请求指纹合并并发的相同请求
+type coalescer struct {
+	mu       sync.Mutex
+	inflight map[string]*inflightCall
+}
+
+// coalesceKey 计算请求指纹，流式请求返回空字符串表示不合并
+func coalesceKey(c *gin.Context, body []byte) string {
+	if strings.Contains(c.Request.URL.Path, ":streamGenerateContent") {
+		return ""
+	}
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Stream {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(service.GetAPIKey(c.Request.Context())))
+	h.Write([]byte{0})
+	// 跳过系统提示词模板的请求与同 Key 的普通请求结果不同
+	h.Write([]byte(c.GetHeader(service.SystemPromptOptOutHeader)))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (co *coalescer) handle(c *gin.Context) {
+	if c.Request.Body == nil {
+		c.Next()
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	key := coalesceKey(c, body)
+	if err != nil || key == "" {
+		c.Next()
+		return
+	}
+
+	co.mu.Lock()
+	if call, running := co.inflight[key]; running {
+		co.mu.Unlock()
+		if co.wait(c, call) {
+			return
+		}
+		// 原请求未得到可共享的结果，自行处理
+		c.Next()
+		return
+	}
+	call := &inflightCall{done: make(chan struct{})}
+	co.inflight[key] = call
+	co.mu.Unlock()
+
+	rw := &recordingWriter{ResponseWriter: c.Writer, limit: maxCoalesceBytes}
+	c.Writer = rw
+	defer func() {
+		c.Writer = rw.ResponseWriter
+		// 客户端中途断开时结果可能不完整，不共享
+		call.ok = !rw.overflow && c.Request.Context().Err() == nil && rw.Status() < 500
+		if call.ok {
+			call.status = rw.Status()
+			call.header = rw.Header().Clone()
+			call.body = rw.buf.Bytes()
+		}
+		co.mu.Lock()
+		delete(co.inflight, key)
+		co.mu.Unlock()
+		close(call.done)
+	}()
+	c.Next()
+}
+
+// wait 等待相同请求完成并复用其响应，返回 false 表示无法复用
+func (co *coalescer) wait(c *gin.Context, call *inflightCall) bool {
+	service.DebugLog(c.Request.Context(), "[Coalesce] 相同请求正在处理，等待共享结果: %s", c.Request.URL.Path)
+	select {
+	case <-call.done:
+	case <-c.Request.Context().Done():
+		c.Abort()
+		return true
+	}
+	if !call.ok {
+		return false
+	}
+
+	for k, values := range call.header {
+		// 重放的响应带本次请求的 traceid
+		if k == service.TraceIDHeader {
+			continue
+		}
+		for _, v := range values {
+			c.Writer.Header().Add(k, v)
+		}
+	}
+	c.Header(CoalescedHeader, "true")
+	c.Status(call.status)
+	c.Writer.Write(call.body)
+	c.Abort()
+	return true
+}
+
+// CoalesceMiddleware 合并并发的相同非流式请求（REQUEST_COALESCING=true 时启用）
+// 同一 API Key 对同一路径发送完全相同的请求体时，后到的请求等待先到的请求完成并共享其响应，不再重复消耗积分
+func CoalesceMiddleware() gin.HandlerFunc {
+	enabled := strings.ToLower(strings.TrimSpace(os.Getenv("REQUEST_COALESCING")))
+	if enabled != "true" && enabled != "1" {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	log.Printf("[INFO] 已启用相同请求合并")
+
+	co := &coalescer{inflight: make(map[string]*inflightCall)}
+	return co.handle
+}
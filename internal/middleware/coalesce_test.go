@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newCoalesceRouter 处理器在 release 关闭前阻塞，并统计实际执行次数
+func newCoalesceRouter(t *testing.T, calls *int32, release chan struct{}) *gin.Engine {
+	t.Helper()
+	t.Setenv("REQUEST_COALESCING", "true")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/messages", CoalesceMiddleware(), func(c *gin.Context) {
+		n := atomic.AddInt32(calls, 1)
+		<-release
+		c.Header("X-Call", string(rune('0'+n)))
+		c.JSON(http.StatusOK, gin.H{"content": "ok"})
+	})
+	return r
+}
+
+func postConcurrently(r *gin.Engine, body string, n int) []*httptest.ResponseRecorder {
+	recs := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body)))
+		}(recs[i])
+	}
+	wg.Wait()
+	return recs
+}
+
+func TestCoalesceSharesIdenticalRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	r := newCoalesceRouter(t, &calls, release)
+
+	go func() {
+		// 等待所有请求到达后再放行第一个
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	recs := postConcurrently(r, `{"model":"m","messages":[{"role":"user","content":"hi"}]}`, 5)
+
+	if calls != 1 {
+		t.Fatalf("handler calls = %d, want 1", calls)
+	}
+	coalesced := 0
+	for _, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"content":"ok"}` || rec.Header().Get("X-Call") != "1" {
+			t.Errorf("status = %d, body = %s, headers = %v", rec.Code, rec.Body, rec.Header())
+		}
+		if rec.Header().Get(CoalescedHeader) == "true" {
+			coalesced++
+		}
+	}
+	if coalesced != 4 {
+		t.Errorf("coalesced responses = %d, want 4", coalesced)
+	}
+}
+
+func TestCoalesceSkipsStreamRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	close(release)
+	r := newCoalesceRouter(t, &calls, release)
+
+	postConcurrently(r, `{"model":"m","stream":true}`, 3)
+	if calls != 3 {
+		t.Errorf("handler calls = %d, want 3", calls)
+	}
+}
+
+func TestCoalesceDisabledByDefault(t *testing.T) {
+	t.Setenv("REQUEST_COALESCING", "")
+	gin.SetMode(gin.TestMode)
+	var calls int32
+	r := gin.New()
+	r.POST("/v1/messages", CoalesceMiddleware(), func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		c.String(http.StatusOK, "ok")
+	})
+
+	postConcurrently(r, `{"model":"m"}`, 3)
+	if calls != 3 {
+		t.Errorf("handler calls = %d, want 3", calls)
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// 上下文压缩相关请求头
+const (
+	// ContextCompressionRequestHeader header 模式下客户端用 on 开启压缩，任何模式下用 off 跳过压缩
+	ContextCompressionRequestHeader = "X-Context-Compression"
+	// ContextCompressedHeader 压缩生效时写入响应头的被替换消息数
+	ContextCompressedHeader = "X-Context-Compressed"
+)
+
+// ContextCompressionMiddleware 估算输入超过阈值时，用低价模型把较早的对话摘要后再转发，
+// 摘要失败时原样转发请求
+func ContextCompressionMiddleware() gin.HandlerFunc {
+	return contextCompression(service.GetContextCompressionConfig())
+}
+
+func contextCompression(cfg service.ContextCompressionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Mode == service.ContextCompressionOff {
+			c.Next()
+			return
+		}
+		switch strings.ToLower(c.GetHeader(ContextCompressionRequestHeader)) {
+		case "off":
+			c.Next()
+			return
+		case "on":
+		default:
+			if cfg.Mode == service.ContextCompressionHeader {
+				c.Next()
+				return
+			}
+		}
+
+		format := service.ContextFormatOpenAI
+		if strings.HasSuffix(c.Request.URL.Path, "/messages") {
+			format = service.ContextFormatAnthropic
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		if err != nil {
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Next()
+			return
+		}
+
+		result, err := service.CompressContext(c.Request.Context(), format, body, cfg)
+		if err != nil {
+			log.Printf("[WARN] [ContextCompression] 摘要失败，原样转发: %v", err)
+		}
+		if result.Compressed > 0 {
+			c.Header(ContextCompressedHeader, strconv.Itoa(result.Compressed))
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(result.Body))
+		c.Request.ContentLength = int64(len(result.Body))
+		c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/database"
+)
+
+// DatabaseMiddleware 数据库不可用时直接返回 503，避免管理接口返回原始 GORM 错误或因空连接 panic
+// Retry-After 为下一次连接检查的间隔
+func DatabaseMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !database.Healthy() {
+			health := database.GetHealth()
+			c.Header("Retry-After", strconv.Itoa(int(database.HealthCheckInterval().Seconds())))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":    "数据库暂时不可用，请稍后重试",
+				"database": health,
+			})
+			return
+		}
+		c.Next()
+	}
+}
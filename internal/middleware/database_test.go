@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDatabaseMiddlewareRejectsWhenUnavailable(t *testing.T) {
+	// 中间件测试不初始化数据库，等同于连接不可用
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	called := false
+	r.GET("/api/accounts", DatabaseMiddleware(), func(c *gin.Context) {
+		called = true
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/accounts", nil))
+	if rec.Code != http.StatusServiceUnavailable || called {
+		t.Fatalf("status = %d, handler called = %v; want 503 without calling the handler", rec.Code, called)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+}
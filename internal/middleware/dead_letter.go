@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// DeadLetterMiddleware 记录请求的各次上游尝试，重试全部用尽仍失败时保存 dead letter 供后台分析和重放；
+// 需放在 AuthMiddleware 和请求体大小限制之后，保存的是客户端原始请求体
+func DeadLetterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Request = c.Request.WithContext(service.WithDeadLetterCollector(c.Request.Context()))
+		c.Next()
+		service.RecordDeadLetter(c.Request.Context(), c.Request.Method, c.Request.URL.Path, body, c.Writer.Status(), time.Since(start))
+	}
+}
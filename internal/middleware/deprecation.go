@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// 模型弃用相关响应头
+const (
+	// ModelReplacementHeader 弃用模型的替代模型
+	ModelReplacementHeader = "X-Model-Replacement"
+	// ModelRedirectedFromHeader 模型已下线、请求被改用替代模型时为原模型
+	ModelRedirectedFromHeader = "X-Model-Redirected-From"
+)
+
+// ModelDeprecationMiddleware 请求已弃用模型时返回 Deprecation/Sunset/Warning 头，
+// 模型已下线且配置了替代模型时改写请求中的模型
+func ModelDeprecationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Gemini 的模型在路径中: /v1beta/models/<model>:<action>
+		if path := c.Param("path"); path != "" {
+			modelID, action, ok := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+			if ok {
+				if resolved := checkDeprecation(c, modelID); resolved != modelID {
+					for i := range c.Params {
+						if c.Params[i].Key == "path" {
+							c.Params[i].Value = "/" + resolved + ":" + action
+						}
+					}
+				}
+			}
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var req map[string]json.RawMessage
+		var modelID string
+		if json.Unmarshal(body, &req) == nil && json.Unmarshal(req["model"], &modelID) == nil && modelID != "" {
+			if resolved := checkDeprecation(c, modelID); resolved != modelID {
+				req["model"], _ = json.Marshal(resolved)
+				if rewritten, err := json.Marshal(req); err == nil {
+					c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+					c.Request.ContentLength = int64(len(rewritten))
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// checkDeprecation 写入弃用响应头，返回实际应使用的模型
+func checkDeprecation(c *gin.Context, modelID string) string {
+	notice, ok := service.CheckModelDeprecation(modelID, time.Now())
+	if !ok {
+		return modelID
+	}
+	dep := notice.Deprecation
+	c.Header("Deprecation", "@"+strconv.FormatInt(dep.DeprecatedAt.Unix(), 10))
+	warning := fmt.Sprintf("model %s is deprecated", modelID)
+	if !dep.SunsetAt.IsZero() {
+		c.Header("Sunset", dep.SunsetAt.UTC().Format(http.TimeFormat))
+		warning += fmt.Sprintf(" and will be removed on %s", dep.SunsetAt.UTC().Format("2006-01-02"))
+	}
+	if dep.ReplacementModel != "" {
+		c.Header(ModelReplacementHeader, dep.ReplacementModel)
+		warning += fmt.Sprintf("; use %s instead", dep.ReplacementModel)
+	}
+
+	if notice.Redirected() {
+		c.Header(ModelRedirectedFromHeader, modelID)
+		warning = fmt.Sprintf("model %s has been removed; request served by %s", modelID, notice.Resolved)
+		log.Printf("[ModelDeprecation] 模型 %s 已下线，请求改用 %s", modelID, notice.Resolved)
+	}
+	c.Header("Warning", "299 - "+strconv.Quote(warning))
+	return notice.Resolved
+}
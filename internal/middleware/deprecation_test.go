@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service"
+)
+
+func TestModelDeprecationMiddlewareRedirectsAfterSunset(t *testing.T) {
+	const old, next = "claude-sonnet-4-20250514", "claude-sonnet-4-5-20250929"
+	now := time.Now()
+	err := service.SetModelDeprecation(old, &model.ModelDeprecation{
+		DeprecatedAt:     now.Add(-48 * time.Hour),
+		SunsetAt:         now.Add(-time.Hour),
+		ReplacementModel: next,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.SetModelDeprecation(old, nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var seenModel, seenPath string
+	r.POST("/v1/messages", ModelDeprecationMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		c.ShouldBindJSON(&req)
+		seenModel = req.Model
+		c.Status(http.StatusOK)
+	})
+	r.POST("/v1beta/models/*path", ModelDeprecationMiddleware(), func(c *gin.Context) {
+		seenPath = c.Param("path")
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"`+old+`","max_tokens":1}`)))
+	if seenModel != next {
+		t.Errorf("handler saw model %q, want %q", seenModel, next)
+	}
+	if rec.Header().Get(ModelRedirectedFromHeader) != old || rec.Header().Get(ModelReplacementHeader) != next {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	if rec.Header().Get("Sunset") == "" || !strings.HasPrefix(rec.Header().Get("Deprecation"), "@") || !strings.HasPrefix(rec.Header().Get("Warning"), "299 - ") {
+		t.Errorf("missing deprecation headers: %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1beta/models/"+old+":generateContent", strings.NewReader(`{}`)))
+	if seenPath != "/"+next+":generateContent" {
+		t.Errorf("gemini path = %q", seenPath)
+	}
+
+	// 未弃用的模型不受影响
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"`+next+`"}`)))
+	if seenModel != next || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("model %q headers %v", seenModel, rec.Header())
+	}
+}
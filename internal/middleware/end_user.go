@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// EndUserMiddleware 按 metadata.user_id 的加盐哈希统计同一 Key 下各终端用户的请求并按需限流，
+// user_id 原样转发上游；需放在 AuthMiddleware 之后
+func EndUserMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		userID := service.AnthropicEndUserID(body)
+		if userID == "" {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		hash, err := service.CheckEndUserRateLimit(service.GetAPIKey(ctx), userID, time.Now())
+		var limitErr *service.EndUserLimitError
+		if errors.As(err, &limitErr) {
+			service.DebugLog(ctx, "[EndUser] 终端用户 %s 超出限制 %d 次/分钟", hash, limitErr.Limit)
+			c.Header("Retry-After", strconv.Itoa(limitErr.RetryAfter))
+			c.Data(http.StatusTooManyRequests, "application/json", service.AnthropicErrorBody("rate_limit_error", limitErr.Error()))
+			c.Abort()
+			return
+		}
+		service.DebugLog(ctx, "[EndUser] 终端用户 %s", hash)
+		c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestEndUserMiddlewareLimitsAndForwards(t *testing.T) {
+	service.SetEndUserRateLimit("", 1)
+	t.Cleanup(func() { service.SetEndUserRateLimit("", 0) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var forwarded string
+	r.POST("/v1/messages", EndUserMiddleware(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		forwarded = string(body)
+		c.Status(http.StatusOK)
+	})
+
+	const body = `{"model":"claude-sonnet-4-5-20250929","metadata":{"user_id":"end-user-mw"},"messages":[]}`
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || forwarded != body {
+		t.Fatalf("first request: status %d, forwarded %s; want 200 with metadata unchanged", rec.Code, forwarded)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body)))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("second request: status %d, headers %v; want 429 with Retry-After", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), `"rate_limit_error"`) {
+		t.Errorf("body = %s, want an Anthropic rate_limit_error", rec.Body.String())
+	}
+
+	// 不带 user_id 的请求不受影响
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"messages":[]}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("request without user_id: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// FederationMiddleware 配置了对等实例时保存处理器实际收到的请求，号池饱和时由处理器转发给对等实例
+// 放在处理器之前，使转发的请求包含模型重定向、金丝雀分流等改写；已被转发过的请求不再转发
+func FederationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !service.FederationEnabled() || c.GetHeader(service.FederationHopHeader) != "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// Gemini 的模型在路径中，金丝雀分流只改写了路由参数
+		path := ""
+		if p := c.Param("path"); p != "" {
+			path = "/v1beta/models" + p
+		}
+		c.Request = c.Request.WithContext(service.WithFederationRequest(c.Request.Context(), c.Request, path, body))
+		c.Next()
+	}
+}
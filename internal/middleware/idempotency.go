@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// IdempotencyKeyHeader 客户端提供的幂等键
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader 返回已保存的响应时带此头
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength 幂等键的最大长度
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecordKey 幂等键按 API Key 和路径隔离
+func idempotencyRecordKey(c *gin.Context, key string) string {
+	h := sha256.New()
+	h.Write([]byte(service.GetAPIKey(c.Request.Context())))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyRejected 以同时兼容 OpenAI 和 Anthropic 的错误格式拒绝
+func idempotencyRejected(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    code,
+		},
+	})
+}
+
+// IdempotencyMiddleware 带 Idempotency-Key 头的非流式请求成功后保存响应，
+// 过期前相同 Key 的重试直接返回保存的响应（带 Idempotent-Replayed: true），不再消耗积分
+// 相同 Key 的请求仍在执行时返回 409，携带不同请求体时返回 422；流式请求忽略该头
+// 需放在 AuthMiddleware 之后，以便按 API Key 隔离
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if idempotencyKey == "" || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			idempotencyRejected(c, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		if err != nil || json.Unmarshal(body, &req) != nil || req.Stream {
+			c.Next()
+			return
+		}
+
+		key := idempotencyRecordKey(c, idempotencyKey)
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		if !service.BeginIdempotentRequest(key) {
+			idempotencyRejected(c, http.StatusConflict, "idempotency_key_in_use", "A request with this Idempotency-Key is already in progress")
+			return
+		}
+		defer service.EndIdempotentRequest(key)
+
+		record, err := service.LookupIdempotency(key)
+		if err != nil {
+			log.Printf("[WARN] [Idempotency] 查询保存的响应失败: %v", err)
+		}
+		if record != nil {
+			if record.RequestHash != requestHash {
+				idempotencyRejected(c, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used with a different request body")
+				return
+			}
+			var header http.Header
+			json.Unmarshal([]byte(record.Header), &header)
+			for k, values := range header {
+				// 重放的响应带本次请求的 traceid
+				if k == service.TraceIDHeader {
+					continue
+				}
+				for _, v := range values {
+					c.Writer.Header().Add(k, v)
+				}
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Status(record.StatusCode)
+			c.Writer.Write([]byte(record.Body))
+			c.Abort()
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: c.Writer, limit: service.GetIdempotencySettings().MaxBytes}
+		c.Writer = rw
+		c.Next()
+		c.Writer = rw.ResponseWriter
+
+		// 只保存成功的完整响应，失败的请求允许客户端用相同 Key 重试
+		status := rw.Status()
+		if !rw.overflow && c.Request.Context().Err() == nil && status >= 200 && status < 300 {
+			service.SaveIdempotency(key, requestHash, status, rw.Header().Clone(), rw.buf.Bytes())
+		}
+	}
+}
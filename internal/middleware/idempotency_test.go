@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyRejectsConcurrentSameKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r := gin.New()
+	r.POST("/v1/messages", IdempotencyMiddleware(), func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"content": "ok"})
+	})
+
+	body := `{"model":"m","messages":[{"role":"user","content":"hi"}]}`
+	newRequest := func(key string) *http.Request {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		return req
+	}
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(first, newRequest("retry-1"))
+		close(done)
+	}()
+	<-started
+
+	second := httptest.NewRecorder()
+	r.ServeHTTP(second, newRequest("retry-1"))
+	if second.Code != http.StatusConflict || !strings.Contains(second.Body.String(), "idempotency_key_in_use") {
+		t.Errorf("concurrent retry status = %d, body = %s", second.Code, second.Body)
+	}
+
+	tooLong := httptest.NewRecorder()
+	r.ServeHTTP(tooLong, newRequest(strings.Repeat("k", maxIdempotencyKeyLength+1)))
+	if tooLong.Code != http.StatusBadRequest {
+		t.Errorf("long key status = %d", tooLong.Code)
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Errorf("first request status = %d", first.Code)
+	}
+}
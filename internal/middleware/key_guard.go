@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// KeyGuardMiddleware 检查 API Key 的来源 IP 绑定，统计用量并在异常突增时临时暂停 Key
+// 需放在 AuthMiddleware 之后
+func KeyGuardMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := service.GetAPIKey(c.Request.Context())
+		if err := service.CheckAPIKeyAccess(apiKey, c.ClientIP(), time.Now()); err != nil {
+			service.DebugLog(c.Request.Context(), "[KeyGuard] 拒绝请求: %v", err)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "permission_error",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// LatencyBudgetMiddleware 读取 X-Zen-Latency-Budget-Ms，首字节超过预算的一部分时换号重试一次，
+// 仍超出则返回 504 budget_exceeded；值无效时返回 400
+func LatencyBudgetMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(service.LatencyBudgetHeader)
+		if raw == "" {
+			c.Next()
+			return
+		}
+		budget, err := service.ParseLatencyBudget(raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "invalid_request_error",
+					"param":   service.LatencyBudgetHeader,
+				},
+			})
+			return
+		}
+		c.Request = c.Request.WithContext(service.WithLatencyBudget(c.Request.Context(), budget))
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestLatencyBudgetMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/messages", LatencyBudgetMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusOK},
+		{"2000", http.StatusOK},
+		{"abc", http.StatusBadRequest},
+		{"0", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		if tc.header != "" {
+			req.Header.Set(service.LatencyBudgetHeader, tc.header)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s=%q: status %d, want %d", service.LatencyBudgetHeader, tc.header, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// ModelAliasHeader 请求的模型是别名、已改写为目标模型时为原模型名
+const ModelAliasHeader = "X-Model-Alias"
+
+// ModelAliasMiddleware 把请求中的模型别名改写为模型表中的目标模型；需放在其他按模型生效的中间件之前，
+// 之后的服务商解析、弃用、灰度和各服务的模型查找都只看到目标模型
+func ModelAliasMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Gemini 的模型在路径中: /v1beta/models/<model>:<action>
+		if path := c.Param("path"); path != "" {
+			modelID, action, ok := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+			if ok {
+				if target, aliased := service.ResolveModelAlias(modelID); aliased {
+					for i := range c.Params {
+						if c.Params[i].Key == "path" {
+							c.Params[i].Value = "/" + target + ":" + action
+						}
+					}
+					modelAliased(c, modelID, target)
+				}
+			}
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var req map[string]json.RawMessage
+		var modelID string
+		if json.Unmarshal(body, &req) == nil && json.Unmarshal(req["model"], &modelID) == nil && modelID != "" {
+			if target, aliased := service.ResolveModelAlias(modelID); aliased {
+				req["model"], _ = json.Marshal(target)
+				if rewritten, err := json.Marshal(req); err == nil {
+					c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+					c.Request.ContentLength = int64(len(rewritten))
+					modelAliased(c, modelID, target)
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+func modelAliased(c *gin.Context, alias, target string) {
+	c.Header(ModelAliasHeader, alias)
+	service.DebugLog(c.Request.Context(), "[ModelAlias] 模型别名 %s 改写为 %s", alias, target)
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// RoutedModelHeader 请求伪模型时实际使用的模型
+const RoutedModelHeader = "X-Routed-Model"
+
+// ModelRouterMiddleware 请求的模型为伪模型（默认 zen-auto）时，按请求内容改写为小模型或大模型；
+// 需放在模型别名之前，之后的中间件、请求日志和计费都只看到实际模型
+func ModelRouterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// Gemini 的模型在路径中: /v1beta/models/<model>:<action>
+		if path := c.Param("path"); path != "" {
+			modelID, action, ok := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+			if ok && service.IsRouterModel(modelID) {
+				route := service.RouteModel(body)
+				for i := range c.Params {
+					if c.Params[i].Key == "path" {
+						c.Params[i].Value = "/" + route.Model + ":" + action
+					}
+				}
+				modelRouted(c, modelID, route)
+			}
+			c.Next()
+			return
+		}
+
+		var req map[string]json.RawMessage
+		var modelID string
+		if json.Unmarshal(body, &req) == nil && json.Unmarshal(req["model"], &modelID) == nil && service.IsRouterModel(modelID) {
+			route := service.RouteModel(body)
+			req["model"], _ = json.Marshal(route.Model)
+			if rewritten, err := json.Marshal(req); err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+				c.Request.ContentLength = int64(len(rewritten))
+				modelRouted(c, modelID, route)
+			}
+		}
+		c.Next()
+	}
+}
+
+func modelRouted(c *gin.Context, name string, route service.ModelRoute) {
+	c.Header(RoutedModelHeader, route.Model)
+	service.DebugLog(c.Request.Context(), "[ModelRouter] %s 按 %s 路由到 %s", name, route.Reason, route.Model)
+}
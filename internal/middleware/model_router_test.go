@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestModelRouterMiddleware(t *testing.T) {
+	defer service.SetModelRouterSettings(service.GetModelRouterSettings())
+	settings := service.GetModelRouterSettings()
+	settings.Name = "zen-auto"
+	settings.SmallModel = "claude-haiku-4-5-20251001"
+	settings.LargeModel = "claude-sonnet-4-5-20250929"
+	settings.ToolsUseLarge = true
+	if err := service.SetModelRouterSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var seenModel, seenPath string
+	handler := func(c *gin.Context) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		c.ShouldBindJSON(&req)
+		seenModel, seenPath = req.Model, c.Param("path")
+		c.Status(http.StatusOK)
+	}
+	r.POST("/v1/chat/completions", ModelRouterMiddleware(), handler)
+	r.POST("/v1beta/models/*path", ModelRouterMiddleware(), handler)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"zen-auto","tools":[{"type":"function"}],"messages":[{"role":"user","content":"hi"}]}`)))
+	if seenModel != "claude-sonnet-4-5-20250929" || rec.Header().Get(RoutedModelHeader) != seenModel {
+		t.Errorf("handler saw %q, header %q", seenModel, rec.Header().Get(RoutedModelHeader))
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-5-mini","messages":[]}`)))
+	if seenModel != "gpt-5-mini" || rec.Header().Get(RoutedModelHeader) != "" {
+		t.Errorf("real model rewritten: %q", seenModel)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1beta/models/zen-auto:generateContent", strings.NewReader(`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)))
+	if seenPath != "/claude-haiku-4-5-20251001:generateContent" {
+		t.Errorf("gemini path = %q", seenPath)
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// ModerationHeader 命中审核时写入响应头的类别（annotate 动作）
+const ModerationHeader = "X-Moderation-Categories"
+
+// moderationWriter 缓冲整个响应，审核通过后再写出
+type moderationWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *moderationWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *moderationWriter) WriteHeaderNow() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *moderationWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	return w.buf.Write(data)
+}
+
+func (w *moderationWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 审核完成前不向客户端刷新
+func (w *moderationWriter) Flush() {}
+
+func (w *moderationWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *moderationWriter) Size() int {
+	if w.status == 0 {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *moderationWriter) Written() bool {
+	return w.status != 0
+}
+
+// finish 写出缓冲的响应
+func (w *moderationWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+	header := w.ResponseWriter.Header()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+// moderate 审核文本，返回 false 表示已按 block 动作拒绝
+// 审核接口异常时放行，避免审核服务故障导致网关不可用
+func moderate(c *gin.Context, rule service.ModerationRule, scope, text string) bool {
+	if strings.TrimSpace(text) == "" {
+		return true
+	}
+	result, err := service.Moderate(c.Request.Context(), text)
+	if err != nil {
+		log.Printf("[WARN] [Moderation] 审核接口调用失败，已放行 (%s %s): %v", scope, c.Request.URL.Path, err)
+		return true
+	}
+	if !result.Flagged {
+		return true
+	}
+
+	categories := strings.Join(result.Categories, ",")
+	log.Printf("[Moderation] 内容命中审核 (%s %s) 类别=%s 动作=%s", scope, c.Request.URL.Path, categories, rule.Action)
+	service.DebugLog(c.Request.Context(), "[Moderation] %s 命中: %s", scope, categories)
+
+	switch rule.Action {
+	case service.ModerationActionBlock:
+		return false
+	case service.ModerationActionAnnotate:
+		c.Header(ModerationHeader, categories)
+	}
+	return true
+}
+
+// moderationBlocked 以同时兼容 OpenAI 和 Anthropic 的错误格式拒绝
+func moderationBlocked(c *gin.Context, scope string) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusBadRequest, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"message": "content blocked by moderation policy (" + scope + ")",
+			"type":    "invalid_request_error",
+			"code":    "content_policy_violation",
+		},
+	})
+}
+
+// ModerationMiddleware 按请求所用 API Key 的规则调用外部审核接口
+// 审核输入时在转发前检查请求中的提示词；审核输出时缓冲完整响应（流式响应会在结束后一次性返回）
+// 需放在 AuthMiddleware 之后，以便按 API Key 选择规则
+func ModerationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := service.ModerationRuleFor(c.Request.Context())
+		if !rule.Enabled() {
+			c.Next()
+			return
+		}
+
+		if rule.Checks(service.ModerationScopeInput) && c.Request.Body != nil {
+			body, err := io.ReadAll(c.Request.Body)
+			c.Request.Body.Close()
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			if err == nil && !moderate(c, rule, service.ModerationScopeInput, service.ExtractModerationText(body)) {
+				moderationBlocked(c, service.ModerationScopeInput)
+				c.Abort()
+				return
+			}
+		}
+
+		if !rule.Checks(service.ModerationScopeOutput) {
+			c.Next()
+			return
+		}
+
+		mw := &moderationWriter{ResponseWriter: c.Writer}
+		c.Writer = mw
+		c.Next()
+		c.Writer = mw.ResponseWriter
+
+		if mw.Status() < 400 && !moderate(c, rule, service.ModerationScopeOutput, service.ExtractModerationText(mw.buf.Bytes())) {
+			c.Writer.Header().Del("Content-Length")
+			moderationBlocked(c, service.ModerationScopeOutput)
+			return
+		}
+		mw.finish()
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// setupModeration 启动把包含 "bad" 的文本判定为违规的审核服务，并设置全局规则
+func setupModeration(t *testing.T, rule service.ModerationRule) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		flagged := strings.Contains(req.Input, "bad")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{"flagged": flagged, "categories": map[string]bool{"harassment": flagged}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	if err := service.SetModerationURL(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetModerationRule("", rule); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		service.SetModerationURL("")
+		service.SetModerationRule("", service.ModerationRule{})
+	})
+}
+
+// serveModeration 处理器原样回显请求中的 reply 字段
+func serveModeration(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", ModerationMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Reply string `json:"reply"`
+		}
+		c.ShouldBindJSON(&req)
+		c.JSON(http.StatusOK, gin.H{"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": req.Reply}}}})
+	})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+	return rec
+}
+
+func TestModerationBlocksInput(t *testing.T) {
+	setupModeration(t, service.ModerationRule{Action: service.ModerationActionBlock})
+
+	rec := serveModeration(t, `{"messages":[{"role":"user","content":"say something bad"}],"reply":"ok"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "content_policy_violation") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec = serveModeration(t, `{"messages":[{"role":"user","content":"hello"}],"reply":"ok"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("clean input status = %d", rec.Code)
+	}
+}
+
+func TestModerationAnnotatesOutput(t *testing.T) {
+	setupModeration(t, service.ModerationRule{Scope: service.ModerationScopeOutput, Action: service.ModerationActionAnnotate})
+
+	rec := serveModeration(t, `{"messages":[{"role":"user","content":"bad prompt is not checked"}],"reply":"a bad answer"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "a bad answer") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(ModerationHeader); got != "harassment" {
+		t.Errorf("%s = %q, want harassment", ModerationHeader, got)
+	}
+}
+
+func TestModerationBlocksOutput(t *testing.T) {
+	setupModeration(t, service.ModerationRule{Scope: service.ModerationScopeOutput, Action: service.ModerationActionBlock})
+
+	rec := serveModeration(t, `{"messages":[{"role":"user","content":"hi"}],"reply":"a bad answer"}`)
+	if rec.Code != http.StatusBadRequest || strings.Contains(rec.Body.String(), "a bad answer") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestModerationFailsOpen(t *testing.T) {
+	setupModeration(t, service.ModerationRule{Action: service.ModerationActionBlock})
+	service.SetModerationURL("http://127.0.0.1:1")
+
+	rec := serveModeration(t, `{"messages":[{"role":"user","content":"bad"}],"reply":"ok"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 when moderation is unreachable", rec.Code)
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// PoolReservationMiddleware 按 API Key 的预留占用号池容量，请求结束后释放；
+// Key 的预留用完且共享容量已满时直接返回 429，不进入号池调度。需放在 AuthMiddleware 之后
+func PoolReservationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		release, err := service.AcquirePoolSlot(service.GetAPIKey(ctx))
+		var capacityErr *service.PoolCapacityError
+		if errors.As(err, &capacityErr) {
+			service.DebugLog(ctx, "[Reservation] 拒绝请求: %v", err)
+			c.Header("Retry-After", "1")
+			c.Data(http.StatusTooManyRequests, "application/json", service.AnthropicErrorBody("rate_limit_error", capacityErr.Error()))
+			c.Abort()
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// ProviderHintMiddleware 按 X-Model-Provider 头或 model#provider 后缀把模型改写为模型表中对应服务商的键，
+// 服务商未知或不提供该模型时返回 400；需放在其他按模型生效的中间件之前
+func ProviderHintMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hint := c.GetHeader(service.ProviderHintHeader)
+
+		// Gemini 的模型在路径中: /v1beta/models/<model>:<action>
+		if path := c.Param("path"); path != "" {
+			modelID, action, ok := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+			if !ok {
+				c.Next()
+				return
+			}
+			resolved, err := service.ResolveModelProvider(modelID, hint)
+			if err != nil {
+				providerHintRejected(c, err)
+				return
+			}
+			if resolved != modelID {
+				for i := range c.Params {
+					if c.Params[i].Key == "path" {
+						c.Params[i].Value = "/" + resolved + ":" + action
+					}
+				}
+			}
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var req map[string]json.RawMessage
+		var modelID string
+		if json.Unmarshal(body, &req) != nil || json.Unmarshal(req["model"], &modelID) != nil || modelID == "" {
+			c.Next()
+			return
+		}
+		resolved, err := service.ResolveModelProvider(modelID, hint)
+		if err != nil {
+			providerHintRejected(c, err)
+			return
+		}
+		if resolved != modelID {
+			req["model"], _ = json.Marshal(resolved)
+			if rewritten, err := json.Marshal(req); err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+				c.Request.ContentLength = int64(len(rewritten))
+			}
+			service.DebugLog(c.Request.Context(), "[ProviderHint] 模型 %s 解析为 %s", modelID, resolved)
+		}
+		c.Next()
+	}
+}
+
+// providerHintRejected 以同时兼容 OpenAI 和 Anthropic 的错误格式拒绝
+func providerHintRejected(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    "invalid_request_error",
+			"param":   "model",
+		},
+	})
+}
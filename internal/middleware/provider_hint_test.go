@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestProviderHintMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var seenModel string
+	r.POST("/v1/chat/completions", ProviderHintMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		c.ShouldBindJSON(&req)
+		seenModel = req.Model
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-5.1-codex#openai"}`)))
+	if rec.Code != http.StatusOK || seenModel != "gpt-5.1-codex" {
+		t.Errorf("status = %d, handler saw model %q", rec.Code, seenModel)
+	}
+
+	seenModel = ""
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-5.1-codex"}`))
+	req.Header.Set(service.ProviderHintHeader, "anthropic")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || seenModel != "" {
+		t.Errorf("mismatched provider: status = %d, handler saw %q", rec.Code, seenModel)
+	}
+	if !strings.Contains(rec.Body.String(), "not offered by provider anthropic") {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+}
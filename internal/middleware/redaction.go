@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// redactedResponseWriter 缓冲管理接口的响应，请求结束后脱敏其中的邮箱再写出
+type redactedResponseWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *redactedResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *redactedResponseWriter) WriteHeaderNow() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *redactedResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	return w.buf.Write(data)
+}
+
+func (w *redactedResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 等待请求结束统一写出
+func (w *redactedResponseWriter) Flush() {}
+
+func (w *redactedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *redactedResponseWriter) Size() int {
+	if w.status == 0 {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *redactedResponseWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *redactedResponseWriter) finish(mode string) {
+	if w.status == 0 {
+		return
+	}
+	body := service.RedactEmails(w.buf.String(), mode)
+	w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteString(body)
+}
+
+// serveViewer 只读管理员只能查看，响应中的邮箱始终脱敏（日志未开启脱敏时使用 mask）
+func serveViewer(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"message": "Read-only admin cannot modify settings",
+				"type":    "permission_error",
+			},
+		})
+		return
+	}
+
+	mode := service.GetEmailRedaction()
+	if mode == service.EmailRedactionOff {
+		mode = service.EmailRedactionMask
+	}
+	w := &redactedResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	c.Writer = w.ResponseWriter
+	w.finish(mode)
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestAdminViewerReadOnlyAndRedacted(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "owner")
+	t.Setenv("ADMIN_VIEWER_PASSWORD", "viewer")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", AdminAuthMiddleware())
+	api.GET("/accounts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"email": "john.doe@gmail.com"})
+	})
+	modified := false
+	api.POST("/accounts", func(c *gin.Context) {
+		modified = true
+		c.Status(http.StatusOK)
+	})
+
+	get := func(password string) string {
+		req := httptest.NewRequest("GET", "/api/accounts", nil)
+		req.Header.Set("X-Admin-Password", password)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if body := get("owner"); !strings.Contains(body, "john.doe@gmail.com") {
+		t.Errorf("owner body = %s, want full email", body)
+	}
+	if body := get("viewer"); !strings.Contains(body, "j***@gmail.com") || strings.Contains(body, "john.doe") {
+		t.Errorf("viewer body = %s, want masked email", body)
+	}
+
+	req := httptest.NewRequest("POST", "/api/accounts", nil)
+	req.Header.Set("Authorization", "Bearer viewer")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || modified {
+		t.Errorf("viewer POST = %d (modified=%v), want 403", rec.Code, modified)
+	}
+}
+
+func TestAdminViewerSettingsHideAPIKeys(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "owner")
+	t.Setenv("ADMIN_VIEWER_PASSWORD", "viewer")
+
+	const key = "sk-viewer-secret-key-42"
+	if err := service.SetServiceTierRule(key, service.ServiceTierRule{Default: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+	defer service.SetServiceTierRule(key, service.ServiceTierRule{})
+	if err := service.SetModerationRule(key, service.ModerationRule{Scope: service.ModerationScopeInput, Action: service.ModerationActionFlag}); err != nil {
+		t.Fatal(err)
+	}
+	defer service.SetModerationRule(key, service.ModerationRule{})
+	if err := service.SetResponseHeaderPolicy(key, service.ResponseHeadersAll); err != nil {
+		t.Fatal(err)
+	}
+	defer service.SetResponseHeaderPolicy(key, "")
+	if err := service.SetAPIKeyAllowedIPs(key, []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer service.SetAPIKeyAllowedIPs(key, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", AdminAuthMiddleware())
+	api.GET("/settings/service-tier", func(c *gin.Context) { c.JSON(http.StatusOK, service.GetServiceTierSettings()) })
+	api.GET("/settings/moderation", func(c *gin.Context) { c.JSON(http.StatusOK, service.GetModerationSettings()) })
+	api.GET("/settings/response-headers", func(c *gin.Context) { c.JSON(http.StatusOK, service.GetResponseHeaderSettings()) })
+	api.GET("/settings/key-guard", func(c *gin.Context) { c.JSON(http.StatusOK, service.GetKeyGuardSettings()) })
+
+	for _, path := range []string{"/api/settings/service-tier", "/api/settings/moderation", "/api/settings/response-headers", "/api/settings/key-guard"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Admin-Password", "viewer")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || strings.Contains(body, key) || !strings.Contains(body, service.MaskAPIKey(key)) {
+			t.Errorf("GET %s = %d %s, want masked API key", path, rec.Code, body)
+		}
+	}
+}
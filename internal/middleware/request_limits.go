@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// BodyLimitMiddleware 请求体超过 MAX_REQUEST_BODY_BYTES 时直接返回 413，不读取剩余内容也不占用账号；
+// 需放在其他读取请求体的中间件之前
+func BodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := int64(service.GetRequestLimitSettings().MaxBodyBytes)
+		if limit <= 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			bodyTooLarge(c, limit)
+			return
+		}
+		// 没有 Content-Length（分块传输）时最多读取 limit+1 字节判断
+		body, _ := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		c.Request.Body.Close()
+		if int64(len(body)) > limit {
+			bodyTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+func bodyTooLarge(c *gin.Context, limit int64) {
+	service.DebugLog(c.Request.Context(), "[RequestLimit] 请求体超过 %d 字节，已拒绝", limit)
+	c.Header("Connection", "close")
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"message": fmt.Sprintf("request body exceeds the %d byte limit", limit),
+			"type":    "request_too_large",
+		},
+	})
+}
+
+// PromptLimitMiddleware 发往 Anthropic 模型的请求在本地估算输入 token 数，超过 ANTHROPIC_PROMPT_TOKEN_LIMIT 时返回 400，
+// 避免占用账号后才收到上游的 prompt is too long；需放在上下文压缩之后
+func PromptLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if service.GetRequestLimitSettings().PromptTokenLimit <= 0 {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var tooLong *service.PromptTooLongError
+		if err := service.CheckPromptLength(body); errors.As(err, &tooLong) {
+			service.DebugLog(c.Request.Context(), "[RequestLimit] 模型 %s 估算输入 %d tokens 超过上限 %d，已拒绝", tooLong.Model, tooLong.Tokens, tooLong.Limit)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"message": tooLong.Error(),
+					"type":    "invalid_request_error",
+					"code":    "prompt_too_long",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	service.SetRequestLimitSettings(service.RequestLimitSettings{MaxBodyBytes: 16})
+	t.Cleanup(func() { service.SetRequestLimitSettings(service.RequestLimitSettings{}) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var forwarded string
+	r.POST("/v1/messages", BodyLimitMiddleware(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		forwarded = string(body)
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"x"}`)))
+	if rec.Code != http.StatusOK || forwarded != `{"model":"x"}` {
+		t.Fatalf("small body: status %d, forwarded %q", rec.Code, forwarded)
+	}
+
+	// 带 Content-Length 和分块传输的超大请求都被拒绝
+	for _, chunked := range []bool{false, true} {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(strings.Repeat("x", 17)))
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), `"request_too_large"`) {
+			t.Errorf("chunked=%v: status %d, body %s; want 413 request_too_large", chunked, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestPromptLimitMiddleware(t *testing.T) {
+	service.SetRequestLimitSettings(service.RequestLimitSettings{PromptTokenLimit: 10})
+	t.Cleanup(func() { service.SetRequestLimitSettings(service.RequestLimitSettings{}) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/messages", PromptLimitMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	long := `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"` + strings.Repeat("x", 100) + `"}]}`
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(long)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "prompt is too long") {
+		t.Fatalf("long prompt: status %d, body %s; want 400 prompt is too long", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"hi"}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("short prompt: status %d", rec.Code)
+	}
+}
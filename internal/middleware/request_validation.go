@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// RequestValidationMiddleware 严格模式下按 kind 对应的接口 schema 校验请求体，
+// 字段类型错误或参数名未知时直接返回 400 并指出出错的参数，不占用账号；宽松模式下原样放行
+func RequestValidationMiddleware(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if service.GetRequestValidation() != service.RequestValidationStrict || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		var invalid *service.InvalidRequestError
+		if err := service.ValidateRequest(kind, body); errors.As(err, &invalid) {
+			// 同时兼容 OpenAI 和 Anthropic 的错误格式
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"message": invalid.Message,
+					"type":    "invalid_request_error",
+					"param":   invalid.Param,
+					"code":    "invalid_request",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+func TestRequestValidationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var reached int
+	r.POST("/v1/messages", RequestValidationMiddleware(service.RequestSchemaAnthropicMessages), func(c *gin.Context) {
+		var req map[string]interface{}
+		if c.ShouldBindJSON(&req) == nil {
+			reached++
+		}
+		c.Status(http.StatusOK)
+	})
+	send := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body)))
+		return rec
+	}
+	const bad = `{"model":"m","max_tokens":1,"messages":[],"stream":"yes"}`
+
+	// 宽松模式（默认）原样转发
+	if rec := send(bad); rec.Code != http.StatusOK || reached != 1 {
+		t.Fatalf("lenient: code = %d, reached = %d", rec.Code, reached)
+	}
+
+	if err := service.SetRequestValidation(service.RequestValidationStrict); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.SetRequestValidation(service.RequestValidationLenient) })
+
+	rec := send(bad)
+	var resp struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+			Param   string `json:"param"`
+		} `json:"error"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusBadRequest || reached != 1 {
+		t.Fatalf("strict: code = %d, reached = %d", rec.Code, reached)
+	}
+	if resp.Type != "error" || resp.Error.Type != "invalid_request_error" || resp.Error.Param != "stream" || resp.Error.Message != "stream: expected boolean, got string" {
+		t.Errorf("error body = %s", rec.Body.String())
+	}
+
+	// 校验通过的请求体仍可被后续处理读取
+	if rec := send(`{"model":"m","max_tokens":1,"messages":[{"role":"user","content":"hi"}]}`); rec.Code != http.StatusOK || reached != 2 {
+		t.Errorf("valid request: code = %d, reached = %d", rec.Code, reached)
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// ResponseCacheHeader 缓存命中时为 HIT，写入缓存时为 MISS，客户端跳过缓存时为 BYPASS
+const ResponseCacheHeader = "X-Cache"
+
+// responseCacheKeyHeaders 会影响响应内容的请求头，与请求体一起计入缓存键
+var responseCacheKeyHeaders = []string{service.SystemPromptOptOutHeader, service.ProviderHintHeader, "anthropic-beta"}
+
+// responseCacheKey 按 API Key、路径、相关请求头和规范化后的请求体（模型、消息和参数）计算缓存键，
+// 字段顺序和空白不同的相同请求得到相同的键；流式请求返回空字符串表示不缓存
+func responseCacheKey(c *gin.Context, body []byte) string {
+	if strings.Contains(c.Request.URL.Path, ":streamGenerateContent") {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var req map[string]interface{}
+	if decoder.Decode(&req) != nil {
+		return ""
+	}
+	if stream, _ := req["stream"].(bool); stream {
+		return ""
+	}
+	canonical, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(service.GetAPIKey(c.Request.Context())))
+	h.Write([]byte{0})
+	for _, name := range responseCacheKeyHeaders {
+		h.Write([]byte(c.GetHeader(name)))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseCacheDirectives 解析客户端的 Cache-Control：no-cache 跳过查找但写入新结果，no-store 完全绕过缓存
+func responseCacheDirectives(c *gin.Context) (lookup, store bool) {
+	lookup, store = true, true
+	for _, directive := range strings.Split(strings.ToLower(c.GetHeader("Cache-Control")), ",") {
+		switch strings.TrimSpace(directive) {
+		case "no-cache":
+			lookup = false
+		case "no-store":
+			lookup, store = false, false
+		}
+	}
+	return lookup, store
+}
+
+// ResponseCacheMiddleware 缓存非流式请求的成功响应（RESPONSE_CACHE_TTL 大于 0 时启用）
+// 有效期内同一 API Key 发送的相同请求直接返回缓存的响应（带 X-Cache: HIT 和 Age 头），不再消耗积分；
+// 缓存保存在进程内存中，重启后清空，多实例之间不共享
+func ResponseCacheMiddleware() gin.HandlerFunc {
+	settings := service.GetResponseCacheSettings()
+	if settings.TTLSeconds <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	log.Printf("[INFO] 已启用响应缓存: 有效期 %ds，最多 %d 条", settings.TTLSeconds, settings.MaxEntries)
+
+	return func(c *gin.Context) {
+		if c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		key := responseCacheKey(c, body)
+		if err != nil || key == "" {
+			c.Next()
+			return
+		}
+
+		lookup, store := responseCacheDirectives(c)
+		if !store {
+			c.Header(ResponseCacheHeader, "BYPASS")
+			c.Next()
+			return
+		}
+		if lookup {
+			if cached := service.LookupResponseCache(key); cached != nil {
+				service.DebugLog(c.Request.Context(), "[ResponseCache] 命中缓存: %s", c.Request.URL.Path)
+				for k, values := range cached.Header {
+					// 命中的响应带本次请求的 traceid
+					if k == service.TraceIDHeader {
+						continue
+					}
+					for _, v := range values {
+						c.Writer.Header().Add(k, v)
+					}
+				}
+				c.Header(ResponseCacheHeader, "HIT")
+				c.Header("Age", strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+				c.Status(cached.Status)
+				c.Writer.Write(cached.Body)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Header(ResponseCacheHeader, "MISS")
+		rw := &recordingWriter{ResponseWriter: c.Writer, limit: settings.MaxBytes}
+		c.Writer = rw
+		c.Next()
+		c.Writer = rw.ResponseWriter
+
+		// 只缓存完整的成功响应
+		if !rw.overflow && c.Request.Context().Err() == nil && rw.Status() == http.StatusOK {
+			header := rw.Header().Clone()
+			header.Del(ResponseCacheHeader)
+			service.SaveResponseCache(key, rw.Status(), header, rw.buf.Bytes())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newResponseCacheRouter(t *testing.T, calls *int32) *gin.Engine {
+	t.Helper()
+	t.Setenv("RESPONSE_CACHE_TTL", "60")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", ResponseCacheMiddleware(), func(c *gin.Context) {
+		atomic.AddInt32(calls, 1)
+		if strings.Contains(c.GetHeader("X-Fail"), "1") {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"content": "ok"})
+	})
+	return r
+}
+
+func postCached(r *gin.Engine, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCacheServesIdenticalRequests(t *testing.T) {
+	var calls int32
+	r := newResponseCacheRouter(t, &calls)
+
+	first := postCached(r, `{"model":"cache-a","messages":[{"role":"user","content":"hi"}],"temperature":0}`, nil)
+	// 字段顺序和空白不同的相同请求命中缓存
+	second := postCached(r, `{ "temperature":0, "messages":[{"content":"hi","role":"user"}], "model":"cache-a" }`, nil)
+	if calls != 1 {
+		t.Fatalf("handler calls = %d, want 1", calls)
+	}
+	if first.Header().Get(ResponseCacheHeader) != "MISS" || second.Header().Get(ResponseCacheHeader) != "HIT" {
+		t.Errorf("X-Cache = %q, %q", first.Header().Get(ResponseCacheHeader), second.Header().Get(ResponseCacheHeader))
+	}
+	if second.Code != http.StatusOK || second.Body.String() != `{"content":"ok"}` || second.Header().Get("Age") == "" {
+		t.Errorf("cached response = %d %s %v", second.Code, second.Body, second.Header())
+	}
+
+	// 参数不同时不命中
+	postCached(r, `{"model":"cache-a","messages":[{"role":"user","content":"hi"}],"temperature":1}`, nil)
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want 2", calls)
+	}
+}
+
+func TestResponseCacheSkips(t *testing.T) {
+	var calls int32
+	r := newResponseCacheRouter(t, &calls)
+
+	for i := 0; i < 2; i++ {
+		postCached(r, `{"model":"cache-b","stream":true}`, nil)
+	}
+	if calls != 2 {
+		t.Errorf("stream requests cached: calls = %d", calls)
+	}
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		postCached(r, `{"model":"cache-c"}`, map[string]string{"X-Fail": "1"})
+	}
+	if calls != 2 {
+		t.Errorf("error responses cached: calls = %d", calls)
+	}
+
+	calls = 0
+	postCached(r, `{"model":"cache-d"}`, map[string]string{"Cache-Control": "no-store"})
+	rec := postCached(r, `{"model":"cache-d"}`, map[string]string{"Cache-Control": "no-cache"})
+	if calls != 2 || rec.Header().Get(ResponseCacheHeader) != "MISS" {
+		t.Errorf("Cache-Control ignored: calls = %d, X-Cache = %q", calls, rec.Header().Get(ResponseCacheHeader))
+	}
+	// no-cache 的请求刷新了缓存
+	if rec = postCached(r, `{"model":"cache-d"}`, nil); calls != 2 || rec.Header().Get(ResponseCacheHeader) != "HIT" {
+		t.Errorf("no-cache response not stored: calls = %d", calls)
+	}
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// defaultStreamFallbackMaxBytes 降级缓冲的默认上限
+const defaultStreamFallbackMaxBytes = 8 << 20
+
+// bufferedResponseWriter 缓冲整个响应，Flush 不再立即下发数据
+// 用于 HTTP/1.0 等无法处理 chunked/SSE 的客户端
+// 缓冲超过 limit 后改为直接透传，避免长响应占满内存
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	buf         bytes.Buffer
+	status      int
+	limit       int
+	fallback    string
+	passthrough bool
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	if !w.passthrough && w.buf.Len()+len(data) > w.limit {
+		w.spill()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 缓冲模式下不向客户端刷新，等待请求结束统一写出
+func (w *bufferedResponseWriter) Flush() {
+	if w.passthrough {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	if w.status == 0 {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.status != 0
+}
+
+// spill 缓冲超限，写出已缓冲内容并切换为透传（HTTP/1.0 以关闭连接结束响应）
+func (w *bufferedResponseWriter) spill() {
+	log.Printf("[WARN] 降级缓冲超过 %d 字节，改为直接透传", w.limit)
+	w.passthrough = true
+	w.ResponseWriter.Header().Set(service.StreamFallbackHeader, "passthrough")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf = bytes.Buffer{}
+}
+
+// finish 把缓冲内容以带 Content-Length 的普通响应写出
+func (w *bufferedResponseWriter) finish() {
+	if w.status == 0 || w.passthrough {
+		return
+	}
+	header := w.ResponseWriter.Header()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	header.Set(service.StreamFallbackHeader, w.fallback)
+	header.Add("Warning", `199 - "streaming downgraded to buffered response"`)
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+// needsStreamFallback 判断客户端是否无法正常接收流式响应
+// HTTP/1.0 不支持 chunked 编码，SSE 经过老旧代理时容易被截断
+func needsStreamFallback(c *gin.Context) bool {
+	return !c.Request.ProtoAtLeast(1, 1)
+}
+
+// downgradeToNonStream 把流式请求改写为非流式，使处理器直接返回完整 JSON
+// 请求体超过 limit 时不读取全部内容，原样交给处理器
+// 返回 false 表示请求无法改写，只能缓冲原始流
+func downgradeToNonStream(c *gin.Context, limit int) bool {
+	// Gemini 通过路径动作区分流式
+	if path := c.Param("path"); strings.HasSuffix(path, ":streamGenerateContent") {
+		for i := range c.Params {
+			if c.Params[i].Key == "path" {
+				c.Params[i].Value = strings.TrimSuffix(path, ":streamGenerateContent") + ":generateContent"
+			}
+		}
+		query := c.Request.URL.Query()
+		query.Del("alt")
+		c.Request.URL.RawQuery = query.Encode()
+		return true
+	}
+
+	if c.Request.Body == nil {
+		return false
+	}
+	original := c.Request.Body
+	body, err := io.ReadAll(io.LimitReader(original, int64(limit)+1))
+	if err != nil || len(body) > limit {
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), original), original}
+		return false
+	}
+	original.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+	var stream bool
+	if raw, ok := payload["stream"]; !ok || json.Unmarshal(raw, &stream) != nil || !stream {
+		return false
+	}
+	payload["stream"] = json.RawMessage("false")
+	// OpenAI 在非流式请求中不接受 stream_options
+	delete(payload, "stream_options")
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(rewritten))
+	c.Request.ContentLength = int64(len(rewritten))
+	c.Request.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	return true
+}
+
+// StreamFallbackMiddleware 为不支持流式的客户端降级响应
+// STREAM_FALLBACK=buffer(默认) 时把流式请求改写为非流式并整体返回，=off 时保持原样
+// STREAM_FALLBACK_MAX_BYTES 限制缓冲大小，超出后直接透传；超过该大小的请求体不改写
+func StreamFallbackMiddleware() gin.HandlerFunc {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("STREAM_FALLBACK")))
+	if mode == "" {
+		mode = "buffer"
+	}
+	limit := defaultStreamFallbackMaxBytes
+	if v, err := strconv.Atoi(os.Getenv("STREAM_FALLBACK_MAX_BYTES")); err == nil && v > 0 {
+		limit = v
+	}
+
+	return func(c *gin.Context) {
+		if mode == "off" || !needsStreamFallback(c) {
+			c.Next()
+			return
+		}
+
+		fallback := "buffered"
+		if downgradeToNonStream(c, limit) {
+			fallback = "non-stream"
+		}
+		log.Printf("[WARN] 客户端不支持流式传输 (%s %s)，响应降级为 %s", c.Request.Proto, c.Request.URL.Path, fallback)
+
+		bw := &bufferedResponseWriter{ResponseWriter: c.Writer, limit: limit, fallback: fallback}
+		c.Writer = bw
+		c.Next()
+		c.Writer = bw.ResponseWriter
+		bw.finish()
+	}
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zencoder2api/internal/service"
+)
+
+// newStreamTestServer 启动挂载降级中间件的测试服务器
+// 处理器在 stream=true 时输出 SSE，否则返回 JSON，并回显收到的 stream 值
+func newStreamTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(StreamFallbackMiddleware())
+
+	r.POST("/v1/messages", func(c *gin.Context) {
+		var req struct {
+			Stream        bool            `json:"stream"`
+			StreamOptions json.RawMessage `json:"stream_options"`
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		json.Unmarshal(body, &req)
+
+		if !req.Stream {
+			c.JSON(http.StatusOK, gin.H{"stream": false, "stream_options": len(req.StreamOptions) > 0})
+			return
+		}
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(c.Writer, "data: chunk-%d\n\n", i)
+			c.Writer.Flush()
+		}
+	})
+	r.POST("/raw", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		for i := 0; i < 4; i++ {
+			fmt.Fprintf(c.Writer, "data: %s\n\n", strings.Repeat("x", 16))
+			c.Writer.Flush()
+		}
+	})
+	r.POST("/v1beta/models/*path", func(c *gin.Context) {
+		c.String(http.StatusOK, "%s?%s", c.Param("path"), c.Request.URL.RawQuery)
+	})
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// sendRaw 通过原始 TCP 连接以指定协议版本发送请求
+func sendRaw(t *testing.T, srv *httptest.Server, proto, path, body string) (*http.Response, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "POST %s %s\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		path, proto, len(body), body)
+
+	req, _ := http.NewRequest("POST", path, nil)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return resp, string(data)
+}
+
+func TestStreamFallbackHTTP10ConvertsToNonStream(t *testing.T) {
+	srv := newStreamTestServer(t)
+
+	resp, body := sendRaw(t, srv, "HTTP/1.0", "/v1/messages", `{"model":"m","stream":true,"stream_options":{"include_usage":true}}`)
+
+	if got := resp.Header.Get(service.StreamFallbackHeader); got != "non-stream" {
+		t.Errorf("fallback header = %q, want non-stream", got)
+	}
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("Content-Length = %d, body length %d", resp.ContentLength, len(body))
+	}
+	if ct := resp.Header.Get("Content-Type"); strings.Contains(ct, "event-stream") {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+	if body != `{"stream":false,"stream_options":false}` {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestStreamFallbackHTTP10BuffersUnconvertibleStream(t *testing.T) {
+	srv := newStreamTestServer(t)
+
+	resp, body := sendRaw(t, srv, "HTTP/1.0", "/raw", `{}`)
+
+	if got := resp.Header.Get(service.StreamFallbackHeader); got != "buffered" {
+		t.Errorf("fallback header = %q, want buffered", got)
+	}
+	if resp.ContentLength != int64(len(body)) || len(body) == 0 {
+		t.Errorf("Content-Length = %d, body length %d", resp.ContentLength, len(body))
+	}
+}
+
+func TestStreamFallbackHTTP10PassesThroughOverLimit(t *testing.T) {
+	t.Setenv("STREAM_FALLBACK_MAX_BYTES", "32")
+	srv := newStreamTestServer(t)
+
+	resp, body := sendRaw(t, srv, "HTTP/1.0", "/raw", `{}`)
+
+	if got := resp.Header.Get(service.StreamFallbackHeader); got != "passthrough" {
+		t.Errorf("fallback header = %q, want passthrough", got)
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("Content-Length = %d, want unset", resp.ContentLength)
+	}
+	if want := 4 * len("data: "+strings.Repeat("x", 16)+"\n\n"); len(body) != want {
+		t.Errorf("body length = %d, want %d", len(body), want)
+	}
+}
+
+func TestStreamFallbackHTTP10SkipsRewriteOverLimit(t *testing.T) {
+	t.Setenv("STREAM_FALLBACK_MAX_BYTES", "64")
+	srv := newStreamTestServer(t)
+
+	// 请求体超过上限时不读入内存改写，处理器仍收到完整的原始请求体
+	payload := fmt.Sprintf(`{"model":"m","stream":true,"padding":%q}`, strings.Repeat("x", 128))
+	resp, body := sendRaw(t, srv, "HTTP/1.0", "/v1/messages", payload)
+
+	if got := resp.Header.Get(service.StreamFallbackHeader); got != "buffered" {
+		t.Errorf("fallback header = %q, want buffered", got)
+	}
+	if !strings.Contains(body, "data: chunk-2") {
+		t.Errorf("body = %s, want original stream request", body)
+	}
+}
+
+func TestStreamFallbackHTTP10RewritesGeminiStreamAction(t *testing.T) {
+	srv := newStreamTestServer(t)
+
+	_, body := sendRaw(t, srv, "HTTP/1.0", "/v1beta/models/gemini-3-flash-preview:streamGenerateContent?alt=sse", `{}`)
+
+	if body != "/gemini-3-flash-preview:generateContent?" {
+		t.Errorf("handler saw %q", body)
+	}
+}
+
+func TestStreamFallbackHTTP11Untouched(t *testing.T) {
+	srv := newStreamTestServer(t)
+
+	resp, body := sendRaw(t, srv, "HTTP/1.1", "/v1/messages", `{"stream":true}`)
+
+	if got := resp.Header.Get(service.StreamFallbackHeader); got != "" {
+		t.Errorf("fallback header = %q, want empty", got)
+	}
+	if !strings.Contains(body, "data: chunk-2") {
+		t.Errorf("expected SSE body, got %q", body)
+	}
+}
+
+func TestStreamFallbackOff(t *testing.T) {
+	t.Setenv("STREAM_FALLBACK", "off")
+	srv := newStreamTestServer(t)
+
+	resp, body := sendRaw(t, srv, "HTTP/1.0", "/v1/messages", `{"stream":true}`)
+
+	if got := resp.Header.Get(service.StreamFallbackHeader); got != "" {
+		t.Errorf("fallback header = %q, want empty", got)
+	}
+	if !strings.Contains(body, "data: chunk-0") {
+		t.Errorf("expected SSE body, got %q", body)
+	}
+}
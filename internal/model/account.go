@@ -23,6 +23,9 @@ var PlanLimits = map[PlanType]int{
 	PlanMax:      4200,
 }
 
+// MaxAccountErrors 连续错误达到该次数后账号被停用并标记为 error
+const MaxAccountErrors = 3
+
 type Account struct {
 	ID            uint      `json:"id" gorm:"primaryKey"`
 	ClientID      string    `json:"client_id" gorm:"uniqueIndex;not null"`
@@ -32,8 +35,10 @@ type Account struct {
 	Status        string    `json:"status" gorm:"default:'normal';index"`   // normal, cooling, banned, error, disabled
 	PlanType      PlanType  `json:"plan_type" gorm:"default:'Free'"`
 	Proxy         string    `json:"proxy"`
+	ProxyRegion   string    `json:"proxy_region" gorm:"index"` // 固定的代理地区，代理池重试只使用该地区的代理
 	AccessToken   string    `json:"-" gorm:"type:text"`
 	RefreshToken  string    `json:"-" gorm:"type:text"` // 用于刷新 AccessToken
+	PreviousRefreshToken string `json:"-" gorm:"type:text"` // 轮换前的 refresh_token，新 token 验证通过后清空
 	TokenExpiry   time.Time `json:"token_expiry"`       // 传出token过期时间
 	CreditRefreshTime time.Time `json:"credit_refresh_time"` // 积分刷新时间（来自Zen-Pricing-Period-End）
 	IsActive      bool      `json:"is_active" gorm:"default:true"`
@@ -49,6 +54,17 @@ type Account struct {
 	ErrorCount            int       `json:"error_count" gorm:"default:0"`
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
+	ProxyHealth           *ProxyHealth `json:"proxy_health,omitempty" gorm:"-"` // 账号代理的健康检查结果（不存储在数据库）
+}
+
+// ProxyHealth 代理健康检查结果
+type ProxyHealth struct {
+	Healthy   bool      `json:"healthy"`
+	Failures  int       `json:"failures"` // 连续失败次数
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+	Failover  string    `json:"failover,omitempty"` // 代理失效期间账号请求改走的出口：pool 或 direct，为空表示仍使用原代理
 }
 
 type AccountRequest struct {
@@ -59,7 +75,16 @@ type AccountRequest struct {
 	Email        string   `json:"email"`
 	PlanType     PlanType `json:"plan_type"`
 	Proxy        string   `json:"proxy"`
+	ProxyRegion  string   `json:"proxy_region"` // 账号注册地所在的代理地区
 	// Batch generation fields
 	GenerateMode bool `json:"generate_mode"` // true for batch generation mode
 	GenerateCount int `json:"generate_count"` // number of credentials to generate
 }
+
+// AccountUpdateRequest 修改账号的请求体，只修改出现的字段；传空字符串清空代理和代理地区
+type AccountUpdateRequest struct {
+	Email       *string   `json:"email"`
+	PlanType    *PlanType `json:"plan_type"`
+	Proxy       *string   `json:"proxy"`
+	ProxyRegion *string   `json:"proxy_region"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// 后台批量任务类型
+const (
+	AdminJobRefreshToken = "refresh_token" // 刷新账号 Token
+	AdminJobDelete       = "delete"        // 删除账号
+	AdminJobMove         = "move"          // 移动账号到其他分类
+)
+
+// 后台批量任务状态
+const (
+	AdminJobQueued    = "queued"
+	AdminJobRunning   = "running"
+	AdminJobCompleted = "completed"
+	AdminJobCancelled = "cancelled"
+)
+
+// AdminJob 管理面板的批量账号操作，账号较多时转为后台执行
+// 按创建时的账号快照逐个处理，Processed 即已处理到的位置，重启后从该位置继续
+type AdminJob struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:64"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status" gorm:"index"`
+	FromStatus string     `json:"from_status,omitempty"` // 只处理仍在该分类中的账号
+	ToStatus   string     `json:"to_status,omitempty"`   // move 的目标分类
+	AccountIDs string     `json:"-" gorm:"type:text"`    // 账号 ID 快照（JSON 数组）
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Errors     string     `json:"-" gorm:"type:text"` // 最近的失败记录（JSON 数组）
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// APIKey 分发给各团队的 API Key，明文只在创建时返回一次，库中只保存 SHA-256 哈希
+type APIKey struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	Name               string     `json:"name"`
+	KeyHash            string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	Prefix             string     `json:"prefix"` // 明文开头几位，便于在后台辨认
+	Enabled            bool       `json:"enabled"`
+	CreditQuota        float64    `json:"credit_quota"`                          // 积分额度，0 表示不限制
+	CreditsUsed        float64    `json:"credits_used"`                          // 已使用积分，按模型倍率累计
+	AllowedModels      string     `json:"allowed_models" gorm:"type:text"`       // 逗号分隔，为空表示不限制
+	SystemPromptPrefix string     `json:"system_prompt_prefix" gorm:"type:text"` // 注入到 Anthropic 请求 system 之前的模板，支持 {date}、{key_name}
+	SystemPromptSuffix string     `json:"system_prompt_suffix" gorm:"type:text"` // 注入到 system 之后的模板
+	SystemPromptOptOut bool       `json:"system_prompt_opt_out"`                 // 允许请求用 X-System-Prompt: off 跳过模板，仅用于受信任的内部 Key
+	ReservedSlots      int        `json:"reserved_slots" gorm:"default:0"`       // 预留的号池并发数，通过 PUT /api/keys/:id/reservation 修改
+	ExpiresAt          *time.Time `json:"expires_at"`
+	LastUsedAt         *time.Time `json:"last_used_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// APIKeyRequest 创建或修改 API Key 的请求，修改时整体替换这些字段
+type APIKeyRequest struct {
+	Name               string     `json:"name"`
+	Enabled            *bool      `json:"enabled"` // 省略时为启用
+	CreditQuota        float64    `json:"credit_quota"`
+	AllowedModels      []string   `json:"allowed_models"`
+	SystemPromptPrefix string     `json:"system_prompt_prefix"`
+	SystemPromptSuffix string     `json:"system_prompt_suffix"`
+	SystemPromptOptOut bool       `json:"system_prompt_opt_out"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	ResetUsage         bool       `json:"reset_usage"` // 修改时清零已使用积分
+}
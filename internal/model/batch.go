@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// 批处理任务状态
+const (
+	BatchStatusQueued    = "queued"    // 等待空闲时段执行
+	BatchStatusRunning   = "running"   // 已开始执行部分请求
+	BatchStatusCompleted = "completed" // 所有请求均已结束
+	BatchStatusExpired   = "expired"   // 截止时间前未能执行完
+	BatchStatusCancelled = "cancelled"
+)
+
+// 批处理中单个请求的状态
+const (
+	BatchRequestPending   = "pending"
+	BatchRequestCompleted = "completed" // 上游返回 2xx
+	BatchRequestFailed    = "failed"
+	BatchRequestExpired   = "expired"
+	BatchRequestCancelled = "cancelled"
+)
+
+// BatchJob 离峰批处理任务（/v1/batch-lite）
+type BatchJob struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:64"`
+	APIKey     string     `json:"-" gorm:"type:text"` // 提交时使用的 API Key，执行时沿用
+	ClientIP   string     `json:"-"`                  // 提交时的来源 IP，执行时沿用以满足 IP 绑定
+	Status     string     `json:"status" gorm:"index"`
+	Deadline   time.Time  `json:"deadline" gorm:"index"`
+	Total      int        `json:"total"`
+	Completed  int        `json:"completed"`
+	Failed     int        `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// BatchRequest 批处理任务中的单个 chat 请求及其结果
+type BatchRequest struct {
+	ID          uint       `json:"-" gorm:"primaryKey"`
+	BatchID     string     `json:"-" gorm:"index;size:64"`
+	CustomID    string     `json:"custom_id"`
+	Body        string     `json:"-" gorm:"type:text"`
+	Status      string     `json:"status" gorm:"index"`
+	StatusCode  int        `json:"status_code,omitempty"`
+	Response    string     `json:"-" gorm:"type:text"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
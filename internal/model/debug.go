@@ -22,6 +22,15 @@ func DebugLogModelMapping(requestModel string, zenModel ZenModel, found bool) {
 			if zenModel.Parameters.ForceStreaming != nil && *zenModel.Parameters.ForceStreaming {
 				log.Printf("[DEBUG] [ModelMapping]   └─ forceStreaming: true")
 			}
+			for k, v := range zenModel.Parameters.ExtraBody {
+				log.Printf("[DEBUG] [ModelMapping]   └─ extraBody: %s=%v", k, v)
+			}
+			if zenModel.Parameters.AggregateSSEToJSON {
+				log.Printf("[DEBUG] [ModelMapping]   └─ aggregateSSEToJSON: true")
+			}
+			if zenModel.Parameters.TypedInput {
+				log.Printf("[DEBUG] [ModelMapping]   └─ typedInput: true")
+			}
 		}
 	} else {
 		log.Printf("[DEBUG] [ModelMapping] ✗ 未找到模型映射: request=%s, 使用默认配置", requestModel)
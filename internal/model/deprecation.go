@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// maxReplacementHops 替代模型链的最大跳数，防止配置成环
+const maxReplacementHops = 5
+
+// ModelDeprecation 模型弃用计划：弃用后请求仍可用但返回警告头，下线后自动改用替代模型
+type ModelDeprecation struct {
+	DeprecatedAt     time.Time `json:"deprecatedAt"`
+	SunsetAt         time.Time `json:"sunsetAt,omitempty"`
+	ReplacementModel string    `json:"replacementModel,omitempty"`
+}
+
+// IsDeprecated 是否已到弃用时间
+func (d *ModelDeprecation) IsDeprecated(now time.Time) bool {
+	return d != nil && !now.Before(d.DeprecatedAt)
+}
+
+// IsSunset 是否已到下线时间
+func (d *ModelDeprecation) IsSunset(now time.Time) bool {
+	return d != nil && !d.SunsetAt.IsZero() && !now.Before(d.SunsetAt)
+}
+
+// ResolveSunsetModel 沿替代模型链找到第一个未下线的模型，模型未下线或没有可用替代时原样返回
+func ResolveSunsetModel(modelID string, now time.Time) string {
+	models := zenModelsSnap.Load().models
+	resolved := modelID
+	for i := 0; i < maxReplacementHops; i++ {
+		m, ok := models[resolved]
+		if !ok || !m.Deprecation.IsSunset(now) {
+			break
+		}
+		next := m.Deprecation.ReplacementModel
+		if _, ok := models[next]; !ok || next == modelID {
+			break
+		}
+		resolved = next
+	}
+	return resolved
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotencyRecord 带 Idempotency-Key 的非流式请求的响应，过期前相同 Key 的重试直接返回该响应
+type IdempotencyRecord struct {
+	ID          string `gorm:"primaryKey;size:64"` // API Key、路径和 Idempotency-Key 的哈希
+	RequestHash string `gorm:"size:64"`            // 请求体哈希，相同 Key 携带不同请求体时拒绝
+	StatusCode  int
+	Header      string    `gorm:"type:text"` // JSON 编码的响应头
+	Body        string    `gorm:"type:text"`
+	ExpiresAt   time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
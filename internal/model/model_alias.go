@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// ModelAlias 模型别名：请求中的 Alias 在查找模型之前被改写为模型表中的 Target
+type ModelAlias struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Alias     string    `json:"alias" gorm:"uniqueIndex;size:128;not null"`
+	Target    string    `json:"target" gorm:"size:128;not null"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ModelAliasRequest 创建或修改模型别名的请求，修改时整体替换这些字段
+type ModelAliasRequest struct {
+	Alias   string `json:"alias"`
+	Target  string `json:"target"`
+	Enabled *bool  `json:"enabled"` // 省略时为启用
+}
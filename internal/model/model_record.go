@@ -0,0 +1,85 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ModelRecord 数据库中的模型注册表记录，表中有记录时代替编译进程序的默认模型表
+type ModelRecord struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;size:128;not null"` // 客户端请求时使用的模型名，即模型表的键
+	ZenID       string    `json:"id" gorm:"size:128;not null"`               // 发往上游的 zen-model-id
+	DisplayName string    `json:"displayName"`
+	Model       string    `json:"model" gorm:"size:128;not null"`
+	Multiplier  float64   `json:"multiplier"`
+	ProviderID  string    `json:"providerId" gorm:"size:32;not null"`
+	Type        string    `json:"type,omitempty" gorm:"size:32"`
+	Parameters  string    `json:"parameters" gorm:"type:text"` // ModelParameters 的 JSON
+	Timeouts    string    `json:"timeouts" gorm:"type:text"`   // TimeoutConfig 的 JSON
+	IsHidden    bool      `json:"isHidden"`
+	PremiumOnly bool      `json:"premiumOnly"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ModelRegistryEntry 模型注册表接口的请求和响应格式：模型名加上模型配置
+type ModelRegistryEntry struct {
+	Name string `json:"name"`
+	ZenModel
+}
+
+// NewModelRecord 把模型配置转换为注册表记录，弃用计划不保存（由弃用接口单独管理）
+func NewModelRecord(name string, m ZenModel) (ModelRecord, error) {
+	record := ModelRecord{
+		Name:        name,
+		ZenID:       m.ID,
+		DisplayName: m.DisplayName,
+		Model:       m.Model,
+		Multiplier:  m.Multiplier,
+		ProviderID:  m.ProviderID,
+		Type:        m.Type,
+		IsHidden:    m.IsHidden,
+		PremiumOnly: m.PremiumOnly,
+	}
+	if m.Parameters != nil {
+		data, err := json.Marshal(m.Parameters)
+		if err != nil {
+			return record, err
+		}
+		record.Parameters = string(data)
+	}
+	if m.Timeouts != nil {
+		data, err := json.Marshal(m.Timeouts)
+		if err != nil {
+			return record, err
+		}
+		record.Timeouts = string(data)
+	}
+	return record, nil
+}
+
+// ZenModel 把注册表记录还原为模型配置
+func (r ModelRecord) ZenModel() (ZenModel, error) {
+	m := ZenModel{
+		ID:          r.ZenID,
+		DisplayName: r.DisplayName,
+		Model:       r.Model,
+		Multiplier:  r.Multiplier,
+		ProviderID:  r.ProviderID,
+		Type:        r.Type,
+		IsHidden:    r.IsHidden,
+		PremiumOnly: r.PremiumOnly,
+	}
+	if r.Parameters != "" {
+		if err := json.Unmarshal([]byte(r.Parameters), &m.Parameters); err != nil {
+			return m, err
+		}
+	}
+	if r.Timeouts != "" {
+		if err := json.Unmarshal([]byte(r.Timeouts), &m.Timeouts); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,55 @@
+package model
+
+import "testing"
+
+func TestModelRecordRoundTrip(t *testing.T) {
+	const name = "claude-opus-4-5-20251101-thinking"
+	want := defaultZenModels[name]
+	record, err := NewModelRecord(name, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := record.ZenModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || got.Multiplier != want.Multiplier || got.ProviderID != want.ProviderID ||
+		got.Parameters.Thinking.BudgetTokens != want.Parameters.Thinking.BudgetTokens ||
+		got.Parameters.ExtraHeaders["anthropic-beta"] != want.Parameters.ExtraHeaders["anthropic-beta"] ||
+		got.Timeouts.TotalSeconds != want.Timeouts.TotalSeconds {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegistryModelsReplaceDefaults(t *testing.T) {
+	defer func() {
+		SetRegistryModels(nil)
+		ResetZenModelsToDefault()
+	}()
+
+	SetRegistryModels(map[string]ZenModel{
+		"custom-model": {ID: "custom", Model: "custom-model", Multiplier: 2, ProviderID: "openai"},
+	})
+	if !UsingRegistryModels() || len(DefaultZenModels()) != 1 {
+		t.Fatalf("DefaultZenModels() = %d models, want only the registry", len(DefaultZenModels()))
+	}
+	ResetZenModelsToDefault()
+	if _, ok := GetZenModel("custom-model"); !ok {
+		t.Error("reset should fall back to the registry")
+	}
+	if _, ok := GetZenModel("claude-sonnet-4-5-20250929"); ok {
+		t.Error("compiled defaults should not be used while the registry is set")
+	}
+	if len(BuiltinZenModels()) != len(defaultZenModels) {
+		t.Error("BuiltinZenModels should ignore the registry")
+	}
+
+	SetRegistryModels(map[string]ZenModel{})
+	ResetZenModelsToDefault()
+	if UsingRegistryModels() {
+		t.Error("empty registry should fall back to the compiled defaults")
+	}
+	if _, ok := GetZenModel("claude-sonnet-4-5-20250929"); !ok {
+		t.Error("compiled defaults should be restored")
+	}
+}
@@ -13,8 +13,22 @@ type ChatCompletionRequest struct {
 }
 
 type ChatMessage struct {
-	Role    string `json:"role,omitempty"`
-	Content string `json:"content"`
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// ToolCall 助手消息中的函数调用，流式增量中 Index 标识属于哪个调用，后续增量只带 arguments 片段
+type ToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 type ChatCompletionResponse struct {
@@ -58,10 +72,20 @@ type ModelListResponse struct {
 }
 
 type ModelInfo struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	OwnedBy string `json:"owned_by"`
+	ID       string         `json:"id"`
+	Object   string         `json:"object"`
+	Created  int64          `json:"created"`
+	OwnedBy  string         `json:"owned_by"`
+	Metadata *ModelMetadata `json:"metadata,omitempty"`
+}
+
+// ModelMetadata 模型列表中附带的网关信息，供客户端展示倍率和服务商
+type ModelMetadata struct {
+	DisplayName string  `json:"display_name"`
+	Provider    string  `json:"provider"`
+	Multiplier  float64 `json:"multiplier"`
+	PremiumOnly bool    `json:"premium_only,omitempty"`
+	Type        string  `json:"type,omitempty"` // embedding 模型为 embedding，对话模型省略
 }
 
 type ModelSyncStatus struct {
@@ -0,0 +1,184 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ParameterOverride 运行时临时覆盖的模型参数，到期后自动失效，回到模型表中的配置
+type ParameterOverride struct {
+	Temperature     *float64          `json:"temperature,omitempty"`
+	ThinkingBudget  *int              `json:"thinkingBudget,omitempty"`  // 为 0 时关闭平台强制的 thinking
+	ReasoningEffort string            `json:"reasoningEffort,omitempty"` // minimal/low/medium/high
+	ExtraHeaders    map[string]string `json:"extraHeaders,omitempty"`    // 值为空时删除该请求头
+	ExpiresAt       time.Time         `json:"expiresAt"`
+}
+
+var reasoningEfforts = map[string]bool{"minimal": true, "low": true, "medium": true, "high": true}
+
+// minThinkingBudget Anthropic 要求的最小 thinking budget_tokens
+const minThinkingBudget = 1024
+
+var (
+	parameterOverridesMu sync.Mutex
+	// parameterOverrides 与模型表一样按写时复制发布，读路径只做一次原子加载
+	parameterOverrides atomic.Pointer[map[string]ParameterOverride]
+)
+
+func init() {
+	empty := make(map[string]ParameterOverride)
+	parameterOverrides.Store(&empty)
+}
+
+func (o ParameterOverride) validate() error {
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if o.ThinkingBudget != nil && *o.ThinkingBudget != 0 && *o.ThinkingBudget < minThinkingBudget {
+		return fmt.Errorf("thinkingBudget must be 0 or at least %d", minThinkingBudget)
+	}
+	if o.ReasoningEffort != "" && !reasoningEfforts[o.ReasoningEffort] {
+		return fmt.Errorf("reasoningEffort must be one of minimal/low/medium/high")
+	}
+	if o.Temperature == nil && o.ThinkingBudget == nil && o.ReasoningEffort == "" && len(o.ExtraHeaders) == 0 {
+		return fmt.Errorf("at least one parameter is required")
+	}
+	return nil
+}
+
+// apply 把覆盖叠加到模型参数副本上
+func (o ParameterOverride) apply(m ZenModel) ZenModel {
+	m = m.Clone()
+	params := m.Parameters
+	if params == nil {
+		params = &ModelParameters{}
+	}
+
+	if o.Temperature != nil {
+		v := *o.Temperature
+		params.Temperature = &v
+	}
+	if o.ThinkingBudget != nil {
+		switch {
+		case *o.ThinkingBudget == 0:
+			params.Thinking = nil
+		case params.Thinking != nil:
+			params.Thinking.BudgetTokens = *o.ThinkingBudget
+		default:
+			params.Thinking = &ThinkingConfig{Type: "enabled", BudgetTokens: *o.ThinkingBudget}
+		}
+	}
+	if o.ReasoningEffort != "" {
+		if params.Reasoning == nil {
+			params.Reasoning = &ReasoningConfig{}
+		}
+		params.Reasoning.Effort = o.ReasoningEffort
+	}
+	if len(o.ExtraHeaders) > 0 {
+		if params.ExtraHeaders == nil {
+			params.ExtraHeaders = make(map[string]string, len(o.ExtraHeaders))
+		}
+		for k, v := range o.ExtraHeaders {
+			if v == "" {
+				delete(params.ExtraHeaders, k)
+			} else {
+				params.ExtraHeaders[k] = v
+			}
+		}
+	}
+
+	m.Parameters = params
+	return m
+}
+
+// activeOverride 返回模型当前生效的覆盖
+func activeOverride(modelID string, now time.Time) (ParameterOverride, bool) {
+	overrides := *parameterOverrides.Load()
+	if len(overrides) == 0 {
+		return ParameterOverride{}, false
+	}
+	o, ok := overrides[modelID]
+	if !ok || !now.Before(o.ExpiresAt) {
+		return ParameterOverride{}, false
+	}
+	return o, true
+}
+
+// withOverride 叠加生效中的参数覆盖，没有覆盖时原样返回
+func withOverride(m ZenModel, modelID string) ZenModel {
+	if o, ok := activeOverride(modelID, time.Now()); ok {
+		return o.apply(m)
+	}
+	return m
+}
+
+// SetParameterOverride 为模型设置临时参数覆盖（仅内存生效），覆盖叠加在模型表之上，
+// 模型同步不会清除覆盖，到期后自动回到模型表中的参数
+func SetParameterOverride(modelID string, o ParameterOverride) error {
+	if _, ok := zenModelsSnap.Load().models[modelID]; !ok {
+		return fmt.Errorf("unknown model: %s", modelID)
+	}
+	if err := o.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if !o.ExpiresAt.After(now) {
+		return fmt.Errorf("expiresAt must be in the future")
+	}
+	if o.ExtraHeaders != nil {
+		headers := make(map[string]string, len(o.ExtraHeaders))
+		for k, v := range o.ExtraHeaders {
+			headers[k] = v
+		}
+		o.ExtraHeaders = headers
+	}
+
+	updateParameterOverrides(now, func(overrides map[string]ParameterOverride) {
+		overrides[modelID] = o
+	})
+	return nil
+}
+
+// ClearParameterOverride 立即撤销模型的参数覆盖，返回之前是否存在生效中的覆盖
+func ClearParameterOverride(modelID string) bool {
+	_, existed := activeOverride(modelID, time.Now())
+	updateParameterOverrides(time.Now(), func(overrides map[string]ParameterOverride) {
+		delete(overrides, modelID)
+	})
+	return existed
+}
+
+// GetParameterOverride 获取模型生效中的参数覆盖
+func GetParameterOverride(modelID string) (ParameterOverride, bool) {
+	return activeOverride(modelID, time.Now())
+}
+
+// ListParameterOverrides 返回所有生效中的参数覆盖
+func ListParameterOverrides() map[string]ParameterOverride {
+	now := time.Now()
+	result := make(map[string]ParameterOverride)
+	for id, o := range *parameterOverrides.Load() {
+		if now.Before(o.ExpiresAt) {
+			result[id] = o
+		}
+	}
+	return result
+}
+
+// updateParameterOverrides 写时复制修改覆盖表，顺带清理已过期的条目
+func updateParameterOverrides(now time.Time, fn func(overrides map[string]ParameterOverride)) {
+	parameterOverridesMu.Lock()
+	defer parameterOverridesMu.Unlock()
+
+	cur := *parameterOverrides.Load()
+	next := make(map[string]ParameterOverride, len(cur)+1)
+	for id, o := range cur {
+		if now.Before(o.ExpiresAt) {
+			next[id] = o
+		}
+	}
+	fn(next)
+	parameterOverrides.Store(&next)
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParameterOverrideLayersOnRegistry(t *testing.T) {
+	const id = "claude-opus-4-5-20251101-thinking"
+	defer ClearParameterOverride(id)
+
+	temp := 0.3
+	budget := 8192
+	err := SetParameterOverride(id, ParameterOverride{
+		Temperature:    &temp,
+		ThinkingBudget: &budget,
+		ExtraHeaders:   map[string]string{"anthropic-beta": "", "x-test": "1"},
+		ExpiresAt:      time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("SetParameterOverride: %v", err)
+	}
+
+	m, _ := GetZenModel(id)
+	if *m.Parameters.Temperature != 0.3 || m.Parameters.Thinking.BudgetTokens != 8192 {
+		t.Errorf("override not applied: temp=%v thinking=%+v", *m.Parameters.Temperature, m.Parameters.Thinking)
+	}
+	if _, ok := m.Parameters.ExtraHeaders["anthropic-beta"]; ok || m.Parameters.ExtraHeaders["x-test"] != "1" {
+		t.Errorf("headers = %v", m.Parameters.ExtraHeaders)
+	}
+	if got := zenModelsSnap.Load().models[id].Parameters.Thinking.BudgetTokens; got != 4096 {
+		t.Errorf("registry mutated: budget=%d", got)
+	}
+
+	// claude-opus-4-5-20251101 与 -thinking 共用同一个 ID，覆盖只能作用于被设置的条目
+	overridden := 0
+	for _, listed := range ListZenModels() {
+		if listed.Parameters != nil && listed.Parameters.Thinking != nil && listed.Parameters.Thinking.BudgetTokens == 8192 {
+			overridden++
+		}
+	}
+	if overridden != 1 {
+		t.Errorf("ListZenModels applied override to %d entries, want 1", overridden)
+	}
+
+	if !ClearParameterOverride(id) {
+		t.Error("ClearParameterOverride reported no active override")
+	}
+	m, _ = GetZenModel(id)
+	if m.Parameters.Thinking.BudgetTokens != 4096 || m.Parameters.ExtraHeaders["anthropic-beta"] == "" {
+		t.Errorf("override not reverted: %+v", m.Parameters)
+	}
+}
+
+func TestParameterOverrideExpires(t *testing.T) {
+	const id = "gpt-5-2025-08-07"
+	defer ClearParameterOverride(id)
+	if _, ok := GetZenModel(id); !ok {
+		t.Skipf("model %s missing from defaults", id)
+	}
+
+	if err := SetParameterOverride(id, ParameterOverride{ReasoningEffort: "high", ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatalf("SetParameterOverride: %v", err)
+	}
+	if m, _ := GetZenModel(id); m.Parameters.Reasoning == nil || m.Parameters.Reasoning.Effort != "high" {
+		t.Fatalf("reasoning effort not applied: %+v", m.Parameters)
+	}
+
+	if _, ok := activeOverride(id, time.Now().Add(2*time.Minute)); ok {
+		t.Error("override still active after expiry")
+	}
+}
+
+func TestParameterOverrideValidation(t *testing.T) {
+	future := time.Now().Add(time.Minute)
+	temp := 3.0
+	small := 100
+
+	cases := map[string]struct {
+		model string
+		o     ParameterOverride
+	}{
+		"unknown model":   {"no-such-model", ParameterOverride{ReasoningEffort: "low", ExpiresAt: future}},
+		"empty":           {"claude-sonnet-4-5-20250929", ParameterOverride{ExpiresAt: future}},
+		"temperature":     {"claude-sonnet-4-5-20250929", ParameterOverride{Temperature: &temp, ExpiresAt: future}},
+		"budget":          {"claude-sonnet-4-5-20250929", ParameterOverride{ThinkingBudget: &small, ExpiresAt: future}},
+		"effort":          {"claude-sonnet-4-5-20250929", ParameterOverride{ReasoningEffort: "max", ExpiresAt: future}},
+		"already expired": {"claude-sonnet-4-5-20250929", ParameterOverride{ReasoningEffort: "low", ExpiresAt: time.Now().Add(-time.Second)}},
+	}
+	for name, tc := range cases {
+		if err := SetParameterOverride(tc.model, tc.o); err == nil {
+			t.Errorf("%s: expected error", name)
+			ClearParameterOverride(tc.model)
+		}
+	}
+}
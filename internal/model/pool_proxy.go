@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// PoolProxy 运行时添加到代理池的代理，与 SOCKS_PROXY_POOL 中的代理一起使用
+type PoolProxy struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	URL       string    `json:"-" gorm:"uniqueIndex;size:512;not null"` // 可能包含认证信息，不直接返回
+	Region    string    `json:"region" gorm:"size:32"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PoolProxyRequest 添加代理的请求
+type PoolProxyRequest struct {
+	URL    string `json:"url"`
+	Region string `json:"region"`
+	Test   bool   `json:"test"` // 保存前先检查代理，不可用时拒绝添加
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// SchemaMigration 已执行的数据库迁移，每个版本只执行一次
+type SchemaMigration struct {
+	Version   string    `json:"version" gorm:"primaryKey;size:64"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
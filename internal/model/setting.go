@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Setting 管理后台修改后需要在重启后保留的运行时配置，Value 为 JSON
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey;size:64"`
+	Value     string    `json:"value" gorm:"type:text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// AccountUsageDaily 账号每日消耗的积分和请求数，用于容量规划报表
+type AccountUsageDaily struct {
+	ID        uint    `json:"-" gorm:"primaryKey"`
+	Date      string  `json:"date" gorm:"uniqueIndex:idx_account_usage_day;size:10"` // 本地日期 2006-01-02
+	AccountID uint    `json:"account_id" gorm:"uniqueIndex:idx_account_usage_day"`
+	Credits   float64 `json:"credits"`
+	Requests  int     `json:"requests"`
+}
+
+// PoolRejectionDaily 每日因号池饱和（有权限的账号均在使用中、冷却中或被预留）被拒绝的请求数
+type PoolRejectionDaily struct {
+	ID    uint   `json:"-" gorm:"primaryKey"`
+	Date  string `json:"date" gorm:"uniqueIndex:idx_pool_rejection_day;size:10"`
+	Model string `json:"model" gorm:"uniqueIndex:idx_pool_rejection_day"`
+	Count int    `json:"count"`
+}
+
+// RequestLog 每次上游调用的记录，用于按日期、模型、账号和 API Key 归集用量
+type RequestLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+	Date       string    `json:"date" gorm:"index;size:10"` // 本地日期 2006-01-02
+	Model      string    `json:"model" gorm:"index;size:128"`
+	AccountID  uint      `json:"account_id" gorm:"index"`
+	StatusCode int       `json:"status_code"`               // 网络错误时为 0
+	ErrorType  string    `json:"error_type" gorm:"size:32"` // 上游失败分类，成功时为空
+	LatencyMs  int64     `json:"latency_ms"`                // 发出请求到收到响应头的耗时
+	Cost       float64   `json:"cost"`                      // Zen-Request-Cost，上游未返回时为 0
+	KeyHash    string    `json:"-" gorm:"index;size:64"`    // 客户端 API Key 的 SHA-256
+	KeyMasked  string    `json:"key" gorm:"size:32"`
+	Stream     bool      `json:"stream"`
+
+	RequestBytes  int64 `json:"request_bytes"`  // 客户端请求体大小，未知时为发往上游的请求体大小
+	ResponseBytes int64 `json:"response_bytes"` // 从上游读取的响应体大小
+	DurationMs    int64 `json:"duration_ms"`    // 发出请求到响应体读完或关闭的耗时，流式响应即流的持续时间
+
+	// Anthropic 响应 usage 中的输入用量，其他服务商或未解析到时为 0
+	InputTokens         int64 `json:"input_tokens" gorm:"default:0"`                // 未命中也未写入 prompt 缓存的输入
+	CacheCreationTokens int64 `json:"cache_creation_input_tokens" gorm:"default:0"` // 写入 prompt 缓存的输入
+	CacheReadTokens     int64 `json:"cache_read_input_tokens" gorm:"default:0"`     // 命中 prompt 缓存的输入
+}
+
+// DeadLetter 重试用尽后仍失败的请求，用于分析反复出现的失败模式，请求体完整保存时可重放
+type DeadLetter struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"index"`
+	Method           string     `json:"method" gorm:"size:8"`
+	Path             string     `json:"path" gorm:"size:255"`
+	Model            string     `json:"model" gorm:"index;size:128"`
+	KeyMasked        string     `json:"key" gorm:"size:32"`
+	StatusCode       int        `json:"status_code"`               // 返回给客户端的状态码
+	Error            string     `json:"error" gorm:"type:text"`    // 最终错误及其错误链
+	AccountIDs       string     `json:"account_ids"`               // 尝试过的账号，逗号分隔
+	Attempts         string     `json:"attempts" gorm:"type:text"` // 每次上游尝试的 JSON 数组
+	DurationMs       int64      `json:"duration_ms"`               // 从收到请求到返回错误的耗时
+	Payload          string     `json:"payload" gorm:"type:text"`  // 脱敏后的请求体开头部分
+	PayloadTruncated bool       `json:"payload_truncated"`         // 请求体超出保存上限，不能重放
+	ReplayedAt       *time.Time `json:"replayed_at"`
+	ReplayStatus     int        `json:"replay_status" gorm:"default:0"` // 最近一次重放的状态码
+}
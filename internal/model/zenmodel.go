@@ -3,6 +3,7 @@ package model
 import (
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,18 +32,52 @@ type ModelParameters struct {
 	Reasoning      *ReasoningConfig  `json:"reasoning,omitempty"`
 	Text           *TextConfig       `json:"text,omitempty"`
 	ExtraHeaders   map[string]string `json:"extraHeaders,omitempty"`
-	ForceStreaming *bool             `json:"forceStreaming,omitempty"`
+	ForceStreaming *bool             `json:"forceStreaming,omitempty"` // 上游只支持流式，OpenAI 请求总是以 stream=true 发送
+
+	// 以下为个别上游模型的特殊要求，由模型表配置，新增同类模型时无需修改代码
+	ExtraBody          map[string]interface{} `json:"extraBody,omitempty"`          // 合并到请求体的字段，对象按字段递归合并，其余值覆盖客户端传入的值
+	AggregateSSEToJSON bool                   `json:"aggregateSSEToJSON,omitempty"` // 非流式 Chat 请求收到 SSE 响应时聚合为 chat.completion，即使没有内容
+	TypedInput         bool                   `json:"typedInput,omitempty"`         // Chat 消息转换为 type=message、内容为 input_text 块的 Responses input
+	ParameterPolicy    map[string]string      `json:"parameterPolicy,omitempty"`    // Chat 请求参数的处理方式：drop 删除、error 返回 400、pass 转发，覆盖服务商的默认策略
+}
+
+// ForcesStreaming 上游是否只支持流式
+func (p *ModelParameters) ForcesStreaming() bool {
+	return p != nil && p.ForceStreaming != nil && *p.ForceStreaming
+}
+
+// AggregatesSSE 非流式请求是否需要把 SSE 响应聚合为 JSON
+func (p *ModelParameters) AggregatesSSE() bool {
+	return p != nil && p.AggregateSSEToJSON
+}
+
+// UsesTypedInput Chat 消息是否需要转换为带类型的 Responses input
+func (p *ModelParameters) UsesTypedInput() bool {
+	return p != nil && p.TypedInput
+}
+
+// TimeoutConfig 模型级超时覆盖(秒)，未设置的字段沿用服务商默认值
+type TimeoutConfig struct {
+	ConnectSeconds int `json:"connectSeconds,omitempty"`
+	TTFBSeconds    int `json:"ttfbSeconds,omitempty"`
+	TotalSeconds   int `json:"totalSeconds,omitempty"`
 }
 
+// ModelTypeEmbedding embedding 模型只能用于 /v1/embeddings，Type 为空表示对话模型
+const ModelTypeEmbedding = "embedding"
+
 type ZenModel struct {
-	ID          string           `json:"id"`
-	DisplayName string           `json:"displayName"`
-	Model       string           `json:"model"`
-	Multiplier  float64          `json:"multiplier"`
-	ProviderID  string           `json:"providerId"`
-	Parameters  *ModelParameters `json:"parameters,omitempty"`
-	IsHidden    bool             `json:"isHidden"`
-	PremiumOnly bool             `json:"premiumOnly"` // 仅Advanced/Max可用
+	ID          string            `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Model       string            `json:"model"`
+	Multiplier  float64           `json:"multiplier"`
+	ProviderID  string            `json:"providerId"`
+	Type        string            `json:"type,omitempty"`
+	Parameters  *ModelParameters  `json:"parameters,omitempty"`
+	IsHidden    bool              `json:"isHidden"`
+	PremiumOnly bool              `json:"premiumOnly"` // 仅Advanced/Max可用
+	Timeouts    *TimeoutConfig    `json:"timeouts,omitempty"`
+	Deprecation *ModelDeprecation `json:"deprecation,omitempty"`
 }
 
 // 辅助变量
@@ -60,6 +95,10 @@ var (
 		},
 	}
 
+	// 长时间thinking模型放宽超时，补全类模型快速失败
+	longTimeouts = &TimeoutConfig{TTFBSeconds: 300, TotalSeconds: 1800}
+	fastTimeouts = &TimeoutConfig{ConnectSeconds: 5, TTFBSeconds: 20, TotalSeconds: 120}
+
 	// OpenAI reasoning参数
 	openaiParams = &ModelParameters{
 		Temperature: &temp1,
@@ -98,6 +137,7 @@ var defaultZenModels = map[string]ZenModel{
 			ForceStreaming: &forceStream,
 		},
 		IsHidden: true,
+		Timeouts: longTimeouts,
 	},
 	"claude-opus-4-5-20251101-thinking": {
 		ID: "opus-4-5-think", DisplayName: "Opus 4.5 Parallel Thinking",
@@ -109,6 +149,7 @@ var defaultZenModels = map[string]ZenModel{
 			ExtraHeaders:   map[string]string{"anthropic-beta": "interleaved-thinking-2025-05-14"},
 			ForceStreaming: &forceStream,
 		},
+		Timeouts: longTimeouts,
 	},
 	// Anthropic Models - 标准模式（不带 Thinking）
 	"claude-sonnet-4-20250514": {
@@ -135,6 +176,7 @@ var defaultZenModels = map[string]ZenModel{
 			ExtraHeaders:   map[string]string{"anthropic-beta": "interleaved-thinking-2025-05-14"},
 			ForceStreaming: &forceStream,
 		},
+		Timeouts: longTimeouts,
 	},
 	"claude-haiku-4-5-20251001": { //非原生实现
 		ID: "haiku-4-5-think", DisplayName: "Haiku 4.5 Parallel Thinking",
@@ -194,6 +236,19 @@ var defaultZenModels = map[string]ZenModel{
 		ID: "grok-code-fast", DisplayName: "Grok Code Fast 1",
 		Model: "grok-code-fast-1", Multiplier: 0.25, ProviderID: "xai",
 		Parameters: &ModelParameters{Temperature: &temp0},
+		Timeouts:   fastTimeouts,
+	},
+
+	// Embedding Models
+	"text-embedding-3-small": {
+		ID: "text-embedding-3-small", DisplayName: "Text Embedding 3 Small",
+		Model: "text-embedding-3-small", Multiplier: 0.1, ProviderID: "openai",
+		Type: ModelTypeEmbedding,
+	},
+	"text-embedding-3-large": {
+		ID: "text-embedding-3-large", DisplayName: "Text Embedding 3 Large",
+		Model: "text-embedding-3-large", Multiplier: 0.25, ProviderID: "openai",
+		Type: ModelTypeEmbedding,
 	},
 
 	// Utility Models
@@ -201,89 +256,331 @@ var defaultZenModels = map[string]ZenModel{
 		ID: "generate-name-v2", DisplayName: "Cheap model for generating names",
 		Model: "gpt-5-nano-2025-08-07", Multiplier: 0, ProviderID: "openai",
 		Parameters: &ModelParameters{
-			Reasoning: &ReasoningConfig{Effort: "minimal"},
+			Temperature:    &temp1,
+			Reasoning:      &ReasoningConfig{Effort: "minimal"},
+			Text:           &TextConfig{Verbosity: "medium"},
+			ForceStreaming: &forceStream,
+			ExtraBody: map[string]interface{}{
+				"prompt_cache_key": "generate-name",
+				"store":            false,
+				"include":          []interface{}{"reasoning.encrypted_content"},
+				"service_tier":     "auto",
+				"reasoning":        map[string]interface{}{"summary": "auto"},
+			},
+			AggregateSSEToJSON: true,
+			TypedInput:         true,
 		},
 	},
 }
 
+// zenModelSnapshot 模型表的只读快照，发布后不再修改
+type zenModelSnapshot struct {
+	models   map[string]ZenModel
+	sorted   []ZenModel
+	keys     []string // 与 sorted 一一对应的模型表键
+	syncedAt time.Time
+
+	// 各订阅类型的可用模型位图，随模型表更新重新生成；第 i 位对应 keys[i]
+	index    map[string]int
+	planBits [len(permissionPlans)][]uint64
+}
+
 var (
-	zenModelsMu       sync.RWMutex
-	zenModels         = cloneZenModels(defaultZenModels)
-	zenModelsSyncedAt time.Time
+	// zenModelsWriteMu 只串行化写入方，读取方通过 atomic 指针无锁访问
+	zenModelsWriteMu sync.Mutex
+	zenModelsSnap    atomic.Pointer[zenModelSnapshot]
 )
 
+func init() {
+	zenModelsSnap.Store(newZenModelSnapshot(defaultZenModels, time.Time{}))
+}
+
+// IsEmbedding 是否为 embedding 模型
+func (m ZenModel) IsEmbedding() bool {
+	return m.Type == ModelTypeEmbedding
+}
+
+// Clone 深拷贝模型配置，避免副本与已发布快照共享参数指针
+func (m ZenModel) Clone() ZenModel {
+	if m.Parameters != nil {
+		m.Parameters = m.Parameters.Clone()
+	}
+	if m.Timeouts != nil {
+		t := *m.Timeouts
+		m.Timeouts = &t
+	}
+	if m.Deprecation != nil {
+		d := *m.Deprecation
+		m.Deprecation = &d
+	}
+	return m
+}
+
+// Clone 深拷贝模型参数
+func (p *ModelParameters) Clone() *ModelParameters {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	if p.Temperature != nil {
+		v := *p.Temperature
+		c.Temperature = &v
+	}
+	if p.Thinking != nil {
+		v := *p.Thinking
+		c.Thinking = &v
+	}
+	if p.Reasoning != nil {
+		v := *p.Reasoning
+		c.Reasoning = &v
+	}
+	if p.Text != nil {
+		v := *p.Text
+		c.Text = &v
+	}
+	if p.ForceStreaming != nil {
+		v := *p.ForceStreaming
+		c.ForceStreaming = &v
+	}
+	if p.ExtraHeaders != nil {
+		c.ExtraHeaders = make(map[string]string, len(p.ExtraHeaders))
+		for k, v := range p.ExtraHeaders {
+			c.ExtraHeaders[k] = v
+		}
+	}
+	if p.ExtraBody != nil {
+		c.ExtraBody = CloneJSONValue(p.ExtraBody).(map[string]interface{})
+	}
+	if p.ParameterPolicy != nil {
+		c.ParameterPolicy = make(map[string]string, len(p.ParameterPolicy))
+		for k, v := range p.ParameterPolicy {
+			c.ParameterPolicy[k] = v
+		}
+	}
+	return &c
+}
+
+// CloneJSONValue 深拷贝由 encoding/json 解码得到的值，对象和数组逐层复制
+func CloneJSONValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			c[k] = CloneJSONValue(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(val))
+		for i, child := range val {
+			c[i] = CloneJSONValue(child)
+		}
+		return c
+	}
+	return v
+}
+
 func cloneZenModels(src map[string]ZenModel) map[string]ZenModel {
 	dst := make(map[string]ZenModel, len(src))
 	for k, v := range src {
-		dst[k] = v
+		dst[k] = v.Clone()
 	}
 	return dst
 }
 
-// DefaultZenModels 返回默认模型集合副本。
-func DefaultZenModels() map[string]ZenModel {
+// newZenModelSnapshot 复制模型表并预先生成排序列表
+func newZenModelSnapshot(models map[string]ZenModel, syncedAt time.Time) *zenModelSnapshot {
+	snap := &zenModelSnapshot{
+		models:   cloneZenModels(models),
+		sorted:   make([]ZenModel, 0, len(models)),
+		keys:     make([]string, 0, len(models)),
+		syncedAt: syncedAt,
+	}
+	for key := range snap.models {
+		snap.keys = append(snap.keys, key)
+	}
+	sort.Slice(snap.keys, func(i, j int) bool {
+		mi, mj := snap.models[snap.keys[i]].Model, snap.models[snap.keys[j]].Model
+		if mi != mj {
+			return mi < mj
+		}
+		return snap.keys[i] < snap.keys[j]
+	})
+	for _, key := range snap.keys {
+		snap.sorted = append(snap.sorted, snap.models[key])
+	}
+	snap.buildPlanBits()
+	return snap
+}
+
+// buildPlanBits 为每种订阅类型预先计算可用模型位图
+func (s *zenModelSnapshot) buildPlanBits() {
+	s.index = make(map[string]int, len(s.keys))
+	for i, key := range s.keys {
+		s.index[key] = i
+	}
+	for slot, plan := range permissionPlans {
+		bits := make([]uint64, (len(s.keys)+63)/64)
+		for i, m := range s.sorted {
+			if planAllowsModel(plan, m) {
+				bits[i/64] |= 1 << (i % 64)
+			}
+		}
+		s.planBits[slot] = bits
+	}
+}
+
+// ThinkingTimeouts 返回 thinking 模型使用的长超时配置副本
+func ThinkingTimeouts() *TimeoutConfig {
+	t := *longTimeouts
+	return &t
+}
+
+// registryModels 数据库中的模型注册表，为 nil 时默认模型集合为编译进程序的 defaultZenModels
+var registryModels atomic.Pointer[map[string]ZenModel]
+
+// SetRegistryModels 用数据库中的模型注册表代替编译时的默认模型表，传入空集合时恢复编译时的默认模型表
+func SetRegistryModels(models map[string]ZenModel) {
+	if len(models) == 0 {
+		registryModels.Store(nil)
+		return
+	}
+	cloned := cloneZenModels(models)
+	registryModels.Store(&cloned)
+}
+
+// UsingRegistryModels 默认模型集合是否来自数据库中的模型注册表
+func UsingRegistryModels() bool {
+	return registryModels.Load() != nil
+}
+
+func baseZenModels() map[string]ZenModel {
+	if models := registryModels.Load(); models != nil {
+		return *models
+	}
+	return defaultZenModels
+}
+
+// BuiltinZenModels 返回编译进程序的默认模型表副本，不受模型注册表影响
+func BuiltinZenModels() map[string]ZenModel {
 	return cloneZenModels(defaultZenModels)
 }
 
+// DefaultZenModels 返回默认模型集合副本：数据库中有模型注册表时为注册表，否则为编译时的默认模型表
+func DefaultZenModels() map[string]ZenModel {
+	return cloneZenModels(baseZenModels())
+}
+
 // ReplaceZenModels 原子替换当前模型集合。
 func ReplaceZenModels(models map[string]ZenModel) {
-	zenModelsMu.Lock()
-	defer zenModelsMu.Unlock()
+	zenModelsWriteMu.Lock()
+	defer zenModelsWriteMu.Unlock()
+
+	zenModelsSnap.Store(newZenModelSnapshot(models, time.Now()))
+}
 
-	zenModels = cloneZenModels(models)
-	zenModelsSyncedAt = time.Now()
+// UpdateZenModels 基于当前模型表做写时复制修改，fn 收到的是深拷贝副本，
+// 修改其中的参数不会影响正在被读取的快照
+func UpdateZenModels(fn func(models map[string]ZenModel)) {
+	zenModelsWriteMu.Lock()
+	defer zenModelsWriteMu.Unlock()
+
+	cur := zenModelsSnap.Load()
+	models := cloneZenModels(cur.models)
+	fn(models)
+	zenModelsSnap.Store(newZenModelSnapshot(models, cur.syncedAt))
 }
 
 // ResetZenModelsToDefault 在同步失败时回退到默认模型集合。
 func ResetZenModelsToDefault() {
-	ReplaceZenModels(defaultZenModels)
+	ReplaceZenModels(baseZenModels())
 }
 
 // ZenModelsSyncedAt 返回最近一次模型表更新时间。
 func ZenModelsSyncedAt() time.Time {
-	zenModelsMu.RLock()
-	defer zenModelsMu.RUnlock()
-	return zenModelsSyncedAt
+	return zenModelsSnap.Load().syncedAt
 }
 
-// GetZenModel 获取模型配置，如果不存在则返回空模型和false
+// GetZenModel 获取模型配置（含生效中的参数覆盖），如果不存在则返回空模型和false
 func GetZenModel(modelID string) (ZenModel, bool) {
-	zenModelsMu.RLock()
-	defer zenModelsMu.RUnlock()
-
-	if m, ok := zenModels[modelID]; ok {
-		return m, true
+	if m, ok := zenModelsSnap.Load().models[modelID]; ok {
+		return withOverride(m, modelID), true
 	}
 	// 模型不存在，返回空模型和false
 	return ZenModel{}, false
 }
 
-// ListZenModels 返回稳定排序后的模型列表。
+// ListZenModels 返回稳定排序后的模型列表（含生效中的参数覆盖）。
 func ListZenModels() []ZenModel {
-	zenModelsMu.RLock()
-	defer zenModelsMu.RUnlock()
-
-	models := make([]ZenModel, 0, len(zenModels))
-	for _, m := range zenModels {
-		models = append(models, m)
+	snap := zenModelsSnap.Load()
+	models := make([]ZenModel, len(snap.sorted))
+	copy(models, snap.sorted)
+	if len(*parameterOverrides.Load()) > 0 {
+		for i, key := range snap.keys {
+			models[i] = withOverride(models[i], key)
+		}
 	}
-
-	sort.Slice(models, func(i, j int) bool {
-		return models[i].Model < models[j].Model
-	})
-
 	return models
 }
 
-// CanUseModel 检查订阅类型是否可以使用指定模型
-func CanUseModel(planType PlanType, modelID string) bool {
-	zenModel, _ := GetZenModel(modelID)
+// ListZenModelIDs 返回模型表的键（即客户端请求时使用的模型名），顺序与 ListZenModels 一致
+func ListZenModelIDs() []string {
+	keys := zenModelsSnap.Load().keys
+	ids := make([]string, len(keys))
+	copy(ids, keys)
+	return ids
+}
+
+// permissionPlans 权限位图覆盖的订阅类型，最后一个槽位代表其他未知订阅类型
+var permissionPlans = [...]PlanType{PlanFree, PlanStarter, PlanCore, PlanAdvanced, PlanMax, ""}
+
+func planSlot(planType PlanType) int {
+	for i, p := range permissionPlans[:len(permissionPlans)-1] {
+		if p == planType {
+			return i
+		}
+	}
+	return len(permissionPlans) - 1
+}
 
+// planAllowsModel 订阅类型的模型权限规则
+func planAllowsModel(planType PlanType, m ZenModel) bool {
 	// Advanced和Max可以使用所有模型
 	if planType == PlanAdvanced || planType == PlanMax {
 		return true
 	}
 
 	// 其他订阅类型不能使用PremiumOnly模型
-	return !zenModel.PremiumOnly
+	return !m.PremiumOnly
+}
+
+// CanUseModel 检查订阅类型是否可以使用指定模型，直接查快照中的位图；不在模型表中的模型视为可用
+func CanUseModel(planType PlanType, modelID string) bool {
+	snap := zenModelsSnap.Load()
+	i, ok := snap.index[modelID]
+	if !ok {
+		return true
+	}
+	return snap.planBits[planSlot(planType)][i/64]&(1<<(i%64)) != 0
+}
+
+// PlanSet 订阅类型集合
+type PlanSet uint8
+
+// Has 集合是否包含该订阅类型
+func (s PlanSet) Has(planType PlanType) bool {
+	return s&(1<<planSlot(planType)) != 0
+}
+
+// AllowedPlans 返回可以使用指定模型的订阅类型集合。选号时每个请求只查一次模型表，
+// 逐个账号判断时不再查表
+func AllowedPlans(modelID string) PlanSet {
+	snap := zenModelsSnap.Load()
+	i, ok := snap.index[modelID]
+	var set PlanSet
+	for slot := range permissionPlans {
+		if !ok || snap.planBits[slot][i/64]&(1<<(i%64)) != 0 {
+			set |= 1 << slot
+		}
+	}
+	return set
 }
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpdateZenModelsDoesNotMutatePublishedSnapshot(t *testing.T) {
+	defer ResetZenModelsToDefault()
+
+	const id = "claude-opus-4-5-20251101-thinking"
+	before, ok := GetZenModel(id)
+	if !ok {
+		t.Fatalf("model %s missing from defaults", id)
+	}
+	wantHeader := before.Parameters.ExtraHeaders["anthropic-beta"]
+	wantTotal := before.Timeouts.TotalSeconds
+
+	UpdateZenModels(func(models map[string]ZenModel) {
+		m := models[id]
+		m.Parameters.ExtraHeaders["anthropic-beta"] = "changed"
+		m.Timeouts.TotalSeconds = 1
+	})
+
+	if got := before.Parameters.ExtraHeaders["anthropic-beta"]; got != wantHeader {
+		t.Errorf("old snapshot header mutated: got %q want %q", got, wantHeader)
+	}
+	if got := before.Timeouts.TotalSeconds; got != wantTotal {
+		t.Errorf("old snapshot timeout mutated: got %d want %d", got, wantTotal)
+	}
+	if got := defaultZenModels[id].Parameters.ExtraHeaders["anthropic-beta"]; got != wantHeader {
+		t.Errorf("defaults mutated: got %q", got)
+	}
+
+	after, _ := GetZenModel(id)
+	if after.Parameters.ExtraHeaders["anthropic-beta"] != "changed" || after.Timeouts.TotalSeconds != 1 {
+		t.Errorf("update not published: %+v %+v", after.Parameters.ExtraHeaders, after.Timeouts)
+	}
+}
+
+func TestListZenModelsSortedAndIsolated(t *testing.T) {
+	defer ResetZenModelsToDefault()
+
+	list := ListZenModels()
+	if len(list) != len(defaultZenModels) {
+		t.Fatalf("got %d models, want %d", len(list), len(defaultZenModels))
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Model > list[i].Model {
+			t.Fatalf("list not sorted at %d: %s > %s", i, list[i-1].Model, list[i].Model)
+		}
+	}
+
+	list[0].Model = "mutated"
+	if ListZenModels()[0].Model == "mutated" {
+		t.Error("ListZenModels returned the snapshot's backing slice")
+	}
+}
+
+func TestReplaceZenModelsUpdatesSyncTime(t *testing.T) {
+	defer ResetZenModelsToDefault()
+
+	start := time.Now()
+	ReplaceZenModels(map[string]ZenModel{"only": {ID: "only", Model: "only"}})
+	if ZenModelsSyncedAt().Before(start) {
+		t.Error("sync time not updated")
+	}
+	if _, ok := GetZenModel("claude-sonnet-4-5-20250929"); ok {
+		t.Error("replaced registry still returns old models")
+	}
+	if _, ok := GetZenModel("only"); !ok {
+		t.Error("replaced registry missing new model")
+	}
+}
+
+func TestCanUseModelFollowsRegistry(t *testing.T) {
+	defer ResetZenModelsToDefault()
+
+	const opus = "claude-opus-4-1-20250805"
+	if CanUseModel(PlanCore, opus) || !CanUseModel(PlanMax, opus) || !CanUseModel(PlanFree, "claude-sonnet-4-5-20250929") {
+		t.Fatal("default permissions wrong")
+	}
+	if !CanUseModel(PlanFree, "not-in-registry") {
+		t.Error("unknown model should be allowed")
+	}
+	if CanUseModel(PlanType("Team"), opus) {
+		t.Error("unknown plan should not use premium models")
+	}
+	if set := AllowedPlans(opus); set.Has(PlanStarter) || !set.Has(PlanAdvanced) || !set.Has(PlanMax) || set.Has(PlanType("Team")) {
+		t.Errorf("AllowedPlans(%s) = %06b", opus, set)
+	}
+	if !AllowedPlans("").Has(PlanFree) {
+		t.Error("empty model should be allowed for every plan")
+	}
+
+	// 位图随模型表更新重新生成
+	UpdateZenModels(func(models map[string]ZenModel) {
+		m := models[opus]
+		m.PremiumOnly = false
+		models[opus] = m
+	})
+	if !CanUseModel(PlanCore, opus) {
+		t.Error("permission not refreshed after UpdateZenModels")
+	}
+
+	models := make(map[string]ZenModel)
+	for i := 0; i < 100; i++ {
+		models[fmt.Sprintf("m%03d", i)] = ZenModel{Model: fmt.Sprintf("m%03d", i), PremiumOnly: i%2 == 1}
+	}
+	ReplaceZenModels(models)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("m%03d", i)
+		if got := CanUseModel(PlanStarter, id); got != (i%2 == 0) {
+			t.Errorf("CanUseModel(Starter, %s) = %v", id, got)
+		}
+		if !CanUseModel(PlanAdvanced, id) {
+			t.Errorf("CanUseModel(Advanced, %s) = false", id)
+		}
+	}
+}
+
+// startRegistryWriter 在基准测试期间持续发布新快照，模拟后台模型同步
+func startRegistryWriter(b *testing.B) func() {
+	b.Helper()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var writes atomic.Int64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			UpdateZenModels(func(models map[string]ZenModel) {
+				m := models["grok-code-fast-1"]
+				m.Multiplier += 0.01
+				models["grok-code-fast-1"] = m
+			})
+			writes.Add(1)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+		b.ReportMetric(float64(writes.Load()), "writes")
+		ResetZenModelsToDefault()
+	}
+}
+
+func BenchmarkGetZenModelParallel(b *testing.B) {
+	ids := make([]string, 0, len(defaultZenModels))
+	for id := range defaultZenModels {
+		ids = append(ids, id)
+	}
+
+	stop := startRegistryWriter(b)
+	defer stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, ok := GetZenModel(ids[i%len(ids)]); !ok {
+				panic(fmt.Sprintf("model %s missing", ids[i%len(ids)]))
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkListZenModels(b *testing.B) {
+	stop := startRegistryWriter(b)
+	defer stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if len(ListZenModels()) == 0 {
+				panic("empty registry")
+			}
+		}
+	})
+}
+
+func TestCloneCopiesExtraBody(t *testing.T) {
+	orig := ZenModel{Parameters: &ModelParameters{ExtraBody: map[string]interface{}{
+		"reasoning": map[string]interface{}{"summary": "auto"},
+		"include":   []interface{}{"reasoning.encrypted_content"},
+	}}}
+	c := orig.Clone()
+	c.Parameters.ExtraBody["reasoning"].(map[string]interface{})["summary"] = "changed"
+	c.Parameters.ExtraBody["include"].([]interface{})[0] = "changed"
+
+	if got := orig.Parameters.ExtraBody["reasoning"].(map[string]interface{})["summary"]; got != "auto" {
+		t.Errorf("nested object shared with clone: %v", got)
+	}
+	if got := orig.Parameters.ExtraBody["include"].([]interface{})[0]; got != "reasoning.encrypted_content" {
+		t.Errorf("array shared with clone: %v", got)
+	}
+}
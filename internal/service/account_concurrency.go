@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxAccountConcurrency 每个账号并发请求数的上限
+const maxAccountConcurrency = 32
+
+var (
+	accountConcurrencyMu   sync.RWMutex
+	accountConcurrency     int
+	accountConcurrencyOnce sync.Once
+
+	// sessionHandles 长连接名额的句柄
+	sessionHandles atomic.Uint64
+)
+
+// GetAccountConcurrency 获取每个账号同时处理的请求数上限，MAX_CONCURRENT_PER_ACCOUNT 默认 1
+func GetAccountConcurrency() int {
+	accountConcurrencyOnce.Do(func() {
+		accountConcurrency = min(envPositiveInt("MAX_CONCURRENT_PER_ACCOUNT", 1), maxAccountConcurrency)
+	})
+	accountConcurrencyMu.RLock()
+	defer accountConcurrencyMu.RUnlock()
+	return accountConcurrency
+}
+
+// SetAccountConcurrency 运行时修改每个账号的并发上限（仅内存生效），已占用的请求不受影响
+func SetAccountConcurrency(n int) error {
+	if n < 1 || n > maxAccountConcurrency {
+		return fmt.Errorf("每个账号的并发数必须在 1 到 %d 之间", maxAccountConcurrency)
+	}
+	GetAccountConcurrency()
+	accountConcurrencyMu.Lock()
+	defer accountConcurrencyMu.Unlock()
+	accountConcurrency = n
+	return nil
+}
+
+// Active 占用的并发名额数，包括长连接持有的名额
+func (s *AccountStatus) Active() int {
+	return len(s.Leases) + len(s.Sessions)
+}
+
+// InUse 账号是否有未释放的占用
+func (s *AccountStatus) InUse() bool {
+	return s.Active() > 0
+}
+
+// InUseSince 最早一个未释放占用的开始时间，没有占用时为零值
+func (s *AccountStatus) InUseSince() time.Time {
+	var since time.Time
+	if len(s.Leases) > 0 {
+		since = s.Leases[0]
+	}
+	for _, t := range s.Sessions {
+		if since.IsZero() || t.Before(since) {
+			since = t
+		}
+	}
+	return since
+}
+
+// Full 并发数是否已达到上限
+func (s *AccountStatus) Full(limit int) bool {
+	return s.Active() >= limit
+}
+
+// acquire 占用一个并发名额
+func (s *AccountStatus) acquire(now time.Time) {
+	s.Leases = append(s.Leases, now)
+	s.LastUsed = now
+}
+
+// release 释放一个并发名额；ReleaseAccount 无法区分是哪个请求，按最早的占用释放
+func (s *AccountStatus) release() {
+	if len(s.Leases) > 0 {
+		s.Leases = append(s.Leases[:0], s.Leases[1:]...)
+	}
+}
+
+// hold 把一个普通占用转为长连接持有的名额，返回释放用的句柄；没有普通占用时新占用一个名额
+func (s *AccountStatus) hold(now time.Time) uint64 {
+	if n := len(s.Leases); n > 0 {
+		// 占用无法区分属于哪个请求，转换最近的一个，对其余请求的超时判断影响最小
+		now = s.Leases[n-1]
+		s.Leases = s.Leases[:n-1]
+	}
+	if s.Sessions == nil {
+		s.Sessions = make(map[uint64]time.Time)
+	}
+	handle := sessionHandles.Add(1)
+	s.Sessions[handle] = now
+	return handle
+}
+
+// expireLeases 释放占用超过 timeout 的普通名额（长连接持有的名额不受影响），返回释放的数量
+func (s *AccountStatus) expireLeases(now time.Time, timeout time.Duration) int {
+	n := 0
+	for n < len(s.Leases) && now.Sub(s.Leases[n]) > timeout {
+		n++
+	}
+	if n > 0 {
+		s.Leases = append(s.Leases[:0], s.Leases[n:]...)
+	}
+	return n
+}
+
+// lessLoaded 调度时 a 是否优于 b：占用少的优先，占用相同时从未使用过的优先，其次最长时间未使用的优先
+func lessLoaded(a, b *AccountStatus) bool {
+	if a.Active() != b.Active() {
+		return a.Active() < b.Active()
+	}
+	if b.LastUsed.IsZero() {
+		return false
+	}
+	return a.LastUsed.IsZero() || a.LastUsed.Before(b.LastUsed)
+}
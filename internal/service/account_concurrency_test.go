@@ -0,0 +1,124 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestAccountConcurrencyLimit(t *testing.T) {
+	now := time.Now()
+	accounts := []*model.Account{
+		{ID: 1, PlanType: model.PlanMax},
+		{ID: 2, PlanType: model.PlanMax},
+	}
+	pool.mu.Lock()
+	saved := pool.accounts
+	pool.accounts = accounts
+	pool.mu.Unlock()
+	defer func() {
+		pool.mu.Lock()
+		pool.accounts = saved
+		pool.mu.Unlock()
+	}()
+	defer swapAccountStatuses(map[uint]*AccountStatus{
+		1: {LastUsed: now.Add(-time.Hour)},
+		2: {LastUsed: now.Add(-time.Minute)},
+	})()
+	prev := GetAccountConcurrency()
+	defer SetAccountConcurrency(prev)
+	if err := SetAccountConcurrency(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// 占用少的账号优先，四个请求均匀分到两个账号
+	var got []uint
+	for i := 0; i < 4; i++ {
+		acc, err := GetNextAccountForModel("")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		got = append(got, acc.ID)
+	}
+	if want := []uint{1, 2, 1, 2}; !equalIDs(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	if _, err := GetNextAccountForModel(""); err == nil {
+		t.Fatal("both accounts are full, want error")
+	}
+
+	ReleaseAccount(accounts[1])
+	acc, err := GetNextAccountForModel("")
+	if err != nil || acc.ID != 2 {
+		t.Fatalf("after release got %+v, %v; want account 2", acc, err)
+	}
+}
+
+func TestAccountStatusLeases(t *testing.T) {
+	now := time.Now()
+	s := &AccountStatus{}
+	s.acquire(now.Add(-90 * time.Second))
+	s.acquire(now.Add(-40 * time.Second))
+	s.acquire(now)
+	if !s.Full(3) || s.Full(4) {
+		t.Errorf("Full with %d leases is wrong", len(s.Leases))
+	}
+	if n := s.expireLeases(now, 60*time.Second); n != 1 || !s.InUseSince().Equal(now.Add(-40*time.Second)) {
+		t.Errorf("expired %d, oldest %v", n, s.InUseSince())
+	}
+	s.release()
+	s.release()
+	s.release()
+	if s.InUse() || !s.InUseSince().IsZero() {
+		t.Errorf("leases after release = %v", s.Leases)
+	}
+}
+
+func TestSetAccountConcurrencyRejectsOutOfRange(t *testing.T) {
+	for _, n := range []int{0, -1, maxAccountConcurrency + 1} {
+		if err := SetAccountConcurrency(n); err == nil {
+			t.Errorf("SetAccountConcurrency(%d) = nil, want error", n)
+		}
+	}
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHoldAccountSurvivesExpiryAndReleasesByHandle(t *testing.T) {
+	now := time.Now()
+	acc := &model.Account{ID: 1}
+	status := &AccountStatus{Leases: []time.Time{now.Add(-time.Second), now}}
+	defer swapAccountStatuses(map[uint]*AccountStatus{1: status})()
+
+	// Realtime 连接持有的名额不受超时释放影响，仍计入并发
+	release := HoldAccount(acc)
+	if len(status.Leases) != 1 || len(status.Sessions) != 1 || !status.Full(2) {
+		t.Fatalf("status = %+v", status)
+	}
+	if n := status.expireLeases(now.Add(time.Hour), 60*time.Second); n != 1 || status.Active() != 1 {
+		t.Fatalf("expired = %d, status = %+v", n, status)
+	}
+
+	// 其他请求的释放不影响连接持有的名额，连接关闭后按句柄释放
+	status.acquire(now)
+	ReleaseAccount(acc)
+	if len(status.Sessions) != 1 {
+		t.Fatalf("session released by another request: %+v", status)
+	}
+	release()
+	release()
+	if status.Active() != 0 {
+		t.Errorf("status = %+v", status)
+	}
+}
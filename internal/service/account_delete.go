@@ -0,0 +1,75 @@
+package service
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// hasClientCredential 账号是否使用通过 api-tokens 生成的 client 凭证登录（而非 JWT 或 RefreshToken 导入）
+func hasClientCredential(account *model.Account) bool {
+	return account.ClientID != "" && account.ClientSecret != "jwt-login" && account.ClientSecret != "refresh-token-login"
+}
+
+// DeleteAccounts 删除 ids 中的账号（fromStatus 不为空时只删除该分类的账号），
+// 删除后在后台吊销其中 client 凭证账号的上游凭证，避免留下仍然有效的凭证；吊销尽力而为，结果只记录日志
+// 返回删除数量和待吊销的凭证数量
+func DeleteAccounts(ids []uint, fromStatus string) (int64, int, error) {
+	query := func() *gorm.DB {
+		q := database.GetDB().Model(&model.Account{}).Where("id IN ?", ids)
+		if fromStatus != "" {
+			q = q.Where("status = ?", fromStatus)
+		}
+		return q
+	}
+
+	var accounts []model.Account
+	if err := query().Select("id", "client_id", "client_secret", "email").Find(&accounts).Error; err != nil {
+		return 0, 0, err
+	}
+	result := query().Delete(&model.Account{})
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+
+	var revoke []model.Account
+	for i := range accounts {
+		if hasClientCredential(&accounts[i]) {
+			revoke = append(revoke, accounts[i])
+		}
+	}
+	if len(revoke) > 0 {
+		go revokeDeletedCredentials(revoke)
+	}
+	return result.RowsAffected, len(revoke), nil
+}
+
+// revokeDeletedCredentials 用同邮箱的 Token 记录逐个吊销已删除账号的凭证，返回吊销成功和失败的数量
+func revokeDeletedCredentials(accounts []model.Account) (int, int) {
+	masterTokens := make(map[string]string)
+	revoked, failed := 0, 0
+	for _, account := range accounts {
+		token, ok := masterTokens[account.Email]
+		if !ok {
+			var err error
+			if token, err = credentialMasterToken(account.Email); err != nil {
+				log.Printf("[AccountDelete] 已删除账号 %s (ID:%d) 的凭证未吊销: %v", account.ClientID, account.ID, err)
+			}
+			masterTokens[account.Email] = token
+		}
+		if token == "" {
+			failed++
+			continue
+		}
+		if err := credentialRevoke(token, account.ClientID); err != nil {
+			log.Printf("[WARN] [AccountDelete] 吊销已删除账号 %s (ID:%d) 的凭证失败: %v", account.ClientID, account.ID, err)
+			failed++
+			continue
+		}
+		revoked++
+	}
+	log.Printf("[AccountDelete] 已删除账号的凭证吊销完成: 成功 %d 个, 失败 %d 个", revoked, failed)
+	return revoked, failed
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+func TestDeleteAccountsRevokesClientCredentials(t *testing.T) {
+	_, account := setupCredentialRotationTest(t)
+	jwtAccount := &model.Account{ClientID: "jwt-user", ClientSecret: "jwt-login", Email: "user@example.com", Status: "normal"}
+	if err := database.GetDB().Create(jwtAccount).Error; err != nil {
+		t.Fatal(err)
+	}
+	revoked := make(chan string, 2)
+	credentialRevoke = func(token, clientID string) error {
+		if token != "master-from-record" {
+			t.Errorf("revoked with token %q", token)
+		}
+		revoked <- clientID
+		return nil
+	}
+
+	deleted, revoking, err := DeleteAccounts([]uint{account.ID, jwtAccount.ID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || revoking != 1 {
+		t.Errorf("deleted = %d, revoking = %d", deleted, revoking)
+	}
+	select {
+	case clientID := <-revoked:
+		if clientID != "client-old" {
+			t.Errorf("revoked %s", clientID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("credential not revoked")
+	}
+
+	// 找不到 Token 记录时只记录日志，不影响删除
+	if revokedCount, failed := revokeDeletedCredentials([]model.Account{{ClientID: "orphan", Email: "nobody@example.com"}}); revokedCount != 0 || failed != 1 {
+		t.Errorf("revoked = %d, failed = %d", revokedCount, failed)
+	}
+}
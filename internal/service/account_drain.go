@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval 等待排空时检查的间隔
+const drainPollInterval = 200 * time.Millisecond
+
+// openResponses 每个账号尚未读完或关闭的上游响应数，账号名额在收到响应头时就已释放，
+// 流式响应要靠它判断是否结束；由 statusMu 保护
+var openResponses = make(map[uint]int)
+
+// AccountDrainStatus 账号的排空状态
+type AccountDrainStatus struct {
+	AccountID      uint       `json:"account_id"`
+	Draining       bool       `json:"draining"`
+	Since          *time.Time `json:"since,omitempty"`
+	ActiveRequests int        `json:"active_requests"` // 尚未收到响应头的请求
+	OpenResponses  int        `json:"open_responses"`  // 仍在转发的响应（含流式）
+	Safe           bool       `json:"safe"`            // 排空中且没有进行中的请求，可以刷新、改代理或删除
+}
+
+// trackOpenResponse 记录账号新打开的上游响应，返回的函数在响应关闭时调用
+func trackOpenResponse(accountID uint) func() {
+	statusMu.Lock()
+	openResponses[accountID]++
+	statusMu.Unlock()
+	return func() {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		if openResponses[accountID]--; openResponses[accountID] <= 0 {
+			delete(openResponses, accountID)
+		}
+	}
+}
+
+// DrainAccount 停止向账号调度新请求，进行中的请求和流不受影响（仅内存生效，重启后恢复调度）
+func DrainAccount(accountID uint, now time.Time) AccountDrainStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status, exists := accountStatuses[accountID]
+	if !exists {
+		status = &AccountStatus{}
+		accountStatuses[accountID] = status
+	}
+	if status.DrainingSince.IsZero() {
+		status.DrainingSince = now
+	}
+	return accountDrainStatus(accountID)
+}
+
+// ResumeAccount 取消排空，账号重新参与调度
+func ResumeAccount(accountID uint) AccountDrainStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if status, exists := accountStatuses[accountID]; exists {
+		status.DrainingSince = time.Time{}
+	}
+	return accountDrainStatus(accountID)
+}
+
+// GetAccountDrainStatus 获取账号的排空状态
+func GetAccountDrainStatus(accountID uint) AccountDrainStatus {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return accountDrainStatus(accountID)
+}
+
+// WaitAccountDrained 等待排空中的账号没有进行中的请求，超时或 ctx 取消时返回当前状态
+func WaitAccountDrained(ctx context.Context, accountID uint, timeout time.Duration) AccountDrainStatus {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		s := GetAccountDrainStatus(accountID)
+		if s.Safe || !s.Draining {
+			return s
+		}
+		select {
+		case <-ctx.Done():
+			return s
+		case <-deadline.C:
+			return s
+		case <-ticker.C:
+		}
+	}
+}
+
+// accountDrainStatus 调用方需持有 statusMu
+func accountDrainStatus(accountID uint) AccountDrainStatus {
+	result := AccountDrainStatus{AccountID: accountID, OpenResponses: openResponses[accountID]}
+	if status, exists := accountStatuses[accountID]; exists {
+		result.ActiveRequests = status.Active()
+		if status.Draining() {
+			result.Draining = true
+			result.Since = timePtr(status.DrainingSince)
+		}
+	}
+	result.Safe = result.Draining && result.ActiveRequests == 0 && result.OpenResponses == 0
+	return result
+}
+
+// Draining 账号是否在排空中
+func (s *AccountStatus) Draining() bool {
+	return !s.DrainingSince.IsZero()
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestDrainAccount(t *testing.T) {
+	now := time.Now()
+	accounts := []*model.Account{
+		{ID: 1, PlanType: model.PlanMax},
+		{ID: 2, PlanType: model.PlanMax},
+	}
+	pool.mu.Lock()
+	saved := pool.accounts
+	pool.accounts = accounts
+	pool.mu.Unlock()
+	defer func() {
+		pool.mu.Lock()
+		pool.accounts = saved
+		pool.mu.Unlock()
+	}()
+	defer swapAccountStatuses(map[uint]*AccountStatus{
+		1: {LastUsed: now.Add(-time.Hour)},
+		2: {LastUsed: now.Add(-time.Minute)},
+	})()
+
+	// 账号 1 收到响应头后释放名额，但流仍在转发
+	acc, err := GetNextAccountForModel("")
+	if err != nil || acc.ID != 1 {
+		t.Fatalf("got %+v, %v", acc, err)
+	}
+	closeStream := trackOpenResponse(1)
+	ReleaseAccount(acc)
+
+	status := DrainAccount(1, now)
+	if !status.Draining || status.Safe || status.OpenResponses != 1 {
+		t.Fatalf("drain status = %+v", status)
+	}
+	// 排空中的账号不再被调度，即使它最久未使用
+	if acc, err := GetNextAccountForModel(""); err != nil || acc.ID != 2 {
+		t.Fatalf("got %+v, %v; want account 2", acc, err)
+	}
+
+	closeStream()
+	if status := WaitAccountDrained(context.Background(), 1, time.Second); !status.Safe {
+		t.Errorf("after stream closed = %+v, want safe", status)
+	}
+
+	if status := ResumeAccount(1); status.Draining || status.Safe {
+		t.Errorf("resumed status = %+v", status)
+	}
+	if acc, err := GetNextAccountForModel(""); err != nil || acc.ID != 1 {
+		t.Fatalf("got %+v, %v; want resumed account 1", acc, err)
+	}
+}
+
+func TestWaitAccountDrainedTimeout(t *testing.T) {
+	defer swapAccountStatuses(map[uint]*AccountStatus{
+		1: {Leases: []time.Time{time.Now()}},
+	})()
+	DrainAccount(1, time.Now())
+	start := time.Now()
+	status := WaitAccountDrained(context.Background(), 1, 300*time.Millisecond)
+	if status.Safe || status.ActiveRequests != 1 || time.Since(start) < 300*time.Millisecond {
+		t.Errorf("status = %+v after %v", status, time.Since(start))
+	}
+}
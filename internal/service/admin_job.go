@@ -0,0 +1,354 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// ErrAdminJobNotFound 后台任务不存在
+var ErrAdminJobNotFound = errors.New("job not found")
+
+const (
+	// adminJobChunk 删除和移动时每步处理的账号数
+	adminJobChunk = 100
+	// adminJobMaxErrors 每个任务保留的失败记录数
+	adminJobMaxErrors = 50
+	// adminJobPollInterval 没有任务时的检查间隔
+	adminJobPollInterval = 2 * time.Second
+)
+
+// AdminJobConfig 后台批量任务配置
+type AdminJobConfig struct {
+	Threshold int // 账号数超过该值时转为后台任务
+	Rate      int // 每秒最多执行的步数（刷新为账号数，删除和移动为批数）
+}
+
+var (
+	adminJobConfig     AdminJobConfig
+	adminJobConfigOnce sync.Once
+
+	// adminJobRefresh 刷新单个账号的 Token，测试时替换
+	adminJobRefresh = RefreshAccountToken
+	// adminJobWake 创建任务后立即唤醒执行器
+	adminJobWake = make(chan struct{}, 1)
+)
+
+// GetAdminJobConfig 读取 ADMIN_JOB_THRESHOLD / ADMIN_JOB_RATE
+func GetAdminJobConfig() AdminJobConfig {
+	adminJobConfigOnce.Do(func() {
+		adminJobConfig = AdminJobConfig{
+			Threshold: envPositiveInt("ADMIN_JOB_THRESHOLD", 200),
+			Rate:      envPositiveInt("ADMIN_JOB_RATE", 5),
+		}
+	})
+	return adminJobConfig
+}
+
+// AdminJobError 单个账号的失败原因
+type AdminJobError struct {
+	AccountID uint   `json:"account_id"`
+	Message   string `json:"message"`
+}
+
+// AdminJobStatus 任务进度，供管理面板轮询
+type AdminJobStatus struct {
+	*model.AdminJob
+	Progress float64         `json:"progress"` // 0-1
+	Errors   []AdminJobError `json:"errors"`
+}
+
+func newAdminJobStatus(job *model.AdminJob) AdminJobStatus {
+	status := AdminJobStatus{AdminJob: job, Errors: []AdminJobError{}}
+	if job.Total > 0 {
+		status.Progress = float64(job.Processed) / float64(job.Total)
+	}
+	if job.Errors != "" {
+		json.Unmarshal([]byte(job.Errors), &status.Errors)
+	}
+	return status
+}
+
+// MoveStatusUpdates 账号移动到目标分类时需要更新的字段，分类无效时返回 false
+func MoveStatusUpdates(toStatus string) (map[string]interface{}, bool) {
+	updates := map[string]interface{}{
+		"status": toStatus,
+		// 兼容旧字段
+		"category": toStatus,
+	}
+
+	// 根据目标状态设置相应的标志
+	switch toStatus {
+	case "normal":
+		updates["is_active"] = true
+		updates["is_cooling"] = false
+		updates["error_count"] = 0
+		updates["ban_reason"] = ""
+	case "cooling":
+		updates["is_active"] = false
+		updates["is_cooling"] = true
+		updates["ban_reason"] = ""
+	case "disabled":
+		updates["is_active"] = false
+		updates["is_cooling"] = false
+		updates["ban_reason"] = ""
+	case "banned", "error":
+		updates["is_active"] = false
+		updates["is_cooling"] = false
+	default:
+		return nil, false
+	}
+	return updates, true
+}
+
+func newAdminJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "job_" + hex.EncodeToString(b)
+}
+
+// CreateAdminJob 保存账号快照并排队执行，fromStatus 不为空时执行时跳过已离开该分类的账号
+func CreateAdminJob(jobType string, accountIDs []uint, fromStatus, toStatus string) (*model.AdminJob, error) {
+	switch jobType {
+	case model.AdminJobRefreshToken, model.AdminJobDelete:
+	case model.AdminJobMove:
+		if _, ok := MoveStatusUpdates(toStatus); !ok {
+			return nil, fmt.Errorf("invalid to_status: %s", toStatus)
+		}
+	default:
+		return nil, fmt.Errorf("unknown job type: %s", jobType)
+	}
+	if len(accountIDs) == 0 {
+		return nil, fmt.Errorf("no accounts to process")
+	}
+
+	ids, err := json.Marshal(accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	job := &model.AdminJob{
+		ID:         newAdminJobID(),
+		Type:       jobType,
+		Status:     model.AdminJobQueued,
+		FromStatus: fromStatus,
+		ToStatus:   toStatus,
+		AccountIDs: string(ids),
+		Total:      len(accountIDs),
+	}
+	if err := database.GetDB().Create(job).Error; err != nil {
+		return nil, fmt.Errorf("保存后台任务失败: %w", err)
+	}
+	log.Printf("[AdminJob] 已创建任务 %s (%s)，共 %d 个账号", job.ID, jobType, job.Total)
+
+	select {
+	case adminJobWake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// GetAdminJob 获取任务进度
+func GetAdminJob(id string) (AdminJobStatus, error) {
+	var job model.AdminJob
+	if err := database.GetDB().Where("id = ?", id).First(&job).Error; err != nil {
+		return AdminJobStatus{}, ErrAdminJobNotFound
+	}
+	return newAdminJobStatus(&job), nil
+}
+
+// ListAdminJobs 返回最近的任务，未结束的在前
+func ListAdminJobs(limit int) ([]AdminJobStatus, error) {
+	var jobs []model.AdminJob
+	err := database.GetDB().Order("finished_at IS NOT NULL, created_at DESC").Limit(limit).Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AdminJobStatus, len(jobs))
+	for i := range jobs {
+		result[i] = newAdminJobStatus(&jobs[i])
+	}
+	return result, nil
+}
+
+// CancelAdminJob 取消任务，已处理的账号不回滚
+func CancelAdminJob(id string) (AdminJobStatus, error) {
+	db := database.GetDB()
+	result := db.Model(&model.AdminJob{}).Where("id = ? AND finished_at IS NULL", id).
+		Updates(map[string]interface{}{"status": model.AdminJobCancelled, "finished_at": time.Now()})
+	if result.Error != nil {
+		return AdminJobStatus{}, result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[AdminJob] 任务 %s 已取消", id)
+	}
+	return GetAdminJob(id)
+}
+
+// StartAdminJobRunner 启动后台任务执行器，同一时间只执行一个任务，启动时继续上次未完成的任务
+func StartAdminJobRunner() {
+	go func() {
+		interval := time.Second / time.Duration(GetAdminJobConfig().Rate)
+		for {
+			if !runNextAdminJob(interval) {
+				select {
+				case <-adminJobWake:
+				case <-time.After(adminJobPollInterval):
+				}
+			}
+		}
+	}()
+}
+
+// runNextAdminJob 执行最早的未完成任务，没有任务、数据库不可用或任务中途停止时返回 false
+func runNextAdminJob(interval time.Duration) bool {
+	// 数据库降级期间暂停，恢复后从已处理的位置继续
+	if !database.Healthy() {
+		return false
+	}
+	var job model.AdminJob
+	if err := database.GetDB().Where("finished_at IS NULL").Order("created_at").First(&job).Error; err != nil {
+		return false
+	}
+	return runAdminJob(&job, interval)
+}
+
+// runAdminJob 从 Processed 处继续执行任务，每步之间按 interval 限速，每步后保存进度
+// 任务结束（含已取消）时返回 true
+func runAdminJob(job *model.AdminJob, interval time.Duration) bool {
+	db := database.GetDB()
+	var ids []uint
+	if err := json.Unmarshal([]byte(job.AccountIDs), &ids); err != nil {
+		log.Printf("[AdminJob] 任务 %s 账号列表无效，已结束: %v", job.ID, err)
+		db.Model(job).Updates(map[string]interface{}{"status": model.AdminJobCompleted, "finished_at": time.Now()})
+		return true
+	}
+	if job.Status == model.AdminJobQueued {
+		db.Model(job).Update("status", model.AdminJobRunning)
+	} else if job.Processed > 0 {
+		log.Printf("[AdminJob] 继续任务 %s，已处理 %d/%d", job.ID, job.Processed, job.Total)
+	}
+
+	var errs []AdminJobError
+	if job.Errors != "" {
+		json.Unmarshal([]byte(job.Errors), &errs)
+	}
+
+	for job.Processed < len(ids) {
+		if !database.Healthy() {
+			return false
+		}
+		// 每步前确认任务未被取消
+		var status string
+		if err := db.Model(&model.AdminJob{}).Where("id = ?", job.ID).Select("status").Scan(&status).Error; err != nil {
+			return false
+		}
+		if status == model.AdminJobCancelled {
+			return true
+		}
+
+		step := 1
+		if job.Type != model.AdminJobRefreshToken {
+			step = adminJobChunk
+		}
+		end := job.Processed + step
+		if end > len(ids) {
+			end = len(ids)
+		}
+		succeeded, failures := runAdminJobStep(job, ids[job.Processed:end])
+		errs = append(errs, failures...)
+		if len(errs) > adminJobMaxErrors {
+			errs = errs[len(errs)-adminJobMaxErrors:]
+		}
+
+		job.Processed = end
+		job.Succeeded += succeeded
+		job.Failed += len(failures)
+		updates := map[string]interface{}{
+			"processed": job.Processed,
+			"succeeded": job.Succeeded,
+			"failed":    job.Failed,
+		}
+		if len(failures) > 0 {
+			data, _ := json.Marshal(errs)
+			updates["errors"] = string(data)
+		}
+		// 只更新未被取消的任务
+		if err := db.Model(&model.AdminJob{}).Where("id = ? AND finished_at IS NULL", job.ID).Updates(updates).Error; err != nil {
+			log.Printf("[WARN] [AdminJob] 保存任务 %s 进度失败: %v", job.ID, err)
+			return false
+		}
+
+		if job.Processed < len(ids) {
+			time.Sleep(interval)
+		}
+	}
+
+	db.Model(&model.AdminJob{}).Where("id = ? AND finished_at IS NULL", job.ID).
+		Updates(map[string]interface{}{"status": model.AdminJobCompleted, "finished_at": time.Now()})
+	log.Printf("[AdminJob] 任务 %s (%s) 完成: 成功 %d 个, 失败 %d 个", job.ID, job.Type, job.Succeeded, job.Failed)
+	if job.Type != model.AdminJobRefreshToken {
+		RefreshAccountPool()
+	}
+	return true
+}
+
+// runAdminJobStep 处理一批账号，返回成功数和失败记录
+func runAdminJobStep(job *model.AdminJob, ids []uint) (int, []AdminJobError) {
+	db := database.GetDB()
+	query := func() *gorm.DB {
+		q := db.Model(&model.Account{}).Where("id IN ?", ids)
+		if job.FromStatus != "" {
+			q = q.Where("status = ?", job.FromStatus)
+		}
+		return q
+	}
+
+	switch job.Type {
+	case model.AdminJobDelete:
+		deleted, _, err := DeleteAccounts(ids, job.FromStatus)
+		if err != nil {
+			return 0, chunkErrors(ids, err)
+		}
+		return int(deleted), nil
+	case model.AdminJobMove:
+		updates, _ := MoveStatusUpdates(job.ToStatus)
+		result := query().Updates(updates)
+		if result.Error != nil {
+			return 0, chunkErrors(ids, result.Error)
+		}
+		return int(result.RowsAffected), nil
+	}
+
+	var account model.Account
+	if err := query().First(&account).Error; err != nil {
+		// 账号已删除或已离开原分类，跳过
+		return 0, nil
+	}
+	if err := adminJobRefresh(&account); err != nil {
+		msg := fmt.Sprintf("刷新失败: %v", err)
+		if lockoutErr, ok := err.(*AccountLockoutError); ok {
+			msg = fmt.Sprintf("账号被锁定已自动标记为封禁: %s", lockoutErr.Body)
+		}
+		log.Printf("[AdminJob] 任务 %s 账号 %s (ID:%d) %s", job.ID, account.ClientID, account.ID, msg)
+		return 0, []AdminJobError{{AccountID: account.ID, Message: msg}}
+	}
+	return 1, nil
+}
+
+// chunkErrors 整批失败时每个账号各记一条
+func chunkErrors(ids []uint, err error) []AdminJobError {
+	failures := make([]AdminJobError, len(ids))
+	for i, id := range ids {
+		failures[i] = AdminJobError{AccountID: id, Message: err.Error()}
+	}
+	return failures
+}
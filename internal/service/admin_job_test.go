@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+func setupAdminJobTest(t *testing.T, statuses ...string) []uint {
+	t.Helper()
+	initTestDB(t, "jobs.db")
+	ids := make([]uint, len(statuses))
+	for i, status := range statuses {
+		acc := model.Account{ClientID: "client-" + string(rune('a'+i)), Status: status}
+		if err := database.GetDB().Create(&acc).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = acc.ID
+	}
+	return ids
+}
+
+func storedAccountStatuses(t *testing.T) map[uint]string {
+	t.Helper()
+	var accounts []model.Account
+	database.GetDB().Find(&accounts)
+	result := make(map[uint]string, len(accounts))
+	for _, acc := range accounts {
+		result[acc.ID] = acc.Status
+	}
+	return result
+}
+
+func TestAdminJobMoveSkipsAccountsThatLeftSourceStatus(t *testing.T) {
+	ids := setupAdminJobTest(t, "cooling", "cooling", "cooling")
+	job, err := CreateAdminJob(model.AdminJobMove, ids, "cooling", "normal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 创建后、执行前被移走的账号不受影响
+	database.GetDB().Model(&model.Account{}).Where("id = ?", ids[1]).Update("status", "banned")
+
+	if !runNextAdminJob(0) {
+		t.Fatal("job should finish")
+	}
+	status, err := GetAdminJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != model.AdminJobCompleted || status.Processed != 3 || status.Succeeded != 2 || status.Progress != 1 {
+		t.Errorf("job = %+v", status.AdminJob)
+	}
+	got := storedAccountStatuses(t)
+	if got[ids[0]] != "normal" || got[ids[1]] != "banned" || got[ids[2]] != "normal" {
+		t.Errorf("statuses = %v", got)
+	}
+	if runNextAdminJob(0) {
+		t.Error("no job should be left")
+	}
+}
+
+func TestAdminJobRefreshResumesAndRecordsFailures(t *testing.T) {
+	ids := setupAdminJobTest(t, "normal", "normal", "normal", "normal")
+	var refreshed []uint
+	defer func(orig func(*model.Account) error) { adminJobRefresh = orig }(adminJobRefresh)
+	adminJobRefresh = func(acc *model.Account) error {
+		refreshed = append(refreshed, acc.ID)
+		if acc.ID == ids[3] {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	job, err := CreateAdminJob(model.AdminJobRefreshToken, ids, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟重启前已处理了前两个账号
+	database.GetDB().Model(job).Updates(map[string]interface{}{"status": model.AdminJobRunning, "processed": 2, "succeeded": 2})
+
+	if !runNextAdminJob(0) {
+		t.Fatal("job should finish")
+	}
+	if len(refreshed) != 2 || refreshed[0] != ids[2] || refreshed[1] != ids[3] {
+		t.Errorf("refreshed = %v, want only the remaining accounts", refreshed)
+	}
+	status, _ := GetAdminJob(job.ID)
+	if status.Succeeded != 3 || status.Failed != 1 || len(status.Errors) != 1 || status.Errors[0].AccountID != ids[3] {
+		t.Errorf("job = %+v, errors = %+v", status.AdminJob, status.Errors)
+	}
+}
+
+func TestAdminJobCancel(t *testing.T) {
+	ids := setupAdminJobTest(t, "error", "error")
+	job, err := CreateAdminJob(model.AdminJobDelete, ids, "error", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := CancelAdminJob(job.ID)
+	if err != nil || status.Status != model.AdminJobCancelled || status.FinishedAt == nil {
+		t.Fatalf("cancel = %+v, %v", status.AdminJob, err)
+	}
+	if runNextAdminJob(0) {
+		t.Error("cancelled job should not run")
+	}
+	if got := storedAccountStatuses(t); len(got) != 2 {
+		t.Errorf("accounts deleted after cancel: %v", got)
+	}
+	if _, err := CancelAdminJob("missing"); !errors.Is(err, ErrAdminJobNotFound) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCreateAdminJobValidates(t *testing.T) {
+	setupAdminJobTest(t)
+	if _, err := CreateAdminJob(model.AdminJobMove, []uint{1}, "", "unknown"); err == nil {
+		t.Error("invalid to_status should be rejected")
+	}
+	if _, err := CreateAdminJob(model.AdminJobDelete, nil, "", ""); err == nil {
+		t.Error("empty job should be rejected")
+	}
+}
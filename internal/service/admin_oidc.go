@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcHTTPTimeout 请求 OIDC 服务商（发现文档、换取 token）的超时
+const oidcHTTPTimeout = 15 * time.Second
+
+// OIDCConfig 管理面板的外部登录配置
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // 为空时按请求的域名生成 /api/admin/oidc/callback
+	Scopes       []string
+	GroupsClaim  string
+	AdminEmails  []string // 邮箱或 @域名
+	ViewerEmails []string
+	AdminGroups  []string
+	ViewerGroups []string
+}
+
+// Enabled 配置了 OIDC_ISSUER 和 OIDC_CLIENT_ID 时启用
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// OIDCIdentity id_token 中与角色映射有关的声明
+type OIDCIdentity struct {
+	Email  string
+	Groups []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+var (
+	oidcConfig     OIDCConfig
+	oidcConfigOnce sync.Once
+
+	oidcDiscoveryMu    sync.Mutex
+	oidcDiscoveryCache = make(map[string]*oidcDiscovery)
+
+	oidcHTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+)
+
+// envList 读取逗号分隔的环境变量，去掉空项
+func envList(name string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// GetOIDCConfig 读取 OIDC_* 环境变量
+func GetOIDCConfig() OIDCConfig {
+	oidcConfigOnce.Do(func() {
+		oidcConfig = OIDCConfig{
+			Issuer:       strings.TrimRight(strings.TrimSpace(os.Getenv("OIDC_ISSUER")), "/"),
+			ClientID:     strings.TrimSpace(os.Getenv("OIDC_CLIENT_ID")),
+			ClientSecret: strings.TrimSpace(os.Getenv("OIDC_CLIENT_SECRET")),
+			RedirectURL:  strings.TrimSpace(os.Getenv("OIDC_REDIRECT_URL")),
+			Scopes:       envList("OIDC_SCOPES"),
+			GroupsClaim:  strings.TrimSpace(os.Getenv("OIDC_GROUPS_CLAIM")),
+			AdminEmails:  envList("OIDC_ADMIN_EMAILS"),
+			ViewerEmails: envList("OIDC_VIEWER_EMAILS"),
+			AdminGroups:  envList("OIDC_ADMIN_GROUPS"),
+			ViewerGroups: envList("OIDC_VIEWER_GROUPS"),
+		}
+		if len(oidcConfig.Scopes) == 0 {
+			oidcConfig.Scopes = []string{"openid", "email", "profile"}
+		}
+		if oidcConfig.GroupsClaim == "" {
+			oidcConfig.GroupsClaim = "groups"
+		}
+	})
+	return oidcConfig
+}
+
+// discoverOIDC 读取并缓存服务商的 /.well-known/openid-configuration
+func discoverOIDC(ctx context.Context, issuer string) (*oidcDiscovery, error) {
+	oidcDiscoveryMu.Lock()
+	defer oidcDiscoveryMu.Unlock()
+	if d, ok := oidcDiscoveryCache[issuer]; ok {
+		return d, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery failed with status %d", resp.StatusCode)
+	}
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("invalid oidc discovery document: %w", err)
+	}
+	if d.Issuer != issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" {
+		return nil, fmt.Errorf("oidc discovery document does not match issuer %s", issuer)
+	}
+	oidcDiscoveryCache[issuer] = &d
+	return &d, nil
+}
+
+// OIDCAuthURL 生成跳转到服务商登录页的地址（授权码模式 + PKCE）
+func OIDCAuthURL(ctx context.Context, cfg OIDCConfig, redirectURL, state, nonce, codeChallenge string) (string, error) {
+	d, err := discoverOIDC(ctx, cfg.Issuer)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// ExchangeOIDCCode 用授权码换取 id_token 并校验 iss、aud、exp 和 nonce
+// id_token 直接从 token 端点经 TLS 取得，按 OIDC Core 3.1.3.7 以 TLS 校验来源，不再校验签名
+func ExchangeOIDCCode(ctx context.Context, cfg OIDCConfig, code, redirectURL, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	d, err := discoverOIDC(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status %d", resp.StatusCode)
+	}
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil || tokenResp.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return parseOIDCIDToken(cfg, d.Issuer, tokenResp.IDToken, nonce, time.Now())
+}
+
+// parseOIDCIDToken 解析 id_token 的声明并校验
+func parseOIDCIDToken(cfg OIDCConfig, issuer, idToken, nonce string, now time.Time) (*OIDCIdentity, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid id_token format")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.New("invalid id_token payload")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, errors.New("invalid id_token payload")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return nil, fmt.Errorf("id_token issuer %q does not match", iss)
+	}
+	if !claimContains(claims["aud"], cfg.ClientID) {
+		return nil, errors.New("id_token audience does not match client id")
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) <= now.Unix() {
+		return nil, errors.New("id_token has expired")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	email, _ := claims["email"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, errors.New("email is not verified")
+	}
+	identity := &OIDCIdentity{Email: strings.ToLower(email)}
+	if groups, ok := claims[cfg.GroupsClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// claimContains aud 可以是字符串或字符串数组
+func claimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		for _, item := range v {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OIDCRole 按邮箱和组映射管理角色，admin 优先；都不匹配时不允许登录
+func OIDCRole(cfg OIDCConfig, identity *OIDCIdentity) (string, bool) {
+	if oidcMatches(cfg.AdminEmails, cfg.AdminGroups, identity) {
+		return AdminRoleAdmin, true
+	}
+	if oidcMatches(cfg.ViewerEmails, cfg.ViewerGroups, identity) {
+		return AdminRoleViewer, true
+	}
+	return "", false
+}
+
+func oidcMatches(emails, groups []string, identity *OIDCIdentity) bool {
+	if identity.Email != "" {
+		for _, e := range emails {
+			e = strings.ToLower(e)
+			if e == identity.Email || (strings.HasPrefix(e, "@") && strings.HasSuffix(identity.Email, e)) {
+				return true
+			}
+		}
+	}
+	for _, g := range groups {
+		for _, have := range identity.Groups {
+			if g == have {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeIDToken(claims map[string]interface{}) string {
+	payload, _ := json.Marshal(claims)
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	var issuer string
+	claims := map[string]interface{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/authorize",
+				"token_endpoint":         issuer + "/token",
+			})
+		case "/token":
+			r.ParseForm()
+			if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") != "verifier" || r.Form.Get("client_secret") != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"id_token": fakeIDToken(claims)})
+		}
+	}))
+	defer srv.Close()
+	issuer = srv.URL
+
+	cfg := OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     "panel",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "email"},
+		GroupsClaim:  "groups",
+		AdminEmails:  []string{"ops@example.com"},
+		ViewerEmails: []string{"@example.com"},
+		AdminGroups:  []string{"gateway-admins"},
+	}
+	ctx := context.Background()
+
+	authURL, err := OIDCAuthURL(ctx, cfg, "https://gw/cb", "st", "n1", "challenge")
+	if err != nil || !strings.HasPrefix(authURL, issuer+"/authorize?") || !strings.Contains(authURL, "nonce=n1") {
+		t.Fatalf("auth url = %s, %v", authURL, err)
+	}
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": issuer, "aud": []interface{}{"panel"}, "exp": float64(time.Now().Add(time.Hour).Unix()),
+			"nonce": "n1", "email": "Dev@Example.com", "email_verified": true,
+		}
+	}
+
+	claims = valid()
+	identity, err := ExchangeOIDCCode(ctx, cfg, "good-code", "https://gw/cb", "verifier", "n1")
+	if err != nil || identity.Email != "dev@example.com" {
+		t.Fatalf("identity = %+v, %v", identity, err)
+	}
+	if role, ok := OIDCRole(cfg, identity); !ok || role != AdminRoleViewer {
+		t.Errorf("domain match role = %q, %v", role, ok)
+	}
+	if role, _ := OIDCRole(cfg, &OIDCIdentity{Email: "x@other.com", Groups: []string{"gateway-admins"}}); role != AdminRoleAdmin {
+		t.Errorf("group match role = %q", role)
+	}
+	if _, ok := OIDCRole(cfg, &OIDCIdentity{Email: "x@other.com"}); ok {
+		t.Error("unmapped identity should be rejected")
+	}
+
+	if _, err := ExchangeOIDCCode(ctx, cfg, "good-code", "https://gw/cb", "verifier", "other-nonce"); err == nil {
+		t.Error("nonce mismatch should be rejected")
+	}
+	claims = valid()
+	claims["aud"] = "someone-else"
+	if _, err := ExchangeOIDCCode(ctx, cfg, "good-code", "https://gw/cb", "verifier", "n1"); err == nil {
+		t.Error("audience mismatch should be rejected")
+	}
+	claims = valid()
+	claims["email_verified"] = false
+	if _, err := ExchangeOIDCCode(ctx, cfg, "good-code", "https://gw/cb", "verifier", "n1"); err == nil {
+		t.Error("unverified email should be rejected")
+	}
+	if _, err := ExchangeOIDCCode(ctx, cfg, "bad-code", "https://gw/cb", "verifier", "n1"); err == nil {
+		t.Error("failed token exchange should be rejected")
+	}
+}
+
+func TestAdminSessionToken(t *testing.T) {
+	now := time.Now()
+	token, err := IssueAdminSession(AdminRoleViewer, "dev@example.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, ok := VerifyAdminSession(token, now)
+	if !ok || session.Role != AdminRoleViewer || session.Email != "dev@example.com" {
+		t.Fatalf("session = %+v, %v", session, ok)
+	}
+	if _, ok := VerifyAdminSession(token, now.Add(GetAdminSessionTTL())); ok {
+		t.Error("expired session accepted")
+	}
+
+	// 篡改角色后签名不再匹配
+	payload, _ := json.Marshal(AdminSession{Role: AdminRoleAdmin, Email: "dev@example.com", ExpiresAt: now.Add(time.Hour).Unix()})
+	sig := token[strings.LastIndex(token, ".")+1:]
+	forged := adminSessionPrefix + base64.RawURLEncoding.EncodeToString(payload) + "." + sig
+	if _, ok := VerifyAdminSession(forged, now); ok {
+		t.Error("forged session accepted")
+	}
+	if _, err := IssueAdminSession("owner", "", now); err == nil {
+		t.Error("unknown role should be rejected")
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 管理面板的角色，与 ADMIN_PASSWORD / ADMIN_VIEWER_PASSWORD 对应
+const (
+	AdminRoleAdmin  = "admin"
+	AdminRoleViewer = "viewer"
+)
+
+// adminSessionPrefix 会话令牌的前缀，便于与管理密码区分
+const adminSessionPrefix = "zs."
+
+// AdminSession 外部登录（OIDC）后签发的管理会话
+type AdminSession struct {
+	Role      string `json:"role"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var (
+	adminSessionSecret     []byte
+	adminSessionSecretOnce sync.Once
+)
+
+// getAdminSessionSecret 读取 ADMIN_SESSION_SECRET，未配置时每次启动随机生成（重启后需重新登录）
+func getAdminSessionSecret() []byte {
+	adminSessionSecretOnce.Do(func() {
+		if secret := os.Getenv("ADMIN_SESSION_SECRET"); secret != "" {
+			adminSessionSecret = []byte(secret)
+			return
+		}
+		adminSessionSecret = make([]byte, 32)
+		rand.Read(adminSessionSecret)
+	})
+	return adminSessionSecret
+}
+
+// GetAdminSessionTTL 读取 ADMIN_SESSION_TTL（秒），默认 12 小时
+func GetAdminSessionTTL() time.Duration {
+	return time.Duration(envPositiveInt("ADMIN_SESSION_TTL", 12*3600)) * time.Second
+}
+
+func signAdminSession(payload string) string {
+	mac := hmac.New(sha256.New, getAdminSessionSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueAdminSession 签发管理会话令牌，可像管理密码一样放在 Authorization / X-Admin-Password 中使用
+func IssueAdminSession(role, email string, now time.Time) (string, error) {
+	if role != AdminRoleAdmin && role != AdminRoleViewer {
+		return "", fmt.Errorf("unknown admin role: %s", role)
+	}
+	raw, err := json.Marshal(AdminSession{Role: role, Email: email, ExpiresAt: now.Add(GetAdminSessionTTL()).Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return adminSessionPrefix + payload + "." + signAdminSession(payload), nil
+}
+
+// VerifyAdminSession 校验会话令牌的签名和有效期
+func VerifyAdminSession(token string, now time.Time) (*AdminSession, bool) {
+	rest, ok := strings.CutPrefix(token, adminSessionPrefix)
+	if !ok {
+		return nil, false
+	}
+	payload, sig, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signAdminSession(payload))) {
+		return nil, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+	var session AdminSession
+	if json.Unmarshal(raw, &session) != nil || now.Unix() >= session.ExpiresAt {
+		return nil, false
+	}
+	return &session, true
+}
@@ -8,12 +8,15 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/classifier"
 	"zencoder2api/internal/service/provider"
 )
 
@@ -125,16 +128,37 @@ func logRequestDetails(prefix string, headers http.Header, body []byte) {
 	log.Printf("%s", sanitizeRequestBody(body))
 }
 
-const AnthropicBaseURL = "https://api.zencoder.ai/anthropic"
+var AnthropicBaseURL = DefaultUpstreamBase + "/anthropic"
 
-type AnthropicService struct{}
+type AnthropicService struct {
+	deps Dependencies
+}
 
 func NewAnthropicService() *AnthropicService {
-	return &AnthropicService{}
+	return NewAnthropicServiceWithDeps(DefaultDependencies())
+}
+
+// NewAnthropicServiceWithDeps 使用指定依赖创建服务，便于替换号池和上游
+func NewAnthropicServiceWithDeps(deps Dependencies) *AnthropicService {
+	return &AnthropicService{deps: deps.withDefaults()}
 }
 
 // Messages 处理/v1/messages请求，直接透传到Anthropic API
+// 校验 tools 定义，注入 API Key 的系统提示词模板，按设置补充/覆盖 service_tier、截断过大的 tool_result，并从响应中记录实际使用的 tier（OpenAI 桥接同样经过这里）
 func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream bool) (*http.Response, error) {
+	body, err := applyToolValidation(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	body = applyToolResultLimit(ctx, applyServiceTier(ctx, applySystemPromptTemplate(ctx, body)))
+	resp, err := s.messages(ctx, body, isStream)
+	if resp != nil && resp.Body != nil {
+		resp.Body = newServiceTierSniffer(ctx, resp.Body)
+	}
+	return resp, err
+}
+
+func (s *AnthropicService) messages(ctx context.Context, body []byte, isStream bool) (*http.Response, error) {
 	var req struct {
 		Model     string                 `json:"model"`
 		MaxTokens float64                `json:"max_tokens,omitempty"`
@@ -183,6 +207,13 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 		}
 	}
 
+	// 客户端明确关闭 thinking 时按 THINKING_DISABLE_POLICY 决定是否改用非 thinking 模型
+	resolvedModel, err := resolveThinkingDisabled(req.Model, req.Thinking)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = resolvedModel
+
 	// 检查模型是否存在于模型字典中
 	exists := EnsureModelAvailable(req.Model)
 	if !exists {
@@ -217,21 +248,34 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 		}
 	}
 
+	cacheKey := anthropicCacheKey(req.Model, body)
+	policy := GetRetryPolicy("anthropic")
+	budget := newLatencyBudget(ctx)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
-		account, err := GetNextAccountForModel(req.Model)
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.acquireAccount(ctx, req.Model, cacheKey, i)
 		if err != nil {
 			DebugLogRequestEnd(ctx, "Anthropic", false, err)
 			return nil, err
 		}
 		DebugLogAccountSelected(ctx, "Anthropic", account.ID, account.Email)
 
-		resp, err := s.doRequest(ctx, account, req.Model, body)
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doRequest(attemptCtx, account, req.Model, body))
+		RecordUpstreamResult(ctx, req.Model, account.ID, start, resp, err)
 		if err != nil {
 			// 请求失败，释放账号
-			ReleaseAccount(account)
+			s.deps.Accounts.ReleaseAccount(account)
 			// MarkAccountError(account)
 			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "Anthropic", false, err)
+				return nil, err
+			}
 			DebugLogRetry(ctx, "Anthropic", i+1, account.ID, err)
 			continue
 		}
@@ -283,33 +327,16 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 						} `json:"error"`
 					}
 
-					isKnownError := false
-					isPromptTooLongError := false
 					if err := json.Unmarshal(errBody, &errResp); err == nil && errResp.Error.Type != "" {
 						// 检查是否是已知的错误类型
-						knownErrors := []string{
-							"prompt is too long",
-							"max_tokens",
-							"invalid_request_error",
-							"authentication_error",
-							"permission_error",
-							"rate_limit_error",
-						}
-
-						errorMessage := strings.ToLower(errResp.Error.Message)
-						for _, known := range knownErrors {
-							if strings.Contains(errorMessage, known) || errResp.Error.Type == known {
-								isKnownError = true
-								if known == "prompt is too long" || strings.Contains(errorMessage, "prompt is too long") {
-									isPromptTooLongError = true
-								}
-								break
-							}
-						}
+						class := classifier.Classify(resp.StatusCode, errBody)
+						isPromptTooLongError := class == classifier.PromptTooLong
 
-						if isKnownError {
+						if class != classifier.Unknown {
 							// 已知错误，只输出简单日志，包含请求模型ID和thinking状态
-							log.Printf("[Anthropic] 400错误: %s - %s (Model: %s, Thinking: %s)", errResp.Error.Type, errResp.Error.Message, req.Model, thinkingStatus)
+							LogEvent(ctx, slog.LevelWarn, "Anthropic", "400错误", logAccountID(account.ID), slog.Int("status", resp.StatusCode),
+								slog.String("error_type", errResp.Error.Type), slog.String("error", errResp.Error.Message),
+								slog.String("model", req.Model), slog.String("thinking", thinkingStatus))
 
 							// 对于非"prompt is too long"错误，在DEBUG模式下输出详细信息
 							if !isPromptTooLongError && IsDebugMode() {
@@ -319,7 +346,8 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 							}
 						} else {
 							// 未知错误，输出详细日志用于调试，包含请求模型ID和thinking状态
-							log.Printf("[Anthropic] 400未知错误: %s (Model: %s, Thinking: %s)", string(errBody), req.Model, thinkingStatus)
+							LogEvent(ctx, slog.LevelWarn, "Anthropic", "400未知错误", logAccountID(account.ID), slog.Int("status", resp.StatusCode),
+								slog.String("body", string(errBody)), slog.String("model", req.Model), slog.String("thinking", thinkingStatus))
 							if IsDebugMode() {
 								// DEBUG模式下输出原始请求信息
 								if originalHeaders, ok := ctx.Value("originalHeaders").(http.Header); ok {
@@ -329,7 +357,8 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 						}
 					} else {
 						// 解析失败，输出完整错误用于调试，包含请求模型ID和thinking状态
-						log.Printf("[Anthropic] 400错误（无法解析）: %s (Model: %s, Thinking: %s)", string(errBody), req.Model, thinkingStatus)
+						LogEvent(ctx, slog.LevelWarn, "Anthropic", "400错误（无法解析）", logAccountID(account.ID), slog.Int("status", resp.StatusCode),
+							slog.String("body", string(errBody)), slog.String("model", req.Model), slog.String("thinking", thinkingStatus))
 						if IsDebugMode() {
 							// DEBUG模式下输出原始请求信息
 							if originalHeaders, ok := ctx.Value("originalHeaders").(http.Header); ok {
@@ -339,35 +368,36 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 					}
 				} else if resp.StatusCode == 429 {
 					// 简化429错误日志输出
-					s.classifyAndLog429Error(string(errBody), account.ID, account.Email)
+					s.logRateLimitError(ctx, errBody, account.ID, account.Email)
 
-					// 检查是否是Claude官方的429错误
-					isClaudeOfficialError := s.isClaudeOfficial429Error(string(errBody))
+					// 按部署策略决定是否向客户端透传429原始响应
+					passThrough := s.shouldPassThrough429(ctx, string(errBody), account.ID)
 
 					// 尝试使用代理池重试
 					proxyResp, proxyErr := s.retryWithProxy(ctx, account, req.Model, body)
 					if proxyErr == nil && proxyResp != nil {
 						// 代理重试成功
-						ReleaseAccount(account)
+						s.deps.Accounts.ReleaseAccount(account)
 						return proxyResp, nil
 					}
 
 					if proxyErr != nil {
-						log.Printf("[Anthropic] 代理重试失败 账号ID:%d %s", account.ID, account.Email)
+						LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理重试失败", logAccountID(account.ID), slog.String("email", account.Email),
+							slog.Int("status", resp.StatusCode), logError(proxyErr))
 					}
 
-					// 只有Claude官方的429错误才返回原始响应，其他429错误返回通用错误
-					if isClaudeOfficialError {
-						// Claude官方429错误，返回原始响应
-						ReleaseAccount(account)
+					// 按策略透传的429返回原始响应，其他429错误返回通用错误
+					if passThrough {
+						// 透传原始429响应
+						s.deps.Accounts.ReleaseAccount(account)
 						return &http.Response{
 							StatusCode: resp.StatusCode,
 							Header:     resp.Header,
 							Body:       io.NopCloser(bytes.NewReader(errBody)),
 						}, nil
 					} else {
-						// 非Claude官方429错误，不返回原始响应，继续重试其他账号
-						ReleaseAccount(account)
+						// 不透传的429错误，不返回原始响应，继续重试其他账号
+						s.deps.Accounts.ReleaseAccount(account)
 						lastErr = fmt.Errorf("non-official 429 error")
 						if IsDebugMode() {
 							DebugLogRetry(ctx, "Anthropic", i+1, account.ID, lastErr)
@@ -379,7 +409,7 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 				// 1. 释放账号
 				// 2. 不计算账号错误次数
 				// 3. 直接返回原始响应
-				ReleaseAccount(account)
+				s.deps.Accounts.ReleaseAccount(account)
 				return &http.Response{
 					StatusCode: resp.StatusCode,
 					Header:     resp.Header,
@@ -390,40 +420,37 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 			// 503和529错误：上游API错误，不是token问题
 			if resp.StatusCode == 503 || resp.StatusCode == 529 {
 				// 只记录简单的错误日志
-				log.Printf("错误响应 [%d]: %s", resp.StatusCode, string(errBody))
+				LogEvent(ctx, slog.LevelWarn, "Anthropic", "上游错误响应", logAccountID(account.ID), slog.Int("status", resp.StatusCode),
+					slog.String("body", string(errBody)))
 				// 释放账号，不计算错误次数，返回通用错误
-				ReleaseAccount(account)
+				s.deps.Accounts.ReleaseAccount(account)
 				return nil, ErrNoAvailableAccount
 			}
 
 			// 500错误处理
 			if resp.StatusCode == 500 {
 				// 检查是否是限速问题
-				if strings.Contains(string(errBody), "Rate limit tracking problem") {
-					log.Printf("[Anthropic] 限速跟踪问题，尝试使用代理重试")
+				if classifier.IsRateLimitTracking(string(errBody)) {
+					LogEvent(ctx, slog.LevelWarn, "Anthropic", "限速跟踪问题，尝试使用代理重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode))
 
 					// 尝试使用代理池重试
 					proxyResp, proxyErr := s.retryWithProxy(ctx, account, req.Model, body)
 					if proxyErr == nil && proxyResp != nil {
 						// 代理重试成功
-						ReleaseAccount(account)
+						s.deps.Accounts.ReleaseAccount(account)
 						return proxyResp, nil
 					}
 
-					log.Printf("[Anthropic] 代理重试失败: %v", proxyErr)
+					LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理重试失败", logAccountID(account.ID), slog.Int("status", resp.StatusCode), logError(proxyErr))
 
 					// 代理重试失败，继续原有逻辑：冻结账号5-10秒随机时间
-					freezeTime := 5 + rand.Intn(6) // 5-10秒随机
+					freezeTime := int(policy.FreezeDuration() / time.Second) // 默认5-10秒随机
 
-					// 非调试模式下只输出简单信息
-					if !IsDebugMode() {
-						log.Printf("[Anthropic] 限速错误，冻结账号 ID:%d %s %d秒，重试 #%d", account.ID, account.Email, freezeTime, i+1)
-					} else {
-						log.Printf("[Anthropic] 检测到限速错误，冻结账号 ID:%d %s %d秒", account.ID, account.Email, freezeTime)
-					}
+					LogEvent(ctx, slog.LevelWarn, "Anthropic", "限速错误，冻结账号", logAccountID(account.ID), slog.String("email", account.Email),
+						slog.Int("freeze_seconds", freezeTime), slog.Int("attempt", i+1))
 
 					// 冻结账号并释放（不计算错误次数，这是临时限速问题）
-					FreezeAccount(account, time.Duration(freezeTime)*time.Second) // 这个函数内部会释放账号
+					s.deps.Accounts.FreezeAccount(account, time.Duration(freezeTime)*time.Second) // 这个函数内部会释放账号
 
 					// 设置错误并继续重试其他账号
 					lastErr = fmt.Errorf("rate limit tracking problem")
@@ -436,7 +463,7 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 				}
 
 				// 其他500错误，释放账号并直接返回
-				ReleaseAccount(account)
+				s.deps.Accounts.ReleaseAccount(account)
 				return &http.Response{
 					StatusCode: resp.StatusCode,
 					Header:     resp.Header,
@@ -445,7 +472,7 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 			}
 
 			// 其他错误，释放账号并继续重试
-			ReleaseAccount(account)
+			s.deps.Accounts.ReleaseAccount(account)
 			// MarkAccountError(account)
 			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
 
@@ -455,22 +482,25 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 				DebugLogRetry(ctx, "Anthropic", i+1, account.ID, lastErr)
 			} else {
 				// 非调试模式下只输出简单的重试信息
-				log.Printf("[Anthropic] API错误 %d，重试 #%d", resp.StatusCode, i+1)
+				LogEvent(ctx, slog.LevelWarn, "Anthropic", "API错误，重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode), slog.Int("attempt", i+1))
 			}
 			continue
 		}
 
 		// 请求成功，释放账号
-		ReleaseAccount(account)
+		s.deps.Accounts.ReleaseAccount(account)
+		if cacheKey != "" {
+			cacheAffinity.remember(cacheKey, account.ID, time.Now())
+		}
 
-		ResetAccountError(account)
+		s.deps.Accounts.ResetAccountError(account)
 		zenModel, exists := model.GetZenModel(req.Model)
 		if !exists {
 			// 模型不存在，使用默认倍率
-			UpdateAccountCreditsFromResponse(account, resp, 1.0)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, 1.0)
 		} else {
 			// 使用统一的积分更新函数，自动处理响应头中的积分信息
-			UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
 		}
 
 		DebugLogRequestEnd(ctx, "Anthropic", true, nil)
@@ -482,24 +512,10 @@ func (s *AnthropicService) Messages(ctx context.Context, body []byte, isStream b
 		DebugLogRequestEnd(ctx, "Anthropic", false, lastErr)
 	} else {
 		// 非调试模式下只输出简单的失败信息
-		log.Printf("[Anthropic] 所有重试失败: %v", lastErr)
-	}
-
-	// 检查是否是网络连接错误，如果是则返回统一的错误信息，避免暴露内部网络详情
-	if lastErr != nil {
-		errStr := lastErr.Error()
-		// 检查常见的网络连接错误
-		if strings.Contains(errStr, "dial tcp") ||
-			strings.Contains(errStr, "connection refused") ||
-			strings.Contains(errStr, "no such host") ||
-			strings.Contains(errStr, "cannot assign requested address") ||
-			strings.Contains(errStr, "timeout") ||
-			strings.Contains(errStr, "network is unreachable") {
-			return nil, ErrNoAvailableAccount
-		}
+		LogEvent(ctx, slog.LevelWarn, "Anthropic", "所有重试失败", slog.String("model", req.Model), logError(lastErr))
 	}
 
-	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
 }
 
 func (s *AnthropicService) doRequest(ctx context.Context, account *model.Account, modelID string, body []byte) (*http.Response, error) {
@@ -518,6 +534,7 @@ func (s *AnthropicService) doRequest(ctx context.Context, account *model.Account
 	if err != nil {
 		return nil, fmt.Errorf("failed to ensure thinking config: %w", err)
 	}
+	modifiedBody = capThinkingBudget(ctx, modifiedBody)
 
 	// 根据模型要求调整参数（温度、top_p等）
 	modifiedBody, err = s.adjustParametersForModel(modifiedBody, modelID)
@@ -545,12 +562,12 @@ func (s *AnthropicService) doRequest(ctx context.Context, account *model.Account
 			errorBody := string(bodyBytes)
 
 			// 检查是否是thinking格式错误，但不再进行模型切换
-			if s.isThinkingFormatError(errorBody) {
+			if classifier.IsThinkingFormat(errorBody) {
 				log.Printf("[Anthropic] thinking格式错误: %s", errorBody)
 			}
 
 			// 检查是否是thinking signature过期错误
-			if s.isThinkingSignatureError(errorBody) {
+			if classifier.IsThinkingSignature(errorBody) {
 				// 解析当前请求的模型和thinking状态
 				var reqInfo struct {
 					Model string `json:"model"`
@@ -581,12 +598,12 @@ func (s *AnthropicService) doRequest(ctx context.Context, account *model.Account
 				if fixErr == nil {
 					return s.makeRequest(ctx, fixedBody, account, zenModel)
 				} else {
-					log.Printf("[Anthropic] 转换assistant消息失败: %v", fixErr)
+					log.Printf("[WARN] [Anthropic] 转换assistant消息失败: %v", fixErr)
 				}
 			}
 
 			// 检查是否是参数冲突错误（temperature 和 top_p 不能同时指定）
-			if s.isParameterConflictError(errorBody) {
+			if classifier.IsParameterConflict(errorBody) {
 				DebugLogRequestSent(ctx, "Anthropic", "Retrying with only temperature parameter")
 
 				// 移除 top_p 参数，只保留 temperature
@@ -597,7 +614,7 @@ func (s *AnthropicService) doRequest(ctx context.Context, account *model.Account
 			}
 
 			// 检查是否是温度参数错误
-			if s.isTemperatureError(errorBody) {
+			if classifier.IsTemperature(errorBody) {
 				DebugLogRequestSent(ctx, "Anthropic", "Retrying with temperature=1.0")
 
 				// 强制设置温度为1.0并重试
@@ -621,7 +638,7 @@ func (s *AnthropicService) doRequest(ctx context.Context, account *model.Account
 }
 
 func (s *AnthropicService) makeRequest(ctx context.Context, body []byte, account *model.Account, zenModel model.ZenModel) (*http.Response, error) {
-	httpReq, err := http.NewRequest("POST", AnthropicBaseURL+"/v1/messages", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(upstreamContext(ctx), "POST", AnthropicBaseURL+"/v1/messages", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -638,6 +655,8 @@ func (s *AnthropicService) makeRequest(ctx context.Context, body []byte, account
 			httpReq.Header.Set(k, v)
 		}
 	}
+	// 追加客户端请求的 beta 功能（如 prompt 缓存）
+	applyAnthropicBeta(ctx, httpReq)
 
 	// 只在非限速测试且调试模式下记录请求头
 	if IsDebugMode() {
@@ -650,7 +669,7 @@ func (s *AnthropicService) makeRequest(ctx context.Context, body []byte, account
 		}
 	}
 
-	httpClient := provider.NewHTTPClient(account.Proxy, 0)
+	httpClient := s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel)
 	resp, err := httpClient.Do(httpReq)
 	if err != nil {
 		return nil, err
@@ -658,180 +677,117 @@ func (s *AnthropicService) makeRequest(ctx context.Context, body []byte, account
 
 	// 不输出响应头调试信息以减少日志量
 
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+
+	// 读取错误响应内容，每个上游错误响应在这里分类并计入命中次数
+	errBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	class := classifier.Observe(resp.StatusCode, errBody)
+
 	// 如果是400错误，记录详细的请求信息
 	if resp.StatusCode == 400 {
-		// 读取错误响应内容
-		errBody, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		// 检查是否是"prompt is too long"错误
-		isPromptTooLongError := false
-		// 检查是否是thinking格式错误（将在doRequest中处理并重试）
-		isThinkingFormatError := false
-		// 检查是否是thinking signature过期错误（将在doRequest中处理并重试）
-		isThinkingSignatureError := false
 		var errResp struct {
 			Error struct {
 				Type    string `json:"type"`
 				Message string `json:"message"`
 			} `json:"error"`
 		}
-
-		if err := json.Unmarshal(errBody, &errResp); err == nil {
-			errorMessage := strings.ToLower(errResp.Error.Message)
-			if strings.Contains(errorMessage, "prompt is too long") {
-				isPromptTooLongError = true
-				// 对于prompt过长错误，只输出简单的错误信息
-				log.Printf("[Anthropic] 400错误: %s - %s", errResp.Error.Type, errResp.Error.Message)
-			}
-			// 检查是否是thinking格式错误
-			if strings.Contains(errResp.Error.Message, "When `thinking` is enabled") ||
-				strings.Contains(errResp.Error.Message, "Expected `thinking` or `redacted_thinking`") {
-				isThinkingFormatError = true
-				// 输出详细的thinking格式错误信息
-				log.Printf("[Anthropic] thinking格式错误详情: %s", errResp.Error.Message)
-				log.Printf("[Anthropic] 发送给zencoder的请求体:")
-				log.Printf("%s", sanitizeRequestBody(body))
-			}
-			// 检查是否是thinking signature过期错误
-			if strings.Contains(errResp.Error.Message, "Invalid `signature` in `thinking` block") {
-				isThinkingSignatureError = true
-				// 对于thinking signature过期错误，只输出简单信息，详细处理留给doRequest
+		json.Unmarshal(errBody, &errResp)
+
+		switch class {
+		case classifier.PromptTooLong:
+			// 对于prompt过长错误，只输出简单的错误信息
+			log.Printf("[Anthropic] 400错误: %s - %s", errResp.Error.Type, errResp.Error.Message)
+		case classifier.ThinkingFormat:
+			// 输出详细的thinking格式错误信息
+			log.Printf("[Anthropic] thinking格式错误详情: %s", errResp.Error.Message)
+			log.Printf("[Anthropic] 发送给zencoder的请求体:")
+			log.Printf("%s", sanitizeRequestBody(body))
+		case classifier.ThinkingSignature:
+			// thinking signature错误只在调试模式下输出简单信息，详细处理留给doRequest
+			if IsDebugMode() {
+				log.Printf("[Anthropic] API返回400错误: %s", string(errBody))
+				logRequestDetails("[Anthropic] 实际API", httpReq.Header, body)
 			}
-		}
-
-		// 只在非调试模式且非已知可重试错误时才输出详细debug信息
-		// thinking相关错误会在doRequest中处理，如果重试成功就不需要输出debug日志
-		shouldOutputDetails := !isPromptTooLongError && !isThinkingFormatError && !isThinkingSignatureError
-		if shouldOutputDetails {
+		default:
+			// 非已知可重试错误才输出详细debug信息
+			// thinking相关错误会在doRequest中处理，如果重试成功就不需要输出debug日志
 			log.Printf("[Anthropic] API返回400错误: %s", string(errBody))
 			// 只在调试模式下输出详细的请求信息
 			if IsDebugMode() {
 				logRequestDetails("[Anthropic] 实际API", httpReq.Header, body)
 			}
-		} else if isThinkingSignatureError && IsDebugMode() {
-			// thinking signature错误只在调试模式下输出简单信息
-			log.Printf("[Anthropic] API返回400错误: %s", string(errBody))
-			logRequestDetails("[Anthropic] 实际API", httpReq.Header, body)
 		}
-
-		// 重新构建响应，因为body已经被读取
-		resp.Body = io.NopCloser(bytes.NewReader(errBody))
 	}
 
+	// 重新构建响应，因为body已经被读取
+	resp.Body = io.NopCloser(bytes.NewReader(errBody))
 	return resp, nil
 }
 
-// isThinkingFormatError 检查是否是thinking格式相关的错误
-func (s *AnthropicService) isThinkingFormatError(errorBody string) bool {
-	return strings.Contains(errorBody, "When `thinking` is enabled, a final `assistant` message must start with a thinking block") ||
-		strings.Contains(errorBody, "Expected `thinking` or `redacted_thinking`") ||
-		strings.Contains(errorBody, "To avoid this requirement, disable `thinking`")
-}
+// 429透传策略
+const (
+	RateLimitPolicyHeuristic = "heuristic" // 仅透传判断为Claude官方的429
+	RateLimitPolicyPass      = "pass"      // 总是透传原始429
+	RateLimitPolicyHide      = "hide"      // 总是隐藏，返回通用错误
+)
 
-// isThinkingSignatureError 检查是否是thinking signature过期错误
-func (s *AnthropicService) isThinkingSignatureError(errorBody string) bool {
-	return strings.Contains(errorBody, "Invalid `signature` in `thinking` block") ||
-		strings.Contains(errorBody, "invalid_request_error") && strings.Contains(errorBody, "signature")
-}
+var (
+	rateLimitPolicy     string
+	rateLimitPolicyOnce sync.Once
+)
 
-// isTemperatureError 检查是否是温度参数相关的错误
-func (s *AnthropicService) isTemperatureError(errorBody string) bool {
-	return strings.Contains(errorBody, "requires temperature=1.0") ||
-		strings.Contains(errorBody, "Parallel Thinking' requires temperature")
+// GetRateLimitPolicy 读取 ANTHROPIC_429_POLICY，未配置或无效时使用 heuristic
+func GetRateLimitPolicy() string {
+	rateLimitPolicyOnce.Do(func() {
+		policy := strings.ToLower(strings.TrimSpace(os.Getenv("ANTHROPIC_429_POLICY")))
+		switch policy {
+		case RateLimitPolicyPass, RateLimitPolicyHide, RateLimitPolicyHeuristic:
+			rateLimitPolicy = policy
+		default:
+			if policy != "" {
+				log.Printf("[WARN] 无效的 ANTHROPIC_429_POLICY: %s，使用 heuristic", policy)
+			}
+			rateLimitPolicy = RateLimitPolicyHeuristic
+		}
+	})
+	return rateLimitPolicy
 }
 
-// isParameterConflictError 检查是否是参数冲突错误
-func (s *AnthropicService) isParameterConflictError(errorBody string) bool {
-	return strings.Contains(errorBody, "`temperature` and `top_p` cannot both be specified")
+// shouldPassThrough429 根据部署策略决定是否透传429
+func (s *AnthropicService) shouldPassThrough429(ctx context.Context, errorBody string, accountID uint) bool {
+	policy := GetRateLimitPolicy()
+	pass := s.passThrough429ForPolicy(policy, errorBody)
+	LogEvent(ctx, slog.LevelInfo, "Anthropic", "429透传决策", logAccountID(accountID), slog.String("policy", policy), slog.Bool("pass_through", pass))
+	return pass
 }
 
-// isClaudeOfficial429Error 检查是否是Claude官方的429限流错误
-func (s *AnthropicService) isClaudeOfficial429Error(errorBody string) bool {
-	// 尝试解析错误响应
-	var errResp struct {
-		Type  string `json:"type"`
-		Error struct {
-			Type    string `json:"type"`
-			Message string `json:"message"`
-		} `json:"error"`
-		RequestID string `json:"request_id"`
-	}
-
-	// 如果能解析成功且符合Claude官方格式
-	if err := json.Unmarshal([]byte(errorBody), &errResp); err == nil {
-		// Claude官方错误特征：
-		// 1. type = "error"
-		// 2. error.type = "rate_limit_error"
-		// 3. 错误消息包含anthropic.com或claude.com域名
-		if errResp.Type == "error" &&
-			errResp.Error.Type == "rate_limit_error" &&
-			(strings.Contains(errResp.Error.Message, "anthropic.com") ||
-				strings.Contains(errResp.Error.Message, "claude.com") ||
-				strings.Contains(errResp.Error.Message, "docs.claude.com")) {
-			return true
-		}
-	}
-
-	// 检查是否是非Claude官方的错误格式（如Google API格式）
-	var nonClaudeErr struct {
-		Error struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-			Status  string `json:"status"`
-		} `json:"error"`
-	}
-
-	if err := json.Unmarshal([]byte(errorBody), &nonClaudeErr); err == nil {
-		// 非Claude官方错误特征：有code和status字段
-		if nonClaudeErr.Error.Code == 429 &&
-			nonClaudeErr.Error.Status == "RESOURCE_EXHAUSTED" {
-			return false
-		}
+// passThrough429ForPolicy 按指定策略判断429是否透传
+func (s *AnthropicService) passThrough429ForPolicy(policy, errorBody string) bool {
+	switch policy {
+	case RateLimitPolicyPass:
+		return true
+	case RateLimitPolicyHide:
+		return false
+	default:
+		return classifier.IsOfficialRateLimit(errorBody)
 	}
-
-	// 默认情况下，如果无法确定，保守处理：不返回原始响应
-	return false
 }
 
-// classifyAndLog429Error 分类并记录429错误的简化日志
-func (s *AnthropicService) classifyAndLog429Error(errorBody string, accountID uint, email string) {
-	// 尝试解析Claude官方错误
-	var claudeErr struct {
-		Type  string `json:"type"`
-		Error struct {
-			Type    string `json:"type"`
-			Message string `json:"message"`
-		} `json:"error"`
-	}
-
-	if err := json.Unmarshal([]byte(errorBody), &claudeErr); err == nil {
-		if claudeErr.Type == "error" && claudeErr.Error.Type == "rate_limit_error" {
-			// Claude官方限流错误
-			log.Printf("[Anthropic] Claude rate_limit_error 账号ID:%d %s", accountID, email)
-			return
-		}
-	}
-
-	// 尝试解析GCP错误
-	var gcpErr struct {
-		Error struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-			Status  string `json:"status"`
-		} `json:"error"`
-	}
-
-	if err := json.Unmarshal([]byte(errorBody), &gcpErr); err == nil {
-		if gcpErr.Error.Code == 429 && gcpErr.Error.Status == "RESOURCE_EXHAUSTED" {
-			// GCP限流错误
-			log.Printf("[Anthropic] GCP RESOURCE_EXHAUSTED 账号ID:%d %s", accountID, email)
-			return
-		}
-	}
-
-	// 其他未识别的429错误
-	log.Printf("[Anthropic] 429限流错误 账号ID:%d %s", accountID, email)
+// logRateLimitError 按分类记录429错误的简化日志
+func (s *AnthropicService) logRateLimitError(ctx context.Context, errorBody []byte, accountID uint, email string) {
+	msg := "429限流错误"
+	switch classifier.Classify(http.StatusTooManyRequests, errorBody) {
+	case classifier.OfficialRateLimit, classifier.ClaudeRateLimit:
+		// Claude官方限流错误
+		msg = "Claude rate_limit_error"
+	case classifier.GCPRateLimit:
+		// GCP限流错误
+		msg = "GCP RESOURCE_EXHAUSTED"
+	}
+	LogEvent(ctx, slog.LevelWarn, "Anthropic", msg, logAccountID(accountID), slog.String("email", email), slog.Int("status", http.StatusTooManyRequests))
 }
 
 // MessagesProxy 直接代理请求和响应
@@ -847,8 +803,34 @@ func (s *AnthropicService) MessagesProxy(ctx context.Context, w http.ResponseWri
 	if err != nil {
 		return err
 	}
+	if req.Stream && resp.StatusCode < 400 {
+		// 思考过长时中断并以较小预算重试一次
+		if resp, err = s.guardThinkingStream(ctx, w, resp, body, req.Model); err != nil {
+			return err
+		}
+	}
 	defer resp.Body.Close()
 
+	// 透传的上游错误统一为 Anthropic 错误对象
+	if resp.StatusCode >= 400 {
+		normalizeAnthropicErrorResponse(resp, time.Now())
+		return CopyResponse(ctx, w, resp)
+	}
+
+	if req.Stream {
+		// 上游在流开头中断时换号续传
+		resp.Body = s.withStreamFailover(ctx, resp.Body, body, req.Model)
+	}
+
+	// 记录实际输入 token 数，流式响应从 message_start 事件中读取
+	resp.Body = observeInputTokens(resp.Body, req.Model, req.Stream)
+	if req.Stream {
+		// 估算已输出 token 的积分，超过 STREAM_CREDIT_CAP 时中断
+		resp.Body = trackStreamCost(resp.Body, req.Model, StreamProtocolAnthropic)
+		// 按 STREAM_PACING_* 及按模型、Key 的规则平滑输出文本增量
+		resp.Body = paceStream(ctx, resp.Body, req.Model, StreamProtocolAnthropic)
+	}
+
 	// 判断是否需要过滤thinking内容
 	// 规则：如果用户调用的是非thinking版本，但平台强制开启了thinking，则需要过滤
 	needsFiltering := false
@@ -867,30 +849,23 @@ func (s *AnthropicService) MessagesProxy(ctx context.Context, w http.ResponseWri
 
 	if needsFiltering {
 		if req.Stream {
-			return s.streamFilteredResponse(w, resp)
+			return s.streamFilteredResponse(ctx, w, resp)
 		}
-		return s.handleNonStreamFilteredResponse(w, resp)
+		return s.handleNonStreamFilteredResponse(ctx, w, resp)
 	}
 
-	return StreamResponse(w, resp)
+	return StreamResponse(ctx, w, resp)
 }
 
-func (s *AnthropicService) handleNonStreamFilteredResponse(w http.ResponseWriter, resp *http.Response) error {
+func (s *AnthropicService) handleNonStreamFilteredResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response) error {
 	// 读取全部响应体
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 
-	// 复制响应头
-	for k, v := range resp.Header {
-		// 过滤掉 Content-Length 和 Content-Encoding
-		if k != "Content-Length" && k != "Content-Encoding" {
-			for _, vv := range v {
-				w.Header().Add(k, vv)
-			}
-		}
-	}
+	// 复制响应头，过滤掉 Content-Length 和 Content-Encoding
+	copyUpstreamHeaders(ctx, w.Header(), resp.Header, "Content-Length", "Content-Encoding")
 	w.WriteHeader(resp.StatusCode)
 
 	// 尝试解析响应
@@ -1046,7 +1021,7 @@ func (s *AnthropicService) ensureThinkingConfig(body []byte, modelID string) ([]
 					if role, ok := msgMap["role"].(string); ok && role == "assistant" {
 						// 转换thinking内容为text并改变角色为user
 						if err := s.convertAssistantToUserMessage(msgMap); err != nil {
-							log.Printf("[Anthropic] 转换assistant消息为user消息失败: %v", err)
+							log.Printf("[WARN] [Anthropic] 转换assistant消息为user消息失败: %v", err)
 						}
 					}
 					messages[i] = msgMap
@@ -1136,10 +1111,15 @@ func (s *AnthropicService) convertThinkingToText(msgMap map[string]interface{})
 				if blockType == "thinking" || blockType == "redacted_thinking" {
 					// 将thinking块转换为text块
 					if thinkingText, ok := blockMap["thinking"].(string); ok {
-						newContent = append(newContent, map[string]interface{}{
+						newBlock := map[string]interface{}{
 							"type": "text",
 							"text": "[thinking] " + thinkingText,
-						})
+						}
+						// 保留缓存控制信息，避免缓存断点丢失
+						if cacheControl, ok := blockMap["cache_control"]; ok {
+							newBlock["cache_control"] = cacheControl
+						}
+						newContent = append(newContent, newBlock)
 					}
 				} else {
 					// 保留其他类型的块
@@ -1262,13 +1242,13 @@ func (s *AnthropicService) convertAssistantMessagesToUser(body []byte) ([]byte,
 					if role == "assistant" {
 						// 转换assistant消息为user消息
 						if err := s.convertAssistantToUserMessage(msgMap); err != nil {
-							log.Printf("[Anthropic] 转换第%d个assistant消息失败: %v", i, err)
+							log.Printf("[WARN] [Anthropic] 转换第%d个assistant消息失败: %v", i, err)
 							continue
 						}
 					} else if role == "user" {
 						// 对于user消息，也要确保tool_result被正确处理
 						if err := s.convertToolBlocksToText(msgMap); err != nil {
-							log.Printf("[Anthropic] 转换第%d个user消息中的工具块失败: %v", i, err)
+							log.Printf("[WARN] [Anthropic] 转换第%d个user消息中的工具块失败: %v", i, err)
 							continue
 						}
 					}
@@ -1379,23 +1359,21 @@ func (s *AnthropicService) adjustParametersForModel(body []byte, modelID string)
 	return s.adjustTemperatureForModel(body, modelID)
 }
 
-func (s *AnthropicService) streamFilteredResponse(w http.ResponseWriter, resp *http.Response) error {
+func (s *AnthropicService) streamFilteredResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response) error {
 	// 复制响应头
-	for k, v := range resp.Header {
-		if k != "Content-Encoding" && k != "Content-Length" {
-			for _, vv := range v {
-				w.Header().Add(k, vv)
-			}
-		}
-	}
+	copyUpstreamHeaders(ctx, w.Header(), resp.Header, "Content-Encoding", "Content-Length")
 	w.WriteHeader(resp.StatusCode)
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	if _, ok := w.(http.Flusher); !ok {
 		_, err := io.Copy(w, resp.Body)
+		if capErr, ok := err.(*StreamCreditCapError); ok {
+			_, err = io.WriteString(w, capErr.Event())
+		}
 		return err
 	}
 
+	sse := NewSSEWriter(ctx, w)
+	defer sse.KeepAlive()()
 	reader := bufio.NewReader(resp.Body)
 	isThinking := false // 标记当前是否处于 thinking block 中
 
@@ -1405,13 +1383,17 @@ func (s *AnthropicService) streamFilteredResponse(w http.ResponseWriter, resp *h
 			if err == io.EOF {
 				return nil
 			}
-			return err
+			return endStreamOnCreditCap(sse, err)
 		}
 
 		trimmedLine := strings.TrimSpace(line)
 		if trimmedLine == "" {
-			fmt.Fprintf(w, "\n")
-			flusher.Flush()
+			if err := sse.Printf("\n"); err != nil {
+				return err
+			}
+			if err := sse.Flush(); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -1419,7 +1401,7 @@ func (s *AnthropicService) streamFilteredResponse(w http.ResponseWriter, resp *h
 			// 读取下一行 data
 			dataLine, err := reader.ReadString('\n')
 			if err != nil {
-				return err
+				return endStreamOnCreditCap(sse, err)
 			}
 
 			// 解析 event 类型
@@ -1453,14 +1435,21 @@ func (s *AnthropicService) streamFilteredResponse(w http.ResponseWriter, resp *h
 			}
 
 			if !shouldFilter {
-				fmt.Fprint(w, line)     // event: ...
-				fmt.Fprint(w, dataLine) // data: ...
-				flusher.Flush()
+				if err := sse.Printf("%s%s", line, dataLine); err != nil { // event: ... / data: ...
+					return err
+				}
+				if err := sse.Flush(); err != nil {
+					return err
+				}
 			}
 		} else {
 			// 其他格式（如 ping），直接透传
-			fmt.Fprint(w, line)
-			flusher.Flush()
+			if err := sse.Printf("%s", line); err != nil {
+				return err
+			}
+			if err := sse.Flush(); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -1476,37 +1465,39 @@ func (s *AnthropicService) retryWithProxy(ctx context.Context, account *model.Ac
 	// 预处理请求体 - 确保包含所需的thinking配置和参数调整
 	processedBody, err := s.preprocessRequestBody(body, modelID, zenModel)
 	if err != nil {
-		log.Printf("[Anthropic] 代理重试请求体预处理失败: %v", err)
+		LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理重试请求体预处理失败", logAccountID(account.ID), logError(err))
 		// 如果预处理失败，使用原始body
 		processedBody = body
 	}
+	processedBody = capThinkingBudget(ctx, processedBody)
 
 	proxyPool := provider.GetProxyPool()
-	if !proxyPool.HasProxies() {
-		return nil, fmt.Errorf("没有可用的代理")
+	region := accountProxyRegion(proxyPool, account)
+	if !proxyPool.HasProxiesInRegion(region) {
+		return nil, regionProxyError(region)
 	}
 
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		// 获取随机代理
-		proxyURL := proxyPool.GetRandomProxy()
-		if proxyURL == "" {
+		// 获取随机代理，账号固定了地区时只在该地区内选择
+		proxyURL := proxyPool.GetRandomProxyInRegion(region)
+		if proxyURL == "" || !proxyHealthy(proxyURL) {
 			continue
 		}
 
-		log.Printf("[Anthropic] 尝试代理 %s (重试 %d/%d)", proxyURL, i+1, maxRetries)
+		LogEvent(ctx, slog.LevelInfo, "Anthropic", "尝试代理", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("attempt", i+1), slog.Int("max_attempts", maxRetries))
 
 		// 创建使用代理的HTTP客户端
-		proxyClient, err := provider.NewHTTPClientWithProxy(proxyURL, 0)
+		proxyClient, err := s.deps.Upstream.ProxyClient(proxyURL, zenModel)
 		if err != nil {
-			log.Printf("[Anthropic] 创建代理客户端失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Anthropic", "创建代理客户端失败", slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
 		// 创建新请求
 		httpReq, err := http.NewRequest("POST", AnthropicBaseURL+"/v1/messages", bytes.NewReader(processedBody))
 		if err != nil {
-			log.Printf("[Anthropic] 创建请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Anthropic", "创建请求失败", logError(err))
 			continue
 		}
 
@@ -1520,6 +1511,7 @@ func (s *AnthropicService) retryWithProxy(ctx context.Context, account *model.Ac
 				httpReq.Header.Set(k, v)
 			}
 		}
+		applyAnthropicBeta(ctx, httpReq)
 
 		// 只在非限速测试且调试模式下记录代理请求详情
 		var reqCheck struct {
@@ -1533,7 +1525,7 @@ func (s *AnthropicService) retryWithProxy(ctx context.Context, account *model.Ac
 		// 执行请求
 		resp, err := proxyClient.Do(httpReq)
 		if err != nil {
-			log.Printf("[Anthropic] 代理请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理请求失败", logAccountID(account.ID), slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
@@ -1541,7 +1533,7 @@ func (s *AnthropicService) retryWithProxy(ctx context.Context, account *model.Ac
 		if resp.StatusCode == 429 {
 			// 仍然是429，尝试下一个代理
 			resp.Body.Close()
-			log.Printf("[Anthropic] 代理 %s 仍返回429，尝试下一个", proxyURL)
+			LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理仍返回429，尝试下一个", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode))
 			continue
 		}
 
@@ -1568,12 +1560,13 @@ func (s *AnthropicService) retryWithProxy(ctx context.Context, account *model.Ac
 				}
 			}
 
-			log.Printf("[Anthropic] 代理 %s 返回错误 %d: %s (Model: %s, Thinking: %s)", proxyURL, resp.StatusCode, string(errBody), modelID, thinkingStatus)
+			LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理返回错误", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode),
+				slog.String("body", string(errBody)), slog.String("model", modelID), slog.String("thinking", thinkingStatus))
 			continue
 		}
 
 		// 成功
-		log.Printf("[Anthropic] 代理 %s 请求成功", proxyURL)
+		LogEvent(ctx, slog.LevelInfo, "Anthropic", "代理请求成功", logAccountID(account.ID), slog.String("proxy", proxyURL))
 		return resp, nil
 	}
 
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// defaultAnthropicBetaPassthrough 未配置 ANTHROPIC_BETA_PASSTHROUGH 时转发的 beta 功能：prompt 缓存及其 1 小时 TTL
+var defaultAnthropicBetaPassthrough = []string{"prompt-caching-2024-07-31", "extended-cache-ttl-2025-04-11"}
+
+const anthropicBetaContextKey contextKey = "anthropic_beta"
+
+// AnthropicBetaSettings 客户端 anthropic-beta 请求头中允许转发给上游的 beta 功能
+type AnthropicBetaSettings struct {
+	Passthrough []string `json:"passthrough"` // 包含 * 时全部转发，为空时不转发
+}
+
+var (
+	anthropicBetaMu       sync.RWMutex
+	anthropicBetaSettings AnthropicBetaSettings
+	anthropicBetaOnce     sync.Once
+)
+
+// loadAnthropicBetaSettings 读取 ANTHROPIC_BETA_PASSTHROUGH，none 表示不转发
+func loadAnthropicBetaSettings() {
+	list := envList("ANTHROPIC_BETA_PASSTHROUGH")
+	switch {
+	case len(list) == 0:
+		list = append([]string(nil), defaultAnthropicBetaPassthrough...)
+	case len(list) == 1 && strings.EqualFold(list[0], "none"):
+		list = []string{}
+	}
+	anthropicBetaSettings = AnthropicBetaSettings{Passthrough: list}
+}
+
+// GetAnthropicBetaSettings 获取允许转发的 beta 功能
+func GetAnthropicBetaSettings() AnthropicBetaSettings {
+	anthropicBetaOnce.Do(loadAnthropicBetaSettings)
+	anthropicBetaMu.RLock()
+	defer anthropicBetaMu.RUnlock()
+	return AnthropicBetaSettings{Passthrough: append([]string{}, anthropicBetaSettings.Passthrough...)}
+}
+
+// SetAnthropicBetaSettings 运行时修改允许转发的 beta 功能（仅内存生效）
+func SetAnthropicBetaSettings(settings AnthropicBetaSettings) error {
+	list := make([]string, 0, len(settings.Passthrough))
+	for _, beta := range settings.Passthrough {
+		beta = strings.TrimSpace(beta)
+		if beta == "" {
+			continue
+		}
+		if strings.ContainsAny(beta, ", ") {
+			return fmt.Errorf("passthrough 中的每一项只能是一个 beta 名称: %q", beta)
+		}
+		list = append(list, beta)
+	}
+	anthropicBetaOnce.Do(loadAnthropicBetaSettings)
+	anthropicBetaMu.Lock()
+	defer anthropicBetaMu.Unlock()
+	anthropicBetaSettings = AnthropicBetaSettings{Passthrough: list}
+	return nil
+}
+
+// WithAnthropicBeta 把客户端的 anthropic-beta 请求头写入 context，发往上游时按允许列表转发
+func WithAnthropicBeta(ctx context.Context, values []string) context.Context {
+	if len(values) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, anthropicBetaContextKey, values)
+}
+
+// applyAnthropicBeta 把客户端请求的、允许转发的 beta 功能追加到上游请求的 anthropic-beta 头（模型配置的值保留在前面）
+func applyAnthropicBeta(ctx context.Context, req *http.Request) {
+	values, _ := ctx.Value(anthropicBetaContextKey).([]string)
+	if len(values) == 0 {
+		return
+	}
+	allowed := GetAnthropicBetaSettings().Passthrough
+	if len(allowed) == 0 {
+		return
+	}
+
+	var betas []string
+	seen := make(map[string]bool)
+	add := func(beta string) {
+		if beta = strings.TrimSpace(beta); beta != "" && !seen[beta] {
+			seen[beta] = true
+			betas = append(betas, beta)
+		}
+	}
+	for _, beta := range strings.Split(req.Header.Get("anthropic-beta"), ",") {
+		add(beta)
+	}
+	for _, value := range values {
+		for _, beta := range strings.Split(value, ",") {
+			if anthropicBetaAllowed(allowed, strings.TrimSpace(beta)) {
+				add(beta)
+			}
+		}
+	}
+	if len(betas) > 0 {
+		req.Header.Set("anthropic-beta", strings.Join(betas, ","))
+	}
+}
+
+func anthropicBetaAllowed(allowed []string, beta string) bool {
+	for _, a := range allowed {
+		if a == "*" || a == beta {
+			return true
+		}
+	}
+	return false
+}
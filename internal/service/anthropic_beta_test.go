@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestApplyAnthropicBeta(t *testing.T) {
+	defer SetAnthropicBetaSettings(AnthropicBetaSettings{Passthrough: defaultAnthropicBetaPassthrough})
+
+	apply := func(modelBeta string, client ...string) string {
+		req, _ := http.NewRequest("POST", "http://upstream", nil)
+		if modelBeta != "" {
+			req.Header.Set("anthropic-beta", modelBeta)
+		}
+		applyAnthropicBeta(WithAnthropicBeta(context.Background(), client), req)
+		return req.Header.Get("anthropic-beta")
+	}
+
+	SetAnthropicBetaSettings(AnthropicBetaSettings{Passthrough: defaultAnthropicBetaPassthrough})
+	if got := apply("interleaved-thinking-2025-05-14", "prompt-caching-2024-07-31, files-api-2025-04-14", "interleaved-thinking-2025-05-14"); got != "interleaved-thinking-2025-05-14,prompt-caching-2024-07-31" {
+		t.Errorf("merged = %q", got)
+	}
+	if got := apply("", "files-api-2025-04-14"); got != "" {
+		t.Errorf("disallowed beta forwarded: %q", got)
+	}
+	if got := apply("interleaved-thinking-2025-05-14"); got != "interleaved-thinking-2025-05-14" {
+		t.Errorf("model beta changed: %q", got)
+	}
+
+	SetAnthropicBetaSettings(AnthropicBetaSettings{Passthrough: []string{"*"}})
+	if got := apply("", "files-api-2025-04-14"); got != "files-api-2025-04-14" {
+		t.Errorf("wildcard = %q", got)
+	}
+
+	if err := SetAnthropicBetaSettings(AnthropicBetaSettings{Passthrough: []string{"a,b"}}); err == nil {
+		t.Error("comma separated item accepted")
+	}
+}
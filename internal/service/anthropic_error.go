@@ -0,0 +1,103 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnthropicErrorType 按 HTTP 状态码返回 Anthropic 原生的错误类型
+func AnthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusPaymentRequired:
+		return "billing_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		if status >= 400 && status < 500 {
+			return "invalid_request_error"
+		}
+		return "api_error"
+	}
+}
+
+// AnthropicErrorBody 构造 Anthropic 原生格式的错误对象
+func AnthropicErrorBody(errType, message string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	})
+	return body
+}
+
+// isAnthropicErrorBody 判断响应体是否已经是 {"type":"error","error":{"type":...,"message":...}}
+func isAnthropicErrorBody(body []byte) bool {
+	var e struct {
+		Type  string `json:"type"`
+		Error *struct {
+			Type    string  `json:"type"`
+			Message *string `json:"message"`
+		} `json:"error"`
+	}
+	return json.Unmarshal(body, &e) == nil && e.Type == "error" && e.Error != nil && e.Error.Type != "" && e.Error.Message != nil
+}
+
+// quotaRetryAfter 积分耗尽导致的 429 按 Zen-Pricing-Period-End 计算重试等待秒数，未知时返回 0
+func quotaRetryAfter(resp *http.Response, now time.Time) int {
+	if ClassifyUpstreamError(resp, nil) != UpstreamErrorQuota {
+		return 0
+	}
+	end, err := time.Parse(time.RFC3339, resp.Header.Get("Zen-Pricing-Period-End"))
+	if err != nil || !end.After(now) {
+		return 0
+	}
+	return int((end.Sub(now) + time.Second - 1) / time.Second)
+}
+
+// normalizeAnthropicErrorResponse 把透传给客户端的上游错误响应统一为 Anthropic 错误对象，
+// 429 没有 Retry-After 但已知积分刷新时间时补上
+func normalizeAnthropicErrorResponse(resp *http.Response, now time.Time) {
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !isAnthropicErrorBody(body) {
+		message := strings.TrimSpace(string(body))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		body = AnthropicErrorBody(AnthropicErrorType(resp.StatusCode), message)
+	}
+	header := resp.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	header.Set("Content-Type", "application/json")
+	if resp.StatusCode == http.StatusTooManyRequests && header.Get("Retry-After") == "" {
+		if seconds := quotaRetryAfter(resp, now); seconds > 0 {
+			header.Set("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+	resp.Header = header
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// AnthropicModelInfo Anthropic /v1/models 中的单个模型
+type AnthropicModelInfo struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// AnthropicModelList Anthropic /v1/models 响应
+type AnthropicModelList struct {
+	Data    []AnthropicModelInfo `json:"data"`
+	HasMore bool                 `json:"has_more"`
+	FirstID *string              `json:"first_id"`
+	LastID  *string              `json:"last_id"`
+}
+
+// 分页参数默认值与上限，与 Anthropic 官方一致
+const (
+	AnthropicModelsDefaultLimit = 20
+	AnthropicModelsMaxLimit     = 1000
+)
+
+// modelDatePattern Claude 模型名末尾的发布日期，如 claude-sonnet-4-5-20250929
+var modelDatePattern = regexp.MustCompile(`-(\d{8})(?:-|$)`)
+
+// modelCreatedAt 从模型名中解析发布日期，解析不到时返回零值时间
+func modelCreatedAt(modelName string) time.Time {
+	m := modelDatePattern.FindStringSubmatch(modelName)
+	if m == nil {
+		return time.Unix(0, 0).UTC()
+	}
+	t, err := time.Parse("20060102", m[1])
+	if err != nil {
+		return time.Unix(0, 0).UTC()
+	}
+	return t
+}
+
+// anthropicModels 返回所有 anthropic 服务商的模型，按发布日期从新到旧排列
+func anthropicModels() []AnthropicModelInfo {
+	var data []AnthropicModelInfo
+	for _, id := range model.ListZenModelIDs() {
+		zenModel, ok := model.GetZenModel(id)
+		if !ok || zenModel.ProviderID != "anthropic" {
+			continue
+		}
+		data = append(data, AnthropicModelInfo{
+			Type:        "model",
+			ID:          id,
+			DisplayName: zenModel.DisplayName,
+			CreatedAt:   modelCreatedAt(id).Format(time.RFC3339),
+		})
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		if data[i].CreatedAt != data[j].CreatedAt {
+			return data[i].CreatedAt > data[j].CreatedAt
+		}
+		return data[i].ID < data[j].ID
+	})
+	return data
+}
+
+// ListAnthropicModels 以 Anthropic 格式列出模型，支持 before_id / after_id 分页
+// 游标不存在时返回空列表
+func ListAnthropicModels(limit int, beforeID, afterID string) AnthropicModelList {
+	if limit <= 0 {
+		limit = AnthropicModelsDefaultLimit
+	}
+	if limit > AnthropicModelsMaxLimit {
+		limit = AnthropicModelsMaxLimit
+	}
+
+	all := anthropicModels()
+	start, end := 0, len(all)
+	if afterID != "" {
+		start = len(all)
+		for i, m := range all {
+			if m.ID == afterID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	if beforeID != "" {
+		end = 0
+		for i, m := range all {
+			if m.ID == beforeID {
+				end = i
+				break
+			}
+		}
+	}
+	if start > end {
+		start = end
+	}
+
+	page := all[start:end]
+	hasMore := false
+	if len(page) > limit {
+		hasMore = true
+		if beforeID != "" && afterID == "" {
+			// 向前翻页时取紧邻游标的一页
+			page = page[len(page)-limit:]
+		} else {
+			page = page[:limit]
+		}
+	}
+
+	result := AnthropicModelList{Data: page, HasMore: hasMore}
+	if result.Data == nil {
+		result.Data = []AnthropicModelInfo{}
+	}
+	if len(page) > 0 {
+		result.FirstID = &page[0].ID
+		result.LastID = &page[len(page)-1].ID
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestAnthropicModelsOnlyAnthropicNewestFirst(t *testing.T) {
+	list := ListAnthropicModels(AnthropicModelsMaxLimit, "", "")
+	if len(list.Data) == 0 || list.HasMore {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+	for i, m := range list.Data {
+		zenModel, ok := model.GetZenModel(m.ID)
+		if !ok || zenModel.ProviderID != "anthropic" || m.Type != "model" {
+			t.Errorf("unexpected entry %+v", m)
+		}
+		if i > 0 && m.CreatedAt > list.Data[i-1].CreatedAt {
+			t.Errorf("not sorted newest first at %d: %s after %s", i, m.CreatedAt, list.Data[i-1].CreatedAt)
+		}
+	}
+	if *list.FirstID != list.Data[0].ID || *list.LastID != list.Data[len(list.Data)-1].ID {
+		t.Errorf("first/last id mismatch: %s %s", *list.FirstID, *list.LastID)
+	}
+}
+
+func TestAnthropicModelsPagination(t *testing.T) {
+	all := ListAnthropicModels(AnthropicModelsMaxLimit, "", "").Data
+	if len(all) < 3 {
+		t.Skip("need at least 3 anthropic models")
+	}
+
+	first := ListAnthropicModels(2, "", "")
+	if len(first.Data) != 2 || !first.HasMore {
+		t.Fatalf("first page = %+v", first)
+	}
+	next := ListAnthropicModels(2, "", *first.LastID)
+	if len(next.Data) == 0 || next.Data[0].ID != all[2].ID {
+		t.Fatalf("after_id page = %+v", next)
+	}
+	prev := ListAnthropicModels(1, *next.FirstID, "")
+	if len(prev.Data) != 1 || prev.Data[0].ID != all[1].ID || !prev.HasMore {
+		t.Fatalf("before_id page = %+v", prev)
+	}
+
+	empty := ListAnthropicModels(2, "", "no-such-model")
+	if len(empty.Data) != 0 || empty.FirstID != nil || empty.HasMore {
+		t.Errorf("unknown cursor = %+v", empty)
+	}
+}
+
+func TestModelCreatedAt(t *testing.T) {
+	cases := map[string]time.Time{
+		"claude-sonnet-4-5-20250929":        time.Date(2025, 9, 29, 0, 0, 0, 0, time.UTC),
+		"claude-opus-4-5-20251101-thinking": time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+		"claude-custom":                     time.Unix(0, 0).UTC(),
+	}
+	for name, want := range cases {
+		if got := modelCreatedAt(name); !got.Equal(want) {
+			t.Errorf("%s: got %v want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPassThrough429ForPolicy(t *testing.T) {
+	const (
+		official = `{"type":"error","error":{"type":"rate_limit_error","message":"This request would exceed your rate limit. See https://docs.claude.com/en/api/rate-limits"},"request_id":"req_1"}`
+		google   = `{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`
+		garbage  = `upstream overloaded`
+	)
+
+	tests := []struct {
+		policy string
+		body   string
+		want   bool
+	}{
+		{RateLimitPolicyHeuristic, official, true},
+		{RateLimitPolicyHeuristic, google, false},
+		{RateLimitPolicyHeuristic, garbage, false},
+		{RateLimitPolicyPass, official, true},
+		{RateLimitPolicyPass, google, true},
+		{RateLimitPolicyPass, garbage, true},
+		{RateLimitPolicyHide, official, false},
+		{RateLimitPolicyHide, google, false},
+		{RateLimitPolicyHide, garbage, false},
+	}
+
+	s := &AnthropicService{}
+	for _, tt := range tests {
+		if got := s.passThrough429ForPolicy(tt.policy, tt.body); got != tt.want {
+			t.Errorf("policy=%s body=%.30q: got %v, want %v", tt.policy, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeAnthropicErrorResponse(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("Content-Length", "27")
+	header.Set("Zen-Pricing-Period-Limit", "280")
+	header.Set("Zen-Pricing-Period-Cost", "280")
+	header.Set("Zen-Pricing-Period-End", now.Add(90*time.Second).Format(time.RFC3339))
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(`{"error":{"code":429,"status":"RESOURCE_EXHAUSTED"}}`)),
+	}
+
+	normalizeAnthropicErrorResponse(resp, now)
+	body, _ := io.ReadAll(resp.Body)
+	var e struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Type != "error" || e.Error.Type != "rate_limit_error" || !strings.Contains(e.Error.Message, "RESOURCE_EXHAUSTED") {
+		t.Errorf("body = %s", body)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "90" {
+		t.Errorf("Retry-After = %q, want 90", got)
+	}
+	if resp.Header.Get("Content-Length") != "" {
+		t.Error("stale Content-Length kept")
+	}
+
+	// 已是 Anthropic 格式的错误原样保留；普通 429 不知道何时恢复，不设置 Retry-After
+	official := `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`
+	resp = &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(official))}
+	normalizeAnthropicErrorResponse(resp, now)
+	if body, _ := io.ReadAll(resp.Body); string(body) != official || resp.Header.Get("Retry-After") != "" {
+		t.Errorf("body = %s, Retry-After = %q", body, resp.Header.Get("Retry-After"))
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"zencoder2api/internal/model"
 	"zencoder2api/internal/service/provider"
@@ -20,14 +21,15 @@ func NewAPIService() *APIService {
 
 func (s *APIService) Chat(req *model.ChatCompletionRequest) (*model.ChatCompletionResponse, error) {
 	// 检查模型是否存在于模型字典中
-	_, exists := model.GetZenModel(req.Model)
+	zenModel, exists := model.GetZenModel(req.Model)
 	if !exists {
 		return nil, ErrNoAvailableAccount
 	}
 
+	policy := GetRetryPolicy(zenModel.ProviderID)
 	var lastErr error
-
-	for i := 0; i < MaxRetries; i++ {
+	for i := 0; i < policy.MaxRetries; i++ {
+		time.Sleep(policy.Delay(i))
 		account, err := GetNextAccountForModel(req.Model)
 		if err != nil {
 			return nil, err
@@ -89,14 +91,15 @@ func (s *APIService) buildConfig(account *model.Account, zenModel model.ZenModel
 
 func (s *APIService) ChatStream(req *model.ChatCompletionRequest, writer http.ResponseWriter) error {
 	// 检查模型是否存在于模型字典中
-	_, exists := model.GetZenModel(req.Model)
+	zenModel, exists := model.GetZenModel(req.Model)
 	if !exists {
 		return ErrNoAvailableAccount
 	}
 
+	policy := GetRetryPolicy(zenModel.ProviderID)
 	var lastErr error
-
-	for i := 0; i < MaxRetries; i++ {
+	for i := 0; i < policy.MaxRetries; i++ {
+		time.Sleep(policy.Delay(i))
 		account, err := GetNextAccountForModel(req.Model)
 		if err != nil {
 			return err
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix 生成的 API Key 的前缀
+const apiKeyPrefix = "sk-zen-"
+
+// apiKeysExistTTL HasAPIKeys 结果的缓存时间，其他实例创建的第一个 Key 最迟在该时间后生效
+const apiKeysExistTTL = 10 * time.Second
+
+var (
+	apiKeysExistMu        sync.Mutex
+	apiKeysExist          bool
+	apiKeysExistCheckedAt time.Time
+)
+
+// APIKeyDeniedError API Key 有效但不允许本次请求（已停用、已过期、额度用尽或模型不在允许列表中）
+type APIKeyDeniedError struct {
+	Message       string
+	QuotaExceeded bool
+}
+
+func (e *APIKeyDeniedError) Error() string {
+	return e.Message
+}
+
+// HashAPIKey 返回 API Key 的 SHA-256 十六进制哈希
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey 生成随机 API Key
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// applyAPIKeyRequest 校验请求并写入 Key 的可修改字段
+func applyAPIKeyRequest(key *model.APIKey, req model.APIKeyRequest) error {
+	if req.CreditQuota < 0 {
+		return fmt.Errorf("credit_quota must not be negative")
+	}
+	if len(req.SystemPromptPrefix)+len(req.SystemPromptSuffix) > maxSystemPromptTemplate {
+		return fmt.Errorf("system prompt templates must not exceed %d bytes", maxSystemPromptTemplate)
+	}
+	var models []string
+	for _, m := range req.AllowedModels {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if _, ok := model.GetZenModel(m); !ok {
+			return fmt.Errorf("unknown model: %s", m)
+		}
+		models = append(models, m)
+	}
+
+	key.Name = strings.TrimSpace(req.Name)
+	key.Enabled = req.Enabled == nil || *req.Enabled
+	key.CreditQuota = req.CreditQuota
+	key.AllowedModels = strings.Join(models, ",")
+	key.SystemPromptPrefix = req.SystemPromptPrefix
+	key.SystemPromptSuffix = req.SystemPromptSuffix
+	key.SystemPromptOptOut = req.SystemPromptOptOut
+	key.ExpiresAt = req.ExpiresAt
+	if req.ResetUsage {
+		key.CreditsUsed = 0
+	}
+	return nil
+}
+
+// CreateAPIKey 创建 API Key，返回记录和明文（明文只在此时可见）
+func CreateAPIKey(req model.APIKeyRequest) (*model.APIKey, string, error) {
+	return createAPIKey(database.GetDB(), req)
+}
+
+// createAPIKey 在指定数据库中创建 API Key
+func createAPIKey(db *gorm.DB, req model.APIKeyRequest) (*model.APIKey, string, error) {
+	var key model.APIKey
+	if err := applyAPIKeyRequest(&key, req); err != nil {
+		return nil, "", err
+	}
+	plain, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key.KeyHash = HashAPIKey(plain)
+	key.Prefix = plain[:len(apiKeyPrefix)+4]
+	if err := db.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	invalidateAPIKeysExist()
+	return &key, plain, nil
+}
+
+// HasAPIKeys 是否已在后台创建过 API Key；存在时请求必须携带有效的 Key，否则即使未设置 AUTH_TOKEN 也会被拒绝。
+// 结果缓存 apiKeysExistTTL，数据库不可用时沿用上次的结果
+func HasAPIKeys() bool {
+	apiKeysExistMu.Lock()
+	defer apiKeysExistMu.Unlock()
+	if time.Since(apiKeysExistCheckedAt) < apiKeysExistTTL || !database.Healthy() {
+		return apiKeysExist
+	}
+	var count int64
+	if err := database.GetDB().Model(&model.APIKey{}).Limit(1).Count(&count).Error; err != nil {
+		log.Printf("[WARN] [APIKey] 查询 API Key 数量失败: %v", err)
+		return apiKeysExist
+	}
+	apiKeysExist = count > 0
+	apiKeysExistCheckedAt = time.Now()
+	return apiKeysExist
+}
+
+func invalidateAPIKeysExist() {
+	apiKeysExistMu.Lock()
+	apiKeysExistCheckedAt = time.Time{}
+	apiKeysExistMu.Unlock()
+}
+
+// ListAPIKeys 返回全部 API Key（不含明文）
+func ListAPIKeys() ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := database.GetDB().Order("id desc").Find(&keys).Error
+	return keys, err
+}
+
+// UpdateAPIKey 修改 API Key 的名称、启用状态、额度、允许的模型和过期时间
+func UpdateAPIKey(id uint, req model.APIKeyRequest) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := database.GetDB().First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	if err := applyAPIKeyRequest(&key, req); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Save(&key).Error; err != nil {
+		return nil, err
+	}
+	ReloadPoolReservations()
+	return &key, nil
+}
+
+// DeleteAPIKey 删除 API Key，之后使用该 Key 的请求会被拒绝
+func DeleteAPIKey(id uint) error {
+	result := database.GetDB().Delete(&model.APIKey{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	invalidateAPIKeysExist()
+	ReloadPoolReservations()
+	return nil
+}
+
+// LookupAPIKey 按明文查找 API Key，不存在或数据库不可用时返回 nil
+// 找到但已停用、已过期或额度用尽时返回 *APIKeyDeniedError
+func LookupAPIKey(plain string, now time.Time) (*model.APIKey, error) {
+	if plain == "" || !database.Healthy() {
+		return nil, nil
+	}
+	var key model.APIKey
+	err := database.GetDB().Where("key_hash = ?", HashAPIKey(plain)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !key.Enabled:
+		return &key, &APIKeyDeniedError{Message: "API key is disabled"}
+	case key.ExpiresAt != nil && !now.Before(*key.ExpiresAt):
+		return &key, &APIKeyDeniedError{Message: "API key has expired"}
+	case key.CreditQuota > 0 && key.CreditsUsed >= key.CreditQuota:
+		return &key, &APIKeyDeniedError{
+			Message:       fmt.Sprintf("API key credit quota of %g has been used up", key.CreditQuota),
+			QuotaExceeded: true,
+		}
+	}
+	return &key, nil
+}
+
+// CheckAPIKeyModel 检查模型是否在 Key 允许的列表中，列表为空时不限制
+func CheckAPIKeyModel(key *model.APIKey, modelID string) error {
+	if key == nil || key.AllowedModels == "" || modelID == "" {
+		return nil
+	}
+	// model#provider 形式按模型名检查
+	base, _ := SplitProviderSuffix(modelID)
+	for _, allowed := range strings.Split(key.AllowedModels, ",") {
+		if allowed == modelID || allowed == base {
+			return nil
+		}
+	}
+	return &APIKeyDeniedError{Message: fmt.Sprintf("API key is not allowed to use model %s", modelID)}
+}
+
+// ChargeAPIKey 请求成功后按模型倍率累计 Key 的已使用积分
+func ChargeAPIKey(id uint, modelID string, now time.Time) {
+	// model#provider 按模型名取倍率
+	base, _ := SplitProviderSuffix(modelID)
+	credits := 0.0
+	if m, ok := model.GetZenModel(modelID); ok {
+		credits = m.Multiplier
+	} else if m, ok := model.GetZenModel(base); ok {
+		credits = m.Multiplier
+	}
+	updates := map[string]interface{}{"last_used_at": now}
+	if credits > 0 {
+		updates["credits_used"] = gorm.Expr("credits_used + ?", credits)
+	}
+	err := database.Exec("API Key 用量", func(db *gorm.DB) error {
+		return db.Model(&model.APIKey{}).Where("id = ?", id).Updates(updates).Error
+	})
+	if err != nil {
+		log.Printf("[WARN] [APIKey] 记录 Key %d 用量失败: %v", id, err)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	initTestDB(t, "keys.db")
+	now := time.Now()
+
+	if _, _, err := CreateAPIKey(model.APIKeyRequest{AllowedModels: []string{"missing-model"}}); err == nil {
+		t.Fatal("unknown model in allowlist should be rejected")
+	}
+	invalidateAPIKeysExist()
+	if HasAPIKeys() {
+		t.Fatal("no keys created yet")
+	}
+
+	key, plain, err := CreateAPIKey(model.APIKeyRequest{
+		Name:          "team-a",
+		CreditQuota:   4,
+		AllowedModels: []string{"claude-sonnet-4-5-20250929"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Enabled || key.KeyHash != HashAPIKey(plain) || key.Prefix == "" {
+		t.Fatalf("key = %+v", key)
+	}
+	if !HasAPIKeys() {
+		t.Error("created key not detected")
+	}
+
+	found, err := LookupAPIKey(plain, now)
+	if err != nil || found == nil || found.ID != key.ID {
+		t.Fatalf("lookup = %+v, %v", found, err)
+	}
+	if found, err := LookupAPIKey("sk-zen-unknown", now); found != nil || err != nil {
+		t.Errorf("unknown key = %+v, %v", found, err)
+	}
+	if err := CheckAPIKeyModel(found, "claude-sonnet-4-5-20250929"); err != nil {
+		t.Errorf("allowed model rejected: %v", err)
+	}
+	if err := CheckAPIKeyModel(found, "gpt-5.1-codex"); err == nil {
+		t.Error("model outside the allowlist should be rejected")
+	}
+
+	// sonnet 倍率为 3，两次请求后超过 4 的额度
+	ChargeAPIKey(key.ID, "claude-sonnet-4-5-20250929", now)
+	if _, err := LookupAPIKey(plain, now); err != nil {
+		t.Fatalf("quota should not be used up yet: %v", err)
+	}
+	ChargeAPIKey(key.ID, "claude-sonnet-4-5-20250929", now)
+	_, err = LookupAPIKey(plain, now)
+	if denied, ok := err.(*APIKeyDeniedError); !ok || !denied.QuotaExceeded {
+		t.Fatalf("err = %v, want quota exceeded", err)
+	}
+
+	disabled := false
+	expires := now.Add(time.Hour)
+	updated, err := UpdateAPIKey(key.ID, model.APIKeyRequest{Name: "team-a", Enabled: &disabled, ExpiresAt: &expires, ResetUsage: true})
+	if err != nil || updated.CreditsUsed != 0 || updated.AllowedModels != "" {
+		t.Fatalf("updated = %+v, %v", updated, err)
+	}
+	if _, err := LookupAPIKey(plain, now); err == nil || err.Error() != "API key is disabled" {
+		t.Errorf("disabled key err = %v", err)
+	}
+
+	enabled := true
+	if _, err := UpdateAPIKey(key.ID, model.APIKeyRequest{Enabled: &enabled, ExpiresAt: &expires}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupAPIKey(plain, expires); err == nil || err.Error() != "API key has expired" {
+		t.Errorf("expired key err = %v", err)
+	}
+
+	if err := DeleteAPIKey(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := LookupAPIKey(plain, now); found != nil {
+		t.Error("deleted key still found")
+	}
+	if HasAPIKeys() {
+		t.Error("deleted key still counted")
+	}
+}
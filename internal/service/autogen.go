@@ -85,7 +85,7 @@ func SaveGenerationTokenWithRefresh(refreshToken string, accessToken string, des
 			log.Printf("[SaveGenerationToken] 解析JWT成功: Email=%s, Plan=%s, SubStart=%s",
 				email, planType, subscriptionDate.Format("2006-01-02"))
 		} else {
-			log.Printf("[SaveGenerationToken] 解析JWT失败: %v", err)
+			log.Printf("[WARN] [SaveGenerationToken] 解析JWT失败: %v", err)
 		}
 	}
 
@@ -194,7 +194,7 @@ func (s *AutoGenerationService) checkAndTriggerGeneration() {
 	// 获取所有活跃的token记录
 	records, err := GetActiveTokenRecords()
 	if err != nil {
-		log.Printf("[AutoGen] 获取token记录失败: %v", err)
+		log.Printf("[WARN] [AutoGen] 获取token记录失败: %v", err)
 		return
 	}
 	
@@ -273,7 +273,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 	if record.RefreshToken != "" && time.Now().After(record.TokenExpiry.Add(-time.Hour)) {
 		log.Printf("[AutoGen] Token记录 %d 的token即将过期，尝试刷新", record.ID)
 		if err := UpdateTokenRecordToken(&record); err != nil {
-			log.Printf("[AutoGen] Token记录 %d 刷新失败，停止生成任务: %v", record.ID, err)
+			log.Printf("[WARN] [AutoGen] Token记录 %d 刷新失败，停止生成任务: %v", record.ID, err)
 			return
 		}
 	}
@@ -288,7 +288,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 	}
 	
 	if err := database.GetDB().Create(&task).Error; err != nil {
-		log.Printf("[AutoGen] 创建任务记录失败: %v", err)
+		log.Printf("[WARN] [AutoGen] 创建任务记录失败: %v", err)
 		return
 	}
 	
@@ -301,12 +301,12 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 			log.Printf("[AutoGen] 检测到原始token被锁定，禁用token记录 %d: %v", record.ID, err)
 			// 将token记录标记为封禁状态
 			if markErr := markTokenRecordAsBanned(&record, "原始token被锁定: "+err.Error()); markErr != nil {
-				log.Printf("[AutoGen] 标记token记录封禁状态失败: %v", markErr)
+				log.Printf("[WARN] [AutoGen] 标记token记录封禁状态失败: %v", markErr)
 			}
 			// 根据邮箱禁用相关的token记录
 			if record.Email != "" {
 				if disableErr := disableTokenRecordsByEmail(record.Email, "关联账号被锁定"); disableErr != nil {
-					log.Printf("[AutoGen] 禁用相关token记录失败: %v", disableErr)
+					log.Printf("[WARN] [AutoGen] 禁用相关token记录失败: %v", disableErr)
 				}
 			}
 			// 提前结束任务
@@ -337,7 +337,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 			if lockoutErr, ok := err.(*AccountLockoutError); ok {
 				log.Printf("[AutoGen] 账号 %s 被锁定: %s", cred.ClientID, lockoutErr.Body)
 			} else {
-				log.Printf("[AutoGen] 账号 %s 认证失败: %v", cred.ClientID, err)
+				log.Printf("[WARN] [AutoGen] 账号 %s 认证失败: %v", cred.ClientID, err)
 			}
 			continue
 		}
@@ -376,7 +376,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 			
 			if err := database.GetDB().Save(&existing).Error; err != nil {
 				failCount++
-				log.Printf("[AutoGen] 更新账号 %s 失败: %v", account.ClientID, err)
+				log.Printf("[WARN] [AutoGen] 更新账号 %s 失败: %v", account.ClientID, err)
 			} else {
 				successCount++
 			}
@@ -384,7 +384,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 			// 记录不存在是正常的，创建新账号（不输出错误日志）
 			if err := database.GetDB().Create(&account).Error; err != nil {
 				failCount++
-				log.Printf("[AutoGen] 创建账号 %s 失败: %v", account.ClientID, err)
+				log.Printf("[WARN] [AutoGen] 创建账号 %s 失败: %v", account.ClientID, err)
 			} else {
 				successCount++
 			}
@@ -406,7 +406,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 	task.CompletedAt = time.Now()
 	
 	if err := database.GetDB().Save(&task).Error; err != nil {
-		log.Printf("[AutoGen] 更新任务记录失败: %v", err)
+		log.Printf("[WARN] [AutoGen] 更新任务记录失败: %v", err)
 	}
 	
 	// 更新token记录，累计所有统计数据
@@ -421,7 +421,7 @@ func (s *AutoGenerationService) executeGeneration(record model.TokenRecord) {
 	if err := database.GetDB().Model(&model.TokenRecord{}).
 		Where("id = ?", record.ID).
 		Updates(updates).Error; err != nil {
-		log.Printf("[AutoGen] 更新token记录失败: %v", err)
+		log.Printf("[WARN] [AutoGen] 更新token记录失败: %v", err)
 	}
 	
 	// 刷新账号池
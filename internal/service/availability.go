@@ -0,0 +1,108 @@
+package service
+
+import (
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// 模型可用性状态
+const (
+	AvailabilityAvailable   = "available"    // 有空闲账号，可立即调度
+	AvailabilityBusy        = "busy"         // 账号都在使用中，稍后释放
+	AvailabilityRateLimited = "rate_limited" // 账号被限流冻结
+	AvailabilityUnavailable = "unavailable"  // 没有可调度该模型的账号
+)
+
+// ModelAvailability 模型当前的调度情况，供编排层提前切换模型
+type ModelAvailability struct {
+	ID                   string `json:"id"`
+	Available            bool   `json:"available"`
+	Status               string `json:"status"`
+	EligibleAccounts     int    `json:"eligible_accounts"`
+	IdleAccounts         int    `json:"idle_accounts"`
+	InUseAccounts        int    `json:"in_use_accounts"`
+	RateLimitedAccounts  int    `json:"rate_limited_accounts"`
+	EstimatedWaitSeconds *int   `json:"estimated_wait_seconds"` // 为 null 时无法估计
+}
+
+// GetModelAvailability 根据号池内存状态统计模型的可用性，不会占用账号
+func GetModelAvailability(modelID string) ModelAvailability {
+	pool.mu.RLock()
+	accounts := pool.accounts
+	pool.mu.RUnlock()
+
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return modelAvailability(accounts, accountStatuses, modelID, GetAccountConcurrency(), time.Now())
+}
+
+// modelAvailability 统计可调度账号；预估等待取最早解冻或最早超时释放的时间
+func modelAvailability(accounts []*model.Account, statuses map[uint]*AccountStatus, modelID string, limit int, now time.Time) ModelAvailability {
+	result := ModelAvailability{ID: modelID}
+	reserved := reservedForModel(accounts, modelID)
+	allowed := model.AllowedPlans(modelID)
+
+	var wait time.Duration = -1
+	earliest := func(d time.Duration) {
+		if d < 0 {
+			d = 0
+		}
+		if wait < 0 || d < wait {
+			wait = d
+		}
+	}
+
+	for _, acc := range accounts {
+		if !allowed.Has(acc.PlanType) || reserved[acc.ID] {
+			continue
+		}
+		status, exists := statuses[acc.ID]
+		if exists && status.Draining() {
+			// 维护排空中的账号不参与调度
+			continue
+		}
+		result.EligibleAccounts++
+
+		if !exists {
+			// 尚未调度过，按数据库中的冷却时间判断
+			status = &AccountStatus{FrozenUntil: acc.CoolingUntil}
+		}
+		// 超过30秒的占用会在下次调度时被自动释放，不计入
+		active := status.Leases
+		for len(active) > 0 && now.Sub(active[0]) > 30*time.Second {
+			active = active[1:]
+		}
+		switch {
+		case !now.After(status.FrozenUntil):
+			result.RateLimitedAccounts++
+			earliest(status.FrozenUntil.Sub(now))
+		case len(active)+len(status.Sessions) >= limit:
+			result.InUseAccounts++
+			// 最早的占用超时释放是等待时间的上限；长连接持有的名额没有上限
+			if len(active) > 0 {
+				earliest(active[0].Add(30 * time.Second).Sub(now))
+			}
+		default:
+			result.IdleAccounts++
+		}
+	}
+
+	switch {
+	case result.IdleAccounts > 0:
+		result.Available = true
+		result.Status = AvailabilityAvailable
+		wait = 0
+	case result.InUseAccounts > 0:
+		result.Status = AvailabilityBusy
+	case result.RateLimitedAccounts > 0:
+		result.Status = AvailabilityRateLimited
+	default:
+		result.Status = AvailabilityUnavailable
+	}
+	if wait >= 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		result.EstimatedWaitSeconds = &seconds
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestModelAvailability(t *testing.T) {
+	now := time.Now()
+	const regular = "claude-sonnet-4-5-20250929-thinking"
+	const premium = "claude-opus-4-5-20251101-thinking"
+
+	accounts := []*model.Account{
+		{ID: 1, PlanType: model.PlanMax},
+		{ID: 2, PlanType: model.PlanFree},
+		{ID: 3, PlanType: model.PlanFree},
+	}
+
+	tests := []struct {
+		name     string
+		modelID  string
+		statuses map[uint]*AccountStatus
+		status   string
+		wait     int
+	}{
+		{"idle", regular, map[uint]*AccountStatus{}, AvailabilityAvailable, 0},
+		{"busy", regular, map[uint]*AccountStatus{
+			1: {Leases: []time.Time{now.Add(-25 * time.Second)}},
+			2: {Leases: []time.Time{now.Add(-10 * time.Second)}},
+			3: {FrozenUntil: now.Add(time.Minute)},
+		}, AvailabilityBusy, 5},
+		{"rate limited", premium, map[uint]*AccountStatus{
+			1: {FrozenUntil: now.Add(90 * time.Second)},
+		}, AvailabilityRateLimited, 90},
+		{"stale in-use counts as idle", premium, map[uint]*AccountStatus{
+			1: {Leases: []time.Time{now.Add(-time.Minute)}},
+		}, AvailabilityAvailable, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := modelAvailability(accounts, tt.statuses, tt.modelID, 1, now)
+			if got.Status != tt.status {
+				t.Fatalf("status = %s, want %s (%+v)", got.Status, tt.status, got)
+			}
+			if got.EstimatedWaitSeconds == nil || *got.EstimatedWaitSeconds != tt.wait {
+				t.Errorf("wait = %v, want %d", got.EstimatedWaitSeconds, tt.wait)
+			}
+		})
+	}
+
+	// 只有 Free 账号时 PremiumOnly 模型无法调度
+	got := modelAvailability(accounts[1:], map[uint]*AccountStatus{}, premium, 1, now)
+	if got.Status != AvailabilityUnavailable || got.EstimatedWaitSeconds != nil || got.EligibleAccounts != 0 {
+		t.Errorf("free-only premium = %+v", got)
+	}
+
+	// 并发上限为 2 时只占用一个名额的账号仍可调度
+	got = modelAvailability(accounts[:1], map[uint]*AccountStatus{1: {Leases: []time.Time{now}}}, premium, 2, now)
+	if got.Status != AvailabilityAvailable {
+		t.Errorf("partially used with limit 2 = %+v", got)
+	}
+}
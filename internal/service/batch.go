@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// ErrBatchNotFound 批处理任务不存在或不属于当前 API Key
+var ErrBatchNotFound = errors.New("batch not found")
+
+// BatchItem 提交批处理时的单个请求
+type BatchItem struct {
+	CustomID string          `json:"custom_id"`
+	Body     json.RawMessage `json:"body"` // /v1/chat/completions 请求体
+}
+
+// BatchConfig 离峰批处理配置
+type BatchConfig struct {
+	MaxRequests  int           // 单个任务的最大请求数
+	MaxPressure  float64       // 号池压力低于该值时才执行
+	Concurrency  int           // 同时执行的请求数
+	PollInterval time.Duration // 调度间隔
+	UrgentWindow time.Duration // 距截止时间不足该时长时不再等待空闲
+}
+
+// BatchExecutor 执行一个 chat 请求，返回状态码和响应体
+type BatchExecutor func(ctx context.Context, job *model.BatchJob, body []byte) (int, []byte, error)
+
+var (
+	batchConfig     BatchConfig
+	batchConfigOnce sync.Once
+)
+
+// 截止时间范围
+const (
+	batchMinWindow     = time.Minute
+	batchMaxWindow     = 7 * 24 * time.Hour
+	batchDefaultWindow = 24 * time.Hour
+)
+
+// GetBatchConfig 读取 BATCH_MAX_REQUESTS / BATCH_MAX_POOL_PRESSURE / BATCH_CONCURRENCY
+func GetBatchConfig() BatchConfig {
+	batchConfigOnce.Do(func() {
+		batchConfig = BatchConfig{
+			MaxRequests:  envPositiveInt("BATCH_MAX_REQUESTS", 1000),
+			MaxPressure:  0.5,
+			Concurrency:  envPositiveInt("BATCH_CONCURRENCY", 2),
+			PollInterval: 5 * time.Second,
+			UrgentWindow: 10 * time.Minute,
+		}
+		if raw := strings.TrimSpace(os.Getenv("BATCH_MAX_POOL_PRESSURE")); raw != "" {
+			if v, err := strconv.ParseFloat(raw, 64); err == nil && v > 0 && v <= 1 {
+				batchConfig.MaxPressure = v
+			} else {
+				log.Printf("[WARN] 无效的 BATCH_MAX_POOL_PRESSURE: %s，使用默认值 0.5", raw)
+			}
+		}
+	})
+	return batchConfig
+}
+
+// PoolPressure 返回号池并发名额的占用比例，冻结中和排空中的账号按占满计算，没有账号时为 1
+func PoolPressure() float64 {
+	pool.mu.RLock()
+	accounts := pool.accounts
+	pool.mu.RUnlock()
+
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return poolPressure(accounts, accountStatuses, GetAccountConcurrency(), time.Now())
+}
+
+func poolPressure(accounts []*model.Account, statuses map[uint]*AccountStatus, limit int, now time.Time) float64 {
+	if len(accounts) == 0 {
+		return 1
+	}
+	busy := 0
+	for _, acc := range accounts {
+		status := statuses[acc.ID]
+		if status == nil {
+			continue
+		}
+		if now.Before(status.FrozenUntil) || status.Draining() {
+			busy += limit
+		} else {
+			busy += min(status.Active(), limit)
+		}
+	}
+	return float64(busy) / float64(len(accounts)*limit)
+}
+
+func newBatchID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "batch_" + hex.EncodeToString(b)
+}
+
+// CreateBatch 校验并保存批处理任务，deadline 为零值时默认 24 小时
+func CreateBatch(apiKey, clientIP string, items []BatchItem, deadline time.Time) (*model.BatchJob, error) {
+	cfg := GetBatchConfig()
+	now := time.Now()
+	if len(items) == 0 {
+		return nil, invalidRequest("requests: must not be empty")
+	}
+	if len(items) > cfg.MaxRequests {
+		return nil, invalidRequest("requests: at most %d requests per batch", cfg.MaxRequests)
+	}
+	if deadline.IsZero() {
+		deadline = now.Add(batchDefaultWindow)
+	}
+	if deadline.Before(now.Add(batchMinWindow)) || deadline.After(now.Add(batchMaxWindow)) {
+		return nil, invalidRequest("deadline: must be between 1 minute and 7 days from now")
+	}
+
+	job := &model.BatchJob{
+		ID:       newBatchID(),
+		APIKey:   apiKey,
+		ClientIP: clientIP,
+		Status:   model.BatchStatusQueued,
+		Deadline: deadline,
+		Total:    len(items),
+	}
+	requests := make([]model.BatchRequest, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		customID := item.CustomID
+		if customID == "" {
+			customID = fmt.Sprintf("request-%d", i)
+		}
+		if seen[customID] {
+			return nil, invalidRequest("requests[%d].custom_id: %q is duplicated", i, customID)
+		}
+		seen[customID] = true
+
+		body, err := normalizeBatchBody(item.Body)
+		if err != nil {
+			return nil, invalidRequest("requests[%d].body: %v", i, err)
+		}
+		requests = append(requests, model.BatchRequest{
+			BatchID:  job.ID,
+			CustomID: customID,
+			Body:     string(body),
+			Status:   model.BatchRequestPending,
+		})
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(requests, 100).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存批处理任务失败: %w", err)
+	}
+	return job, nil
+}
+
+// normalizeBatchBody 检查请求体包含 model 和 messages，并强制关闭流式输出
+func normalizeBatchBody(raw json.RawMessage) ([]byte, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err != nil || body == nil {
+		return nil, fmt.Errorf("must be a chat completions request object")
+	}
+	modelID, _ := body["model"].(string)
+	if modelID == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	if _, ok := model.GetZenModel(modelID); !ok {
+		return nil, fmt.Errorf("model %q does not exist", modelID)
+	}
+	if _, ok := body["messages"].([]interface{}); !ok {
+		return nil, fmt.Errorf("messages is required")
+	}
+	body["stream"] = false
+	return json.Marshal(body)
+}
+
+// GetBatch 获取批处理任务，apiKey 不匹配时视为不存在
+func GetBatch(id, apiKey string) (*model.BatchJob, error) {
+	var job model.BatchJob
+	if err := database.GetDB().Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, ErrBatchNotFound
+	}
+	if job.APIKey != apiKey {
+		return nil, ErrBatchNotFound
+	}
+	return &job, nil
+}
+
+// ListBatchRequests 返回批处理任务中的所有请求（含结果）
+func ListBatchRequests(batchID string) ([]model.BatchRequest, error) {
+	var requests []model.BatchRequest
+	err := database.GetDB().Where("batch_id = ?", batchID).Order("id").Find(&requests).Error
+	return requests, err
+}
+
+// CancelBatch 取消尚未执行的请求，已完成的结果保留
+func CancelBatch(id, apiKey string) (*model.BatchJob, error) {
+	job, err := GetBatch(id, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if job.FinishedAt != nil {
+		return job, nil
+	}
+	if err := finishBatch(job, model.BatchStatusCancelled, model.BatchRequestCancelled, time.Now()); err != nil {
+		return nil, err
+	}
+	return GetBatch(id, apiKey)
+}
+
+// finishBatch 把剩余的待执行请求标记为 requestStatus 并结束任务
+func finishBatch(job *model.BatchJob, status, requestStatus string, now time.Time) error {
+	db := database.GetDB()
+	if err := db.Model(&model.BatchRequest{}).
+		Where("batch_id = ? AND status = ?", job.ID, model.BatchRequestPending).
+		Update("status", requestStatus).Error; err != nil {
+		return err
+	}
+	return db.Model(&model.BatchJob{}).Where("id = ?", job.ID).
+		Updates(map[string]interface{}{"status": status, "finished_at": now}).Error
+}
+
+// batchScheduler 在号池空闲时逐个执行批处理请求
+type batchScheduler struct {
+	cfg     BatchConfig
+	exec    BatchExecutor
+	running sync.Map // 正在执行的 BatchRequest.ID
+}
+
+// StartBatchScheduler 启动离峰批处理调度
+func StartBatchScheduler(exec BatchExecutor) {
+	s := &batchScheduler{cfg: GetBatchConfig(), exec: exec}
+	go func() {
+		ticker := time.NewTicker(s.cfg.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.tick(time.Now(), PoolPressure())
+		}
+	}()
+}
+
+// tick 结束过期任务，然后在号池压力允许（或临近截止时间）时启动下一批请求
+func (s *batchScheduler) tick(now time.Time, pressure float64) {
+	// 数据库降级期间暂停调度，恢复后再判断过期和启动请求
+	if !database.Healthy() {
+		return
+	}
+	db := database.GetDB()
+
+	var expired []model.BatchJob
+	db.Where("finished_at IS NULL AND deadline <= ?", now).Find(&expired)
+	for i := range expired {
+		if err := finishBatch(&expired[i], model.BatchStatusExpired, model.BatchRequestExpired, now); err != nil {
+			log.Printf("[WARN] [Batch] 任务 %s 标记过期失败: %v", expired[i].ID, err)
+			continue
+		}
+		log.Printf("[Batch] 任务 %s 未在截止时间前完成，剩余请求已过期", expired[i].ID)
+	}
+
+	var jobs []model.BatchJob
+	db.Where("finished_at IS NULL").Order("deadline").Find(&jobs)
+
+	slots := s.cfg.Concurrency
+	s.running.Range(func(_, _ interface{}) bool {
+		slots--
+		return true
+	})
+	for i := range jobs {
+		if slots <= 0 {
+			return
+		}
+		job := &jobs[i]
+		// 号池繁忙时只执行临近截止时间的任务
+		if pressure >= s.cfg.MaxPressure && job.Deadline.Sub(now) > s.cfg.UrgentWindow {
+			continue
+		}
+
+		var pending []model.BatchRequest
+		db.Where("batch_id = ? AND status = ?", job.ID, model.BatchRequestPending).
+			Order("id").Limit(slots + s.cfg.Concurrency).Find(&pending)
+		for j := range pending {
+			if slots <= 0 {
+				break
+			}
+			if _, busy := s.running.LoadOrStore(pending[j].ID, true); busy {
+				continue
+			}
+			slots--
+			if job.Status == model.BatchStatusQueued {
+				db.Model(job).Update("status", model.BatchStatusRunning)
+				job.Status = model.BatchStatusRunning
+			}
+			go s.run(*job, pending[j])
+		}
+	}
+}
+
+// run 执行单个请求并保存结果，所有请求结束后完成任务
+func (s *batchScheduler) run(job model.BatchJob, req model.BatchRequest) {
+	defer s.running.Delete(req.ID)
+
+	ctx, cancel := context.WithDeadline(context.Background(), job.Deadline)
+	defer cancel()
+	statusCode, body, err := s.exec(ctx, &job, []byte(req.Body))
+
+	now := time.Now()
+	updates := map[string]interface{}{"status_code": statusCode, "response": string(body), "completed_at": now}
+	counter := "failed"
+	switch {
+	case err != nil:
+		updates["status"] = model.BatchRequestFailed
+		updates["error"] = err.Error()
+	case statusCode >= 200 && statusCode < 300:
+		updates["status"] = model.BatchRequestCompleted
+		counter = "completed"
+	default:
+		updates["status"] = model.BatchRequestFailed
+		updates["error"] = fmt.Sprintf("upstream returned status %d", statusCode)
+	}
+
+	db := database.GetDB()
+	// 只更新仍在等待的请求，避免覆盖执行期间的取消/过期
+	result := db.Model(&model.BatchRequest{}).
+		Where("id = ? AND status = ?", req.ID, model.BatchRequestPending).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[WARN] [Batch] 保存任务 %s 请求 %s 结果失败: %v", job.ID, req.CustomID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	db.Model(&model.BatchJob{}).Where("id = ?", job.ID).
+		Update(counter, gorm.Expr(counter+" + 1"))
+
+	var remaining int64
+	db.Model(&model.BatchRequest{}).Where("batch_id = ? AND status = ?", job.ID, model.BatchRequestPending).Count(&remaining)
+	if remaining == 0 {
+		db.Model(&model.BatchJob{}).Where("id = ? AND finished_at IS NULL", job.ID).
+			Updates(map[string]interface{}{"status": model.BatchStatusCompleted, "finished_at": now})
+	}
+}
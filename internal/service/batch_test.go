@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+const testBatchBody = `{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"hi"}],"stream":true}`
+
+func setupBatchTest(t *testing.T) {
+	t.Helper()
+	initTestDB(t, "batch.db")
+}
+
+func batchItems(n int) []BatchItem {
+	items := make([]BatchItem, n)
+	for i := range items {
+		items[i] = BatchItem{Body: json.RawMessage(testBatchBody)}
+	}
+	return items
+}
+
+// waitIdle 等待调度器启动的请求全部结束
+func waitIdle(t *testing.T, s *batchScheduler) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		busy := false
+		s.running.Range(func(_, _ interface{}) bool {
+			busy = true
+			return false
+		})
+		if !busy {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("scheduler did not become idle")
+}
+
+func TestBatchRunsWhenPoolIdle(t *testing.T) {
+	setupBatchTest(t)
+	var calls int32
+	var sentBody map[string]interface{}
+	s := &batchScheduler{
+		cfg: BatchConfig{MaxPressure: 0.5, Concurrency: 2, UrgentWindow: 10 * time.Minute},
+		exec: func(ctx context.Context, job *model.BatchJob, body []byte) (int, []byte, error) {
+			if atomic.AddInt32(&calls, 1) == 3 {
+				return 500, []byte(`{"error":"boom"}`), nil
+			}
+			json.Unmarshal(body, &sentBody)
+			return 200, []byte(`{"object":"chat.completion"}`), nil
+		},
+	}
+
+	job, err := CreateBatch("sk-a", "127.0.0.1", batchItems(3), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+
+	// 号池繁忙且远未到截止时间：不执行
+	s.tick(time.Now(), 0.9)
+	waitIdle(t, s)
+	if calls != 0 {
+		t.Fatalf("executed %d requests under pressure", calls)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.tick(time.Now(), 0.1)
+		waitIdle(t, s)
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+	if sentBody["stream"] != false {
+		t.Errorf("stream not disabled: %v", sentBody["stream"])
+	}
+
+	got, err := GetBatch(job.ID, "sk-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.BatchStatusCompleted || got.Completed != 2 || got.Failed != 1 || got.FinishedAt == nil {
+		t.Errorf("job = %+v", got)
+	}
+	requests, _ := ListBatchRequests(job.ID)
+	if len(requests) != 3 || requests[0].CustomID != "request-0" || requests[0].Response == "" {
+		t.Errorf("requests = %+v", requests)
+	}
+}
+
+func TestBatchUrgentRunsDespitePressure(t *testing.T) {
+	setupBatchTest(t)
+	var calls int32
+	s := &batchScheduler{
+		cfg: BatchConfig{MaxPressure: 0.5, Concurrency: 1, UrgentWindow: 10 * time.Minute},
+		exec: func(ctx context.Context, job *model.BatchJob, body []byte) (int, []byte, error) {
+			atomic.AddInt32(&calls, 1)
+			return 200, []byte(`{}`), nil
+		},
+	}
+	if _, err := CreateBatch("sk-a", "", batchItems(1), time.Now().Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s.tick(time.Now(), 1)
+	waitIdle(t, s)
+	if calls != 1 {
+		t.Errorf("urgent batch not executed: calls=%d", calls)
+	}
+}
+
+func TestBatchExpiresAndCancels(t *testing.T) {
+	setupBatchTest(t)
+	s := &batchScheduler{
+		cfg: BatchConfig{MaxPressure: 0.5, Concurrency: 1},
+		exec: func(ctx context.Context, job *model.BatchJob, body []byte) (int, []byte, error) {
+			t.Error("expired batch executed")
+			return 200, nil, nil
+		},
+	}
+	expiring, _ := CreateBatch("sk-a", "", batchItems(2), time.Now().Add(2*time.Minute))
+	s.tick(time.Now().Add(3*time.Minute), 1)
+	if got, _ := GetBatch(expiring.ID, "sk-a"); got.Status != model.BatchStatusExpired {
+		t.Errorf("status = %s, want expired", got.Status)
+	}
+
+	cancelled, _ := CreateBatch("sk-a", "", batchItems(2), time.Now().Add(time.Hour))
+	if _, err := CancelBatch(cancelled.ID, "sk-other"); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("cancel by other key: %v", err)
+	}
+	got, err := CancelBatch(cancelled.ID, "sk-a")
+	if err != nil || got.Status != model.BatchStatusCancelled {
+		t.Fatalf("cancel: %+v %v", got, err)
+	}
+	requests, _ := ListBatchRequests(cancelled.ID)
+	for _, r := range requests {
+		if r.Status != model.BatchRequestCancelled {
+			t.Errorf("request %s status = %s", r.CustomID, r.Status)
+		}
+	}
+	s.tick(time.Now(), 0)
+	waitIdle(t, s)
+}
+
+func TestCreateBatchValidation(t *testing.T) {
+	setupBatchTest(t)
+	hour := time.Now().Add(time.Hour)
+	cases := map[string]struct {
+		items    []BatchItem
+		deadline time.Time
+	}{
+		"empty":         {nil, hour},
+		"no model":      {[]BatchItem{{Body: json.RawMessage(`{"messages":[]}`)}}, hour},
+		"unknown model": {[]BatchItem{{Body: json.RawMessage(`{"model":"nope","messages":[]}`)}}, hour},
+		"no messages":   {[]BatchItem{{Body: json.RawMessage(`{"model":"claude-sonnet-4-5-20250929"}`)}}, hour},
+		"duplicate id":  {[]BatchItem{{CustomID: "a", Body: json.RawMessage(testBatchBody)}, {CustomID: "a", Body: json.RawMessage(testBatchBody)}}, hour},
+		"past deadline": {batchItems(1), time.Now().Add(-time.Minute)},
+		"far deadline":  {batchItems(1), time.Now().Add(30 * 24 * time.Hour)},
+	}
+	for name, tc := range cases {
+		var invalid *InvalidRequestError
+		if _, err := CreateBatch("sk-a", "", tc.items, tc.deadline); !errors.As(err, &invalid) {
+			t.Errorf("%s: err = %v, want InvalidRequestError", name, err)
+		}
+	}
+}
+
+func TestPoolPressure(t *testing.T) {
+	now := time.Now()
+	accounts := []*model.Account{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+	statuses := map[uint]*AccountStatus{
+		1: {Leases: []time.Time{now}},
+		2: {FrozenUntil: now.Add(time.Minute)},
+		3: {FrozenUntil: now.Add(-time.Minute)},
+	}
+	if got := poolPressure(accounts, statuses, 1, now); got != 0.5 {
+		t.Errorf("pressure = %v, want 0.5", got)
+	}
+	// 并发上限为 2：账号 1 占用 1/2，冻结的账号 2 按占满计
+	if got := poolPressure(accounts, statuses, 2, now); got != 0.375 {
+		t.Errorf("pressure with limit 2 = %v, want 0.375", got)
+	}
+	if got := poolPressure(nil, statuses, 1, now); got != 1 {
+		t.Errorf("empty pool pressure = %v, want 1", got)
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// adminPasswordSettingKey 初始化向导设置的管理密码（bcrypt 哈希）在 settings 表中的 Key
+	adminPasswordSettingKey = "admin_password"
+	// bootstrapSettingsKey 初始化向导设置的全局限制在 settings 表中的 Key
+	bootstrapSettingsKey = "bootstrap_settings"
+	// minAdminPasswordLength 初始化向导要求的最短管理密码
+	minAdminPasswordLength = 8
+)
+
+// ErrAlreadyBootstrapped 已配置管理员，初始化接口关闭
+var ErrAlreadyBootstrapped = errors.New("管理员已存在，初始化接口已关闭")
+
+// BootstrapDatabase 初始化向导中的数据库设置，写入 BOOTSTRAP_FILE 供下次启动使用
+type BootstrapDatabase struct {
+	Type string `json:"type"` // sqlite / postgres / mysql
+	DSN  string `json:"dsn"`
+}
+
+// BootstrapRequest 首次部署的初始化参数，除管理密码外均可省略
+type BootstrapRequest struct {
+	AdminPassword string                     `json:"admin_password"`
+	APIKeys       []model.APIKeyRequest      `json:"api_keys"`
+	Database      *BootstrapDatabase         `json:"database"`
+	Settings      map[string]json.RawMessage `json:"settings"` // 与配置导出中 settings 的字段同名，如 premium_reserve、account_concurrency
+}
+
+// BootstrapKey 初始化时创建的 API Key，明文只返回这一次
+type BootstrapKey struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// BootstrapResult 初始化结果
+type BootstrapResult struct {
+	APIKeys  []BootstrapKey `json:"api_keys"`
+	Settings []string       `json:"settings"`
+	Database string         `json:"database,omitempty"` // 切换后的数据库类型
+	// RestartRequired 设置了数据库时为 true：上述内容已写入新库，重启后切换，当前进程继续使用原数据库
+	RestartRequired bool `json:"restart_required,omitempty"`
+}
+
+var (
+	storedAdminPassword       string
+	storedAdminPasswordMu     sync.RWMutex
+	storedAdminPasswordLoaded bool // 数据库不可用时下次再读，避免因一次读取失败而跳过鉴权
+	// bootstrapMu 保证初始化只执行一次
+	bootstrapMu sync.Mutex
+)
+
+// getBootstrapFile 读取 BOOTSTRAP_FILE，默认 bootstrap.json
+func getBootstrapFile() string {
+	if path := strings.TrimSpace(os.Getenv("BOOTSTRAP_FILE")); path != "" {
+		return path
+	}
+	return "bootstrap.json"
+}
+
+// LoadBootstrapDatabase 读取初始化向导保存的数据库设置，文件不存在或无效时 ok 为 false
+func LoadBootstrapDatabase() (dbType, dsn string, ok bool) {
+	data, err := os.ReadFile(getBootstrapFile())
+	if err != nil {
+		return "", "", false
+	}
+	var cfg BootstrapDatabase
+	if err := json.Unmarshal(data, &cfg); err != nil || cfg.DSN == "" {
+		log.Printf("[WARN] 初始化向导保存的数据库设置无效，已忽略: %s", getBootstrapFile())
+		return "", "", false
+	}
+	return cfg.Type, cfg.DSN, true
+}
+
+// loadStoredAdminPassword 读取数据库中保存的管理密码哈希，调用方需持有 storedAdminPasswordMu 写锁
+func loadStoredAdminPassword() {
+	if !database.Healthy() {
+		return
+	}
+	var setting model.Setting
+	err := database.GetDB().Where(&model.Setting{Key: adminPasswordSettingKey}).Limit(1).Find(&setting).Error
+	if err == nil {
+		storedAdminPassword = setting.Value
+		storedAdminPasswordLoaded = true
+	}
+}
+
+func getStoredAdminPassword() string {
+	storedAdminPasswordMu.RLock()
+	if storedAdminPasswordLoaded {
+		defer storedAdminPasswordMu.RUnlock()
+		return storedAdminPassword
+	}
+	storedAdminPasswordMu.RUnlock()
+
+	storedAdminPasswordMu.Lock()
+	defer storedAdminPasswordMu.Unlock()
+	if !storedAdminPasswordLoaded {
+		loadStoredAdminPassword()
+	}
+	return storedAdminPassword
+}
+
+// hashAdminPassword 使用 bcrypt 哈希管理密码
+func hashAdminPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// verifyAdminPasswordHash 校验 bcrypt 哈希；早期版本保存的 salt$sha256(salt+password) 格式仍可校验，needsRehash 为 true
+func verifyAdminPasswordHash(hash, password string) (ok, needsRehash bool) {
+	if strings.HasPrefix(hash, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, false
+	}
+	salt, want, found := strings.Cut(hash, "$")
+	if !found {
+		return false, false
+	}
+	sum := sha256.Sum256([]byte(salt + password))
+	ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(want)) == 1
+	return ok, ok
+}
+
+// rehashAdminPassword 旧格式的密码校验通过后改存为 bcrypt
+func rehashAdminPassword(password string) {
+	hash, err := hashAdminPassword(password)
+	if err != nil || !database.Healthy() {
+		return
+	}
+	if err := saveSetting(database.GetDB(), adminPasswordSettingKey, hash); err != nil {
+		log.Printf("[WARN] [Bootstrap] 更新管理密码哈希失败: %v", err)
+		return
+	}
+	storedAdminPasswordMu.Lock()
+	storedAdminPassword = hash
+	storedAdminPasswordLoaded = true
+	storedAdminPasswordMu.Unlock()
+}
+
+// AdminPasswordConfigured 是否配置了管理密码（ADMIN_PASSWORD 或初始化向导）
+func AdminPasswordConfigured() bool {
+	return GetSecret("ADMIN_PASSWORD") != "" || getStoredAdminPassword() != ""
+}
+
+// CheckAdminPassword 校验管理密码，ADMIN_PASSWORD 和初始化向导设置的密码都可以使用
+func CheckAdminPassword(password string) bool {
+	if password == "" {
+		return false
+	}
+	if env := GetSecret("ADMIN_PASSWORD"); env != "" && subtle.ConstantTimeCompare([]byte(password), []byte(env)) == 1 {
+		return true
+	}
+	if hash := getStoredAdminPassword(); hash != "" {
+		ok, needsRehash := verifyAdminPasswordHash(hash, password)
+		if needsRehash {
+			rehashAdminPassword(password)
+		}
+		return ok
+	}
+	return false
+}
+
+// BootstrapRequired 没有任何管理员（未配置管理密码且未启用 OIDC）时需要初始化
+func BootstrapRequired() bool {
+	return !AdminPasswordConfigured() && !GetOIDCConfig().Enabled()
+}
+
+// Bootstrap 首次部署时设置管理密码、API Key、数据库和全局限制，成功后接口关闭
+// 参数无效时返回 *InvalidRequestError，已有管理员时返回 ErrAlreadyBootstrapped
+func Bootstrap(req BootstrapRequest) (*BootstrapResult, error) {
+	bootstrapMu.Lock()
+	defer bootstrapMu.Unlock()
+
+	if !BootstrapRequired() {
+		return nil, ErrAlreadyBootstrapped
+	}
+	if len(req.AdminPassword) < minAdminPasswordLength {
+		return nil, &InvalidRequestError{Message: fmt.Sprintf("管理密码至少 %d 位", minAdminPasswordLength), Param: "admin_password"}
+	}
+	// API Key 先全部校验，避免创建一半后失败
+	for i, keyReq := range req.APIKeys {
+		if err := applyAPIKeyRequest(&model.APIKey{}, keyReq); err != nil {
+			return nil, &InvalidRequestError{Message: err.Error(), Param: fmt.Sprintf("api_keys.%d", i)}
+		}
+	}
+	if req.Database != nil && req.Database.DSN == "" {
+		return nil, &InvalidRequestError{Message: "数据库连接字符串不能为空", Param: "database.dsn"}
+	}
+	keys := make([]string, 0, len(req.Settings))
+	for key := range req.Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &BootstrapResult{APIKeys: []BootstrapKey{}, Settings: keys}
+
+	// 设置了数据库时之后的内容都写入新库，重启后切换；运行中替换全局连接会使号池、模型注册表等状态仍来自原库
+	db := database.GetDB()
+	if req.Database != nil {
+		dbType := strings.ToLower(strings.TrimSpace(req.Database.Type))
+		target, err := database.Prepare(dbType, req.Database.DSN)
+		if err != nil {
+			return nil, &InvalidRequestError{Message: "无法连接数据库: " + err.Error(), Param: "database"}
+		}
+		defer func() {
+			if sqlDB, err := target.DB(); err == nil {
+				sqlDB.Close()
+			}
+		}()
+		// 新库中可能已有其他实例保存的管理密码
+		var existing model.Setting
+		if err := target.Where(&model.Setting{Key: adminPasswordSettingKey}).Limit(1).Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		if existing.Value != "" {
+			return nil, ErrAlreadyBootstrapped
+		}
+		db = target
+		result.Database = dbType
+		result.RestartRequired = true
+	} else if !database.Healthy() {
+		return nil, database.ErrUnavailable
+	}
+
+	for _, key := range keys {
+		value := req.Settings[key]
+		if err := applyConfigSetting(key, func(v interface{}) error { return json.Unmarshal(value, v) }); err != nil {
+			return nil, &InvalidRequestError{Message: err.Error(), Param: "settings." + key}
+		}
+	}
+	if len(req.Settings) > 0 {
+		value, _ := json.Marshal(req.Settings)
+		if err := saveSetting(db, bootstrapSettingsKey, string(value)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, keyReq := range req.APIKeys {
+		key, plain, err := createAPIKey(db, keyReq)
+		if err != nil {
+			return nil, err
+		}
+		result.APIKeys = append(result.APIKeys, BootstrapKey{ID: key.ID, Name: key.Name, Key: plain})
+	}
+
+	// 最后保存管理密码，保存后初始化接口关闭
+	hash, err := hashAdminPassword(req.AdminPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveSetting(db, adminPasswordSettingKey, hash); err != nil {
+		return nil, err
+	}
+	if req.Database != nil {
+		data, _ := json.MarshalIndent(BootstrapDatabase{Type: result.Database, DSN: req.Database.DSN}, "", "  ")
+		if err := os.WriteFile(getBootstrapFile(), data, 0600); err != nil {
+			return nil, fmt.Errorf("保存数据库设置失败: %w", err)
+		}
+		log.Printf("[Bootstrap] %s 数据库设置已保存到 %s，重启后生效", result.Database, getBootstrapFile())
+	}
+	// 当前进程立即使用新密码，初始化接口随之关闭
+	storedAdminPasswordMu.Lock()
+	storedAdminPassword = hash
+	storedAdminPasswordLoaded = true
+	storedAdminPasswordMu.Unlock()
+
+	log.Printf("[Bootstrap] 初始化完成：%d 个 API Key，%d 项设置", len(result.APIKeys), len(keys))
+	return result, nil
+}
+
+// LoadBootstrapSettings 启动时应用初始化向导保存的全局限制
+func LoadBootstrapSettings() {
+	if !database.Healthy() {
+		return
+	}
+	var setting model.Setting
+	err := database.GetDB().Where(&model.Setting{Key: bootstrapSettingsKey}).Limit(1).Find(&setting).Error
+	if err != nil || setting.Key == "" {
+		return
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(setting.Value), &settings); err != nil {
+		log.Printf("[WARN] 初始化向导保存的设置无效，已忽略: %v", err)
+		return
+	}
+	for key, value := range settings {
+		value := value
+		if err := applyConfigSetting(key, func(v interface{}) error { return json.Unmarshal(value, v) }); err != nil {
+			log.Printf("[WARN] 初始化向导保存的设置 %s 无效，已忽略: %v", key, err)
+		}
+	}
+}
+
+func saveSetting(db *gorm.DB, key, value string) error {
+	setting := model.Setting{Key: key, Value: value, UpdatedAt: time.Now()}
+	return db.Save(&setting).Error
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// resetStoredAdminPassword 让下次校验重新从数据库读取管理密码
+func resetStoredAdminPassword() {
+	storedAdminPasswordMu.Lock()
+	storedAdminPassword = ""
+	storedAdminPasswordLoaded = false
+	storedAdminPasswordMu.Unlock()
+}
+
+func TestBootstrap(t *testing.T) {
+	initTestDB(t, "bootstrap.db")
+	t.Setenv("ADMIN_PASSWORD", "")
+	resetStoredAdminPassword()
+	defer resetStoredAdminPassword()
+	prev := GetAccountConcurrency()
+	defer SetAccountConcurrency(prev)
+
+	if !BootstrapRequired() {
+		t.Fatal("fresh deployment should require bootstrap")
+	}
+
+	var invalid *InvalidRequestError
+	if _, err := Bootstrap(BootstrapRequest{AdminPassword: "short"}); !errors.As(err, &invalid) || invalid.Param != "admin_password" {
+		t.Errorf("short password err = %v", err)
+	}
+	_, err := Bootstrap(BootstrapRequest{
+		AdminPassword: "correct horse",
+		APIKeys:       []model.APIKeyRequest{{AllowedModels: []string{"missing-model"}}},
+	})
+	if !errors.As(err, &invalid) || invalid.Param != "api_keys.0" {
+		t.Errorf("invalid key err = %v", err)
+	}
+	if !BootstrapRequired() {
+		t.Fatal("failed bootstrap must not close the endpoint")
+	}
+
+	result, err := Bootstrap(BootstrapRequest{
+		AdminPassword: "correct horse",
+		APIKeys:       []model.APIKeyRequest{{Name: "default"}},
+		Settings:      map[string]json.RawMessage{"account_concurrency": json.RawMessage("2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.APIKeys) != 1 || result.APIKeys[0].Key == "" {
+		t.Fatalf("keys = %+v", result.APIKeys)
+	}
+	if key, err := LookupAPIKey(result.APIKeys[0].Key, time.Now()); err != nil || key == nil {
+		t.Errorf("created key lookup = %+v, %v", key, err)
+	}
+	if got := GetAccountConcurrency(); got != 2 {
+		t.Errorf("account concurrency = %d, want 2", got)
+	}
+	if BootstrapRequired() || !CheckAdminPassword("correct horse") || CheckAdminPassword("wrong password") {
+		t.Error("admin password not applied")
+	}
+	if _, err := Bootstrap(BootstrapRequest{AdminPassword: "another password"}); !errors.Is(err, ErrAlreadyBootstrapped) {
+		t.Errorf("second bootstrap err = %v, want ErrAlreadyBootstrapped", err)
+	}
+
+	// 重启后从数据库读取密码和设置
+	resetStoredAdminPassword()
+	SetAccountConcurrency(1)
+	LoadBootstrapSettings()
+	if !CheckAdminPassword("correct horse") || GetAccountConcurrency() != 2 {
+		t.Error("bootstrap state not persisted")
+	}
+}
+
+func TestBootstrapDatabase(t *testing.T) {
+	dir := t.TempDir()
+	if err := database.Init("sqlite", filepath.Join(dir, "initial.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	initial := database.GetDB()
+	t.Setenv("ADMIN_PASSWORD", "")
+	t.Setenv("BOOTSTRAP_FILE", filepath.Join(dir, "bootstrap.json"))
+	resetStoredAdminPassword()
+	defer resetStoredAdminPassword()
+
+	target := filepath.Join(dir, "target.db")
+	result, err := Bootstrap(BootstrapRequest{
+		AdminPassword: "correct horse",
+		Database:      &BootstrapDatabase{Type: "SQLite", DSN: target},
+	})
+	if err != nil || result.Database != "sqlite" || !result.RestartRequired {
+		t.Fatalf("result = %+v, %v", result, err)
+	}
+	// 当前进程继续使用原数据库，新密码立即生效
+	if database.GetDB() != initial {
+		t.Error("global database replaced before restart")
+	}
+	if BootstrapRequired() || !CheckAdminPassword("correct horse") {
+		t.Error("bootstrap endpoint still open")
+	}
+	if dbType, dsn, ok := LoadBootstrapDatabase(); !ok || dbType != "sqlite" || dsn != target {
+		t.Errorf("saved database = %q %q %v", dbType, dsn, ok)
+	}
+
+	// 管理密码写入了新库
+	if err := database.Init("sqlite", target); err != nil {
+		t.Fatal(err)
+	}
+	resetStoredAdminPassword()
+	if !CheckAdminPassword("correct horse") {
+		t.Error("admin password not stored in the new database")
+	}
+}
+
+func TestAdminPasswordHash(t *testing.T) {
+	hash, err := hashAdminPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := hashAdminPassword("correct horse")
+	if hash == other {
+		t.Error("hashes of the same password should use different salts")
+	}
+	if !strings.HasPrefix(hash, "$2") {
+		t.Errorf("hash = %q, want bcrypt", hash)
+	}
+	if ok, _ := verifyAdminPasswordHash(hash, "correct horse"); !ok {
+		t.Error("correct password rejected")
+	}
+	if ok, _ := verifyAdminPasswordHash(hash, "correct horse "); ok {
+		t.Error("wrong password accepted")
+	}
+	if ok, _ := verifyAdminPasswordHash("garbage", ""); ok {
+		t.Error("garbage hash accepted")
+	}
+
+	// 旧版 salt$sha256 格式可校验，需要改存为 bcrypt
+	legacy := "00$" + fmt.Sprintf("%x", sha256.Sum256([]byte("00correct horse")))
+	if ok, rehash := verifyAdminPasswordHash(legacy, "correct horse"); !ok || !rehash {
+		t.Errorf("legacy hash ok = %v, rehash = %v", ok, rehash)
+	}
+}
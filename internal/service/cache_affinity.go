@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+const (
+	// cacheAffinityTTL Anthropic prompt cache 默认存活 5 分钟，每次命中后重新计时
+	cacheAffinityTTL = 5 * time.Minute
+	// cacheAffinityMaxEntries 记录的前缀数上限，超出时先清理过期条目
+	cacheAffinityMaxEntries = 10000
+)
+
+// 账号亲和选择结果
+const (
+	CacheAffinityHit  = "hit"  // 选中了最近处理过相同前缀的账号
+	CacheAffinityMiss = "miss" // 该账号不可用，改选其他账号
+	CacheAffinityNew  = "new"  // 前缀首次出现或记录已过期
+)
+
+type cacheAffinityEntry struct {
+	accountID uint
+	expires   time.Time
+}
+
+// cacheAffinityTable 记录带 cache_control 的请求前缀最近由哪个账号处理，
+// prompt cache 按 API Key 隔离，同一前缀落到同一账号才能命中缓存
+type cacheAffinityTable struct {
+	mu      sync.Mutex
+	entries map[string]cacheAffinityEntry
+	results map[string]uint64
+}
+
+var cacheAffinity = &cacheAffinityTable{
+	entries: make(map[string]cacheAffinityEntry),
+	results: make(map[string]uint64),
+}
+
+// anthropicCacheKey 请求包含 cache_control 时按模型、system、tools 和第一条消息计算前缀指纹，
+// 同一 Agent 会话的后续轮次共享该前缀；不含缓存提示时返回空字符串
+func anthropicCacheKey(modelID string, body []byte) string {
+	if !bytes.Contains(body, []byte(`"cache_control"`)) {
+		return ""
+	}
+	var req struct {
+		System   json.RawMessage   `json:"system"`
+		Tools    json.RawMessage   `json:"tools"`
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+
+	h := sha256.New()
+	io.WriteString(h, modelID)
+	for _, part := range [][]byte{req.System, req.Tools} {
+		h.Write([]byte{0})
+		h.Write(part)
+	}
+	h.Write([]byte{0})
+	if len(req.Messages) > 0 {
+		h.Write(req.Messages[0])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// lookup 返回最近处理过该前缀且记录未过期的账号，没有时返回 0
+func (t *cacheAffinityTable) lookup(key string, now time.Time) uint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if !ok || now.After(e.expires) {
+		return 0
+	}
+	return e.accountID
+}
+
+// remember 记录处理该前缀的账号
+func (t *cacheAffinityTable) remember(key string, accountID uint, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.entries[key]; !exists && len(t.entries) >= cacheAffinityMaxEntries {
+		for k, e := range t.entries {
+			if now.After(e.expires) {
+				delete(t.entries, k)
+			}
+		}
+		// 仍然已满时随机淘汰一条
+		for k := range t.entries {
+			if len(t.entries) < cacheAffinityMaxEntries {
+				break
+			}
+			delete(t.entries, k)
+		}
+	}
+	t.entries[key] = cacheAffinityEntry{accountID: accountID, expires: now.Add(cacheAffinityTTL)}
+}
+
+func (t *cacheAffinityTable) record(result string) {
+	t.mu.Lock()
+	t.results[result]++
+	t.mu.Unlock()
+}
+
+// GetCacheAffinityStats 返回各选择结果的累计次数
+func GetCacheAffinityStats() map[string]uint64 {
+	cacheAffinity.mu.Lock()
+	defer cacheAffinity.mu.Unlock()
+	stats := map[string]uint64{CacheAffinityHit: 0, CacheAffinityMiss: 0, CacheAffinityNew: 0}
+	for k, v := range cacheAffinity.results {
+		stats[k] = v
+	}
+	return stats
+}
+
+func writeCacheAffinityMetrics(w io.Writer, stats map[string]uint64) {
+	fmt.Fprintln(w, "# TYPE zencoder_cache_affinity counter")
+	fmt.Fprintln(w, "# HELP zencoder_cache_affinity Account selections for requests with cache_control, by whether the account that last served the prompt prefix was reused.")
+	for _, result := range []string{CacheAffinityHit, CacheAffinityMiss, CacheAffinityNew} {
+		fmt.Fprintf(w, "zencoder_cache_affinity_total{result=%q} %d\n", result, stats[result])
+	}
+}
+
+// acquireAccount 请求带缓存提示时优先选择最近处理过相同前缀的账号，仅首次尝试生效，重试和流式续传时正常调度
+func (s *AnthropicService) acquireAccount(ctx context.Context, modelID, cacheKey string, attempt int) (*model.Account, error) {
+	if cacheKey == "" || attempt > 0 || ctx.Value(streamFailoverContextKey) != nil {
+		return s.deps.Accounts.GetNextAccountForModel(modelID)
+	}
+	preferred := cacheAffinity.lookup(cacheKey, time.Now())
+	provider, ok := s.deps.Accounts.(PreferredAccountProvider)
+	if preferred == 0 || !ok {
+		cacheAffinity.record(CacheAffinityNew)
+		return s.deps.Accounts.GetNextAccountForModel(modelID)
+	}
+
+	account, err := provider.GetPreferredAccountForModel(modelID, preferred)
+	if err != nil {
+		return nil, err
+	}
+	if account.ID == preferred {
+		cacheAffinity.record(CacheAffinityHit)
+		DebugLog(ctx, "[CacheAffinity] 复用最近处理过相同前缀的账号 ID:%d", preferred)
+	} else {
+		cacheAffinity.record(CacheAffinityMiss)
+	}
+	return account, nil
+}
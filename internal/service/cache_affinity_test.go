@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestAnthropicCacheKey(t *testing.T) {
+	turn1 := `{"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],"messages":[{"role":"user","content":"fix pool.go"}]}`
+	turn2 := `{"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],"messages":[{"role":"user","content":"fix pool.go"},{"role":"assistant","content":"done"},{"role":"user","content":"thanks"}]}`
+	other := `{"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],"messages":[{"role":"user","content":"write docs"}]}`
+
+	k1 := anthropicCacheKey("claude-sonnet-4-5-20250929", []byte(turn1))
+	if k1 == "" {
+		t.Fatal("request with cache_control should have a key")
+	}
+	if k2 := anthropicCacheKey("claude-sonnet-4-5-20250929", []byte(turn2)); k2 != k1 {
+		t.Error("later turns of the same conversation should share the key")
+	}
+	if anthropicCacheKey("claude-sonnet-4-5-20250929", []byte(other)) == k1 {
+		t.Error("different conversations should not share the key")
+	}
+	if anthropicCacheKey("claude-opus-4-5-20251101", []byte(turn1)) == k1 {
+		t.Error("different models should not share the key")
+	}
+	if anthropicCacheKey("claude-sonnet-4-5-20250929", []byte(`{"messages":[{"role":"user","content":"hi"}]}`)) != "" {
+		t.Error("request without cache_control should not have a key")
+	}
+}
+
+func TestCacheAffinityTableExpires(t *testing.T) {
+	table := &cacheAffinityTable{entries: make(map[string]cacheAffinityEntry), results: make(map[string]uint64)}
+	now := time.Now()
+	table.remember("k", 7, now)
+	if got := table.lookup("k", now.Add(cacheAffinityTTL-time.Second)); got != 7 {
+		t.Errorf("lookup = %d, want 7", got)
+	}
+	if got := table.lookup("k", now.Add(cacheAffinityTTL+time.Second)); got != 0 {
+		t.Errorf("expired lookup = %d, want 0", got)
+	}
+}
+
+func TestGetPreferredAccountForModel(t *testing.T) {
+	now := time.Now()
+	accounts := []*model.Account{
+		{ID: 1, PlanType: model.PlanMax},
+		{ID: 2, PlanType: model.PlanMax},
+	}
+	pool.mu.Lock()
+	saved := pool.accounts
+	pool.accounts = accounts
+	pool.mu.Unlock()
+	defer func() {
+		pool.mu.Lock()
+		pool.accounts = saved
+		pool.mu.Unlock()
+	}()
+	// 2 号账号刚用过，正常调度会选 1 号
+	defer swapAccountStatuses(map[uint]*AccountStatus{
+		1: {LastUsed: now.Add(-time.Hour)},
+		2: {LastUsed: now.Add(-time.Second)},
+	})()
+
+	acc, err := GetPreferredAccountForModel("", 2)
+	if err != nil || acc.ID != 2 {
+		t.Fatalf("got %+v, %v; want preferred account 2", acc, err)
+	}
+	// 2 号账号使用中时退回最长时间未使用的账号
+	acc, err = GetPreferredAccountForModel("", 2)
+	if err != nil || acc.ID != 1 {
+		t.Fatalf("got %+v, %v; want fallback account 1", acc, err)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// 金丝雀分流的两组
+const (
+	CanaryArmControl = "control" // 仍使用原模型
+	CanaryArmCanary  = "canary"  // 改用新模型
+)
+
+// ModelCanary 把原模型的一部分流量切给新模型
+type ModelCanary struct {
+	Target  string `json:"target"`  // 新模型
+	Percent int    `json:"percent"` // 切给新模型的流量百分比，0-100
+}
+
+// canaryArmStats 单组的请求统计
+type canaryArmStats struct {
+	requests  int64
+	errors    int64
+	latencyMs int64
+}
+
+type canaryState struct {
+	config  ModelCanary
+	since   time.Time
+	control canaryArmStats
+	canary  canaryArmStats
+}
+
+var (
+	modelCanariesMu sync.Mutex
+	modelCanaries   = make(map[string]*canaryState)
+)
+
+// SetModelCanary 设置模型的金丝雀分流（仅内存生效），cfg 为 nil 时立即回滚，全部流量回到原模型
+// 只调整比例时保留统计，换目标模型时重新开始；返回设置后（回滚时为回滚前）的统计
+func SetModelCanary(modelID string, cfg *ModelCanary) (*ModelCanaryStatus, error) {
+	if _, ok := model.GetZenModel(modelID); !ok {
+		return nil, fmt.Errorf("unknown model: %s", modelID)
+	}
+	if cfg != nil {
+		if cfg.Target == modelID {
+			return nil, fmt.Errorf("target must differ from the model")
+		}
+		if _, ok := model.GetZenModel(cfg.Target); !ok {
+			return nil, fmt.Errorf("unknown target model: %s", cfg.Target)
+		}
+		if cfg.Percent < 0 || cfg.Percent > 100 {
+			return nil, fmt.Errorf("percent must be between 0 and 100")
+		}
+	}
+
+	modelCanariesMu.Lock()
+	defer modelCanariesMu.Unlock()
+
+	cur := modelCanaries[modelID]
+	if cfg == nil {
+		delete(modelCanaries, modelID)
+		if cur == nil {
+			return nil, nil
+		}
+		status := cur.status(modelID)
+		return &status, nil
+	}
+	if cur != nil && cur.config.Target == cfg.Target {
+		cur.config.Percent = cfg.Percent
+		status := cur.status(modelID)
+		return &status, nil
+	}
+	state := &canaryState{config: *cfg, since: time.Now()}
+	modelCanaries[modelID] = state
+	status := state.status(modelID)
+	return &status, nil
+}
+
+// CanaryDecision 一次请求的分流结果
+type CanaryDecision struct {
+	Model  string // 客户端请求的原模型
+	Target string // 金丝雀目标模型
+	Arm    string // control / canary
+}
+
+// Resolved 实际使用的模型
+func (d CanaryDecision) Resolved() string {
+	if d.Arm == CanaryArmCanary {
+		return d.Target
+	}
+	return d.Model
+}
+
+// PickModelCanary 按比例决定本次请求是否切到新模型，模型没有金丝雀配置时返回 false
+func PickModelCanary(modelID string) (CanaryDecision, bool) {
+	modelCanariesMu.Lock()
+	state := modelCanaries[modelID]
+	var cfg ModelCanary
+	if state != nil {
+		cfg = state.config
+	}
+	modelCanariesMu.Unlock()
+
+	if state == nil {
+		return CanaryDecision{}, false
+	}
+	d := CanaryDecision{Model: modelID, Target: cfg.Target, Arm: CanaryArmControl}
+	if cfg.Percent > 0 && rand.Intn(100) < cfg.Percent {
+		d.Arm = CanaryArmCanary
+	}
+	return d, true
+}
+
+// RecordModelCanaryResult 记录金丝雀请求的结果，状态码 >= 400 计为错误
+// 期间配置已回滚或改为其他目标时忽略
+func RecordModelCanaryResult(d CanaryDecision, status int, latency time.Duration) {
+	modelCanariesMu.Lock()
+	defer modelCanariesMu.Unlock()
+
+	state := modelCanaries[d.Model]
+	if state == nil || state.config.Target != d.Target {
+		return
+	}
+	stats := &state.control
+	if d.Arm == CanaryArmCanary {
+		stats = &state.canary
+	}
+	stats.requests++
+	if status >= 400 {
+		stats.errors++
+	}
+	stats.latencyMs += latency.Milliseconds()
+}
+
+// CanaryArmStatus 单组的对比指标
+type CanaryArmStatus struct {
+	Model        string  `json:"model"`
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"` // 完整响应耗时，流式请求包含输出时间
+}
+
+// ModelCanaryStatus /api/models/canaries 中的一项
+type ModelCanaryStatus struct {
+	Model   string          `json:"model"`
+	Target  string          `json:"target"`
+	Percent int             `json:"percent"`
+	Since   time.Time       `json:"since"`
+	Control CanaryArmStatus `json:"control"`
+	Canary  CanaryArmStatus `json:"canary"`
+}
+
+func (s *canaryState) status(modelID string) ModelCanaryStatus {
+	return ModelCanaryStatus{
+		Model:   modelID,
+		Target:  s.config.Target,
+		Percent: s.config.Percent,
+		Since:   s.since,
+		Control: s.control.status(modelID),
+		Canary:  s.canary.status(s.config.Target),
+	}
+}
+
+func (a canaryArmStats) status(modelID string) CanaryArmStatus {
+	result := CanaryArmStatus{Model: modelID, Requests: a.requests, Errors: a.errors}
+	if a.requests > 0 {
+		result.ErrorRate = float64(a.errors) / float64(a.requests)
+		result.AvgLatencyMs = a.latencyMs / a.requests
+	}
+	return result
+}
+
+// ListModelCanaries 返回所有金丝雀分流及两组的对比指标
+func ListModelCanaries() []ModelCanaryStatus {
+	modelCanariesMu.Lock()
+	defer modelCanariesMu.Unlock()
+
+	result := make([]ModelCanaryStatus, 0, len(modelCanaries))
+	for modelID, state := range modelCanaries {
+		result = append(result, state.status(modelID))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Model < result[j].Model })
+	return result
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModelCanaryLifecycle(t *testing.T) {
+	const old, next = "gpt-5.1-codex", "gpt-5.2-codex"
+	if _, err := SetModelCanary(old, &ModelCanary{Target: "missing", Percent: 10}); err == nil {
+		t.Error("unknown target should be rejected")
+	}
+	if _, err := SetModelCanary(old, &ModelCanary{Target: next, Percent: 101}); err == nil {
+		t.Error("percent above 100 should be rejected")
+	}
+
+	if _, err := SetModelCanary(old, &ModelCanary{Target: next, Percent: 100}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetModelCanary(old, nil)
+
+	d, ok := PickModelCanary(old)
+	if !ok || d.Arm != CanaryArmCanary || d.Resolved() != next {
+		t.Fatalf("decision = %+v, %v", d, ok)
+	}
+	RecordModelCanaryResult(d, 200, 100*time.Millisecond)
+	RecordModelCanaryResult(d, 500, 300*time.Millisecond)
+
+	// 调整比例保留统计
+	if _, err := SetModelCanary(old, &ModelCanary{Target: next, Percent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	d, ok = PickModelCanary(old)
+	if !ok || d.Arm != CanaryArmControl || d.Resolved() != old {
+		t.Fatalf("decision = %+v, %v", d, ok)
+	}
+	RecordModelCanaryResult(d, 200, 50*time.Millisecond)
+
+	list := ListModelCanaries()
+	if len(list) != 1 {
+		t.Fatalf("canaries = %+v", list)
+	}
+	s := list[0]
+	if s.Canary.Requests != 2 || s.Canary.ErrorRate != 0.5 || s.Canary.AvgLatencyMs != 200 || s.Canary.Model != next {
+		t.Errorf("canary arm = %+v", s.Canary)
+	}
+	if s.Control.Requests != 1 || s.Control.Errors != 0 || s.Control.AvgLatencyMs != 50 {
+		t.Errorf("control arm = %+v", s.Control)
+	}
+
+	// 回滚后返回最终统计，不再分流，迟到的结果被忽略
+	final, err := SetModelCanary(old, nil)
+	if err != nil || final == nil || final.Canary.Requests != 2 {
+		t.Fatalf("rollback = %+v, %v", final, err)
+	}
+	if _, ok := PickModelCanary(old); ok {
+		t.Error("canary should be gone after rollback")
+	}
+	RecordModelCanaryResult(d, 200, time.Millisecond)
+	if len(ListModelCanaries()) != 0 {
+		t.Error("late result should not recreate the canary")
+	}
+}
@@ -0,0 +1,143 @@
+// Package classifier 按响应体识别 Anthropic 上游的 400/413/429/500 错误，
+// 识别规则由 testdata 中收集的真实错误响应驱动测试，命中次数作为指标输出，上游改动错误文案时能及时发现
+package classifier
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Class 错误分类
+type Class string
+
+const (
+	None              Class = ""                    // 不在识别范围内的状态码
+	Unknown           Class = "unknown"             // 状态码在识别范围内但没有命中任何规则
+	PromptTooLong     Class = "prompt_too_long"     // 输入超过上下文窗口
+	ThinkingFormat    Class = "thinking_format"     // 启用 thinking 时历史 assistant 消息缺少 thinking 块
+	ThinkingSignature Class = "thinking_signature"  // 历史 thinking 块的签名失效，可转换 assistant 消息后重试
+	Temperature       Class = "temperature"         // 模型要求 temperature=1.0，可强制设置后重试
+	ParameterConflict Class = "parameter_conflict"  // temperature 与 top_p 不能同时指定，可去掉 top_p 后重试
+	KnownInvalid      Class = "known_invalid"       // 其余 Anthropic 原生格式的已知错误，原样返回客户端
+	OfficialRateLimit Class = "official_rate_limit" // Claude 官方的 429，消息中带有官方文档链接
+	ClaudeRateLimit   Class = "claude_rate_limit"   // rate_limit_error 格式但没有官方文档链接
+	GCPRateLimit      Class = "gcp_rate_limit"      // Vertex 的 RESOURCE_EXHAUSTED
+	RateLimitTracking Class = "rate_limit_tracking" // 500 Rate limit tracking problem，冻结账号后换号重试
+)
+
+// knownErrorTypes 视为已知错误的 Anthropic error.type
+var knownErrorTypes = map[string]bool{
+	"invalid_request_error": true,
+	"authentication_error":  true,
+	"permission_error":      true,
+	"rate_limit_error":      true,
+	"request_too_large":     true,
+}
+
+// anthropicError Anthropic 原生错误格式 {"type":"error","error":{"type":...,"message":...}}
+type anthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// gcpError Google API 错误格式 {"error":{"code":429,"message":...,"status":...}}
+type gcpError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// IsPromptTooLong 输入超过上下文窗口
+func IsPromptTooLong(body string) bool {
+	return strings.Contains(strings.ToLower(body), "prompt is too long")
+}
+
+// IsThinkingFormat 启用 thinking 时 assistant 消息缺少 thinking 块
+func IsThinkingFormat(body string) bool {
+	return strings.Contains(body, "When `thinking` is enabled") ||
+		strings.Contains(body, "Expected `thinking` or `redacted_thinking`") ||
+		strings.Contains(body, "To avoid this requirement, disable `thinking`")
+}
+
+// IsThinkingSignature thinking 块签名过期或无效
+func IsThinkingSignature(body string) bool {
+	return strings.Contains(body, "Invalid `signature` in `thinking` block") ||
+		strings.Contains(body, "invalid_request_error") && strings.Contains(body, "signature")
+}
+
+// IsTemperature 模型要求 temperature=1.0
+func IsTemperature(body string) bool {
+	return strings.Contains(body, "requires temperature=1.0") ||
+		strings.Contains(body, "Parallel Thinking' requires temperature")
+}
+
+// IsParameterConflict temperature 与 top_p 同时指定
+func IsParameterConflict(body string) bool {
+	return strings.Contains(body, "`temperature` and `top_p` cannot both be specified")
+}
+
+// IsRateLimitTracking 上游限速跟踪出错导致的 500
+func IsRateLimitTracking(body string) bool {
+	return strings.Contains(body, "Rate limit tracking problem")
+}
+
+// IsOfficialRateLimit 判断 429 是否来自 Claude 官方：Anthropic 错误格式、rate_limit_error 且消息带有官方域名。
+// 无法确定时保守地返回 false，不把原始响应透传给客户端
+func IsOfficialRateLimit(body string) bool {
+	var e anthropicError
+	if json.Unmarshal([]byte(body), &e) != nil {
+		return false
+	}
+	return e.Type == "error" && e.Error.Type == "rate_limit_error" &&
+		(strings.Contains(e.Error.Message, "anthropic.com") || strings.Contains(e.Error.Message, "claude.com"))
+}
+
+// Classify 按状态码和响应体给出错误分类，不计数；同一响应可能命中多条规则时按可重试的修复优先
+func Classify(status int, body []byte) Class {
+	text := string(body)
+	switch status {
+	case 400, 413:
+		switch {
+		case IsThinkingSignature(text):
+			return ThinkingSignature
+		case IsThinkingFormat(text):
+			return ThinkingFormat
+		case IsParameterConflict(text):
+			return ParameterConflict
+		case IsTemperature(text):
+			return Temperature
+		case IsPromptTooLong(text):
+			return PromptTooLong
+		}
+		var e anthropicError
+		if json.Unmarshal(body, &e) == nil && e.Error.Type != "" &&
+			(knownErrorTypes[e.Error.Type] || strings.Contains(strings.ToLower(e.Error.Message), "max_tokens")) {
+			return KnownInvalid
+		}
+		return Unknown
+	case 429:
+		if IsOfficialRateLimit(text) {
+			return OfficialRateLimit
+		}
+		var e anthropicError
+		if json.Unmarshal(body, &e) == nil && e.Type == "error" && e.Error.Type == "rate_limit_error" {
+			return ClaudeRateLimit
+		}
+		var g gcpError
+		if json.Unmarshal(body, &g) == nil && g.Error.Code == 429 && g.Error.Status == "RESOURCE_EXHAUSTED" {
+			return GCPRateLimit
+		}
+		return Unknown
+	case 500:
+		if IsRateLimitTracking(text) {
+			return RateLimitTracking
+		}
+		return Unknown
+	}
+	return None
+}
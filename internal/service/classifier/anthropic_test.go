@@ -0,0 +1,68 @@
+package classifier
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// corpusEntry testdata/anthropic_errors.json 中的一条真实错误响应
+// 上游出现新的错误文案时追加到语料中，并写明期望的分类
+type corpusEntry struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Class  Class  `json:"class"`
+	Body   string `json:"body"`
+}
+
+func loadCorpus(t *testing.T) []corpusEntry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "anthropic_errors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corpus []corpusEntry
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		t.Fatal(err)
+	}
+	return corpus
+}
+
+func TestClassifyCorpus(t *testing.T) {
+	covered := make(map[Class]bool)
+	for _, entry := range loadCorpus(t) {
+		if got := Classify(entry.Status, []byte(entry.Body)); got != entry.Class {
+			t.Errorf("%s: Classify(%d) = %q, want %q", entry.Name, entry.Status, got, entry.Class)
+		}
+		covered[entry.Class] = true
+	}
+	// 每个分类至少有一条语料，新增分类时需要同时补充真实样本
+	for _, class := range []Class{Unknown, PromptTooLong, ThinkingFormat, ThinkingSignature, Temperature, ParameterConflict,
+		KnownInvalid, OfficialRateLimit, ClaudeRateLimit, GCPRateLimit, RateLimitTracking} {
+		if !covered[class] {
+			t.Errorf("class %q has no corpus entry", class)
+		}
+	}
+}
+
+func TestObserveCountsHits(t *testing.T) {
+	count := func(status int, class Class) uint64 {
+		for _, h := range Hits() {
+			if h.Status == status && h.Class == class {
+				return h.Count
+			}
+		}
+		return 0
+	}
+	before := count(429, GCPRateLimit)
+	body := []byte(`{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`)
+	Observe(429, body)
+	Observe(429, body)
+	if got := count(429, GCPRateLimit); got != before+2 {
+		t.Errorf("hits = %d, want %d", got, before+2)
+	}
+	if Observe(503, body) != None || count(503, None) != 0 {
+		t.Error("statuses outside the classifier should not be counted")
+	}
+}
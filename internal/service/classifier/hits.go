@@ -0,0 +1,52 @@
+package classifier
+
+import (
+	"sort"
+	"sync"
+)
+
+type hitKey struct {
+	status int
+	class  Class
+}
+
+var (
+	hitsMu sync.Mutex
+	hits   = make(map[hitKey]uint64)
+)
+
+// Hit 某状态码下某分类的命中次数
+type Hit struct {
+	Status int    `json:"status"`
+	Class  Class  `json:"class"`
+	Count  uint64 `json:"count"`
+}
+
+// Observe 分类一次上游错误响应并计数，每个上游响应只应调用一次
+func Observe(status int, body []byte) Class {
+	class := Classify(status, body)
+	if class == None {
+		return class
+	}
+	hitsMu.Lock()
+	hits[hitKey{status: status, class: class}]++
+	hitsMu.Unlock()
+	return class
+}
+
+// Hits 返回各状态码、分类的累计命中次数，按状态码和分类排序
+func Hits() []Hit {
+	hitsMu.Lock()
+	result := make([]Hit, 0, len(hits))
+	for k, n := range hits {
+		result = append(result, Hit{Status: k.status, Class: k.class, Count: n})
+	}
+	hitsMu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Status != result[j].Status {
+			return result[i].Status < result[j].Status
+		}
+		return result[i].Class < result[j].Class
+	})
+	return result
+}
@@ -0,0 +1,468 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"zencoder2api/internal/model"
+)
+
+// ConfigSchemaVersion 配置文档的格式版本，不兼容的改动时递增
+const ConfigSchemaVersion = 1
+
+// 配置变更的类型
+const (
+	ConfigChangeAdd    = "add"
+	ConfigChangeUpdate = "update"
+	ConfigChangeRemove = "remove"
+)
+
+// ConfigDocument 网关运行时配置的完整快照，用于在测试与生产环境之间同步及在 git 中审阅
+// 导入时省略（或为 null）的部分保持不变；models 和 keys 仅供审阅，导入时忽略：
+// 模型表以上游同步为准，按 API Key 的规则导出时已脱敏，无法还原
+type ConfigDocument struct {
+	SchemaVersion     int                                `json:"schema_version"`
+	Settings          *ConfigSettings                    `json:"settings,omitempty"`
+	ProviderTimeouts  map[string]model.TimeoutConfig     `json:"provider_timeouts"`
+	ModelTimeouts     map[string]model.TimeoutConfig     `json:"model_timeouts"`
+	Transports        map[string]string                  `json:"transports"`
+	Deprecations      map[string]model.ModelDeprecation  `json:"deprecations"`
+	ParameterProfiles map[string]model.ParameterOverride `json:"parameter_profiles"`
+	Canaries          map[string]ModelCanary             `json:"canaries"`
+	ThinkingLimits    map[string]int                     `json:"thinking_limits"`
+	Aliases           map[string]string                  `json:"aliases"`       // Ollama 模型名映射
+	StreamPacing      map[string]StreamPacingRule        `json:"stream_pacing"` // 按模型的平滑输出规则
+	Models            map[string]model.ZenModel          `json:"models,omitempty"`
+	Keys              *ConfigKeyRules                    `json:"keys,omitempty"`
+}
+
+// ConfigSettings 全局设置
+type ConfigSettings struct {
+	PremiumReserve           int                     `json:"premium_reserve"`
+	AccountConcurrency       int                     `json:"account_concurrency"`
+	StreamCredit             StreamCreditSettings    `json:"stream_credit"`
+	RequestLimits            RequestLimitSettings    `json:"request_limits"`
+	ModerationURL            string                  `json:"moderation_url"`
+	Moderation               ModerationRule          `json:"moderation"`
+	ServiceTier              ServiceTierRule         `json:"service_tier"`
+	ResponseHeaders          string                  `json:"response_headers"`
+	EndUserRequestsPerMinute int                     `json:"end_user_requests_per_minute"`
+	EmailRedaction           string                  `json:"email_redaction"`
+	RequestValidation        string                  `json:"request_validation"`
+	ThinkingDisable          string                  `json:"thinking_disable"`
+	IdentityProbe            IdentityProbeSettings   `json:"identity_probe"`
+	AnthropicBeta            AnthropicBetaSettings   `json:"anthropic_beta"`
+	ModelRouter              ModelRouterSettings     `json:"model_router"`
+	StreamPacing             StreamPacingRule        `json:"stream_pacing"`
+	StreamKeepAlive          StreamKeepAliveSettings `json:"stream_keepalive"`
+	ProxyHealth              ProxyHealthSettings     `json:"proxy_health"`
+	UsageAnomaly             UsageAnomalySettings    `json:"usage_anomaly"`
+}
+
+// ConfigKeyRules 按 API Key（已脱敏）的规则
+type ConfigKeyRules struct {
+	ServiceTier     map[string]ServiceTierRule  `json:"service_tier"`
+	Moderation      map[string]ModerationRule   `json:"moderation"`
+	ResponseHeaders map[string]string           `json:"response_headers"`
+	EndUserLimits   map[string]int              `json:"end_user_limits"`
+	AllowedIPs      map[string][]string         `json:"allowed_ips"`
+	StreamPacing    map[string]StreamPacingRule `json:"stream_pacing"`
+}
+
+// ConfigChange 导入时与当前配置的一处差异
+type ConfigChange struct {
+	Path   string          `json:"path"` // 例如 settings.premium_reserve、canaries.gpt-5
+	Action string          `json:"action"`
+	From   json.RawMessage `json:"from,omitempty"`
+	To     json.RawMessage `json:"to,omitempty"`
+	Error  string          `json:"error,omitempty"` // 应用失败的原因，其余变更仍会应用
+}
+
+// ExportConfig 导出当前运行时配置
+func ExportConfig() ConfigDocument {
+	moderation := GetModerationSettings()
+	serviceTier := GetServiceTierSettings()
+	responseHeaders := GetResponseHeaderSettings()
+	endUser := GetEndUserLimitSettings("")
+	streamPacing := GetStreamPacingSettings()
+
+	doc := ConfigDocument{
+		SchemaVersion: ConfigSchemaVersion,
+		Settings: &ConfigSettings{
+			PremiumReserve:           GetPremiumReserve(),
+			AccountConcurrency:       GetAccountConcurrency(),
+			StreamCredit:             GetStreamCreditSettings(),
+			RequestLimits:            GetRequestLimitSettings(),
+			ModerationURL:            moderation.URL,
+			Moderation:               moderation.ModerationRule,
+			ServiceTier:              serviceTier.ServiceTierRule,
+			ResponseHeaders:          responseHeaders.Policy,
+			EndUserRequestsPerMinute: endUser.RequestsPerMinute,
+			EmailRedaction:           GetEmailRedaction(),
+			RequestValidation:        GetRequestValidation(),
+			ThinkingDisable:          GetThinkingDisablePolicy(),
+			IdentityProbe:            GetIdentityProbeSettings(),
+			AnthropicBeta:            GetAnthropicBetaSettings(),
+			ModelRouter:              GetModelRouterSettings(),
+			StreamPacing:             streamPacing.StreamPacingRule,
+			StreamKeepAlive:          GetStreamKeepAliveSettings(),
+			ProxyHealth:              GetProxyHealthSettings(),
+			UsageAnomaly:             GetUsageAnomalySettings(),
+		},
+		ProviderTimeouts:  GetProviderTimeouts(),
+		ModelTimeouts:     make(map[string]model.TimeoutConfig),
+		Transports:        GetUpstreamTransports(),
+		Deprecations:      make(map[string]model.ModelDeprecation),
+		ParameterProfiles: model.ListParameterOverrides(),
+		Canaries:          make(map[string]ModelCanary),
+		ThinkingLimits:    GetThinkingTokenLimits(),
+		Aliases:           GetOllamaAliases(),
+		StreamPacing:      streamPacing.Models,
+		Models:            make(map[string]model.ZenModel),
+		Keys: &ConfigKeyRules{
+			ServiceTier:     serviceTier.Keys,
+			Moderation:      moderation.Keys,
+			ResponseHeaders: responseHeaders.Keys,
+			EndUserLimits:   endUser.KeyLimits,
+			AllowedIPs:      GetKeyGuardSettings().AllowedIPs,
+			StreamPacing:    streamPacing.Keys,
+		},
+	}
+
+	providerTimeoutsMu.RLock()
+	for id, cfg := range modelTimeoutOverrides {
+		doc.ModelTimeouts[id] = cfg
+	}
+	providerTimeoutsMu.RUnlock()
+
+	modelDeprecationsOnce.Do(loadModelDeprecations)
+	modelDeprecationsMu.RLock()
+	for id, dep := range modelDeprecations {
+		doc.Deprecations[id] = dep
+	}
+	modelDeprecationsMu.RUnlock()
+
+	modelCanariesMu.Lock()
+	for id, state := range modelCanaries {
+		doc.Canaries[id] = state.config
+	}
+	modelCanariesMu.Unlock()
+
+	ids := model.ListZenModelIDs()
+	for i, m := range model.ListZenModels() {
+		doc.Models[ids[i]] = m
+	}
+	return doc
+}
+
+// ImportConfig 比较文档与当前配置，dryRun 为 false 时逐项应用差异（仅内存生效，重启后以环境变量为准）
+// 返回全部差异，应用失败的变更带 Error；只有文档版本不受支持时返回 error
+func ImportConfig(doc ConfigDocument, dryRun bool) ([]ConfigChange, error) {
+	if doc.SchemaVersion != ConfigSchemaVersion {
+		return nil, &InvalidRequestError{Message: fmt.Sprintf("unsupported schema_version %d, expected %d", doc.SchemaVersion, ConfigSchemaVersion)}
+	}
+
+	current := ExportConfig()
+	sections := []struct {
+		name      string
+		cur, next interface{}
+		present   bool
+	}{
+		// 先应用全局设置和超时，再应用依赖模型表的配置
+		{"settings", current.Settings, doc.Settings, doc.Settings != nil},
+		{"provider_timeouts", current.ProviderTimeouts, doc.ProviderTimeouts, doc.ProviderTimeouts != nil},
+		{"model_timeouts", current.ModelTimeouts, doc.ModelTimeouts, doc.ModelTimeouts != nil},
+		{"transports", current.Transports, doc.Transports, doc.Transports != nil},
+		{"deprecations", current.Deprecations, doc.Deprecations, doc.Deprecations != nil},
+		{"parameter_profiles", current.ParameterProfiles, doc.ParameterProfiles, doc.ParameterProfiles != nil},
+		{"canaries", current.Canaries, doc.Canaries, doc.Canaries != nil},
+		{"thinking_limits", current.ThinkingLimits, doc.ThinkingLimits, doc.ThinkingLimits != nil},
+		{"aliases", current.Aliases, doc.Aliases, doc.Aliases != nil},
+		{"stream_pacing", current.StreamPacing, doc.StreamPacing, doc.StreamPacing != nil},
+	}
+
+	changes := []ConfigChange{}
+	for _, s := range sections {
+		if !s.present {
+			continue
+		}
+		diff, err := diffConfigSection(s.name, s.cur, s.next)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range diff {
+			if !dryRun {
+				if err := applyConfigChange(s.name, change); err != nil {
+					change.Error = err.Error()
+				}
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// diffConfigSection 按 JSON 字段（结构体）或键（map）比较两份配置，结果按键排序
+func diffConfigSection(section string, cur, next interface{}) ([]ConfigChange, error) {
+	curFields, err := configFields(cur)
+	if err != nil {
+		return nil, err
+	}
+	nextFields, err := configFields(next)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(curFields)+len(nextFields))
+	for k := range curFields {
+		keys = append(keys, k)
+	}
+	for k := range nextFields {
+		if _, ok := curFields[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []ConfigChange
+	for _, k := range keys {
+		from, hadFrom := curFields[k]
+		to, hasTo := nextFields[k]
+		change := ConfigChange{Path: section + "." + k, From: from, To: to}
+		switch {
+		case !hadFrom:
+			change.Action = ConfigChangeAdd
+		case !hasTo:
+			change.Action = ConfigChangeRemove
+		case !bytes.Equal(from, to):
+			change.Action = ConfigChangeUpdate
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// configFields 把一部分配置转换为 JSON 字段，重新编码以便逐字节比较
+func configFields(v interface{}) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for k, field := range fields {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, field); err != nil {
+			return nil, err
+		}
+		fields[k] = buf.Bytes()
+	}
+	return fields, nil
+}
+
+// applyConfigChange 调用对应的运行时设置接口应用一处差异
+func applyConfigChange(section string, change ConfigChange) error {
+	key := change.Path[len(section)+1:]
+	remove := change.Action == ConfigChangeRemove
+	decode := func(v interface{}) error {
+		if remove {
+			return nil
+		}
+		return json.Unmarshal(change.To, v)
+	}
+
+	switch section {
+	case "settings":
+		return applyConfigSetting(key, decode)
+	case "provider_timeouts", "model_timeouts":
+		var cfg model.TimeoutConfig
+		if err := decode(&cfg); err != nil {
+			return err
+		}
+		if section == "model_timeouts" {
+			return SetModelTimeouts(key, cfg)
+		}
+		return SetProviderTimeouts(key, cfg)
+	case "transports":
+		var mode string
+		if err := decode(&mode); err != nil {
+			return err
+		}
+		return SetUpstreamTransport(key, mode)
+	case "deprecations":
+		if remove {
+			return SetModelDeprecation(key, nil)
+		}
+		var dep model.ModelDeprecation
+		if err := decode(&dep); err != nil {
+			return err
+		}
+		return SetModelDeprecation(key, &dep)
+	case "parameter_profiles":
+		if remove {
+			model.ClearParameterOverride(key)
+			return nil
+		}
+		var o model.ParameterOverride
+		if err := decode(&o); err != nil {
+			return err
+		}
+		return model.SetParameterOverride(key, o)
+	case "canaries":
+		var cfg *ModelCanary
+		if !remove {
+			cfg = &ModelCanary{}
+			if err := decode(cfg); err != nil {
+				return err
+			}
+		}
+		_, err := SetModelCanary(key, cfg)
+		return err
+	case "thinking_limits":
+		var limit int
+		if err := decode(&limit); err != nil {
+			return err
+		}
+		return SetThinkingTokenLimit(key, limit)
+	case "aliases":
+		var target string
+		if err := decode(&target); err != nil {
+			return err
+		}
+		return SetOllamaAlias(key, target)
+	case "stream_pacing":
+		var rule StreamPacingRule
+		if err := decode(&rule); err != nil {
+			return err
+		}
+		return SetStreamPacingRule("", key, rule)
+	}
+	return fmt.Errorf("unknown section: %s", section)
+}
+
+func applyConfigSetting(key string, decode func(v interface{}) error) error {
+	switch key {
+	case "premium_reserve":
+		var n int
+		if err := decode(&n); err != nil {
+			return err
+		}
+		return SetPremiumReserve(n)
+	case "account_concurrency":
+		var n int
+		if err := decode(&n); err != nil {
+			return err
+		}
+		return SetAccountConcurrency(n)
+	case "stream_credit":
+		var settings StreamCreditSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetStreamCreditSettings(settings)
+	case "request_limits":
+		var settings RequestLimitSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetRequestLimitSettings(settings)
+	case "moderation_url":
+		var rawURL string
+		if err := decode(&rawURL); err != nil {
+			return err
+		}
+		return SetModerationURL(rawURL)
+	case "moderation":
+		var rule ModerationRule
+		if err := decode(&rule); err != nil {
+			return err
+		}
+		return SetModerationRule("", rule)
+	case "service_tier":
+		var rule ServiceTierRule
+		if err := decode(&rule); err != nil {
+			return err
+		}
+		return SetServiceTierRule("", rule)
+	case "response_headers":
+		var policy string
+		if err := decode(&policy); err != nil {
+			return err
+		}
+		return SetResponseHeaderPolicy("", policy)
+	case "end_user_requests_per_minute":
+		var n int
+		if err := decode(&n); err != nil {
+			return err
+		}
+		SetEndUserRateLimit("", n)
+		return nil
+	case "email_redaction":
+		var mode string
+		if err := decode(&mode); err != nil {
+			return err
+		}
+		return SetEmailRedaction(mode)
+	case "request_validation":
+		var mode string
+		if err := decode(&mode); err != nil {
+			return err
+		}
+		return SetRequestValidation(mode)
+	case "thinking_disable":
+		var policy string
+		if err := decode(&policy); err != nil {
+			return err
+		}
+		return SetThinkingDisablePolicy(policy)
+	case "identity_probe":
+		var settings IdentityProbeSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetIdentityProbeSettings(settings)
+	case "anthropic_beta":
+		var settings AnthropicBetaSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetAnthropicBetaSettings(settings)
+	case "model_router":
+		var settings ModelRouterSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetModelRouterSettings(settings)
+	case "stream_pacing":
+		var rule StreamPacingRule
+		if err := decode(&rule); err != nil {
+			return err
+		}
+		return SetStreamPacingRule("", "", rule)
+	case "stream_keepalive":
+		var settings StreamKeepAliveSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetStreamKeepAliveSettings(settings)
+	case "proxy_health":
+		var settings ProxyHealthSettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetProxyHealthSettings(settings)
+	case "usage_anomaly":
+		var settings UsageAnomalySettings
+		if err := decode(&settings); err != nil {
+			return err
+		}
+		return SetUsageAnomalySettings(settings)
+	}
+	return fmt.Errorf("unknown setting: %s", key)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfigExportImportRoundTrip(t *testing.T) {
+	original := ExportConfig()
+	defer func() {
+		SetModelCanary("gpt-5.1-codex", nil)
+		SetOllamaAlias("llama3", "")
+		SetPremiumReserve(original.Settings.PremiumReserve)
+	}()
+
+	// 模拟从另一个实例导出的文档经过 JSON 传输
+	raw, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc ConfigDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := ImportConfig(doc, false); err != nil || len(changes) != 0 {
+		t.Fatalf("re-importing the export should be a no-op, got %+v, %v", changes, err)
+	}
+
+	doc.Settings.PremiumReserve = original.Settings.PremiumReserve + 2
+	doc.Canaries["gpt-5.1-codex"] = ModelCanary{Target: "gpt-5.2-codex", Percent: 5}
+	doc.Aliases["llama3"] = "missing-model"
+	doc.Transports = nil // 省略的部分保持不变
+
+	changes, err := ImportConfig(doc, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("changes = %+v, want 3", changes)
+	}
+	if GetPremiumReserve() != original.Settings.PremiumReserve {
+		t.Fatal("dry run must not apply changes")
+	}
+
+	changes, err = ImportConfig(doc, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]ConfigChange)
+	for _, c := range changes {
+		byPath[c.Path] = c
+	}
+	if c := byPath["settings.premium_reserve"]; c.Action != ConfigChangeUpdate || c.Error != "" {
+		t.Errorf("premium reserve change = %+v", c)
+	}
+	if c := byPath["canaries.gpt-5.1-codex"]; c.Action != ConfigChangeAdd || c.Error != "" {
+		t.Errorf("canary change = %+v", c)
+	}
+	if c := byPath["aliases.llama3"]; c.Error == "" {
+		t.Errorf("alias to unknown model should fail, got %+v", c)
+	}
+	if GetPremiumReserve() != original.Settings.PremiumReserve+2 {
+		t.Errorf("premium reserve = %d", GetPremiumReserve())
+	}
+	if got := ExportConfig().Canaries["gpt-5.1-codex"]; got.Target != "gpt-5.2-codex" || got.Percent != 5 {
+		t.Errorf("canary = %+v", got)
+	}
+
+	// 文档中删除的条目会被撤销
+	delete(doc.Canaries, "gpt-5.1-codex")
+	changes, _ = ImportConfig(doc, false)
+	if _, ok := ExportConfig().Canaries["gpt-5.1-codex"]; ok {
+		t.Errorf("canary should be removed, changes = %+v", changes)
+	}
+
+	doc.SchemaVersion = ConfigSchemaVersion + 1
+	if _, err := ImportConfig(doc, true); err == nil {
+		t.Error("unsupported schema version should be rejected")
+	}
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/model"
+)
+
+// 上下文压缩模式
+const (
+	ContextCompressionOff    = "off"
+	ContextCompressionOn     = "on"     // 所有超过阈值的请求都压缩
+	ContextCompressionHeader = "header" // 仅压缩带 X-Context-Compression: on 的请求
+)
+
+// 请求体格式
+const (
+	ContextFormatOpenAI    = "openai"    // /v1/chat/completions
+	ContextFormatAnthropic = "anthropic" // /v1/messages
+)
+
+const (
+	// contextBlockMaxChars 生成摘要时单个内容块保留的最大字符数
+	contextBlockMaxChars = 2000
+	// contextTranscriptMaxChars 发送给摘要模型的对话记录上限，超出时保留最近的部分
+	contextTranscriptMaxChars = 400000
+	contextSummaryPrefix      = "[Summary of the earlier conversation]\n"
+	contextSummaryAck         = "Understood. I will continue from this summary."
+)
+
+const contextSummaryPrompt = `Summarize the earlier part of a conversation between a user and an AI assistant so the assistant can continue without the original messages.
+Keep every fact, decision, file path, code identifier, command, error message, open task and user preference that may matter later. Omit pleasantries. Be concise.
+
+<transcript>
+%s
+</transcript>`
+
+// ContextCompressionConfig 上下文压缩配置
+type ContextCompressionConfig struct {
+	Mode            string `json:"mode"`
+	ThresholdTokens int    `json:"thresholdTokens"` // 估算输入超过该值才压缩
+	KeepMessages    int    `json:"keepMessages"`    // 保留原样的最近消息数
+	Model           string `json:"model"`           // 生成摘要的模型
+}
+
+var (
+	contextCompressionConfig     ContextCompressionConfig
+	contextCompressionConfigOnce sync.Once
+)
+
+// GetContextCompressionConfig 读取 CONTEXT_COMPRESSION / CONTEXT_COMPRESSION_THRESHOLD /
+// CONTEXT_COMPRESSION_KEEP_MESSAGES / CONTEXT_COMPRESSION_MODEL
+func GetContextCompressionConfig() ContextCompressionConfig {
+	contextCompressionConfigOnce.Do(func() {
+		mode := strings.ToLower(strings.TrimSpace(os.Getenv("CONTEXT_COMPRESSION")))
+		switch mode {
+		case "", "false", "0", ContextCompressionOff:
+			mode = ContextCompressionOff
+		case "true", "1", ContextCompressionOn:
+			mode = ContextCompressionOn
+		case ContextCompressionHeader:
+		default:
+			log.Printf("[WARN] 无效的 CONTEXT_COMPRESSION: %s，已关闭上下文压缩", mode)
+			mode = ContextCompressionOff
+		}
+		summaryModel := strings.TrimSpace(os.Getenv("CONTEXT_COMPRESSION_MODEL"))
+		if summaryModel == "" {
+			summaryModel = "gpt-5-nano-2025-08-07"
+		}
+		contextCompressionConfig = ContextCompressionConfig{
+			Mode:            mode,
+			ThresholdTokens: envPositiveInt("CONTEXT_COMPRESSION_THRESHOLD", 100000),
+			KeepMessages:    envPositiveInt("CONTEXT_COMPRESSION_KEEP_MESSAGES", 10),
+			Model:           summaryModel,
+		}
+		if mode != ContextCompressionOff {
+			log.Printf("[INFO] 已启用上下文压缩 (模式 %s，阈值约 %d tokens，摘要模型 %s)", mode, contextCompressionConfig.ThresholdTokens, summaryModel)
+		}
+	})
+	return contextCompressionConfig
+}
+
+// contextSummarizer 用指定模型对提示词生成摘要，测试时可替换
+var contextSummarizer = summarizeWithModel
+
+// summarizeWithModel 在进程内以非流式请求调用摘要模型，走正常的账号调度
+func summarizeWithModel(ctx context.Context, modelID, prompt string) (string, error) {
+	zenModel, ok := model.GetZenModel(modelID)
+	if !ok {
+		return "", fmt.Errorf("摘要模型不存在: %s", modelID)
+	}
+	messages := []map[string]string{{"role": "user", "content": prompt}}
+	rec := httptest.NewRecorder()
+
+	switch zenModel.ProviderID {
+	case "anthropic":
+		body, _ := json.Marshal(map[string]interface{}{"model": modelID, "max_tokens": 4096, "messages": messages})
+		if err := NewAnthropicService().MessagesProxy(ctx, rec, body); err != nil {
+			return "", err
+		}
+		if rec.Code >= 400 {
+			return "", fmt.Errorf("摘要模型返回 %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, block := range resp.Content {
+			if block.Type == "text" {
+				sb.WriteString(block.Text)
+			}
+		}
+		return strings.TrimSpace(sb.String()), nil
+	case "openai":
+		body, _ := json.Marshal(map[string]interface{}{"model": modelID, "messages": messages, "stream": false})
+		if err := NewOpenAIService().ChatCompletionsProxy(ctx, rec, body); err != nil {
+			return "", err
+		}
+		if rec.Code >= 400 {
+			return "", fmt.Errorf("摘要模型返回 %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp model.ChatCompletionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("摘要模型没有返回内容")
+		}
+		return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+	default:
+		return "", fmt.Errorf("摘要模型 %s 的服务商 %s 不支持", modelID, zenModel.ProviderID)
+	}
+}
+
+// ContextCompressionResult 一次压缩的结果
+type ContextCompressionResult struct {
+	Body         []byte
+	Compressed   int // 被摘要替换的消息数，0 表示未压缩
+	TokensBefore int
+	TokensAfter  int
+}
+
+// estimateTokens 按 JSON 字节数粗略估算 token 数（约 4 字节一个 token）
+func estimateTokens(raw []byte) int {
+	return len(raw) / 4
+}
+
+// CompressContext 估算输入超过阈值时，把较早的消息替换为摘要，保留系统提示和最近的消息
+// 不满足压缩条件时返回原请求体，Compressed 为 0
+func CompressContext(ctx context.Context, format string, body []byte, cfg ContextCompressionConfig) (ContextCompressionResult, error) {
+	result := ContextCompressionResult{Body: body, TokensBefore: estimateTokens(body)}
+	if result.TokensBefore <= cfg.ThresholdTokens {
+		return result, nil
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return result, nil
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(req["messages"], &messages); err != nil {
+		return result, nil
+	}
+
+	// OpenAI 格式的系统提示位于消息开头，保持不动
+	head := 0
+	if format == ContextFormatOpenAI {
+		for head < len(messages) && isSystemMessage(messages[head]) {
+			head++
+		}
+	}
+	rest := messages[head:]
+
+	// 从保留窗口的起点向后找到普通用户消息，避免拆开 tool_use 与 tool_result
+	split := len(rest) - cfg.KeepMessages
+	if split < 0 {
+		split = 0
+	}
+	for split < len(rest) && !isPlainUserMessage(rest[split]) {
+		split++
+	}
+	if split < 2 || split >= len(rest) {
+		return result, nil
+	}
+
+	summary, err := contextSummarizer(ctx, cfg.Model, fmt.Sprintf(contextSummaryPrompt, renderTranscript(rest[:split])))
+	if err != nil {
+		return result, err
+	}
+	if summary == "" {
+		return result, fmt.Errorf("摘要为空")
+	}
+
+	summaryMsg, _ := json.Marshal(map[string]string{"role": "user", "content": contextSummaryPrefix + summary})
+	ackMsg, _ := json.Marshal(map[string]string{"role": "assistant", "content": contextSummaryAck})
+	compressed := make([]json.RawMessage, 0, head+2+len(rest)-split)
+	compressed = append(compressed, messages[:head]...)
+	compressed = append(compressed, summaryMsg, ackMsg)
+	compressed = append(compressed, rest[split:]...)
+
+	req["messages"], _ = json.Marshal(compressed)
+	newBody, err := json.Marshal(req)
+	if err != nil {
+		return result, err
+	}
+	result.Body = newBody
+	result.Compressed = split
+	result.TokensAfter = estimateTokens(newBody)
+	DebugLog(ctx, "[ContextCompression] 已将 %d 条较早的消息替换为摘要，约 %d → %d tokens", split, result.TokensBefore, result.TokensAfter)
+	return result, nil
+}
+
+type contextMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type contextBlock struct {
+	Type    string          `json:"type"`
+	Text    string          `json:"text"`
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input"`
+	Content json.RawMessage `json:"content"`
+}
+
+func isSystemMessage(raw json.RawMessage) bool {
+	var m contextMessage
+	return json.Unmarshal(raw, &m) == nil && (m.Role == "system" || m.Role == "developer")
+}
+
+// isPlainUserMessage 用户消息且不包含 tool_result，可以作为保留部分的第一条
+func isPlainUserMessage(raw json.RawMessage) bool {
+	var m contextMessage
+	if json.Unmarshal(raw, &m) != nil || m.Role != "user" {
+		return false
+	}
+	var blocks []contextBlock
+	if json.Unmarshal(m.Content, &blocks) != nil {
+		return true
+	}
+	for _, b := range blocks {
+		if b.Type == "tool_result" {
+			return false
+		}
+	}
+	return true
+}
+
+func truncateBlock(s string) string {
+	if len(s) <= contextBlockMaxChars {
+		return s
+	}
+	return s[:contextBlockMaxChars] + "…[truncated]"
+}
+
+// renderTranscript 把消息渲染为纯文本对话记录，工具调用和图片只保留简要信息
+func renderTranscript(messages []json.RawMessage) string {
+	var sb strings.Builder
+	for _, raw := range messages {
+		var m contextMessage
+		if json.Unmarshal(raw, &m) != nil {
+			continue
+		}
+		sb.WriteString(m.Role)
+		sb.WriteString(": ")
+
+		var text string
+		var blocks []contextBlock
+		switch {
+		case json.Unmarshal(m.Content, &text) == nil:
+			sb.WriteString(truncateBlock(text))
+		case json.Unmarshal(m.Content, &blocks) == nil:
+			for i, b := range blocks {
+				if i > 0 {
+					sb.WriteString("\n")
+				}
+				switch b.Type {
+				case "text":
+					sb.WriteString(truncateBlock(b.Text))
+				case "tool_use":
+					sb.WriteString("[tool_use " + b.Name + "] " + truncateBlock(string(b.Input)))
+				case "tool_result":
+					sb.WriteString("[tool_result] " + truncateBlock(string(b.Content)))
+				default:
+					sb.WriteString("[" + b.Type + "]")
+				}
+			}
+		}
+		// OpenAI 格式的工具调用在 tool_calls 字段中
+		var extra struct {
+			ToolCalls json.RawMessage `json:"tool_calls"`
+		}
+		if json.Unmarshal(raw, &extra) == nil && len(extra.ToolCalls) > 0 && string(extra.ToolCalls) != "null" {
+			sb.WriteString("\n[tool_calls] " + truncateBlock(string(extra.ToolCalls)))
+		}
+		sb.WriteString("\n\n")
+	}
+
+	transcript := sb.String()
+	if len(transcript) > contextTranscriptMaxChars {
+		transcript = "…[earlier messages omitted]\n" + transcript[len(transcript)-contextTranscriptMaxChars:]
+	}
+	return transcript
+}
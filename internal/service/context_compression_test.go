@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fakeSummarizer 记录收到的提示词并返回固定摘要
+func fakeSummarizer(t *testing.T) *string {
+	t.Helper()
+	var prompt string
+	orig := contextSummarizer
+	contextSummarizer = func(ctx context.Context, modelID, p string) (string, error) {
+		prompt = p
+		return "user is refactoring pool.go", nil
+	}
+	t.Cleanup(func() { contextSummarizer = orig })
+	return &prompt
+}
+
+func decodeMessages(t *testing.T, body []byte) []map[string]interface{} {
+	t.Helper()
+	var req struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	return req.Messages
+}
+
+func TestCompressContextAnthropicKeepsToolPairs(t *testing.T) {
+	prompt := fakeSummarizer(t)
+	body := []byte(`{"model":"claude-sonnet-4-5-20250929","system":"be brief","messages":[
+		{"role":"user","content":"open pool.go"},
+		{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"read","input":{"path":"pool.go"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"package service"}]},
+		{"role":"assistant","content":"done"},
+		{"role":"user","content":"now split it"},
+		{"role":"assistant","content":[{"type":"tool_use","id":"t2","name":"edit","input":{}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"t2","content":"ok"}]}
+	]}`)
+	cfg := ContextCompressionConfig{Mode: ContextCompressionOn, ThresholdTokens: 10, KeepMessages: 4}
+
+	result, err := CompressContext(context.Background(), ContextFormatAnthropic, body, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 保留窗口起点是 tool_use，向后移到 "now split it"
+	if result.Compressed != 4 {
+		t.Fatalf("compressed = %d, want 4", result.Compressed)
+	}
+	msgs := decodeMessages(t, result.Body)
+	if len(msgs) != 5 || msgs[2]["content"] != "now split it" {
+		t.Fatalf("messages = %v", msgs)
+	}
+	if content, _ := msgs[0]["content"].(string); msgs[0]["role"] != "user" || !strings.HasSuffix(content, "user is refactoring pool.go") {
+		t.Errorf("summary message = %v", msgs[0])
+	}
+	if msgs[1]["role"] != "assistant" {
+		t.Errorf("ack message = %v", msgs[1])
+	}
+	var req map[string]interface{}
+	json.Unmarshal(result.Body, &req)
+	if req["system"] != "be brief" || req["model"] != "claude-sonnet-4-5-20250929" {
+		t.Errorf("other fields changed: %v", req)
+	}
+	for _, want := range []string{"user: open pool.go", "[tool_use read]", "[tool_result] \"package service\"", "assistant: done"} {
+		if !strings.Contains(*prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, *prompt)
+		}
+	}
+	if strings.Contains(*prompt, "now split it") {
+		t.Error("kept messages should not be summarized")
+	}
+}
+
+func TestCompressContextOpenAIKeepsSystem(t *testing.T) {
+	fakeSummarizer(t)
+	body := []byte(`{"model":"gpt-5","messages":[
+		{"role":"system","content":"sys"},
+		{"role":"user","content":"a"},
+		{"role":"assistant","content":"b"},
+		{"role":"user","content":"c"},
+		{"role":"assistant","content":"d"},
+		{"role":"user","content":"e"}
+	]}`)
+	cfg := ContextCompressionConfig{Mode: ContextCompressionOn, ThresholdTokens: 10, KeepMessages: 1}
+
+	result, err := CompressContext(context.Background(), ContextFormatOpenAI, body, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := decodeMessages(t, result.Body)
+	if result.Compressed != 4 || len(msgs) != 4 || msgs[0]["content"] != "sys" || msgs[3]["content"] != "e" {
+		t.Fatalf("compressed=%d messages=%v", result.Compressed, msgs)
+	}
+}
+
+func TestCompressContextSkipsBelowThreshold(t *testing.T) {
+	fakeSummarizer(t)
+	body := []byte(`{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`)
+
+	result, err := CompressContext(context.Background(), ContextFormatOpenAI, body, ContextCompressionConfig{ThresholdTokens: 1000, KeepMessages: 1})
+	if err != nil || result.Compressed != 0 || string(result.Body) != string(body) {
+		t.Errorf("should not compress: %+v %v", result, err)
+	}
+	// 没有足够的早期消息可以摘要
+	result, _ = CompressContext(context.Background(), ContextFormatOpenAI, body, ContextCompressionConfig{ThresholdTokens: 1, KeepMessages: 3})
+	if result.Compressed != 0 {
+		t.Errorf("compressed = %d", result.Compressed)
+	}
+}
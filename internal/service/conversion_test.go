@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zencoder2api/internal/model"
+)
+
+// 修改转换规则后用 go test ./internal/service -run TestConversionGolden -update 重新生成期望输出，
+// 并在提交前检查 testdata 的差异是否符合预期
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/conversion")
+
+// assertJSONBody 比较输出与期望的 JSON 是否逐字节一致（期望值先压缩空白）
+func assertJSONBody(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(want)); err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	if !bytes.Equal(got, compact.Bytes()) {
+		t.Errorf("body mismatch\n got: %s\nwant: %s", got, compact.Bytes())
+	}
+}
+
+func TestEnsureThinkingConfig(t *testing.T) {
+	model.ResetZenModelsToDefault()
+	tests := []struct {
+		name  string
+		model string
+		in    string
+		want  string
+	}{
+		{
+			name:  "model without thinking parameters is untouched",
+			model: "claude-sonnet-4-5-20250929",
+			in:    `{"model":"x", "top_p":0.9, "messages":[{"role":"assistant","content":"hi"}]}`,
+			want:  `{"model":"x", "top_p":0.9, "messages":[{"role":"assistant","content":"hi"}]}`,
+		},
+		{
+			name:  "unknown model is untouched",
+			model: "no-such-model",
+			in:    `{"thinking":{"type":"disabled"}}`,
+			want:  `{"thinking":{"type":"disabled"}}`,
+		},
+		{
+			name:  "thinking alias adds config, forces temperature and drops top_p",
+			model: "claude-sonnet-4-5-20250929-thinking",
+			in:    `{"messages":[{"role":"assistant","content":"hi"}],"temperature":0.2,"top_p":0.9}`,
+			want:  `{"messages":[{"content":"hi","role":"assistant"}],"temperature":1,"thinking":{"budget_tokens":4096,"type":"enabled"}}`,
+		},
+		{
+			name:  "client budget is replaced by the model budget",
+			model: "claude-sonnet-4-5-20250929-thinking",
+			in:    `{"thinking":{"type":"enabled","budget_tokens":31999}}`,
+			want:  `{"temperature":1,"thinking":{"budget_tokens":4096,"type":"enabled"}}`,
+		},
+		{
+			name:  "thinking config without type gets enabled",
+			model: "claude-sonnet-4-5-20250929-thinking",
+			in:    `{"thinking":{}}`,
+			want:  `{"temperature":1,"thinking":{"budget_tokens":4096,"type":"enabled"}}`,
+		},
+		{
+			name:  "explicitly disabled thinking is re-enabled and assistant turns become user turns",
+			model: "claude-sonnet-4-5-20250929-thinking",
+			in:    `{"thinking":{"type":"disabled"},"messages":[{"role":"user","content":"q"},{"role":"assistant","content":[{"type":"text","text":"a"},{"type":"tool_use","id":"t1","name":"Read","input":{}}]}]}`,
+			want:  `{"messages":[{"content":"q","role":"user"},{"content":[{"text":"a","type":"text"},{"text":"[tool_use] Read (ID: t1)","type":"text"}],"role":"user"}],"temperature":1,"thinking":{"budget_tokens":4096,"type":"enabled"}}`,
+		},
+		{
+			name:  "enabled=false counts as disabling thinking",
+			model: "claude-sonnet-4-5-20250929-thinking",
+			in:    `{"thinking":{"enabled":false},"messages":[{"role":"assistant","content":"a"}]}`,
+			want:  `{"messages":[{"content":"a","role":"user"}],"temperature":1,"thinking":{"budget_tokens":4096,"enabled":false,"type":"enabled"}}`,
+		},
+		{
+			name:  "non-thinking id of a thinking model converts assistant turns",
+			model: "claude-haiku-4-5-20251001",
+			in:    `{"messages":[{"role":"assistant","content":[{"type":"thinking","thinking":"hmm","signature":"sig","cache_control":{"type":"ephemeral"}}]}]}`,
+			want:  `{"messages":[{"content":[{"cache_control":{"type":"ephemeral"},"text":"[thinking] hmm","type":"text"}],"role":"user"}],"temperature":1,"thinking":{"budget_tokens":4096,"type":"enabled"}}`,
+		},
+		{
+			name:  "invalid JSON is returned as is",
+			model: "claude-sonnet-4-5-20250929-thinking",
+			in:    `{"messages":`,
+			want:  `{"messages":`,
+		},
+	}
+
+	s := &AnthropicService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ensureThinkingConfig([]byte(tt.in), tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == tt.in {
+				if string(got) != tt.in {
+					t.Errorf("got %s, want input unchanged", got)
+				}
+				return
+			}
+			assertJSONBody(t, got, tt.want)
+		})
+	}
+}
+
+func TestConvertAssistantMessagesToUser(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "string content only changes the role",
+			in:   `{"messages":[{"role":"assistant","content":"hello"}]}`,
+			want: `{"messages":[{"content":"hello","role":"user"}]}`,
+		},
+		{
+			name: "thinking and tool_use become text and keep cache_control",
+			in:   `{"messages":[{"role":"assistant","content":[{"type":"thinking","thinking":"plan","signature":"s"},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"},"cache_control":{"type":"ephemeral"}}]}]}`,
+			want: `{"messages":[{"content":[{"text":"[thinking] plan","type":"text"},{"cache_control":{"type":"ephemeral"},"text":"[tool_use] Bash (ID: t1)","type":"text"}],"role":"user"}]}`,
+		},
+		{
+			name: "tool results in user turns become text, errors are marked",
+			in:   `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"},{"type":"tool_result","tool_use_id":"t2","is_error":true,"content":"boom"},{"type":"text","text":"next"}]}]}`,
+			want: `{"messages":[{"content":[{"text":"[tool_result] (ID: t1)","type":"text"},{"text":"[tool_error] (ID: t2)","type":"text"},{"text":"next","type":"text"}],"role":"user"}]}`,
+		},
+		{
+			// redacted_thinking 没有 thinking 字段，块保持原样
+			name: "redacted thinking without text is kept",
+			in:   `{"messages":[{"role":"assistant","content":[{"type":"redacted_thinking","data":"abc"}]}]}`,
+			want: `{"messages":[{"content":[{"data":"abc","type":"redacted_thinking"}],"role":"user"}]}`,
+		},
+		{
+			name: "other fields are preserved",
+			in:   `{"model":"m","system":"s","messages":[]}`,
+			want: `{"messages":[],"model":"m","system":"s"}`,
+		},
+	}
+
+	s := &AnthropicService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.convertAssistantMessagesToUser([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONBody(t, got, tt.want)
+		})
+	}
+
+	if got, err := s.convertAssistantMessagesToUser([]byte(`not json`)); err == nil || string(got) != "not json" {
+		t.Errorf("invalid JSON: got %s, %v", got, err)
+	}
+}
+
+func TestAdjustParametersForModel(t *testing.T) {
+	model.ResetZenModelsToDefault()
+	tests := []struct {
+		name  string
+		model string
+		in    string
+		want  string
+	}{
+		{
+			name:  "opus 4.5 drops top_p and forces its temperature",
+			model: "claude-opus-4-5-20251101",
+			in:    `{"temperature":0.3,"top_p":0.9}`,
+			want:  `{"temperature":1}`,
+		},
+		{
+			name:  "opus 4.1 drops top_p but keeps the client temperature",
+			model: "claude-opus-4-1-20250805",
+			in:    `{"temperature":0.3,"top_p":0.9}`,
+			want:  `{"temperature":0.3}`,
+		},
+		{
+			name:  "model with a fixed temperature drops top_p",
+			model: "claude-haiku-4-5-20251001",
+			in:    `{"top_p":0.5}`,
+			want:  `{"temperature":1}`,
+		},
+		{
+			name:  "model without parameters is untouched",
+			model: "claude-sonnet-4-5-20250929",
+			in:    `{"temperature": 0.3, "top_p": 0.9}`,
+			want:  `{"temperature": 0.3, "top_p": 0.9}`,
+		},
+		{
+			name:  "invalid JSON is untouched",
+			model: "claude-opus-4-5-20251101",
+			in:    `{"top_p":`,
+			want:  `{"top_p":`,
+		},
+	}
+
+	s := &AnthropicService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.adjustParametersForModel([]byte(tt.in), tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == tt.in {
+				if string(got) != tt.in {
+					t.Errorf("got %s, want input unchanged", got)
+				}
+				return
+			}
+			assertJSONBody(t, got, tt.want)
+		})
+	}
+}
+
+// TestConversionGolden 用真实客户端请求体走一遍转换，输出与 testdata/conversion 中的期望逐字节比较
+func TestConversionGolden(t *testing.T) {
+	model.ResetZenModelsToDefault()
+	tests := []struct {
+		fixture string
+		model   string
+	}{
+		{"claude_code", "claude-sonnet-4-5-20250929-thinking"},
+		{"cline", "claude-haiku-4-5-20251001"},
+		{"librechat", "claude-opus-4-5-20251101"},
+	}
+
+	s := &AnthropicService{}
+	steps := []struct {
+		name string
+		run  func(body []byte, modelID string) ([]byte, error)
+	}{
+		{"ensure_thinking", s.ensureThinkingConfig},
+		{"adjust_parameters", s.adjustParametersForModel},
+		{"assistant_to_user", func(body []byte, _ string) ([]byte, error) { return s.convertAssistantMessagesToUser(body) }},
+	}
+
+	for _, tt := range tests {
+		input, err := os.ReadFile(filepath.Join("testdata", "conversion", tt.fixture+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, input); err != nil {
+			t.Fatalf("%s: %v", tt.fixture, err)
+		}
+
+		for _, step := range steps {
+			t.Run(tt.fixture+"/"+step.name, func(t *testing.T) {
+				got, err := step.run(compact.Bytes(), tt.model)
+				if err != nil {
+					t.Fatal(err)
+				}
+				golden := filepath.Join("testdata", "conversion", tt.fixture+"."+step.name+".golden.json")
+				if *updateGolden {
+					var pretty bytes.Buffer
+					if err := json.Indent(&pretty, got, "", "  "); err != nil {
+						t.Fatal(err)
+					}
+					pretty.WriteByte('\n')
+					if err := os.WriteFile(golden, pretty.Bytes(), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v (run with -update to create)", err)
+				}
+				assertJSONBody(t, got, string(want))
+			})
+		}
+	}
+}
+
+func TestApplyOpenAIModelParameters(t *testing.T) {
+	model.ResetZenModelsToDefault()
+	nano, _ := model.GetZenModel("gpt-5-nano-2025-08-07")
+	tests := []struct {
+		name   string
+		params *model.ModelParameters
+		in     string
+		want   string
+	}{
+		{
+			name:   "nano defaults, extra body and forced stream",
+			params: nano.Parameters,
+			in:     `{"input":"hi","stream":false}`,
+			want:   `{"include":["reasoning.encrypted_content"],"input":"hi","prompt_cache_key":"generate-name","reasoning":{"effort":"minimal","summary":"auto"},"service_tier":"auto","store":false,"stream":true,"temperature":1,"text":{"verbosity":"medium"}}`,
+		},
+		{
+			name:   "extra body merges into the client's reasoning",
+			params: nano.Parameters,
+			in:     `{"reasoning":{"effort":"high"},"temperature":0.5,"store":true}`,
+			want:   `{"include":["reasoning.encrypted_content"],"prompt_cache_key":"generate-name","reasoning":{"effort":"high","summary":"auto"},"service_tier":"auto","store":false,"stream":true,"temperature":0.5,"text":{"verbosity":"medium"}}`,
+		},
+		{
+			name:   "model without quirks keeps stream",
+			params: &model.ModelParameters{Temperature: new(float64)},
+			in:     `{"stream":false}`,
+			want:   `{"stream":false,"temperature":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSONBody(t, applyOpenAIModelParameters([]byte(tt.in), tt.params), tt.want)
+		})
+	}
+
+	if params := nano.Parameters; params.ExtraBody["reasoning"].(map[string]interface{})["effort"] != nil {
+		t.Errorf("extra body mutated by merge: %v", params.ExtraBody)
+	}
+}
+
+// 新的特殊模型只需在模型表中配置，不需要修改转换代码
+func TestOpenAIModelQuirksFromRegistry(t *testing.T) {
+	defer model.ResetZenModelsToDefault()
+	model.UpdateZenModels(func(models map[string]model.ZenModel) {
+		models["quirky-model"] = model.ZenModel{
+			ID: "quirky-model", Model: "quirky-model", ProviderID: "openai",
+			Parameters: &model.ModelParameters{AggregateSSEToJSON: true, TypedInput: true},
+		}
+	})
+
+	s := &OpenAIService{}
+	body, err := s.convertChatToResponsesBody([]byte(`{"model":"quirky-model","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONBody(t, body, `{"input":[{"content":[{"text":"hi","type":"input_text"}],"role":"user","type":"message"}],"model":"quirky-model"}`)
+
+	// 没有可提取的内容时也聚合为 chat.completion，而不是透传 SSE
+	rec := httptest.NewRecorder()
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("data: {\"type\":\"response.created\"}\n\ndata: [DONE]\n\n"))}
+	if err := s.handleNonStreamResponse(context.Background(), rec, resp, "quirky-model"); err != nil {
+		t.Fatal(err)
+	}
+	var got model.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not a chat completion: %s", rec.Body.String())
+	}
+	if got.Object != "chat.completion" || got.Model != "quirky-model" || len(got.Choices) != 1 {
+		t.Errorf("unexpected aggregated response: %s", rec.Body.String())
+	}
+}
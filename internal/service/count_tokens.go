@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"zencoder2api/internal/model"
+)
+
+// CountTokensEstimatedHeader 上游无法计数、由网关在本地估算时带此头
+const CountTokensEstimatedHeader = "X-Token-Count-Estimated"
+
+// anthropicImageTokens 本地估算时每张图片或每个 PDF 文档按固定 token 数计，约为一张 1092x1092 图片的用量
+const anthropicImageTokens = 1600
+
+// CountTokensResult /v1/messages/count_tokens 的结果
+type CountTokensResult struct {
+	InputTokens int  `json:"input_tokens"`
+	Estimated   bool `json:"-"` // 是否为本地估算
+}
+
+// CountTokens 处理 /v1/messages/count_tokens：经号池转发上游计数；
+// 没有可用账号、上游不支持或出错时在本地估算。上游认为请求无效时返回 *InvalidRequestError
+func (s *AnthropicService) CountTokens(ctx context.Context, body []byte) (*CountTokensResult, error) {
+	var req struct {
+		Model    string          `json:"model"`
+		Messages json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, invalidRequest("invalid request body: %v", err)
+	}
+	if req.Model == "" {
+		return nil, invalidRequest("model: Field required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, invalidRequest("messages: Field required")
+	}
+
+	// 计入 Key 的系统提示词模板，与实际发送的请求一致
+	body = applySystemPromptTemplate(ctx, body)
+	tokens, err := s.countTokensUpstream(ctx, req.Model, body)
+	if err == nil {
+		return &CountTokensResult{InputTokens: tokens}, nil
+	}
+	var invalid *InvalidRequestError
+	if errors.As(err, &invalid) {
+		return nil, err
+	}
+	DebugLog(ctx, "[Anthropic] count_tokens 上游不可用，使用本地估算: %v", err)
+
+	tokens, err = EstimateAnthropicTokens(body)
+	if err != nil {
+		return nil, err
+	}
+	return &CountTokensResult{InputTokens: tokens, Estimated: true}, nil
+}
+
+// countTokensUpstream 用号池中的账号请求上游 count_tokens，不重试
+func (s *AnthropicService) countTokensUpstream(ctx context.Context, modelID string, body []byte) (int, error) {
+	zenModel, ok := model.GetZenModel(modelID)
+	if !ok {
+		return 0, fmt.Errorf("unknown model: %s", modelID)
+	}
+	account, err := s.deps.Accounts.GetNextAccountForModel(modelID)
+	if err != nil {
+		return 0, err
+	}
+	defer s.deps.Accounts.ReleaseAccount(account)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", AnthropicBaseURL+"/v1/messages/count_tokens", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	SetZencoderHeaders(httpReq, account, zenModel)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	if zenModel.Parameters != nil {
+		for k, v := range zenModel.Parameters.ExtraHeaders {
+			httpReq.Header.Set(k, v)
+		}
+	}
+
+	resp, err := s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel).Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var result struct {
+			InputTokens *int `json:"input_tokens"`
+		}
+		if json.Unmarshal(respBody, &result) != nil || result.InputTokens == nil {
+			return 0, fmt.Errorf("unexpected count_tokens response: %s", respBody)
+		}
+		return *result.InputTokens, nil
+	case http.StatusBadRequest:
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(respBody, &e) == nil && e.Error.Message != "" {
+			return 0, &InvalidRequestError{Message: e.Error.Message}
+		}
+	}
+	return 0, fmt.Errorf("count_tokens returned %d: %s", resp.StatusCode, respBody)
+}
+
+// EstimateAnthropicTokens 在本地估算 count_tokens 请求的输入 token 数，不占用上游账号
+// system 和消息中的文本按 4 字节一个 token 估算，工具定义和 tool_use 的参数按 JSON 原文估算，
+// 图片和 PDF 文档每个按 1600 token 计
+func EstimateAnthropicTokens(body []byte) (int, error) {
+	var req struct {
+		System   json.RawMessage `json:"system"`
+		Messages json.RawMessage `json:"messages"`
+		Tools    json.RawMessage `json:"tools"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, invalidRequest("invalid request body: %v", err)
+	}
+
+	var textBytes, media int
+	for _, raw := range []json.RawMessage{req.System, req.Messages} {
+		var v interface{}
+		if len(raw) > 0 && json.Unmarshal(raw, &v) == nil {
+			t, m := countAnthropicContent(v)
+			textBytes += t
+			media += m
+		}
+	}
+	textBytes += len(req.Tools)
+	return (textBytes+3)/4 + media*anthropicImageTokens, nil
+}
+
+// countAnthropicContent 递归统计消息和内容块中文本的字节数及图片、文档的个数
+func countAnthropicContent(v interface{}) (textBytes, media int) {
+	switch val := v.(type) {
+	case string:
+		return len(val), 0
+	case []interface{}:
+		for _, child := range val {
+			t, m := countAnthropicContent(child)
+			textBytes += t
+			media += m
+		}
+	case map[string]interface{}:
+		switch val["type"] {
+		case "image", "document":
+			return 0, 1
+		case "tool_use":
+			input, _ := json.Marshal(val["input"])
+			name, _ := val["name"].(string)
+			return len(input) + len(name), 0
+		}
+		for _, key := range []string{"text", "thinking", "content"} {
+			if child, ok := val[key]; ok {
+				t, m := countAnthropicContent(child)
+				textBytes += t
+				media += m
+			}
+		}
+	}
+	return textBytes, media
+}
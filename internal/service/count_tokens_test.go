@@ -0,0 +1,18 @@
+package service
+
+import "testing"
+
+func TestEstimateAnthropicTokens(t *testing.T) {
+	body := `{"model":"m","system":[{"type":"text","text":"` + "abcdefgh" + `"}],"messages":[
+		{"role":"user","content":[{"type":"text","text":"abcdefgh"},{"type":"image","source":{"type":"base64","data":"AAAA"}}]},
+		{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"f","input":{}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"abcd"}]}]}`
+	got, err := EstimateAnthropicTokens([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 文本 8+8+4 字节，tool_use 为 name 与 {} 共 3 字节，合计 23 字节约 6 token，另加一张图片
+	if want := 6 + anthropicImageTokens; got != want {
+		t.Errorf("tokens = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// ErrCredentialRotationBusy 该账号正在轮换凭证
+var ErrCredentialRotationBusy = errors.New("该账号正在轮换凭证")
+
+var (
+	// credentialGenerate / credentialRevoke / credentialLogin 调用上游的凭证接口，测试时替换
+	credentialGenerate = GenerateCredential
+	credentialRevoke   = RevokeCredential
+	credentialLogin    = RefreshToken
+
+	credentialRotatingMu sync.Mutex
+	credentialRotating   = make(map[uint]bool)
+)
+
+// CredentialRotationResult 凭证轮换结果，旧凭证吊销失败不影响轮换本身
+type CredentialRotationResult struct {
+	AccountID   uint   `json:"account_id"`
+	OldClientID string `json:"old_client_id"`
+	NewClientID string `json:"new_client_id"`
+	Revoked     bool   `json:"revoked"`
+	RevokeError string `json:"revoke_error,omitempty"`
+}
+
+// RotateAccountCredential 为通过 GenerateCredential 创建的账号换一对新的 client 凭证：
+//  1. 用 masterToken（为空时使用同邮箱的 Token 记录）生成新凭证
+//  2. 用新凭证登录并探测上游，确认可用且属于同一用户
+//  3. 仅在 client_id 未被改动时写库替换，并同步号池中的账号
+//  4. 吊销旧凭证；前面任一步失败都会吊销新凭证，账号保持不变
+func RotateAccountCredential(accountID uint, masterToken string) (*CredentialRotationResult, error) {
+	credentialRotatingMu.Lock()
+	if credentialRotating[accountID] {
+		credentialRotatingMu.Unlock()
+		return nil, ErrCredentialRotationBusy
+	}
+	credentialRotating[accountID] = true
+	credentialRotatingMu.Unlock()
+	defer func() {
+		credentialRotatingMu.Lock()
+		delete(credentialRotating, accountID)
+		credentialRotatingMu.Unlock()
+	}()
+
+	var account model.Account
+	if err := database.GetDB().First(&account, accountID).Error; err != nil {
+		return nil, fmt.Errorf("账号不存在")
+	}
+	if !hasClientCredential(&account) {
+		return nil, fmt.Errorf("账号 %s 不是 client 凭证账号，无需轮换", account.ClientID)
+	}
+
+	if masterToken == "" {
+		token, err := credentialMasterToken(account.Email)
+		if err != nil {
+			return nil, err
+		}
+		masterToken = token
+	}
+
+	cred, err := credentialGenerate(masterToken)
+	if err != nil {
+		return nil, fmt.Errorf("生成新凭证失败: %w", err)
+	}
+	// discard 放弃新凭证，避免留下无人使用的有效凭证
+	discard := func(cause error) error {
+		if err := credentialRevoke(masterToken, cred.ClientID); err != nil {
+			log.Printf("[WARN] [CredentialRotation] 账号 %s (ID:%d) 吊销未使用的新凭证 %s 失败: %v", account.ClientID, account.ID, cred.ClientID, err)
+		}
+		return cause
+	}
+
+	candidate := model.Account{ClientID: cred.ClientID, ClientSecret: cred.Secret, Proxy: account.Proxy}
+	if _, err := credentialLogin(&candidate); err != nil {
+		return nil, discard(fmt.Errorf("新凭证登录失败: %w", err))
+	}
+	if payload, err := ParseJWT(candidate.AccessToken); err == nil && account.Email != "" && payload.Email != account.Email {
+		return nil, discard(fmt.Errorf("新凭证属于 %s，与账号邮箱 %s 不一致", payload.Email, account.Email))
+	}
+	if err := accessTokenProbe(candidate.AccessToken, account.Proxy); err != nil {
+		return nil, discard(fmt.Errorf("新凭证验证失败: %w", err))
+	}
+
+	result := database.GetDB().Model(&model.Account{}).
+		Where("id = ? AND client_id = ?", account.ID, account.ClientID).
+		Updates(map[string]interface{}{
+			"client_id":     candidate.ClientID,
+			"client_secret": candidate.ClientSecret,
+			"access_token":  candidate.AccessToken,
+			"token_expiry":  candidate.TokenExpiry,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
+		return nil, discard(fmt.Errorf("更新数据库失败: %w", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, discard(fmt.Errorf("账号已被删除或凭证已被修改"))
+	}
+	swapPoolCredential(account.ID, candidate)
+	log.Printf("[CredentialRotation] 账号 ID:%d 凭证已轮换: %s -> %s", account.ID, account.ClientID, candidate.ClientID)
+
+	rotation := &CredentialRotationResult{AccountID: account.ID, OldClientID: account.ClientID, NewClientID: candidate.ClientID}
+	if err := credentialRevoke(masterToken, account.ClientID); err != nil {
+		log.Printf("[WARN] [CredentialRotation] 账号 ID:%d 吊销旧凭证 %s 失败: %v", account.ID, account.ClientID, err)
+		rotation.RevokeError = err.Error()
+	} else {
+		rotation.Revoked = true
+	}
+	return rotation, nil
+}
+
+// credentialMasterToken 取同邮箱的可用 Token 记录，必要时先刷新其 access_token
+func credentialMasterToken(email string) (string, error) {
+	if email == "" {
+		return "", fmt.Errorf("账号没有邮箱，无法找到对应的 Token 记录，请提供 token 或 refresh_token")
+	}
+	var record model.TokenRecord
+	if err := database.GetDB().Where("email = ? AND status = ? AND is_active = ?", email, "active", true).
+		Order("updated_at DESC").First(&record).Error; err != nil {
+		return "", fmt.Errorf("没有邮箱 %s 的可用 Token 记录，请提供 token 或 refresh_token", email)
+	}
+	if err := CheckAndRefreshTokenRecord(&record); err != nil {
+		return "", fmt.Errorf("刷新 Token 记录失败: %w", err)
+	}
+	if record.Token == "" {
+		return "", fmt.Errorf("Token 记录 %d 没有 access_token", record.ID)
+	}
+	return record.Token, nil
+}
+
+// swapPoolCredential 替换号池中该账号的凭证，避免进行中的请求把旧凭证写回数据库
+func swapPoolCredential(accountID uint, cred model.Account) {
+	if pool == nil {
+		return
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, acc := range pool.accounts {
+		if acc.ID == accountID {
+			acc.ClientID = cred.ClientID
+			acc.ClientSecret = cred.ClientSecret
+			acc.AccessToken = cred.AccessToken
+			acc.TokenExpiry = cred.TokenExpiry
+		}
+	}
+}
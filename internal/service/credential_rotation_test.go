@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// fakeCredentialUpstream 记录生成和吊销的凭证
+type fakeCredentialUpstream struct {
+	masterTokens []string
+	revoked      []string
+}
+
+func setupCredentialRotationTest(t *testing.T) (*fakeCredentialUpstream, *model.Account) {
+	t.Helper()
+	initTestDB(t, "credential.db")
+	up := &fakeCredentialUpstream{}
+	origGenerate, origRevoke, origLogin, origProbe := credentialGenerate, credentialRevoke, credentialLogin, accessTokenProbe
+	t.Cleanup(func() {
+		credentialGenerate, credentialRevoke, credentialLogin, accessTokenProbe = origGenerate, origRevoke, origLogin, origProbe
+	})
+	credentialGenerate = func(token string) (*CredentialGenerateResponse, error) {
+		up.masterTokens = append(up.masterTokens, token)
+		return &CredentialGenerateResponse{ClientID: "client-new", Secret: "secret-new"}, nil
+	}
+	credentialRevoke = func(token, clientID string) error {
+		up.revoked = append(up.revoked, clientID)
+		return nil
+	}
+	credentialLogin = func(account *model.Account) (string, error) {
+		account.AccessToken = "at-" + account.ClientID
+		account.TokenExpiry = time.Now().Add(time.Hour)
+		return account.AccessToken, nil
+	}
+	accessTokenProbe = func(string, string) error { return nil }
+
+	account := &model.Account{
+		ClientID: "client-old", ClientSecret: "secret-old", Email: "user@example.com", Status: "normal",
+		AccessToken: "at-client-old", TokenExpiry: time.Now().Add(time.Hour),
+	}
+	if err := database.GetDB().Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+	record := &model.TokenRecord{Token: "master-from-record", Email: "user@example.com", Status: "active", IsActive: true}
+	if err := database.GetDB().Create(record).Error; err != nil {
+		t.Fatal(err)
+	}
+	return up, account
+}
+
+func TestRotateAccountCredential(t *testing.T) {
+	up, account := setupCredentialRotationTest(t)
+
+	result, err := RotateAccountCredential(account.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OldClientID != "client-old" || result.NewClientID != "client-new" || !result.Revoked {
+		t.Errorf("result = %+v", result)
+	}
+	if len(up.masterTokens) != 1 || up.masterTokens[0] != "master-from-record" {
+		t.Errorf("master tokens = %v, want token record", up.masterTokens)
+	}
+	if len(up.revoked) != 1 || up.revoked[0] != "client-old" {
+		t.Errorf("revoked = %v, want only old credential", up.revoked)
+	}
+
+	stored := storedAccount(t, account.ID)
+	if stored.ClientID != "client-new" || stored.ClientSecret != "secret-new" || stored.AccessToken != "at-client-new" {
+		t.Errorf("stored = %s/%s/%s", stored.ClientID, stored.ClientSecret, stored.AccessToken)
+	}
+}
+
+func TestRotateAccountCredentialVerifyFailureKeepsOld(t *testing.T) {
+	up, account := setupCredentialRotationTest(t)
+	accessTokenProbe = func(string, string) error { return errTokenRejected }
+
+	if _, err := RotateAccountCredential(account.ID, "master-explicit"); !errors.Is(err, errTokenRejected) {
+		t.Fatalf("err = %v, want rejected", err)
+	}
+	if len(up.masterTokens) != 1 || up.masterTokens[0] != "master-explicit" {
+		t.Errorf("master tokens = %v, want explicit token", up.masterTokens)
+	}
+	// 只吊销未使用的新凭证
+	if len(up.revoked) != 1 || up.revoked[0] != "client-new" {
+		t.Errorf("revoked = %v, want only new credential", up.revoked)
+	}
+	if stored := storedAccount(t, account.ID); stored.ClientID != "client-old" || stored.ClientSecret != "secret-old" {
+		t.Errorf("account changed: %s/%s", stored.ClientID, stored.ClientSecret)
+	}
+}
+
+func TestRotateAccountCredentialRevokeFailureStillSwaps(t *testing.T) {
+	_, account := setupCredentialRotationTest(t)
+	credentialRevoke = func(string, string) error { return errors.New("status 500") }
+
+	result, err := RotateAccountCredential(account.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Revoked || result.RevokeError == "" {
+		t.Errorf("result = %+v, want revoke error reported", result)
+	}
+	if stored := storedAccount(t, account.ID); stored.ClientID != "client-new" {
+		t.Errorf("client_id = %s, want swapped", stored.ClientID)
+	}
+}
+
+func TestRotateAccountCredentialRejectsTokenLogin(t *testing.T) {
+	up, account := setupCredentialRotationTest(t)
+	database.GetDB().Model(account).Update("client_secret", "refresh-token-login")
+
+	if _, err := RotateAccountCredential(account.ID, ""); err == nil {
+		t.Fatal("refresh-token-login account rotated")
+	}
+	if len(up.masterTokens) != 0 {
+		t.Errorf("generated credentials for token login account: %v", up.masterTokens)
+	}
+}
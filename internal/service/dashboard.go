@@ -0,0 +1,205 @@
+package service
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+// 账号运行时状态的筛选条件
+const (
+	DashboardFilterInUse  = "in_use"
+	DashboardFilterFrozen = "frozen"
+	DashboardFilterBusy   = "busy" // 使用中、冻结中或排空中
+)
+
+// DashboardAccount 账号在内存中的运行时状态，与数据库中的状态可能不同
+type DashboardAccount struct {
+	ID             uint           `json:"id"`
+	Email          string         `json:"email,omitempty"`
+	PlanType       model.PlanType `json:"plan_type,omitempty"`
+	InPool         bool           `json:"in_pool"`                // 不在号池中的状态通常是已删除或停用账号的残留
+	ActiveRequests int            `json:"active_requests"`        // 未释放的并发名额
+	StaleRequests  int            `json:"stale_requests"`         // 其中超过 30 秒未释放、下次调度时会被回收的
+	OpenResponses  int            `json:"open_responses"`         // 仍在转发的响应（含流式）
+	Draining       bool           `json:"draining"`               // 维护排空中，不调度新请求
+	InUseSince     *time.Time     `json:"in_use_since,omitempty"` // 最早的未释放占用
+	FrozenUntil    *time.Time     `json:"frozen_until,omitempty"` // 仅在仍冻结时返回
+	LastUsed       *time.Time     `json:"last_used,omitempty"`
+	Proxy          string         `json:"proxy,omitempty"`        // 已隐藏认证信息
+	ProxyRegion    string         `json:"proxy_region,omitempty"` // 固定的代理地区
+}
+
+// DashboardProxy 代理及绑定它的账号数
+type DashboardProxy struct {
+	URL      string             `json:"url"`              // 已隐藏认证信息
+	Pool     bool               `json:"pool"`             // 是否在 SOCKS_PROXY_POOL 轮询中
+	Region   string             `json:"region,omitempty"` // SOCKS_PROXY_POOL 中标注的地区
+	Health   *model.ProxyHealth `json:"health,omitempty"` // 最近一次健康检查结果，未检查过时为空
+	Accounts int                `json:"accounts"`         // 号池中配置了该代理的账号数
+}
+
+// DashboardSnapshot 管理面板排查用的实时状态
+type DashboardSnapshot struct {
+	GeneratedAt   time.Time            `json:"generated_at"`
+	MaxConcurrent int                  `json:"max_concurrent_per_account"`
+	Accounts      []DashboardAccount   `json:"accounts"`
+	Streams       []ActiveStream       `json:"streams"`
+	Proxies       []DashboardProxy     `json:"proxies"`
+	RecentErrors  []UpstreamErrorEvent `json:"recent_errors"`
+}
+
+// GetDashboardSnapshot 汇总账号运行时状态、进行中的流、代理和最近的上游失败
+func GetDashboardSnapshot(now time.Time) DashboardSnapshot {
+	return DashboardSnapshot{
+		GeneratedAt:   now,
+		MaxConcurrent: GetAccountConcurrency(),
+		Accounts:      GetDashboardAccounts(DashboardFilterBusy, now),
+		Streams:       ListActiveStreams(),
+		Proxies:       GetDashboardProxies(),
+		RecentErrors:  RecentUpstreamErrors(),
+	}
+}
+
+// GetDashboardAccounts 返回账号的运行时状态，filter 为空时返回号池中的全部账号和号池外仍有状态的账号
+func GetDashboardAccounts(filter string, now time.Time) []DashboardAccount {
+	pool.mu.RLock()
+	accounts := pool.accounts
+	pool.mu.RUnlock()
+
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return dashboardAccounts(accounts, accountStatuses, openResponses, filter, now)
+}
+
+func dashboardAccounts(accounts []*model.Account, statuses map[uint]*AccountStatus, open map[uint]int, filter string, now time.Time) []DashboardAccount {
+	result := []DashboardAccount{}
+	add := func(item DashboardAccount, status *AccountStatus) {
+		item.OpenResponses = open[item.ID]
+		if status != nil {
+			item.Draining = status.Draining()
+			item.ActiveRequests = status.Active()
+			for _, t := range status.Leases {
+				if now.Sub(t) > 30*time.Second {
+					item.StaleRequests++
+				}
+			}
+			if status.InUse() {
+				item.InUseSince = timePtr(status.InUseSince())
+			}
+			if now.Before(status.FrozenUntil) {
+				item.FrozenUntil = timePtr(status.FrozenUntil)
+			}
+			if !status.LastUsed.IsZero() {
+				item.LastUsed = timePtr(status.LastUsed)
+			}
+		}
+		inUse, frozen := item.ActiveRequests > 0 || item.OpenResponses > 0, item.FrozenUntil != nil
+		switch filter {
+		case DashboardFilterInUse:
+			if !inUse {
+				return
+			}
+		case DashboardFilterFrozen:
+			if !frozen {
+				return
+			}
+		case DashboardFilterBusy:
+			if !inUse && !frozen && !item.Draining {
+				return
+			}
+		}
+		result = append(result, item)
+	}
+
+	inPool := make(map[uint]bool, len(accounts))
+	for _, acc := range accounts {
+		inPool[acc.ID] = true
+		item := DashboardAccount{ID: acc.ID, Email: acc.Email, PlanType: acc.PlanType, InPool: true, Proxy: maskProxyURL(acc.Proxy), ProxyRegion: acc.ProxyRegion}
+		status := statuses[acc.ID]
+		if status == nil && now.Before(acc.CoolingUntil) {
+			// 尚未调度过，按数据库中的冷却时间判断
+			status = &AccountStatus{FrozenUntil: acc.CoolingUntil}
+		}
+		add(item, status)
+	}
+	for id, status := range statuses {
+		if !inPool[id] {
+			add(DashboardAccount{ID: id}, status)
+		}
+	}
+	for id := range open {
+		if _, ok := statuses[id]; !ok && !inPool[id] {
+			add(DashboardAccount{ID: id}, nil)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// GetDashboardProxies 返回代理池中的代理和账号单独配置的代理
+func GetDashboardProxies() []DashboardProxy {
+	pool.mu.RLock()
+	accounts := pool.accounts
+	pool.mu.RUnlock()
+	proxyPool := provider.GetProxyPool()
+	return dashboardProxies(proxyPool.GetAllProxies(), proxyPool.GetProxyRegion, accounts)
+}
+
+func dashboardProxies(poolProxies []string, regionOf func(string) string, accounts []*model.Account) []DashboardProxy {
+	byURL := make(map[string]*DashboardProxy)
+	var order []string
+	get := func(raw string) *DashboardProxy {
+		if p, ok := byURL[raw]; ok {
+			return p
+		}
+		p := &DashboardProxy{URL: maskProxyURL(raw), Health: getProxyHealth(raw)}
+		byURL[raw] = p
+		order = append(order, raw)
+		return p
+	}
+	for _, raw := range poolProxies {
+		p := get(raw)
+		p.Pool = true
+		p.Region = regionOf(raw)
+	}
+	for _, acc := range accounts {
+		if acc.Proxy != "" {
+			get(acc.Proxy).Accounts++
+		}
+	}
+
+	result := make([]DashboardProxy, 0, len(order))
+	for _, raw := range order {
+		result = append(result, *byURL[raw])
+	}
+	return result
+}
+
+// maskProxyURL 隐藏代理地址中的用户名和密码，支持 socks5://host:port:user:pass 格式
+func maskProxyURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	if strings.HasPrefix(raw, "socks5://") && strings.Count(raw, ":") == 4 {
+		parts := strings.SplitN(raw, ":", 4)
+		return parts[0] + ":" + parts[1] + ":" + parts[2] + ":***"
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "***"
+	}
+	if u.User == nil {
+		return u.String()
+	}
+	u.User = nil
+	return u.Scheme + "://***@" + strings.TrimPrefix(u.String(), u.Scheme+"://")
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const deadLetterContextKey contextKey = "dead_letter"
+
+// deadLetterPurgeInterval 清理过期 dead letter 的最小间隔
+const deadLetterPurgeInterval = time.Hour
+
+// Dead letter 查询条数
+const (
+	DeadLetterDefaultLimit = 100
+	DeadLetterMaxLimit     = 1000
+)
+
+// secretPattern 请求体中疑似密钥的字符串，保存前脱敏
+var secretPattern = regexp.MustCompile(`\b(sk|pk|rk)-[A-Za-z0-9_\-]{12,}`)
+
+// DeadLetterAttempt 一次上游尝试
+type DeadLetterAttempt struct {
+	AccountID  uint   `json:"account_id"`
+	StatusCode int    `json:"status_code"` // 网络错误时为 0
+	Category   string `json:"category"`    // 上游失败分类，成功时为空
+	Error      string `json:"error,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+}
+
+// deadLetterCollector 收集一次客户端请求的各次上游尝试，重试用尽时记录最终错误
+type deadLetterCollector struct {
+	mu        sync.Mutex
+	model     string
+	attempts  []DeadLetterAttempt
+	exhausted error
+}
+
+var (
+	deadLetterPayloadOnce  sync.Once
+	deadLetterPayloadBytes int
+	deadLetterRetention    time.Duration
+
+	deadLetterPurgeMu   sync.Mutex
+	deadLetterLastPurge time.Time
+)
+
+// loadDeadLetterConfig 读取 DEAD_LETTER_PAYLOAD_BYTES（默认 2048，0 表示不保存请求体）
+// 和 DEAD_LETTER_RETENTION_DAYS（默认 30，0 表示不清理）
+func loadDeadLetterConfig() {
+	deadLetterPayloadBytes = envNonNegativeIntDefault("DEAD_LETTER_PAYLOAD_BYTES", 2048)
+	deadLetterRetention = time.Duration(envNonNegativeIntDefault("DEAD_LETTER_RETENTION_DAYS", 30)) * 24 * time.Hour
+}
+
+// WithDeadLetterCollector 为请求创建 dead letter 收集器，之后的上游尝试都会记入
+func WithDeadLetterCollector(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deadLetterContextKey, &deadLetterCollector{})
+}
+
+func getDeadLetterCollector(ctx context.Context) *deadLetterCollector {
+	collector, _ := ctx.Value(deadLetterContextKey).(*deadLetterCollector)
+	return collector
+}
+
+// recordDeadLetterAttempt 记录一次上游尝试，由 RecordUpstreamResult 调用
+func recordDeadLetterAttempt(ctx context.Context, modelID string, accountID uint, category string, start, now time.Time, resp *http.Response, err error) {
+	collector := getDeadLetterCollector(ctx)
+	if collector == nil {
+		return
+	}
+	attempt := DeadLetterAttempt{AccountID: accountID, Category: category, LatencyMs: now.Sub(start).Milliseconds()}
+	if resp != nil {
+		attempt.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		attempt.Error = truncateUTF8(err.Error(), 200)
+	}
+	collector.mu.Lock()
+	collector.model = modelID
+	collector.attempts = append(collector.attempts, attempt)
+	collector.mu.Unlock()
+}
+
+// markDeadLetter 标记请求的重试已用尽
+func markDeadLetter(ctx context.Context, err error) {
+	if collector := getDeadLetterCollector(ctx); collector != nil {
+		collector.mu.Lock()
+		collector.exhausted = err
+		collector.mu.Unlock()
+	}
+}
+
+// sanitizeDeadLetterPayload 脱敏请求体中的邮箱和疑似密钥，并截断到 limit 字节
+func sanitizeDeadLetterPayload(body []byte, limit int) (string, bool) {
+	text := RedactEmails(string(body), EmailRedactionMask)
+	text = secretPattern.ReplaceAllStringFunc(text, MaskAPIKey)
+	if len(text) <= limit {
+		return text, false
+	}
+	return truncateUTF8(text, limit), true
+}
+
+// newDeadLetter 按收集到的尝试生成记录，重试未用尽时返回 nil
+func newDeadLetter(ctx context.Context, method, path string, body []byte, status int, duration time.Duration, now time.Time) *model.DeadLetter {
+	collector := getDeadLetterCollector(ctx)
+	if collector == nil {
+		return nil
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if collector.exhausted == nil {
+		return nil
+	}
+
+	deadLetterPayloadOnce.Do(loadDeadLetterConfig)
+	entry := &model.DeadLetter{
+		CreatedAt:  now,
+		Method:     method,
+		Path:       path,
+		Model:      collector.model,
+		StatusCode: status,
+		Error:      collector.exhausted.Error(),
+		DurationMs: duration.Milliseconds(),
+	}
+	if key := GetAPIKey(ctx); key != "" {
+		entry.KeyMasked = MaskAPIKey(key)
+	}
+	ids := make([]string, 0, len(collector.attempts))
+	seen := make(map[uint]bool)
+	for _, a := range collector.attempts {
+		if !seen[a.AccountID] {
+			seen[a.AccountID] = true
+			ids = append(ids, strconv.FormatUint(uint64(a.AccountID), 10))
+		}
+	}
+	entry.AccountIDs = strings.Join(ids, ",")
+	attempts, _ := json.Marshal(collector.attempts)
+	entry.Attempts = string(attempts)
+	entry.Payload, entry.PayloadTruncated = sanitizeDeadLetterPayload(body, deadLetterPayloadBytes)
+	return entry
+}
+
+// RecordDeadLetter 请求结束后调用：重试已用尽时保存 dead letter，数据库降级期间暂存，恢复后写入
+func RecordDeadLetter(ctx context.Context, method, path string, body []byte, status int, duration time.Duration) {
+	now := time.Now()
+	entry := newDeadLetter(ctx, method, path, body, status, duration, now)
+	if entry == nil {
+		return
+	}
+	DebugLog(ctx, "[DeadLetter] 重试用尽，记录 dead letter: model=%s, accounts=%s", entry.Model, entry.AccountIDs)
+	if err := database.Exec("dead letter", func(db *gorm.DB) error {
+		return db.Create(entry).Error
+	}); err != nil {
+		log.Printf("[WARN] [DeadLetter] 保存失败: %v", err)
+	}
+	purgeDeadLetters(now)
+}
+
+// purgeDeadLetters 删除超过保留期的记录，最多每小时执行一次
+func purgeDeadLetters(now time.Time) {
+	if deadLetterRetention <= 0 || !database.Healthy() {
+		return
+	}
+	deadLetterPurgeMu.Lock()
+	if now.Sub(deadLetterLastPurge) < deadLetterPurgeInterval {
+		deadLetterPurgeMu.Unlock()
+		return
+	}
+	deadLetterLastPurge = now
+	deadLetterPurgeMu.Unlock()
+
+	result := database.GetDB().Where("created_at < ?", now.Add(-deadLetterRetention)).Delete(&model.DeadLetter{})
+	if result.Error != nil {
+		log.Printf("[WARN] [DeadLetter] 清理过期记录失败: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[DeadLetter] 已清理 %d 条过期记录", result.RowsAffected)
+	}
+}
+
+// DeadLetterFilter dead letter 查询条件
+type DeadLetterFilter struct {
+	Model     string
+	AccountID uint
+	Since     time.Time
+	Limit     int
+}
+
+// ListDeadLetters 返回最近的 dead letter，最新的在前
+func ListDeadLetters(filter DeadLetterFilter) ([]model.DeadLetter, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DeadLetterDefaultLimit
+	}
+	if filter.Limit > DeadLetterMaxLimit {
+		filter.Limit = DeadLetterMaxLimit
+	}
+	query := database.GetReadDB().Model(&model.DeadLetter{})
+	if filter.Model != "" {
+		query = query.Where("model = ?", filter.Model)
+	}
+	if filter.AccountID != 0 {
+		id := strconv.FormatUint(uint64(filter.AccountID), 10)
+		query = query.Where("account_ids = ? OR account_ids LIKE ? OR account_ids LIKE ? OR account_ids LIKE ?",
+			id, id+",%", "%,"+id, "%,"+id+",%")
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	var letters []model.DeadLetter
+	err := query.Order("id desc").Limit(filter.Limit).Find(&letters).Error
+	return letters, err
+}
+
+// GetDeadLetter 按 ID 查询 dead letter
+func GetDeadLetter(id uint) (*model.DeadLetter, error) {
+	var letter model.DeadLetter
+	if err := database.GetDB().First(&letter, id).Error; err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// MarkDeadLetterReplayed 记录重放的时间和状态码
+func MarkDeadLetterReplayed(id uint, status int, now time.Time) error {
+	return database.GetDB().Model(&model.DeadLetter{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"replayed_at": now, "replay_status": status}).Error
+}
+
+// DeleteDeadLetter 删除 dead letter
+func DeleteDeadLetter(id uint) error {
+	result := database.GetDB().Delete(&model.DeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
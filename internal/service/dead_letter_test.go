@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterCapturesExhaustedRetries(t *testing.T) {
+	ctx := WithDeadLetterCollector(WithAPIKey(context.Background(), "sk-zen-0123456789abcdef"))
+	start := time.Now()
+	recordDeadLetterAttempt(ctx, "claude-sonnet-4-5-20250929", 3, UpstreamErrorRate, start, start.Add(20*time.Millisecond), &http.Response{StatusCode: 429}, nil)
+	recordDeadLetterAttempt(ctx, "claude-sonnet-4-5-20250929", 5, UpstreamErrorNetwork, start, start.Add(30*time.Millisecond), nil, errors.New("connection reset"))
+	recordDeadLetterAttempt(ctx, "claude-sonnet-4-5-20250929", 3, UpstreamErrorRate, start, start.Add(40*time.Millisecond), &http.Response{StatusCode: 429}, nil)
+
+	body := []byte(`{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"mail alice@example.com key sk-ant-abcdefghijklmnop"}]}`)
+	if entry := newDeadLetter(ctx, "POST", "/v1/messages", body, 503, time.Second, start); entry != nil {
+		t.Fatal("recorded before retries were exhausted")
+	}
+
+	err := exhaustRetries(ctx, errors.New("API error: 429"))
+	entry := newDeadLetter(ctx, "POST", "/v1/messages", body, 503, time.Second, start)
+	if entry == nil {
+		t.Fatal("no dead letter after exhausted retries")
+	}
+	if entry.Error != err.Error() || !strings.Contains(entry.Error, "all retries failed: API error: 429") {
+		t.Errorf("error = %q", entry.Error)
+	}
+	if entry.Model != "claude-sonnet-4-5-20250929" || entry.AccountIDs != "3,5" || entry.KeyMasked != "sk-z****cdef" || entry.DurationMs != 1000 {
+		t.Errorf("entry = %+v", entry)
+	}
+	var attempts []DeadLetterAttempt
+	if err := json.Unmarshal([]byte(entry.Attempts), &attempts); err != nil || len(attempts) != 3 || attempts[1].Error != "connection reset" || attempts[0].StatusCode != 429 {
+		t.Errorf("attempts = %s", entry.Attempts)
+	}
+	if strings.Contains(entry.Payload, "alice@") || strings.Contains(entry.Payload, "abcdefghijklmnop") || entry.PayloadTruncated {
+		t.Errorf("payload not sanitized: %s", entry.Payload)
+	}
+
+	// 没有收集器的请求不记录
+	if newDeadLetter(context.Background(), "POST", "/v1/messages", body, 503, time.Second, start) != nil {
+		t.Error("recorded without a collector")
+	}
+}
+
+func TestSanitizeDeadLetterPayloadTruncates(t *testing.T) {
+	payload, truncated := sanitizeDeadLetterPayload([]byte(strings.Repeat("中", 10)), 10)
+	if !truncated || payload != strings.Repeat("中", 3) {
+		t.Errorf("payload = %q, truncated = %v", payload, truncated)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -16,41 +19,72 @@ var (
 // IsDebugMode 检查是否启用调试模式
 func IsDebugMode() bool {
 	debugModeOnce.Do(func() {
-		debugMode = os.Getenv("DEBUG") == "true" || os.Getenv("DEBUG") == "1"
+		debugMode = os.Getenv("DEBUG") == "true" || os.Getenv("DEBUG") == "1" || strings.EqualFold(strings.TrimSpace(os.Getenv("LOG_LEVEL")), "debug")
 	})
 	return debugMode
 }
 
 // RequestLogger 用于收集请求级日志
 type RequestLogger struct {
-	logs     []string
-	mu       sync.Mutex
-	hasError bool
+	logs        []requestLogLine
+	mu          sync.Mutex
+	hasError    bool
+	serviceTier string
+	traceID     string
 }
 
-// NewRequestLogger 创建新的请求日志记录器
+// requestLogLine 一条请求级日志：调用处给出的级别、文本和结构化字段
+type requestLogLine struct {
+	level slog.Level
+	msg   string
+	attrs []slog.Attr
+}
+
+// text 保存到 trace 中的文本
+func (line requestLogLine) text() string {
+	return "[" + line.level.String() + "] " + line.msg
+}
+
+// NewRequestLogger 创建新的请求日志记录器，并为请求生成 traceid
 func NewRequestLogger() *RequestLogger {
 	return &RequestLogger{
-		logs: make([]string, 0, 20),
+		logs:    make([]requestLogLine, 0, 20),
+		traceID: NewTraceID(),
 	}
 }
 
-// Log 记录一条日志
+// Log 记录一条 DEBUG 日志
 func (l *RequestLogger) Log(format string, args ...interface{}) {
-	msg := fmt.Sprintf(format, args...)
-	
-	// 如果全局 DEBUG 开启，直接打印
+	l.LogAttrs(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+// LogAttrs 按调用处给出的级别记录一条带字段的日志
+// DEBUG 模式下立即输出，否则只缓冲，请求出错时在 Flush 中输出
+func (l *RequestLogger) LogAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
+	line := requestLogLine{level: level, msg: msg, attrs: attrs}
 	if IsDebugMode() {
-		log.Print("[DEBUG] " + msg)
-		return 
+		emitRequestLogLine(l.linePrefix(), line, level)
 	}
 
-	// 否则缓冲
+	// 始终缓冲，出错时按 traceid 保存
 	l.mu.Lock()
-	l.logs = append(l.logs, "[DEBUG] " + msg)
+	l.logs = append(l.logs, line)
 	l.mu.Unlock()
 }
 
+// emitRequestLogLine 按 level 输出一条请求级日志；JSON 格式下附带调用处的字段和行首标签对应的字段
+func emitRequestLogLine(prefix string, line requestLogLine, level slog.Level) {
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+	text := prefix + line.text()
+	var attrs []slog.Attr
+	if JSONLogging() {
+		attrs = mergeLogAttrs(append([]slog.Attr(nil), line.attrs...), logLineTagFields(text)...)
+	}
+	logger.LogAttrs(context.Background(), level, text, attrs...)
+}
+
 // MarkError 标记发生错误
 func (l *RequestLogger) MarkError() {
 	l.mu.Lock()
@@ -58,21 +92,87 @@ func (l *RequestLogger) MarkError() {
 	l.mu.Unlock()
 }
 
-// Flush 输出缓冲的日志（如果有错误）
+// SetServiceTier 记录上游实际使用的 service_tier
+func (l *RequestLogger) SetServiceTier(tier string) {
+	l.mu.Lock()
+	l.serviceTier = tier
+	l.mu.Unlock()
+}
+
+// ServiceTier 返回上游实际使用的 service_tier，未知时为空
+func (l *RequestLogger) ServiceTier() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.serviceTier
+}
+
+// SetTraceID 替换本次请求的 traceid 并标记错误，请求结束时日志按该 ID 保存
+func (l *RequestLogger) SetTraceID(traceID string) {
+	l.mu.Lock()
+	l.traceID = traceID
+	l.hasError = true
+	l.mu.Unlock()
+}
+
+// TraceID 返回本次请求的 traceid
+func (l *RequestLogger) TraceID() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.traceID
+}
+
+// linePrefix 打印到服务端日志的每一行都带上 traceid，便于按客户端拿到的 X-Trace-Id 检索
+func (l *RequestLogger) linePrefix() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.traceID == "" {
+		return ""
+	}
+	return "[" + l.traceID + "] "
+}
+
+// texts 返回缓冲日志的文本，调用方需持有锁
+func (l *RequestLogger) texts() []string {
+	logs := make([]string, len(l.logs))
+	for i, line := range l.logs {
+		logs[i] = line.text()
+	}
+	return logs
+}
+
+// Flush 输出缓冲的日志（如果有错误），并按 traceid 保存出错请求的日志供后台查询
 func (l *RequestLogger) Flush() {
-	// 只有在非 Debug 模式且发生错误时才需要 Flush (Debug 模式下已经实时打印了)
+	prefix := l.linePrefix()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 只有在非 Debug 模式且发生错误时才需要输出 (Debug 模式下已经实时打印了)
+	// 缓冲的日志多为 DEBUG，请求出错后需要在默认级别下可见，至少按 WARN 输出
 	if !IsDebugMode() && l.hasError {
-		l.mu.Lock()
-		defer l.mu.Unlock()
-		for _, msg := range l.logs {
-			log.Print(msg)
+		for _, line := range l.logs {
+			level := line.level
+			if level < slog.LevelWarn {
+				level = slog.LevelWarn
+			}
+			emitRequestLogLine(prefix, line, level)
 		}
 	}
+	if l.hasError && l.traceID != "" {
+		getTraceStore().put(Trace{
+			ID:          l.traceID,
+			CreatedAt:   time.Now(),
+			ServiceTier: l.serviceTier,
+			Logs:        l.texts(),
+		})
+	}
 }
 
 type contextKey string
 
-const loggerContextKey contextKey = "request_logger"
+const (
+	loggerContextKey contextKey = "request_logger"
+	apiKeyContextKey contextKey = "api_key"
+)
 
 // WithLogger 将 logger 注入 context
 func WithLogger(ctx context.Context, logger *RequestLogger) context.Context {
@@ -90,6 +190,17 @@ func GetLogger(ctx context.Context) *RequestLogger {
 	return nil
 }
 
+// WithAPIKey 将客户端使用的 API Key 注入 context
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey, key)
+}
+
+// GetAPIKey 从 context 获取客户端使用的 API Key
+func GetAPIKey(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyContextKey).(string)
+	return key
+}
+
 // 辅助函数：获取 logger 并记录
 func logToContext(ctx context.Context, format string, args ...interface{}) {
 	logger := GetLogger(ctx)
@@ -100,6 +211,15 @@ func logToContext(ctx context.Context, format string, args ...interface{}) {
 	}
 }
 
+// logAttrsToContext 按级别记录一条带字段的请求日志；没有请求 logger 时 DEBUG 模式下直接输出
+func logAttrsToContext(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if logger := GetLogger(ctx); logger != nil {
+		logger.LogAttrs(level, msg, attrs...)
+	} else if IsDebugMode() {
+		emitRequestLogLine("", requestLogLine{level: level, msg: msg, attrs: attrs}, level)
+	}
+}
+
 // DebugLog 调试日志输出
 func DebugLog(ctx context.Context, format string, args ...interface{}) {
 	logToContext(ctx, format, args...)
@@ -107,7 +227,8 @@ func DebugLog(ctx context.Context, format string, args ...interface{}) {
 
 // DebugLogRequest 请求开始日志
 func DebugLogRequest(ctx context.Context, provider, endpoint, model string) {
-	logToContext(ctx, "[%s] >>> 请求开始: endpoint=%s, model=%s", provider, endpoint, model)
+	logAttrsToContext(ctx, slog.LevelDebug, fmt.Sprintf("[%s] >>> 请求开始: endpoint=%s, model=%s", provider, endpoint, model),
+		slog.String("endpoint", endpoint), slog.String("model", model))
 }
 
 // DebugLogRetry 重试日志
@@ -115,12 +236,13 @@ func DebugLogRetry(ctx context.Context, provider string, attempt int, accountID
     if logger := GetLogger(ctx); logger != nil {
         logger.MarkError()
     }
-	logToContext(ctx, "[%s] ↻ 重试 #%d: accountID=%d, error=%v", provider, attempt, accountID, err)
+	logAttrsToContext(ctx, slog.LevelWarn, fmt.Sprintf("[%s] ↻ 重试 #%d: accountID=%d, error=%v", provider, attempt, accountID, err),
+		slog.Int("attempt", attempt), logAccountID(accountID), logError(err))
 }
 
 // DebugLogAccountSelected 账号选择日志
 func DebugLogAccountSelected(ctx context.Context, provider string, accountID uint, email string) {
-	logToContext(ctx, "[%s] ✓ 选择账号: id=%d, email=%s", provider, accountID, email)
+	logAttrsToContext(ctx, slog.LevelDebug, fmt.Sprintf("[%s] ✓ 选择账号: id=%d, email=%s", provider, accountID, email), logAccountID(accountID))
 }
 
 // DebugLogRequestSent 请求发送日志
@@ -130,7 +252,16 @@ func DebugLogRequestSent(ctx context.Context, provider, url string) {
 
 // DebugLogResponseReceived 响应接收日志
 func DebugLogResponseReceived(ctx context.Context, provider string, statusCode int) {
-	logToContext(ctx, "[%s] ← 收到响应: status=%d", provider, statusCode)
+	logAttrsToContext(ctx, slog.LevelDebug, fmt.Sprintf("[%s] ← 收到响应: status=%d", provider, statusCode), slog.Int("status", statusCode))
+}
+
+// RecordClientDisconnected 在请求日志中记录客户端中途断开，流式响应随之中止
+func RecordClientDisconnected(ctx context.Context, err error) {
+	if logger := GetLogger(ctx); logger != nil {
+		logger.MarkError()
+	}
+	logAttrsToContext(ctx, slog.LevelWarn, fmt.Sprintf("[Stream] client_disconnected: 写入客户端失败，停止读取上游: %v", err),
+		slog.String("event", "client_disconnected"), logError(err))
 }
 
 // DebugLogRequestEnd 请求结束日志
@@ -139,9 +270,10 @@ func DebugLogRequestEnd(ctx context.Context, provider string, success bool, err
         if logger := GetLogger(ctx); logger != nil {
             logger.MarkError()
         }
-		logToContext(ctx, "[%s] <<< 请求完成: success=false, error=%v", provider, err)
+		logAttrsToContext(ctx, slog.LevelWarn, fmt.Sprintf("[%s] <<< 请求完成: success=false, error=%v", provider, err),
+			slog.Bool("success", false), logError(err))
     } else {
-        logToContext(ctx, "[%s] <<< 请求完成: success=true", provider)
+        logAttrsToContext(ctx, slog.LevelDebug, fmt.Sprintf("[%s] <<< 请求完成: success=true", provider), slog.Bool("success", true))
     }
 }
 
@@ -173,7 +305,8 @@ func DebugLogResponseHeaders(ctx context.Context, provider string, headers map[s
 
 // DebugLogActualModel 实际调用模型日志
 func DebugLogActualModel(ctx context.Context, provider, requestModel, actualModel string) {
-	logToContext(ctx, "[%s] 模型映射: %s → %s", provider, requestModel, actualModel)
+	logAttrsToContext(ctx, slog.LevelDebug, fmt.Sprintf("[%s] 模型映射: %s → %s", provider, requestModel, actualModel),
+		slog.String("model", requestModel), slog.String("upstream_model", actualModel))
 }
 
 // DebugLogErrorResponse 错误响应内容日志
@@ -181,5 +314,5 @@ func DebugLogErrorResponse(ctx context.Context, provider string, statusCode int,
     if logger := GetLogger(ctx); logger != nil {
         logger.MarkError()
     }
-	logToContext(ctx, "[%s] ✗ 错误响应 [%d]: %s", provider, statusCode, body)
+	logAttrsToContext(ctx, slog.LevelWarn, fmt.Sprintf("[%s] ✗ 错误响应 [%d]: %s", provider, statusCode, body), slog.Int("status", statusCode))
 }
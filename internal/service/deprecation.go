@@ -0,0 +1,237 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+var (
+	modelDeprecationsMu   sync.RWMutex
+	modelDeprecations     map[string]model.ModelDeprecation
+	modelDeprecationsOnce sync.Once
+)
+
+// loadModelDeprecations 从 MODEL_DEPRECATIONS 读取模型弃用计划
+func loadModelDeprecations() {
+	modelDeprecations = parseModelDeprecations(os.Getenv("MODEL_DEPRECATIONS"))
+	if len(modelDeprecations) > 0 {
+		log.Printf("[INFO] 已加载 %d 个模型弃用计划", len(modelDeprecations))
+	}
+}
+
+// parseDeprecationTime 支持 2006-01-02（本地时间零点）和 RFC3339
+func parseDeprecationTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// parseModelDeprecations 解析模型弃用计划
+// 格式: model=deprecated_at/sunset_at/replacement，逗号分隔，下线时间和替代模型可省略，
+// 例如 claude-sonnet-4-20250514=2026-01-01/2026-03-01/claude-sonnet-4-5-20250929
+func parseModelDeprecations(raw string) map[string]model.ModelDeprecation {
+	result := make(map[string]model.ModelDeprecation)
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return result
+	}
+
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		modelID := strings.TrimSpace(parts[0])
+		values := strings.SplitN(parts[1], "/", 3)
+		for len(values) < 3 {
+			values = append(values, "")
+		}
+		deprecatedAt, err1 := parseDeprecationTime(values[0])
+		sunsetAt, err2 := parseDeprecationTime(values[1])
+		dep := model.ModelDeprecation{
+			DeprecatedAt:     deprecatedAt,
+			SunsetAt:         sunsetAt,
+			ReplacementModel: strings.TrimSpace(values[2]),
+		}
+		if err1 != nil || err2 != nil || deprecatedAt.IsZero() {
+			log.Printf("[WARN] MODEL_DEPRECATIONS 中 %s 的值无效，已忽略: %s", modelID, parts[1])
+			continue
+		}
+		if err := validateModelDeprecation(modelID, dep); err != nil {
+			log.Printf("[WARN] MODEL_DEPRECATIONS 中 %s 的值无效，已忽略: %v", modelID, err)
+			continue
+		}
+		result[modelID] = dep
+	}
+	return result
+}
+
+func validateModelDeprecation(modelID string, dep model.ModelDeprecation) error {
+	if dep.DeprecatedAt.IsZero() {
+		return fmt.Errorf("deprecatedAt is required")
+	}
+	if !dep.SunsetAt.IsZero() && dep.SunsetAt.Before(dep.DeprecatedAt) {
+		return fmt.Errorf("sunsetAt must not be before deprecatedAt")
+	}
+	if dep.ReplacementModel == modelID {
+		return fmt.Errorf("replacementModel must differ from the model")
+	}
+	return nil
+}
+
+// applyModelDeprecations 把弃用计划应用到新同步的模型集
+func applyModelDeprecations(models map[string]model.ZenModel) {
+	modelDeprecationsOnce.Do(loadModelDeprecations)
+	modelDeprecationsMu.RLock()
+	defer modelDeprecationsMu.RUnlock()
+
+	for modelID, dep := range modelDeprecations {
+		if m, ok := models[modelID]; ok {
+			dep := dep
+			m.Deprecation = &dep
+			models[modelID] = m
+		}
+	}
+}
+
+// SetModelDeprecation 运行时设置模型的弃用计划（仅内存生效，重启后以环境变量为准），dep 为 nil 时撤销
+// 计划会在每次模型同步后重新应用
+func SetModelDeprecation(modelID string, dep *model.ModelDeprecation) error {
+	if _, ok := model.GetZenModel(modelID); !ok {
+		return fmt.Errorf("unknown model: %s", modelID)
+	}
+	if dep != nil {
+		if err := validateModelDeprecation(modelID, *dep); err != nil {
+			return err
+		}
+		if dep.ReplacementModel != "" {
+			if _, ok := model.GetZenModel(dep.ReplacementModel); !ok {
+				return fmt.Errorf("unknown replacement model: %s", dep.ReplacementModel)
+			}
+		}
+	}
+
+	modelDeprecationsOnce.Do(loadModelDeprecations)
+	modelDeprecationsMu.Lock()
+	if dep == nil {
+		delete(modelDeprecations, modelID)
+	} else {
+		modelDeprecations[modelID] = *dep
+	}
+	modelDeprecationsMu.Unlock()
+
+	defaults := model.DefaultZenModels()
+	model.UpdateZenModels(func(models map[string]model.ZenModel) {
+		m, ok := models[modelID]
+		if !ok {
+			return
+		}
+		if dep == nil {
+			m.Deprecation = nil
+			if tpl, ok := defaults[modelID]; ok {
+				m.Deprecation = tpl.Deprecation
+			}
+		} else {
+			d := *dep
+			m.Deprecation = &d
+		}
+		models[modelID] = m
+	})
+	return nil
+}
+
+// ModelDeprecationNotice 一次请求命中的弃用信息
+type ModelDeprecationNotice struct {
+	Model       string                  // 客户端请求的模型
+	Resolved    string                  // 实际使用的模型，下线后为替代模型
+	Deprecation *model.ModelDeprecation // 请求模型的弃用计划
+}
+
+// Redirected 是否因下线改用了替代模型
+func (n ModelDeprecationNotice) Redirected() bool {
+	return n.Resolved != n.Model
+}
+
+// CheckModelDeprecation 检查模型是否已弃用，已下线且配置了替代模型时返回替代模型
+// 模型未弃用时返回 false
+func CheckModelDeprecation(modelID string, now time.Time) (ModelDeprecationNotice, bool) {
+	zenModel, ok := model.GetZenModel(modelID)
+	if !ok || !zenModel.Deprecation.IsDeprecated(now) {
+		return ModelDeprecationNotice{}, false
+	}
+	return ModelDeprecationNotice{
+		Model:       modelID,
+		Resolved:    model.ResolveSunsetModel(modelID, now),
+		Deprecation: zenModel.Deprecation,
+	}, true
+}
+
+// ModelDeprecationEntry /api/models/deprecations 中的一项
+type ModelDeprecationEntry struct {
+	Model            string     `json:"model"`
+	Status           string     `json:"status"` // scheduled / deprecated / sunset
+	DeprecatedAt     time.Time  `json:"deprecated_at"`
+	SunsetAt         *time.Time `json:"sunset_at"`
+	ReplacementModel string     `json:"replacement_model,omitempty"`
+	// DaysUntilSunset 距下线的天数，已下线或未设置下线时间时为 null
+	DaysUntilSunset *int `json:"days_until_sunset"`
+}
+
+// ListModelDeprecations 返回所有带弃用计划的模型，即将下线的在前
+func ListModelDeprecations(now time.Time) []ModelDeprecationEntry {
+	ids := model.ListZenModelIDs()
+	models := model.ListZenModels()
+	entries := []ModelDeprecationEntry{}
+	for i, m := range models {
+		dep := m.Deprecation
+		if dep == nil {
+			continue
+		}
+		entry := ModelDeprecationEntry{
+			Model:            ids[i],
+			Status:           "scheduled",
+			DeprecatedAt:     dep.DeprecatedAt,
+			ReplacementModel: dep.ReplacementModel,
+		}
+		switch {
+		case dep.IsSunset(now):
+			entry.Status = "sunset"
+		case dep.IsDeprecated(now):
+			entry.Status = "deprecated"
+		}
+		if !dep.SunsetAt.IsZero() {
+			sunset := dep.SunsetAt
+			entry.SunsetAt = &sunset
+			if !dep.IsSunset(now) {
+				days := int(sunset.Sub(now).Hours() / 24)
+				entry.DaysUntilSunset = &days
+			}
+		}
+		entries = append(entries, entry)
+	}
+	// 有下线时间的按时间先后，没有的排在最后
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].SunsetAt, entries[j].SunsetAt
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return entries[i].Model < entries[j].Model
+	})
+	return entries
+}
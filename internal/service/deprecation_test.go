@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestParseModelDeprecations(t *testing.T) {
+	got := parseModelDeprecations("claude-sonnet-4-20250514=2026-01-01/2026-03-01/claude-sonnet-4-5-20250929, gpt-5-codex=2026-02-01T00:00:00Z, bad=later, loop=2026-01-01//loop")
+	if len(got) != 2 {
+		t.Fatalf("got %d entries: %+v", len(got), got)
+	}
+	sonnet := got["claude-sonnet-4-20250514"]
+	if sonnet.ReplacementModel != "claude-sonnet-4-5-20250929" || sonnet.SunsetAt.Format("2006-01-02") != "2026-03-01" {
+		t.Errorf("sonnet = %+v", sonnet)
+	}
+	codex := got["gpt-5-codex"]
+	if !codex.SunsetAt.IsZero() || codex.ReplacementModel != "" || !codex.DeprecatedAt.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("codex = %+v", codex)
+	}
+}
+
+func TestModelDeprecationLifecycle(t *testing.T) {
+	defer model.ResetZenModelsToDefault()
+	const old, next = "claude-sonnet-4-20250514", "claude-sonnet-4-5-20250929"
+	deprecatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunsetAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := SetModelDeprecation(old, &model.ModelDeprecation{DeprecatedAt: deprecatedAt, SunsetAt: sunsetAt, ReplacementModel: next}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetModelDeprecation(old, nil)
+
+	if _, ok := CheckModelDeprecation(old, deprecatedAt.Add(-time.Hour)); ok {
+		t.Error("should not warn before deprecatedAt")
+	}
+	notice, ok := CheckModelDeprecation(old, deprecatedAt.Add(time.Hour))
+	if !ok || notice.Redirected() {
+		t.Errorf("deprecated notice = %+v, %v", notice, ok)
+	}
+	notice, ok = CheckModelDeprecation(old, sunsetAt)
+	if !ok || !notice.Redirected() || notice.Resolved != next {
+		t.Errorf("sunset notice = %+v, %v", notice, ok)
+	}
+
+	entries := ListModelDeprecations(sunsetAt.Add(-48 * time.Hour))
+	if len(entries) != 1 || entries[0].Model != old || entries[0].Status != "deprecated" || *entries[0].DaysUntilSunset != 2 {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	// 模型同步后重新应用弃用计划
+	models := model.DefaultZenModels()
+	applyModelDeprecations(models)
+	if models[old].Deprecation == nil || models[old].Deprecation.ReplacementModel != next {
+		t.Errorf("deprecation not reapplied: %+v", models[old].Deprecation)
+	}
+
+	if err := SetModelDeprecation(old, &model.ModelDeprecation{DeprecatedAt: deprecatedAt, ReplacementModel: "missing"}); err == nil {
+		t.Error("unknown replacement should be rejected")
+	}
+	if err := SetModelDeprecation(old, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(ListModelDeprecations(sunsetAt)) != 0 {
+		t.Error("deprecation not cleared")
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// AccountProvider 账号选择与状态维护，默认实现为全局号池
+type AccountProvider interface {
+	GetNextAccountForModel(modelID string) (*model.Account, error)
+	ReleaseAccount(account *model.Account)
+	MarkAccountError(account *model.Account)
+	ResetAccountError(account *model.Account)
+	MarkAccountRateLimitedShort(account *model.Account, cooling time.Duration)
+	MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Response, cooling time.Duration)
+	FreezeAccount(account *model.Account, duration time.Duration)
+}
+
+// PreferredAccountProvider 可选接口：支持优先选择指定账号的号池实现，用于 prompt cache 亲和
+type PreferredAccountProvider interface {
+	GetPreferredAccountForModel(modelID string, preferredID uint) (*model.Account, error)
+}
+
+// SessionAccountProvider 可选接口：长连接在整个连接期间持有账号，返回的函数代替 ReleaseAccount 释放
+type SessionAccountProvider interface {
+	HoldAccount(account *model.Account) func()
+}
+
+// CreditTracker 积分消耗记录
+type CreditTracker interface {
+	UseCredit(account *model.Account, multiplier float64)
+	UpdateAccountCreditsFromResponse(account *model.Account, resp *http.Response, modelMultiplier float64)
+}
+
+// Upstream 上游HTTP客户端工厂
+type Upstream interface {
+	Client(proxy string, zenModel model.ZenModel) *http.Client
+	ProxyClient(proxyURL string, zenModel model.ZenModel) (*http.Client, error)
+}
+
+// Dependencies 代理服务依赖，零值字段使用默认实现
+type Dependencies struct {
+	Accounts AccountProvider
+	Credits  CreditTracker
+	Upstream Upstream
+}
+
+// DefaultDependencies 返回基于全局号池和数据库的默认依赖
+func DefaultDependencies() Dependencies {
+	return Dependencies{
+		Accounts: poolAccountProvider{},
+		Credits:  poolCreditTracker{},
+		Upstream: httpUpstream{},
+	}
+}
+
+func (d Dependencies) withDefaults() Dependencies {
+	def := DefaultDependencies()
+	if d.Accounts == nil {
+		d.Accounts = def.Accounts
+	}
+	if d.Credits == nil {
+		d.Credits = def.Credits
+	}
+	if d.Upstream == nil {
+		d.Upstream = def.Upstream
+	}
+	return d
+}
+
+// poolAccountProvider 委托给全局号池
+type poolAccountProvider struct{}
+
+func (poolAccountProvider) GetNextAccountForModel(modelID string) (*model.Account, error) {
+	return GetNextAccountForModel(modelID)
+}
+
+func (poolAccountProvider) GetPreferredAccountForModel(modelID string, preferredID uint) (*model.Account, error) {
+	return GetPreferredAccountForModel(modelID, preferredID)
+}
+
+func (poolAccountProvider) ReleaseAccount(account *model.Account) {
+	ReleaseAccount(account)
+}
+
+func (poolAccountProvider) HoldAccount(account *model.Account) func() {
+	return HoldAccount(account)
+}
+
+func (poolAccountProvider) MarkAccountError(account *model.Account) {
+	MarkAccountError(account)
+}
+
+func (poolAccountProvider) ResetAccountError(account *model.Account) {
+	ResetAccountError(account)
+}
+
+func (poolAccountProvider) MarkAccountRateLimitedShort(account *model.Account, cooling time.Duration) {
+	MarkAccountRateLimitedShort(account, cooling)
+}
+
+func (poolAccountProvider) MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Response, cooling time.Duration) {
+	MarkAccountRateLimitedWithResponse(account, resp, cooling)
+}
+
+func (poolAccountProvider) FreezeAccount(account *model.Account, duration time.Duration) {
+	FreezeAccount(account, duration)
+}
+
+// poolCreditTracker 委托给号池的积分记录
+type poolCreditTracker struct{}
+
+func (poolCreditTracker) UseCredit(account *model.Account, multiplier float64) {
+	UseCredit(account, multiplier)
+}
+
+func (poolCreditTracker) UpdateAccountCreditsFromResponse(account *model.Account, resp *http.Response, modelMultiplier float64) {
+	UpdateAccountCreditsFromResponse(account, resp, modelMultiplier)
+}
+
+// httpUpstream 按模型超时配置创建真实HTTP客户端，模型配置为 sdk 时经官方 SDK 发送
+type httpUpstream struct{}
+
+func (httpUpstream) Client(proxy string, zenModel model.ZenModel) *http.Client {
+	return withUpstreamTransport(newUpstreamClient(proxy, zenModel), zenModel)
+}
+
+func (httpUpstream) ProxyClient(proxyURL string, zenModel model.ZenModel) (*http.Client, error) {
+	client, err := newUpstreamProxyClient(proxyURL, zenModel)
+	if err != nil {
+		return nil, err
+	}
+	return withUpstreamTransport(client, zenModel), nil
+}
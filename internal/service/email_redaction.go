@@ -0,0 +1,119 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 邮箱脱敏方式
+const (
+	EmailRedactionOff  = "off"  // 原样输出（默认）
+	EmailRedactionMask = "mask" // 只保留首字母和域名: j***@gmail.com
+	EmailRedactionHash = "hash" // 替换为哈希，同一邮箱结果相同，便于在日志中关联: email-1a2b3c4d@gmail.com
+)
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+var (
+	emailRedactionMu   sync.RWMutex
+	emailRedactionMode string
+	emailRedactionOnce sync.Once
+)
+
+func validEmailRedaction(mode string) bool {
+	switch mode {
+	case EmailRedactionOff, EmailRedactionMask, EmailRedactionHash:
+		return true
+	}
+	return false
+}
+
+// loadEmailRedaction 从 EMAIL_REDACTION 读取日志中邮箱的脱敏方式
+func loadEmailRedaction() {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("EMAIL_REDACTION")))
+	if mode == "" {
+		mode = EmailRedactionOff
+	} else if !validEmailRedaction(mode) {
+		// 配置错误时宁可多脱敏
+		fmt.Fprintf(os.Stderr, "[WARN] 无效的 EMAIL_REDACTION: %s，使用 mask\n", mode)
+		mode = EmailRedactionMask
+	}
+	emailRedactionMode = mode
+}
+
+// GetEmailRedaction 获取日志中邮箱的脱敏方式
+func GetEmailRedaction() string {
+	emailRedactionOnce.Do(loadEmailRedaction)
+	emailRedactionMu.RLock()
+	defer emailRedactionMu.RUnlock()
+	return emailRedactionMode
+}
+
+// SetEmailRedaction 运行时修改日志中邮箱的脱敏方式（仅内存生效）
+func SetEmailRedaction(mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if !validEmailRedaction(mode) {
+		return fmt.Errorf("mode 只能为 off、mask 或 hash")
+	}
+	emailRedactionOnce.Do(loadEmailRedaction)
+	emailRedactionMu.Lock()
+	emailRedactionMode = mode
+	emailRedactionMu.Unlock()
+	log.Printf("[EmailRedaction] 日志邮箱脱敏方式已调整为 %s", mode)
+	return nil
+}
+
+// RedactEmail 按 mode 脱敏单个邮箱
+func RedactEmail(email, mode string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return email
+	}
+	switch mode {
+	case EmailRedactionMask:
+		return string([]rune(local)[:1]) + "***@" + domain
+	case EmailRedactionHash:
+		sum := sha256.Sum256([]byte(strings.ToLower(email)))
+		return "email-" + hex.EncodeToString(sum[:4]) + "@" + domain
+	}
+	return email
+}
+
+// RedactEmails 按 mode 脱敏文本中出现的所有邮箱
+func RedactEmails(text, mode string) string {
+	if mode == EmailRedactionOff || mode == "" || !strings.Contains(text, "@") {
+		return text
+	}
+	return emailPattern.ReplaceAllStringFunc(text, func(email string) string {
+		return RedactEmail(email, mode)
+	})
+}
+
+// redactingLogWriter 按当前设置脱敏每条日志中的邮箱
+type redactingLogWriter struct {
+	w io.Writer
+}
+
+// NewRedactingLogWriter 包装日志输出，用于 log.SetOutput
+func NewRedactingLogWriter(w io.Writer) io.Writer {
+	return redactingLogWriter{w: w}
+}
+
+func (r redactingLogWriter) Write(p []byte) (int, error) {
+	mode := GetEmailRedaction()
+	if mode == EmailRedactionOff {
+		return r.w.Write(p)
+	}
+	// log 包每条日志只调用一次 Write，返回原长度避免被当作短写
+	if _, err := io.WriteString(r.w, RedactEmails(string(p), mode)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
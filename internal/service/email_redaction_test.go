@@ -0,0 +1,48 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactEmails(t *testing.T) {
+	const line = "[账号刷新] 账号 ID:3 邮箱不匹配 (期望: john.doe@gmail.com, 实际: Amy+x@corp.example.org)"
+
+	if got := RedactEmails(line, EmailRedactionOff); got != line {
+		t.Errorf("off changed text: %s", got)
+	}
+	masked := RedactEmails(line, EmailRedactionMask)
+	if !strings.Contains(masked, "j***@gmail.com") || !strings.Contains(masked, "A***@corp.example.org") || strings.Contains(masked, "john.doe") {
+		t.Errorf("mask = %s", masked)
+	}
+
+	hashed := RedactEmails(line, EmailRedactionHash)
+	if strings.Contains(hashed, "john.doe") || !strings.Contains(hashed, "@gmail.com") {
+		t.Errorf("hash = %s", hashed)
+	}
+	// 同一邮箱（忽略大小写）哈希一致，便于关联
+	if RedactEmail("John.Doe@gmail.com", EmailRedactionHash) != RedactEmail("john.doe@gmail.com", EmailRedactionHash) {
+		t.Error("hash differs by case")
+	}
+}
+
+func TestRedactingLogWriter(t *testing.T) {
+	defer SetEmailRedaction(EmailRedactionOff)
+	if err := SetEmailRedaction("everything"); err == nil {
+		t.Error("invalid mode accepted")
+	}
+	if err := SetEmailRedaction(EmailRedactionMask); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	line := []byte("user alice@example.com logged in\n")
+	n, err := NewRedactingLogWriter(&buf).Write(line)
+	if err != nil || n != len(line) {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if buf.String() != "user a***@example.com logged in\n" {
+		t.Errorf("log = %q", buf.String())
+	}
+}
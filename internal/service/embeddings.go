@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// Embeddings 处理 /v1/embeddings：只接受 embedding 类型的模型，经号池转发到上游，
+// 与对话接口一样按 Zen-Request-Cost 更新账号积分并写入请求日志。上游的 4xx 参数错误原样返回
+func (s *OpenAIService) Embeddings(ctx context.Context, body []byte) (*http.Response, error) {
+	var req struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, invalidRequest("invalid request body: %v", err)
+	}
+	if req.Model == "" {
+		return nil, invalidRequest("model is required")
+	}
+	if len(req.Input) == 0 || string(req.Input) == "null" {
+		return nil, invalidRequest("input is required")
+	}
+
+	if !EnsureModelAvailable(req.Model) {
+		DebugLog(ctx, "[OpenAI] 模型不存在: %s", req.Model)
+		return nil, ErrNoAvailableAccount
+	}
+	zenModel, _ := model.GetZenModel(req.Model)
+	if !zenModel.IsEmbedding() {
+		return nil, invalidRequest("model %s is not an embedding model", req.Model)
+	}
+
+	DebugLogRequest(ctx, "OpenAI", "/v1/embeddings", req.Model)
+
+	policy := GetRetryPolicy("openai")
+	budget := newLatencyBudget(ctx)
+	var lastErr error
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.deps.Accounts.GetNextAccountForModel(req.Model)
+		if err != nil {
+			DebugLogRequestEnd(ctx, "OpenAI", false, err)
+			return nil, err
+		}
+		DebugLogAccountSelected(ctx, "OpenAI", account.ID, account.Email)
+
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doEmbeddingRequest(attemptCtx, account, zenModel, body))
+		RecordUpstreamResult(ctx, req.Model, account.ID, start, resp, err)
+		if err != nil {
+			s.deps.Accounts.ReleaseAccount(account)
+			s.deps.Accounts.MarkAccountError(account)
+			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "OpenAI", false, err)
+				return nil, err
+			}
+			DebugLogRetry(ctx, "OpenAI", i+1, account.ID, err)
+			continue
+		}
+		DebugLogResponseReceived(ctx, "OpenAI", resp.StatusCode)
+
+		if resp.StatusCode >= 400 {
+			errBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			DebugLogErrorResponse(ctx, "OpenAI", resp.StatusCode, string(errBody))
+
+			switch resp.StatusCode {
+			case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+				// 请求本身的问题，换号也无法解决
+				s.deps.Accounts.ReleaseAccount(account)
+				DebugLogRequestEnd(ctx, "OpenAI", false, fmt.Errorf("API error: %d", resp.StatusCode))
+				resp.Body = io.NopCloser(bytes.NewReader(errBody))
+				return resp, nil
+			case http.StatusTooManyRequests:
+				proxyResp, proxyErr := s.retryWithProxy(ctx, account, req.Model, "/v1/embeddings", body)
+				if proxyErr == nil && proxyResp != nil {
+					s.deps.Accounts.ReleaseAccount(account)
+					return proxyResp, nil
+				}
+				log.Printf("[WARN] [OpenAI] embeddings 代理重试失败: %v", proxyErr)
+				s.deps.Accounts.MarkAccountRateLimitedWithResponse(account, resp, policy.Cooling())
+			default:
+				s.deps.Accounts.MarkAccountError(account)
+			}
+
+			s.deps.Accounts.ReleaseAccount(account)
+			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
+			DebugLogRetry(ctx, "OpenAI", i+1, account.ID, lastErr)
+			continue
+		}
+
+		s.deps.Accounts.ResetAccountError(account)
+		s.deps.Accounts.ReleaseAccount(account)
+		s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
+		DebugLogRequestEnd(ctx, "OpenAI", true, nil)
+		return resp, nil
+	}
+
+	DebugLogRequestEnd(ctx, "OpenAI", false, lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
+}
+
+// doEmbeddingRequest 原样转发 embeddings 请求体，输入可能很大，不记录请求体
+func (s *OpenAIService) doEmbeddingRequest(ctx context.Context, account *model.Account, zenModel model.ZenModel, body []byte) (*http.Response, error) {
+	reqURL := OpenAIBaseURL + "/v1/embeddings"
+	DebugLogRequestSent(ctx, "OpenAI", reqURL)
+
+	httpReq, err := http.NewRequestWithContext(upstreamContext(ctx), "POST", reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	SetZencoderHeaders(httpReq, account, zenModel)
+	if zenModel.Parameters != nil {
+		for k, v := range zenModel.Parameters.ExtraHeaders {
+			httpReq.Header.Set(k, v)
+		}
+	}
+	return s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel).Do(httpReq)
+}
+
+// EmbeddingsProxy 代理 embeddings 请求
+func (s *OpenAIService) EmbeddingsProxy(ctx context.Context, w http.ResponseWriter, body []byte) error {
+	resp, err := s.Embeddings(ctx, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return CopyResponse(ctx, w, resp)
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// endUserMaxPerKey 每个 Key 记录的终端用户上限，超出时淘汰最久未出现的
+	endUserMaxPerKey = 10000
+	// endUserListLimit 设置接口返回的终端用户条数上限
+	endUserListLimit = 100
+)
+
+// EndUserLimitError 终端用户超出每分钟请求数限制
+type EndUserLimitError struct {
+	Limit      int
+	RetryAfter int // 秒
+}
+
+func (e *EndUserLimitError) Error() string {
+	return fmt.Sprintf("end user rate limit exceeded: %d requests per minute", e.Limit)
+}
+
+// endUserUsage 单个终端用户的用量
+type endUserUsage struct {
+	minute   int64
+	count    int
+	requests int
+	limited  int
+	lastSeen time.Time
+}
+
+type endUserLimiter struct {
+	mu        sync.Mutex
+	salt      string
+	limit     int            // 每个终端用户每分钟请求数，0 表示不限制
+	keyLimits map[string]int // 按 API Key 覆盖的限制
+	usage     map[string]map[string]*endUserUsage
+}
+
+var (
+	endUserState *endUserLimiter
+	endUserOnce  sync.Once
+)
+
+func newEndUserLimiter(salt string, limit int) *endUserLimiter {
+	return &endUserLimiter{
+		salt:      salt,
+		limit:     limit,
+		keyLimits: make(map[string]int),
+		usage:     make(map[string]map[string]*endUserUsage),
+	}
+}
+
+// getEndUserLimiter 读取 END_USER_RATE_LIMIT / END_USER_HASH_SALT
+func getEndUserLimiter() *endUserLimiter {
+	endUserOnce.Do(func() {
+		salt := os.Getenv("END_USER_HASH_SALT")
+		if salt == "" {
+			b := make([]byte, 16)
+			rand.Read(b)
+			salt = hex.EncodeToString(b)
+		}
+		endUserState = newEndUserLimiter(salt, envNonNegativeIntDefault("END_USER_RATE_LIMIT", 0))
+		if endUserState.limit > 0 {
+			log.Printf("[INFO] 已启用终端用户限流 (每个 metadata.user_id 每分钟 %d 次请求)", endUserState.limit)
+			if os.Getenv("END_USER_HASH_SALT") == "" {
+				log.Printf("[WARN] 未设置 END_USER_HASH_SALT，终端用户哈希在重启后会变化")
+			}
+		}
+	})
+	return endUserState
+}
+
+// hash 按 Key 隔离的终端用户哈希，不同 Key 下相同的 user_id 互不影响，统计中不保留原始 ID
+func (l *endUserLimiter) hash(apiKey, userID string) string {
+	sum := sha256.Sum256([]byte(l.salt + "\x00" + apiKey + "\x00" + userID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// check 统计终端用户的请求，超过每分钟限制时返回 EndUserLimitError
+func (l *endUserLimiter) check(apiKey, userID string, now time.Time) (string, error) {
+	hash := l.hash(apiKey, userID)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	users := l.usage[apiKey]
+	if users == nil {
+		users = make(map[string]*endUserUsage)
+		l.usage[apiKey] = users
+	}
+	u := users[hash]
+	if u == nil {
+		if len(users) >= endUserMaxPerKey {
+			evictOldestEndUser(users)
+		}
+		u = &endUserUsage{}
+		users[hash] = u
+	}
+	if minute := now.Unix() / 60; minute != u.minute {
+		u.minute = minute
+		u.count = 0
+	}
+	u.lastSeen = now
+
+	limit := l.limit
+	if n, ok := l.keyLimits[apiKey]; ok {
+		limit = n
+	}
+	if limit > 0 && u.count >= limit {
+		u.limited++
+		return hash, &EndUserLimitError{Limit: limit, RetryAfter: int(60 - now.Unix()%60)}
+	}
+	u.count++
+	u.requests++
+	return hash, nil
+}
+
+func evictOldestEndUser(users map[string]*endUserUsage) {
+	var oldest string
+	var oldestSeen time.Time
+	for hash, u := range users {
+		if oldest == "" || u.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = hash, u.lastSeen
+		}
+	}
+	delete(users, oldest)
+}
+
+// AnthropicEndUserID 读取 Anthropic 请求体中的 metadata.user_id，没有时返回空字符串
+func AnthropicEndUserID(body []byte) string {
+	var req struct {
+		Metadata struct {
+			UserID string `json:"user_id"`
+		} `json:"metadata"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return ""
+	}
+	return strings.TrimSpace(req.Metadata.UserID)
+}
+
+// CheckEndUserRateLimit 统计 API Key 下终端用户的请求并检查限流，返回终端用户哈希
+// 超出限制时返回 *EndUserLimitError
+func CheckEndUserRateLimit(apiKey, userID string, now time.Time) (string, error) {
+	return getEndUserLimiter().check(apiKey, userID, now)
+}
+
+// EndUserStats 单个终端用户的用量
+type EndUserStats struct {
+	Key      string    `json:"key"` // 已脱敏
+	User     string    `json:"user"`
+	Requests int       `json:"requests"`
+	Limited  int       `json:"limited"` // 被限流的请求数
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// EndUserLimitSettings 终端用户限流配置及用量最多的终端用户
+type EndUserLimitSettings struct {
+	RequestsPerMinute int            `json:"requestsPerMinute"`
+	KeyLimits         map[string]int `json:"keyLimits"` // 按 API Key（已脱敏）覆盖的限制
+	Users             []EndUserStats `json:"users"`
+}
+
+// GetEndUserLimitSettings 获取限流配置及请求数最多的终端用户，apiKey 不为空时只看该 Key
+func GetEndUserLimitSettings(apiKey string) EndUserLimitSettings {
+	l := getEndUserLimiter()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := EndUserLimitSettings{
+		RequestsPerMinute: l.limit,
+		KeyLimits:         make(map[string]int, len(l.keyLimits)),
+		Users:             []EndUserStats{},
+	}
+	for key, n := range l.keyLimits {
+		result.KeyLimits[MaskAPIKey(key)] = n
+	}
+	for key, users := range l.usage {
+		if apiKey != "" && key != apiKey {
+			continue
+		}
+		for hash, u := range users {
+			result.Users = append(result.Users, EndUserStats{
+				Key:      MaskAPIKey(key),
+				User:     hash,
+				Requests: u.requests,
+				Limited:  u.limited,
+				LastSeen: u.lastSeen,
+			})
+		}
+	}
+	sort.Slice(result.Users, func(i, j int) bool {
+		a, b := result.Users[i], result.Users[j]
+		if a.Requests+a.Limited != b.Requests+b.Limited {
+			return a.Requests+a.Limited > b.Requests+b.Limited
+		}
+		return a.User < b.User
+	})
+	if len(result.Users) > endUserListLimit {
+		result.Users = result.Users[:endUserListLimit]
+	}
+	return result
+}
+
+// SetEndUserRateLimit 修改终端用户每分钟请求数限制（仅内存生效），apiKey 为空时修改默认值
+// 指定 Key 且 limit 为负数时撤销该 Key 的覆盖
+func SetEndUserRateLimit(apiKey string, limit int) {
+	l := getEndUserLimiter()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case apiKey == "":
+		if limit < 0 {
+			limit = 0
+		}
+		l.limit = limit
+	case limit < 0:
+		delete(l.keyLimits, apiKey)
+	default:
+		l.keyLimits[apiKey] = limit
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEndUserLimiter(t *testing.T) {
+	l := newEndUserLimiter("salt", 2)
+	now := time.Unix(1700000080, 0) // 本分钟还剩 20 秒
+
+	h1, err := l.check("sk-a", "user-1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 == "user-1" || len(h1) != 16 {
+		t.Errorf("hash = %q, want a 16-char digest", h1)
+	}
+	if h, _ := l.check("sk-b", "user-1", now); h == h1 {
+		t.Error("the same user_id under different keys should hash differently")
+	}
+
+	l.check("sk-a", "user-1", now)
+	_, err = l.check("sk-a", "user-1", now)
+	var limitErr *EndUserLimitError
+	if !errors.As(err, &limitErr) || limitErr.RetryAfter != 20 {
+		t.Fatalf("third request: err=%v, want limit error with Retry-After 20", err)
+	}
+	if _, err := l.check("sk-a", "user-2", now); err != nil {
+		t.Errorf("other end users are not limited: %v", err)
+	}
+	if _, err := l.check("sk-a", "user-1", now.Add(time.Minute)); err != nil {
+		t.Errorf("limit should reset next minute: %v", err)
+	}
+
+	// 按 Key 覆盖，0 表示不限制
+	l.keyLimits["sk-a"] = 0
+	for i := 0; i < 5; i++ {
+		if _, err := l.check("sk-a", "user-1", now.Add(time.Minute)); err != nil {
+			t.Fatalf("override without limit: %v", err)
+		}
+	}
+
+	u := l.usage["sk-a"][h1]
+	if u.requests != 8 || u.limited != 1 {
+		t.Errorf("requests=%d limited=%d, want 8 and 1", u.requests, u.limited)
+	}
+}
+
+func TestAnthropicEndUserID(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"metadata":{"user_id":" u-42 "},"messages":[]}`: "u-42",
+		`{"metadata":{}}`:       "",
+		`{"messages":[]}`:       "",
+		`{"metadata":{"user_id`: "",
+	} {
+		if got := AnthropicEndUserID([]byte(body)); got != want {
+			t.Errorf("AnthropicEndUserID(%s) = %q, want %q", body, got, want)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上游失败分类，固定为以下六类
+const (
+	UpstreamErrorAuth       = "auth"         // 401/403，token 失效或账号被封
+	UpstreamErrorQuota      = "quota"        // 402，或积分耗尽导致的 429
+	UpstreamErrorRate       = "rate"         // 其余 429
+	UpstreamErrorValidation = "validation"   // 400/413/422 等请求被上游拒绝
+	UpstreamErrorNetwork    = "network"      // 未拿到响应
+	UpstreamError5xx        = "upstream_5xx" // 上游 5xx
+)
+
+// UpstreamErrorCategories 全部分类，按固定顺序输出指标
+var UpstreamErrorCategories = []string{
+	UpstreamErrorAuth,
+	UpstreamErrorQuota,
+	UpstreamErrorRate,
+	UpstreamErrorValidation,
+	UpstreamErrorNetwork,
+	UpstreamError5xx,
+}
+
+const (
+	validationWindowMinutes   = 5                // 检测窗口
+	validationBaselineMinutes = 60               // 窗口之前用作基线的分钟数
+	validationSpikeFactor     = 3                // 窗口内错误率超过基线多少倍视为突增
+	validationAlertCooldown   = 30 * time.Minute // 同一模型两次告警的最小间隔
+	validationMaxAlerts       = 100              // 保留的告警条数
+	recentUpstreamErrorsLimit = 100              // 保留的最近失败条数
+)
+
+// ValidationAlert 模型校验错误率突增告警，通常意味着上游 API 变更后请求转换出错
+type ValidationAlert struct {
+	Model        string    `json:"model"`
+	Requests     int       `json:"requests"` // 窗口内请求数
+	Errors       int       `json:"errors"`   // 窗口内校验错误数
+	Rate         float64   `json:"rate"`
+	BaselineRate float64   `json:"baselineRate"`
+	At           time.Time `json:"at"`
+}
+
+// ValidationAlertConfig 校验错误率告警配置
+type ValidationAlertConfig struct {
+	MinRequests int     `json:"minRequests"` // 窗口内至少这么多请求才判定
+	Rate        float64 `json:"rate"`        // 窗口内错误率下限
+}
+
+// UpstreamErrorStats 按模型和账号统计的上游失败次数及最近告警
+type UpstreamErrorStats struct {
+	Config    ValidationAlertConfig       `json:"config"`
+	Requests  map[string]int64            `json:"requests"` // 每个模型的上游请求数
+	ByModel   map[string]map[string]int64 `json:"byModel"`
+	ByAccount map[uint]map[string]int64   `json:"byAccount"`
+	Alerts    []ValidationAlert           `json:"alerts"`
+}
+
+// UpstreamErrorEvent 一次失败的上游调用，用于管理面板排查
+type UpstreamErrorEvent struct {
+	At         time.Time `json:"at"`
+	Model      string    `json:"model"`
+	AccountID  uint      `json:"accountId"`
+	Category   string    `json:"category"`
+	StatusCode int       `json:"statusCode,omitempty"` // 网络错误时为 0
+	Error      string    `json:"error,omitempty"`      // 网络错误的原因
+}
+
+// minuteBucket 一分钟内的请求数和校验错误数
+type minuteBucket struct {
+	minute     int64
+	total      int
+	validation int
+}
+
+// modelValidation 单个模型最近一段时间的分钟桶，按 minute 取模循环使用
+type modelValidation struct {
+	buckets     [validationWindowMinutes + validationBaselineMinutes]minuteBucket
+	lastAlertAt time.Time
+}
+
+type errorTaxonomy struct {
+	mu         sync.Mutex
+	config     ValidationAlertConfig
+	requests   map[string]int64
+	byModel    map[string]map[string]int64
+	byAccount  map[uint]map[string]int64
+	validation map[string]*modelValidation
+	alerts     []ValidationAlert
+	recent     []UpstreamErrorEvent // 最近的失败，最多 recentUpstreamErrorsLimit 条
+}
+
+var (
+	errorTaxonomyState *errorTaxonomy
+	errorTaxonomyOnce  sync.Once
+)
+
+func newErrorTaxonomy(config ValidationAlertConfig) *errorTaxonomy {
+	return &errorTaxonomy{
+		config:     config,
+		requests:   make(map[string]int64),
+		byModel:    make(map[string]map[string]int64),
+		byAccount:  make(map[uint]map[string]int64),
+		validation: make(map[string]*modelValidation),
+	}
+}
+
+// getErrorTaxonomy 读取 VALIDATION_ALERT_MIN_REQUESTS / VALIDATION_ALERT_RATE
+func getErrorTaxonomy() *errorTaxonomy {
+	errorTaxonomyOnce.Do(func() {
+		config := ValidationAlertConfig{
+			MinRequests: envPositiveInt("VALIDATION_ALERT_MIN_REQUESTS", 20),
+			Rate:        0.2,
+		}
+		if raw := strings.TrimSpace(os.Getenv("VALIDATION_ALERT_RATE")); raw != "" {
+			if v, err := strconv.ParseFloat(raw, 64); err == nil && v > 0 && v <= 1 {
+				config.Rate = v
+			} else {
+				log.Printf("[WARN] 无效的 VALIDATION_ALERT_RATE: %s，使用默认值 0.2", raw)
+			}
+		}
+		errorTaxonomyState = newErrorTaxonomy(config)
+	})
+	return errorTaxonomyState
+}
+
+// ClassifyUpstreamError 把一次上游调用的结果归入固定分类，成功时返回空字符串
+func ClassifyUpstreamError(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return UpstreamErrorNetwork
+	}
+	switch code := resp.StatusCode; {
+	case code < 400:
+		return ""
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return UpstreamErrorAuth
+	case code == http.StatusPaymentRequired:
+		return UpstreamErrorQuota
+	case code == http.StatusTooManyRequests:
+		// 与 MarkAccountRateLimitedWithResponse 相同的判断：周期积分已用满
+		limit := parseFloat(resp.Header.Get("Zen-Pricing-Period-Limit"))
+		used := parseFloat(resp.Header.Get("Zen-Pricing-Period-Cost"))
+		if limit > 0 && used >= limit {
+			return UpstreamErrorQuota
+		}
+		return UpstreamErrorRate
+	case code >= 500:
+		return UpstreamError5xx
+	default:
+		return UpstreamErrorValidation
+	}
+}
+
+// record 统计一次上游调用，category 为空表示成功
+func (t *errorTaxonomy) record(modelID string, accountID uint, category string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests[modelID]++
+	if category != "" {
+		if t.byModel[modelID] == nil {
+			t.byModel[modelID] = make(map[string]int64)
+		}
+		t.byModel[modelID][category]++
+		if t.byAccount[accountID] == nil {
+			t.byAccount[accountID] = make(map[string]int64)
+		}
+		t.byAccount[accountID][category]++
+	}
+
+	v := t.validation[modelID]
+	if v == nil {
+		v = &modelValidation{}
+		t.validation[modelID] = v
+	}
+	minute := now.Unix() / 60
+	b := &v.buckets[minute%int64(len(v.buckets))]
+	if b.minute != minute {
+		*b = minuteBucket{minute: minute}
+	}
+	b.total++
+	if category == UpstreamErrorValidation {
+		b.validation++
+		t.checkValidationSpike(modelID, v, minute, now)
+	}
+}
+
+// checkValidationSpike 最近几分钟的校验错误率同时超过阈值和基线的数倍时告警，调用方需持有锁
+func (t *errorTaxonomy) checkValidationSpike(modelID string, v *modelValidation, minute int64, now time.Time) {
+	if !v.lastAlertAt.IsZero() && now.Sub(v.lastAlertAt) < validationAlertCooldown {
+		return
+	}
+	var recentTotal, recentErrors, baseTotal, baseErrors int
+	for _, b := range v.buckets {
+		age := minute - b.minute
+		switch {
+		case age < 0 || age >= int64(len(v.buckets)):
+			continue
+		case age < validationWindowMinutes:
+			recentTotal += b.total
+			recentErrors += b.validation
+		default:
+			baseTotal += b.total
+			baseErrors += b.validation
+		}
+	}
+	if recentTotal < t.config.MinRequests {
+		return
+	}
+	rate := float64(recentErrors) / float64(recentTotal)
+	var baseline float64
+	if baseTotal > 0 {
+		baseline = float64(baseErrors) / float64(baseTotal)
+	}
+	if rate < t.config.Rate || rate < validationSpikeFactor*baseline {
+		return
+	}
+
+	v.lastAlertAt = now
+	a := ValidationAlert{Model: modelID, Requests: recentTotal, Errors: recentErrors, Rate: rate, BaselineRate: baseline, At: now}
+	log.Printf("[ErrorTaxonomy] 模型 %s 校验错误率突增: 最近 %d 分钟 %d/%d (%.1f%%)，基线 %.1f%%，可能是上游 API 变更导致请求转换出错",
+		modelID, validationWindowMinutes, recentErrors, recentTotal, rate*100, baseline*100)
+	t.alerts = append(t.alerts, a)
+	if len(t.alerts) > validationMaxAlerts {
+		t.alerts = t.alerts[len(t.alerts)-validationMaxAlerts:]
+	}
+}
+
+// RecordUpstreamResult 按分类统计一次上游调用的结果，并检测模型的校验错误率突增；
+// 同时写入请求日志，start 为发出请求的时间
+func RecordUpstreamResult(ctx context.Context, modelID string, accountID uint, start time.Time, resp *http.Response, err error) {
+	now := time.Now()
+	category := ClassifyUpstreamError(resp, err)
+	t := getErrorTaxonomy()
+	t.record(modelID, accountID, category, now)
+	if category != "" {
+		event := UpstreamErrorEvent{At: now, Model: modelID, AccountID: accountID, Category: category}
+		if resp != nil {
+			event.StatusCode = resp.StatusCode
+		}
+		if err != nil {
+			event.Error = truncateUTF8(err.Error(), 200)
+		}
+		t.remember(event)
+	}
+	recordRequestLog(ctx, modelID, accountID, category, start, now, resp)
+	recordDeadLetterAttempt(ctx, modelID, accountID, category, start, now, resp, err)
+}
+
+// remember 保存一次失败，超过上限时丢弃最早的
+func (t *errorTaxonomy) remember(event UpstreamErrorEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = append(t.recent, event)
+	if len(t.recent) > recentUpstreamErrorsLimit {
+		t.recent = append(t.recent[:0], t.recent[len(t.recent)-recentUpstreamErrorsLimit:]...)
+	}
+}
+
+// RecentUpstreamErrors 最近的上游失败，最新的在前
+func RecentUpstreamErrors() []UpstreamErrorEvent {
+	t := getErrorTaxonomy()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := make([]UpstreamErrorEvent, len(t.recent))
+	for i, e := range t.recent {
+		events[len(t.recent)-1-i] = e
+	}
+	return events
+}
+
+// GetUpstreamErrorStats 获取按模型和账号统计的上游失败次数及最近的告警
+func GetUpstreamErrorStats() UpstreamErrorStats {
+	t := getErrorTaxonomy()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := UpstreamErrorStats{
+		Config:    t.config,
+		Requests:  make(map[string]int64, len(t.requests)),
+		ByModel:   make(map[string]map[string]int64, len(t.byModel)),
+		ByAccount: make(map[uint]map[string]int64, len(t.byAccount)),
+		Alerts:    append([]ValidationAlert{}, t.alerts...),
+	}
+	for id, n := range t.requests {
+		stats.Requests[id] = n
+	}
+	for id, counts := range t.byModel {
+		stats.ByModel[id] = copyCounts(counts)
+	}
+	for id, counts := range t.byAccount {
+		stats.ByAccount[id] = copyCounts(counts)
+	}
+	return stats
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	c := make(map[string]int64, len(counts))
+	for k, v := range counts {
+		c[k] = v
+	}
+	return c
+}
+
+// writeUpstreamErrorMetrics 输出按模型（perAccount 时另按账号）分类的上游失败计数
+func writeUpstreamErrorMetrics(w io.Writer, stats UpstreamErrorStats, perAccount bool) {
+	models := make([]string, 0, len(stats.Requests))
+	for id := range stats.Requests {
+		models = append(models, id)
+	}
+	sort.Strings(models)
+
+	fmt.Fprintln(w, "# TYPE zencoder_upstream_requests counter")
+	fmt.Fprintln(w, "# HELP zencoder_upstream_requests Upstream calls by model, including retries.")
+	for _, id := range models {
+		fmt.Fprintf(w, "zencoder_upstream_requests_total{model=%q} %d\n", id, stats.Requests[id])
+	}
+	fmt.Fprintln(w, "# TYPE zencoder_upstream_errors counter")
+	fmt.Fprintln(w, "# HELP zencoder_upstream_errors Failed upstream calls by model and category.")
+	for _, id := range models {
+		for _, category := range UpstreamErrorCategories {
+			if n := stats.ByModel[id][category]; n > 0 {
+				fmt.Fprintf(w, "zencoder_upstream_errors_total{model=%q,category=%q} %d\n", id, category, n)
+			}
+		}
+	}
+
+	if perAccount {
+		accounts := make([]uint, 0, len(stats.ByAccount))
+		for id := range stats.ByAccount {
+			accounts = append(accounts, id)
+		}
+		sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+		fmt.Fprintln(w, "# TYPE zencoder_account_upstream_errors counter")
+		fmt.Fprintln(w, "# HELP zencoder_account_upstream_errors Failed upstream calls by account and category.")
+		for _, id := range accounts {
+			for _, category := range UpstreamErrorCategories {
+				if n := stats.ByAccount[id][category]; n > 0 {
+					fmt.Fprintf(w, "zencoder_account_upstream_errors_total{account_id=\"%d\",category=%q} %d\n", id, category, n)
+				}
+			}
+		}
+	}
+}
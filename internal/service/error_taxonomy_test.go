@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyUpstreamError(t *testing.T) {
+	quotaHeader := http.Header{}
+	quotaHeader.Set("Zen-Pricing-Period-Limit", "100")
+	quotaHeader.Set("Zen-Pricing-Period-Cost", "100")
+
+	cases := []struct {
+		resp *http.Response
+		err  error
+		want string
+	}{
+		{&http.Response{StatusCode: 200}, nil, ""},
+		{nil, errors.New("dial tcp: connection refused"), UpstreamErrorNetwork},
+		{&http.Response{StatusCode: 401}, nil, UpstreamErrorAuth},
+		{&http.Response{StatusCode: 403}, nil, UpstreamErrorAuth},
+		{&http.Response{StatusCode: 402}, nil, UpstreamErrorQuota},
+		{&http.Response{StatusCode: 429, Header: quotaHeader}, nil, UpstreamErrorQuota},
+		{&http.Response{StatusCode: 429, Header: http.Header{}}, nil, UpstreamErrorRate},
+		{&http.Response{StatusCode: 400}, nil, UpstreamErrorValidation},
+		{&http.Response{StatusCode: 413}, nil, UpstreamErrorValidation},
+		{&http.Response{StatusCode: 502}, nil, UpstreamError5xx},
+	}
+	for _, tc := range cases {
+		if got := ClassifyUpstreamError(tc.resp, tc.err); got != tc.want {
+			t.Errorf("ClassifyUpstreamError(%+v, %v) = %q, want %q", tc.resp, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestValidationSpikeAlert(t *testing.T) {
+	tax := newErrorTaxonomy(ValidationAlertConfig{MinRequests: 10, Rate: 0.2})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// 前一小时偶有校验错误，基线 5%
+	for m := 0; m < 30; m++ {
+		now := start.Add(time.Duration(m) * time.Minute)
+		for i := 0; i < 20; i++ {
+			category := ""
+			if i == 0 {
+				category = UpstreamErrorValidation
+			}
+			tax.record("gpt-5", 1, category, now)
+		}
+	}
+	if len(tax.alerts) != 0 {
+		t.Fatalf("alert under baseline error rate: %+v", tax.alerts)
+	}
+
+	// 转换出错后错误率突增到 50%
+	now := start.Add(35 * time.Minute)
+	for i := 0; i < 20; i++ {
+		tax.record("gpt-5", 2, "", now)
+		tax.record("gpt-5", 2, UpstreamErrorValidation, now)
+	}
+	if len(tax.alerts) != 1 || tax.alerts[0].Model != "gpt-5" || tax.alerts[0].BaselineRate != 0.05 {
+		t.Fatalf("alerts = %+v", tax.alerts)
+	}
+
+	// 冷却期内不重复告警
+	for i := 0; i < 20; i++ {
+		tax.record("gpt-5", 2, UpstreamErrorValidation, now.Add(time.Minute))
+	}
+	if len(tax.alerts) != 1 {
+		t.Errorf("repeated alert during cooldown: %d", len(tax.alerts))
+	}
+	if got := tax.byAccount[2][UpstreamErrorValidation]; got != 40 {
+		t.Errorf("account 2 validation errors = %d, want 40", got)
+	}
+}
+
+func TestValidationSpikeNeedsMinRequests(t *testing.T) {
+	tax := newErrorTaxonomy(ValidationAlertConfig{MinRequests: 10, Rate: 0.2})
+	now := time.Now()
+	for i := 0; i < 9; i++ {
+		tax.record("gemini-2.5-pro", 1, UpstreamErrorValidation, now)
+	}
+	if len(tax.alerts) != 0 {
+		t.Errorf("alert below min requests: %+v", tax.alerts)
+	}
+	tax.record("gemini-2.5-pro", 1, UpstreamErrorValidation, now)
+	if len(tax.alerts) != 1 {
+		t.Errorf("alerts = %d, want 1", len(tax.alerts))
+	}
+}
+
+func TestWriteUpstreamErrorMetrics(t *testing.T) {
+	stats := UpstreamErrorStats{
+		Requests:  map[string]int64{"gpt-5": 10},
+		ByModel:   map[string]map[string]int64{"gpt-5": {UpstreamErrorRate: 2, UpstreamErrorValidation: 1}},
+		ByAccount: map[uint]map[string]int64{7: {UpstreamErrorRate: 2}},
+	}
+
+	var aggregate strings.Builder
+	writeUpstreamErrorMetrics(&aggregate, stats, false)
+	out := aggregate.String()
+	for _, want := range []string{
+		`zencoder_upstream_requests_total{model="gpt-5"} 10`,
+		`zencoder_upstream_errors_total{model="gpt-5",category="rate"} 2`,
+		`zencoder_upstream_errors_total{model="gpt-5",category="validation"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "zencoder_account_upstream_errors") {
+		t.Errorf("per-account series without perAccount:\n%s", out)
+	}
+
+	var detailed strings.Builder
+	writeUpstreamErrorMetrics(&detailed, stats, true)
+	if want := `zencoder_account_upstream_errors_total{account_id="7",category="rate"} 2`; !strings.Contains(detailed.String(), want) {
+		t.Errorf("missing %q in:\n%s", want, detailed.String())
+	}
+}
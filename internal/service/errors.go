@@ -1,10 +1,39 @@
 package service
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrNoAvailableAccount = errors.New("没有可用token")
 	ErrNoPermission       = errors.New("没有账号有权限使用此模型")
 	ErrTokenExpired       = errors.New("token已过期")
 	ErrRequestFailed      = errors.New("请求失败")
+	// ErrUpstreamUnreachable 重试全部因网络原因失败，上游无法连通
+	ErrUpstreamUnreachable = errors.New("upstream_unreachable")
 )
+
+// retriesExhausted 重试用尽时按最后一次失败的原因选择返回的错误
+// 网络失败返回 ErrUpstreamUnreachable(502)，上游有响应但账号均不可用返回 ErrNoAvailableAccount(503)，
+// 最后一次因延迟预算被取消时原样返回 ErrLatencyBudgetExceeded(504)
+func retriesExhausted(lastErr error) error {
+	if lastErr == nil {
+		return ErrNoAvailableAccount
+	}
+	if errors.Is(lastErr, ErrLatencyBudgetExceeded) {
+		return lastErr
+	}
+	if isNetworkError(lastErr) {
+		return fmt.Errorf("%w: all retries failed: %w", ErrUpstreamUnreachable, lastErr)
+	}
+	return fmt.Errorf("%w: all retries failed: %w", ErrNoAvailableAccount, lastErr)
+}
+
+// exhaustRetries 重试用尽时返回 retriesExhausted 的错误，并标记本次请求需要记录 dead letter
+func exhaustRetries(ctx context.Context, lastErr error) error {
+	err := retriesExhausted(lastErr)
+	markDeadLetter(ctx, err)
+	return err
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestRetriesExhausted(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")}
+
+	tests := []struct {
+		name            string
+		lastErr         error
+		wantUnreachable bool
+	}{
+		{"nil", nil, false},
+		{"typed dial error", &url.Error{Op: "Post", URL: "https://api.example.com", Err: dialErr}, true},
+		{"dial tcp string", errors.New("dial tcp 10.0.0.1:443: i/o timeout"), true},
+		{"connection refused string", errors.New("connection refused"), true},
+		{"no such host string", errors.New("lookup api.example.com: no such host"), true},
+		{"upstream 401", fmt.Errorf("API error: %d", 401), false},
+		{"non-official 429", errors.New("non-official 429 error"), false},
+		{"rate limit tracking", errors.New("rate limit tracking problem"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := retriesExhausted(tt.lastErr)
+			if got := errors.Is(err, ErrUpstreamUnreachable); got != tt.wantUnreachable {
+				t.Errorf("unreachable = %v, want %v (err: %v)", got, tt.wantUnreachable, err)
+			}
+			if got := errors.Is(err, ErrNoAvailableAccount); got == tt.wantUnreachable {
+				t.Errorf("no-account = %v, want %v (err: %v)", got, !tt.wantUnreachable, err)
+			}
+			if tt.lastErr != nil && !errors.Is(err, tt.lastErr) {
+				t.Errorf("cause not wrapped: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FederationHopHeader 转发给对等实例的请求带该头（值为本实例标识），带该头的请求不会再次转发，避免环路
+	FederationHopHeader = "X-Zencoder-Federation-Hop"
+	// FederationPeerHeader 由对等实例处理的响应带该头，值为对等实例名称
+	FederationPeerHeader = "X-Federation-Peer"
+)
+
+// federationPeer 一个对等的 zencoder2api 实例
+type federationPeer struct {
+	name  string
+	url   string
+	key   string
+	quota int // 每分钟最多转发的请求数，0 表示不限
+
+	mu            sync.Mutex
+	minute        int64
+	used          int
+	forwarded     int64
+	saturated     int64
+	failed        int64
+	quotaExceeded int64
+}
+
+// FederationPeerStatus 对等实例的配置和转发统计
+type FederationPeerStatus struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	Quota          int    `json:"quota"`
+	UsedThisMinute int    `json:"used_this_minute"`
+	Forwarded      int64  `json:"forwarded"`      // 由对等实例处理的请求
+	Saturated      int64  `json:"saturated"`      // 对等实例同样没有可用账号（503/429）
+	Failed         int64  `json:"failed"`         // 连接失败
+	QuotaExceeded  int64  `json:"quota_exceeded"` // 超出每分钟配额而跳过
+}
+
+// federationRequest 号池饱和时转发所需的原始请求
+type federationRequest struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+const federationRequestContextKey contextKey = "federation_request"
+
+var (
+	federationPeers      []*federationPeer
+	federationInstanceID string
+	federationOnce       sync.Once
+
+	// federationClient 不设整体超时，流式响应可能持续较久，由请求 context 控制取消
+	federationClient = &http.Client{}
+)
+
+// loadFederationPeers 从 FEDERATION_PEERS 读取对等实例
+func loadFederationPeers() {
+	federationPeers = parseFederationPeers(os.Getenv("FEDERATION_PEERS"))
+	federationInstanceID = strings.TrimSpace(os.Getenv("FEDERATION_INSTANCE_ID"))
+	if federationInstanceID == "" {
+		federationInstanceID, _ = os.Hostname()
+	}
+	if len(federationPeers) > 0 {
+		log.Printf("[INFO] 已加载 %d 个联邦对等实例，本实例标识: %s", len(federationPeers), federationInstanceID)
+	}
+}
+
+// parseFederationPeers 解析对等实例
+// 格式: name=url|key|quota，逗号分隔，quota 可省略（不限），
+// 例如 hk=https://hk.example.com|sk-xxx|60
+func parseFederationPeers(raw string) []*federationPeer {
+	var peers []*federationPeer
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return peers
+	}
+
+	for _, item := range strings.Split(raw, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			log.Printf("[WARN] FEDERATION_PEERS 中的配置无效，已忽略: %s", item)
+			continue
+		}
+		values := strings.Split(value, "|")
+		peer := &federationPeer{name: name, url: strings.TrimRight(strings.TrimSpace(values[0]), "/")}
+		if len(values) > 1 {
+			peer.key = strings.TrimSpace(values[1])
+		}
+		if len(values) > 2 {
+			quota, err := strconv.Atoi(strings.TrimSpace(values[2]))
+			if err != nil || quota < 0 {
+				log.Printf("[WARN] FEDERATION_PEERS 中 %s 的配额无效，已忽略: %s", name, values[2])
+				continue
+			}
+			peer.quota = quota
+		}
+		if !strings.HasPrefix(peer.url, "http://") && !strings.HasPrefix(peer.url, "https://") {
+			log.Printf("[WARN] FEDERATION_PEERS 中 %s 的地址无效，已忽略: %s", name, peer.url)
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// FederationEnabled 是否配置了对等实例
+func FederationEnabled() bool {
+	federationOnce.Do(loadFederationPeers)
+	return len(federationPeers) > 0
+}
+
+// WithFederationRequest 保存请求内容，号池饱和时由 ForwardToPeer 转发；path 为空时使用 r.URL.Path
+func WithFederationRequest(ctx context.Context, r *http.Request, path string, body []byte) context.Context {
+	if path == "" {
+		path = r.URL.Path
+	}
+	return context.WithValue(ctx, federationRequestContextKey, &federationRequest{
+		method: r.Method,
+		path:   path,
+		query:  r.URL.RawQuery,
+		header: r.Header.Clone(),
+		body:   body,
+	})
+}
+
+// ForwardToPeer 号池饱和时按配置顺序把请求转发给对等实例，并把响应原样写给客户端
+// 对等实例同样饱和、连接失败或超出配额时尝试下一个；返回 false 表示没有实例处理，调用方照常返回错误
+func ForwardToPeer(ctx context.Context, w http.ResponseWriter) bool {
+	req, ok := ctx.Value(federationRequestContextKey).(*federationRequest)
+	if !ok || !FederationEnabled() {
+		return false
+	}
+	for _, peer := range federationPeers {
+		if !peer.take(time.Now()) {
+			continue
+		}
+		resp, err := peer.send(ctx, req)
+		if err != nil {
+			peer.count(&peer.failed)
+			log.Printf("[WARN] [Federation] 转发到 %s 失败: %v", peer.name, err)
+			continue
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			peer.count(&peer.saturated)
+			log.Printf("[Federation] 对等实例 %s 同样没有可用账号 (%d)", peer.name, resp.StatusCode)
+			continue
+		}
+
+		peer.count(&peer.forwarded)
+		log.Printf("[Federation] 号池饱和，%s %s 已转发到 %s (%d)", req.method, req.path, peer.name, resp.StatusCode)
+		relayPeerResponse(w, resp, peer.name)
+		return true
+	}
+	return false
+}
+
+// take 占用一次每分钟配额
+func (p *federationPeer) take(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if minute := now.Unix() / 60; minute != p.minute {
+		p.minute = minute
+		p.used = 0
+	}
+	if p.quota > 0 && p.used >= p.quota {
+		p.quotaExceeded++
+		return false
+	}
+	p.used++
+	return true
+}
+
+func (p *federationPeer) count(n *int64) {
+	p.mu.Lock()
+	*n++
+	p.mu.Unlock()
+}
+
+// send 用对等实例的 key 替换客户端的鉴权信息后发送请求
+func (p *federationPeer) send(ctx context.Context, req *federationRequest) (*http.Response, error) {
+	target := p.url + req.path
+	if query := stripQueryKey(req.query); query != "" {
+		target += "?" + query
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, bytes.NewReader(req.body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header = req.header.Clone()
+	for _, h := range []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "X-Admin-Password", "Content-Length", "Connection"} {
+		httpReq.Header.Del(h)
+	}
+	if p.key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.key)
+	}
+	// 值为空时对方读不到该头，环路检测会失效
+	hop := federationInstanceID
+	if hop == "" {
+		hop = "zencoder2api"
+	}
+	httpReq.Header.Set(FederationHopHeader, hop)
+	return federationClient.Do(httpReq)
+}
+
+// stripQueryKey 去掉 Gemini 格式放在查询参数中的 key
+func stripQueryKey(query string) string {
+	if query == "" {
+		return ""
+	}
+	var kept []string
+	for _, part := range strings.Split(query, "&") {
+		if part == "key" || strings.HasPrefix(part, "key=") {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
+
+// relayPeerResponse 转发对等实例的响应，流式响应逐块刷新
+func relayPeerResponse(w http.ResponseWriter, resp *http.Response, peerName string) {
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		if k == "Connection" || k == "Transfer-Encoding" {
+			continue
+		}
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	w.Header().Set(FederationPeerHeader, peerName)
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// GetFederationStatus 返回各对等实例的配置（不含 key）和转发统计
+func GetFederationStatus() []FederationPeerStatus {
+	FederationEnabled()
+	now := time.Now().Unix() / 60
+	result := make([]FederationPeerStatus, 0, len(federationPeers))
+	for _, p := range federationPeers {
+		p.mu.Lock()
+		used := p.used
+		if p.minute != now {
+			used = 0
+		}
+		result = append(result, FederationPeerStatus{
+			Name: p.name, URL: p.url, Quota: p.quota, UsedThisMinute: used,
+			Forwarded: p.forwarded, Saturated: p.saturated, Failed: p.failed, QuotaExceeded: p.quotaExceeded,
+		})
+		p.mu.Unlock()
+	}
+	return result
+}
+
+func writeFederationMetrics(w io.Writer) {
+	peers := GetFederationStatus()
+	if len(peers) == 0 {
+		return
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+
+	fmt.Fprintln(w, "# TYPE zencoder_federation_requests_total counter")
+	fmt.Fprintln(w, "# HELP zencoder_federation_requests_total Overflow requests offered to federation peers while the local pool was saturated, by outcome.")
+	for _, p := range peers {
+		fmt.Fprintf(w, "zencoder_federation_requests_total{peer=%q,result=\"forwarded\"} %d\n", p.Name, p.Forwarded)
+		fmt.Fprintf(w, "zencoder_federation_requests_total{peer=%q,result=\"saturated\"} %d\n", p.Name, p.Saturated)
+		fmt.Fprintf(w, "zencoder_federation_requests_total{peer=%q,result=\"failed\"} %d\n", p.Name, p.Failed)
+		fmt.Fprintf(w, "zencoder_federation_requests_total{peer=%q,result=\"quota_exceeded\"} %d\n", p.Name, p.QuotaExceeded)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setFederationPeers(t *testing.T, peers ...*federationPeer) {
+	t.Helper()
+	federationOnce.Do(func() {})
+	orig := federationPeers
+	federationPeers = peers
+	t.Cleanup(func() { federationPeers = orig })
+}
+
+func federationContext(t *testing.T, target, body string) context.Context {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("x-api-key", "client-key")
+	r.Header.Set("Content-Type", "application/json")
+	return WithFederationRequest(context.Background(), r, "", []byte(body))
+}
+
+func TestParseFederationPeers(t *testing.T) {
+	peers := parseFederationPeers("hk=https://hk.example.com/|sk-hk|60, us=http://us.example.com|sk-us, bad=ftp://x|k, broken")
+	if len(peers) != 2 {
+		t.Fatalf("got %d peers, want 2", len(peers))
+	}
+	if p := peers[0]; p.name != "hk" || p.url != "https://hk.example.com" || p.key != "sk-hk" || p.quota != 60 {
+		t.Errorf("hk = %+v", p)
+	}
+	if p := peers[1]; p.name != "us" || p.key != "sk-us" || p.quota != 0 {
+		t.Errorf("us = %+v", p)
+	}
+}
+
+func TestForwardToPeerSkipsSaturatedPeer(t *testing.T) {
+	saturated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer saturated.Close()
+
+	var got *http.Request
+	var gotBody string
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1"}`))
+	}))
+	defer healthy.Close()
+
+	a := &federationPeer{name: "a", url: saturated.URL, key: "sk-a"}
+	b := &federationPeer{name: "b", url: healthy.URL, key: "sk-b"}
+	setFederationPeers(t, a, b)
+
+	rec := httptest.NewRecorder()
+	if !ForwardToPeer(federationContext(t, "/v1beta/models/m:generateContent?key=client-key&alt=sse", `{"model":"m"}`), rec) {
+		t.Fatal("request not forwarded")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id":"msg_1"}` || rec.Header().Get(FederationPeerHeader) != "b" {
+		t.Errorf("response = %d %q peer=%q", rec.Code, rec.Body.String(), rec.Header().Get(FederationPeerHeader))
+	}
+	if got.URL.Path != "/v1beta/models/m:generateContent" || got.URL.RawQuery != "alt=sse" || gotBody != `{"model":"m"}` {
+		t.Errorf("forwarded %s?%s body=%q", got.URL.Path, got.URL.RawQuery, gotBody)
+	}
+	if got.Header.Get("Authorization") != "Bearer sk-b" || got.Header.Get("x-api-key") != "" {
+		t.Errorf("auth = %q / %q, want only peer key", got.Header.Get("Authorization"), got.Header.Get("x-api-key"))
+	}
+	if got.Header.Get(FederationHopHeader) == "" {
+		t.Error("hop header missing")
+	}
+
+	status := GetFederationStatus()
+	if status[0].Saturated != 1 || status[1].Forwarded != 1 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestForwardToPeerQuota(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	peer := &federationPeer{name: "a", url: srv.URL, quota: 1}
+	setFederationPeers(t, peer)
+
+	ctx := federationContext(t, "/v1/messages", `{}`)
+	if !ForwardToPeer(ctx, httptest.NewRecorder()) {
+		t.Fatal("first request not forwarded")
+	}
+	if ForwardToPeer(ctx, httptest.NewRecorder()) {
+		t.Fatal("forwarded beyond quota")
+	}
+	if s := GetFederationStatus()[0]; s.UsedThisMinute != 1 || s.QuotaExceeded != 1 {
+		t.Errorf("status = %+v", s)
+	}
+}
+
+func TestForwardToPeerWithoutRequest(t *testing.T) {
+	setFederationPeers(t, &federationPeer{name: "a", url: "http://127.0.0.1:1"})
+	if ForwardToPeer(context.Background(), httptest.NewRecorder()) {
+		t.Error("forwarded without a saved request")
+	}
+}
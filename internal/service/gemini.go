@@ -5,19 +5,27 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"zencoder2api/internal/model"
 	"zencoder2api/internal/service/provider"
 )
 
-const GeminiBaseURL = "https://api.zencoder.ai/gemini"
+var GeminiBaseURL = DefaultUpstreamBase + "/gemini"
 
-type GeminiService struct{}
+type GeminiService struct {
+	deps Dependencies
+}
 
 func NewGeminiService() *GeminiService {
-	return &GeminiService{}
+	return NewGeminiServiceWithDeps(DefaultDependencies())
+}
+
+// NewGeminiServiceWithDeps 使用指定依赖创建服务，便于替换号池和上游
+func NewGeminiServiceWithDeps(deps Dependencies) *GeminiService {
+	return &GeminiService{deps: deps.withDefaults()}
 }
 
 // GenerateContent 处理generateContent请求
@@ -31,20 +39,32 @@ func (s *GeminiService) GenerateContent(ctx context.Context, modelName string, b
 
 	DebugLogRequest(ctx, "Gemini", "generateContent", modelName)
 
+	policy := GetRetryPolicy("gemini")
+	budget := newLatencyBudget(ctx)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
-		account, err := GetNextAccountForModel(modelName)
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.deps.Accounts.GetNextAccountForModel(modelName)
 		if err != nil {
 			DebugLogRequestEnd(ctx, "Gemini", false, err)
 			return nil, err
 		}
 		DebugLogAccountSelected(ctx, "Gemini", account.ID, account.Email)
 
-		resp, err := s.doRequest(ctx, account, modelName, body, false)
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doRequest(attemptCtx, account, modelName, body, false))
+		RecordUpstreamResult(ctx, modelName, account.ID, start, resp, err)
 		if err != nil {
-			ReleaseAccount(account) // 释放账号
-			MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
 			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "Gemini", false, err)
+				return nil, err
+			}
 			DebugLogRetry(ctx, "Gemini", i+1, account.ID, err)
 			continue
 		}
@@ -56,10 +76,10 @@ func (s *GeminiService) GenerateContent(ctx context.Context, modelName string, b
 		if resp.Header.Get("Zen-Pricing-Period-Limit") != "" ||
 		   resp.Header.Get("Zen-Pricing-Period-Cost") != "" ||
 		   resp.Header.Get("Zen-Request-Cost") != "" {
-			log.Printf("[Gemini] 积分信息 - 周期限额: %s, 周期消耗: %s, 本次消耗: %s",
-				resp.Header.Get("Zen-Pricing-Period-Limit"),
-				resp.Header.Get("Zen-Pricing-Period-Cost"),
-				resp.Header.Get("Zen-Request-Cost"))
+			LogEvent(ctx, slog.LevelInfo, "Gemini", "积分信息", logAccountID(account.ID),
+				slog.String("period_limit", resp.Header.Get("Zen-Pricing-Period-Limit")),
+				slog.String("period_cost", resp.Header.Get("Zen-Pricing-Period-Cost")),
+				slog.String("request_cost", resp.Header.Get("Zen-Request-Cost")))
 		}
 
 		if resp.StatusCode >= 400 {
@@ -70,44 +90,44 @@ func (s *GeminiService) GenerateContent(ctx context.Context, modelName string, b
 
 			// 400和500错误直接返回，不进行账号错误计数
 			if resp.StatusCode == 400 || resp.StatusCode == 500 {
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				DebugLogRequestEnd(ctx, "Gemini", false, fmt.Errorf("API error: %d", resp.StatusCode))
 				return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(errBody))
 			}
 
 			// 429 错误特殊处理
 			if resp.StatusCode == 429 {
-				log.Printf("[Gemini] 429限流错误，尝试使用代理重试")
+				LogEvent(ctx, slog.LevelWarn, "Gemini", "429限流错误，尝试使用代理重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode))
 
 				// 尝试使用代理池重试
 				proxyResp, proxyErr := s.retryWithProxy(ctx, account, modelName, body, false)
 				if proxyErr == nil && proxyResp != nil {
 					// 代理重试成功
-					ReleaseAccount(account) // 释放账号
+					s.deps.Accounts.ReleaseAccount(account) // 释放账号
 					return proxyResp, nil
 				}
 
-				log.Printf("[Gemini] 代理重试失败: %v", proxyErr)
-				MarkAccountRateLimitedWithResponse(account, resp)
+				LogEvent(ctx, slog.LevelWarn, "Gemini", "代理重试失败", logAccountID(account.ID), logError(proxyErr))
+				s.deps.Accounts.MarkAccountRateLimitedWithResponse(account, resp, policy.Cooling())
 			} else {
-				MarkAccountError(account)
+				s.deps.Accounts.MarkAccountError(account)
 			}
 
-			ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
 			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
 			DebugLogRetry(ctx, "Gemini", i+1, account.ID, lastErr)
 			continue
 		}
 
-		ResetAccountError(account)
-		ReleaseAccount(account) // 释放账号
+		s.deps.Accounts.ResetAccountError(account)
+		s.deps.Accounts.ReleaseAccount(account) // 释放账号
 		zenModel, exists := model.GetZenModel(modelName)
 		if !exists {
 			// 模型不存在，使用默认倍率
-			UpdateAccountCreditsFromResponse(account, resp, 1.0)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, 1.0)
 		} else {
 			// 使用统一的积分更新函数，自动处理响应头中的积分信息
-			UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
 		}
 		
 		DebugLogRequestEnd(ctx, "Gemini", true, nil)
@@ -115,7 +135,7 @@ func (s *GeminiService) GenerateContent(ctx context.Context, modelName string, b
 	}
 
 	DebugLogRequestEnd(ctx, "Gemini", false, lastErr)
-	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
 }
 
 // StreamGenerateContent 处理streamGenerateContent请求
@@ -129,20 +149,32 @@ func (s *GeminiService) StreamGenerateContent(ctx context.Context, modelName str
 
 	DebugLogRequest(ctx, "Gemini", "streamGenerateContent", modelName)
 
+	policy := GetRetryPolicy("gemini")
+	budget := newLatencyBudget(ctx)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
-		account, err := GetNextAccountForModel(modelName)
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.deps.Accounts.GetNextAccountForModel(modelName)
 		if err != nil {
 			DebugLogRequestEnd(ctx, "Gemini", false, err)
 			return nil, err
 		}
 		DebugLogAccountSelected(ctx, "Gemini", account.ID, account.Email)
 
-		resp, err := s.doRequest(ctx, account, modelName, body, true)
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doRequest(attemptCtx, account, modelName, body, true))
+		RecordUpstreamResult(ctx, modelName, account.ID, start, resp, err)
 		if err != nil {
-			ReleaseAccount(account) // 释放账号
-			MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
 			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "Gemini", false, err)
+				return nil, err
+			}
 			DebugLogRetry(ctx, "Gemini", i+1, account.ID, err)
 			continue
 		}
@@ -154,10 +186,10 @@ func (s *GeminiService) StreamGenerateContent(ctx context.Context, modelName str
 		if resp.Header.Get("Zen-Pricing-Period-Limit") != "" ||
 		   resp.Header.Get("Zen-Pricing-Period-Cost") != "" ||
 		   resp.Header.Get("Zen-Request-Cost") != "" {
-			log.Printf("[Gemini] 积分信息 - 周期限额: %s, 周期消耗: %s, 本次消耗: %s",
-				resp.Header.Get("Zen-Pricing-Period-Limit"),
-				resp.Header.Get("Zen-Pricing-Period-Cost"),
-				resp.Header.Get("Zen-Request-Cost"))
+			LogEvent(ctx, slog.LevelInfo, "Gemini", "积分信息", logAccountID(account.ID),
+				slog.String("period_limit", resp.Header.Get("Zen-Pricing-Period-Limit")),
+				slog.String("period_cost", resp.Header.Get("Zen-Pricing-Period-Cost")),
+				slog.String("request_cost", resp.Header.Get("Zen-Request-Cost")))
 		}
 
 		if resp.StatusCode >= 400 {
@@ -168,44 +200,44 @@ func (s *GeminiService) StreamGenerateContent(ctx context.Context, modelName str
 
 			// 400和500错误直接返回，不进行账号错误计数
 			if resp.StatusCode == 400 || resp.StatusCode == 500 {
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				DebugLogRequestEnd(ctx, "Gemini", false, fmt.Errorf("API error: %d", resp.StatusCode))
 				return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(errBody))
 			}
 
 			// 429 错误特殊处理
 			if resp.StatusCode == 429 {
-				log.Printf("[Gemini] 429限流错误，尝试使用代理重试")
+				LogEvent(ctx, slog.LevelWarn, "Gemini", "429限流错误，尝试使用代理重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode))
 
 				// 尝试使用代理池重试
 				proxyResp, proxyErr := s.retryWithProxy(ctx, account, modelName, body, true)
 				if proxyErr == nil && proxyResp != nil {
 					// 代理重试成功
-					ReleaseAccount(account) // 释放账号
+					s.deps.Accounts.ReleaseAccount(account) // 释放账号
 					return proxyResp, nil
 				}
 
-				log.Printf("[Gemini] 代理重试失败: %v", proxyErr)
-				MarkAccountRateLimitedWithResponse(account, resp)
+				LogEvent(ctx, slog.LevelWarn, "Gemini", "代理重试失败", logAccountID(account.ID), logError(proxyErr))
+				s.deps.Accounts.MarkAccountRateLimitedWithResponse(account, resp, policy.Cooling())
 			} else {
-				MarkAccountError(account)
+				s.deps.Accounts.MarkAccountError(account)
 			}
 
-			ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
 			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
 			DebugLogRetry(ctx, "Gemini", i+1, account.ID, lastErr)
 			continue
 		}
 
-		ResetAccountError(account)
-		ReleaseAccount(account) // 释放账号
+		s.deps.Accounts.ResetAccountError(account)
+		s.deps.Accounts.ReleaseAccount(account) // 释放账号
 		zenModel, exists := model.GetZenModel(modelName)
 		if !exists {
 			// 模型不存在，使用默认倍率
-			UseCredit(account, 1.0)
+			s.deps.Credits.UseCredit(account, 1.0)
 		} else {
 			// 流式响应，暂时使用模型倍率（因为没有完整响应头）
-			UseCredit(account, zenModel.Multiplier)
+			s.deps.Credits.UseCredit(account, zenModel.Multiplier)
 		}
 		
 		DebugLogRequestEnd(ctx, "Gemini", true, nil)
@@ -213,7 +245,7 @@ func (s *GeminiService) StreamGenerateContent(ctx context.Context, modelName str
 	}
 
 	DebugLogRequestEnd(ctx, "Gemini", false, lastErr)
-	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
 }
 
 func (s *GeminiService) doRequest(ctx context.Context, account *model.Account, modelName string, body []byte, stream bool) (*http.Response, error) {
@@ -221,7 +253,7 @@ func (s *GeminiService) doRequest(ctx context.Context, account *model.Account, m
 	if !exists {
 		return nil, ErrNoAvailableAccount
 	}
-	httpClient := provider.NewHTTPClient(account.Proxy, 0)
+	httpClient := s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel)
 
 	action := "generateContent"
 	queryParam := ""
@@ -231,7 +263,7 @@ func (s *GeminiService) doRequest(ctx context.Context, account *model.Account, m
 	}
 	reqURL := fmt.Sprintf("%s/v1beta/models/%s:%s%s", GeminiBaseURL, modelName, action, queryParam)
 	DebugLogRequestSent(ctx, "Gemini", reqURL)
-	httpReq, err := http.NewRequest("POST", reqURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(upstreamContext(ctx), "POST", reqURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -265,7 +297,7 @@ func (s *GeminiService) GenerateContentProxy(ctx context.Context, w http.Respons
 	}
 	defer resp.Body.Close()
 
-	return StreamResponse(w, resp)
+	return StreamResponse(ctx, w, resp)
 }
 
 // retryWithProxy 使用代理池重试Gemini请求
@@ -277,24 +309,25 @@ func (s *GeminiService) retryWithProxy(ctx context.Context, account *model.Accou
 	}
 
 	proxyPool := provider.GetProxyPool()
-	if !proxyPool.HasProxies() {
-		return nil, fmt.Errorf("没有可用的代理")
+	region := accountProxyRegion(proxyPool, account)
+	if !proxyPool.HasProxiesInRegion(region) {
+		return nil, regionProxyError(region)
 	}
 
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		// 获取随机代理
-		proxyURL := proxyPool.GetRandomProxy()
-		if proxyURL == "" {
+		// 获取随机代理，账号固定了地区时只在该地区内选择
+		proxyURL := proxyPool.GetRandomProxyInRegion(region)
+		if proxyURL == "" || !proxyHealthy(proxyURL) {
 			continue
 		}
 
-		log.Printf("[Gemini] 尝试代理 %s (重试 %d/%d)", proxyURL, i+1, maxRetries)
+		LogEvent(ctx, slog.LevelInfo, "Gemini", "尝试代理", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("attempt", i+1), slog.Int("max_attempts", maxRetries))
 
 		// 创建使用代理的HTTP客户端
-		proxyClient, err := provider.NewHTTPClientWithProxy(proxyURL, 0)
+		proxyClient, err := s.deps.Upstream.ProxyClient(proxyURL, zenModel)
 		if err != nil {
-			log.Printf("[Gemini] 创建代理客户端失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Gemini", "创建代理客户端失败", slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
@@ -308,7 +341,7 @@ func (s *GeminiService) retryWithProxy(ctx context.Context, account *model.Accou
 		reqURL := fmt.Sprintf("%s/v1beta/models/%s:%s%s", GeminiBaseURL, modelName, action, queryParam)
 		httpReq, err := http.NewRequest("POST", reqURL, bytes.NewReader(body))
 		if err != nil {
-			log.Printf("[Gemini] 创建请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Gemini", "创建请求失败", logError(err))
 			continue
 		}
 
@@ -330,7 +363,7 @@ func (s *GeminiService) retryWithProxy(ctx context.Context, account *model.Accou
 		// 执行请求
 		resp, err := proxyClient.Do(httpReq)
 		if err != nil {
-			log.Printf("[Gemini] 代理请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Gemini", "代理请求失败", logAccountID(account.ID), slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
@@ -338,7 +371,7 @@ func (s *GeminiService) retryWithProxy(ctx context.Context, account *model.Accou
 		if resp.StatusCode == 429 {
 			// 仍然是429，尝试下一个代理
 			resp.Body.Close()
-			log.Printf("[Gemini] 代理 %s 仍返回429，尝试下一个", proxyURL)
+			LogEvent(ctx, slog.LevelWarn, "Gemini", "代理仍返回429，尝试下一个", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode))
 			continue
 		}
 
@@ -346,12 +379,12 @@ func (s *GeminiService) retryWithProxy(ctx context.Context, account *model.Accou
 			// 其他错误，记录并尝试下一个代理
 			errBody, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			log.Printf("[Gemini] 代理 %s 返回错误 %d: %s", proxyURL, resp.StatusCode, string(errBody))
+			LogEvent(ctx, slog.LevelWarn, "Gemini", "代理返回错误", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode), slog.String("body", string(errBody)))
 			continue
 		}
 
 		// 成功
-		log.Printf("[Gemini] 代理 %s 请求成功", proxyURL)
+		LogEvent(ctx, slog.LevelInfo, "Gemini", "代理请求成功", logAccountID(account.ID), slog.String("proxy", proxyURL))
 		return resp, nil
 	}
 
@@ -366,5 +399,5 @@ func (s *GeminiService) StreamGenerateContentProxy(ctx context.Context, w http.R
 	}
 	defer resp.Body.Close()
 
-	return StreamResponse(w, resp)
+	return StreamResponse(ctx, w, resp)
 }
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"zencoder2api/internal/model"
+)
+
+// GeminiModelInfo Gemini ListModels 中的单个模型
+type GeminiModelInfo struct {
+	Name                       string   `json:"name"`
+	BaseModelID                string   `json:"baseModelId"`
+	Version                    string   `json:"version"`
+	DisplayName                string   `json:"displayName"`
+	Description                string   `json:"description,omitempty"`
+	SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+}
+
+// GeminiModelList Gemini ListModels 响应
+type GeminiModelList struct {
+	Models        []GeminiModelInfo `json:"models"`
+	NextPageToken string            `json:"nextPageToken,omitempty"`
+}
+
+// 分页参数默认值与上限，与 Gemini 官方一致
+const (
+	GeminiModelsDefaultPageSize = 50
+	GeminiModelsMaxPageSize     = 1000
+)
+
+// geminiGenerationMethods 网关支持的 Gemini 方法
+var geminiGenerationMethods = []string{"generateContent", "streamGenerateContent", "countTokens"}
+
+// geminiImageTokens Gemini 对每张图片按固定 token 数计费
+const geminiImageTokens = 258
+
+func geminiModelInfo(id string, zenModel model.ZenModel) GeminiModelInfo {
+	return GeminiModelInfo{
+		Name:                       "models/" + id,
+		BaseModelID:                id,
+		Version:                    "001",
+		DisplayName:                zenModel.DisplayName,
+		SupportedGenerationMethods: geminiGenerationMethods,
+	}
+}
+
+// ListGeminiModels 以 Gemini 格式列出 gemini 服务商的可见模型
+// pageToken 为上一页最后一个模型的 name，不存在时返回空列表
+func ListGeminiModels(pageSize int, pageToken string) GeminiModelList {
+	if pageSize <= 0 {
+		pageSize = GeminiModelsDefaultPageSize
+	}
+	if pageSize > GeminiModelsMaxPageSize {
+		pageSize = GeminiModelsMaxPageSize
+	}
+
+	var all []GeminiModelInfo
+	for _, id := range model.ListZenModelIDs() {
+		zenModel, ok := model.GetZenModel(id)
+		if !ok || zenModel.ProviderID != "gemini" || zenModel.IsHidden {
+			continue
+		}
+		all = append(all, geminiModelInfo(id, zenModel))
+	}
+
+	start := 0
+	if pageToken != "" {
+		start = len(all)
+		for i, m := range all {
+			if m.Name == pageToken {
+				start = i + 1
+				break
+			}
+		}
+	}
+	page := all[start:]
+	result := GeminiModelList{Models: []GeminiModelInfo{}}
+	if len(page) > pageSize {
+		page = page[:pageSize]
+		result.NextPageToken = page[len(page)-1].Name
+	}
+	result.Models = append(result.Models, page...)
+	return result
+}
+
+// GetGeminiModel 返回单个 gemini 模型，name 可带 models/ 前缀
+func GetGeminiModel(name string) (GeminiModelInfo, bool) {
+	id := strings.TrimPrefix(name, "models/")
+	zenModel, ok := model.GetZenModel(id)
+	if !ok || zenModel.ProviderID != "gemini" {
+		return GeminiModelInfo{}, false
+	}
+	return geminiModelInfo(id, zenModel), true
+}
+
+// EstimateGeminiTokens 在本地估算 countTokens 请求的 token 数，不占用上游账号
+// 文本按 4 字节一个 token 估算，图片等内联数据按每个 258 token 计
+// 请求体可以直接包含 contents，也可以是 generateContentRequest
+func EstimateGeminiTokens(body []byte) (int, error) {
+	var req struct {
+		Contents               json.RawMessage `json:"contents"`
+		GenerateContentRequest *struct {
+			Contents          json.RawMessage `json:"contents"`
+			SystemInstruction json.RawMessage `json:"systemInstruction"`
+			Tools             json.RawMessage `json:"tools"`
+		} `json:"generateContentRequest"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, &InvalidRequestError{Message: "Invalid JSON payload received."}
+	}
+
+	var textBytes, media int
+	count := func(raw json.RawMessage) {
+		if len(raw) == 0 {
+			return
+		}
+		var v interface{}
+		if json.Unmarshal(raw, &v) == nil {
+			t, m := countGeminiParts(v)
+			textBytes += t
+			media += m
+		}
+	}
+	count(req.Contents)
+	if r := req.GenerateContentRequest; r != nil {
+		count(r.Contents)
+		count(r.SystemInstruction)
+		// 工具定义按 JSON 原文估算
+		textBytes += len(r.Tools)
+	}
+	return (textBytes+3)/4 + media*geminiImageTokens, nil
+}
+
+// countGeminiParts 递归统计 text 字段的字节数和 inlineData / fileData 的个数
+func countGeminiParts(v interface{}) (textBytes, media int) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			switch key {
+			case "text":
+				if s, ok := child.(string); ok {
+					textBytes += len(s)
+				}
+			case "inlineData", "fileData":
+				media++
+			default:
+				t, m := countGeminiParts(child)
+				textBytes += t
+				media += m
+			}
+		}
+	case []interface{}:
+		for _, child := range val {
+			t, m := countGeminiParts(child)
+			textBytes += t
+			media += m
+		}
+	}
+	return textBytes, media
+}
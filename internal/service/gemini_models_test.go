@@ -0,0 +1,47 @@
+package service
+
+import "testing"
+
+func TestListGeminiModelsPaginates(t *testing.T) {
+	all := ListGeminiModels(0, "")
+	if len(all.Models) == 0 || all.NextPageToken != "" {
+		t.Fatalf("models = %+v", all)
+	}
+	for _, m := range all.Models {
+		info, ok := GetGeminiModel(m.Name)
+		if !ok || info.Name != m.Name || len(m.SupportedGenerationMethods) == 0 {
+			t.Errorf("GetGeminiModel(%q) = %+v, %v", m.Name, info, ok)
+		}
+	}
+	if len(all.Models) < 2 {
+		return
+	}
+
+	first := ListGeminiModels(1, "")
+	if len(first.Models) != 1 || first.NextPageToken != first.Models[0].Name {
+		t.Fatalf("first page = %+v", first)
+	}
+	next := ListGeminiModels(1, first.NextPageToken)
+	if len(next.Models) != 1 || next.Models[0].Name != all.Models[1].Name {
+		t.Errorf("second page = %+v", next)
+	}
+	if _, ok := GetGeminiModel("claude-sonnet-4-5-20250929"); ok {
+		t.Error("non-gemini model returned")
+	}
+}
+
+func TestEstimateGeminiTokens(t *testing.T) {
+	body := `{"contents":[{"role":"user","parts":[{"text":"12345678"},{"inlineData":{"mimeType":"image/png","data":"AAAA"}}]}]}`
+	tokens, err := EstimateGeminiTokens([]byte(body))
+	if err != nil || tokens != 2+geminiImageTokens {
+		t.Errorf("tokens = %d, err = %v", tokens, err)
+	}
+
+	wrapped := `{"generateContentRequest":{"contents":[{"parts":[{"text":"1234"}]}],"systemInstruction":{"parts":[{"text":"1234"}]}}}`
+	if tokens, err := EstimateGeminiTokens([]byte(wrapped)); err != nil || tokens != 2 {
+		t.Errorf("wrapped tokens = %d, err = %v", tokens, err)
+	}
+	if _, err := EstimateGeminiTokens([]byte("{")); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+}
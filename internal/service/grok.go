@@ -6,20 +6,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"zencoder2api/internal/model"
 	"zencoder2api/internal/service/provider"
 )
 
-const GrokBaseURL = "https://api.zencoder.ai/xai"
+var GrokBaseURL = DefaultUpstreamBase + "/xai"
 
-type GrokService struct{}
+type GrokService struct {
+	deps Dependencies
+}
 
 func NewGrokService() *GrokService {
-	return &GrokService{}
+	return NewGrokServiceWithDeps(DefaultDependencies())
+}
+
+// NewGrokServiceWithDeps 使用指定依赖创建服务，便于替换号池和上游
+func NewGrokServiceWithDeps(deps Dependencies) *GrokService {
+	return &GrokService{deps: deps.withDefaults()}
 }
 
 // ChatCompletions 处理/v1/chat/completions请求
@@ -40,20 +48,32 @@ func (s *GrokService) ChatCompletions(ctx context.Context, body []byte) (*http.R
 
 	DebugLogRequest(ctx, "Grok", "/v1/chat/completions", req.Model)
 
+	policy := GetRetryPolicy("xai")
+	budget := newLatencyBudget(ctx)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
-		account, err := GetNextAccountForModel(req.Model)
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.deps.Accounts.GetNextAccountForModel(req.Model)
 		if err != nil {
 			DebugLogRequestEnd(ctx, "Grok", false, err)
 			return nil, err
 		}
 		DebugLogAccountSelected(ctx, "Grok", account.ID, account.Email)
 
-		resp, err := s.doRequest(ctx, account, req.Model, body)
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doRequest(attemptCtx, account, req.Model, body))
+		RecordUpstreamResult(ctx, req.Model, account.ID, start, resp, err)
 		if err != nil {
-			ReleaseAccount(account) // 释放账号
-			MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
 			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "Grok", false, err)
+				return nil, err
+			}
 			DebugLogRetry(ctx, "Grok", i+1, account.ID, err)
 			continue
 		}
@@ -65,10 +85,10 @@ func (s *GrokService) ChatCompletions(ctx context.Context, body []byte) (*http.R
 		if resp.Header.Get("Zen-Pricing-Period-Limit") != "" ||
 		   resp.Header.Get("Zen-Pricing-Period-Cost") != "" ||
 		   resp.Header.Get("Zen-Request-Cost") != "" {
-			log.Printf("[Grok] 积分信息 - 周期限额: %s, 周期消耗: %s, 本次消耗: %s",
-				resp.Header.Get("Zen-Pricing-Period-Limit"),
-				resp.Header.Get("Zen-Pricing-Period-Cost"),
-				resp.Header.Get("Zen-Request-Cost"))
+			LogEvent(ctx, slog.LevelInfo, "Grok", "积分信息", logAccountID(account.ID),
+				slog.String("period_limit", resp.Header.Get("Zen-Pricing-Period-Limit")),
+				slog.String("period_cost", resp.Header.Get("Zen-Pricing-Period-Cost")),
+				slog.String("request_cost", resp.Header.Get("Zen-Request-Cost")))
 		}
 
 		if resp.StatusCode >= 400 {
@@ -78,22 +98,22 @@ func (s *GrokService) ChatCompletions(ctx context.Context, body []byte) (*http.R
 
 			// 429 错误特殊处理 - 直接返回，不重试
 			if resp.StatusCode == 429 {
-				log.Printf("[Grok] 429限流错误，尝试使用代理重试")
+				LogEvent(ctx, slog.LevelWarn, "Grok", "429限流错误，尝试使用代理重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode))
 
 				// 尝试使用代理池重试
 				proxyResp, proxyErr := s.retryWithProxy(ctx, account, req.Model, body)
 				if proxyErr == nil && proxyResp != nil {
 					// 代理重试成功
-					ReleaseAccount(account) // 释放账号
+					s.deps.Accounts.ReleaseAccount(account) // 释放账号
 					return proxyResp, nil
 				}
 
-				log.Printf("[Grok] 代理重试失败: %v", proxyErr)
+				LogEvent(ctx, slog.LevelWarn, "Grok", "代理重试失败", logAccountID(account.ID), logError(proxyErr))
 				// 在DEBUG模式下记录详细信息
 				DebugLogErrorResponse(ctx, "Grok", resp.StatusCode, string(errBody))
 				// 将账号放入短期冷却（5秒）
-				MarkAccountRateLimitedShort(account)
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.MarkAccountRateLimitedShort(account, policy.ShortCooling())
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				// 标记错误并结束请求
 				DebugLogRequestEnd(ctx, "Grok", false, ErrNoAvailableAccount)
 				// 返回通用错误
@@ -104,27 +124,27 @@ func (s *GrokService) ChatCompletions(ctx context.Context, body []byte) (*http.R
 
 			// 400和500错误直接返回，不进行账号错误计数
 			if resp.StatusCode == 400 || resp.StatusCode == 500 {
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				DebugLogRequestEnd(ctx, "Grok", false, fmt.Errorf("API error: %d", resp.StatusCode))
 				return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(errBody))
 			}
 
-			MarkAccountError(account)
-			ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
 			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
 			DebugLogRetry(ctx, "Grok", i+1, account.ID, lastErr)
 			continue
 		}
 
-		ResetAccountError(account)
-		ReleaseAccount(account) // 释放账号
+		s.deps.Accounts.ResetAccountError(account)
+		s.deps.Accounts.ReleaseAccount(account) // 释放账号
 		zenModel, exists := model.GetZenModel(req.Model)
 		if !exists {
 			// 模型不存在，使用默认倍率
-			UpdateAccountCreditsFromResponse(account, resp, 1.0)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, 1.0)
 		} else {
 			// 使用统一的积分更新函数，自动处理响应头中的积分信息
-			UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
 		}
 		
 		DebugLogRequestEnd(ctx, "Grok", true, nil)
@@ -132,7 +152,7 @@ func (s *GrokService) ChatCompletions(ctx context.Context, body []byte) (*http.R
 	}
 
 	DebugLogRequestEnd(ctx, "Grok", false, lastErr)
-	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
 }
 
 func (s *GrokService) doRequest(ctx context.Context, account *model.Account, modelID string, body []byte) (*http.Response, error) {
@@ -140,7 +160,7 @@ func (s *GrokService) doRequest(ctx context.Context, account *model.Account, mod
 	if !exists {
 		return nil, ErrNoAvailableAccount
 	}
-	httpClient := provider.NewHTTPClient(account.Proxy, 0)
+	httpClient := s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel)
 
 	// 处理请求体，Grok Code 模型要求 temperature=0
 	modifiedBody := body
@@ -151,7 +171,7 @@ func (s *GrokService) doRequest(ctx context.Context, account *model.Account, mod
 	reqURL := GrokBaseURL + "/v1/chat/completions"
 	DebugLogRequestSent(ctx, "Grok", reqURL)
 
-	httpReq, err := http.NewRequest("POST", reqURL, bytes.NewReader(modifiedBody))
+	httpReq, err := http.NewRequestWithContext(upstreamContext(ctx), "POST", reqURL, bytes.NewReader(modifiedBody))
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +210,7 @@ func (s *GrokService) ChatCompletionsProxy(ctx context.Context, w http.ResponseW
 	}
 	defer resp.Body.Close()
 
-	return StreamResponse(w, resp)
+	return StreamResponse(ctx, w, resp)
 }
 
 // retryWithProxy 使用代理池重试Grok请求
@@ -202,24 +222,25 @@ func (s *GrokService) retryWithProxy(ctx context.Context, account *model.Account
 	}
 
 	proxyPool := provider.GetProxyPool()
-	if !proxyPool.HasProxies() {
-		return nil, fmt.Errorf("没有可用的代理")
+	region := accountProxyRegion(proxyPool, account)
+	if !proxyPool.HasProxiesInRegion(region) {
+		return nil, regionProxyError(region)
 	}
 
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		// 获取随机代理
-		proxyURL := proxyPool.GetRandomProxy()
-		if proxyURL == "" {
+		// 获取随机代理，账号固定了地区时只在该地区内选择
+		proxyURL := proxyPool.GetRandomProxyInRegion(region)
+		if proxyURL == "" || !proxyHealthy(proxyURL) {
 			continue
 		}
 
-		log.Printf("[Grok] 尝试代理 %s (重试 %d/%d)", proxyURL, i+1, maxRetries)
+		LogEvent(ctx, slog.LevelInfo, "Grok", "尝试代理", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("attempt", i+1), slog.Int("max_attempts", maxRetries))
 
 		// 创建使用代理的HTTP客户端
-		proxyClient, err := provider.NewHTTPClientWithProxy(proxyURL, 0)
+		proxyClient, err := s.deps.Upstream.ProxyClient(proxyURL, zenModel)
 		if err != nil {
-			log.Printf("[Grok] 创建代理客户端失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Grok", "创建代理客户端失败", slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
@@ -233,7 +254,7 @@ func (s *GrokService) retryWithProxy(ctx context.Context, account *model.Account
 		reqURL := GrokBaseURL + "/v1/chat/completions"
 		httpReq, err := http.NewRequest("POST", reqURL, bytes.NewReader(modifiedBody))
 		if err != nil {
-			log.Printf("[Grok] 创建请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Grok", "创建请求失败", logError(err))
 			continue
 		}
 
@@ -250,7 +271,7 @@ func (s *GrokService) retryWithProxy(ctx context.Context, account *model.Account
 		// 执行请求
 		resp, err := proxyClient.Do(httpReq)
 		if err != nil {
-			log.Printf("[Grok] 代理请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "Grok", "代理请求失败", logAccountID(account.ID), slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
@@ -258,7 +279,7 @@ func (s *GrokService) retryWithProxy(ctx context.Context, account *model.Account
 		if resp.StatusCode == 429 {
 			// 仍然是429，尝试下一个代理
 			resp.Body.Close()
-			log.Printf("[Grok] 代理 %s 仍返回429，尝试下一个", proxyURL)
+			LogEvent(ctx, slog.LevelWarn, "Grok", "代理仍返回429，尝试下一个", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode))
 			continue
 		}
 
@@ -266,12 +287,12 @@ func (s *GrokService) retryWithProxy(ctx context.Context, account *model.Account
 			// 其他错误，记录并尝试下一个代理
 			errBody, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			log.Printf("[Grok] 代理 %s 返回错误 %d: %s", proxyURL, resp.StatusCode, string(errBody))
+			LogEvent(ctx, slog.LevelWarn, "Grok", "代理返回错误", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode), slog.String("body", string(errBody)))
 			continue
 		}
 
 		// 成功
-		log.Printf("[Grok] 代理 %s 请求成功", proxyURL)
+		LogEvent(ctx, slog.LevelInfo, "Grok", "代理请求成功", logAccountID(account.ID), slog.String("proxy", proxyURL))
 		return resp, nil
 	}
 
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencySettings 幂等请求的保存时间和响应大小上限
+type IdempotencySettings struct {
+	TTLSeconds int `json:"ttl_seconds"` // 响应保存时间
+	MaxBytes   int `json:"max_bytes"`   // 超过该大小的响应不保存
+}
+
+// idempotencySweepInterval 清理过期记录的最小间隔
+const idempotencySweepInterval = time.Hour
+
+var (
+	idempotencySettings     IdempotencySettings
+	idempotencySettingsOnce sync.Once
+
+	idempotencyMu       sync.Mutex
+	idempotencyInflight = make(map[string]bool)
+	idempotencySweptAt  time.Time
+)
+
+// GetIdempotencySettings 读取 IDEMPOTENCY_TTL / IDEMPOTENCY_MAX_BYTES
+func GetIdempotencySettings() IdempotencySettings {
+	idempotencySettingsOnce.Do(func() {
+		idempotencySettings = IdempotencySettings{
+			TTLSeconds: envPositiveInt("IDEMPOTENCY_TTL", 86400),
+			MaxBytes:   envPositiveInt("IDEMPOTENCY_MAX_BYTES", 1<<20),
+		}
+	})
+	return idempotencySettings
+}
+
+// BeginIdempotentRequest 标记 Key 对应的请求正在执行，已有相同 Key 的请求在执行时返回 false
+func BeginIdempotentRequest(key string) bool {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	if idempotencyInflight[key] {
+		return false
+	}
+	idempotencyInflight[key] = true
+	return true
+}
+
+// EndIdempotentRequest 请求结束（无论是否保存了响应）后调用
+func EndIdempotentRequest(key string) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	delete(idempotencyInflight, key)
+}
+
+// LookupIdempotency 查找未过期的响应，没有记录或数据库不可用时返回 nil
+func LookupIdempotency(key string) (*model.IdempotencyRecord, error) {
+	if !database.Healthy() {
+		return nil, nil
+	}
+	var record model.IdempotencyRecord
+	err := database.GetDB().Where("id = ? AND expires_at > ?", key, time.Now()).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// SaveIdempotency 保存响应，数据库中断时排队写入
+func SaveIdempotency(key, requestHash string, status int, header http.Header, body []byte) {
+	if database.GetDB() == nil {
+		return
+	}
+	settings := GetIdempotencySettings()
+	headerJSON, _ := json.Marshal(header)
+	now := time.Now()
+	record := model.IdempotencyRecord{
+		ID:          key,
+		RequestHash: requestHash,
+		StatusCode:  status,
+		Header:      string(headerJSON),
+		Body:        string(body),
+		ExpiresAt:   now.Add(time.Duration(settings.TTLSeconds) * time.Second),
+		CreatedAt:   now,
+	}
+	err := database.Exec("save idempotency record", func(db *gorm.DB) error {
+		return db.Save(&record).Error
+	})
+	if err != nil {
+		log.Printf("[WARN] [Idempotency] 保存响应失败: %v", err)
+		return
+	}
+
+	idempotencyMu.Lock()
+	sweep := now.Sub(idempotencySweptAt) >= idempotencySweepInterval
+	if sweep {
+		idempotencySweptAt = now
+	}
+	idempotencyMu.Unlock()
+	if sweep {
+		database.Exec("purge expired idempotency records", func(db *gorm.DB) error {
+			return db.Where("expires_at <= ?", now).Delete(&model.IdempotencyRecord{}).Error
+		})
+	}
+}
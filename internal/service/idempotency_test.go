@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+func TestIdempotencyRecordRoundTripAndExpiry(t *testing.T) {
+	initTestDB(t, "idempotency.db")
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	SaveIdempotency("k1", "hash", http.StatusOK, header, []byte(`{"ok":true}`))
+
+	record, err := LookupIdempotency("k1")
+	if err != nil || record == nil {
+		t.Fatalf("record = %+v, err = %v", record, err)
+	}
+	if record.RequestHash != "hash" || record.StatusCode != http.StatusOK || record.Body != `{"ok":true}` {
+		t.Errorf("record = %+v", record)
+	}
+
+	if err := database.GetDB().Model(&model.IdempotencyRecord{}).Where("id = ?", "k1").
+		Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if record, err := LookupIdempotency("k1"); err != nil || record != nil {
+		t.Errorf("expired record = %+v, err = %v", record, err)
+	}
+}
+
+func TestBeginIdempotentRequestRejectsConcurrent(t *testing.T) {
+	if !BeginIdempotentRequest("k2") {
+		t.Fatal("first request rejected")
+	}
+	if BeginIdempotentRequest("k2") {
+		t.Error("concurrent request with the same key accepted")
+	}
+	EndIdempotentRequest("k2")
+	if !BeginIdempotentRequest("k2") {
+		t.Error("key not released")
+	}
+	EndIdempotentRequest("k2")
+}
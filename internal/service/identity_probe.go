@@ -0,0 +1,254 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+const (
+	// identityProbeIdleCheck 探测关闭时重新检查设置的间隔
+	identityProbeIdleCheck = time.Minute
+	// identityProbeConcurrency 同时登录探测的账号数
+	identityProbeConcurrency = 4
+	// identityMaxAlerts 保留的告警条数
+	identityMaxAlerts = 100
+)
+
+// 身份告警类型
+const (
+	IdentityMismatchEmail = "email" // 凭证登录后的邮箱与账号记录不一致，凭证可能被复用或泄露
+	IdentityMismatchPlan  = "plan"  // 订阅类型与账号记录不一致，可能是正常的升降级，只告警
+)
+
+// IdentityProbeSettings 账号身份探测配置
+type IdentityProbeSettings struct {
+	IntervalSeconds int  `json:"interval_seconds"` // 探测间隔，0 表示关闭
+	AutoDisable     bool `json:"auto_disable"`     // 邮箱不一致时自动停用账号
+}
+
+// IdentityAlert 一次身份不一致告警
+type IdentityAlert struct {
+	AccountID uint      `json:"account_id"`
+	ClientID  string    `json:"client_id"`
+	Kind      string    `json:"kind"`
+	Expected  string    `json:"expected"`
+	Actual    string    `json:"actual"`
+	Disabled  bool      `json:"disabled"` // 是否已自动停用
+	At        time.Time `json:"at"`
+}
+
+// IdentityProbeResult 一轮探测的结果
+type IdentityProbeResult struct {
+	Checked  int             `json:"checked"`
+	Skipped  int             `json:"skipped"` // 没有邮箱记录或登录失败的账号
+	Alerts   []IdentityAlert `json:"alerts"`
+	Finished time.Time       `json:"finished"`
+}
+
+var (
+	identityProbeMu       sync.RWMutex
+	identityProbeSettings IdentityProbeSettings
+	identityProbeOnce     sync.Once
+
+	identityAlertsMu sync.Mutex
+	identityAlerts   []IdentityAlert
+	identityRunMu    sync.Mutex
+
+	// identityLogin 用账号凭证重新登录取得新的 access_token，测试时替换
+	identityLogin = RefreshToken
+)
+
+// loadIdentityProbeSettings 读取 IDENTITY_PROBE_INTERVAL / IDENTITY_PROBE_AUTO_DISABLE
+func loadIdentityProbeSettings() {
+	autoDisable := strings.ToLower(strings.TrimSpace(os.Getenv("IDENTITY_PROBE_AUTO_DISABLE")))
+	identityProbeSettings = IdentityProbeSettings{
+		IntervalSeconds: envNonNegativeInt("IDENTITY_PROBE_INTERVAL"),
+		AutoDisable:     autoDisable != "false" && autoDisable != "0",
+	}
+}
+
+// GetIdentityProbeSettings 获取账号身份探测配置
+func GetIdentityProbeSettings() IdentityProbeSettings {
+	identityProbeOnce.Do(loadIdentityProbeSettings)
+	identityProbeMu.RLock()
+	defer identityProbeMu.RUnlock()
+	return identityProbeSettings
+}
+
+// SetIdentityProbeSettings 运行时修改账号身份探测配置（仅内存生效），修改间隔在下一轮生效
+func SetIdentityProbeSettings(settings IdentityProbeSettings) error {
+	if settings.IntervalSeconds < 0 {
+		return fmt.Errorf("interval_seconds 不能为负数")
+	}
+	identityProbeOnce.Do(loadIdentityProbeSettings)
+	identityProbeMu.Lock()
+	identityProbeSettings = settings
+	identityProbeMu.Unlock()
+	log.Printf("[IdentityProbe] 配置已调整: interval=%ds, auto_disable=%v", settings.IntervalSeconds, settings.AutoDisable)
+	return nil
+}
+
+// StartIdentityProbeScheduler 按 IDENTITY_PROBE_INTERVAL 定期探测账号身份，关闭时每分钟检查一次设置
+func StartIdentityProbeScheduler() {
+	go func() {
+		for {
+			seconds := GetIdentityProbeSettings().IntervalSeconds
+			if seconds <= 0 {
+				time.Sleep(identityProbeIdleCheck)
+				continue
+			}
+			time.Sleep(time.Duration(seconds) * time.Second)
+			if GetIdentityProbeSettings().IntervalSeconds > 0 {
+				RunIdentityProbe()
+			}
+		}
+	}()
+}
+
+// RunIdentityProbe 用每个正常账号的凭证重新登录，比对 JWT 中的邮箱和订阅类型与账号记录是否一致；
+// 邮箱不一致说明 client 凭证已对应到其他用户（复用或泄露），按配置自动停用
+func RunIdentityProbe() (*IdentityProbeResult, error) {
+	identityRunMu.Lock()
+	defer identityRunMu.Unlock()
+
+	var accounts []model.Account
+	if err := database.GetDB().Where("status = ?", "normal").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	autoDisable := GetIdentityProbeSettings().AutoDisable
+
+	result := &IdentityProbeResult{Alerts: []IdentityAlert{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, identityProbeConcurrency)
+	for i := range accounts {
+		account := &accounts[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			alerts, ok := probeAccountIdentity(account, autoDisable)
+			mu.Lock()
+			defer mu.Unlock()
+			if !ok {
+				result.Skipped++
+				return
+			}
+			result.Checked++
+			result.Alerts = append(result.Alerts, alerts...)
+		}()
+	}
+	wg.Wait()
+
+	result.Finished = time.Now()
+	recordIdentityAlerts(result.Alerts)
+	disabled := 0
+	for _, a := range result.Alerts {
+		if a.Disabled {
+			disabled++
+		}
+	}
+	if disabled > 0 {
+		pool.refresh()
+	}
+	log.Printf("[IdentityProbe] 探测完成：检查 %d 个账号，跳过 %d 个，告警 %d 条，停用 %d 个", result.Checked, result.Skipped, len(result.Alerts), disabled)
+	return result, nil
+}
+
+// probeAccountIdentity 探测单个账号，无法比对（没有邮箱记录或登录失败）时返回 false
+func probeAccountIdentity(account *model.Account, autoDisable bool) ([]IdentityAlert, bool) {
+	if account.Email == "" {
+		return nil, false
+	}
+	token := account.AccessToken
+	// client 凭证账号重新登录才能发现凭证已对应到其他用户；refresh_token 账号的 token 由定时刷新保持最新。
+	// 登录使用不带 ID 的副本，新 token 只用于比对，不写回账号
+	if account.ClientSecret != "refresh-token-login" {
+		probe := model.Account{ClientID: account.ClientID, ClientSecret: account.ClientSecret, Proxy: account.Proxy}
+		fresh, err := identityLogin(&probe)
+		if err != nil {
+			log.Printf("[WARN] [IdentityProbe] 账号 %s (ID:%d) 登录失败，跳过: %v", account.ClientID, account.ID, err)
+			return nil, false
+		}
+		token = fresh
+	}
+	payload, err := ParseJWT(token)
+	if err != nil {
+		return nil, false
+	}
+
+	alerts := compareAccountIdentity(account, payload, time.Now())
+	for i := range alerts {
+		if alerts[i].Kind == IdentityMismatchEmail && autoDisable {
+			alerts[i].Disabled = disableMismatchedAccount(account, alerts[i])
+		}
+		log.Printf("[WARN] [IdentityProbe] 账号 %s (ID:%d) %s 不一致: 期望 %s，实际 %s", account.ClientID, account.ID, alerts[i].Kind, alerts[i].Expected, alerts[i].Actual)
+	}
+	return alerts, true
+}
+
+// compareAccountIdentity 比对 JWT 中的邮箱和订阅类型与账号记录，JWT 中缺少的字段不比对
+func compareAccountIdentity(account *model.Account, payload *JWTPayload, now time.Time) []IdentityAlert {
+	var alerts []IdentityAlert
+	alert := func(kind, expected, actual string) {
+		alerts = append(alerts, IdentityAlert{
+			AccountID: account.ID,
+			ClientID:  account.ClientID,
+			Kind:      kind,
+			Expected:  expected,
+			Actual:    actual,
+			At:        now,
+		})
+	}
+	if payload.Email != "" && !strings.EqualFold(payload.Email, account.Email) {
+		alert(IdentityMismatchEmail, account.Email, payload.Email)
+	}
+	if plan := payload.CustomClaims.Plan; plan != "" && account.PlanType != "" && !strings.EqualFold(plan, string(account.PlanType)) {
+		alert(IdentityMismatchPlan, string(account.PlanType), plan)
+	}
+	return alerts
+}
+
+// disableMismatchedAccount 停用邮箱不一致的账号，原因写入 ban_reason
+func disableMismatchedAccount(account *model.Account, alert IdentityAlert) bool {
+	updates, _ := MoveStatusUpdates("disabled")
+	updates["ban_reason"] = fmt.Sprintf("身份探测: 凭证登录后为 %s，与账号邮箱 %s 不一致", alert.Actual, alert.Expected)
+	updates["updated_at"] = time.Now()
+	if err := database.GetDB().Model(&model.Account{}).Where("id = ?", account.ID).Updates(updates).Error; err != nil {
+		log.Printf("[WARN] [IdentityProbe] 停用账号 %s (ID:%d) 失败: %v", account.ClientID, account.ID, err)
+		return false
+	}
+	return true
+}
+
+func recordIdentityAlerts(alerts []IdentityAlert) {
+	if len(alerts) == 0 {
+		return
+	}
+	identityAlertsMu.Lock()
+	defer identityAlertsMu.Unlock()
+	identityAlerts = append(identityAlerts, alerts...)
+	if len(identityAlerts) > identityMaxAlerts {
+		identityAlerts = identityAlerts[len(identityAlerts)-identityMaxAlerts:]
+	}
+}
+
+// ListIdentityAlerts 返回最近的身份告警，最新的在前
+func ListIdentityAlerts() []IdentityAlert {
+	identityAlertsMu.Lock()
+	defer identityAlertsMu.Unlock()
+	alerts := make([]IdentityAlert, len(identityAlerts))
+	for i, a := range identityAlerts {
+		alerts[len(identityAlerts)-1-i] = a
+	}
+	return alerts
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func testJWT(t *testing.T, payload JWTPayload) string {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "header." + base64.RawURLEncoding.EncodeToString(data) + ".sig"
+}
+
+func TestCompareAccountIdentity(t *testing.T) {
+	account := &model.Account{ID: 7, ClientID: "c", Email: "a@example.com", PlanType: model.PlanAdvanced}
+	now := time.Now()
+
+	same := &JWTPayload{Email: "A@example.com", CustomClaims: CustomClaims{Plan: "advanced"}}
+	if alerts := compareAccountIdentity(account, same, now); len(alerts) != 0 {
+		t.Errorf("matching identity alerts = %+v", alerts)
+	}
+
+	changed := &JWTPayload{Email: "b@example.com", CustomClaims: CustomClaims{Plan: "Free"}}
+	alerts := compareAccountIdentity(account, changed, now)
+	if len(alerts) != 2 || alerts[0].Kind != IdentityMismatchEmail || alerts[0].Actual != "b@example.com" ||
+		alerts[1].Kind != IdentityMismatchPlan || alerts[1].Expected != string(model.PlanAdvanced) {
+		t.Errorf("alerts = %+v", alerts)
+	}
+
+	// JWT 中缺少的字段不比对
+	if alerts := compareAccountIdentity(account, &JWTPayload{}, now); len(alerts) != 0 {
+		t.Errorf("empty claims alerts = %+v", alerts)
+	}
+}
+
+func TestProbeAccountIdentityUsesFreshLogin(t *testing.T) {
+	var loggedIn model.Account
+	identityLogin = func(account *model.Account) (string, error) {
+		loggedIn = *account
+		return testJWT(t, JWTPayload{Email: "other@example.com"}), nil
+	}
+	defer func() { identityLogin = RefreshToken }()
+
+	account := &model.Account{ID: 3, ClientID: "c", ClientSecret: "s", Email: "a@example.com",
+		AccessToken: testJWT(t, JWTPayload{Email: "a@example.com"})}
+	alerts, ok := probeAccountIdentity(account, false)
+	if !ok || len(alerts) != 1 || alerts[0].Kind != IdentityMismatchEmail || alerts[0].Disabled {
+		t.Fatalf("probe = %+v, %v; want one email alert without disabling", alerts, ok)
+	}
+	if loggedIn.ID != 0 || loggedIn.ClientID != "c" {
+		t.Errorf("login copy = %+v, want the credential without the account ID so nothing is saved", loggedIn)
+	}
+
+	// refresh_token 账号直接比对当前 token，不重新登录
+	identityLogin = func(*model.Account) (string, error) { return "", errors.New("should not log in") }
+	account.ClientSecret = "refresh-token-login"
+	if alerts, ok := probeAccountIdentity(account, false); !ok || len(alerts) != 0 {
+		t.Errorf("refresh-token account = %+v, %v", alerts, ok)
+	}
+
+	account.ClientSecret = "s"
+	if _, ok := probeAccountIdentity(account, false); ok {
+		t.Error("failed login should skip the account")
+	}
+	if _, ok := probeAccountIdentity(&model.Account{ClientID: "x"}, false); ok {
+		t.Error("account without email should be skipped")
+	}
+}
+
+func TestSetIdentityProbeSettingsRejectsNegativeInterval(t *testing.T) {
+	before := GetIdentityProbeSettings()
+	defer SetIdentityProbeSettings(before)
+	if err := SetIdentityProbeSettings(IdentityProbeSettings{IntervalSeconds: -1}); err == nil {
+		t.Error("negative interval should be rejected")
+	}
+	if err := SetIdentityProbeSettings(IdentityProbeSettings{IntervalSeconds: 3600, AutoDisable: true}); err != nil || GetIdentityProbeSettings().IntervalSeconds != 3600 {
+		t.Errorf("SetIdentityProbeSettings = %v, settings = %+v", err, GetIdentityProbeSettings())
+	}
+}
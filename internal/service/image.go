@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultImageMaxBytes 单张图片解码后的默认大小上限，与 Anthropic 的限制一致
+const defaultImageMaxBytes = 5 << 20
+
+// imageFetchTimeout 下载图片 URL 的超时
+const imageFetchTimeout = 15 * time.Second
+
+// supportedImageTypes 各协议都支持的图片格式
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	imageMaxBytes     int
+	imageMaxBytesOnce sync.Once
+
+	imageHTTPClient = &http.Client{Timeout: imageFetchTimeout}
+)
+
+// GetImageMaxBytes 读取 IMAGE_MAX_BYTES
+func GetImageMaxBytes() int {
+	imageMaxBytesOnce.Do(func() {
+		imageMaxBytes = envPositiveInt("IMAGE_MAX_BYTES", defaultImageMaxBytes)
+	})
+	return imageMaxBytes
+}
+
+// ImageData 从 OpenAI image_url 中解析出的图片，URL 不为空时表示未下载的远程图片
+type ImageData struct {
+	MediaType string
+	Data      string // base64
+	URL       string
+}
+
+// ParseImageURL 解析 OpenAI 的 image_url：data URL 解码后校验大小和实际格式；
+// http(s) URL 在 fetch 为 true 时下载为 base64（上游不支持远程图片时使用），否则原样保留
+func ParseImageURL(ctx context.Context, raw string, fetch bool) (ImageData, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "data:") {
+		return parseImageDataURL(raw)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ImageData{}, invalidRequest("url must be a data URL or an http(s) URL")
+	}
+	if !fetch {
+		return ImageData{URL: raw}, nil
+	}
+	return fetchImage(ctx, raw)
+}
+
+// parseImageDataURL 解析 data:<mime>;base64,<data>
+func parseImageDataURL(raw string) (ImageData, error) {
+	meta, payload, ok := strings.Cut(strings.TrimPrefix(raw, "data:"), ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return ImageData{}, invalidRequest("data URL must be base64 encoded")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "=")); err != nil {
+			return ImageData{}, invalidRequest("invalid base64 image data")
+		}
+	}
+	return checkImage(data, strings.TrimSuffix(meta, ";base64"))
+}
+
+// fetchImage 下载远程图片，超过大小上限时不再继续读取
+func fetchImage(ctx context.Context, rawURL string) (ImageData, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return ImageData{}, invalidRequest("invalid image url")
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return ImageData{}, invalidRequest("failed to download image: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ImageData{}, invalidRequest("failed to download image: HTTP %d", resp.StatusCode)
+	}
+
+	maxBytes := GetImageMaxBytes()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return ImageData{}, invalidRequest("failed to download image: %v", err)
+	}
+	declared, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return checkImage(data, declared)
+}
+
+// checkImage 校验大小，按内容识别格式，内容无法识别时使用声明的格式
+func checkImage(data []byte, declared string) (ImageData, error) {
+	if maxBytes := GetImageMaxBytes(); len(data) > maxBytes {
+		return ImageData{}, invalidRequest("image exceeds the maximum size of %d bytes", maxBytes)
+	}
+	if len(data) == 0 {
+		return ImageData{}, invalidRequest("image is empty")
+	}
+
+	mediaType := http.DetectContentType(data)
+	if mediaType == "application/octet-stream" {
+		mediaType = strings.ToLower(strings.TrimSpace(declared))
+	}
+	if !supportedImageTypes[mediaType] {
+		return ImageData{}, invalidRequest("unsupported image type %q, expected jpeg, png, gif or webp", mediaType)
+	}
+	return ImageData{MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data)}, nil
+}
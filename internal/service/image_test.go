@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+func TestParseImageURLDataURL(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testPNG)
+
+	// 声明的格式与实际内容不符时以实际内容为准
+	img, err := ParseImageURL(context.Background(), "data:image/jpeg;base64,"+encoded, false)
+	if err != nil || img.MediaType != "image/png" || img.Data != encoded {
+		t.Fatalf("image = %+v, err = %v", img, err)
+	}
+
+	for _, raw := range []string{
+		"data:image/png," + encoded,
+		"data:image/png;base64,not base64!",
+		"data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte("hello")),
+		"data:image/png;base64," + base64.StdEncoding.EncodeToString(make([]byte, GetImageMaxBytes()+1)),
+		"ftp://example.com/a.png",
+	} {
+		if _, err := ParseImageURL(context.Background(), raw, false); err == nil {
+			t.Errorf("%.40q should be rejected", raw)
+		} else if _, ok := err.(*InvalidRequestError); !ok {
+			t.Errorf("%.40q: error %T should be an invalid request", raw, err)
+		}
+	}
+}
+
+func TestParseImageURLRemote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing.png") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(testPNG)
+	}))
+	defer srv.Close()
+
+	img, err := ParseImageURL(context.Background(), srv.URL+"/a.png", false)
+	if err != nil || img.URL != srv.URL+"/a.png" || img.Data != "" {
+		t.Fatalf("without fetch: image = %+v, err = %v", img, err)
+	}
+
+	img, err = ParseImageURL(context.Background(), srv.URL+"/a.png", true)
+	if err != nil || img.MediaType != "image/png" || img.Data != base64.StdEncoding.EncodeToString(testPNG) {
+		t.Fatalf("fetched: image = %+v, err = %v", img, err)
+	}
+
+	if _, err := ParseImageURL(context.Background(), srv.URL+"/missing.png", true); err == nil {
+		t.Error("download failure should be rejected")
+	}
+}
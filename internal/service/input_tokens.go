@@ -0,0 +1,208 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	// inputTokensStreamScanLimit message_start 是流中的第一个事件，超过该字节数仍未出现时不再查找
+	inputTokensStreamScanLimit = 64 << 10
+	// inputTokensBodyLimit 非流式响应体超过该大小时不解析用量
+	inputTokensBodyLimit = 4 << 20
+)
+
+// inputTokenBuckets 输入 token 数直方图的上界
+var inputTokenBuckets = []int{256, 1024, 4096, 16384, 32768, 65536, 131072, 200000, 500000, 1000000}
+
+type inputTokenKey struct {
+	model  string
+	stream bool
+}
+
+type inputTokenHistogram struct {
+	buckets []uint64 // 与 inputTokenBuckets 一一对应，不含 +Inf
+	count   uint64
+	sum     uint64
+}
+
+var (
+	inputTokenStatsMu sync.Mutex
+	inputTokenStats   = make(map[inputTokenKey]*inputTokenHistogram)
+)
+
+// anthropicUsage Anthropic 响应中与输入相关的用量
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// total 实际输入大小，input_tokens 不含命中或写入 prompt 缓存的部分
+func (u anthropicUsage) total() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// recordInputTokens 记录一次请求的实际输入 token 数
+func recordInputTokens(modelID string, stream bool, tokens int) {
+	if tokens < 0 {
+		return
+	}
+	inputTokenStatsMu.Lock()
+	defer inputTokenStatsMu.Unlock()
+
+	key := inputTokenKey{model: modelID, stream: stream}
+	h := inputTokenStats[key]
+	if h == nil {
+		h = &inputTokenHistogram{buckets: make([]uint64, len(inputTokenBuckets))}
+		inputTokenStats[key] = h
+	}
+	for i, le := range inputTokenBuckets {
+		if tokens <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += uint64(tokens)
+}
+
+func writeInputTokenMetrics(w io.Writer) {
+	inputTokenStatsMu.Lock()
+	defer inputTokenStatsMu.Unlock()
+
+	keys := make([]inputTokenKey, 0, len(inputTokenStats))
+	for key := range inputTokenStats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].model != keys[j].model {
+			return keys[i].model < keys[j].model
+		}
+		return !keys[i].stream && keys[j].stream
+	})
+
+	fmt.Fprintln(w, "# TYPE zencoder_request_input_tokens histogram")
+	fmt.Fprintln(w, "# HELP zencoder_request_input_tokens Input tokens per Anthropic request from upstream usage (including prompt cache reads and writes), streamed responses read from message_start.")
+	for _, key := range keys {
+		h := inputTokenStats[key]
+		labels := fmt.Sprintf("model=%q,stream=\"%t\"", key.model, key.stream)
+		for i, le := range inputTokenBuckets {
+			fmt.Fprintf(w, "zencoder_request_input_tokens_bucket{%s,le=\"%d\"} %d\n", labels, le, h.buckets[i])
+		}
+		fmt.Fprintf(w, "zencoder_request_input_tokens_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "zencoder_request_input_tokens_sum{%s} %d\n", labels, h.sum)
+		fmt.Fprintf(w, "zencoder_request_input_tokens_count{%s} %d\n", labels, h.count)
+	}
+}
+
+// anthropicUsageScanner 从转发中的 Anthropic 响应体读取输入用量：
+// 流式响应从 message_start 事件中读取，非流式响应在读完后解析响应体
+type anthropicUsageScanner struct {
+	stream  bool
+	buf     []byte
+	scanned int
+	done    bool
+}
+
+// feed 处理读取到的一段响应体，流式响应找到 message_start 时返回其中的用量
+func (s *anthropicUsageScanner) feed(p []byte) (anthropicUsage, bool) {
+	if s.done || len(p) == 0 {
+		return anthropicUsage{}, false
+	}
+	if s.stream {
+		return s.scanStream(p)
+	}
+	if len(s.buf)+len(p) > inputTokensBodyLimit {
+		s.done, s.buf = true, nil
+	} else {
+		s.buf = append(s.buf, p...)
+	}
+	return anthropicUsage{}, false
+}
+
+// eof 响应体读完时调用，非流式响应在此解析用量
+func (s *anthropicUsageScanner) eof() (anthropicUsage, bool) {
+	if s.done || s.stream {
+		return anthropicUsage{}, false
+	}
+	s.done = true
+	var resp struct {
+		Usage *anthropicUsage `json:"usage"`
+	}
+	ok := json.Unmarshal(s.buf, &resp) == nil && resp.Usage != nil
+	s.buf = nil
+	if !ok {
+		return anthropicUsage{}, false
+	}
+	return *resp.Usage, true
+}
+
+// scanStream 按行查找 message_start 事件的 data 行
+func (s *anthropicUsageScanner) scanStream(p []byte) (anthropicUsage, bool) {
+	s.scanned += len(p)
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSpace(s.buf[:i])
+		s.buf = s.buf[i+1:]
+		if usage, ok := parseMessageStartUsage(line); ok {
+			s.done, s.buf = true, nil
+			return usage, true
+		}
+	}
+	if s.scanned > inputTokensStreamScanLimit {
+		s.done, s.buf = true, nil
+	}
+	return anthropicUsage{}, false
+}
+
+// inputTokenObserver 在转发响应的同时读取 usage.input_tokens 并计入直方图
+type inputTokenObserver struct {
+	io.ReadCloser
+	model   string
+	stream  bool
+	scanner anthropicUsageScanner
+}
+
+// observeInputTokens 包装 Anthropic 响应体，读取到输入 token 数时计入直方图
+func observeInputTokens(body io.ReadCloser, modelID string, stream bool) io.ReadCloser {
+	return &inputTokenObserver{ReadCloser: body, model: modelID, stream: stream, scanner: anthropicUsageScanner{stream: stream}}
+}
+
+func (o *inputTokenObserver) Read(p []byte) (int, error) {
+	n, err := o.ReadCloser.Read(p)
+	if usage, ok := o.scanner.feed(p[:n]); ok {
+		recordInputTokens(o.model, o.stream, usage.total())
+	}
+	if err == io.EOF {
+		if usage, ok := o.scanner.eof(); ok {
+			recordInputTokens(o.model, o.stream, usage.total())
+		}
+	}
+	return n, err
+}
+
+// parseMessageStartUsage 解析 message_start 事件 data 行中的输入用量
+func parseMessageStartUsage(line []byte) (anthropicUsage, bool) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"message_start"`)) {
+		return anthropicUsage{}, false
+	}
+	var event struct {
+		Type    string `json:"type"`
+		Message struct {
+			Usage *anthropicUsage `json:"usage"`
+		} `json:"message"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(data), &event) != nil || event.Type != "message_start" || event.Message.Usage == nil {
+		return anthropicUsage{}, false
+	}
+	return *event.Message.Usage, true
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestObserveInputTokensFromStream(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":1500,"cache_read_input_tokens":3000,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"message_start"}}` + "\n\n"
+	// 逐字节读取，确保跨多次 Read 拆开的行也能识别
+	body := observeInputTokens(io.NopCloser(iotest.OneByteReader(strings.NewReader(stream))), "test-stream-model", true)
+	out, err := io.ReadAll(body)
+	if err != nil || string(out) != stream {
+		t.Fatalf("body altered: %q, %v", out, err)
+	}
+
+	var buf bytes.Buffer
+	writeInputTokenMetrics(&buf)
+	metrics := buf.String()
+	for _, want := range []string{
+		`zencoder_request_input_tokens_bucket{model="test-stream-model",stream="true",le="4096"} 0`,
+		`zencoder_request_input_tokens_bucket{model="test-stream-model",stream="true",le="16384"} 1`,
+		`zencoder_request_input_tokens_sum{model="test-stream-model",stream="true"} 4500`,
+		`zencoder_request_input_tokens_count{model="test-stream-model",stream="true"} 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("missing %q in:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestObserveInputTokensFromJSONBody(t *testing.T) {
+	body := observeInputTokens(io.NopCloser(strings.NewReader(`{"content":[],"usage":{"input_tokens":42,"output_tokens":7}}`)), "test-json-model", false)
+	io.ReadAll(body)
+
+	var buf bytes.Buffer
+	writeInputTokenMetrics(&buf)
+	if !strings.Contains(buf.String(), `zencoder_request_input_tokens_count{model="test-json-model",stream="false"} 1`) ||
+		!strings.Contains(buf.String(), `zencoder_request_input_tokens_bucket{model="test-json-model",stream="false",le="256"} 1`) {
+		t.Errorf("metrics = %s", buf.String())
+	}
+}
+
+func TestObserveInputTokensIgnoresStreamWithoutMessageStart(t *testing.T) {
+	stream := strings.Repeat("event: ping\ndata: {\"type\": \"ping\"}\n\n", 4000)
+	io.ReadAll(observeInputTokens(io.NopCloser(strings.NewReader(stream)), "test-no-start-model", true))
+
+	var buf bytes.Buffer
+	writeInputTokenMetrics(&buf)
+	if strings.Contains(buf.String(), "test-no-start-model") {
+		t.Errorf("should not record without message_start: %s", buf.String())
+	}
+}
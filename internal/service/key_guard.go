@@ -0,0 +1,356 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 异常告警类型
+const (
+	KeyAlertVolumeSpike = "volume_spike" // 请求量突增到基线的 10 倍以上
+	KeyAlertNewNetwork  = "new_network"  // 来自从未出现过的网段
+)
+
+const (
+	keySpikeFactor      = 10  // 超过基线多少倍视为突增
+	keyLearningMinutes  = 10  // 建立基线所需的活跃分钟数，之前不告警
+	keyMaxNetworks      = 256 // 每个 Key 记录的网段上限
+	keyMaxAlerts        = 100 // 保留的告警条数
+	keyBaselineDecay    = 0.9 // 每分钟基线的衰减系数
+	keyMaxElapsedFolded = 60  // 计算基线时最多补齐的空闲分钟数
+)
+
+// KeyAlert 一条 API Key 异常告警
+type KeyAlert struct {
+	Key            string    `json:"key"` // 已脱敏
+	Type           string    `json:"type"`
+	Detail         string    `json:"detail"`
+	At             time.Time `json:"at"`
+	SuspendedUntil time.Time `json:"suspendedUntil"` // 零值表示未暂停
+}
+
+// KeyGuardConfig 异常检测配置
+type KeyGuardConfig struct {
+	Enabled        bool `json:"enabled"`
+	MinRequests    int  `json:"minRequests"` // 一分钟内至少这么多请求才判定突增
+	SuspendSeconds int  `json:"suspendSeconds"`
+	suspendFor     time.Duration
+}
+
+// KeyGuardSettings IP 绑定、暂停中的 Key 及最近告警
+type KeyGuardSettings struct {
+	KeyGuardConfig
+	AllowedIPs map[string][]string  `json:"allowedIps"` // 按 API Key（已脱敏）
+	Suspended  map[string]time.Time `json:"suspended"`  // 按 API Key（已脱敏）
+	Alerts     []KeyAlert           `json:"alerts"`
+}
+
+// keyUsage 单个 Key 的用量统计
+type keyUsage struct {
+	minute         int64
+	count          int
+	baseline       float64 // 历史每分钟请求数的指数平均
+	foldedMinutes  int     // 已并入基线的分钟数
+	activeMinutes  int
+	spikeAlerted   bool
+	networks       map[string]bool
+	suspendedUntil time.Time
+}
+
+type keyGuard struct {
+	mu      sync.Mutex
+	config  KeyGuardConfig
+	allowed map[string][]*net.IPNet
+	usage   map[string]*keyUsage
+	alerts  []KeyAlert
+}
+
+var (
+	keyGuardState *keyGuard
+	keyGuardOnce  sync.Once
+)
+
+func newKeyGuard(config KeyGuardConfig) *keyGuard {
+	config.suspendFor = time.Duration(config.SuspendSeconds) * time.Second
+	return &keyGuard{
+		config:  config,
+		allowed: make(map[string][]*net.IPNet),
+		usage:   make(map[string]*keyUsage),
+	}
+}
+
+// getKeyGuard 读取 KEY_ANOMALY_DETECTION / KEY_ANOMALY_MIN_REQUESTS / KEY_SUSPEND_SECONDS，
+// 并按 AUTH_ALLOWED_IPS 绑定 AUTH_TOKEN 的来源 IP
+func getKeyGuard() *keyGuard {
+	keyGuardOnce.Do(func() {
+		enabled := strings.ToLower(strings.TrimSpace(os.Getenv("KEY_ANOMALY_DETECTION")))
+		config := KeyGuardConfig{
+			Enabled:        enabled == "true" || enabled == "1",
+			MinRequests:    envPositiveInt("KEY_ANOMALY_MIN_REQUESTS", 30),
+			SuspendSeconds: envNonNegativeIntDefault("KEY_SUSPEND_SECONDS", 900),
+		}
+		keyGuardState = newKeyGuard(config)
+		if token, raw := GetSecret("AUTH_TOKEN"), os.Getenv("AUTH_ALLOWED_IPS"); token != "" && strings.TrimSpace(raw) != "" {
+			if nets, err := parseAllowedIPs(strings.Split(raw, ",")); err != nil {
+				log.Printf("[WARN] 无效的 AUTH_ALLOWED_IPS: %v，已忽略", err)
+			} else if len(nets) > 0 {
+				keyGuardState.allowed[token] = nets
+			}
+		}
+		if config.Enabled {
+			log.Printf("[INFO] 已启用 API Key 异常检测 (突增阈值 %d 次/分钟，暂停 %d 秒)", config.MinRequests, config.SuspendSeconds)
+		}
+	})
+	return keyGuardState
+}
+
+func envPositiveInt(name string, def int) int {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("[WARN] 无效的 %s: %s，使用默认值 %d", name, raw, def)
+		return def
+	}
+	return n
+}
+
+func envNonNegativeIntDefault(name string, def int) int {
+	if strings.TrimSpace(os.Getenv(name)) == "" {
+		return def
+	}
+	return envNonNegativeInt(name)
+}
+
+// MaskAPIKey 日志及告警中使用的脱敏 Key
+func MaskAPIKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+// parseAllowedIPs 解析 IP 或 CIDR 列表
+func parseAllowedIPs(items []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 CIDR: %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// networkOf 返回 IP 所在网段（IPv4 /16，IPv6 /32），用于发现新的来源地区
+func networkOf(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String() + "/32"
+}
+
+// check 在转发前检查 Key：IP 不在绑定范围内或 Key 已暂停时返回错误，同时更新用量并检测异常
+func (g *keyGuard) check(apiKey string, ip net.IP, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if nets, bound := g.allowed[apiKey]; bound && !ipAllowed(nets, ip) {
+		return fmt.Errorf("source IP %s is not allowed for this API key", ip)
+	}
+	if !g.config.Enabled {
+		return nil
+	}
+
+	u := g.usage[apiKey]
+	if u == nil {
+		u = &keyUsage{minute: now.Unix() / 60, networks: make(map[string]bool)}
+		g.usage[apiKey] = u
+	}
+	if now.Before(u.suspendedUntil) {
+		return fmt.Errorf("API key temporarily suspended until %s due to anomalous usage", u.suspendedUntil.UTC().Format(time.RFC3339))
+	}
+
+	u.advance(now.Unix() / 60)
+	u.count++
+	learned := u.activeMinutes >= keyLearningMinutes
+
+	if ip != nil {
+		network := networkOf(ip)
+		if !u.networks[network] {
+			if learned {
+				g.alert(apiKey, KeyAlertNewNetwork, fmt.Sprintf("来自新网段 %s (%s)", network, ip), time.Time{}, now)
+			}
+			if len(u.networks) < keyMaxNetworks {
+				u.networks[network] = true
+			}
+		}
+	}
+
+	baseline := u.baseline
+	if baseline < 1 {
+		baseline = 1
+	}
+	if learned && !u.spikeAlerted && u.count >= g.config.MinRequests && float64(u.count) > keySpikeFactor*baseline {
+		u.spikeAlerted = true
+		var until time.Time
+		if g.config.suspendFor > 0 {
+			until = now.Add(g.config.suspendFor)
+			u.suspendedUntil = until
+		}
+		g.alert(apiKey, KeyAlertVolumeSpike, fmt.Sprintf("本分钟 %d 次请求，基线 %.1f 次/分钟", u.count, u.baseline), until, now)
+	}
+	return nil
+}
+
+// advance 切换到新的分钟，把已结束分钟的请求数并入基线
+func (u *keyUsage) advance(minute int64) {
+	if minute <= u.minute {
+		return
+	}
+	if u.count > 0 {
+		u.activeMinutes++
+	}
+	elapsed := minute - u.minute
+	if elapsed > keyMaxElapsedFolded {
+		elapsed = keyMaxElapsedFolded
+	}
+	for i := int64(0); i < elapsed; i++ {
+		// 起步阶段按算术平均，避免基线从 0 缓慢爬升
+		u.foldedMinutes++
+		weight := 1 / float64(u.foldedMinutes)
+		if weight < 1-keyBaselineDecay {
+			weight = 1 - keyBaselineDecay
+		}
+		u.baseline += (float64(u.count) - u.baseline) * weight
+		u.count = 0
+	}
+	u.minute = minute
+	u.spikeAlerted = false
+}
+
+func ipAllowed(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// alert 记录告警，调用方需持有锁
+func (g *keyGuard) alert(apiKey, alertType, detail string, suspendedUntil, now time.Time) {
+	a := KeyAlert{Key: MaskAPIKey(apiKey), Type: alertType, Detail: detail, At: now, SuspendedUntil: suspendedUntil}
+	if suspendedUntil.IsZero() {
+		log.Printf("[KeyGuard] API Key %s 异常 (%s): %s", a.Key, alertType, detail)
+	} else {
+		log.Printf("[KeyGuard] API Key %s 异常 (%s): %s，已暂停至 %s", a.Key, alertType, detail, suspendedUntil.Format(time.RFC3339))
+	}
+	g.alerts = append(g.alerts, a)
+	if len(g.alerts) > keyMaxAlerts {
+		g.alerts = g.alerts[len(g.alerts)-keyMaxAlerts:]
+	}
+}
+
+// CheckAPIKeyAccess 检查 API Key 的来源 IP 绑定和暂停状态，并统计用量检测异常
+func CheckAPIKeyAccess(apiKey, clientIP string, now time.Time) error {
+	if apiKey == "" {
+		return nil
+	}
+	return getKeyGuard().check(apiKey, net.ParseIP(clientIP), now)
+}
+
+// SetAPIKeyAllowedIPs 绑定 API Key 的来源 IP/CIDR（仅内存生效），列表为空时解除绑定
+func SetAPIKeyAllowedIPs(apiKey string, items []string) error {
+	nets, err := parseAllowedIPs(items)
+	if err != nil {
+		return err
+	}
+	g := getKeyGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(nets) == 0 {
+		delete(g.allowed, apiKey)
+	} else {
+		g.allowed[apiKey] = nets
+	}
+	return nil
+}
+
+// rebindAuthToken AUTH_TOKEN 轮换后把旧 Token 的来源 IP 绑定转给新 Token
+func rebindAuthToken(oldToken, newToken string) {
+	g := getKeyGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nets, ok := g.allowed[oldToken]
+	if !ok || oldToken == "" || newToken == "" {
+		return
+	}
+	delete(g.allowed, oldToken)
+	g.allowed[newToken] = nets
+}
+
+// ResumeAPIKey 立即解除 API Key 的暂停，之后的分钟仍突增时会再次暂停
+func ResumeAPIKey(apiKey string) {
+	g := getKeyGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if u := g.usage[apiKey]; u != nil {
+		u.suspendedUntil = time.Time{}
+	}
+}
+
+// GetKeyGuardSettings 获取 IP 绑定、暂停中的 Key 及最近的告警
+func GetKeyGuardSettings() KeyGuardSettings {
+	g := getKeyGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	result := KeyGuardSettings{
+		KeyGuardConfig: g.config,
+		AllowedIPs:     make(map[string][]string, len(g.allowed)),
+		Suspended:      make(map[string]time.Time),
+		Alerts:         append([]KeyAlert(nil), g.alerts...),
+	}
+	for key, nets := range g.allowed {
+		masked := MaskAPIKey(key)
+		for _, n := range nets {
+			result.AllowedIPs[masked] = append(result.AllowedIPs[masked], n.String())
+		}
+	}
+	for key, u := range g.usage {
+		if now.Before(u.suspendedUntil) {
+			result.Suspended[MaskAPIKey(key)] = u.suspendedUntil
+		}
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyGuardIPBinding(t *testing.T) {
+	g := newKeyGuard(KeyGuardConfig{})
+	nets, err := parseAllowedIPs([]string{"10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("parseAllowedIPs: %v", err)
+	}
+	g.allowed["sk-bound"] = nets
+
+	now := time.Now()
+	for ip, allowed := range map[string]bool{"10.1.2.3": true, "192.168.1.5": true, "192.168.1.6": false, "": false} {
+		err := g.check("sk-bound", net.ParseIP(ip), now)
+		if (err == nil) != allowed {
+			t.Errorf("ip %q: err=%v, want allowed=%v", ip, err, allowed)
+		}
+	}
+	if err := g.check("sk-other", net.ParseIP("8.8.8.8"), now); err != nil {
+		t.Errorf("unbound key rejected: %v", err)
+	}
+
+	if _, err := parseAllowedIPs([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
+
+// warmUp 以每分钟 perMinute 次请求建立基线，返回下一分钟的起始时间
+func warmUp(t *testing.T, g *keyGuard, key string, start time.Time, perMinute int) time.Time {
+	t.Helper()
+	ip := net.ParseIP("203.0.113.7")
+	for m := 0; m < keyLearningMinutes+1; m++ {
+		at := start.Add(time.Duration(m) * time.Minute)
+		for i := 0; i < perMinute; i++ {
+			if err := g.check(key, ip, at); err != nil {
+				t.Fatalf("warm-up rejected at minute %d: %v", m, err)
+			}
+		}
+	}
+	return start.Add(time.Duration(keyLearningMinutes+1) * time.Minute)
+}
+
+func TestKeyGuardSuspendsOnVolumeSpike(t *testing.T) {
+	g := newKeyGuard(KeyGuardConfig{Enabled: true, MinRequests: 20, SuspendSeconds: 600})
+	start := time.Unix(1_700_000_040, 0).Truncate(time.Minute)
+	spikeAt := warmUp(t, g, "sk-leaked", start, 3)
+
+	ip := net.ParseIP("203.0.113.7")
+	var rejected error
+	sent := 0
+	for sent = 0; sent < 200; sent++ {
+		if rejected = g.check("sk-leaked", ip, spikeAt); rejected != nil {
+			break
+		}
+	}
+	if rejected == nil {
+		t.Fatal("spike did not suspend the key")
+	}
+	if sent < 30 {
+		t.Errorf("suspended after %d requests, want at least 10x baseline", sent)
+	}
+	if !strings.Contains(rejected.Error(), "suspended") {
+		t.Errorf("unexpected error: %v", rejected)
+	}
+
+	if len(g.alerts) != 1 || g.alerts[0].Type != KeyAlertVolumeSpike || g.alerts[0].Key == "sk-leaked" {
+		t.Errorf("alerts = %+v", g.alerts)
+	}
+	if err := g.check("sk-leaked", ip, spikeAt.Add(11*time.Minute)); err != nil {
+		t.Errorf("suspension did not expire: %v", err)
+	}
+}
+
+func TestKeyGuardSteadyTrafficNotSuspended(t *testing.T) {
+	g := newKeyGuard(KeyGuardConfig{Enabled: true, MinRequests: 20, SuspendSeconds: 600})
+	start := time.Unix(1_700_000_040, 0).Truncate(time.Minute)
+	next := warmUp(t, g, "sk-busy", start, 50)
+	for i := 0; i < 60; i++ {
+		if err := g.check("sk-busy", net.ParseIP("203.0.113.7"), next); err != nil {
+			t.Fatalf("steady traffic suspended: %v", err)
+		}
+	}
+	if len(g.alerts) != 0 {
+		t.Errorf("unexpected alerts: %+v", g.alerts)
+	}
+}
+
+func TestKeyGuardAlertsOnNewNetwork(t *testing.T) {
+	g := newKeyGuard(KeyGuardConfig{Enabled: true, MinRequests: 1000})
+	start := time.Unix(1_700_000_040, 0).Truncate(time.Minute)
+	next := warmUp(t, g, "sk-roaming", start, 2)
+
+	// 同一 /16 网段不告警
+	g.check("sk-roaming", net.ParseIP("203.0.200.1"), next)
+	if len(g.alerts) != 0 {
+		t.Fatalf("same network alerted: %+v", g.alerts)
+	}
+	g.check("sk-roaming", net.ParseIP("198.51.100.9"), next)
+	g.check("sk-roaming", net.ParseIP("198.51.100.10"), next)
+	if len(g.alerts) != 1 || g.alerts[0].Type != KeyAlertNewNetwork {
+		t.Fatalf("alerts = %+v", g.alerts)
+	}
+	if !g.alerts[0].SuspendedUntil.IsZero() {
+		t.Error("new network should only alert, not suspend")
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// KeyReservation 一个 API Key 预留的号池容量及当前占用
+type KeyReservation struct {
+	KeyID    uint   `json:"key_id"`
+	Name     string `json:"name"`
+	Prefix   string `json:"prefix"`
+	Reserved int    `json:"reserved"` // 预留的并发数，其他 Key 不能占用
+	InUse    int    `json:"in_use"`   // 进行中的请求数，包括超出预留、占用共享容量的部分
+}
+
+// PoolReservationStatus 号池容量的分配情况
+type PoolReservationStatus struct {
+	Capacity    int              `json:"capacity"` // 号池账号数 × 每个账号的并发上限
+	Reserved    int              `json:"reserved"` // 各 Key 的预留之和
+	Shared      int              `json:"shared"`   // 未被预留、所有请求尽力共享的容量
+	SharedInUse int              `json:"shared_in_use"`
+	Keys        []KeyReservation `json:"keys"`
+}
+
+// PoolCapacityError Key 的预留已用完且共享容量已满
+type PoolCapacityError struct {
+	Reserved int
+	Shared   int
+}
+
+func (e *PoolCapacityError) Error() string {
+	if e.Reserved > 0 {
+		return fmt.Sprintf("API key is using all %d reserved pool slots and the %d shared slots are busy", e.Reserved, e.Shared)
+	}
+	return fmt.Sprintf("all %d shared pool slots are busy; the rest of the pool is reserved for other API keys", e.Shared)
+}
+
+// keyReservationState 一个有预留的 Key 的占用情况
+type keyReservationState struct {
+	KeyReservation
+	reservedInUse int // 占用预留容量的请求数
+	sharedInUse   int // 超出预留、占用共享容量的请求数
+}
+
+// poolReservations 按 Key 哈希记录预留及占用；没有预留的 Key（包括 AUTH_TOKEN）只能使用共享容量
+type poolReservations struct {
+	mu          sync.Mutex
+	loaded      bool
+	keys        map[string]*keyReservationState
+	reserved    int
+	sharedInUse int
+}
+
+var reservations = &poolReservations{keys: make(map[string]*keyReservationState)}
+
+// setReservations 替换预留列表，保留仍有预留的 Key 的占用计数；调用方需持有锁
+func (r *poolReservations) setReservations(byHash map[string]KeyReservation) {
+	keys := make(map[string]*keyReservationState, len(byHash))
+	total := 0
+	for hash, k := range byHash {
+		state := &keyReservationState{KeyReservation: k}
+		if old := r.keys[hash]; old != nil {
+			state.reservedInUse, state.sharedInUse = old.reservedInUse, old.sharedInUse
+		}
+		keys[hash] = state
+		total += k.Reserved
+	}
+	r.keys = keys
+	r.reserved = total
+	r.loaded = true
+}
+
+// load 从数据库读取启用中、未过期且有预留的 Key，数据库不可用时沿用之前的列表；调用方需持有锁
+func (r *poolReservations) load(now time.Time) {
+	if r.loaded || !database.Healthy() {
+		return
+	}
+	var keys []model.APIKey
+	err := database.GetDB().Where("reserved_slots > 0 AND enabled = ?", true).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Find(&keys).Error
+	if err != nil {
+		log.Printf("[WARN] [Reservation] 读取 API Key 预留失败: %v", err)
+		return
+	}
+	byHash := make(map[string]KeyReservation, len(keys))
+	for _, k := range keys {
+		byHash[k.KeyHash] = KeyReservation{KeyID: k.ID, Name: k.Name, Prefix: k.Prefix, Reserved: k.ReservedSlots}
+	}
+	r.setReservations(byHash)
+}
+
+// acquire 为请求占用一个号池容量：先用 Key 自己的预留，用完后与其他请求共享未预留的部分。
+// 没有任何预留时不做限制，由号池按账号状态调度
+func (r *poolReservations) acquire(hash string, capacity int) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reserved == 0 {
+		return func() {}, nil
+	}
+
+	state := r.keys[hash]
+	if state != nil && state.reservedInUse < state.Reserved {
+		state.reservedInUse++
+		return r.releaser(hash, true), nil
+	}
+	shared := max(capacity-r.reserved, 0)
+	if r.sharedInUse >= shared {
+		err := &PoolCapacityError{Shared: shared}
+		if state != nil {
+			err.Reserved = state.Reserved
+		}
+		return nil, err
+	}
+	r.sharedInUse++
+	if state != nil {
+		state.sharedInUse++
+	}
+	return r.releaser(hash, false), nil
+}
+
+// releaser 返回只生效一次的释放函数；期间预留被修改时按当前的记录扣减
+func (r *poolReservations) releaser(hash string, reserved bool) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			state := r.keys[hash]
+			if reserved {
+				if state != nil && state.reservedInUse > 0 {
+					state.reservedInUse--
+				}
+				return
+			}
+			if r.sharedInUse > 0 {
+				r.sharedInUse--
+			}
+			if state != nil && state.sharedInUse > 0 {
+				state.sharedInUse--
+			}
+		})
+	}
+}
+
+func (r *poolReservations) status(capacity int) PoolReservationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := PoolReservationStatus{
+		Capacity:    capacity,
+		Reserved:    r.reserved,
+		Shared:      max(capacity-r.reserved, 0),
+		SharedInUse: r.sharedInUse,
+		Keys:        make([]KeyReservation, 0, len(r.keys)),
+	}
+	for _, state := range r.keys {
+		k := state.KeyReservation
+		k.InUse = state.reservedInUse + state.sharedInUse
+		status.Keys = append(status.Keys, k)
+	}
+	sort.Slice(status.Keys, func(i, j int) bool { return status.Keys[i].KeyID < status.Keys[j].KeyID })
+	return status
+}
+
+// poolCapacity 号池的总并发容量
+func poolCapacity() int {
+	return pool.count() * GetAccountConcurrency()
+}
+
+// AcquirePoolSlot 在分发前为 API Key 的请求占用号池容量，返回的函数在请求结束时释放。
+// 预留和共享容量都已占满时返回 *PoolCapacityError
+func AcquirePoolSlot(apiKey string) (func(), error) {
+	reservations.mu.Lock()
+	reservations.load(time.Now())
+	reservations.mu.Unlock()
+	return reservations.acquire(HashAPIKey(apiKey), poolCapacity())
+}
+
+// ReloadPoolReservations API Key 修改后下次分发时重新读取预留
+func ReloadPoolReservations() {
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+	reservations.loaded = false
+}
+
+// GetPoolReservationStatus 获取号池容量、各 Key 的预留及当前占用
+func GetPoolReservationStatus() PoolReservationStatus {
+	reservations.mu.Lock()
+	reservations.load(time.Now())
+	reservations.mu.Unlock()
+	return reservations.status(poolCapacity())
+}
+
+// SetAPIKeyReservation 修改 API Key 预留的号池并发数，0 表示取消预留
+func SetAPIKeyReservation(id uint, slots int) (*model.APIKey, error) {
+	if slots < 0 {
+		return nil, fmt.Errorf("reserved_slots must not be negative")
+	}
+	var key model.APIKey
+	if err := database.GetDB().First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Model(&key).Update("reserved_slots", slots).Error; err != nil {
+		return nil, err
+	}
+	key.ReservedSlots = slots
+	ReloadPoolReservations()
+	if capacity := poolCapacity(); slots > 0 && GetPoolReservationStatus().Reserved > capacity {
+		log.Printf("[Reservation] 各 API Key 的预留之和已超过号池容量 %d，共享容量为 0", capacity)
+	}
+	return &key, nil
+}
+
+func writePoolReservationMetrics(w io.Writer) {
+	status := reservations.status(poolCapacity())
+	if status.Reserved == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# TYPE zencoder_pool_reserved_slots gauge")
+	fmt.Fprintln(w, "# HELP zencoder_pool_reserved_slots Pool slots reserved for the API key.")
+	for _, k := range status.Keys {
+		fmt.Fprintf(w, "zencoder_pool_reserved_slots{key_id=\"%d\"} %d\n", k.KeyID, k.Reserved)
+	}
+	fmt.Fprintln(w, "# TYPE zencoder_pool_reserved_in_use gauge")
+	fmt.Fprintln(w, "# HELP zencoder_pool_reserved_in_use In-flight requests of the API key, including those using shared slots.")
+	for _, k := range status.Keys {
+		fmt.Fprintf(w, "zencoder_pool_reserved_in_use{key_id=\"%d\"} %d\n", k.KeyID, k.InUse)
+	}
+	fmt.Fprintln(w, "# TYPE zencoder_pool_shared_slots_in_use gauge")
+	fmt.Fprintln(w, "# HELP zencoder_pool_shared_slots_in_use In-flight requests using unreserved pool slots.")
+	fmt.Fprintf(w, "zencoder_pool_shared_slots_in_use %d\n", status.SharedInUse)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPoolReservationsEnforceReservedAndShared(t *testing.T) {
+	r := &poolReservations{keys: make(map[string]*keyReservationState)}
+
+	// 没有预留时不限制
+	if _, err := r.acquire("noisy", 0); err != nil {
+		t.Fatalf("no reservations: %v", err)
+	}
+
+	r.setReservations(map[string]KeyReservation{
+		"tenant-a": {KeyID: 1, Reserved: 2},
+		"tenant-b": {KeyID: 2, Reserved: 1},
+	})
+	const capacity = 5 // 共享 2
+
+	var capacityErr *PoolCapacityError
+	var noisy []func()
+	for i := 0; i < 2; i++ {
+		release, err := r.acquire("noisy", capacity)
+		if err != nil {
+			t.Fatalf("noisy request %d: %v", i, err)
+		}
+		noisy = append(noisy, release)
+	}
+	if _, err := r.acquire("noisy", capacity); !errors.As(err, &capacityErr) || capacityErr.Shared != 2 {
+		t.Fatalf("noisy key took reserved capacity: err = %v", err)
+	}
+
+	// 共享容量已满，预留仍可用
+	releaseA1, err := r.acquire("tenant-a", capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.acquire("tenant-a", capacity); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.acquire("tenant-a", capacity); !errors.As(err, &capacityErr) || capacityErr.Reserved != 2 {
+		t.Fatalf("tenant-a beyond reservation with shared full: err = %v", err)
+	}
+	if _, err := r.acquire("tenant-b", capacity); err != nil {
+		t.Fatal(err)
+	}
+
+	// 共享容量释放后，超出预留的部分可以尽力使用
+	noisy[0]()
+	noisy[0]() // 重复释放无效
+	if _, err := r.acquire("tenant-a", capacity); err != nil {
+		t.Fatalf("tenant-a overflow into shared: %v", err)
+	}
+	status := r.status(capacity)
+	if status.Reserved != 3 || status.Shared != 2 || status.SharedInUse != 2 || status.Keys[0].InUse != 3 {
+		t.Errorf("status = %+v", status)
+	}
+
+	releaseA1()
+	if _, err := r.acquire("tenant-a", capacity); err != nil {
+		t.Fatalf("released reserved slot not reusable: %v", err)
+	}
+
+	// 修改预留时保留占用计数
+	r.setReservations(map[string]KeyReservation{"tenant-a": {KeyID: 1, Reserved: 4}})
+	if got := r.status(capacity).Keys[0].InUse; got != 3 {
+		t.Errorf("in use after reload = %d", got)
+	}
+
+	var buf bytes.Buffer
+	old := reservations
+	reservations = r
+	defer func() { reservations = old }()
+	writePoolReservationMetrics(&buf)
+	if !strings.Contains(buf.String(), `zencoder_pool_reserved_slots{key_id="1"} 4`) {
+		t.Errorf("metrics = %s", buf.String())
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBudgetHeader 客户端声明的延迟预算（毫秒），首字节超过预算的一部分时换号重试一次
+const LatencyBudgetHeader = "X-Zen-Latency-Budget-Ms"
+
+// ErrLatencyBudgetExceeded 换号后仍未在延迟预算内收到上游响应头
+var ErrLatencyBudgetExceeded = errors.New("budget_exceeded")
+
+const (
+	// latencyBudgetContextKey 请求的延迟预算
+	latencyBudgetContextKey contextKey = "latency_budget"
+	// upstreamContextKey 单次上游请求可被延迟预算取消的 context
+	upstreamContextKey contextKey = "upstream_context"
+
+	defaultLatencyBudgetPercent = 50
+	// latencyBudgetAttempts 超出预算时最多尝试的次数（首次加一次换号）
+	latencyBudgetAttempts = 2
+	// maxLatencyBudget 延迟预算的上限
+	maxLatencyBudget = 10 * time.Minute
+)
+
+var (
+	latencyBudgetPercent     int
+	latencyBudgetPercentOnce sync.Once
+)
+
+// getLatencyBudgetPercent 读取 LATENCY_BUDGET_TTFB_PERCENT：首字节超过预算的该百分比时放弃当前账号
+func getLatencyBudgetPercent() int {
+	latencyBudgetPercentOnce.Do(func() {
+		latencyBudgetPercent = envPositiveInt("LATENCY_BUDGET_TTFB_PERCENT", defaultLatencyBudgetPercent)
+		if latencyBudgetPercent > 100 {
+			log.Printf("[WARN] LATENCY_BUDGET_TTFB_PERCENT 不能超过 100，使用默认值 %d", defaultLatencyBudgetPercent)
+			latencyBudgetPercent = defaultLatencyBudgetPercent
+		}
+	})
+	return latencyBudgetPercent
+}
+
+// WithLatencyBudget 为请求设置延迟预算
+func WithLatencyBudget(ctx context.Context, budget time.Duration) context.Context {
+	return context.WithValue(ctx, latencyBudgetContextKey, budget)
+}
+
+// upstreamContext 上游请求使用的 context，只有延迟预算会取消上游请求，客户端断开不影响
+func upstreamContext(ctx context.Context) context.Context {
+	if upstream, ok := ctx.Value(upstreamContextKey).(context.Context); ok {
+		return upstream
+	}
+	return context.Background()
+}
+
+// latencyBudget 一次请求（含重试）的延迟预算，未设置预算时为 nil，各方法均可在 nil 上调用
+type latencyBudget struct {
+	deadline time.Time
+	ttfb     time.Duration // 单次尝试等待响应头的上限
+	exceeded int           // 超出预算的尝试次数
+}
+
+// newLatencyBudget 从请求 context 读取延迟预算，预算从调用时开始计算
+func newLatencyBudget(ctx context.Context) *latencyBudget {
+	budget, ok := ctx.Value(latencyBudgetContextKey).(time.Duration)
+	if !ok || budget <= 0 {
+		return nil
+	}
+	return &latencyBudget{
+		deadline: time.Now().Add(budget),
+		ttfb:     budget * time.Duration(getLatencyBudgetPercent()) / 100,
+	}
+}
+
+// attempt 开始一次上游请求：超过首字节上限仍未收到响应头时取消请求
+// 返回的 finish 需在 doRequest 返回后立即调用，超时的请求会被转换为 ErrLatencyBudgetExceeded
+func (b *latencyBudget) attempt(ctx context.Context) (context.Context, func(*http.Response, error) (*http.Response, error)) {
+	if b == nil {
+		return ctx, func(resp *http.Response, err error) (*http.Response, error) { return resp, err }
+	}
+
+	limit := b.ttfb
+	if remaining := time.Until(b.deadline); remaining < limit {
+		limit = remaining
+	}
+	upstream, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(max(limit, 0), cancel)
+	ctx = context.WithValue(ctx, upstreamContextKey, upstream)
+
+	return ctx, func(resp *http.Response, err error) (*http.Response, error) {
+		if timer.Stop() {
+			if resp == nil {
+				cancel()
+			} else {
+				// 响应体读完或关闭后再释放 context，否则会中断正在读取的响应
+				resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			}
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		b.exceeded++
+		return nil, fmt.Errorf("%w: %s 内未收到上游响应头", ErrLatencyBudgetExceeded, limit.Round(time.Millisecond))
+	}
+}
+
+// exhausted 超出预算的尝试已达上限或预算已用完时返回 true，调用方应直接返回 err
+func (b *latencyBudget) exhausted(err error) bool {
+	if b == nil || !errors.Is(err, ErrLatencyBudgetExceeded) {
+		return false
+	}
+	return b.exceeded >= latencyBudgetAttempts || !time.Now().Before(b.deadline)
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// ParseLatencyBudget 解析 X-Zen-Latency-Budget-Ms 的值
+func ParseLatencyBudget(raw string) (time.Duration, error) {
+	ms, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("%s 必须是正整数（毫秒）", LatencyBudgetHeader)
+	}
+	if int64(ms) > maxLatencyBudget.Milliseconds() {
+		return 0, fmt.Errorf("%s 不能超过 %d", LatencyBudgetHeader, maxLatencyBudget.Milliseconds())
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
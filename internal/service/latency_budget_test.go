@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLatencyBudget(t *testing.T) {
+	if got, err := ParseLatencyBudget(" 1500 "); err != nil || got != 1500*time.Millisecond {
+		t.Errorf("ParseLatencyBudget(1500) = %v, %v", got, err)
+	}
+	for _, raw := range []string{"", "0", "-5", "1.5s", "600001", "99999999999999999999"} {
+		if _, err := ParseLatencyBudget(raw); err == nil {
+			t.Errorf("ParseLatencyBudget(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestLatencyBudgetFailsOverOnceOnSlowTTFB(t *testing.T) {
+	delay := make(chan time.Duration, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(<-delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// 响应头之后的输出不受预算限制
+		time.Sleep(150 * time.Millisecond)
+		io.WriteString(w, "done")
+	}))
+	defer srv.Close()
+
+	do := func(ctx context.Context) (*http.Response, error) {
+		req, _ := http.NewRequestWithContext(upstreamContext(ctx), "GET", srv.URL, nil)
+		return http.DefaultClient.Do(req)
+	}
+
+	// 预算 400ms，默认首字节上限为一半即 200ms
+	ctx := WithLatencyBudget(context.Background(), 400*time.Millisecond)
+	budget := newLatencyBudget(ctx)
+
+	delay <- time.Second
+	attemptCtx, finish := budget.attempt(ctx)
+	resp, err := finish(do(attemptCtx))
+	if !errors.Is(err, ErrLatencyBudgetExceeded) || resp != nil {
+		t.Fatalf("slow attempt = %v, %v; want ErrLatencyBudgetExceeded", resp, err)
+	}
+	if budget.exhausted(err) {
+		t.Fatal("first slow attempt should allow one failover")
+	}
+
+	delay <- 0
+	attemptCtx, finish = budget.attempt(ctx)
+	resp, err = finish(do(attemptCtx))
+	if err != nil {
+		t.Fatalf("fast attempt: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "done" {
+		t.Errorf("body = %q, %v; want the full body read past the TTFB limit", body, err)
+	}
+
+	budget.exceeded = latencyBudgetAttempts
+	if !budget.exhausted(ErrLatencyBudgetExceeded) || budget.exhausted(errors.New("other")) {
+		t.Error("only a second budget failure should be final")
+	}
+}
+
+func TestLatencyBudgetUnsetIsNoop(t *testing.T) {
+	budget := newLatencyBudget(context.Background())
+	if budget != nil {
+		t.Fatalf("newLatencyBudget without header = %+v, want nil", budget)
+	}
+	ctx := context.Background()
+	attemptCtx, finish := budget.attempt(ctx)
+	if attemptCtx != ctx || upstreamContext(attemptCtx) != context.Background() {
+		t.Error("attempt without budget should not change the upstream context")
+	}
+	sentinel := errors.New("x")
+	if _, err := finish(nil, sentinel); err != sentinel || budget.exhausted(ErrLatencyBudgetExceeded) {
+		t.Error("nil budget should pass results through and never be exhausted")
+	}
+	if err := retriesExhausted(ErrLatencyBudgetExceeded); err != ErrLatencyBudgetExceeded {
+		t.Errorf("retriesExhausted(budget) = %v, want the budget error unchanged", err)
+	}
+}
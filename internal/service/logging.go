@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志输出格式
+const (
+	LogFormatText = "text" // 与 log 包相同的单行文本（默认）
+	LogFormatJSON = "json" // 每行一个 JSON 对象，便于 Loki / Datadog 等解析
+)
+
+var (
+	logLevel     = new(slog.LevelVar)
+	logFormat    = LogFormatText
+	logger       = slog.New(newTextLogHandler(os.Stderr, logLevel))
+	logBridgeOut io.Writer
+)
+
+// ConfigureLogging 按 LOG_LEVEL（debug/info/warn/error，DEBUG=true 时默认 debug，否则 info）和 LOG_FORMAT（text/json）
+// 配置日志；之后 log 包输出的每一行都按行首的 [WARN] 等标签确定级别，级别以下的丢弃，JSON 格式下行首的组件和 traceid 标签转为字段
+func ConfigureLogging(w io.Writer) {
+	level := slog.LevelInfo
+	if IsDebugMode() {
+		level = slog.LevelDebug
+	}
+	if raw := strings.TrimSpace(os.Getenv("LOG_LEVEL")); raw != "" {
+		if err := level.UnmarshalText([]byte(raw)); err != nil {
+			fmt.Fprintf(w, "[WARN] 无效的 LOG_LEVEL: %s，使用 %s\n", raw, level)
+		}
+	}
+	logLevel.Set(level)
+
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT")))
+	if format == LogFormatJSON {
+		logFormat = LogFormatJSON
+		logger = slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevel}))
+	} else {
+		if format != "" && format != LogFormatText {
+			fmt.Fprintf(w, "[WARN] 无效的 LOG_FORMAT: %s，使用 text\n", format)
+		}
+		logFormat = LogFormatText
+		logger = slog.New(newTextLogHandler(w, logLevel))
+	}
+	logBridgeOut = logBridge{}
+	log.SetFlags(0)
+	log.SetOutput(logBridgeOut)
+}
+
+// JSONLogging 是否以 JSON 输出日志
+func JSONLogging() bool {
+	return logFormat == LogFormatJSON
+}
+
+// LogWriter 返回 log 包使用的输出，gin 等直接写 io.Writer 的组件写入后同样按级别过滤并转换格式
+func LogWriter() io.Writer {
+	if logBridgeOut == nil {
+		return os.Stderr
+	}
+	return logBridgeOut
+}
+
+// logBridge 把 log 包的输出转给结构化日志
+type logBridge struct{}
+
+func (logBridge) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		level := logLineLevel(line)
+		if !logger.Enabled(context.Background(), level) {
+			continue
+		}
+		var attrs []slog.Attr
+		if JSONLogging() {
+			attrs = logLineTagFields(line)
+		}
+		logger.LogAttrs(context.Background(), level, line, attrs...)
+	}
+	return len(p), nil
+}
+
+var (
+	logTagPattern  = regexp.MustCompile(`^\[([^\]\s]+)\]\s*`)
+	traceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	logProviders   = map[string]bool{"anthropic": true, "openai": true, "gemini": true, "grok": true}
+	logLevelTags   = map[string]bool{"DEBUG": true, "INFO": true, "WARN": true, "WARNING": true, "ERROR": true, "FATAL": true}
+)
+
+// logLineTags 返回行首连续的 [xxx] 标签
+func logLineTags(line string) []string {
+	var tags []string
+	for {
+		m := logTagPattern.FindStringSubmatch(line)
+		if m == nil {
+			return tags
+		}
+		tags = append(tags, m[1])
+		line = line[len(m[0]):]
+	}
+}
+
+// logLineLevel 按行首的 [DEBUG]/[INFO]/[WARN]/[ERROR] 标签确定级别，没有级别标签的行为 INFO
+func logLineLevel(line string) slog.Level {
+	for _, tag := range logLineTags(line) {
+		switch strings.ToUpper(tag) {
+		case "DEBUG":
+			return slog.LevelDebug
+		case "INFO":
+			return slog.LevelInfo
+		case "WARN", "WARNING":
+			return slog.LevelWarn
+		case "ERROR", "FATAL":
+			return slog.LevelError
+		}
+	}
+	return slog.LevelInfo
+}
+
+// logLineTagFields 把行首的标签转为 component、provider、trace_id 字段，不解析消息正文
+func logLineTagFields(line string) []slog.Attr {
+	var attrs []slog.Attr
+	for _, tag := range logLineTags(line) {
+		switch {
+		case traceIDPattern.MatchString(tag):
+			attrs = append(attrs, slog.String("trace_id", tag))
+		case logProviders[strings.ToLower(tag)]:
+			attrs = append(attrs, slog.String("provider", strings.ToLower(tag)))
+		case logLevelTags[strings.ToUpper(tag)]:
+		default:
+			if !hasLogAttr(attrs, "component") {
+				attrs = append(attrs, slog.String("component", tag))
+			}
+		}
+	}
+	return attrs
+}
+
+func hasLogAttr(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeLogAttrs 在 base 后追加 extra 中 base 没有的字段
+func mergeLogAttrs(base []slog.Attr, extra ...slog.Attr) []slog.Attr {
+	for _, a := range extra {
+		if !hasLogAttr(base, a.Key) {
+			base = append(base, a)
+		}
+	}
+	return base
+}
+
+// LogEvent 在调用处按级别输出一条带字段的日志；traceid 取自 attrs 中的 trace_id，没有时取自请求上下文
+// JSON 格式下消息和字段分开输出；文本格式下与 log 包的行格式相同（[traceid] [级别] [组件] 消息），字段以 key=value 追加在末尾
+func LogEvent(ctx context.Context, level slog.Level, component, msg string, attrs ...slog.Attr) {
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	traceID := ""
+	for i, a := range attrs {
+		if a.Key == "trace_id" {
+			traceID = a.Value.String()
+			attrs = append(attrs[:i:i], attrs[i+1:]...)
+			break
+		}
+	}
+	if l := GetLogger(ctx); traceID == "" && l != nil {
+		traceID = l.TraceID()
+	}
+	if JSONLogging() {
+		base := []slog.Attr{slog.String("component", component)}
+		if provider := strings.ToLower(component); logProviders[provider] {
+			base = append(base, slog.String("provider", provider))
+		}
+		if traceID != "" {
+			base = append(base, slog.String("trace_id", traceID))
+		}
+		logger.LogAttrs(ctx, level, msg, mergeLogAttrs(attrs, base...)...)
+		return
+	}
+	prefix := ""
+	if traceID != "" {
+		prefix = "[" + traceID + "] "
+	}
+	if level != slog.LevelInfo {
+		prefix += "[" + level.String() + "] "
+	}
+	logger.LogAttrs(ctx, level, prefix+"["+component+"] "+msg, attrs...)
+}
+
+// logAccountID 账号 ID 字段
+func logAccountID(id uint) slog.Attr {
+	return slog.Uint64("account_id", uint64(id))
+}
+
+// logError 错误字段
+func logError(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// logUpstreamRequest 每次上游调用输出一条带固定字段的日志：成功为 DEBUG，失败为 WARN
+func logUpstreamRequest(ctx context.Context, provider, modelID string, accountID uint, status int, category string, latency time.Duration) {
+	level := slog.LevelDebug
+	if category != "" {
+		level = slog.LevelWarn
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("provider", provider),
+		slog.Uint64("account_id", uint64(accountID)),
+		slog.String("model", modelID),
+		slog.Int("status", status),
+		slog.Int64("latency_ms", latency.Milliseconds()),
+	}
+	if category != "" {
+		attrs = append(attrs, slog.String("error_type", category))
+	}
+	if l := GetLogger(ctx); l != nil {
+		attrs = append(attrs, slog.String("trace_id", l.TraceID()))
+	}
+	logger.LogAttrs(ctx, level, "upstream request", attrs...)
+}
+
+// textLogHandler 以 log 包的格式输出：时间 + 消息，结构化字段以 key=value 追加在末尾
+type textLogHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func newTextLogHandler(w io.Writer, level slog.Leveler) *textLogHandler {
+	return &textLogHandler{mu: new(sync.Mutex), w: w, level: level}
+}
+
+func (h *textLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textLogHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	b.WriteString(r.Message)
+	write := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *textLogHandler) WithGroup(string) slog.Handler {
+	return h
+}
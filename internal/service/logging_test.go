@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withJSONLogger 临时把日志改为输出到缓冲区的 JSON
+func withJSONLogger(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	savedLogger, savedFormat, savedLevel := logger, logFormat, logLevel.Level()
+	logLevel.Set(level)
+	logFormat = LogFormatJSON
+	logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: logLevel}))
+	t.Cleanup(func() {
+		logger, logFormat = savedLogger, savedFormat
+		logLevel.Set(savedLevel)
+	})
+	return &buf
+}
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid json %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogLineLevel(t *testing.T) {
+	for line, want := range map[string]slog.Level{
+		"[WARN] 无效的 LOG_LEVEL":                                  slog.LevelWarn,
+		"[0123456789abcdef0123456789abcdef] [DEBUG] [OpenAI] x": slog.LevelDebug,
+		"[WARN] [ProxyPool] 重新加载代理失败: timeout":                  slog.LevelWarn,
+		"[AdminJob] 任务完成: 成功 3 个, 失败 1 个":                       slog.LevelInfo,
+		"[AccountPool] 刷新完成":                                    slog.LevelInfo,
+		"[ERROR] [Stream] write failed":                         slog.LevelError,
+	} {
+		if got := logLineLevel(line); got != want {
+			t.Errorf("%q level = %s, want %s", line, got, want)
+		}
+	}
+}
+
+func TestLogBridgeJSONFields(t *testing.T) {
+	buf := withJSONLogger(t, slog.LevelInfo)
+	bridge := logBridge{}
+	const trace = "0123456789abcdef0123456789abcdef"
+
+	bridge.Write([]byte("[" + trace + "] [DEBUG] [Anthropic] ↻ 重试 #1: accountID=7, error=x\n"))
+	bridge.Write([]byte("[" + trace + "] [WARN] [Anthropic] ✗ 错误响应 [529]: overloaded\n[AccountPool] 账号 a@b.c (ID:12) 已冷却\n"))
+
+	records := decodeLogLines(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("records = %v", records)
+	}
+	first := records[0]
+	if first["level"] != "WARN" || first["trace_id"] != trace || first["provider"] != "anthropic" {
+		t.Errorf("first = %v", first)
+	}
+	// 消息正文不解析为字段
+	if _, ok := first["status"]; ok {
+		t.Errorf("status scraped from message: %v", first)
+	}
+	second := records[1]
+	if second["level"] != "INFO" || second["component"] != "AccountPool" {
+		t.Errorf("second = %v", second)
+	}
+}
+
+func TestLogEventAttrs(t *testing.T) {
+	buf := withJSONLogger(t, slog.LevelInfo)
+	requestLogger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), requestLogger)
+
+	LogEvent(ctx, slog.LevelWarn, "Anthropic", "代理请求失败", logAccountID(7), slog.Int("status", 429))
+	LogEvent(ctx, slog.LevelDebug, "Anthropic", "below level")
+	records := decodeLogLines(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("records = %v", records)
+	}
+	r := records[0]
+	if r["msg"] != "代理请求失败" || r["level"] != "WARN" || r["component"] != "Anthropic" || r["provider"] != "anthropic" ||
+		r["account_id"] != float64(7) || r["status"] != float64(429) || r["trace_id"] != requestLogger.TraceID() {
+		t.Errorf("record = %v", r)
+	}
+
+	// 文本格式与 log 包的行格式相同，显式的 trace_id 写在行首
+	var text bytes.Buffer
+	logger, logFormat = slog.New(newTextLogHandler(&text, logLevel)), LogFormatText
+	LogEvent(context.Background(), slog.LevelError, "OpenAI", "请求失败", slog.String("trace_id", "abc"), slog.Int("status", 500))
+	if got := text.String(); !strings.HasSuffix(got, " [abc] [ERROR] [OpenAI] 请求失败 status=500\n") {
+		t.Errorf("text = %q", got)
+	}
+}
+
+func TestRequestLoggerFlushKeepsAttrs(t *testing.T) {
+	buf := withJSONLogger(t, slog.LevelInfo)
+	requestLogger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), requestLogger)
+
+	DebugLogAccountSelected(ctx, "Anthropic", 5, "a@b.c")
+	DebugLogErrorResponse(ctx, "Anthropic", 529, "overloaded")
+	requestLogger.Flush()
+
+	records := decodeLogLines(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("records = %v", records)
+	}
+	// 缓冲的 DEBUG 日志在请求出错后按 WARN 输出，字段来自调用处
+	if r := records[0]; r["level"] != "WARN" || r["account_id"] != float64(5) || r["provider"] != "anthropic" || r["trace_id"] != requestLogger.TraceID() {
+		t.Errorf("first = %v", r)
+	}
+	if r := records[1]; r["level"] != "WARN" || r["status"] != float64(529) {
+		t.Errorf("second = %v", r)
+	}
+	if logs := requestLogger.texts(); logs[0] != "[DEBUG] [Anthropic] ✓ 选择账号: id=5, email=a@b.c" || !strings.HasPrefix(logs[1], "[WARN] ") {
+		t.Errorf("trace logs = %v", logs)
+	}
+}
+
+func TestLogUpstreamRequestFields(t *testing.T) {
+	buf := withJSONLogger(t, slog.LevelDebug)
+	requestLogger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), requestLogger)
+
+	logUpstreamRequest(ctx, "anthropic", "claude-sonnet-4-5-20250929", 3, 429, UpstreamErrorRate, 1500*time.Millisecond)
+	records := decodeLogLines(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("records = %v", records)
+	}
+	r := records[0]
+	if r["msg"] != "upstream request" || r["level"] != "WARN" || r["provider"] != "anthropic" || r["account_id"] != float64(3) ||
+		r["model"] != "claude-sonnet-4-5-20250929" || r["status"] != float64(429) || r["latency_ms"] != float64(1500) ||
+		r["error_type"] != UpstreamErrorRate || r["trace_id"] != requestLogger.TraceID() {
+		t.Errorf("record = %v", r)
+	}
+
+	// 成功的调用为 DEBUG，默认级别下不输出
+	buf.Reset()
+	logLevel.Set(slog.LevelInfo)
+	logUpstreamRequest(ctx, "anthropic", "claude-sonnet-4-5-20250929", 3, 200, "", time.Second)
+	if buf.Len() != 0 {
+		t.Errorf("debug record written: %s", buf.String())
+	}
+}
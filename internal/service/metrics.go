@@ -0,0 +1,151 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/classifier"
+)
+
+// OpenMetricsContentType /metrics 响应的 Content-Type
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var (
+	perAccountMetrics     bool
+	perAccountMetricsOnce sync.Once
+)
+
+// PerAccountMetricsEnabled 读取 METRICS_PER_ACCOUNT，账号多时标签基数较大，默认关闭
+func PerAccountMetricsEnabled() bool {
+	perAccountMetricsOnce.Do(func() {
+		v := strings.ToLower(strings.TrimSpace(os.Getenv("METRICS_PER_ACCOUNT")))
+		perAccountMetrics = v == "true" || v == "1"
+	})
+	return perAccountMetrics
+}
+
+// accountCreditRemaining 当日剩余积分，不小于 0
+func accountCreditRemaining(acc model.Account) float64 {
+	remaining := float64(model.PlanLimits[acc.PlanType]) - acc.DailyUsed
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// accountCooldownSeconds 距冷却结束的秒数，非冷却账号为 0
+func accountCooldownSeconds(acc model.Account, now time.Time) float64 {
+	if acc.Status != "cooling" || !acc.CoolingUntil.After(now) {
+		return 0
+	}
+	return acc.CoolingUntil.Sub(now).Seconds()
+}
+
+// emailHash 邮箱的短哈希，避免在指标中暴露邮箱
+func emailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// WriteMetrics 以 OpenMetrics 文本格式输出号池指标
+// 汇总指标始终输出，perAccount 为 true 时额外输出每个账号的剩余积分、冷却时间和上游失败分类
+func WriteMetrics(w io.Writer, accounts []model.Account, perAccount bool, now time.Time) {
+	statusCounts := map[string]int{"normal": 0, "cooling": 0, "banned": 0, "error": 0, "disabled": 0}
+	var remaining float64
+	for _, acc := range accounts {
+		statusCounts[acc.Status]++
+		if acc.Status == "normal" {
+			remaining += accountCreditRemaining(acc)
+		}
+	}
+
+	statuses := make([]string, 0, len(statusCounts))
+	for status := range statusCounts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	fmt.Fprintln(w, "# TYPE zencoder_accounts gauge")
+	fmt.Fprintln(w, "# HELP zencoder_accounts Number of accounts by status.")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "zencoder_accounts{status=%q} %d\n", status, statusCounts[status])
+	}
+	fmt.Fprintln(w, "# TYPE zencoder_pool_credit_remaining gauge")
+	fmt.Fprintln(w, "# HELP zencoder_pool_credit_remaining Remaining daily credits across normal accounts.")
+	fmt.Fprintf(w, "zencoder_pool_credit_remaining %g\n", remaining)
+
+	if perAccount {
+		fmt.Fprintln(w, "# TYPE zencoder_account_credit_remaining gauge")
+		fmt.Fprintln(w, "# HELP zencoder_account_credit_remaining Remaining daily credits per account.")
+		for _, acc := range accounts {
+			fmt.Fprintf(w, "zencoder_account_credit_remaining{%s} %g\n", accountLabels(acc), accountCreditRemaining(acc))
+		}
+		fmt.Fprintln(w, "# TYPE zencoder_account_cooldown_seconds gauge")
+		fmt.Fprintln(w, "# HELP zencoder_account_cooldown_seconds Seconds until the account leaves cooling.")
+		for _, acc := range accounts {
+			fmt.Fprintf(w, "zencoder_account_cooldown_seconds{%s} %g\n", accountLabels(acc), accountCooldownSeconds(acc, now))
+		}
+	}
+	writeUpstreamErrorMetrics(w, GetUpstreamErrorStats(), perAccount)
+	writeCacheAffinityMetrics(w, GetCacheAffinityStats())
+	writeInputTokenMetrics(w)
+	writeServiceTierMetrics(w)
+	writeFederationMetrics(w)
+	writeModelRouterMetrics(w)
+	writePoolReservationMetrics(w)
+	writeDatabaseMetrics(w, database.GetHealth())
+	writeClassifierMetrics(w, classifier.Hits())
+	writeStreamFailoverMetrics(w, GetStreamFailoverCounts())
+	writeSlowClientMetrics(w, GetSlowClientCounts())
+	writeStreamKeepAliveMetrics(w)
+	writeProxyHealthMetrics(w)
+	writeUsageAnomalyMetrics(w)
+	fmt.Fprintln(w, "# TYPE zencoder_realtime_sessions gauge")
+	fmt.Fprintln(w, "# HELP zencoder_realtime_sessions Open WebSocket connections proxied through /v1/realtime; each holds one account.")
+	fmt.Fprintf(w, "zencoder_realtime_sessions %d\n", ActiveRealtimeSessions())
+	fmt.Fprintln(w, "# EOF")
+}
+
+func writeDatabaseMetrics(w io.Writer, health database.HealthStatus) {
+	up := 0
+	if health.Healthy {
+		up = 1
+	}
+	fmt.Fprintln(w, "# TYPE zencoder_database_up gauge")
+	fmt.Fprintln(w, "# HELP zencoder_database_up Whether the database is reachable; 0 means the pool is serving from its in-memory snapshot.")
+	fmt.Fprintf(w, "zencoder_database_up %d\n", up)
+	fmt.Fprintln(w, "# TYPE zencoder_database_queued_mutations gauge")
+	fmt.Fprintln(w, "# HELP zencoder_database_queued_mutations Writes queued while the database is unavailable.")
+	fmt.Fprintf(w, "zencoder_database_queued_mutations %d\n", health.QueuedMutations)
+	if health.ReadReplica != nil {
+		replicaUp := 0
+		if *health.ReadReplica {
+			replicaUp = 1
+		}
+		fmt.Fprintln(w, "# TYPE zencoder_database_read_replica_up gauge")
+		fmt.Fprintln(w, "# HELP zencoder_database_read_replica_up Whether the read replica is reachable; 0 means admin queries fall back to the primary.")
+		fmt.Fprintf(w, "zencoder_database_read_replica_up %d\n", replicaUp)
+	}
+}
+
+// writeClassifierMetrics 输出 Anthropic 错误分类规则的命中次数，unknown 上升通常意味着上游改了错误文案
+func writeClassifierMetrics(w io.Writer, hits []classifier.Hit) {
+	fmt.Fprintln(w, "# TYPE zencoder_anthropic_error_class counter")
+	fmt.Fprintln(w, "# HELP zencoder_anthropic_error_class Anthropic upstream error responses by status and classifier rule.")
+	for _, h := range hits {
+		fmt.Fprintf(w, "zencoder_anthropic_error_class_total{status=\"%d\",class=%q} %d\n", h.Status, h.Class, h.Count)
+	}
+}
+
+func accountLabels(acc model.Account) string {
+	return fmt.Sprintf("account_id=\"%d\",email_hash=%q,plan=%q", acc.ID, emailHash(acc.Email), acc.PlanType)
+}
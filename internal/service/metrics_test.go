@@ -0,0 +1,50 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	now := time.Now()
+	accounts := []model.Account{
+		{ID: 1, Email: "a@example.com", PlanType: model.PlanMax, Status: "normal", DailyUsed: 200},
+		{ID: 2, Email: "b@example.com", PlanType: model.PlanFree, Status: "cooling", DailyUsed: 40, CoolingUntil: now.Add(90 * time.Second)},
+	}
+
+	var aggregate strings.Builder
+	WriteMetrics(&aggregate, accounts, false, now)
+	out := aggregate.String()
+	for _, want := range []string{
+		`zencoder_accounts{status="normal"} 1`,
+		`zencoder_accounts{status="cooling"} 1`,
+		"zencoder_pool_credit_remaining 4000\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "zencoder_account_credit_remaining") || !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("unexpected aggregate output:\n%s", out)
+	}
+
+	var detailed strings.Builder
+	WriteMetrics(&detailed, accounts, true, now)
+	out = detailed.String()
+	hash := emailHash("b@example.com")
+	for _, want := range []string{
+		`zencoder_account_credit_remaining{account_id="1",email_hash="` + emailHash("a@example.com") + `",plan="Max"} 4000`,
+		`zencoder_account_credit_remaining{account_id="2",email_hash="` + hash + `",plan="Free"} 0`,
+		`zencoder_account_cooldown_seconds{account_id="2",email_hash="` + hash + `",plan="Free"} 90`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "b@example.com") {
+		t.Error("email leaked into metrics")
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// maxModelAliasLength 别名和目标模型名的最大长度，与表字段一致
+const maxModelAliasLength = 128
+
+var (
+	modelAliasMu sync.RWMutex
+	modelAliases = make(map[string]string) // 启用的别名 -> 目标模型
+)
+
+// LoadModelAliases 从数据库加载启用的模型别名到内存，启动时和每次修改后调用
+func LoadModelAliases() error {
+	var aliases []model.ModelAlias
+	if err := database.GetDB().Where("enabled = ?", true).Find(&aliases).Error; err != nil {
+		return err
+	}
+	loaded := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		loaded[a.Alias] = a.Target
+	}
+	modelAliasMu.Lock()
+	modelAliases = loaded
+	modelAliasMu.Unlock()
+	return nil
+}
+
+// ResolveModelAlias 返回别名对应的目标模型，不是别名时返回 false；只解析一层，目标不会再次按别名改写
+func ResolveModelAlias(name string) (string, bool) {
+	modelAliasMu.RLock()
+	defer modelAliasMu.RUnlock()
+	target, ok := modelAliases[name]
+	return target, ok
+}
+
+// applyModelAliasRequest 校验请求并写入别名的可修改字段
+func applyModelAliasRequest(alias *model.ModelAlias, req model.ModelAliasRequest) error {
+	name := strings.TrimSpace(req.Alias)
+	target := strings.TrimSpace(req.Target)
+	if name == "" || target == "" {
+		return invalidRequest("alias and target are required")
+	}
+	if len(name) > maxModelAliasLength || len(target) > maxModelAliasLength {
+		return invalidRequest("alias and target must not exceed %d characters", maxModelAliasLength)
+	}
+	if name == target {
+		return invalidRequest("alias %s must differ from its target", name)
+	}
+	if _, ok := model.GetZenModel(target); !ok {
+		return invalidRequest("unknown target model: %s", target)
+	}
+	alias.Alias = name
+	alias.Target = target
+	alias.Enabled = req.Enabled == nil || *req.Enabled
+	return nil
+}
+
+// ListModelAliases 返回全部模型别名
+func ListModelAliases() ([]model.ModelAlias, error) {
+	var aliases []model.ModelAlias
+	err := database.GetDB().Order("alias").Find(&aliases).Error
+	return aliases, err
+}
+
+// CreateModelAlias 创建模型别名，别名已存在时返回 *InvalidRequestError
+func CreateModelAlias(req model.ModelAliasRequest) (*model.ModelAlias, error) {
+	var alias model.ModelAlias
+	if err := applyModelAliasRequest(&alias, req); err != nil {
+		return nil, err
+	}
+	if err := checkModelAliasUnique(alias.Alias, 0); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Create(&alias).Error; err != nil {
+		return nil, err
+	}
+	reloadModelAliases()
+	return &alias, nil
+}
+
+// UpdateModelAlias 修改模型别名的名称、目标模型和启用状态
+func UpdateModelAlias(id uint, req model.ModelAliasRequest) (*model.ModelAlias, error) {
+	var alias model.ModelAlias
+	if err := database.GetDB().First(&alias, id).Error; err != nil {
+		return nil, err
+	}
+	if err := applyModelAliasRequest(&alias, req); err != nil {
+		return nil, err
+	}
+	if err := checkModelAliasUnique(alias.Alias, alias.ID); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Save(&alias).Error; err != nil {
+		return nil, err
+	}
+	reloadModelAliases()
+	return &alias, nil
+}
+
+// DeleteModelAlias 删除模型别名
+func DeleteModelAlias(id uint) error {
+	result := database.GetDB().Delete(&model.ModelAlias{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	reloadModelAliases()
+	return nil
+}
+
+// checkModelAliasUnique 别名已被其他记录使用时返回 *InvalidRequestError
+func checkModelAliasUnique(name string, id uint) error {
+	var count int64
+	if err := database.GetDB().Model(&model.ModelAlias{}).Where("alias = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return invalidRequest("alias %s already exists", name)
+	}
+	return nil
+}
+
+func reloadModelAliases() {
+	if err := LoadModelAliases(); err != nil {
+		log.Printf("[WARN] [ModelAlias] 重新加载模型别名失败: %v", err)
+	}
+}
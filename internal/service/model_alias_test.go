@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestModelAliasLifecycle(t *testing.T) {
+	initTestDB(t, "aliases.db")
+	t.Cleanup(func() { modelAliases = make(map[string]string) })
+
+	var invalid *InvalidRequestError
+	for _, req := range []model.ModelAliasRequest{
+		{Alias: "gpt-4o"},
+		{Alias: "gpt-4o", Target: "missing-model"},
+		{Alias: "gpt-5.1-codex", Target: "gpt-5.1-codex"},
+	} {
+		if _, err := CreateModelAlias(req); !errors.As(err, &invalid) {
+			t.Errorf("CreateModelAlias(%+v) = %v, want *InvalidRequestError", req, err)
+		}
+	}
+
+	alias, err := CreateModelAlias(model.ModelAliasRequest{Alias: " gpt-4o ", Target: "gpt-5.1-codex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, ok := ResolveModelAlias("gpt-4o"); !ok || target != "gpt-5.1-codex" || !alias.Enabled {
+		t.Fatalf("ResolveModelAlias(gpt-4o) = %q, %v; alias = %+v", target, ok, alias)
+	}
+	if _, err := CreateModelAlias(model.ModelAliasRequest{Alias: "gpt-4o", Target: "claude-sonnet-4-5-20250929"}); !errors.As(err, &invalid) {
+		t.Errorf("duplicate alias = %v, want *InvalidRequestError", err)
+	}
+
+	// 只解析一层：目标本身也是别名时不继续改写
+	if _, err := CreateModelAlias(model.ModelAliasRequest{Alias: "gpt-5.1-codex", Target: "claude-sonnet-4-5-20250929"}); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := ResolveModelAlias("gpt-4o"); target != "gpt-5.1-codex" {
+		t.Errorf("ResolveModelAlias(gpt-4o) = %q, want a single hop", target)
+	}
+
+	disabled := false
+	if _, err := UpdateModelAlias(alias.ID, model.ModelAliasRequest{Alias: "gpt-4o", Target: "gpt-5.1-codex", Enabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ResolveModelAlias("gpt-4o"); ok {
+		t.Error("disabled alias should not resolve")
+	}
+	if _, err := UpdateModelAlias(9999, model.ModelAliasRequest{Alias: "x", Target: "gpt-5.1-codex"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("UpdateModelAlias(missing) = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := DeleteModelAlias(alias.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteModelAlias(alias.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("second delete = %v, want ErrRecordNotFound", err)
+	}
+	aliases, err := ListModelAliases()
+	if err != nil || len(aliases) != 1 || aliases[0].Alias != "gpt-5.1-codex" {
+		t.Errorf("ListModelAliases = %+v, %v", aliases, err)
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 模型注册表的来源
+const (
+	ModelRegistryDatabase = "database" // 数据库中的模型注册表
+	ModelRegistryDefault  = "default"  // 数据库中没有记录，使用编译时的默认模型表
+)
+
+// maxModelNameLength 模型名的最大长度，与表字段一致
+const maxModelNameLength = 128
+
+// LoadModelRegistry 从数据库加载模型注册表并重建模型表，表为空时回退到编译时的默认模型表；
+// 启动时和每次修改后调用，多实例部署时可通过 POST /api/models/reload 手动重新加载
+func LoadModelRegistry() error {
+	var records []model.ModelRecord
+	if err := database.GetDB().Find(&records).Error; err != nil {
+		return err
+	}
+	models := make(map[string]model.ZenModel, len(records))
+	for _, r := range records {
+		m, err := r.ZenModel()
+		if err != nil {
+			log.Printf("[ModelRegistry] 模型 %s 的配置无法解析，已跳过: %v", r.Name, err)
+			continue
+		}
+		models[r.Name] = m
+	}
+	model.SetRegistryModels(models)
+	GetModelSyncService().Reload()
+	if len(models) > 0 {
+		log.Printf("[ModelRegistry] 已加载数据库中的 %d 个模型", len(models))
+	}
+	return nil
+}
+
+// ListModelRegistry 返回模型注册表和来源，数据库中没有记录时返回编译时的默认模型表
+func ListModelRegistry() ([]model.ModelRegistryEntry, string, error) {
+	var records []model.ModelRecord
+	if err := database.GetDB().Order("name").Find(&records).Error; err != nil {
+		return nil, "", err
+	}
+	if len(records) == 0 {
+		builtin := model.BuiltinZenModels()
+		entries := make([]model.ModelRegistryEntry, 0, len(builtin))
+		for name, m := range builtin {
+			entries = append(entries, model.ModelRegistryEntry{Name: name, ZenModel: m})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		return entries, ModelRegistryDefault, nil
+	}
+
+	entries := make([]model.ModelRegistryEntry, 0, len(records))
+	for _, r := range records {
+		m, err := r.ZenModel()
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, model.ModelRegistryEntry{Name: r.Name, ZenModel: m})
+	}
+	return entries, ModelRegistryDatabase, nil
+}
+
+// validateModelRegistryEntry 校验并规范化注册表条目，弃用计划由弃用接口单独管理，这里忽略
+func validateModelRegistryEntry(entry *model.ModelRegistryEntry) error {
+	entry.Name = strings.TrimSpace(entry.Name)
+	entry.ID = strings.TrimSpace(entry.ID)
+	entry.Model = strings.TrimSpace(entry.Model)
+	entry.ProviderID = strings.ToLower(strings.TrimSpace(entry.ProviderID))
+	entry.Deprecation = nil
+	switch {
+	case entry.Name == "":
+		return invalidRequest("name is required")
+	case len(entry.Name) > maxModelNameLength || len(entry.ID) > maxModelNameLength || len(entry.Model) > maxModelNameLength:
+		return invalidRequest("name, id and model must not exceed %d characters", maxModelNameLength)
+	case entry.ID == "" || entry.Model == "":
+		return invalidRequest("id and model are required")
+	case !knownProviders[entry.ProviderID]:
+		return invalidRequest("unknown providerId: %s", entry.ProviderID)
+	case entry.Multiplier < 0:
+		return invalidRequest("multiplier must not be negative")
+	case entry.Type != "" && entry.Type != model.ModelTypeEmbedding:
+		return invalidRequest("type must be empty or %s", model.ModelTypeEmbedding)
+	}
+	if entry.Parameters != nil {
+		if err := validateParameterPolicy(entry.Parameters.ParameterPolicy); err != nil {
+			return err
+		}
+	}
+	if entry.DisplayName == "" {
+		entry.DisplayName = entry.Name
+	}
+	return nil
+}
+
+// seedModelRegistry 表为空时先写入编译时的默认模型表，避免第一次修改后其余默认模型全部消失
+func seedModelRegistry(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Model(&model.ModelRecord{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	for name, m := range model.BuiltinZenModels() {
+		record, err := model.NewModelRecord(name, m)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+	}
+	log.Printf("[ModelRegistry] 已把编译时的默认模型表写入数据库")
+	return nil
+}
+
+// CreateModelRegistryEntry 向模型注册表添加模型，模型名已存在时返回 *InvalidRequestError
+func CreateModelRegistryEntry(entry model.ModelRegistryEntry) error {
+	if err := validateModelRegistryEntry(&entry); err != nil {
+		return err
+	}
+	record, err := model.NewModelRecord(entry.Name, entry.ZenModel)
+	if err != nil {
+		return err
+	}
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := seedModelRegistry(tx); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&model.ModelRecord{}).Where("name = ?", entry.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return invalidRequest("model %s already exists", entry.Name)
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return err
+	}
+	reloadModelRegistry()
+	return nil
+}
+
+// UpdateModelRegistryEntry 整体替换模型注册表中的模型配置，模型不存在时返回 gorm.ErrRecordNotFound
+func UpdateModelRegistryEntry(name string, entry model.ModelRegistryEntry) error {
+	entry.Name = name
+	if err := validateModelRegistryEntry(&entry); err != nil {
+		return err
+	}
+	record, err := model.NewModelRecord(entry.Name, entry.ZenModel)
+	if err != nil {
+		return err
+	}
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := seedModelRegistry(tx); err != nil {
+			return err
+		}
+		var existing model.ModelRecord
+		if err := tx.Where("name = ?", entry.Name).First(&existing).Error; err != nil {
+			return err
+		}
+		record.ID = existing.ID
+		record.CreatedAt = existing.CreatedAt
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return err
+	}
+	reloadModelRegistry()
+	return nil
+}
+
+// DeleteModelRegistryEntry 从模型注册表删除模型，删除最后一个模型后回退到编译时的默认模型表
+func DeleteModelRegistryEntry(name string) error {
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := seedModelRegistry(tx); err != nil {
+			return err
+		}
+		result := tx.Where("name = ?", name).Delete(&model.ModelRecord{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	reloadModelRegistry()
+	return nil
+}
+
+func reloadModelRegistry() {
+	if err := LoadModelRegistry(); err != nil {
+		log.Printf("[WARN] [ModelRegistry] 重新加载模型注册表失败: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestBuildDynamicModelMapKeepsRegistryModels(t *testing.T) {
+	defer model.SetRegistryModels(nil)
+	model.SetRegistryModels(map[string]model.ZenModel{
+		"custom-model": {ID: "custom", Model: "custom-model", Multiplier: 2, ProviderID: "openai"},
+	})
+
+	models := buildDynamicModelMap([]modelDescriptor{{ID: "gpt-5.1-codex", OwnedBy: "openai"}})
+	if m, ok := models["custom-model"]; !ok || m.Multiplier != 2 {
+		t.Errorf("registry model missing after sync: %+v", models)
+	}
+	if _, ok := models["gpt-5.1-codex"]; !ok {
+		t.Error("upstream model missing after sync")
+	}
+}
+
+func TestModelRegistryLifecycle(t *testing.T) {
+	initTestDB(t, "registry.db")
+	t.Cleanup(func() {
+		model.SetRegistryModels(nil)
+		model.ResetZenModelsToDefault()
+	})
+
+	if _, source, err := ListModelRegistry(); err != nil || source != ModelRegistryDefault {
+		t.Fatalf("empty registry source = %q, %v", source, err)
+	}
+
+	var invalid *InvalidRequestError
+	for _, entry := range []model.ModelRegistryEntry{
+		{Name: "new-model", ZenModel: model.ZenModel{ID: "new", Model: "new-model", ProviderID: "unknown"}},
+		{Name: "new-model", ZenModel: model.ZenModel{Model: "new-model", ProviderID: "openai"}},
+		{Name: "new-model", ZenModel: model.ZenModel{ID: "new", Model: "new-model", ProviderID: "openai", Multiplier: -1}},
+	} {
+		if err := CreateModelRegistryEntry(entry); !errors.As(err, &invalid) {
+			t.Errorf("CreateModelRegistryEntry(%+v) = %v, want *InvalidRequestError", entry, err)
+		}
+	}
+
+	// 第一次写入时把默认模型表写入数据库，其余默认模型继续可用
+	temp := 0.5
+	err := CreateModelRegistryEntry(model.ModelRegistryEntry{Name: "new-model", ZenModel: model.ZenModel{
+		ID: "new", Model: "new-model", ProviderID: "openai", Multiplier: 2,
+		Parameters: &model.ModelParameters{Temperature: &temp},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := model.GetZenModel("new-model"); !ok || m.Multiplier != 2 || *m.Parameters.Temperature != 0.5 {
+		t.Fatalf("new model not loaded: %+v", m)
+	}
+	if _, ok := model.GetZenModel("claude-sonnet-4-5-20250929"); !ok {
+		t.Error("compiled defaults should be seeded on the first write")
+	}
+	if err := CreateModelRegistryEntry(model.ModelRegistryEntry{Name: "new-model", ZenModel: model.ZenModel{ID: "new", Model: "new-model", ProviderID: "openai"}}); !errors.As(err, &invalid) {
+		t.Errorf("duplicate model = %v, want *InvalidRequestError", err)
+	}
+
+	err = UpdateModelRegistryEntry("new-model", model.ModelRegistryEntry{ZenModel: model.ZenModel{
+		ID: "new", Model: "new-model", ProviderID: "openai", Multiplier: 3, PremiumOnly: true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := model.GetZenModel("new-model"); m.Multiplier != 3 || !m.PremiumOnly || m.Parameters != nil {
+		t.Errorf("update not applied: %+v", m)
+	}
+	if err := UpdateModelRegistryEntry("missing", model.ModelRegistryEntry{ZenModel: model.ZenModel{ID: "x", Model: "x", ProviderID: "openai"}}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("update missing = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := DeleteModelRegistryEntry("new-model"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := model.GetZenModel("new-model"); ok {
+		t.Error("deleted model should be unavailable")
+	}
+	if _, source, _ := ListModelRegistry(); source != ModelRegistryDatabase {
+		t.Errorf("source = %q, want %q", source, ModelRegistryDatabase)
+	}
+}
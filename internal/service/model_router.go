@@ -0,0 +1,247 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/model"
+)
+
+// 路由原因，同时用作指标标签
+const (
+	ModelRouteTools      = "tools"       // 请求带 tools
+	ModelRouteKeyword    = "keyword"     // 最后一条用户消息包含关键词
+	ModelRouteLargeInput = "large_input" // 估算输入超过小模型上限
+	ModelRouteSmallInput = "small_input" // 以上都不满足
+)
+
+// defaultModelRouterKeywords 默认视为复杂任务的关键词
+var defaultModelRouterKeywords = []string{"refactor", "architecture", "design", "debug", "analyze", "optimize", "重构", "架构", "设计", "调试", "分析", "优化"}
+
+// ModelRouterSettings 伪模型的路由规则：请求伪模型时按输入大小、tools 和关键词改写为小模型或大模型
+type ModelRouterSettings struct {
+	Name           string   `json:"name"`             // 伪模型名，为空表示关闭
+	SmallModel     string   `json:"small_model"`      // 简单请求使用的模型
+	LargeModel     string   `json:"large_model"`      // 复杂请求使用的模型
+	MaxSmallTokens int      `json:"max_small_tokens"` // 估算输入超过该值时使用大模型，0 表示不按输入大小判断
+	ToolsUseLarge  bool     `json:"tools_use_large"`  // 带 tools 的请求使用大模型
+	Keywords       []string `json:"keywords"`         // 最后一条用户消息包含任一关键词（不区分大小写）时使用大模型
+}
+
+// ModelRoute 一次路由的结果
+type ModelRoute struct {
+	Model  string
+	Reason string
+}
+
+var (
+	modelRouterMu       sync.RWMutex
+	modelRouterSettings ModelRouterSettings
+	modelRouterOnce     sync.Once
+
+	modelRouterStatsMu sync.Mutex
+	modelRouterStats   = make(map[ModelRoute]uint64)
+)
+
+// loadModelRouterSettings 读取 MODEL_ROUTER_* 环境变量，MODEL_ROUTER_NAME=none 表示关闭
+func loadModelRouterSettings() {
+	settings := ModelRouterSettings{
+		Name:           strings.TrimSpace(os.Getenv("MODEL_ROUTER_NAME")),
+		SmallModel:     strings.TrimSpace(os.Getenv("MODEL_ROUTER_SMALL_MODEL")),
+		LargeModel:     strings.TrimSpace(os.Getenv("MODEL_ROUTER_LARGE_MODEL")),
+		MaxSmallTokens: envPositiveInt("MODEL_ROUTER_SMALL_MAX_TOKENS", 4000),
+		ToolsUseLarge:  strings.ToLower(strings.TrimSpace(os.Getenv("MODEL_ROUTER_TOOLS_LARGE"))) != "false",
+		Keywords:       envList("MODEL_ROUTER_KEYWORDS"),
+	}
+	switch {
+	case settings.Name == "":
+		settings.Name = "zen-auto"
+	case strings.EqualFold(settings.Name, "none"):
+		settings.Name = ""
+	}
+	if settings.SmallModel == "" {
+		settings.SmallModel = "claude-haiku-4-5-20251001"
+	}
+	if settings.LargeModel == "" {
+		settings.LargeModel = "claude-sonnet-4-5-20250929"
+	}
+	if len(settings.Keywords) == 0 {
+		settings.Keywords = append([]string(nil), defaultModelRouterKeywords...)
+	}
+	modelRouterSettings = settings
+}
+
+// GetModelRouterSettings 获取伪模型的路由规则
+func GetModelRouterSettings() ModelRouterSettings {
+	modelRouterOnce.Do(loadModelRouterSettings)
+	modelRouterMu.RLock()
+	defer modelRouterMu.RUnlock()
+	settings := modelRouterSettings
+	settings.Keywords = append([]string{}, settings.Keywords...)
+	return settings
+}
+
+// SetModelRouterSettings 运行时修改路由规则（仅内存生效）
+func SetModelRouterSettings(settings ModelRouterSettings) error {
+	settings.Name = strings.TrimSpace(settings.Name)
+	settings.SmallModel = strings.TrimSpace(settings.SmallModel)
+	settings.LargeModel = strings.TrimSpace(settings.LargeModel)
+	if settings.MaxSmallTokens < 0 {
+		return fmt.Errorf("max_small_tokens 不能为负数")
+	}
+	if settings.Name != "" {
+		if _, ok := model.GetZenModel(settings.Name); ok {
+			return fmt.Errorf("name %s 与已有模型重名", settings.Name)
+		}
+		for _, target := range []string{settings.SmallModel, settings.LargeModel} {
+			if _, ok := model.GetZenModel(target); !ok {
+				return fmt.Errorf("未知的模型: %s", target)
+			}
+		}
+	}
+	keywords := make([]string, 0, len(settings.Keywords))
+	for _, k := range settings.Keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	settings.Keywords = keywords
+
+	modelRouterOnce.Do(loadModelRouterSettings)
+	modelRouterMu.Lock()
+	modelRouterSettings = settings
+	modelRouterMu.Unlock()
+	log.Printf("[ModelRouter] 路由规则已更新: %s -> %s / %s", settings.Name, settings.SmallModel, settings.LargeModel)
+	return nil
+}
+
+// IsRouterModel 模型名是否为启用中的伪模型
+func IsRouterModel(name string) bool {
+	settings := GetModelRouterSettings()
+	return settings.Name != "" && name == settings.Name
+}
+
+// RouteModel 按请求体为伪模型选择实际模型，依次检查 tools、关键词和估算的输入大小，并计入路由统计；
+// 请求体可以是 OpenAI、Anthropic、Responses 或 Gemini 格式
+func RouteModel(body []byte) ModelRoute {
+	settings := GetModelRouterSettings()
+	route := ModelRoute{Model: settings.SmallModel, Reason: ModelRouteSmallInput}
+
+	var req struct {
+		Tools    json.RawMessage   `json:"tools"`
+		Messages []json.RawMessage `json:"messages"`
+		Input    json.RawMessage   `json:"input"`
+		Contents []json.RawMessage `json:"contents"`
+	}
+	json.Unmarshal(body, &req)
+
+	switch {
+	case settings.ToolsUseLarge && hasTools(req.Tools):
+		route = ModelRoute{Model: settings.LargeModel, Reason: ModelRouteTools}
+	case containsKeyword(lastUserText(req.Messages, req.Input, req.Contents), settings.Keywords):
+		route = ModelRoute{Model: settings.LargeModel, Reason: ModelRouteKeyword}
+	case settings.MaxSmallTokens > 0 && estimateTokens(body) > settings.MaxSmallTokens:
+		route = ModelRoute{Model: settings.LargeModel, Reason: ModelRouteLargeInput}
+	}
+
+	modelRouterStatsMu.Lock()
+	modelRouterStats[route]++
+	modelRouterStatsMu.Unlock()
+	return route
+}
+
+func hasTools(raw json.RawMessage) bool {
+	var tools []json.RawMessage
+	return json.Unmarshal(raw, &tools) == nil && len(tools) > 0
+}
+
+func containsKeyword(text string, keywords []string) bool {
+	if text == "" {
+		return false
+	}
+	text = strings.ToLower(text)
+	for _, k := range keywords {
+		if strings.Contains(text, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastUserText 取出最后一条用户消息的文本：messages（OpenAI/Anthropic）、input（Responses）或 contents（Gemini）
+func lastUserText(messages []json.RawMessage, input json.RawMessage, contents []json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return text
+	}
+	var items []json.RawMessage
+	json.Unmarshal(input, &items)
+	for _, list := range [][]json.RawMessage{messages, items, contents} {
+		for i := len(list) - 1; i >= 0; i-- {
+			var msg struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+				Parts   json.RawMessage `json:"parts"`
+			}
+			if json.Unmarshal(list[i], &msg) != nil || msg.Role != "user" {
+				continue
+			}
+			if len(msg.Parts) > 0 {
+				return contentText(msg.Parts)
+			}
+			return contentText(msg.Content)
+		}
+	}
+	return ""
+}
+
+// contentText 拼接字符串内容或内容片段中的 text
+func contentText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(raw, &parts)
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func writeModelRouterMetrics(w io.Writer) {
+	modelRouterStatsMu.Lock()
+	routes := make([]ModelRoute, 0, len(modelRouterStats))
+	counts := make(map[ModelRoute]uint64, len(modelRouterStats))
+	for route, n := range modelRouterStats {
+		routes = append(routes, route)
+		counts[route] = n
+	}
+	modelRouterStatsMu.Unlock()
+	if len(routes) == 0 {
+		return
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Model != routes[j].Model {
+			return routes[i].Model < routes[j].Model
+		}
+		return routes[i].Reason < routes[j].Reason
+	})
+
+	fmt.Fprintln(w, "# TYPE zencoder_model_router_total counter")
+	fmt.Fprintln(w, "# HELP zencoder_model_router_total Requests for the router pseudo-model, by the real model chosen and the reason.")
+	for _, route := range routes {
+		fmt.Fprintf(w, "zencoder_model_router_total{model=%q,reason=%q} %d\n", route.Model, route.Reason, counts[route])
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRouteModel(t *testing.T) {
+	defer SetModelRouterSettings(GetModelRouterSettings())
+	if err := SetModelRouterSettings(ModelRouterSettings{
+		Name:           "zen-auto",
+		SmallModel:     "claude-haiku-4-5-20251001",
+		LargeModel:     "claude-sonnet-4-5-20250929",
+		MaxSmallTokens: 100,
+		ToolsUseLarge:  true,
+		Keywords:       []string{"Refactor"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want ModelRoute
+	}{
+		{"small", `{"model":"zen-auto","messages":[{"role":"user","content":"hi"}]}`, ModelRoute{"claude-haiku-4-5-20251001", ModelRouteSmallInput}},
+		{"tools", `{"model":"zen-auto","tools":[{"name":"read"}],"messages":[{"role":"user","content":"hi"}]}`, ModelRoute{"claude-sonnet-4-5-20250929", ModelRouteTools}},
+		{"keyword in last user message", `{"messages":[{"role":"user","content":"refactor"},{"role":"assistant","content":"ok"},{"role":"user","content":[{"type":"text","text":"please REFACTOR this"}]}]}`, ModelRoute{"claude-sonnet-4-5-20250929", ModelRouteKeyword}},
+		{"keyword only in earlier message", `{"messages":[{"role":"user","content":"refactor"},{"role":"user","content":"thanks"}]}`, ModelRoute{"claude-haiku-4-5-20251001", ModelRouteSmallInput}},
+		{"responses input", `{"input":"refactor the parser"}`, ModelRoute{"claude-sonnet-4-5-20250929", ModelRouteKeyword}},
+		{"gemini contents", `{"contents":[{"role":"user","parts":[{"text":"refactor"}]}]}`, ModelRoute{"claude-sonnet-4-5-20250929", ModelRouteKeyword}},
+		{"large input", `{"messages":[{"role":"user","content":"` + strings.Repeat("a", 500) + `"}]}`, ModelRoute{"claude-sonnet-4-5-20250929", ModelRouteLargeInput}},
+	}
+	for _, tt := range tests {
+		if got := RouteModel([]byte(tt.body)); got != tt.want {
+			t.Errorf("%s: route = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	writeModelRouterMetrics(&buf)
+	if !strings.Contains(buf.String(), `zencoder_model_router_total{model="claude-sonnet-4-5-20250929",reason="keyword"}`) {
+		t.Errorf("metrics = %s", buf.String())
+	}
+}
+
+func TestSetModelRouterSettingsValidates(t *testing.T) {
+	defer SetModelRouterSettings(GetModelRouterSettings())
+	base := GetModelRouterSettings()
+
+	settings := base
+	settings.Name = "claude-sonnet-4-5-20250929"
+	if err := SetModelRouterSettings(settings); err == nil {
+		t.Error("name shadowing a real model accepted")
+	}
+	settings = base
+	settings.LargeModel = "no-such-model"
+	if err := SetModelRouterSettings(settings); err == nil {
+		t.Error("unknown large model accepted")
+	}
+
+	settings = base
+	settings.Name = ""
+	if err := SetModelRouterSettings(settings); err != nil || IsRouterModel("zen-auto") {
+		t.Errorf("disable: err = %v", err)
+	}
+}
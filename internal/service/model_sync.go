@@ -41,6 +41,7 @@ type ModelSyncService struct {
 	lastError    string
 	usingDefault bool
 	modelCount   int
+	items        []modelDescriptor // 最近一次同步成功的上游模型列表，模型注册表变更后据此重建模型表
 }
 
 var (
@@ -61,8 +62,10 @@ func GetModelSyncService() *ModelSyncService {
 
 func InitModelSyncService() {
 	svc := GetModelSyncService()
+	// 同步失败时继续使用默认模型集，弃用计划同样需要生效
+	model.UpdateZenModels(applyModelDeprecations)
 	if err := svc.Sync(); err != nil {
-		log.Printf("[ModelSync] 初始同步失败，继续使用默认模型集: %v", err)
+		log.Printf("[WARN] [ModelSync] 初始同步失败，继续使用默认模型集: %v", err)
 	}
 	go svc.refreshLoop()
 }
@@ -73,19 +76,20 @@ func (s *ModelSyncService) refreshLoop() {
 
 	for range ticker.C {
 		if err := s.Sync(); err != nil {
-			log.Printf("[ModelSync] 定时同步失败: %v", err)
+			log.Printf("[WARN] [ModelSync] 定时同步失败: %v", err)
 		}
 	}
 }
 
 func (s *ModelSyncService) Sync() error {
-	models, source, err := s.fetchModels()
+	items, source, err := s.fetchModels()
 	if err != nil {
 		current := model.ListZenModels()
 		s.setStatus(s.currentSourceOrDefault(), err.Error(), len(current) == len(model.DefaultZenModels()), len(current))
 		return err
 	}
 
+	models := buildDynamicModelMap(items)
 	if len(models) == 0 {
 		err = fmt.Errorf("上游返回空模型列表")
 		current := model.ListZenModels()
@@ -93,12 +97,36 @@ func (s *ModelSyncService) Sync() error {
 		return err
 	}
 
+	applyModelTimeoutOverrides(models)
+	applyModelDeprecations(models)
 	model.ReplaceZenModels(models)
+	s.mu.Lock()
+	s.items = items
+	s.mu.Unlock()
 	s.setStatus(source, "", false, len(models))
 	log.Printf("[ModelSync] 模型同步成功，来源=%s，数量=%d", source, len(models))
 	return nil
 }
 
+// Reload 模型注册表变更后重建模型表：同步成功过时按最近一次的上游模型列表重建，否则使用默认模型集合
+func (s *ModelSyncService) Reload() {
+	s.mu.RLock()
+	items := s.items
+	s.mu.RUnlock()
+
+	models := model.DefaultZenModels()
+	if len(items) > 0 {
+		models = buildDynamicModelMap(items)
+	}
+	applyModelTimeoutOverrides(models)
+	applyModelDeprecations(models)
+	model.ReplaceZenModels(models)
+	s.mu.Lock()
+	s.usingDefault = len(items) == 0
+	s.modelCount = len(models)
+	s.mu.Unlock()
+}
+
 func (s *ModelSyncService) Status() model.ModelSyncStatus {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -131,19 +159,19 @@ func (s *ModelSyncService) currentSourceOrDefault() string {
 	return s.source
 }
 
-func (s *ModelSyncService) fetchModels() (map[string]model.ZenModel, string, error) {
-	if models, err := s.fetchFromAPI(); err == nil && len(models) > 0 {
-		return models, "api", nil
+func (s *ModelSyncService) fetchModels() ([]modelDescriptor, string, error) {
+	if items, err := s.fetchFromAPI(); err == nil && len(items) > 0 {
+		return items, "api", nil
 	}
 
-	models, err := s.fetchFromDocs()
+	items, err := s.fetchFromDocs()
 	if err != nil {
 		return nil, "", err
 	}
-	return models, "docs", nil
+	return items, "docs", nil
 }
 
-func (s *ModelSyncService) fetchFromAPI() (map[string]model.ZenModel, error) {
+func (s *ModelSyncService) fetchFromAPI() ([]modelDescriptor, error) {
 	account, err := GetNextAccount()
 	if err != nil {
 		return nil, fmt.Errorf("获取同步账号失败: %w", err)
@@ -192,10 +220,10 @@ func (s *ModelSyncService) fetchFromAPI() (map[string]model.ZenModel, error) {
 		})
 	}
 
-	return buildDynamicModelMap(items), nil
+	return items, nil
 }
 
-func (s *ModelSyncService) fetchFromDocs() (map[string]model.ZenModel, error) {
+func (s *ModelSyncService) fetchFromDocs() ([]modelDescriptor, error) {
 	client := &http.Client{Timeout: 20 * time.Second}
 	req, err := http.NewRequest("GET", ZencoderModelsDocsURL, nil)
 	if err != nil {
@@ -230,7 +258,7 @@ func (s *ModelSyncService) fetchFromDocs() (map[string]model.ZenModel, error) {
 		})
 	}
 
-	return buildDynamicModelMap(items), nil
+	return items, nil
 }
 
 func buildDynamicModelMap(items []modelDescriptor) map[string]model.ZenModel {
@@ -258,6 +286,15 @@ func buildDynamicModelMap(items []modelDescriptor) map[string]model.ZenModel {
 		}
 	}
 
+	// 数据库模型注册表中的模型由管理员配置，上游列表中没有时同样保留
+	if model.UsingRegistryModels() {
+		for modelID, m := range defaults {
+			if _, exists := result[modelID]; !exists {
+				result[modelID] = m
+			}
+		}
+	}
+
 	return result
 }
 
@@ -270,6 +307,12 @@ func buildFallbackModel(modelID, providerID string) model.ZenModel {
 		ProviderID:  providerID,
 	}
 
+	// embedding 模型不接受对话参数
+	if strings.Contains(modelID, "embedding") {
+		zenModel.Type = model.ModelTypeEmbedding
+		return zenModel
+	}
+
 	switch providerID {
 	case "openai":
 		zenModel.Parameters = buildDefaultOpenAIParams()
@@ -290,6 +333,12 @@ func buildThinkingAlias(modelID string, defaults map[string]model.ZenModel, base
 		return tpl
 	}
 
+	// thinking 响应首包较慢，沿用基础模型的超时或放宽到长超时
+	timeouts := base.Timeouts
+	if timeouts == nil {
+		timeouts = model.ThinkingTimeouts()
+	}
+
 	thinking := buildDefaultThinkingParams()
 	return model.ZenModel{
 		ID:          base.ID,
@@ -299,6 +348,7 @@ func buildThinkingAlias(modelID string, defaults map[string]model.ZenModel, base
 		ProviderID:  base.ProviderID,
 		Parameters:  thinking,
 		PremiumOnly: base.PremiumOnly,
+		Timeouts:    timeouts,
 	}
 }
 
@@ -357,7 +407,7 @@ func EnsureModelAvailable(modelID string) bool {
 	}
 
 	if err := GetModelSyncService().Sync(); err != nil {
-		log.Printf("[ModelSync] 按需同步失败，模型=%s，错误=%v", modelID, err)
+		log.Printf("[WARN] [ModelSync] 按需同步失败，模型=%s，错误=%v", modelID, err)
 		return false
 	}
 
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 审核范围
+const (
+	ModerationScopeInput  = "input"  // 只审核请求中的提示词
+	ModerationScopeOutput = "output" // 只审核返回的内容
+	ModerationScopeBoth   = "both"
+)
+
+// 命中后的处理方式
+const (
+	ModerationActionBlock    = "block"    // 拒绝请求/替换响应
+	ModerationActionFlag     = "flag"     // 放行，只记录日志
+	ModerationActionAnnotate = "annotate" // 放行，并在响应头中标注命中类别
+)
+
+// ModerationRule 内容审核规则，Action 为空表示不审核
+type ModerationRule struct {
+	Scope  string `json:"scope"`
+	Action string `json:"action"`
+}
+
+// ModerationSettings 审核接口地址、全局规则及按 API Key 的规则，Key 规则优先
+type ModerationSettings struct {
+	URL string `json:"url"`
+	ModerationRule
+	Keys map[string]ModerationRule `json:"keys"` // 按 API Key（已脱敏）的规则
+}
+
+// ModerationResult 审核结果
+type ModerationResult struct {
+	Flagged    bool
+	Categories []string
+}
+
+var (
+	moderationMu       sync.RWMutex
+	moderationSettings ModerationSettings
+	moderationOnce     sync.Once
+	moderationClient   = &http.Client{Timeout: 10 * time.Second}
+)
+
+func (r ModerationRule) valid() bool {
+	switch r.Scope {
+	case "", ModerationScopeInput, ModerationScopeOutput, ModerationScopeBoth:
+	default:
+		return false
+	}
+	switch r.Action {
+	case "", ModerationActionBlock, ModerationActionFlag, ModerationActionAnnotate:
+		return true
+	}
+	return false
+}
+
+// Enabled 规则是否需要审核
+func (r ModerationRule) Enabled() bool {
+	return r.Action != ""
+}
+
+// Checks 判断规则是否审核输入或输出，Scope 为空时只审核输入
+func (r ModerationRule) Checks(scope string) bool {
+	if !r.Enabled() {
+		return false
+	}
+	switch r.Scope {
+	case "", ModerationScopeInput:
+		return scope == ModerationScopeInput
+	case ModerationScopeOutput:
+		return scope == ModerationScopeOutput
+	}
+	return true
+}
+
+// loadModerationSettings 从 MODERATION_URL / MODERATION_SCOPE / MODERATION_ACTION 读取全局配置
+func loadModerationSettings() {
+	rule := ModerationRule{
+		Scope:  strings.ToLower(strings.TrimSpace(os.Getenv("MODERATION_SCOPE"))),
+		Action: strings.ToLower(strings.TrimSpace(os.Getenv("MODERATION_ACTION"))),
+	}
+	endpoint := strings.TrimSpace(os.Getenv("MODERATION_URL"))
+	if endpoint != "" && rule.Action == "" {
+		rule.Action = ModerationActionFlag
+	}
+	if !rule.valid() {
+		log.Printf("[WARN] 无效的 MODERATION_SCOPE/MODERATION_ACTION: %s/%s，已关闭内容审核", rule.Scope, rule.Action)
+		rule = ModerationRule{}
+	}
+	moderationSettings = ModerationSettings{URL: endpoint, ModerationRule: rule, Keys: make(map[string]ModerationRule)}
+}
+
+// GetModerationSettings 获取当前内容审核设置副本
+func GetModerationSettings() ModerationSettings {
+	moderationOnce.Do(loadModerationSettings)
+	moderationMu.RLock()
+	defer moderationMu.RUnlock()
+
+	result := moderationSettings
+	result.Keys = make(map[string]ModerationRule, len(moderationSettings.Keys))
+	for k, v := range moderationSettings.Keys {
+		result.Keys[MaskAPIKey(k)] = v
+	}
+	return result
+}
+
+// SetModerationRule 运行时修改审核规则（仅内存生效）
+// apiKey 为空时修改全局规则；否则修改该 Key 的规则
+// Key 规则为空时删除，回到全局规则；如需对某个 Key 关闭审核，可设置 scope 而 action 留空
+func SetModerationRule(apiKey string, rule ModerationRule) error {
+	if !rule.valid() {
+		return fmt.Errorf("scope 只能为 input/output/both，action 只能为 block/flag/annotate")
+	}
+	moderationOnce.Do(loadModerationSettings)
+	moderationMu.Lock()
+	defer moderationMu.Unlock()
+
+	switch {
+	case apiKey == "":
+		moderationSettings.ModerationRule = rule
+	case rule.Scope == "" && rule.Action == "":
+		delete(moderationSettings.Keys, apiKey)
+	default:
+		moderationSettings.Keys[apiKey] = rule
+	}
+	return nil
+}
+
+// SetModerationURL 运行时修改审核接口地址，为空时关闭审核
+func SetModerationURL(rawURL string) error {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL != "" {
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("无效的审核接口地址: %s", rawURL)
+		}
+	}
+	moderationOnce.Do(loadModerationSettings)
+	moderationMu.Lock()
+	moderationSettings.URL = rawURL
+	moderationMu.Unlock()
+	return nil
+}
+
+// ModerationRuleFor 返回请求所用 API Key 的审核规则，未配置审核接口时返回空规则
+func ModerationRuleFor(ctx context.Context) ModerationRule {
+	moderationOnce.Do(loadModerationSettings)
+	moderationMu.RLock()
+	defer moderationMu.RUnlock()
+
+	if moderationSettings.URL == "" {
+		return ModerationRule{}
+	}
+	if rule, ok := moderationSettings.Keys[GetAPIKey(ctx)]; ok {
+		return rule
+	}
+	return moderationSettings.ModerationRule
+}
+
+// Moderate 调用外部审核接口，请求/响应格式与 OpenAI /v1/moderations 兼容
+func Moderate(ctx context.Context, text string) (ModerationResult, error) {
+	moderationOnce.Do(loadModerationSettings)
+	moderationMu.RLock()
+	endpoint := moderationSettings.URL
+	moderationMu.RUnlock()
+
+	payload, _ := json.Marshal(map[string]string{"input": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return ModerationResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("MODERATION_API_KEY"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := moderationClient.Do(req)
+	if err != nil {
+		return ModerationResult{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return ModerationResult{}, fmt.Errorf("审核接口返回 %d: %s", resp.StatusCode, string(body))
+	}
+
+	var parsed struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return ModerationResult{}, fmt.Errorf("解析审核结果失败: %w", err)
+	}
+
+	var result ModerationResult
+	seen := make(map[string]bool)
+	for _, r := range parsed.Results {
+		result.Flagged = result.Flagged || r.Flagged
+		for category, hit := range r.Categories {
+			if hit && !seen[category] {
+				seen[category] = true
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
+
+// moderationTextKeys 各协议中承载文本的字段
+var moderationTextKeys = map[string]bool{
+	"content": true, "text": true, "system": true, "input": true, "prompt": true,
+	"instructions": true, "delta": true,
+}
+
+// ExtractModerationText 从 OpenAI/Anthropic/Gemini 的请求或响应 JSON 中提取文本，流式响应按 SSE data 行逐条提取
+func ExtractModerationText(body []byte) string {
+	var parts []string
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err == nil {
+		collectModerationText(data, &parts)
+		return strings.Join(parts, "\n")
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &data); err == nil {
+			collectModerationText(data, &parts)
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// collectModerationText 收集文本字段的字符串值（或字符串数组），其他字段继续向下查找
+func collectModerationText(v interface{}, parts *[]string) {
+	switch val := v.(type) {
+	case []interface{}:
+		for _, item := range val {
+			collectModerationText(item, parts)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			item := val[key]
+			if !moderationTextKeys[key] {
+				collectModerationText(item, parts)
+				continue
+			}
+			switch text := item.(type) {
+			case string:
+				if text != "" {
+					*parts = append(*parts, text)
+				}
+			case []interface{}:
+				for _, elem := range text {
+					if str, ok := elem.(string); ok {
+						*parts = append(*parts, str)
+					} else {
+						collectModerationText(elem, parts)
+					}
+				}
+			default:
+				collectModerationText(item, parts)
+			}
+		}
+	}
+}
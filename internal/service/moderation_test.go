@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtractModerationText(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"anthropic request", `{"model":"m","system":"be nice","messages":[{"role":"user","content":[{"type":"text","text":"hello"},{"type":"tool_result","tool_use_id":"t1","content":"file dump"}]}]}`,
+			[]string{"be nice", "hello", "file dump"}},
+		{"openai request", `{"model":"m","messages":[{"role":"user","content":"hi there"}]}`, []string{"hi there"}},
+		{"gemini request", `{"contents":[{"role":"user","parts":[{"text":"bonjour"}]}]}`, []string{"bonjour"}},
+		{"openai stream", "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\ndata: [DONE]\n\n",
+			[]string{"Hello"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractModerationText([]byte(tt.body))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("text %q missing %q", got, want)
+				}
+			}
+			if strings.Contains(got, "tool_result") || strings.Contains(got, "user") {
+				t.Errorf("text %q contains non-content fields", got)
+			}
+		})
+	}
+}
+
+func TestModerationRuleChecks(t *testing.T) {
+	cases := []struct {
+		rule          ModerationRule
+		input, output bool
+	}{
+		{ModerationRule{}, false, false},
+		{ModerationRule{Action: "flag"}, true, false},
+		{ModerationRule{Scope: "output", Action: "block"}, false, true},
+		{ModerationRule{Scope: "both", Action: "annotate"}, true, true},
+		{ModerationRule{Scope: "both"}, false, false},
+	}
+	for _, c := range cases {
+		if got := c.rule.Checks(ModerationScopeInput); got != c.input {
+			t.Errorf("%+v input = %v", c.rule, got)
+		}
+		if got := c.rule.Checks(ModerationScopeOutput); got != c.output {
+			t.Errorf("%+v output = %v", c.rule, got)
+		}
+	}
+	if err := SetModerationRule("k", ModerationRule{Action: "delete"}); err == nil {
+		t.Error("expected error for invalid action")
+	}
+	if err := SetModerationURL("ftp://example.com"); err == nil {
+		t.Error("expected error for invalid url")
+	}
+}
+
+func TestModerateAndPerKeyRule(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		flagged := strings.Contains(req.Input, "bad")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{
+				"flagged":    flagged,
+				"categories": map[string]bool{"violence": flagged, "hate": false},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	defer SetModerationURL("")
+	defer SetModerationRule("", ModerationRule{})
+	defer SetModerationRule("strict", ModerationRule{})
+	if err := SetModerationURL(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	SetModerationRule("", ModerationRule{Action: ModerationActionFlag})
+	SetModerationRule("strict", ModerationRule{Scope: ModerationScopeBoth, Action: ModerationActionBlock})
+
+	if rule := ModerationRuleFor(WithAPIKey(context.Background(), "strict")); rule.Action != ModerationActionBlock {
+		t.Errorf("strict key rule = %+v", rule)
+	}
+	if rule := ModerationRuleFor(WithAPIKey(context.Background(), "other")); rule.Action != ModerationActionFlag {
+		t.Errorf("global rule = %+v", rule)
+	}
+
+	result, err := Moderate(context.Background(), "something bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Flagged || len(result.Categories) != 1 || result.Categories[0] != "violence" {
+		t.Errorf("result = %+v", result)
+	}
+	if result, _ := Moderate(context.Background(), "fine"); result.Flagged {
+		t.Error("clean text flagged")
+	}
+}
+
+func TestModerationSettingsMaskKeys(t *testing.T) {
+	const key = "sk-moderation-secret-01"
+	if err := SetModerationRule(key, ModerationRule{Scope: ModerationScopeInput, Action: ModerationActionBlock}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetModerationRule(key, ModerationRule{})
+
+	keys := GetModerationSettings().Keys
+	if _, ok := keys[key]; ok {
+		t.Fatalf("raw API key exposed: %v", keys)
+	}
+	if rule := keys[MaskAPIKey(key)]; rule.Action != ModerationActionBlock {
+		t.Errorf("keys = %v, want rule under masked key", keys)
+	}
+}
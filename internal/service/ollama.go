@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/model"
+)
+
+var (
+	ollamaAliasesMu   sync.RWMutex
+	ollamaAliases     map[string]string
+	ollamaAliasesOnce sync.Once
+)
+
+// parseOllamaAliases 解析 Ollama 模型名映射
+// 格式: ollama_name=model，逗号分隔，例如 llama3=claude-sonnet-4-5-20250929,qwen2.5-coder:7b=gpt-5-mini
+func parseOllamaAliases(raw string) map[string]string {
+	result := make(map[string]string)
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return result
+	}
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			log.Printf("[WARN] OLLAMA_MODEL_ALIASES 中的配置无效，已忽略: %s", item)
+			continue
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result
+}
+
+func loadOllamaAliases() {
+	ollamaAliases = parseOllamaAliases(os.Getenv("OLLAMA_MODEL_ALIASES"))
+}
+
+// GetOllamaAliases 返回 Ollama 模型名映射副本
+func GetOllamaAliases() map[string]string {
+	ollamaAliasesOnce.Do(loadOllamaAliases)
+	ollamaAliasesMu.RLock()
+	defer ollamaAliasesMu.RUnlock()
+
+	result := make(map[string]string, len(ollamaAliases))
+	for k, v := range ollamaAliases {
+		result[k] = v
+	}
+	return result
+}
+
+// SetOllamaAlias 运行时修改 Ollama 模型名映射（仅内存生效，重启后以环境变量为准），target 为空时删除
+func SetOllamaAlias(name, target string) error {
+	name = strings.TrimSpace(name)
+	target = strings.TrimSpace(target)
+	if name == "" {
+		return fmt.Errorf("alias name is required")
+	}
+	if target != "" {
+		if _, ok := model.GetZenModel(target); !ok {
+			return fmt.Errorf("unknown model: %s", target)
+		}
+	}
+
+	ollamaAliasesOnce.Do(loadOllamaAliases)
+	ollamaAliasesMu.Lock()
+	defer ollamaAliasesMu.Unlock()
+	if target == "" {
+		delete(ollamaAliases, name)
+		return nil
+	}
+	ollamaAliases[name] = target
+	return nil
+}
+
+// ResolveOllamaModel 把 Ollama 客户端使用的模型名转换为网关模型名
+// 依次尝试完整名称的映射、去掉 :latest 标签后的映射，都没有配置时按网关模型名处理
+func ResolveOllamaModel(name string) string {
+	ollamaAliasesOnce.Do(loadOllamaAliases)
+	ollamaAliasesMu.RLock()
+	defer ollamaAliasesMu.RUnlock()
+	if target, ok := ollamaAliases[name]; ok {
+		return target
+	}
+	base := strings.TrimSuffix(name, ":latest")
+	if target, ok := ollamaAliases[base]; ok {
+		return target
+	}
+	return base
+}
+
+// ListOllamaModelNames 返回 /api/tags 中列出的模型名：可见模型和已配置的映射名，按名称排序
+func ListOllamaModelNames() []string {
+	ollamaAliasesOnce.Do(loadOllamaAliases)
+	ollamaAliasesMu.RLock()
+	defer ollamaAliasesMu.RUnlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, id := range model.ListZenModelIDs() {
+		if zenModel, ok := model.GetZenModel(id); ok && !zenModel.IsHidden {
+			seen[id] = true
+			names = append(names, id)
+		}
+	}
+	for alias := range ollamaAliases {
+		if !seen[alias] {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
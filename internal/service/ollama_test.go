@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestResolveOllamaModel(t *testing.T) {
+	ollamaAliasesOnce.Do(func() {})
+	prev := ollamaAliases
+	defer func() { ollamaAliases = prev }()
+	ollamaAliases = parseOllamaAliases("llama3=claude-sonnet-4-5-20250929, qwen2.5-coder:7b=gpt-5-mini,broken")
+
+	cases := map[string]string{
+		"llama3":                    "claude-sonnet-4-5-20250929",
+		"llama3:latest":             "claude-sonnet-4-5-20250929",
+		"qwen2.5-coder:7b":          "gpt-5-mini",
+		"claude-haiku-4-5-20251001": "claude-haiku-4-5-20251001",
+		"gpt-5-mini:latest":         "gpt-5-mini",
+	}
+	for name, want := range cases {
+		if got := ResolveOllamaModel(name); got != want {
+			t.Errorf("ResolveOllamaModel(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if len(ollamaAliases) != 2 {
+		t.Errorf("aliases = %v, want invalid entry skipped", ollamaAliases)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -16,26 +17,32 @@ import (
 	"zencoder2api/internal/service/provider"
 )
 
-const OpenAIBaseURL = "https://api.zencoder.ai/openai"
+var OpenAIBaseURL = DefaultUpstreamBase + "/openai"
 
-type OpenAIService struct{}
+type OpenAIService struct {
+	deps Dependencies
+}
 
 func NewOpenAIService() *OpenAIService {
-	return &OpenAIService{}
+	return NewOpenAIServiceWithDeps(DefaultDependencies())
 }
 
-// ListModels 返回 OpenAI 兼容的模型列表。
-func (s *OpenAIService) ListModels() model.ModelListResponse {
-	models := model.ListZenModels()
-	data := make([]model.ModelInfo, 0, len(models))
+// NewOpenAIServiceWithDeps 使用指定依赖创建服务，便于替换号池和上游
+func NewOpenAIServiceWithDeps(deps Dependencies) *OpenAIService {
+	return &OpenAIService{deps: deps.withDefaults()}
+}
 
-	for _, zenModel := range models {
-		data = append(data, model.ModelInfo{
-			ID:      zenModel.Model,
-			Object:  "model",
-			Created: 0,
-			OwnedBy: zenModel.ProviderID,
-		})
+// ListModels 返回 OpenAI 兼容的模型列表，不含隐藏模型
+// id 为客户端请求时使用的模型名，供 LobeChat、OpenWebUI 等客户端自动发现模型
+func (s *OpenAIService) ListModels() model.ModelListResponse {
+	ids := model.ListZenModelIDs()
+	data := make([]model.ModelInfo, 0, len(ids))
+	for _, id := range ids {
+		zenModel, ok := model.GetZenModel(id)
+		if !ok || zenModel.IsHidden {
+			continue
+		}
+		data = append(data, openAIModelInfo(id, zenModel))
 	}
 
 	return model.ModelListResponse{
@@ -44,6 +51,31 @@ func (s *OpenAIService) ListModels() model.ModelListResponse {
 	}
 }
 
+// GetModel 返回单个模型的信息（/v1/models/:id），隐藏模型仍可直接查询
+func (s *OpenAIService) GetModel(id string) (model.ModelInfo, bool) {
+	zenModel, ok := model.GetZenModel(id)
+	if !ok {
+		return model.ModelInfo{}, false
+	}
+	return openAIModelInfo(id, zenModel), true
+}
+
+func openAIModelInfo(id string, zenModel model.ZenModel) model.ModelInfo {
+	return model.ModelInfo{
+		ID:      id,
+		Object:  "model",
+		Created: modelCreatedAt(id).Unix(),
+		OwnedBy: zenModel.ProviderID,
+		Metadata: &model.ModelMetadata{
+			DisplayName: zenModel.DisplayName,
+			Provider:    zenModel.ProviderID,
+			Multiplier:  zenModel.Multiplier,
+			PremiumOnly: zenModel.PremiumOnly,
+			Type:        zenModel.Type,
+		},
+	}
+}
+
 func (s *OpenAIService) GetModelSyncStatus() model.ModelSyncStatus {
 	return GetModelSyncService().Status()
 }
@@ -66,9 +98,14 @@ func (s *OpenAIService) ChatCompletions(ctx context.Context, body []byte) (*http
 
 	DebugLogRequest(ctx, "OpenAI", "/v1/chat/completions", req.Model)
 
+	policy := GetRetryPolicy("openai")
+	budget := newLatencyBudget(ctx)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
-		account, err := GetNextAccountForModel(req.Model)
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.deps.Accounts.GetNextAccountForModel(req.Model)
 		if err != nil {
 			DebugLogRequestEnd(ctx, "OpenAI", false, err)
 			return nil, err
@@ -83,11 +120,18 @@ func (s *OpenAIService) ChatCompletions(ctx context.Context, body []byte) (*http
 			return nil, fmt.Errorf("failed to convert request body: %w", err)
 		}
 
-		resp, err := s.doRequest(ctx, account, req.Model, "/v1/responses", convertedBody)
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doRequest(attemptCtx, account, req.Model, "/v1/responses", convertedBody))
+		RecordUpstreamResult(ctx, req.Model, account.ID, start, resp, err)
 		if err != nil {
-			ReleaseAccount(account) // 释放账号
-			MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
 			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "OpenAI", false, err)
+				return nil, err
+			}
 			DebugLogRetry(ctx, "OpenAI", i+1, account.ID, err)
 			continue
 		}
@@ -99,10 +143,10 @@ func (s *OpenAIService) ChatCompletions(ctx context.Context, body []byte) (*http
 		if resp.Header.Get("Zen-Pricing-Period-Limit") != "" ||
 		   resp.Header.Get("Zen-Pricing-Period-Cost") != "" ||
 		   resp.Header.Get("Zen-Request-Cost") != "" {
-			log.Printf("[OpenAI] 积分信息 - 周期限额: %s, 周期消耗: %s, 本次消耗: %s",
-				resp.Header.Get("Zen-Pricing-Period-Limit"),
-				resp.Header.Get("Zen-Pricing-Period-Cost"),
-				resp.Header.Get("Zen-Request-Cost"))
+			LogEvent(ctx, slog.LevelInfo, "OpenAI", "积分信息", logAccountID(account.ID),
+				slog.String("period_limit", resp.Header.Get("Zen-Pricing-Period-Limit")),
+				slog.String("period_cost", resp.Header.Get("Zen-Pricing-Period-Cost")),
+				slog.String("request_cost", resp.Header.Get("Zen-Request-Cost")))
 		}
 
 		if resp.StatusCode >= 400 {
@@ -113,44 +157,44 @@ func (s *OpenAIService) ChatCompletions(ctx context.Context, body []byte) (*http
 
 			// 400和500错误直接返回，不进行账号错误计数
 			if resp.StatusCode == 400 || resp.StatusCode == 500 {
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				DebugLogRequestEnd(ctx, "OpenAI", false, fmt.Errorf("API error: %d", resp.StatusCode))
 				return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(errBody))
 			}
 
 			// 429 错误特殊处理
 			if resp.StatusCode == 429 {
-				log.Printf("[OpenAI] 429限流错误，尝试使用代理重试")
+				LogEvent(ctx, slog.LevelWarn, "OpenAI", "429限流错误，尝试使用代理重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode))
 
 				// 尝试使用代理池重试
 				proxyResp, proxyErr := s.retryWithProxy(ctx, account, req.Model, "/v1/responses", convertedBody)
 				if proxyErr == nil && proxyResp != nil {
 					// 代理重试成功
-					ReleaseAccount(account) // 释放账号
+					s.deps.Accounts.ReleaseAccount(account) // 释放账号
 					return proxyResp, nil
 				}
 
-				log.Printf("[OpenAI] 代理重试失败: %v", proxyErr)
-				MarkAccountRateLimitedWithResponse(account, resp)
+				LogEvent(ctx, slog.LevelWarn, "OpenAI", "代理重试失败", logAccountID(account.ID), logError(proxyErr))
+				s.deps.Accounts.MarkAccountRateLimitedWithResponse(account, resp, policy.Cooling())
 			} else {
-				MarkAccountError(account)
+				s.deps.Accounts.MarkAccountError(account)
 			}
 
-			ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
 			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
 			DebugLogRetry(ctx, "OpenAI", i+1, account.ID, lastErr)
 			continue
 		}
 
-		ResetAccountError(account)
-		ReleaseAccount(account) // 释放账号
+		s.deps.Accounts.ResetAccountError(account)
+		s.deps.Accounts.ReleaseAccount(account) // 释放账号
 		zenModel, exists := model.GetZenModel(req.Model)
 		if !exists {
 			// 模型不存在，使用默认倍率
-			UpdateAccountCreditsFromResponse(account, resp, 1.0)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, 1.0)
 		} else {
 			// 使用统一的积分更新函数，自动处理响应头中的积分信息
-			UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
 		}
 		
 		DebugLogRequestEnd(ctx, "OpenAI", true, nil)
@@ -158,7 +202,7 @@ func (s *OpenAIService) ChatCompletions(ctx context.Context, body []byte) (*http
 	}
 
 	DebugLogRequestEnd(ctx, "OpenAI", false, lastErr)
-	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
 }
 
 // Responses 处理/v1/responses请求
@@ -179,20 +223,32 @@ func (s *OpenAIService) Responses(ctx context.Context, body []byte) (*http.Respo
 
 	DebugLogRequest(ctx, "OpenAI", "/v1/responses", req.Model)
 
+	policy := GetRetryPolicy("openai")
+	budget := newLatencyBudget(ctx)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
-		account, err := GetNextAccountForModel(req.Model)
+	for i := 0; i < policy.MaxRetries; i++ {
+		if err := waitRetry(ctx, policy, i); err != nil {
+			return nil, err
+		}
+		account, err := s.deps.Accounts.GetNextAccountForModel(req.Model)
 		if err != nil {
 			DebugLogRequestEnd(ctx, "OpenAI", false, err)
 			return nil, err
 		}
 		DebugLogAccountSelected(ctx, "OpenAI", account.ID, account.Email)
 
-		resp, err := s.doRequest(ctx, account, req.Model, "/v1/responses", body)
+		start := time.Now()
+		attemptCtx, finish := budget.attempt(ctx)
+		resp, err := finish(s.doRequest(attemptCtx, account, req.Model, "/v1/responses", body))
+		RecordUpstreamResult(ctx, req.Model, account.ID, start, resp, err)
 		if err != nil {
-			ReleaseAccount(account) // 释放账号
-			MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
 			lastErr = err
+			if budget.exhausted(err) {
+				DebugLogRequestEnd(ctx, "OpenAI", false, err)
+				return nil, err
+			}
 			DebugLogRetry(ctx, "OpenAI", i+1, account.ID, err)
 			continue
 		}
@@ -204,10 +260,10 @@ func (s *OpenAIService) Responses(ctx context.Context, body []byte) (*http.Respo
 		if resp.Header.Get("Zen-Pricing-Period-Limit") != "" ||
 		   resp.Header.Get("Zen-Pricing-Period-Cost") != "" ||
 		   resp.Header.Get("Zen-Request-Cost") != "" {
-			log.Printf("[OpenAI] 积分信息 - 周期限额: %s, 周期消耗: %s, 本次消耗: %s",
-				resp.Header.Get("Zen-Pricing-Period-Limit"),
-				resp.Header.Get("Zen-Pricing-Period-Cost"),
-				resp.Header.Get("Zen-Request-Cost"))
+			LogEvent(ctx, slog.LevelInfo, "OpenAI", "积分信息", logAccountID(account.ID),
+				slog.String("period_limit", resp.Header.Get("Zen-Pricing-Period-Limit")),
+				slog.String("period_cost", resp.Header.Get("Zen-Pricing-Period-Cost")),
+				slog.String("request_cost", resp.Header.Get("Zen-Request-Cost")))
 		}
 
 		if resp.StatusCode >= 400 {
@@ -217,20 +273,20 @@ func (s *OpenAIService) Responses(ctx context.Context, body []byte) (*http.Respo
 
 			// 429 错误特殊处理 - 直接返回，不重试
 			if resp.StatusCode == 429 {
-				log.Printf("[OpenAI] 429限流错误，尝试使用代理重试")
+				LogEvent(ctx, slog.LevelWarn, "OpenAI", "429限流错误，尝试使用代理重试", logAccountID(account.ID), slog.Int("status", resp.StatusCode))
 
 				// 尝试使用代理池重试
 				proxyResp, proxyErr := s.retryWithProxy(ctx, account, req.Model, "/v1/responses", body)
 				if proxyErr == nil && proxyResp != nil {
 					// 代理重试成功
-					ReleaseAccount(account) // 释放账号
+					s.deps.Accounts.ReleaseAccount(account) // 释放账号
 					return proxyResp, nil
 				}
 
-				log.Printf("[OpenAI] 代理重试失败: %v", proxyErr)
+				LogEvent(ctx, slog.LevelWarn, "OpenAI", "代理重试失败", logAccountID(account.ID), logError(proxyErr))
 				// 将账号放入短期冷却（5秒）
-				MarkAccountRateLimitedShort(account)
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.MarkAccountRateLimitedShort(account, policy.ShortCooling())
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				// 不输出错误日志，直接返回
 				return nil, ErrNoAvailableAccount
 			}
@@ -239,27 +295,27 @@ func (s *OpenAIService) Responses(ctx context.Context, body []byte) (*http.Respo
 
 			// 400和500错误直接返回，不进行账号错误计数
 			if resp.StatusCode == 400 || resp.StatusCode == 500 {
-				ReleaseAccount(account) // 释放账号
+				s.deps.Accounts.ReleaseAccount(account) // 释放账号
 				DebugLogRequestEnd(ctx, "OpenAI", false, fmt.Errorf("API error: %d", resp.StatusCode))
 				return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(errBody))
 			}
 
-			MarkAccountError(account)
-			ReleaseAccount(account) // 释放账号
+			s.deps.Accounts.MarkAccountError(account)
+			s.deps.Accounts.ReleaseAccount(account) // 释放账号
 			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
 			DebugLogRetry(ctx, "OpenAI", i+1, account.ID, lastErr)
 			continue
 		}
 
-		ResetAccountError(account)
-		ReleaseAccount(account) // 释放账号
+		s.deps.Accounts.ResetAccountError(account)
+		s.deps.Accounts.ReleaseAccount(account) // 释放账号
 		zenModel, exists := model.GetZenModel(req.Model)
 		if !exists {
 			// 模型不存在，使用默认倍率
-			UpdateAccountCreditsFromResponse(account, resp, 1.0)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, 1.0)
 		} else {
 			// 使用统一的积分更新函数，自动处理响应头中的积分信息
-			UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
+			s.deps.Credits.UpdateAccountCreditsFromResponse(account, resp, zenModel.Multiplier)
 		}
 		
 		DebugLogRequestEnd(ctx, "OpenAI", true, nil)
@@ -267,7 +323,7 @@ func (s *OpenAIService) Responses(ctx context.Context, body []byte) (*http.Respo
 	}
 
 	DebugLogRequestEnd(ctx, "OpenAI", false, lastErr)
-	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, exhaustRetries(ctx, lastErr)
 }
 
 // convertChatToResponsesBody 将 Chat Completion 的请求体转换为 Responses API 的请求体
@@ -297,8 +353,8 @@ func (s *OpenAIService) convertChatToResponsesBody(body []byte) ([]byte, error)
 
 	// 检查是否有 messages 字段
 	if messages, ok := raw["messages"].([]interface{}); ok {
-		if modelStr == "gpt-5-nano-2025-08-07" {
-			// gpt-5-nano 特殊处理：转换为复杂的 input 结构
+		if zenModel, ok := model.GetZenModel(modelStr); ok && zenModel.Parameters.UsesTypedInput() {
+			// 模型要求带类型的 input 结构
 			newInput := make([]map[string]interface{}, 0)
 			for _, m := range messages {
 				if msgMap, ok := m.(map[string]interface{}); ok {
@@ -332,85 +388,71 @@ func (s *OpenAIService) convertChatToResponsesBody(body []byte) ([]byte, error)
 		delete(raw, "messages")
 	}
 
-	// gpt-5-nano-2025-08-07 特殊处理参数
-	if modelStr == "gpt-5-nano-2025-08-07" {
-		// 添加该模型所需的特定参数
-		raw["prompt_cache_key"] = "generate-name"
-		raw["store"] = false
-		raw["include"] = []string{"reasoning.encrypted_content"}
-		raw["service_tier"] = "auto"
-	}
-
 	return json.Marshal(raw)
 }
 
-func (s *OpenAIService) doRequest(ctx context.Context, account *model.Account, modelID, path string, body []byte) (*http.Response, error) {
-	zenModel, exists := model.GetZenModel(modelID)
-	if !exists {
-		return nil, ErrNoAvailableAccount
+// applyOpenAIModelParameters 把模型表中的参数合并到请求体：reasoning、text、temperature 只在客户端未设置时补充，
+// extraBody 按字段合并并覆盖客户端的值，上游只支持流式时强制 stream=true
+func applyOpenAIModelParameters(body []byte, params *model.ModelParameters) []byte {
+	if params == nil {
+		return body
+	}
+	var raw map[string]interface{}
+	if json.Unmarshal(body, &raw) != nil {
+		return body
 	}
-	httpClient := provider.NewHTTPClient(account.Proxy, 0)
 
-	// 将模型参数合并到请求体中
-	modifiedBody := body
-	if zenModel.Parameters != nil {
-		var raw map[string]interface{}
-		if json.Unmarshal(modifiedBody, &raw) == nil {
-			// 添加 reasoning 配置
-			if zenModel.Parameters.Reasoning != nil && raw["reasoning"] == nil {
-				reasoningMap := map[string]interface{}{
-					"effort": zenModel.Parameters.Reasoning.Effort,
-				}
-				if zenModel.Parameters.Reasoning.Summary != "" {
-					reasoningMap["summary"] = zenModel.Parameters.Reasoning.Summary
-				}
-				raw["reasoning"] = reasoningMap
-			}
-			
-			// 添加 text 配置
-			if zenModel.Parameters.Text != nil && raw["text"] == nil {
-				raw["text"] = map[string]interface{}{
-					"verbosity": zenModel.Parameters.Text.Verbosity,
-				}
-			}
-			
-			// 添加 temperature 配置
-			if zenModel.Parameters.Temperature != nil && raw["temperature"] == nil {
-				raw["temperature"] = *zenModel.Parameters.Temperature
-			}
-			
-			modifiedBody, _ = json.Marshal(raw)
+	if params.Reasoning != nil && raw["reasoning"] == nil {
+		reasoningMap := map[string]interface{}{
+			"effort": params.Reasoning.Effort,
+		}
+		if params.Reasoning.Summary != "" {
+			reasoningMap["summary"] = params.Reasoning.Summary
 		}
+		raw["reasoning"] = reasoningMap
+	}
+	if params.Text != nil && raw["text"] == nil {
+		raw["text"] = map[string]interface{}{
+			"verbosity": params.Text.Verbosity,
+		}
+	}
+	if params.Temperature != nil && raw["temperature"] == nil {
+		raw["temperature"] = *params.Temperature
+	}
+	mergeExtraBody(raw, params.ExtraBody)
+	if params.ForcesStreaming() {
+		raw["stream"] = true
 	}
 
-	// gpt-5-nano-2025-08-07 特殊处理参数
-	if modelID == "gpt-5-nano-2025-08-07" {
-		var raw map[string]interface{}
-		if json.Unmarshal(modifiedBody, &raw) == nil {
-			// 添加 text 参数
-			if _, ok := raw["text"]; !ok {
-				raw["text"] = map[string]string{"verbosity": "medium"}
-			}
-			// 添加 temperature 参数 (如果缺失)
-			if _, ok := raw["temperature"]; !ok {
-				raw["temperature"] = 1
-			}
-			// 强制开启 stream，因为该模型似乎不支持非流式
-			raw["stream"] = true
+	modified, err := json.Marshal(raw)
+	if err != nil {
+		return body
+	}
+	return modified
+}
 
-			// 修正 reasoning 参数，添加 summary
-			if reasoning, ok := raw["reasoning"].(map[string]interface{}); ok {
-				reasoning["summary"] = "auto"
-				raw["reasoning"] = reasoning
-			} else {
-				raw["reasoning"] = map[string]interface{}{
-					"effort":  "minimal",
-					"summary": "auto",
-				}
+// mergeExtraBody 把 extra 合并到请求体：两边都是对象时递归合并，否则用 extra 的值（副本）覆盖
+func mergeExtraBody(dst, extra map[string]interface{}) {
+	for k, v := range extra {
+		if src, ok := v.(map[string]interface{}); ok {
+			if existing, ok := dst[k].(map[string]interface{}); ok {
+				mergeExtraBody(existing, src)
+				continue
 			}
-			modifiedBody, _ = json.Marshal(raw)
 		}
+		dst[k] = model.CloneJSONValue(v)
+	}
+}
+
+func (s *OpenAIService) doRequest(ctx context.Context, account *model.Account, modelID, path string, body []byte) (*http.Response, error) {
+	zenModel, exists := model.GetZenModel(modelID)
+	if !exists {
+		return nil, ErrNoAvailableAccount
 	}
+	httpClient := s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel)
+
+	// 将模型参数合并到请求体中
+	modifiedBody := applyOpenAIModelParameters(body, zenModel.Parameters)
 
 	// 注意：已移除模型重定向逻辑，直接使用用户请求的模型名
 	DebugLogActualModel(ctx, "OpenAI", modelID, modelID)
@@ -418,7 +460,7 @@ func (s *OpenAIService) doRequest(ctx context.Context, account *model.Account, m
 	reqURL := OpenAIBaseURL + path
 	DebugLogRequestSent(ctx, "OpenAI", reqURL)
 
-	httpReq, err := http.NewRequest("POST", reqURL, bytes.NewReader(modifiedBody))
+	httpReq, err := http.NewRequestWithContext(upstreamContext(ctx), "POST", reqURL, bytes.NewReader(modifiedBody))
 	if err != nil {
 		return nil, err
 	}
@@ -460,33 +502,30 @@ func (s *OpenAIService) ChatCompletionsProxy(ctx context.Context, w http.Respons
 	defer resp.Body.Close()
 
 	if req.Stream {
-		return s.streamConvertedResponse(w, resp, req.Model)
+		resp.Body = trackStreamCost(resp.Body, req.Model, StreamProtocolChat)
+		resp.Body = paceStream(ctx, resp.Body, req.Model, StreamProtocolChat)
+		return s.streamConvertedResponse(ctx, w, resp, req.Model)
 	}
 
-	return s.handleNonStreamResponse(w, resp, req.Model)
+	return s.handleNonStreamResponse(ctx, w, resp, req.Model)
 }
 
-func (s *OpenAIService) handleNonStreamResponse(w http.ResponseWriter, resp *http.Response, modelID string) error {
+func (s *OpenAIService) handleNonStreamResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response, modelID string) error {
 	// 读取全部响应体
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 
-	// 复制响应头
-	for k, v := range resp.Header {
-		// 过滤掉 Content-Length (会重新计算) 和 Content-Encoding (Go会自动解压)
-		if k != "Content-Length" && k != "Content-Encoding" {
-			for _, vv := range v {
-				w.Header().Add(k, vv)
-			}
-		}
-	}
+	// 复制响应头，过滤掉 Content-Length (会重新计算) 和 Content-Encoding (Go会自动解压)
+	copyUpstreamHeaders(ctx, w.Header(), resp.Header, "Content-Length", "Content-Encoding")
 	w.WriteHeader(resp.StatusCode)
 
 	// 尝试解析响应
 	var raw map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &raw); err != nil {
+		zenModel, _ := model.GetZenModel(modelID)
+		aggregateSSE := zenModel.Parameters.AggregatesSSE()
 		// 如果不是 JSON，检查是否是 SSE 流 (可能是因为我们强制开启了 stream)
 		bodyStr := string(bodyBytes)
 		trimmedBody := strings.TrimSpace(bodyStr)
@@ -495,7 +534,7 @@ func (s *OpenAIService) handleNonStreamResponse(w http.ResponseWriter, resp *htt
 			strings.HasPrefix(trimmedBody, "data:") ||
 			strings.HasPrefix(trimmedBody, "event:") ||
 			strings.HasPrefix(trimmedBody, ":") ||
-			modelID == "gpt-5-nano-2025-08-07" // 强制该模型走 SSE 解析
+			aggregateSSE // 模型强制走 SSE 解析
 
 		if isSSE {
 			var fullContent string
@@ -532,8 +571,8 @@ func (s *OpenAIService) handleNonStreamResponse(w http.ResponseWriter, resp *htt
 				}
 			}
 
-			// 如果提取到了内容，或者是强制模型（即使没提取到也返回空内容以避免透传错误格式）
-			if fullContent != "" || modelID == "gpt-5-nano-2025-08-07" {
+			// 如果提取到了内容，或者是强制聚合的模型（即使没提取到也返回空内容以避免透传错误格式）
+			if fullContent != "" || aggregateSSE {
 				timestamp := time.Now().Unix()
 				respObj := model.ChatCompletionResponse{
 					ID:      fmt.Sprintf("chatcmpl-%d", timestamp),
@@ -602,20 +641,24 @@ func (s *OpenAIService) handleNonStreamResponse(w http.ResponseWriter, resp *htt
 	return nil
 }
 
-func (s *OpenAIService) streamConvertedResponse(w http.ResponseWriter, resp *http.Response, modelID string) error {
+func (s *OpenAIService) streamConvertedResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response, modelID string) error {
 	// 设置SSE响应头
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.WriteHeader(resp.StatusCode)
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	if _, ok := w.(http.Flusher); !ok {
 		// 如果不支持Flusher，回退到普通复制
 		_, err := io.Copy(w, resp.Body)
+		if capErr, ok := err.(*StreamCreditCapError); ok {
+			_, err = io.WriteString(w, capErr.Event())
+		}
 		return err
 	}
 
+	sse := NewSSEWriter(ctx, w)
+	defer sse.KeepAlive()()
 	reader := bufio.NewReader(resp.Body)
 	timestamp := time.Now().Unix()
 	id := fmt.Sprintf("chatcmpl-%d", timestamp)
@@ -642,13 +685,16 @@ func (s *OpenAIService) streamConvertedResponse(w http.ResponseWriter, resp *htt
 						},
 					}
 					finishBytes, _ := json.Marshal(finishChunk)
-					fmt.Fprintf(w, "data: %s\n\n", string(finishBytes))
+					if err := sse.Printf("data: %s\n\n", string(finishBytes)); err != nil {
+						return err
+					}
+				}
+				if err := sse.Printf("data: [DONE]\n\n"); err != nil {
+					return err
 				}
-				fmt.Fprintf(w, "data: [DONE]\n\n")
-				flusher.Flush()
-				return nil
+				return sse.Flush()
 			}
-			return err
+			return endStreamOnCreditCap(sse, err)
 		}
 
 		trimmedLine := strings.TrimSpace(line)
@@ -683,11 +729,14 @@ func (s *OpenAIService) streamConvertedResponse(w http.ResponseWriter, resp *htt
 					},
 				}
 				finishBytes, _ := json.Marshal(finishChunk)
-				fmt.Fprintf(w, "data: %s\n\n", string(finishBytes))
+				if err := sse.Printf("data: %s\n\n", string(finishBytes)); err != nil {
+					return err
+				}
+			}
+			if err := sse.Printf("data: [DONE]\n\n"); err != nil {
+				return err
 			}
-			fmt.Fprintf(w, "data: [DONE]\n\n")
-			flusher.Flush()
-			return nil
+			return sse.Flush()
 		}
 
 		// 尝试解析 JSON
@@ -698,8 +747,12 @@ func (s *OpenAIService) streamConvertedResponse(w http.ResponseWriter, resp *htt
 
 		// 检查是否已经是 OpenAI Chat Completion 格式
 		if _, hasChoices := raw["choices"]; hasChoices {
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
+			if err := sse.Printf("data: %s\n\n", data); err != nil {
+				return err
+			}
+			if err := sse.Flush(); err != nil {
+				return err
+			}
 			sentFirstChunk = true
 			continue
 		}
@@ -759,8 +812,12 @@ func (s *OpenAIService) streamConvertedResponse(w http.ResponseWriter, resp *htt
 			}
 
 			newBytes, _ := json.Marshal(chunk)
-			fmt.Fprintf(w, "data: %s\n\n", string(newBytes))
-			flusher.Flush()
+			if err := sse.Printf("data: %s\n\n", string(newBytes)); err != nil {
+				return err
+			}
+			if err := sse.Flush(); err != nil {
+				return err
+			}
 			sentFirstChunk = true
 		}
 	}
@@ -817,13 +874,24 @@ func stringPtr(s string) *string {
 
 // ResponsesProxy 代理responses请求
 func (s *OpenAIService) ResponsesProxy(ctx context.Context, w http.ResponseWriter, body []byte) error {
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	_ = json.Unmarshal(body, &req)
+
 	resp, err := s.Responses(ctx, body)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	return StreamResponse(w, resp)
+	if req.Stream && resp.StatusCode < 400 {
+		resp.Body = trackStreamCost(resp.Body, req.Model, StreamProtocolResponses)
+		resp.Body = paceStream(ctx, resp.Body, req.Model, StreamProtocolResponses)
+	}
+
+	return StreamResponse(ctx, w, resp)
 }
 
 // retryWithProxy 使用代理池重试OpenAI请求
@@ -835,88 +903,36 @@ func (s *OpenAIService) retryWithProxy(ctx context.Context, account *model.Accou
 	}
 
 	proxyPool := provider.GetProxyPool()
-	if !proxyPool.HasProxies() {
-		return nil, fmt.Errorf("没有可用的代理")
+	region := accountProxyRegion(proxyPool, account)
+	if !proxyPool.HasProxiesInRegion(region) {
+		return nil, regionProxyError(region)
 	}
 
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		// 获取随机代理
-		proxyURL := proxyPool.GetRandomProxy()
-		if proxyURL == "" {
+		// 获取随机代理，账号固定了地区时只在该地区内选择
+		proxyURL := proxyPool.GetRandomProxyInRegion(region)
+		if proxyURL == "" || !proxyHealthy(proxyURL) {
 			continue
 		}
 
-		log.Printf("[OpenAI] 尝试代理 %s (重试 %d/%d)", proxyURL, i+1, maxRetries)
+		LogEvent(ctx, slog.LevelInfo, "OpenAI", "尝试代理", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("attempt", i+1), slog.Int("max_attempts", maxRetries))
 
 		// 创建使用代理的HTTP客户端
-		proxyClient, err := provider.NewHTTPClientWithProxy(proxyURL, 0)
+		proxyClient, err := s.deps.Upstream.ProxyClient(proxyURL, zenModel)
 		if err != nil {
-			log.Printf("[OpenAI] 创建代理客户端失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "OpenAI", "创建代理客户端失败", slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
 		// 将模型参数合并到请求体中
-		modifiedBody := body
-		if zenModel.Parameters != nil {
-			var raw map[string]interface{}
-			if json.Unmarshal(modifiedBody, &raw) == nil {
-				// 添加 reasoning 配置
-				if zenModel.Parameters.Reasoning != nil && raw["reasoning"] == nil {
-					reasoningMap := map[string]interface{}{
-						"effort": zenModel.Parameters.Reasoning.Effort,
-					}
-					if zenModel.Parameters.Reasoning.Summary != "" {
-						reasoningMap["summary"] = zenModel.Parameters.Reasoning.Summary
-					}
-					raw["reasoning"] = reasoningMap
-				}
-				
-				// 添加 text 配置
-				if zenModel.Parameters.Text != nil && raw["text"] == nil {
-					raw["text"] = map[string]interface{}{
-						"verbosity": zenModel.Parameters.Text.Verbosity,
-					}
-				}
-				
-				// 添加 temperature 配置
-				if zenModel.Parameters.Temperature != nil && raw["temperature"] == nil {
-					raw["temperature"] = *zenModel.Parameters.Temperature
-				}
-				
-				modifiedBody, _ = json.Marshal(raw)
-			}
-		}
-
-		// 特殊模型的额外处理
-		if modelID == "gpt-5-nano-2025-08-07" {
-			var raw map[string]interface{}
-			if json.Unmarshal(modifiedBody, &raw) == nil {
-				if _, ok := raw["text"]; !ok {
-					raw["text"] = map[string]string{"verbosity": "medium"}
-				}
-				if _, ok := raw["temperature"]; !ok {
-					raw["temperature"] = 1
-				}
-				raw["stream"] = true
-				if reasoning, ok := raw["reasoning"].(map[string]interface{}); ok {
-					reasoning["summary"] = "auto"
-					raw["reasoning"] = reasoning
-				} else {
-					raw["reasoning"] = map[string]interface{}{
-						"effort":  "minimal",
-						"summary": "auto",
-					}
-				}
-				modifiedBody, _ = json.Marshal(raw)
-			}
-		}
+		modifiedBody := applyOpenAIModelParameters(body, zenModel.Parameters)
 
 		// 创建新请求
 		reqURL := OpenAIBaseURL + path
 		httpReq, err := http.NewRequest("POST", reqURL, bytes.NewReader(modifiedBody))
 		if err != nil {
-			log.Printf("[OpenAI] 创建请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "OpenAI", "创建请求失败", logError(err))
 			continue
 		}
 
@@ -937,7 +953,7 @@ func (s *OpenAIService) retryWithProxy(ctx context.Context, account *model.Accou
 		// 执行请求
 		resp, err := proxyClient.Do(httpReq)
 		if err != nil {
-			log.Printf("[OpenAI] 代理请求失败: %v", err)
+			LogEvent(ctx, slog.LevelWarn, "OpenAI", "代理请求失败", logAccountID(account.ID), slog.String("proxy", proxyURL), logError(err))
 			continue
 		}
 
@@ -945,7 +961,7 @@ func (s *OpenAIService) retryWithProxy(ctx context.Context, account *model.Accou
 		if resp.StatusCode == 429 {
 			// 仍然是429，尝试下一个代理
 			resp.Body.Close()
-			log.Printf("[OpenAI] 代理 %s 仍返回429，尝试下一个", proxyURL)
+			LogEvent(ctx, slog.LevelWarn, "OpenAI", "代理仍返回429，尝试下一个", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode))
 			continue
 		}
 
@@ -953,12 +969,12 @@ func (s *OpenAIService) retryWithProxy(ctx context.Context, account *model.Accou
 			// 其他错误，记录并尝试下一个代理
 			errBody, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			log.Printf("[OpenAI] 代理 %s 返回错误 %d: %s", proxyURL, resp.StatusCode, string(errBody))
+			LogEvent(ctx, slog.LevelWarn, "OpenAI", "代理返回错误", logAccountID(account.ID), slog.String("proxy", proxyURL), slog.Int("status", resp.StatusCode), slog.String("body", string(errBody)))
 			continue
 		}
 
 		// 成功
-		log.Printf("[OpenAI] 代理 %s 请求成功", proxyURL)
+		LogEvent(ctx, slog.LevelInfo, "OpenAI", "代理请求成功", logAccountID(account.ID), slog.String("proxy", proxyURL))
 		return resp, nil
 	}
 
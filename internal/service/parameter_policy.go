@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"zencoder2api/internal/model"
+)
+
+// Chat 请求参数的处理方式
+const (
+	ParameterPolicyPass  = "pass"  // 原样转发
+	ParameterPolicyDrop  = "drop"  // 删除后转发，参数名写入 X-Dropped-Parameters
+	ParameterPolicyError = "error" // 返回 400
+)
+
+// DroppedParametersHeader 列出按参数策略删除的请求参数，逗号分隔
+const DroppedParametersHeader = "X-Dropped-Parameters"
+
+// defaultParameterPolicies 模型未配置时按服务商使用的策略：OpenAI 模型走 Responses API，不接受 seed 和 logit_bias
+var defaultParameterPolicies = map[string]map[string]string{
+	"openai": {
+		"seed":       ParameterPolicyDrop,
+		"logit_bias": ParameterPolicyDrop,
+	},
+}
+
+// validateParameterPolicy 校验模型表中的参数策略
+func validateParameterPolicy(policy map[string]string) error {
+	for param, action := range policy {
+		if strings.TrimSpace(param) == "" {
+			return invalidRequest("parameterPolicy keys must not be empty")
+		}
+		switch action {
+		case ParameterPolicyPass, ParameterPolicyDrop, ParameterPolicyError:
+		default:
+			return invalidRequest("parameterPolicy.%s must be one of pass/drop/error", param)
+		}
+	}
+	return nil
+}
+
+// chatParameterPolicy 服务商默认策略叠加模型表中的策略
+func chatParameterPolicy(zenModel model.ZenModel) map[string]string {
+	policy := make(map[string]string)
+	for param, action := range defaultParameterPolicies[zenModel.ProviderID] {
+		policy[param] = action
+	}
+	if zenModel.Parameters != nil {
+		for param, action := range zenModel.Parameters.ParameterPolicy {
+			policy[param] = action
+		}
+	}
+	return policy
+}
+
+// ApplyChatParameterPolicy 按模型的参数策略处理 Chat 请求体，返回处理后的请求体和被删除的参数（按名称排序）；
+// 请求包含策略为 error 的参数时返回 *InvalidRequestError
+func ApplyChatParameterPolicy(zenModel model.ZenModel, body []byte) ([]byte, []string, error) {
+	policy := chatParameterPolicy(zenModel)
+	if len(policy) == 0 {
+		return body, nil, nil
+	}
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(body, &raw) != nil {
+		return body, nil, nil
+	}
+
+	var dropped, rejected []string
+	for param, action := range policy {
+		if _, ok := raw[param]; !ok {
+			continue
+		}
+		switch action {
+		case ParameterPolicyDrop:
+			dropped = append(dropped, param)
+		case ParameterPolicyError:
+			rejected = append(rejected, param)
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		return nil, nil, invalidRequest("unsupported parameter(s) for this model: %s", strings.Join(rejected, ", "))
+	}
+	if len(dropped) == 0 {
+		return body, nil, nil
+	}
+	sort.Strings(dropped)
+	for _, param := range dropped {
+		delete(raw, param)
+	}
+	modified, err := json.Marshal(raw)
+	if err != nil {
+		return body, nil, nil
+	}
+	return modified, dropped, nil
+}
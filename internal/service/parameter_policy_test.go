@@ -0,0 +1,53 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"zencoder2api/internal/model"
+)
+
+func TestApplyChatParameterPolicyDropsOpenAIDefaults(t *testing.T) {
+	openai := model.ZenModel{ID: "gpt-5.1-codex", ProviderID: "openai"}
+	body := []byte(`{"model":"gpt-5.1-codex","seed":7,"logit_bias":{"50256":-100},"temperature":0.2}`)
+
+	out, dropped, err := ApplyChatParameterPolicy(openai, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dropped, []string{"logit_bias", "seed"}) {
+		t.Errorf("dropped = %v", dropped)
+	}
+	var raw map[string]interface{}
+	json.Unmarshal(out, &raw)
+	if _, ok := raw["seed"]; ok || raw["temperature"] != 0.2 {
+		t.Errorf("body = %s", out)
+	}
+
+	// 其他服务商默认原样转发
+	anthropic := model.ZenModel{ID: "claude", ProviderID: "anthropic"}
+	if out, dropped, err := ApplyChatParameterPolicy(anthropic, body); err != nil || dropped != nil || string(out) != string(body) {
+		t.Errorf("anthropic: %s %v %v", out, dropped, err)
+	}
+}
+
+func TestApplyChatParameterPolicyModelOverrides(t *testing.T) {
+	m := model.ZenModel{ID: "gpt-5.1-codex", ProviderID: "openai", Parameters: &model.ModelParameters{
+		ParameterPolicy: map[string]string{"seed": ParameterPolicyError, "logit_bias": ParameterPolicyPass},
+	}}
+	_, _, err := ApplyChatParameterPolicy(m, []byte(`{"seed":1}`))
+	var invalid *InvalidRequestError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("err = %v", err)
+	}
+	body := []byte(`{"logit_bias":{"1":2}}`)
+	if out, dropped, err := ApplyChatParameterPolicy(m, body); err != nil || dropped != nil || string(out) != string(body) {
+		t.Errorf("pass: %s %v %v", out, dropped, err)
+	}
+
+	if err := validateParameterPolicy(map[string]string{"seed": "ignore"}); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"zencoder2api/internal/database"
 	"zencoder2api/internal/model"
+
+	"gorm.io/gorm"
 )
 
 type AccountPool struct {
@@ -17,13 +19,14 @@ type AccountPool struct {
 	index    uint64
 	maxErrs  int
 	stopChan chan struct{}
+	stopOnce sync.Once
 }
 
 var pool *AccountPool
 
 func init() {
 	pool = &AccountPool{
-		maxErrs:  3,
+		maxErrs:  model.MaxAccountErrors,
 		accounts: make([]*model.Account, 0),
 		stopChan: make(chan struct{}),
 	}
@@ -31,38 +34,26 @@ func init() {
 
 // InitAccountPool 初始化账号池并启动刷新协程
 func InitAccountPool() {
-	// 数据迁移：将旧字段状态迁移到 Status
-	pool.migrateData()
-	
+	// 恢复上一个实例交接的冻结/占用状态
+	LoadPoolState()
+
 	// 初始加载
 	pool.refresh()
 	// 启动后台刷新
 	go pool.refreshLoop()
 }
 
-func (p *AccountPool) migrateData() {
-	db := database.GetDB()
-	// 默认设为 normal
-	db.Model(&model.Account{}).Where("status = '' OR status IS NULL").Update("status", "normal")
-	
-	// 迁移冷却状态
-	db.Model(&model.Account{}).Where("is_cooling = ?", true).Update("status", "cooling")
-	
-	// 迁移错误封禁状态
-	db.Model(&model.Account{}).Where("is_active = ? AND error_count >= ?", false, p.maxErrs).Update("status", "error")
-	
-	// 迁移手动禁用状态 (!Active && !Cooling && Error < Max)
-	db.Model(&model.Account{}).Where("is_active = ? AND is_cooling = ? AND error_count < ?", false, false, p.maxErrs).Update("status", "disabled")
-	
-	// 迁移 category 到 status (如果 category 是 banned/error/cooling/abnormal)
-	db.Model(&model.Account{}).Where("category = ?", "banned").Update("status", "banned")
-	db.Model(&model.Account{}).Where("category = ?", "error").Update("status", "error")
-	db.Model(&model.Account{}).Where("category = ?", "cooling").Update("status", "cooling")
-	db.Model(&model.Account{}).Where("category = ?", "abnormal").Update("status", "cooling")
+// StopAccountPool 停止后台刷新并保存号池运行时状态，供下一个实例恢复，同时写入未落库的用量统计
+func StopAccountPool() {
+	pool.stopOnce.Do(func() {
+		close(pool.stopChan)
+	})
+	SavePoolState()
+	FlushUsageStats()
 }
 
 func (p *AccountPool) refreshLoop() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(time.Duration(envPositiveInt("POOL_REFRESH_INTERVAL", 30)) * time.Second)
 	defer ticker.Stop()
 
 	for {
@@ -70,6 +61,10 @@ func (p *AccountPool) refreshLoop() {
 		case <-ticker.C:
 			p.refresh()
 			p.cleanupTimeoutAccounts() // 清理超时账号
+			SavePoolState()            // 定期保存，实例异常退出时也能交接大部分状态
+			FlushUsageStats()          // 用量统计写库
+			ReloadPoolReservations()   // 读取其他实例修改及已过期 Key 的预留
+			ReloadPoolProxies()        // 读取其他实例添加或删除的代理
 		case <-p.stopChan:
 			return
 		}
@@ -84,12 +79,8 @@ func (p *AccountPool) cleanupTimeoutAccounts() {
 	
 	cleanedCount := 0
 	for _, status := range accountStatuses {
-		// 清理超过60秒还在使用中的账号
-		if status.InUse && !status.InUseSince.IsZero() && now.Sub(status.InUseSince) > 60*time.Second {
-			status.InUse = false
-			status.InUseSince = time.Time{}
-			cleanedCount++
-		}
+		// 清理超过60秒还未释放的占用
+		cleanedCount += status.expireLeases(now, 60*time.Second)
 	}
 	
 	if cleanedCount > 0 {
@@ -98,12 +89,16 @@ func (p *AccountPool) cleanupTimeoutAccounts() {
 }
 
 func (p *AccountPool) refresh() {
+	// 数据库降级期间继续使用内存中的账号快照
+	if !database.Healthy() {
+		log.Printf("[AccountPool] 数据库不可用，沿用内存中的 %d 个账号", p.count())
+		return
+	}
+
 	// 先恢复冷却账号
 	recoverCoolingAccounts()
 
-	// 刷新即将过期的token（1小时内过期）
-	p.refreshExpiredTokens()
-
+	// token 刷新由独立的调度器负责（StartTokenRefreshScheduler），这里只读库并替换缓存，不等待网络请求
 	var dbAccounts []model.Account
 	// 只查询状态为 normal 的账号
 	result := database.GetDB().Where("status = ?", "normal").
@@ -136,100 +131,31 @@ func (p *AccountPool) refresh() {
 	p.accounts = newAccounts
 }
 
-// refreshExpiredTokens 刷新即将过期的账号token
-func (p *AccountPool) refreshExpiredTokens() {
-	now := time.Now()
-	threshold := now.Add(time.Hour) // 1小时内即将过期的token
-
-	var expiredAccounts []model.Account
-	// 只排除banned状态的账号，其他状态的账号仍可以刷新token
-	result := database.GetDB().Where("status != ?", "banned").
-		Where("client_id != '' AND client_secret != ''").
-		Where("token_expiry < ?", threshold).
-		Find(&expiredAccounts)
-
-	if result.Error != nil {
-		log.Printf("[AccountPool] 查询即将过期的账号失败: %v", result.Error)
-		return
-	}
-
-	// 额外验证：再次过滤掉banned状态的账号
-	var validAccounts []model.Account
-	for _, acc := range expiredAccounts {
-		if acc.Status != "banned" {
-			validAccounts = append(validAccounts, acc)
-		}
-	}
-	expiredAccounts = validAccounts
-
-	if len(expiredAccounts) == 0 {
-		return
-	}
-
-	log.Printf("[AccountPool] 发现 %d 个非封禁账号的token需要刷新", len(expiredAccounts))
-
-	// 限制并发刷新数量，避免对API造成压力
-	semaphore := make(chan struct{}, 10) // 最多10个并发
-	var refreshCount int32
-	var successCount int32
-
-	// 并发刷新token
-	for i := range expiredAccounts {
-		account := &expiredAccounts[i]
-		
-		go func(acc *model.Account) {
-			semaphore <- struct{}{} // 获取信号量
-			defer func() { <-semaphore }() // 释放信号量
-			
-			refreshCount++
-			
-			// 根据账号类型选择不同的刷新方式
-			if acc.ClientSecret == "refresh-token-login" {
-				// refresh-token-login 账号使用 refresh_token 刷新
-				if err := p.refreshRefreshTokenAccount(acc); err != nil {
-					log.Printf("[AccountPool] refresh-token账号 %s (ID:%d) token刷新失败: %v",
-						acc.ClientID, acc.ID, err)
-				} else {
-					successCount++
-					log.Printf("[AccountPool] refresh-token账号 %s (ID:%d) token刷新成功，新过期时间: %s",
-						acc.ClientID, acc.ID, acc.TokenExpiry.Format("2006-01-02 15:04:05"))
-				}
-			} else {
-				// 普通账号使用 OAuth client credentials 刷新
-				if err := p.refreshSingleAccountToken(acc); err != nil {
-					log.Printf("[AccountPool] 账号 %s (ID:%d) token刷新失败: %v",
-						acc.ClientID, acc.ID, err)
-				} else {
-					successCount++
-					log.Printf("[AccountPool] 账号 %s (ID:%d) token刷新成功，新过期时间: %s",
-						acc.ClientID, acc.ID, acc.TokenExpiry.Format("2006-01-02 15:04:05"))
-				}
-			}
-		}(account)
-	}
-
-	// 等待所有刷新完成（最多等待30秒）
-	timeout := time.After(30 * time.Second)
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+func (p *AccountPool) count() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.accounts)
+}
 
-	for {
-		select {
-		case <-timeout:
-			log.Printf("[AccountPool] Token刷新超时，已完成 %d/%d", refreshCount, len(expiredAccounts))
-			return
-		case <-ticker.C:
-			if int(refreshCount) >= len(expiredAccounts) {
-				log.Printf("[AccountPool] Token刷新完成：成功 %d/%d", successCount, len(expiredAccounts))
-				return
-			}
-		}
+// PoolAccounts 返回号池内存快照中的账号副本，数据库不可用时用于输出指标
+func PoolAccounts() []model.Account {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	accounts := make([]model.Account, len(pool.accounts))
+	for i, acc := range pool.accounts {
+		accounts[i] = *acc
 	}
+	return accounts
 }
 
-// refreshSingleAccountToken 刷新单个账号的token
-func (p *AccountPool) refreshSingleAccountToken(account *model.Account) error {
-	return refreshAccountToken(account)
+// saveAccount 保存账号状态，数据库降级期间暂存，恢复后按顺序写入
+func saveAccount(account *model.Account) {
+	snapshot := *account
+	if err := database.Exec(fmt.Sprintf("save account %d", snapshot.ID), func(db *gorm.DB) error {
+		return db.Save(&snapshot).Error
+	}); err != nil {
+		log.Printf("[WARN] [AccountPool] 保存账号 %d 失败: %v", snapshot.ID, err)
+	}
 }
 
 func GetNextAccount() (*model.Account, error) {
@@ -238,10 +164,13 @@ func GetNextAccount() (*model.Account, error) {
 
 // AccountStatus 账号运行时状态
 type AccountStatus struct {
-	LastUsed       time.Time
-	InUse          bool
-	FrozenUntil    time.Time
-	InUseSince     time.Time // 记录开始使用的时间
+	LastUsed    time.Time
+	FrozenUntil time.Time
+	Leases      []time.Time // 未释放请求的开始时间，按先后排序，数量不超过 GetAccountConcurrency()
+	// Sessions 长连接（Realtime WebSocket）持有的名额，按句柄释放，不会超时自动释放（见 HoldAccount）
+	Sessions map[uint64]time.Time
+	// DrainingSince 非零表示维护排空中，不再调度新请求（见 DrainAccount）
+	DrainingSince time.Time
 }
 
 // 账号运行时状态管理
@@ -253,6 +182,15 @@ var (
 // GetNextAccountForModel 获取可用于指定模型的账号
 // 使用内存状态管理，避免高并发下的竞态条件
 func GetNextAccountForModel(modelID string) (*model.Account, error) {
+	return getNextAccount(modelID, 0)
+}
+
+// GetPreferredAccountForModel 与 GetNextAccountForModel 相同，但 preferredID 账号可用时优先选择它
+func GetPreferredAccountForModel(modelID string, preferredID uint) (*model.Account, error) {
+	return getNextAccount(modelID, preferredID)
+}
+
+func getNextAccount(modelID string, preferredID uint) (*model.Account, error) {
 	pool.mu.RLock()
 	accounts := pool.accounts // 获取账号列表引用
 	pool.mu.RUnlock()
@@ -261,13 +199,27 @@ func GetNextAccountForModel(modelID string) (*model.Account, error) {
 		return nil, ErrNoAvailableAccount
 	}
 
-	// 获取候选账号
-	var candidates []*model.Account
+	// 非 PremiumOnly 模型不能占用预留的 Max 账号
+	reserved := reservedForModel(accounts, modelID)
+	// 模型权限每个请求只查一次
+	allowed := model.AllowedPlans(modelID)
+
+	limit := GetAccountConcurrency()
+
+	// 遍历时直接挑选：优先指定账号（如最近处理过相同 prompt 前缀的账号），
+	// 否则选择占用最少的账号，占用相同时选最长时间未使用的，从未使用过的优先。
+	// 挑选和占用在同一把写锁内完成，避免并发请求同时挤进最后一个名额
+	var selected, preferred *model.Account
+	var selectedStatus, preferredStatus *AccountStatus
+	candidates := 0
 	now := time.Now()
-	statusMu.RLock()
+	statusMu.Lock()
 	for _, acc := range accounts {
 		// 检查模型权限
-		if modelID != "" && !model.CanUseModel(acc.PlanType, modelID) {
+		if !allowed.Has(acc.PlanType) {
+			continue
+		}
+		if reserved[acc.ID] {
 			continue
 		}
 		
@@ -275,45 +227,64 @@ func GetNextAccountForModel(modelID string) (*model.Account, error) {
 		status, exists := accountStatuses[acc.ID]
 		if !exists {
 			// 初始化状态
-			accountStatuses[acc.ID] = &AccountStatus{
+			status = &AccountStatus{
 				LastUsed:    acc.LastUsed,
-				InUse:       false,
 				FrozenUntil: acc.CoolingUntil,
-				InUseSince:  time.Time{},
 			}
-			status = accountStatuses[acc.ID]
+			accountStatuses[acc.ID] = status
 		}
 		
-		// 自动释放超时账号（超过30秒未释放的账号）
-		if status.InUse && !status.InUseSince.IsZero() && now.Sub(status.InUseSince) > 30*time.Second {
-			status.InUse = false
-			status.InUseSince = time.Time{}
-			log.Printf("[WARN] 账号 %s (ID:%d) 使用超时，已自动释放", acc.Email, acc.ID)
+		// 自动释放超时占用（超过30秒未释放）
+		if n := status.expireLeases(now, 30*time.Second); n > 0 {
+			log.Printf("[WARN] 账号 %s (ID:%d) 有 %d 个请求使用超时，已自动释放", acc.Email, acc.ID, n)
 		}
 		
-		// 检查是否可用（未被使用且未被冻结）
-		if !status.InUse && now.After(status.FrozenUntil) {
-			candidates = append(candidates, acc)
+		// 检查是否可用（未排空、并发未满且未被冻结）
+		if status.Draining() || status.Full(limit) || !now.After(status.FrozenUntil) {
+			continue
+		}
+		candidates++
+		if acc.ID == preferredID {
+			preferred, preferredStatus = acc, status
+		}
+		if selected == nil || lessLoaded(status, selectedStatus) {
+			selected, selectedStatus = acc, status
 		}
 	}
-	statusMu.RUnlock()
 
-	if len(candidates) == 0 {
+	if candidates > 0 {
+		if preferred != nil {
+			selected, selectedStatus = preferred, preferredStatus
+		}
+		// 立即在内存中占用一个并发名额
+		selectedStatus.acquire(time.Now())
+	}
+	statusMu.Unlock()
+
+	if candidates == 0 {
 		// 提供详细的调试信息
 		totalAccounts := len(accounts)
 		inUseCount := 0
 		frozenCount := 0
+		drainingCount := 0
 		noPermissionCount := 0
+		reservedCount := 0
 		
 		statusMu.RLock()
 		for _, acc := range accounts {
-			if modelID != "" && !model.CanUseModel(acc.PlanType, modelID) {
+			if !allowed.Has(acc.PlanType) {
 				noPermissionCount++
 				continue
 			}
+			if reserved[acc.ID] {
+				reservedCount++
+				continue
+			}
 			
 			if status, exists := accountStatuses[acc.ID]; exists {
-				if status.InUse {
+				if status.Draining() {
+					drainingCount++
+				} else if status.Full(limit) {
 					inUseCount++
 				} else if !now.After(status.FrozenUntil) {
 					frozenCount++
@@ -322,67 +293,27 @@ func GetNextAccountForModel(modelID string) (*model.Account, error) {
 		}
 		statusMu.RUnlock()
 		
-		log.Printf("[ERROR] 无可用账号 - 总账号数: %d, 权限不足: %d, 使用中: %d, 冻结中: %d, 模型: %s",
-			totalAccounts, noPermissionCount, inUseCount, frozenCount, modelID)
+		log.Printf("[ERROR] 无可用账号 - 总账号数: %d, 权限不足: %d, 高级模型预留: %d, 使用中: %d, 冻结中: %d, 排空中: %d, 模型: %s",
+			totalAccounts, noPermissionCount, reservedCount, inUseCount, frozenCount, drainingCount, modelID)
+		// 有权限的账号都在使用中、冻结中或被预留，计入号池饱和拒绝
+		if noPermissionCount < totalAccounts {
+			recordPoolRejection(modelID, now)
+		}
 			
 		return nil, ErrNoPermission
 	}
-
-	// 选择最长时间未使用的账号
-	var selected *model.Account
-	oldestTime := time.Now()
-	
-	statusMu.RLock()
-	for _, acc := range candidates {
-		status := accountStatuses[acc.ID]
-		if status == nil {
-			continue
-		}
-		
-		// 如果账号从未使用过，优先选择
-		if status.LastUsed.IsZero() {
-			selected = acc
-			break
-		}
-		// 选择最长时间未使用的账号
-		if status.LastUsed.Before(oldestTime) {
-			oldestTime = status.LastUsed
-			selected = acc
-		}
-	}
-	statusMu.RUnlock()
-	
-	// 如果没有找到合适的账号，使用轮询
-	if selected == nil {
-		selected = candidates[time.Now().UnixNano()%int64(len(candidates))]
-	}
-	
-	// 立即在内存中标记账号为使用中
-	statusMu.Lock()
-	currentTime := time.Now()
-	if status, exists := accountStatuses[selected.ID]; exists {
-		status.InUse = true
-		status.LastUsed = currentTime
-		status.InUseSince = currentTime
-	} else {
-		accountStatuses[selected.ID] = &AccountStatus{
-			LastUsed:    currentTime,
-			InUse:       true,
-			FrozenUntil: time.Time{},
-			InUseSince:  currentTime,
-		}
-	}
-	statusMu.Unlock()
 	
 	// 异步更新数据库
-	go func(acc *model.Account, usedTime time.Time) {
-		database.GetDB().Model(acc).Update("last_used", usedTime)
-	}(selected, time.Now())
+	go func(id uint, usedTime time.Time) {
+		database.Exec("update last_used", func(db *gorm.DB) error {
+			return db.Model(&model.Account{}).Where("id = ?", id).Update("last_used", usedTime).Error
+		})
+	}(selected.ID, time.Now())
 	
 	return selected, nil
 }
 
-// ReleaseAccount 释放账号（标记为未使用）
+// ReleaseAccount 释放账号的一个并发名额
 func ReleaseAccount(account *model.Account) {
 	if account == nil {
 		return
@@ -392,8 +323,30 @@ func ReleaseAccount(account *model.Account) {
 	defer statusMu.Unlock()
 	
 	if status, exists := accountStatuses[account.ID]; exists {
-		status.InUse = false
-		status.InUseSince = time.Time{} // 重置使用开始时间
+		status.release()
+	}
+}
+
+// HoldAccount 把已通过 GetNextAccountForModel 占用的名额转为长连接持有：连接期间不会被超时自动释放，
+// 返回的函数按句柄释放该名额（可重复调用），不会误释放其他请求的占用
+func HoldAccount(account *model.Account) func() {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status, exists := accountStatuses[account.ID]
+	if !exists {
+		status = &AccountStatus{}
+		accountStatuses[account.ID] = status
+	}
+	handle := status.hold(time.Now())
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			statusMu.Lock()
+			defer statusMu.Unlock()
+			if status, exists := accountStatuses[account.ID]; exists {
+				delete(status.Sessions, handle)
+			}
+		})
 	}
 }
 
@@ -412,7 +365,7 @@ func recoverCoolingAccounts() {
 		acc.Category = "normal" // 保持兼容
 		acc.Status = "normal"   // 恢复状态
 		acc.BanReason = ""      // 清除封禁原因
-		database.GetDB().Save(&acc)
+		saveAccount(&acc)
 		log.Printf("[INFO] 账号 %s (ID:%d) 冷却期结束，已恢复 (冷却结束时间: %s UTC)",
 			acc.Email, acc.ID, acc.CoolingUntil.Format("2006-01-02 15:04:05"))
 	}
@@ -426,17 +379,17 @@ func MarkAccountError(account *model.Account) {
 		account.Category = "error"
 		account.BanReason = "Error count exceeded limit"
 	}
-	database.GetDB().Save(account)
+	saveAccount(account)
 }
 
-// MarkAccountRateLimited 标记账号遇到 429 限流错误
-func MarkAccountRateLimited(account *model.Account) {
+// MarkAccountRateLimited 标记账号遇到 429 限流错误，冷却 cooling（默认1小时）
+func MarkAccountRateLimited(account *model.Account, cooling time.Duration) {
 	account.RateLimitHits++
 	account.IsCooling = true
 	account.IsActive = false
 
-	// 设置冷却时间：1小时（使用UTC时间）
-	account.CoolingUntil = time.Now().UTC().Add(1 * time.Hour)
+	// 设置冷却时间（使用UTC时间）
+	account.CoolingUntil = time.Now().UTC().Add(cooling)
 
 	// 更新状态
 	oldStatus := account.Status
@@ -444,7 +397,7 @@ func MarkAccountRateLimited(account *model.Account) {
 	account.Category = "cooling"
 	account.BanReason = "Rate limited (429)"
 
-	database.GetDB().Save(account)
+	saveAccount(account)
 
 	log.Printf("[WARN] 账号 %s (ID:%d) 遇到 429 限流 (第 %d 次)，已移至冷却分组，冷却至 %s UTC",
 		account.Email, account.ID, account.RateLimitHits, account.CoolingUntil.Format("2006-01-02 15:04:05"))
@@ -455,10 +408,11 @@ func MarkAccountRateLimited(account *model.Account) {
 }
 
 // MarkAccountRateLimitedWithResponse 根据响应头信息处理429限流错误
-func MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Response) {
+// 积分耗尽时冷却到积分刷新时间，其余情况冷却 cooling
+func MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Response, cooling time.Duration) {
 	if resp == nil || resp.Header == nil {
 		// 如果没有响应头，使用默认处理
-		MarkAccountRateLimited(account)
+		MarkAccountRateLimited(account, cooling)
 		return
 	}
 	
@@ -500,7 +454,7 @@ func MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Respo
 					account.Email, account.ID, endTime.Format("2006-01-02 15:04:05"))
 			} else {
 				// 解析失败，使用默认冷却时间
-				account.CoolingUntil = time.Now().UTC().Add(1 * time.Hour)
+				account.CoolingUntil = time.Now().UTC().Add(cooling)
 				account.BanReason = "Quota exhausted (429) - fallback cooling"
 				
 				log.Printf("[WARN] 账号 %s (ID:%d) 积分耗尽但无法解析刷新时间，使用默认冷却: %s UTC",
@@ -508,7 +462,7 @@ func MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Respo
 			}
 		} else {
 			// 没有periodEnd，使用默认冷却时间
-			account.CoolingUntil = time.Now().UTC().Add(1 * time.Hour)
+			account.CoolingUntil = time.Now().UTC().Add(cooling)
 			account.BanReason = "Quota exhausted (429) - no end time"
 			
 			log.Printf("[WARN] 账号 %s (ID:%d) 积分耗尽但无刷新时间信息，使用默认冷却: %s UTC",
@@ -516,35 +470,35 @@ func MarkAccountRateLimitedWithResponse(account *model.Account, resp *http.Respo
 		}
 	} else {
 		// 常规429限流错误，使用默认冷却时间
-		account.CoolingUntil = time.Now().UTC().Add(1 * time.Hour)
+		account.CoolingUntil = time.Now().UTC().Add(cooling)
 		account.BanReason = "Rate limited (429)"
 		
 		log.Printf("[WARN] 账号 %s (ID:%d) 遇到常规429限流 (第 %d 次)，冷却至: %s UTC",
 			account.Email, account.ID, account.RateLimitHits, account.CoolingUntil.Format("2006-01-02 15:04:05"))
 	}
 	
-	database.GetDB().Save(account)
+	saveAccount(account)
 	
 	if oldStatus != "cooling" {
 		log.Printf("[INFO] 账号 %s 状态变更: %s -> cooling", account.Email, oldStatus)
 	}
 }
 
-// MarkAccountRateLimitedShort 标记账号遇到 429 限流错误（短期冷却）
-func MarkAccountRateLimitedShort(account *model.Account) {
+// MarkAccountRateLimitedShort 标记账号遇到 429 限流错误（短期冷却，默认5秒）
+func MarkAccountRateLimitedShort(account *model.Account, cooling time.Duration) {
 	account.RateLimitHits++
 	account.IsCooling = true
 	account.IsActive = false
 
-	// 设置短期冷却时间：5秒（使用UTC时间）
-	account.CoolingUntil = time.Now().UTC().Add(5 * time.Second)
+	// 设置短期冷却时间（使用UTC时间）
+	account.CoolingUntil = time.Now().UTC().Add(cooling)
 
 	// 更新状态
 	account.Status = "cooling"
 	account.Category = "cooling"
 	account.BanReason = "Rate limited (429) - short cooling"
 
-	database.GetDB().Save(account)
+	saveAccount(account)
 	
 	log.Printf("[INFO] 账号 %s (ID:%d) 短期冷却，冷却至 %s UTC",
 		account.Email, account.ID, account.CoolingUntil.Format("2006-01-02 15:04:05"))
@@ -562,14 +516,11 @@ func FreezeAccount(account *model.Account, duration time.Duration) {
 	statusMu.Lock()
 	if status, exists := accountStatuses[account.ID]; exists {
 		status.FrozenUntil = freezeUntil
-		status.InUse = false // 释放账号
-		status.InUseSince = time.Time{} // 重置使用开始时间
+		status.release() // 释放当前请求占用的名额
 	} else {
 		accountStatuses[account.ID] = &AccountStatus{
 			LastUsed:    time.Now(),
-			InUse:       false,
 			FrozenUntil: freezeUntil,
-			InUseSince:  time.Time{},
 		}
 	}
 	statusMu.Unlock()
@@ -586,13 +537,13 @@ func FreezeAccount(account *model.Account, duration time.Duration) {
 		account.Category = "cooling"
 		account.BanReason = "Rate limit tracking problem (500)"
 		
-		database.GetDB().Save(account)
+		saveAccount(account)
 	}()
 }
 
 func ResetAccountError(account *model.Account) {
 	account.ErrorCount = 0
-	database.GetDB().Save(account)
+	saveAccount(account)
 }
 
 // 扣减积分并检查是否需要冷却
@@ -600,6 +551,7 @@ func UseCredit(account *model.Account, multiplier float64) {
 	account.DailyUsed += multiplier
 	account.TotalUsed += multiplier
 	account.LastUsed = time.Now()  // 更新最后使用时间
+	recordAccountUsage(account.ID, multiplier, account.LastUsed)
 
 	limit := float64(model.PlanLimits[account.PlanType])
 	if account.DailyUsed >= limit {
@@ -609,7 +561,7 @@ func UseCredit(account *model.Account, multiplier float64) {
 		account.BanReason = "Daily quota exceeded"
 	}
 
-	database.GetDB().Save(account)
+	saveAccount(account)
 }
 
 // UpdateAccountCreditsFromResponse 根据响应头中的积分信息更新账号
@@ -644,6 +596,8 @@ func UpdateAccountCreditsFromResponse(account *model.Account, resp *http.Respons
 	// 如果有 periodCost，更新账号的总使用量（当日总计）
 	if periodCost != "" {
 		if val := parseFloat(periodCost); val >= 0 {
+			// 与上一次报告比对，发现网关之外的用量
+			checkAccountUsage(account, val, creditUsed, periodEnd)
 			// 直接使用API返回的当日使用量
 			account.DailyUsed = val
 			hasAPICredits = true
@@ -681,6 +635,11 @@ func UpdateAccountCreditsFromResponse(account *model.Account, resp *http.Respons
 		if requestCost != "" && creditUsed > 0 {
 			account.TotalUsed += creditUsed
 		}
+		if creditUsed > 0 {
+			recordAccountUsage(account.ID, creditUsed, account.LastUsed)
+		} else {
+			recordAccountUsage(account.ID, modelMultiplier, account.LastUsed)
+		}
 		
 		// 检查是否需要冷却
 		limit := float64(model.PlanLimits[account.PlanType])
@@ -705,7 +664,7 @@ func UpdateAccountCreditsFromResponse(account *model.Account, resp *http.Respons
 			}
 		}
 		
-		database.GetDB().Save(account)
+		saveAccount(account)
 		
 		// 输出调试日志（仅在调试模式下）
 		if IsDebugMode() && (requestCost != "" || periodCost != "") {
@@ -727,40 +686,3 @@ func parseFloat(s string) float64 {
 	_, _ = fmt.Sscanf(s, "%f", &val)
 	return val
 }
-
-// refreshRefreshTokenAccount 使用 refresh_token 刷新账号 token (用于 refresh-token-login 类型的账号)
-func (p *AccountPool) refreshRefreshTokenAccount(account *model.Account) error {
-	if account.RefreshToken == "" {
-		return fmt.Errorf("账号 %s 缺少 refresh_token", account.ClientID)
-	}
-
-	// 调用 zencoder auth API 刷新 token
-	tokenResp, err := RefreshAccessToken(account.RefreshToken, account.Proxy)
-	if err != nil {
-		return fmt.Errorf("调用 zencoder auth API 失败: %w", err)
-	}
-
-	// 计算过期时间
-	expiry := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-
-	// 更新数据库
-	updates := map[string]interface{}{
-		"access_token":  tokenResp.AccessToken,
-		"refresh_token": tokenResp.RefreshToken,
-		"token_expiry":  expiry,
-		"updated_at":    time.Now(),
-	}
-
-	if err := database.GetDB().Model(&model.Account{}).
-		Where("id = ?", account.ID).
-		Updates(updates).Error; err != nil {
-		return fmt.Errorf("更新数据库失败: %w", err)
-	}
-
-	// 更新内存中的值
-	account.AccessToken = tokenResp.AccessToken
-	account.RefreshToken = tokenResp.RefreshToken
-	account.TokenExpiry = expiry
-
-	return nil
-}
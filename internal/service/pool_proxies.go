@@ -0,0 +1,184 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+
+	"gorm.io/gorm"
+)
+
+// 代理池条目的来源
+const (
+	PoolProxySourceEnv = "env" // SOCKS_PROXY_POOL，只能通过修改环境变量并重启调整
+	PoolProxySourceDB  = "db"  // 通过 /api/proxies 添加
+)
+
+// maxPoolProxyRegionLength 地区标签的最大长度，与表字段一致
+const maxPoolProxyRegionLength = 32
+
+// PoolProxyInfo 代理池条目，认证信息已隐藏
+type PoolProxyInfo struct {
+	ID        uint               `json:"id,omitempty"` // 只有运行时添加的代理有 ID
+	URL       string             `json:"url"`
+	Region    string             `json:"region,omitempty"`
+	Source    string             `json:"source"`
+	CreatedAt *time.Time         `json:"created_at,omitempty"`
+	Health    *model.ProxyHealth `json:"health,omitempty"` // 最近一次健康检查结果
+}
+
+// LoadPoolProxies 从数据库加载运行时添加的代理到代理池，启动时、每次修改后和号池定期刷新时调用
+func LoadPoolProxies() error {
+	var proxies []model.PoolProxy
+	if err := database.GetDB().Order("id").Find(&proxies).Error; err != nil {
+		return err
+	}
+	entries := make([]provider.ProxyEntry, len(proxies))
+	for i, p := range proxies {
+		entries[i] = provider.ProxyEntry{URL: p.URL, Region: p.Region}
+	}
+	provider.GetProxyPool().SetExtraProxies(entries)
+	return nil
+}
+
+// ReloadPoolProxies 重新加载代理池，读取其他实例的修改；数据库不可用时保留当前代理
+func ReloadPoolProxies() {
+	if !database.Healthy() {
+		return
+	}
+	if err := LoadPoolProxies(); err != nil {
+		log.Printf("[WARN] [ProxyPool] 重新加载代理失败: %v", err)
+	}
+}
+
+// ListPoolProxies 返回 SOCKS_PROXY_POOL 和运行时添加的代理
+func ListPoolProxies() ([]PoolProxyInfo, error) {
+	var stored []model.PoolProxy
+	if err := database.GetDB().Order("id").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	env := provider.GetProxyPool().EnvProxies()
+	result := make([]PoolProxyInfo, 0, len(env)+len(stored))
+	for _, entry := range env {
+		result = append(result, PoolProxyInfo{
+			URL:    maskProxyURL(entry.URL),
+			Region: entry.Region,
+			Source: PoolProxySourceEnv,
+			Health: getProxyHealth(entry.URL),
+		})
+	}
+	for _, p := range stored {
+		result = append(result, poolProxyInfo(p))
+	}
+	return result, nil
+}
+
+func poolProxyInfo(p model.PoolProxy) PoolProxyInfo {
+	return PoolProxyInfo{
+		ID:        p.ID,
+		URL:       maskProxyURL(p.URL),
+		Region:    p.Region,
+		Source:    PoolProxySourceDB,
+		CreatedAt: timePtr(p.CreatedAt),
+		Health:    getProxyHealth(p.URL),
+	}
+}
+
+// normalizePoolProxyRequest 校验代理地址和地区
+func normalizePoolProxyRequest(req model.PoolProxyRequest) (string, string, error) {
+	raw := strings.TrimSpace(req.URL)
+	if raw == "" {
+		return "", "", invalidRequest("url is required")
+	}
+	if strings.Contains(raw, "#") {
+		return "", "", invalidRequest("set the region with the region field instead of a # suffix")
+	}
+	if _, err := provider.ParseProxyURL(raw); err != nil {
+		return "", "", invalidRequest("invalid proxy url: %v", err)
+	}
+	region := provider.NormalizeProxyRegion(req.Region)
+	if len(region) > maxPoolProxyRegionLength {
+		return "", "", invalidRequest("region must not exceed %d characters", maxPoolProxyRegionLength)
+	}
+	return raw, region, nil
+}
+
+// CreatePoolProxy 添加代理并立即加入代理池；地址已存在或 Test 为 true 且检查失败时返回 *InvalidRequestError
+func CreatePoolProxy(req model.PoolProxyRequest) (*PoolProxyInfo, error) {
+	raw, region, err := normalizePoolProxyRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if provider.GetProxyPool().Contains(raw) {
+		return nil, invalidRequest("proxy %s already exists", maskProxyURL(raw))
+	}
+	var count int64
+	if err := database.GetDB().Model(&model.PoolProxy{}).Where("url = ?", raw).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, invalidRequest("proxy %s already exists", maskProxyURL(raw))
+	}
+	if req.Test {
+		if health := TestProxy(raw); !health.Healthy {
+			return nil, invalidRequest("proxy check failed: %s", health.Error)
+		}
+	}
+
+	p := model.PoolProxy{URL: raw, Region: region}
+	if err := database.GetDB().Create(&p).Error; err != nil {
+		return nil, err
+	}
+	ReloadPoolProxies()
+	info := poolProxyInfo(p)
+	return &info, nil
+}
+
+// DeletePoolProxy 删除运行时添加的代理，立即从代理池移除
+func DeletePoolProxy(id uint) error {
+	result := database.GetDB().Delete(&model.PoolProxy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	ReloadPoolProxies()
+	return nil
+}
+
+// TestPoolProxy 检查运行时添加的代理（id 非 0 时），或检查尚未添加的代理地址
+func TestPoolProxy(id uint, raw string) (model.ProxyHealth, error) {
+	if id != 0 {
+		var p model.PoolProxy
+		if err := database.GetDB().First(&p, id).Error; err != nil {
+			return model.ProxyHealth{}, err
+		}
+		return TestProxy(p.URL), nil
+	}
+	raw, _, err := normalizePoolProxyRequest(model.PoolProxyRequest{URL: raw})
+	if err != nil {
+		return model.ProxyHealth{}, err
+	}
+	return TestProxy(raw), nil
+}
+
+// TestProxy 立即检查代理是否可用，代理在池中时结果按健康检查的规则计入其状态
+func TestProxy(raw string) model.ProxyHealth {
+	settings := GetProxyHealthSettings()
+	start := time.Now()
+	latency, err := proxyHealthProbe(raw, time.Duration(settings.TimeoutSeconds)*time.Second)
+	if provider.GetProxyPool().Contains(raw) {
+		recordProxyHealth(raw, latency, err, settings.FailureThreshold, start)
+	}
+	result := model.ProxyHealth{Healthy: err == nil, LatencyMs: latency.Milliseconds(), CheckedAt: start}
+	if err != nil {
+		result.Failures = 1
+		result.Error = truncateUTF8(err.Error(), 200)
+	}
+	return result
+}
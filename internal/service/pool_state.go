@@ -0,0 +1,184 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// poolStateVersion 状态文件格式版本，不一致时忽略文件
+const poolStateVersion = 1
+
+// poolStateLastUsedWindow 只交接该时间内用过的账号的 LastUsed，更早的对调度顺序影响不大
+const poolStateLastUsedWindow = time.Hour
+
+// accountStateEntry 单个账号交接的运行时状态
+type accountStateEntry struct {
+	LastUsed    time.Time   `json:"lastUsed,omitempty"`
+	FrozenUntil time.Time   `json:"frozenUntil,omitempty"`
+	Leases      []time.Time `json:"leases,omitempty"`     // 保存时仍未释放的占用
+	InUseSince  time.Time   `json:"inUseSince,omitempty"` // 旧版本只记录一个占用，仅用于读取
+}
+
+// poolStateSnapshot 号池运行时状态快照
+type poolStateSnapshot struct {
+	Version  int                        `json:"version"`
+	SavedAt  time.Time                  `json:"savedAt"`
+	Accounts map[uint]accountStateEntry `json:"accounts"`
+}
+
+var (
+	poolStateFile     string
+	poolStateFileOnce sync.Once
+	poolStateSaveMu   sync.Mutex
+)
+
+// getPoolStateFile 读取 POOL_STATE_FILE，为空时不交接状态
+func getPoolStateFile() string {
+	poolStateFileOnce.Do(func() {
+		poolStateFile = strings.TrimSpace(os.Getenv("POOL_STATE_FILE"))
+	})
+	return poolStateFile
+}
+
+// snapshotAccountStatuses 复制需要交接的账号状态：冻结中、占用中或近期用过的账号
+func snapshotAccountStatuses(now time.Time) poolStateSnapshot {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+
+	snap := poolStateSnapshot{Version: poolStateVersion, SavedAt: now, Accounts: make(map[uint]accountStateEntry)}
+	for id, status := range accountStatuses {
+		entry := accountStateEntry{}
+		if now.Before(status.FrozenUntil) {
+			entry.FrozenUntil = status.FrozenUntil
+		}
+		if status.InUse() {
+			entry.Leases = append([]time.Time(nil), status.Leases...)
+		}
+		if now.Sub(status.LastUsed) < poolStateLastUsedWindow {
+			entry.LastUsed = status.LastUsed
+		}
+		if !entry.LastUsed.IsZero() || !entry.FrozenUntil.IsZero() || len(entry.Leases) > 0 {
+			snap.Accounts[id] = entry
+		}
+	}
+	return snap
+}
+
+// restoreAccountStatuses 把快照合并进内存状态，已过期的冻结和占用不会恢复
+// 内存中已有的状态优先（取更晚的冻结时间和使用时间）
+func restoreAccountStatuses(snap poolStateSnapshot, now time.Time) int {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	restored := 0
+	for id, entry := range snap.Accounts {
+		status, exists := accountStatuses[id]
+		if !exists {
+			status = &AccountStatus{}
+		}
+		changed := false
+		if entry.FrozenUntil.After(now) && entry.FrozenUntil.After(status.FrozenUntil) {
+			status.FrozenUntil = entry.FrozenUntil
+			changed = true
+		}
+		// 旧实例的占用沿用原开始时间，超时后由自动释放逻辑回收
+		leases := entry.Leases
+		if len(leases) == 0 && !entry.InUseSince.IsZero() {
+			leases = []time.Time{entry.InUseSince}
+		}
+		if !status.InUse() {
+			for _, t := range leases {
+				if now.Sub(t) < 30*time.Second {
+					status.Leases = append(status.Leases, t)
+					changed = true
+				}
+			}
+		}
+		if entry.LastUsed.After(status.LastUsed) {
+			status.LastUsed = entry.LastUsed
+			changed = true
+		}
+		if changed {
+			accountStatuses[id] = status
+			restored++
+		}
+	}
+	return restored
+}
+
+// savePoolStateTo 原子写入状态文件（先写临时文件再重命名）
+func savePoolStateTo(path string, now time.Time) error {
+	poolStateSaveMu.Lock()
+	defer poolStateSaveMu.Unlock()
+
+	data, err := json.Marshal(snapshotAccountStatuses(now))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadPoolStateFrom 读取状态文件并合并到内存，文件不存在时返回 0
+func loadPoolStateFrom(path string, now time.Time) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var snap poolStateSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("解析状态文件失败: %w", err)
+	}
+	if snap.Version != poolStateVersion {
+		return 0, fmt.Errorf("状态文件版本 %d 不受支持", snap.Version)
+	}
+	return restoreAccountStatuses(snap, now), nil
+}
+
+// SavePoolState 把号池运行时状态（冻结、占用、最近使用）写入 POOL_STATE_FILE
+func SavePoolState() {
+	path := getPoolStateFile()
+	if path == "" {
+		return
+	}
+	if err := savePoolStateTo(path, time.Now()); err != nil {
+		log.Printf("[WARN] [PoolState] 保存号池状态失败: %v", err)
+	}
+}
+
+// LoadPoolState 启动时从 POOL_STATE_FILE 恢复上一个实例的号池运行时状态，
+// 避免滚动重启后冷却中的账号立即被重新调度
+func LoadPoolState() {
+	path := getPoolStateFile()
+	if path == "" {
+		return
+	}
+	restored, err := loadPoolStateFrom(path, time.Now())
+	if err != nil {
+		log.Printf("[WARN] [PoolState] 恢复号池状态失败: %v", err)
+		return
+	}
+	if restored > 0 {
+		log.Printf("[PoolState] 已从 %s 恢复 %d 个账号的运行时状态", path, restored)
+	}
+}
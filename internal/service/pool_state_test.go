@@ -0,0 +1,98 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// swapAccountStatuses 替换全局账号状态，返回恢复函数
+func swapAccountStatuses(statuses map[uint]*AccountStatus) func() {
+	statusMu.Lock()
+	saved := accountStatuses
+	accountStatuses = statuses
+	statusMu.Unlock()
+	return func() {
+		statusMu.Lock()
+		accountStatuses = saved
+		statusMu.Unlock()
+	}
+}
+
+func TestPoolStateHandoff(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "pool_state.json")
+
+	restore := swapAccountStatuses(map[uint]*AccountStatus{
+		1: {LastUsed: now.Add(-time.Minute), FrozenUntil: now.Add(10 * time.Minute)},
+		2: {LastUsed: now.Add(-5 * time.Second), Leases: []time.Time{now.Add(-5 * time.Second)}},
+		3: {LastUsed: now.Add(-2 * time.Hour), FrozenUntil: now.Add(-time.Minute)},
+	})
+	if err := savePoolStateTo(path, now); err != nil {
+		restore()
+		t.Fatalf("save: %v", err)
+	}
+	restore()
+
+	// 新实例启动时内存状态为空
+	defer swapAccountStatuses(make(map[uint]*AccountStatus))()
+	restored, err := loadPoolStateFrom(path, now.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if restored != 2 {
+		t.Errorf("restored = %d, want 2", restored)
+	}
+
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	if s := accountStatuses[1]; s == nil || !s.FrozenUntil.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("frozen account not restored: %+v", s)
+	}
+	if s := accountStatuses[2]; s == nil || !s.InUse() || !s.InUseSince().Equal(now.Add(-5*time.Second)) {
+		t.Errorf("leased account not restored: %+v", s)
+	}
+	if _, ok := accountStatuses[3]; ok {
+		t.Error("stale account should not be handed off")
+	}
+}
+
+func TestPoolStateExpiredEntriesIgnored(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "pool_state.json")
+
+	restore := swapAccountStatuses(map[uint]*AccountStatus{
+		1: {FrozenUntil: now.Add(time.Minute), Leases: []time.Time{now}},
+	})
+	if err := savePoolStateTo(path, now); err != nil {
+		restore()
+		t.Fatalf("save: %v", err)
+	}
+	restore()
+
+	// 重启间隔超过冻结时间和占用超时后，不应恢复任何限制
+	defer swapAccountStatuses(make(map[uint]*AccountStatus))()
+	if _, err := loadPoolStateFrom(path, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	statusMu.RLock()
+	s := accountStatuses[1]
+	statusMu.RUnlock()
+	if s != nil && (s.InUse() || s.FrozenUntil.After(now.Add(2*time.Minute))) {
+		t.Errorf("expired state restored: %+v", s)
+	}
+}
+
+func TestPoolStateMissingOrInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	if n, err := loadPoolStateFrom(filepath.Join(dir, "missing.json"), time.Now()); n != 0 || err != nil {
+		t.Errorf("missing file: n=%d err=%v", n, err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"version":99,"accounts":{}}`), 0o644)
+	if _, err := loadPoolStateFrom(bad, time.Now()); err == nil {
+		t.Error("unsupported version accepted")
+	}
+}
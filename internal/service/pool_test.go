@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// initTestDB 使用临时 SQLite 数据库，测试结束后关闭并清空暂存的写操作，避免影响之后的测试
+func initTestDB(t *testing.T, name string) {
+	t.Helper()
+	if err := database.Init("sqlite", filepath.Join(t.TempDir(), name)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+}
+
+func TestPoolRefreshOnlyReloadsFromDatabase(t *testing.T) {
+	initTestDB(t, "pool.db")
+	now := time.Now()
+	// 1 号账号即将过期且有刷新凭据，号池刷新不应再等待它的 token 刷新
+	accounts := []model.Account{
+		{ClientID: "expiring", ClientSecret: "secret", Status: "normal", AccessToken: "old", TokenExpiry: now.Add(10 * time.Minute)},
+		{ClientID: "expired", ClientSecret: "secret", Status: "normal", TokenExpiry: now.Add(-time.Minute)},
+		{ClientID: "cooling", ClientSecret: "secret", Status: "cooling", TokenExpiry: now.Add(time.Hour), CoolingUntil: now.Add(time.Hour)},
+	}
+	if err := database.GetDB().Create(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	pool.mu.RLock()
+	saved := pool.accounts
+	pool.mu.RUnlock()
+	defer func() {
+		pool.mu.Lock()
+		pool.accounts = saved
+		pool.mu.Unlock()
+	}()
+
+	start := time.Now()
+	pool.refresh()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("refresh took %s", elapsed)
+	}
+
+	pool.mu.RLock()
+	loaded := pool.accounts
+	pool.mu.RUnlock()
+	if len(loaded) != 1 || loaded[0].ClientID != "expiring" || loaded[0].AccessToken != "old" {
+		t.Fatalf("loaded = %+v", loaded)
+	}
+}
+
+// BenchmarkGetNextAccountForModel 1 万个账号时单次选号应保持在亚毫秒级
+func BenchmarkGetNextAccountForModel(b *testing.B) {
+	plans := []model.PlanType{model.PlanFree, model.PlanStarter, model.PlanCore, model.PlanAdvanced, model.PlanMax}
+	accounts := make([]*model.Account, 10000)
+	for i := range accounts {
+		accounts[i] = &model.Account{
+			ID:       uint(i + 1),
+			Email:    fmt.Sprintf("bench%d@example.com", i),
+			PlanType: plans[i%len(plans)],
+			Status:   "normal",
+		}
+	}
+
+	pool.mu.Lock()
+	saved := pool.accounts
+	pool.accounts = accounts
+	pool.mu.Unlock()
+	statusMu.Lock()
+	savedStatuses := accountStatuses
+	accountStatuses = make(map[uint]*AccountStatus)
+	statusMu.Unlock()
+	// 未连接数据库时每次选号都会暂存 last_used 更新，队列满后的丢弃日志不计入测量
+	savedOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	defer func() {
+		log.SetOutput(savedOutput)
+		pool.mu.Lock()
+		pool.accounts = saved
+		pool.mu.Unlock()
+		statusMu.Lock()
+		accountStatuses = savedStatuses
+		statusMu.Unlock()
+	}()
+
+	// 首次选号会为所有账号初始化运行时状态，不计入测量
+	acc, err := GetNextAccountForModel("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	ReleaseAccount(acc)
+
+	for _, modelID := range []string{"", "claude-sonnet-4-5-20250929", "claude-opus-4-1-20250805"} {
+		b.Run("model="+modelID, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				acc, err := GetNextAccountForModel(modelID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ReleaseAccount(acc)
+			}
+			if perOp := b.Elapsed() / time.Duration(b.N); perOp > time.Millisecond {
+				b.Errorf("selection took %s per call", perOp)
+			}
+		})
+	}
+}
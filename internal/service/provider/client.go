@@ -15,7 +15,7 @@ func NewHTTPClient(proxy string, timeout time.Duration) *http.Client {
 	if strings.HasPrefix(proxy, "socks5://") {
 		client, err := NewHTTPClientWithProxy(proxy, timeout)
 		if err != nil {
-			log.Printf("创建SOCKS5代理客户端失败: %v, 使用默认客户端", err)
+			log.Printf("[WARN] 创建SOCKS5代理客户端失败: %v, 使用默认客户端", err)
 			client, _ := NewHTTPClientWithProxy("", timeout)
 			return client
 		}
@@ -60,7 +60,7 @@ func NewHTTPClientWithPoolProxy(useProxy bool, timeout time.Duration) *http.Clie
 	proxyURL := pool.GetNextProxy()
 	client, err := NewHTTPClientWithProxy(proxyURL, timeout)
 	if err != nil {
-		log.Printf("使用代理 %s 创建客户端失败: %v, 使用默认客户端", proxyURL, err)
+		log.Printf("[WARN] 使用代理 %s 创建客户端失败: %v, 使用默认客户端", proxyURL, err)
 		client, _ := NewHTTPClientWithProxy("", timeout)
 		return client
 	}
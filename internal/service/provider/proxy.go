@@ -18,10 +18,18 @@ import (
 // ProxyPool 代理池管理器
 type ProxyPool struct {
 	proxies []string
+	regions map[string]string // 代理地址 -> 地区标签，未标注地区的代理不在其中
+	env     []ProxyEntry      // SOCKS_PROXY_POOL 中的代理，运行时添加的代理排在其后
 	mu      sync.RWMutex
 	index   int
 }
 
+// ProxyEntry 代理池条目
+type ProxyEntry struct {
+	URL    string
+	Region string
+}
+
 var (
 	globalProxyPool *ProxyPool
 	once           sync.Once
@@ -39,12 +47,14 @@ func GetProxyPool() *ProxyPool {
 func NewProxyPool() *ProxyPool {
 	pool := &ProxyPool{
 		proxies: make([]string, 0),
+		regions: make(map[string]string),
 	}
 	pool.loadProxiesFromEnv()
 	return pool
 }
 
-// loadProxiesFromEnv 从环境变量加载代理列表
+// loadProxiesFromEnv 从环境变量加载代理列表，每项可用 #地区 后缀标注出口地区，
+// 如 socks5://1.2.3.4:1080#us-east
 func (p *ProxyPool) loadProxiesFromEnv() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -57,11 +67,64 @@ func (p *ProxyPool) loadProxiesFromEnv() {
 	// 解析逗号分隔的代理列表
 	proxiesStr := strings.Split(proxyEnv, ",")
 	for _, proxyStr := range proxiesStr {
-		proxyStr = strings.TrimSpace(proxyStr)
+		proxyStr, region := splitProxyRegion(proxyStr)
 		if proxyStr != "" {
+			p.env = append(p.env, ProxyEntry{URL: proxyStr, Region: region})
 			p.proxies = append(p.proxies, proxyStr)
+			if region != "" {
+				p.regions[proxyStr] = region
+			}
+		}
+	}
+}
+
+// EnvProxies 返回 SOCKS_PROXY_POOL 中配置的代理
+func (p *ProxyPool) EnvProxies() []ProxyEntry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	result := make([]ProxyEntry, len(p.env))
+	copy(result, p.env)
+	return result
+}
+
+// SetExtraProxies 替换运行时添加的代理，SOCKS_PROXY_POOL 中的代理保留在前，地址重复的条目忽略
+func (p *ProxyPool) SetExtraProxies(extra []ProxyEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxies := make([]string, 0, len(p.env)+len(extra))
+	regions := make(map[string]string)
+	for _, entry := range append(append([]ProxyEntry(nil), p.env...), extra...) {
+		if entry.URL == "" {
+			continue
+		}
+		if _, exists := regions[entry.URL]; exists {
+			continue
+		}
+		proxies = append(proxies, entry.URL)
+		regions[entry.URL] = NormalizeProxyRegion(entry.Region)
+	}
+	for proxyURL, region := range regions {
+		if region == "" {
+			delete(regions, proxyURL)
+		}
+	}
+	p.proxies, p.regions = proxies, regions
+	if p.index >= len(proxies) {
+		p.index = 0
+	}
+}
+
+// Contains 检查代理是否在池中
+func (p *ProxyPool) Contains(proxyURL string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, existing := range p.proxies {
+		if existing == proxyURL {
+			return true
 		}
 	}
+	return false
 }
 
 // GetNextProxy 获取下一个代理(轮询方式)
@@ -91,6 +154,59 @@ func (p *ProxyPool) GetRandomProxy() string {
 	return p.proxies[index]
 }
 
+// splitProxyRegion 拆分代理池条目中的 #地区 后缀
+func splitProxyRegion(entry string) (string, string) {
+	entry = strings.TrimSpace(entry)
+	if i := strings.LastIndex(entry, "#"); i >= 0 {
+		return strings.TrimSpace(entry[:i]), NormalizeProxyRegion(entry[i+1:])
+	}
+	return entry, ""
+}
+
+// NormalizeProxyRegion 地区标签不区分大小写，统一为小写
+func NormalizeProxyRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+// GetRandomProxyInRegion 获取指定地区的随机代理，region 为空时不限地区；该地区没有代理时返回空
+func (p *ProxyPool) GetRandomProxyInRegion(region string) string {
+	if region == "" {
+		return p.GetRandomProxy()
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var candidates []string
+	for _, proxyURL := range p.proxies {
+		if p.regions[proxyURL] == region {
+			candidates = append(candidates, proxyURL)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// HasProxiesInRegion 检查指定地区是否有代理，region 为空时等同 HasProxies
+func (p *ProxyPool) HasProxiesInRegion(region string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, proxyURL := range p.proxies {
+		if region == "" || p.regions[proxyURL] == region {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProxyRegion 返回代理池中该代理的地区标签，不在池中或未标注时返回空
+func (p *ProxyPool) GetProxyRegion(proxyURL string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.regions[proxyURL]
+}
+
 // HasProxies 检查是否有可用代理
 func (p *ProxyPool) HasProxies() bool {
 	p.mu.RLock()
@@ -160,6 +276,10 @@ func createSOCKS5Transport(proxyURL string, timeout time.Duration) (*http.Transp
 	
 	transport := &http.Transport{
 		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// 优先使用支持 context 的拨号，使连接超时对 SOCKS5 同样生效
+			if cd, ok := dialer.(proxy.ContextDialer); ok {
+				return cd.DialContext(ctx, network, addr)
+			}
 			return dialer.Dial(network, addr)
 		},
 		MaxIdleConns:        100,
@@ -191,6 +311,21 @@ func parseCustomProxyURL(proxyURL string) string {
 	return proxyURL
 }
 
+// ParseProxyURL 解析代理地址（支持 socks5://host:port:username:password 格式），只接受 http、https、socks5
+func ParseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(parseCustomProxyURL(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("解析代理URL失败: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		return nil, fmt.Errorf("不支持的代理协议: %q", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("代理地址缺少主机或端口")
+	}
+	return u, nil
+}
+
 // NewHTTPClientWithProxy 创建带指定代理的HTTP客户端
 func NewHTTPClientWithProxy(proxyURL string, timeout time.Duration) (*http.Client, error) {
 	if timeout == 0 {
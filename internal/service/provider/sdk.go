@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/openai/openai-go"
+	openaioption "github.com/openai/openai-go/option"
+)
+
+// 上游请求的发送方式
+const (
+	TransportHTTP = "http" // 直接用 net/http 发送（默认）
+	TransportSDK  = "sdk"  // 经官方 SDK 的请求管线发送
+)
+
+// sdkAuthHeaders SDK 可能从环境变量（ANTHROPIC_API_KEY、OPENAI_ORG_ID 等）自动添加的请求头，
+// 原请求没有时删除，避免把本机凭据发给上游
+var sdkAuthHeaders = []string{"X-Api-Key", "Authorization", "OpenAI-Organization", "OpenAI-Project"}
+
+// SupportsSDKTransport 服务商是否有可用的官方 SDK
+func SupportsSDKTransport(providerID string) bool {
+	return providerID == "anthropic" || providerID == "openai"
+}
+
+// sdkTransport 把已构建好的请求交给官方 SDK 发送，返回未读取的原始响应，
+// 流式响应由调用方照常逐行转发；SDK 自身不重试，重试和换号由调用方负责
+type sdkTransport struct {
+	providerID string
+	base       http.RoundTripper
+}
+
+// NewSDKClient 返回经官方 SDK 发送请求的客户端，保留原客户端的超时和代理设置
+// 服务商没有 SDK 时原样返回
+func NewSDKClient(client *http.Client, providerID string) *http.Client {
+	if !SupportsSDKTransport(providerID) {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &sdkTransport{providerID: providerID, base: base}
+	return &wrapped
+}
+
+func (t *sdkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body interface{}
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+
+	baseURL := req.URL.Scheme + "://" + req.URL.Host + "/"
+	path := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	httpClient := &http.Client{Transport: t.base}
+
+	var resp *http.Response
+	var err error
+	switch t.providerID {
+	case "anthropic":
+		opts := []anthropicoption.RequestOption{
+			anthropicoption.WithBaseURL(baseURL),
+			anthropicoption.WithHTTPClient(httpClient),
+			anthropicoption.WithMaxRetries(0),
+			anthropicoption.WithResponseInto(&resp),
+		}
+		for _, key := range sdkAuthHeaders {
+			if req.Header.Get(key) == "" {
+				opts = append(opts, anthropicoption.WithHeaderDel(key))
+			}
+		}
+		for key, values := range req.Header {
+			for i, v := range values {
+				if i == 0 {
+					opts = append(opts, anthropicoption.WithHeader(key, v))
+				} else {
+					opts = append(opts, anthropicoption.WithHeaderAdd(key, v))
+				}
+			}
+		}
+		err = anthropic.NewClient().Execute(req.Context(), req.Method, path, body, nil, opts...)
+	case "openai":
+		opts := []openaioption.RequestOption{
+			openaioption.WithBaseURL(baseURL),
+			openaioption.WithHTTPClient(httpClient),
+			openaioption.WithMaxRetries(0),
+			openaioption.WithResponseInto(&resp),
+		}
+		for _, key := range sdkAuthHeaders {
+			if req.Header.Get(key) == "" {
+				opts = append(opts, openaioption.WithHeaderDel(key))
+			}
+		}
+		for key, values := range req.Header {
+			for i, v := range values {
+				if i == 0 {
+					opts = append(opts, openaioption.WithHeader(key, v))
+				} else {
+					opts = append(opts, openaioption.WithHeaderAdd(key, v))
+				}
+			}
+		}
+		err = openai.NewClient().Execute(req.Context(), req.Method, path, body, nil, opts...)
+	default:
+		return nil, fmt.Errorf("%w: %s has no SDK transport", ErrUnknownProvider, t.providerID)
+	}
+
+	// SDK 把 4xx/5xx 转换为错误（响应体已读出并重新填回），这里还原为普通响应，交给调用方按状态码处理
+	if resp != nil && (err == nil || resp.StatusCode >= 400) {
+		return resp, nil
+	}
+	if err == nil {
+		err = ErrRequestFailed
+	}
+	return nil, err
+}
@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSDKClientForwardsRequestAndStreams(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-local-should-not-leak")
+	const reqBody = `{"model":"claude-sonnet-4-5-20250929","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path != "/anthropic/v1/messages" || r.URL.RawQuery != "beta=true":
+			t.Errorf("url = %s", r.URL)
+		case string(body) != reqBody:
+			t.Errorf("body = %s", body)
+		case r.Header.Get("X-Api-Key") != "" || r.Header.Get("Authorization") != "Bearer zen-token":
+			t.Errorf("auth headers = %q / %q", r.Header.Get("X-Api-Key"), r.Header.Get("Authorization"))
+		case r.Header.Get("X-Stainless-Lang") == "":
+			t.Error("request did not go through the SDK")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "event: ping\ndata: {\"n\":%d}\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	client := NewSDKClient(&http.Client{}, "anthropic")
+	req, _ := http.NewRequest("POST", srv.URL+"/anthropic/v1/messages?beta=true", strings.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer zen-token")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var events int
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data: ") {
+			events++
+		}
+	}
+	if events != 3 {
+		t.Errorf("read %d events, want 3", events)
+	}
+}
+
+func TestSDKClientReturnsErrorResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, "slow down")
+	}))
+	defer srv.Close()
+
+	for _, providerID := range []string{"anthropic", "openai"} {
+		client := NewSDKClient(&http.Client{}, providerID)
+		resp, err := client.Post(srv.URL+"/v1/chat/completions", "application/json", bytes.NewReader([]byte(`{}`)))
+		if err != nil {
+			t.Fatalf("%s: %v", providerID, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || string(body) != "slow down" || resp.Header.Get("Retry-After") != "7" {
+			t.Errorf("%s: got %d %q, want the upstream 429 unchanged", providerID, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestNewSDKClientWithoutSDK(t *testing.T) {
+	client := &http.Client{}
+	if NewSDKClient(client, "xai") != client {
+		t.Error("providers without an SDK should keep the plain client")
+	}
+}
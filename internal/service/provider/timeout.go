@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Timeouts 上游请求的分段超时设置，零值表示使用默认值
+type Timeouts struct {
+	Connect time.Duration `json:"connect"` // 建立连接(含代理握手)
+	TTFB    time.Duration `json:"ttfb"`    // 等待响应头
+	Total   time.Duration `json:"total"`   // 整个请求(含流式读取)
+}
+
+// Merge 用 o 中的非零字段覆盖 t
+func (t Timeouts) Merge(o Timeouts) Timeouts {
+	if o.Connect > 0 {
+		t.Connect = o.Connect
+	}
+	if o.TTFB > 0 {
+		t.TTFB = o.TTFB
+	}
+	if o.Total > 0 {
+		t.Total = o.Total
+	}
+	return t
+}
+
+// ApplyTimeouts 把分段超时应用到已创建的客户端上
+func ApplyTimeouts(client *http.Client, t Timeouts) *http.Client {
+	if client == nil {
+		return nil
+	}
+	if t.Total > 0 {
+		client.Timeout = t.Total
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return client
+	}
+	if t.TTFB > 0 {
+		transport.ResponseHeaderTimeout = t.TTFB
+	}
+	if t.Connect > 0 {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext
+		}
+		connect := t.Connect
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, connect)
+			defer cancel()
+			return dial(ctx, network, addr)
+		}
+		transport.TLSHandshakeTimeout = connect
+	}
+	return client
+}
+
+// NewHTTPClientWithTimeouts 创建带分段超时的HTTP客户端
+func NewHTTPClientWithTimeouts(proxy string, t Timeouts) *http.Client {
+	return ApplyTimeouts(NewHTTPClient(proxy, t.Total), t)
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeoutsMerge(t *testing.T) {
+	base := Timeouts{Connect: 10 * time.Second, TTFB: 60 * time.Second, Total: 600 * time.Second}
+
+	tests := []struct {
+		name     string
+		override Timeouts
+		want     Timeouts
+	}{
+		{"zero override keeps base", Timeouts{}, base},
+		{"partial override", Timeouts{TTFB: 5 * time.Second}, Timeouts{Connect: 10 * time.Second, TTFB: 5 * time.Second, Total: 600 * time.Second}},
+		{"full override", Timeouts{Connect: time.Second, TTFB: 2 * time.Second, Total: 3 * time.Second}, Timeouts{Connect: time.Second, TTFB: 2 * time.Second, Total: 3 * time.Second}},
+		{"negative ignored", Timeouts{Total: -time.Second}, base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base.Merge(tt.override); got != tt.want {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTimeouts(t *testing.T) {
+	client := &http.Client{Transport: &http.Transport{}, Timeout: time.Minute}
+	ApplyTimeouts(client, Timeouts{TTFB: 7 * time.Second, Total: 9 * time.Second})
+
+	if client.Timeout != 9*time.Second {
+		t.Errorf("client.Timeout = %s", client.Timeout)
+	}
+	if rt := client.Transport.(*http.Transport).ResponseHeaderTimeout; rt != 7*time.Second {
+		t.Errorf("ResponseHeaderTimeout = %s", rt)
+	}
+
+	client = &http.Client{Timeout: time.Minute}
+	ApplyTimeouts(client, Timeouts{})
+	if client.Timeout != time.Minute {
+		t.Errorf("zero timeouts changed client.Timeout to %s", client.Timeout)
+	}
+}
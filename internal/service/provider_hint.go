@@ -0,0 +1,98 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"zencoder2api/internal/model"
+)
+
+// ProviderHintHeader 请求头中指定服务商，与模型名后缀 model#provider 等效
+const ProviderHintHeader = "X-Model-Provider"
+
+// providerSuffixSep 模型名与服务商后缀的分隔符；同名模型由多个服务商提供时，
+// 模型表以 <模型名>#<服务商> 为键登记各服务商的版本
+const providerSuffixSep = "#"
+
+// SplitProviderSuffix 拆分 model#provider，没有后缀时 provider 为空
+func SplitProviderSuffix(name string) (string, string) {
+	base, provider, _ := strings.Cut(name, providerSuffixSep)
+	return base, strings.ToLower(strings.TrimSpace(provider))
+}
+
+// providerVariants 模型名对应的各服务商版本，键为服务商，值为模型表中的键
+func providerVariants(base string) map[string]string {
+	result := make(map[string]string)
+	if m, ok := model.GetZenModel(base); ok {
+		result[m.ProviderID] = base
+	}
+	prefix := base + providerSuffixSep
+	for _, key := range model.ListZenModelIDs() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if m, ok := model.GetZenModel(key); ok {
+			result[m.ProviderID] = key
+		}
+	}
+	return result
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ResolveModelProvider 按服务商提示（请求头或 model#provider 后缀）把模型名解析为模型表中的键
+// 没有提示时模型名本身在模型表中则原样返回；只有 <模型名>#<服务商> 形式的版本时，
+// 仅有一个服务商则使用它，多个服务商时要求客户端指定，保证同名模型的路由是确定的
+func ResolveModelProvider(name, hint string) (string, error) {
+	base, suffix := SplitProviderSuffix(name)
+	hint = strings.ToLower(strings.TrimSpace(hint))
+	if suffix != "" && hint != "" && suffix != hint {
+		return "", invalidRequest("model suffix #%s conflicts with %s: %s", suffix, ProviderHintHeader, hint)
+	}
+	provider := suffix
+	if provider == "" {
+		provider = hint
+	}
+
+	if provider == "" {
+		if _, ok := model.GetZenModel(name); ok {
+			return name, nil
+		}
+		variants := providerVariants(base)
+		switch len(variants) {
+		case 0:
+			return name, nil // 未知模型交给后续处理
+		case 1:
+			for _, key := range variants {
+				return key, nil
+			}
+		}
+		return "", invalidRequest("model %s is offered by multiple providers (%s); specify one with %s or model#provider",
+			base, strings.Join(sortedKeys(variants), ", "), ProviderHintHeader)
+	}
+
+	if !knownProviders[provider] {
+		names := make([]string, 0, len(knownProviders))
+		for p := range knownProviders {
+			names = append(names, p)
+		}
+		sort.Strings(names)
+		return "", invalidRequest("unknown provider %q, expected one of: %s", provider, strings.Join(names, ", "))
+	}
+	variants := providerVariants(base)
+	if key, ok := variants[provider]; ok {
+		return key, nil
+	}
+	if len(variants) == 0 {
+		return "", invalidRequest("model %s does not exist", base)
+	}
+	return "", invalidRequest("model %s is not offered by provider %s (available: %s)",
+		base, provider, strings.Join(sortedKeys(variants), ", "))
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"zencoder2api/internal/model"
+)
+
+func TestResolveModelProvider(t *testing.T) {
+	defer model.ResetZenModelsToDefault()
+	model.UpdateZenModels(func(models map[string]model.ZenModel) {
+		models["shared-model#openai"] = model.ZenModel{ID: "shared-model", Model: "shared-model", ProviderID: "openai", Multiplier: 1}
+		models["shared-model#xai"] = model.ZenModel{ID: "shared-model", Model: "shared-model", ProviderID: "xai", Multiplier: 1}
+		models["solo-model#gemini"] = model.ZenModel{ID: "solo-model", Model: "solo-model", ProviderID: "gemini", Multiplier: 1}
+	})
+
+	tests := []struct {
+		name, hint, want, wantErr string
+	}{
+		{name: "claude-sonnet-4-5-20250929", want: "claude-sonnet-4-5-20250929"},
+		{name: "claude-sonnet-4-5-20250929#anthropic", want: "claude-sonnet-4-5-20250929"},
+		{name: "claude-sonnet-4-5-20250929", hint: "Anthropic", want: "claude-sonnet-4-5-20250929"},
+		{name: "claude-sonnet-4-5-20250929", hint: "gemini", wantErr: "not offered by provider gemini (available: anthropic)"},
+		{name: "claude-sonnet-4-5-20250929#nope", wantErr: "unknown provider"},
+		{name: "claude-sonnet-4-5-20250929#anthropic", hint: "xai", wantErr: "conflicts"},
+		{name: "shared-model", wantErr: "multiple providers (openai, xai)"},
+		{name: "shared-model#xai", want: "shared-model#xai"},
+		{name: "shared-model", hint: "openai", want: "shared-model#openai"},
+		{name: "solo-model", want: "solo-model#gemini"},
+		{name: "missing-model", want: "missing-model"},
+		{name: "missing-model", hint: "openai", wantErr: "does not exist"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveModelProvider(tt.name, tt.hint)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResolveModelProvider(%q, %q) error = %v, want %q", tt.name, tt.hint, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveModelProvider(%q, %q) = %q, %v, want %q", tt.name, tt.hint, got, err, tt.want)
+		}
+	}
+}
@@ -120,6 +120,9 @@ func DoRequestWithProxyRetry(ctx context.Context, req *http.Request, originalPro
 		time.Sleep(options.RetryDelay)
 	}
 	
+	if isNetworkError(lastErr) {
+		return nil, fmt.Errorf("%w: 所有代理重试均失败，最后错误: %v", ErrUpstreamUnreachable, lastErr)
+	}
 	return nil, fmt.Errorf("所有代理重试均失败，最后错误: %v", lastErr)
 }
 
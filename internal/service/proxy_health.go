@@ -0,0 +1,362 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+const (
+	// proxyHealthIdleCheck 健康检查关闭时重新检查设置的间隔
+	proxyHealthIdleCheck = time.Minute
+	// proxyHealthConcurrency 同时检查的代理数
+	proxyHealthConcurrency = 8
+)
+
+// 账号代理失效后的处理方式
+const (
+	ProxyFailoverPool   = "pool"   // 改用代理池中同地区的健康代理，账号固定了地区但该地区没有健康代理时仍用原代理
+	ProxyFailoverDirect = "direct" // 改为直连
+	ProxyFailoverOff    = "off"    // 继续使用原代理
+)
+
+// ProxyHealthSettings 代理健康检查配置
+type ProxyHealthSettings struct {
+	IntervalSeconds  int    `json:"interval_seconds"`  // 检查间隔，0 表示关闭
+	TimeoutSeconds   int    `json:"timeout_seconds"`   // 单次检查的超时
+	FailureThreshold int    `json:"failure_threshold"` // 连续失败多少次标记为失效，成功一次即恢复
+	Failover         string `json:"failover"`          // pool / direct / off
+}
+
+// ProxyHealthStatus 单个代理的健康状态
+type ProxyHealthStatus struct {
+	URL      string `json:"url"`      // 已隐藏认证信息
+	Pool     bool   `json:"pool"`     // 是否在 SOCKS_PROXY_POOL 中
+	Accounts int    `json:"accounts"` // 号池中配置了该代理的账号数
+	model.ProxyHealth
+}
+
+var (
+	proxyHealthMu       sync.RWMutex
+	proxyHealthSettings ProxyHealthSettings
+	proxyHealthOnce     sync.Once
+
+	proxyHealthStateMu sync.RWMutex
+	proxyHealthStates  = make(map[string]*model.ProxyHealth)
+	proxyHealthRunMu   sync.Mutex
+
+	proxyFailovers atomic.Uint64
+
+	// proxyHealthProbe 通过代理请求上游并返回耗时，测试时替换
+	proxyHealthProbe = probeProxy
+)
+
+// loadProxyHealthSettings 读取 PROXY_HEALTH_CHECK_INTERVAL / PROXY_HEALTH_CHECK_TIMEOUT / PROXY_HEALTH_FAILURES / PROXY_FAILOVER
+func loadProxyHealthSettings() {
+	proxyHealthSettings = ProxyHealthSettings{
+		IntervalSeconds:  envNonNegativeIntDefault("PROXY_HEALTH_CHECK_INTERVAL", 60),
+		TimeoutSeconds:   envPositiveInt("PROXY_HEALTH_CHECK_TIMEOUT", 10),
+		FailureThreshold: envPositiveInt("PROXY_HEALTH_FAILURES", 2),
+		Failover:         ProxyFailoverPool,
+	}
+	if failover := strings.ToLower(strings.TrimSpace(os.Getenv("PROXY_FAILOVER"))); failover != "" {
+		if validProxyFailover(failover) {
+			proxyHealthSettings.Failover = failover
+		} else {
+			log.Printf("[WARN] PROXY_FAILOVER=%s 无效，使用 pool", failover)
+		}
+	}
+}
+
+func validProxyFailover(failover string) bool {
+	return failover == ProxyFailoverPool || failover == ProxyFailoverDirect || failover == ProxyFailoverOff
+}
+
+// GetProxyHealthSettings 获取代理健康检查配置
+func GetProxyHealthSettings() ProxyHealthSettings {
+	proxyHealthOnce.Do(loadProxyHealthSettings)
+	proxyHealthMu.RLock()
+	defer proxyHealthMu.RUnlock()
+	return proxyHealthSettings
+}
+
+// SetProxyHealthSettings 运行时修改代理健康检查配置（仅内存生效），修改间隔在下一轮生效
+func SetProxyHealthSettings(settings ProxyHealthSettings) error {
+	if settings.IntervalSeconds < 0 {
+		return fmt.Errorf("interval_seconds 不能为负数")
+	}
+	if settings.TimeoutSeconds <= 0 || settings.FailureThreshold <= 0 {
+		return fmt.Errorf("timeout_seconds 和 failure_threshold 必须大于 0")
+	}
+	if !validProxyFailover(settings.Failover) {
+		return fmt.Errorf("failover 只能是 pool、direct 或 off")
+	}
+	proxyHealthOnce.Do(loadProxyHealthSettings)
+	proxyHealthMu.Lock()
+	proxyHealthSettings = settings
+	proxyHealthMu.Unlock()
+	log.Printf("[ProxyHealth] 配置已调整: interval=%ds, timeout=%ds, failures=%d, failover=%s",
+		settings.IntervalSeconds, settings.TimeoutSeconds, settings.FailureThreshold, settings.Failover)
+	return nil
+}
+
+// StartProxyHealthScheduler 按 PROXY_HEALTH_CHECK_INTERVAL 定期检查账号代理和代理池，关闭时每分钟检查一次设置
+func StartProxyHealthScheduler() {
+	go func() {
+		for {
+			seconds := GetProxyHealthSettings().IntervalSeconds
+			if seconds <= 0 {
+				time.Sleep(proxyHealthIdleCheck)
+				continue
+			}
+			time.Sleep(time.Duration(seconds) * time.Second)
+			if GetProxyHealthSettings().IntervalSeconds > 0 {
+				RunProxyHealthCheck()
+			}
+		}
+	}()
+}
+
+// RunProxyHealthCheck 检查号池账号配置的代理和 SOCKS_PROXY_POOL 中的代理，返回各代理的状态
+func RunProxyHealthCheck() []ProxyHealthStatus {
+	proxyHealthRunMu.Lock()
+	defer proxyHealthRunMu.Unlock()
+
+	settings := GetProxyHealthSettings()
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	targets := proxyHealthTargets()
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, proxyHealthConcurrency)
+	for _, target := range targets {
+		wg.Add(1)
+		go func(proxyURL string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			latency, err := proxyHealthProbe(proxyURL, timeout)
+			recordProxyHealth(proxyURL, latency, err, settings.FailureThreshold, start)
+		}(target.raw)
+	}
+	wg.Wait()
+
+	result := make([]ProxyHealthStatus, 0, len(targets))
+	unhealthy := 0
+	for _, target := range targets {
+		status := ProxyHealthStatus{URL: maskProxyURL(target.raw), Pool: target.pool, Accounts: target.accounts}
+		if health := getProxyHealth(target.raw); health != nil {
+			status.ProxyHealth = *health
+		}
+		if !status.Healthy {
+			unhealthy++
+		}
+		result = append(result, status)
+	}
+	log.Printf("[ProxyHealth] 检查完成：%d 个代理，%d 个失效", len(result), unhealthy)
+	return result
+}
+
+type proxyHealthTarget struct {
+	raw      string
+	pool     bool
+	accounts int
+}
+
+// proxyHealthTargets 需要检查的代理：号池账号配置的代理和代理池中的代理，去重
+func proxyHealthTargets() []proxyHealthTarget {
+	var accounts []*model.Account
+	if pool != nil {
+		pool.mu.RLock()
+		accounts = pool.accounts
+		pool.mu.RUnlock()
+	}
+
+	var targets []proxyHealthTarget
+	index := make(map[string]int)
+	get := func(raw string) *proxyHealthTarget {
+		if i, ok := index[raw]; ok {
+			return &targets[i]
+		}
+		index[raw] = len(targets)
+		targets = append(targets, proxyHealthTarget{raw: raw})
+		return &targets[len(targets)-1]
+	}
+	for _, raw := range provider.GetProxyPool().GetAllProxies() {
+		get(raw).pool = true
+	}
+	for _, acc := range accounts {
+		if acc.Proxy != "" {
+			get(acc.Proxy).accounts++
+		}
+	}
+	return targets
+}
+
+// probeProxy 通过代理向上游发起 HEAD 请求，收到任意 HTTP 响应即认为代理可用
+func probeProxy(proxyURL string, timeout time.Duration) (time.Duration, error) {
+	client, err := provider.NewHTTPClientWithProxy(proxyURL, timeout)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodHead, strings.TrimSuffix(AnthropicBaseURL, "/anthropic")+"/", nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return time.Since(start), nil
+}
+
+// recordProxyHealth 记录一次检查结果，连续失败达到阈值时标记失效，成功一次即恢复
+func recordProxyHealth(proxyURL string, latency time.Duration, err error, threshold int, now time.Time) {
+	proxyHealthStateMu.Lock()
+	defer proxyHealthStateMu.Unlock()
+
+	health, ok := proxyHealthStates[proxyURL]
+	if !ok {
+		health = &model.ProxyHealth{Healthy: true}
+		proxyHealthStates[proxyURL] = health
+	}
+	health.CheckedAt = now
+	if err == nil {
+		if !health.Healthy {
+			log.Printf("[ProxyHealth] 代理 %s 已恢复，延迟 %dms", maskProxyURL(proxyURL), latency.Milliseconds())
+		}
+		health.Healthy = true
+		health.Failures = 0
+		health.LatencyMs = latency.Milliseconds()
+		health.Error = ""
+		return
+	}
+	health.Failures++
+	health.LatencyMs = 0
+	health.Error = truncateUTF8(err.Error(), 200)
+	if health.Healthy && health.Failures >= threshold {
+		health.Healthy = false
+		log.Printf("[WARN] [ProxyHealth] 代理 %s 连续 %d 次检查失败，标记为失效: %v", maskProxyURL(proxyURL), health.Failures, err)
+	}
+}
+
+// getProxyHealth 返回代理最近一次检查结果的副本，未检查过时返回 nil
+func getProxyHealth(proxyURL string) *model.ProxyHealth {
+	proxyHealthStateMu.RLock()
+	defer proxyHealthStateMu.RUnlock()
+	health, ok := proxyHealthStates[proxyURL]
+	if !ok {
+		return nil
+	}
+	result := *health
+	return &result
+}
+
+// proxyHealthy 未检查过的代理视为可用
+func proxyHealthy(proxyURL string) bool {
+	proxyHealthStateMu.RLock()
+	defer proxyHealthStateMu.RUnlock()
+	health, ok := proxyHealthStates[proxyURL]
+	return !ok || health.Healthy
+}
+
+// AccountProxyHealth 账号代理的健康状态，用于账号列表展示；账号没有代理或代理未检查过时返回 nil
+func AccountProxyHealth(account *model.Account) *model.ProxyHealth {
+	if account.Proxy == "" {
+		return nil
+	}
+	health := getProxyHealth(account.Proxy)
+	if health == nil || health.Healthy {
+		return health
+	}
+	if proxyURL, failover := resolveAccountProxy(account); failover && proxyURL == "" {
+		health.Failover = ProxyFailoverDirect
+	} else if failover {
+		health.Failover = ProxyFailoverPool
+	}
+	return health
+}
+
+// accountUpstreamProxy 账号请求上游实际使用的代理：账号代理失效时按 failover 配置改用代理池或直连
+func accountUpstreamProxy(account *model.Account) string {
+	proxyURL, failover := resolveAccountProxy(account)
+	if failover {
+		proxyFailovers.Add(1)
+	}
+	return proxyURL
+}
+
+// resolveAccountProxy 返回账号应使用的代理，以及是否绕开了失效的账号代理
+func resolveAccountProxy(account *model.Account) (string, bool) {
+	if account.Proxy == "" || proxyHealthy(account.Proxy) {
+		return account.Proxy, false
+	}
+	switch GetProxyHealthSettings().Failover {
+	case ProxyFailoverDirect:
+		return "", true
+	case ProxyFailoverPool:
+		proxyPool := provider.GetProxyPool()
+		region := accountProxyRegion(proxyPool, account)
+		if proxyURL := healthyPoolProxy(proxyPool, region, account.Proxy); proxyURL != "" {
+			return proxyURL, true
+		}
+		// 不限地区的账号在代理池没有健康代理时直连，固定了地区的账号不跨地区
+		if region == "" {
+			return "", true
+		}
+	}
+	return account.Proxy, false
+}
+
+// healthyPoolProxy 随机选择代理池中指定地区（为空时不限）的健康代理，排除 exclude
+func healthyPoolProxy(proxyPool *provider.ProxyPool, region, exclude string) string {
+	var candidates []string
+	for _, proxyURL := range proxyPool.GetAllProxies() {
+		if proxyURL == exclude || !proxyHealthy(proxyURL) {
+			continue
+		}
+		if region != "" && proxyPool.GetProxyRegion(proxyURL) != region {
+			continue
+		}
+		candidates = append(candidates, proxyURL)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+func writeProxyHealthMetrics(w io.Writer) {
+	proxyHealthStateMu.RLock()
+	unhealthy := 0
+	for _, health := range proxyHealthStates {
+		if !health.Healthy {
+			unhealthy++
+		}
+	}
+	checked := len(proxyHealthStates)
+	proxyHealthStateMu.RUnlock()
+
+	fmt.Fprintln(w, "# TYPE zencoder_proxies_checked gauge")
+	fmt.Fprintf(w, "zencoder_proxies_checked %d\n", checked)
+	fmt.Fprintln(w, "# TYPE zencoder_proxies_unhealthy gauge")
+	fmt.Fprintln(w, "# HELP zencoder_proxies_unhealthy Proxies currently marked dead by the health check.")
+	fmt.Fprintf(w, "zencoder_proxies_unhealthy %d\n", unhealthy)
+	fmt.Fprintln(w, "# TYPE zencoder_proxy_failovers counter")
+	fmt.Fprintln(w, "# HELP zencoder_proxy_failovers Upstream requests routed around an account's dead proxy.")
+	fmt.Fprintf(w, "zencoder_proxy_failovers_total %d\n", proxyFailovers.Load())
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// withProxyHealth 临时替换代理检查函数和配置，测试结束后恢复并清空检查结果
+func withProxyHealth(t *testing.T, settings ProxyHealthSettings, probe func(string, time.Duration) (time.Duration, error)) {
+	t.Helper()
+	prevSettings := GetProxyHealthSettings()
+	prevProbe := proxyHealthProbe
+	if err := SetProxyHealthSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	proxyHealthProbe = probe
+	t.Cleanup(func() {
+		SetProxyHealthSettings(prevSettings)
+		proxyHealthProbe = prevProbe
+		proxyHealthStateMu.Lock()
+		proxyHealthStates = make(map[string]*model.ProxyHealth)
+		proxyHealthStateMu.Unlock()
+	})
+}
+
+func TestProxyHealthCheckMarksDeadProxyAndFailsOver(t *testing.T) {
+	const dead, alive = "http://10.0.0.1:8080", "http://10.0.0.2:8080"
+	down := true
+	withProxyHealth(t, ProxyHealthSettings{TimeoutSeconds: 1, FailureThreshold: 2, Failover: ProxyFailoverDirect},
+		func(proxyURL string, _ time.Duration) (time.Duration, error) {
+			if proxyURL == dead && down {
+				return 0, errors.New("connect: connection refused")
+			}
+			return 30 * time.Millisecond, nil
+		})
+
+	accounts := []*model.Account{{ID: 1, Proxy: dead}, {ID: 2, Proxy: alive}, {ID: 3, Proxy: dead}}
+	pool.mu.Lock()
+	saved := pool.accounts
+	pool.accounts = accounts
+	pool.mu.Unlock()
+	defer func() {
+		pool.mu.Lock()
+		pool.accounts = saved
+		pool.mu.Unlock()
+	}()
+
+	// 第一次失败未达到阈值，仍使用原代理
+	RunProxyHealthCheck()
+	if got := accountUpstreamProxy(accounts[0]); got != dead {
+		t.Fatalf("after one failure proxy = %q", got)
+	}
+
+	statuses := RunProxyHealthCheck()
+	if len(statuses) != 2 || statuses[0].Accounts != 2 || statuses[0].Healthy || statuses[0].Failures != 2 || !statuses[1].Healthy || statuses[1].LatencyMs != 30 {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+	if got := accountUpstreamProxy(accounts[0]); got != "" {
+		t.Errorf("dead proxy not bypassed: %q", got)
+	}
+	if got := accountUpstreamProxy(accounts[1]); got != alive {
+		t.Errorf("healthy proxy = %q", got)
+	}
+	if health := AccountProxyHealth(accounts[0]); health == nil || health.Healthy || health.Failover != ProxyFailoverDirect || health.Error == "" {
+		t.Errorf("account health = %+v", health)
+	}
+
+	// 成功一次即恢复
+	down = false
+	RunProxyHealthCheck()
+	if got := accountUpstreamProxy(accounts[0]); got != dead {
+		t.Errorf("recovered proxy = %q", got)
+	}
+	if health := AccountProxyHealth(accounts[0]); health == nil || !health.Healthy || health.Failover != "" {
+		t.Errorf("recovered health = %+v", health)
+	}
+}
+
+func TestProxyFailoverKeepsRegionPinnedAccounts(t *testing.T) {
+	const dead = "http://10.0.0.1:8080"
+	withProxyHealth(t, ProxyHealthSettings{TimeoutSeconds: 1, FailureThreshold: 1, Failover: ProxyFailoverPool}, nil)
+	recordProxyHealth(dead, 0, errors.New("timeout"), 1, time.Now())
+
+	// 代理池中没有该地区的健康代理时不换出口
+	pinned := &model.Account{Proxy: dead, ProxyRegion: "eu-west"}
+	if got := accountUpstreamProxy(pinned); got != dead {
+		t.Errorf("pinned account proxy = %q", got)
+	}
+	if health := AccountProxyHealth(pinned); health.Failover != "" {
+		t.Errorf("pinned failover = %q", health.Failover)
+	}
+	// 不限地区的账号改为直连
+	if got := accountUpstreamProxy(&model.Account{Proxy: dead}); got != "" {
+		t.Errorf("unpinned account proxy = %q", got)
+	}
+
+	withProxyHealth(t, ProxyHealthSettings{TimeoutSeconds: 1, FailureThreshold: 1, Failover: ProxyFailoverOff}, nil)
+	recordProxyHealth(dead, 0, errors.New("timeout"), 1, time.Now())
+	if got := accountUpstreamProxy(&model.Account{Proxy: dead}); got != dead {
+		t.Errorf("failover off proxy = %q", got)
+	}
+}
+
+func TestSetProxyHealthSettingsValidates(t *testing.T) {
+	for _, settings := range []ProxyHealthSettings{
+		{IntervalSeconds: -1, TimeoutSeconds: 1, FailureThreshold: 1, Failover: ProxyFailoverPool},
+		{TimeoutSeconds: 0, FailureThreshold: 1, Failover: ProxyFailoverPool},
+		{TimeoutSeconds: 1, FailureThreshold: 1, Failover: "random"},
+	} {
+		if err := SetProxyHealthSettings(settings); err == nil {
+			t.Errorf("%+v accepted", settings)
+		}
+	}
+}
+
+func TestTestPoolProxyValidatesURL(t *testing.T) {
+	withProxyHealth(t, ProxyHealthSettings{TimeoutSeconds: 1, FailureThreshold: 1, Failover: ProxyFailoverPool},
+		func(proxyURL string, _ time.Duration) (time.Duration, error) {
+			return 0, errors.New("dial tcp: i/o timeout")
+		})
+
+	for _, raw := range []string{"", "10.0.0.1:1080", "socks5://10.0.0.1:1080#us-east"} {
+		if _, err := TestPoolProxy(0, raw); err == nil {
+			t.Errorf("%q accepted", raw)
+		}
+	}
+	health, err := TestPoolProxy(0, " socks5://10.0.0.9:1080:user:pass ")
+	if err != nil || health.Healthy || health.Error != "dial tcp: i/o timeout" {
+		t.Errorf("health = %+v, err = %v", health, err)
+	}
+	// 不在池中的代理不计入健康状态
+	if getProxyHealth("socks5://10.0.0.9:1080:user:pass") != nil {
+		t.Error("unpooled proxy recorded")
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"fmt"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+// accountProxyRegion 账号固定的代理地区：优先使用账号的 proxy_region，
+// 否则沿用账号自身代理在 SOCKS_PROXY_POOL 中标注的地区，都没有时不限地区
+func accountProxyRegion(pool *provider.ProxyPool, account *model.Account) string {
+	if account == nil {
+		return ""
+	}
+	if region := provider.NormalizeProxyRegion(account.ProxyRegion); region != "" {
+		return region
+	}
+	if account.Proxy != "" {
+		return pool.GetProxyRegion(account.Proxy)
+	}
+	return ""
+}
+
+// regionProxyError 代理池中没有账号所在地区的代理时返回的错误，此时不会换用其他地区的出口
+func regionProxyError(region string) error {
+	if region == "" {
+		return fmt.Errorf("没有可用的代理")
+	}
+	return fmt.Errorf("没有地区 %s 的可用代理", region)
+}
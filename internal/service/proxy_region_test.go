@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+func TestAccountProxyRegion(t *testing.T) {
+	t.Setenv("SOCKS_PROXY_POOL", "socks5://10.0.0.1:1080#us-east,socks5://10.0.0.2:1080")
+	pool := provider.NewProxyPool()
+
+	tests := []struct {
+		account *model.Account
+		want    string
+	}{
+		{&model.Account{ProxyRegion: " EU-West "}, "eu-west"},
+		{&model.Account{ProxyRegion: "eu-west", Proxy: "socks5://10.0.0.1:1080"}, "eu-west"},
+		{&model.Account{Proxy: "socks5://10.0.0.1:1080"}, "us-east"},
+		{&model.Account{Proxy: "socks5://10.0.0.2:1080"}, ""},
+		{&model.Account{}, ""},
+	}
+	for _, tt := range tests {
+		if got := accountProxyRegion(pool, tt.account); got != tt.want {
+			t.Errorf("accountProxyRegion(%+v) = %q, want %q", tt.account, got, tt.want)
+		}
+	}
+	if err := regionProxyError("ap-south"); err.Error() != "没有地区 ap-south 的可用代理" {
+		t.Errorf("error = %v", err)
+	}
+}
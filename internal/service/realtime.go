@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// realtimeHandshakeHeaders 握手响应中必须保留给客户端的头，不受上游响应头过滤影响
+var realtimeHandshakeHeaders = []string{"Connection", "Upgrade", "Sec-WebSocket-Accept", "Sec-WebSocket-Protocol", "Sec-WebSocket-Extensions"}
+
+// activeRealtimeSessions 当前转发中的 WebSocket 连接数
+var activeRealtimeSessions atomic.Int64
+
+// ActiveRealtimeSessions 返回当前转发中的 WebSocket 连接数
+func ActiveRealtimeSessions() int64 {
+	return activeRealtimeSessions.Load()
+}
+
+// IsWebSocketUpgrade 请求是否为 WebSocket 升级握手
+func IsWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RealtimeProxy 把 WebSocket 升级请求经号池转发到上游 /v1/realtime：
+// 握手时注入 Zencoder 请求头，连接建立后双向透传帧数据，账号在整个连接期间保持占用，连接关闭后才释放。
+// 模型从查询参数 model 读取；握手失败不重试，上游的错误响应原样返回给客户端
+func (s *OpenAIService) RealtimeProxy(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if !IsWebSocketUpgrade(r) {
+		return invalidRequest("realtime endpoint requires a WebSocket upgrade request")
+	}
+	modelID := r.URL.Query().Get("model")
+	if modelID == "" {
+		return invalidRequest("model query parameter is required")
+	}
+	if target, ok := ResolveModelAlias(modelID); ok {
+		modelID = target
+	}
+	if !EnsureModelAvailable(modelID) {
+		DebugLog(ctx, "[Realtime] 模型不存在: %s", modelID)
+		return ErrNoAvailableAccount
+	}
+	zenModel, _ := model.GetZenModel(modelID)
+	target, err := url.Parse(OpenAIBaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid upstream url: %w", err)
+	}
+
+	DebugLogRequest(ctx, "Realtime", r.URL.Path, modelID)
+
+	account, err := s.deps.Accounts.GetNextAccountForModel(modelID)
+	if err != nil {
+		DebugLogRequestEnd(ctx, "Realtime", false, err)
+		return err
+	}
+	// 普通占用 60 秒后会被自动释放，连接期间改为按句柄持有
+	release := func() { s.deps.Accounts.ReleaseAccount(account) }
+	if holder, ok := s.deps.Accounts.(SessionAccountProvider); ok {
+		release = holder.HoldAccount(account)
+	}
+	defer release()
+	DebugLogAccountSelected(ctx, "Realtime", account.ID, account.Email)
+
+	transport := s.deps.Upstream.Client(accountUpstreamProxy(account), zenModel).Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	start := time.Now()
+	var proxyErr error
+	upgraded := false
+	proxy := &httputil.ReverseProxy{
+		Transport: transport,
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = strings.TrimSuffix(target.Path, "/") + "/v1/realtime"
+			req.URL.RawPath = ""
+			req.Host = target.Host
+			setRealtimeHeaders(req, account, zenModel)
+			DebugLogRequestSent(ctx, "Realtime", req.URL.String())
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			RecordUpstreamResult(ctx, modelID, account.ID, start, resp, nil)
+			DebugLogResponseReceived(ctx, "Realtime", resp.StatusCode)
+			switch {
+			case resp.StatusCode == http.StatusSwitchingProtocols:
+				upgraded = true
+				activeRealtimeSessions.Add(1)
+				LogEvent(ctx, slog.LevelInfo, "Realtime", "已建立连接", logAccountID(account.ID), slog.String("model", modelID))
+			case resp.StatusCode == http.StatusTooManyRequests:
+				s.deps.Accounts.MarkAccountRateLimitedWithResponse(account, resp, GetRetryPolicy("openai").Cooling())
+			case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode >= 500:
+				s.deps.Accounts.MarkAccountError(account)
+			}
+			filtered := make(http.Header)
+			copyUpstreamHeaders(ctx, filtered, resp.Header)
+			for _, name := range realtimeHandshakeHeaders {
+				if v := resp.Header.Values(name); len(v) > 0 {
+					filtered[name] = v
+				}
+			}
+			resp.Header = filtered
+			return nil
+		},
+		ErrorHandler: func(_ http.ResponseWriter, _ *http.Request, err error) {
+			proxyErr = err
+		},
+	}
+	// 升级成功后 ServeHTTP 一直阻塞到任一方关闭连接
+	proxy.ServeHTTP(w, r)
+	if upgraded {
+		activeRealtimeSessions.Add(-1)
+		LogEvent(ctx, slog.LevelInfo, "Realtime", "连接已关闭", logAccountID(account.ID), slog.Int64("duration_ms", time.Since(start).Milliseconds()))
+	}
+
+	if proxyErr != nil && upgraded {
+		// 握手已成功，错误发生在接管连接时，响应已无法再写入
+		LogEvent(ctx, slog.LevelWarn, "Realtime", "连接转发失败", logAccountID(account.ID), logError(proxyErr))
+		DebugLogRequestEnd(ctx, "Realtime", false, proxyErr)
+		return ErrClientDisconnected
+	}
+	if proxyErr != nil {
+		RecordUpstreamResult(ctx, modelID, account.ID, start, nil, proxyErr)
+		s.deps.Accounts.MarkAccountError(account)
+		DebugLogRequestEnd(ctx, "Realtime", false, proxyErr)
+		return fmt.Errorf("%w: %v", ErrUpstreamUnreachable, proxyErr)
+	}
+	DebugLogRequestEnd(ctx, "Realtime", true, nil)
+	return nil
+}
+
+// setRealtimeHeaders 替换客户端的鉴权信息为账号凭证并注入 Zencoder 请求头，保留 WebSocket 握手头
+func setRealtimeHeaders(req *http.Request, account *model.Account, zenModel model.ZenModel) {
+	connection, upgrade := req.Header.Values("Connection"), req.Header.Values("Upgrade")
+	for _, name := range []string{"Authorization", "x-api-key", "x-goog-api-key", "X-Admin-Password"} {
+		req.Header.Del(name)
+	}
+	// 浏览器客户端通过 ?key= 鉴权，不转发给上游
+	query := req.URL.Query()
+	query.Del("key")
+	req.URL.RawQuery = query.Encode()
+
+	SetZencoderHeaders(req, account, zenModel)
+	if zenModel.Parameters != nil {
+		for k, v := range zenModel.Parameters.ExtraHeaders {
+			req.Header.Set(k, v)
+		}
+	}
+	// 握手是不带请求体的 GET
+	req.Header.Del("Content-Type")
+	req.Header["Connection"] = connection
+	req.Header["Upgrade"] = upgrade
+}
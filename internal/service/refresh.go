@@ -8,6 +8,8 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"zencoder2api/internal/model"
@@ -150,9 +152,12 @@ func disableTokenRecordsByEmail(email string, reason string) error {
 	return nil
 }
 
+// refreshTokenURL 刷新 token 的认证接口
+var refreshTokenURL = "https://auth.zencoder.ai/api/frontegg/oauth/token"
+
 // RefreshAccessToken 使用 refresh_token 获取新的 access_token
 func RefreshAccessToken(refreshToken string, proxy string) (*RefreshTokenResponse, error) {
-	url := "https://auth.zencoder.ai/api/frontegg/oauth/token"
+	url := refreshTokenURL
 	
 	// 打印调试日志
 	if IsDebugMode() {
@@ -314,42 +319,19 @@ func UpdateAccountToken(account *model.Account) error {
 		return fmt.Errorf("account %s has no refresh token", account.ClientID)
 	}
 	
-	// 调用刷新接口
-	tokenResp, err := RefreshAccessToken(account.RefreshToken, account.Proxy)
-	if err != nil {
+	// 调用刷新接口，新 token 验证通过前保留旧 refresh_token
+	if err := refreshAccountWithRotation(account); err != nil {
 		// 检查是否是账号锁定错误
 		if lockoutErr, ok := err.(*AccountLockoutError); ok {
 			// 将账号标记为封禁状态
 			if markErr := markAccountAsBanned(account, "用户被锁定: "+lockoutErr.Body); markErr != nil {
-				log.Printf("[账号管理] 标记账号封禁状态失败: %v", markErr)
+				log.Printf("[WARN] [账号管理] 标记账号封禁状态失败: %v", markErr)
 			}
 		}
 		return fmt.Errorf("failed to refresh token for account %s: %w", account.ClientID, err)
 	}
 	
-	// 计算过期时间
-	expiry := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-	
-	// 更新数据库
-	updates := map[string]interface{}{
-		"access_token":  tokenResp.AccessToken,
-		"refresh_token": tokenResp.RefreshToken, // 更新新的 refresh_token
-		"token_expiry":  expiry,
-		"updated_at":    time.Now(),
-	}
-	
-	if err := database.DB.Model(&model.Account{}).
-		Where("id = ?", account.ID).
-		Updates(updates).Error; err != nil {
-		return fmt.Errorf("failed to update account token: %w", err)
-	}
-	
-	// 更新内存中的值
-	account.AccessToken = tokenResp.AccessToken
-	account.RefreshToken = tokenResp.RefreshToken
-	account.TokenExpiry = expiry
-	
-	debugLogf("✅ Refreshed token for account %s, expires at %s", account.ClientID, expiry.Format(time.RFC3339))
+	debugLogf("✅ Refreshed token for account %s, expires at %s", account.ClientID, account.TokenExpiry.Format(time.RFC3339))
 	
 	return nil
 }
@@ -367,12 +349,12 @@ func UpdateTokenRecordToken(record *model.TokenRecord) error {
 		if lockoutErr, ok := err.(*AccountLockoutError); ok {
 			// 将token记录标记为封禁状态
 			if markErr := markTokenRecordAsBanned(record, "账号被锁定: "+lockoutErr.Body); markErr != nil {
-				log.Printf("[Token管理] 标记token记录封禁状态失败: %v", markErr)
+				log.Printf("[WARN] [Token管理] 标记token记录封禁状态失败: %v", markErr)
 			}
 			// 根据邮箱禁用相关的token记录
 			if record.Email != "" {
 				if disableErr := disableTokenRecordsByEmail(record.Email, "关联账号被锁定"); disableErr != nil {
-					log.Printf("[Token管理] 禁用相关token记录失败: %v", disableErr)
+					log.Printf("[WARN] [Token管理] 禁用相关token记录失败: %v", disableErr)
 				}
 			}
 			return fmt.Errorf("token record %d account locked out: %w", record.ID, err)
@@ -382,7 +364,7 @@ func UpdateTokenRecordToken(record *model.TokenRecord) error {
 		if strings.Contains(err.Error(), "refresh token expired or invalid") {
 			// 将token记录标记为过期状态
 			if markErr := markTokenRecordAsExpired(record, "Refresh token过期或无效"); markErr != nil {
-				log.Printf("[Token管理] 标记token记录过期状态失败: %v", markErr)
+				log.Printf("[WARN] [Token管理] 标记token记录过期状态失败: %v", markErr)
 			}
 			return fmt.Errorf("token record %d refresh token expired: %w", record.ID, err)
 		}
@@ -453,64 +435,97 @@ func CheckAndRefreshTokenRecord(record *model.TokenRecord) error {
 	return nil
 }
 
-// StartTokenRefreshScheduler 启动定时刷新 token 的调度器
+// tokenRefreshConcurrency 同时刷新的账号数上限，避免对认证接口造成压力
+const tokenRefreshConcurrency = 10
+
+// StartTokenRefreshScheduler 启动定时刷新 token 的调度器，间隔由 TOKEN_REFRESH_INTERVAL (秒) 配置，
+// 与号池刷新（POOL_REFRESH_INTERVAL）互不阻塞
 func StartTokenRefreshScheduler() {
+	interval := time.Duration(envPositiveInt("TOKEN_REFRESH_INTERVAL", 60)) * time.Second
 	go func() {
 		// 立即执行一次
 		refreshExpiredTokens()
-		
-		// 然后每分钟检查一次
-		ticker := time.NewTicker(1 * time.Minute)
+
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
-		
+
 		for range ticker.C {
 			refreshExpiredTokens()
 		}
 	}()
-	
-	log.Printf("🔄 Token refresh scheduler started - checking every minute")
+
+	log.Printf("🔄 Token refresh scheduler started - checking every %s", interval)
 }
 
-// refreshExpiredTokens 刷新即将过期的 tokens
+// refreshExpiredTokens 并发刷新 1 小时内过期的账号和生成 token，账号刷新成功后立即重载号池
 func refreshExpiredTokens() {
 	now := time.Now()
 	threshold := now.Add(time.Hour) // 1小时内即将过期的token
-	
+
 	// 查询所有即将过期的账号（排除banned状态）
 	var accounts []model.Account
 	if err := database.DB.Where("token_expiry < ?", threshold).
 		Where("status != ?", "banned").
-		Find(&accounts).Error; err == nil {
-		
-		for _, account := range accounts {
-			// 根据账号类型选择不同的刷新方式
-			if account.ClientSecret == "refresh-token-login" {
-				// refresh-token-login 账号使用 refresh_token 刷新
-				if account.RefreshToken != "" {
-					if err := UpdateAccountToken(&account); err != nil {
-						log.Printf("[Token刷新] ❌ refresh-token账号 %s 刷新失败: %v", account.ClientID, err)
+		Find(&accounts).Error; err != nil {
+		log.Printf("[WARN] [Token刷新] 查询即将过期的账号失败: %v", err)
+	} else if len(accounts) > 0 {
+		var wg sync.WaitGroup
+		var attempted, succeeded int32
+		semaphore := make(chan struct{}, tokenRefreshConcurrency)
+		for i := range accounts {
+			account := &accounts[i]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				var err error
+				// 根据账号类型选择不同的刷新方式
+				if account.ClientSecret == "refresh-token-login" {
+					// refresh-token-login 账号使用 refresh_token 刷新
+					if account.RefreshToken == "" {
+						return
 					}
-				}
-			} else {
-				// 普通账号使用 OAuth client credentials 刷新
-				if account.ClientID != "" && account.ClientSecret != "" {
-					if err := refreshAccountToken(&account); err != nil {
-						log.Printf("[Token刷新] ❌ 账号 %s OAuth刷新失败: %v", account.ClientID, err)
+					atomic.AddInt32(&attempted, 1)
+					if err = UpdateAccountToken(account); err != nil {
+						log.Printf("[WARN] [Token刷新] ❌ refresh-token账号 %s 刷新失败: %v", account.ClientID, err)
+					}
+				} else {
+					// 普通账号使用 OAuth client credentials 刷新
+					if account.ClientID == "" || account.ClientSecret == "" {
+						return
+					}
+					atomic.AddInt32(&attempted, 1)
+					if err = refreshAccountToken(account); err != nil {
+						log.Printf("[WARN] [Token刷新] ❌ 账号 %s OAuth刷新失败: %v", account.ClientID, err)
 					}
 				}
-			}
+				if err == nil {
+					atomic.AddInt32(&succeeded, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if attempted > 0 {
+			log.Printf("[Token刷新] 账号token刷新完成：成功 %d/%d", succeeded, attempted)
+		}
+		// 刷新后的账号不必等到下一轮号池刷新才可用
+		if succeeded > 0 {
+			pool.refresh()
 		}
 	}
-	
+
 	// 刷新 TokenRecord 的 tokens - 只排除banned状态的记录
 	var records []model.TokenRecord
 	if err := database.DB.Where("refresh_token != '' AND token_expiry < ?", threshold).
 		Where("status != ?", "banned").
 		Find(&records).Error; err == nil {
-		
+
 		for _, record := range records {
 			if err := UpdateTokenRecordToken(&record); err != nil {
-				log.Printf("[Token刷新] ❌ 生成token #%d 刷新失败: %v", record.ID, err)
+				log.Printf("[WARN] [Token刷新] ❌ 生成token #%d 刷新失败: %v", record.ID, err)
 			}
 		}
 	}
@@ -545,12 +560,12 @@ func RefreshTokenAndAccounts(tokenRecordID uint) error {
 		if lockoutErr, ok := err.(*AccountLockoutError); ok {
 			// 将token记录标记为封禁状态
 			if markErr := markTokenRecordAsBanned(&record, "账号被锁定: "+lockoutErr.Body); markErr != nil {
-				log.Printf("[Token管理] 标记token记录封禁状态失败: %v", markErr)
+				log.Printf("[WARN] [Token管理] 标记token记录封禁状态失败: %v", markErr)
 			}
 			// 根据邮箱禁用相关的token记录
 			if record.Email != "" {
 				if disableErr := disableTokenRecordsByEmail(record.Email, "关联账号被锁定"); disableErr != nil {
-					log.Printf("[Token管理] 禁用相关token记录失败: %v", disableErr)
+					log.Printf("[WARN] [Token管理] 禁用相关token记录失败: %v", disableErr)
 				}
 			}
 		}
@@ -559,7 +574,7 @@ func RefreshTokenAndAccounts(tokenRecordID uint) error {
 		if strings.Contains(err.Error(), "refresh token expired or invalid") {
 			// 将token记录标记为过期状态
 			if markErr := markTokenRecordAsExpired(&record, "Refresh token过期或无效"); markErr != nil {
-				log.Printf("[Token管理] 标记token记录过期状态失败: %v", markErr)
+				log.Printf("[WARN] [Token管理] 标记token记录过期状态失败: %v", markErr)
 			}
 		}
 		
@@ -613,7 +628,7 @@ func refreshAccountsByEmail(email string) {
 	// 查询所有相同邮箱的账号
 	var accounts []model.Account
 	if err := database.GetDB().Where("email = ?", email).Find(&accounts).Error; err != nil {
-		log.Printf("[账号刷新] 查询邮箱 %s 的账号失败: %v", email, err)
+		log.Printf("[WARN] [账号刷新] 查询邮箱 %s 的账号失败: %v", email, err)
 		return
 	}
 	
@@ -639,7 +654,7 @@ func refreshAccountsByEmail(email string) {
 		
 		// 使用OAuth方式刷新token
 		if err := refreshAccountToken(&account); err != nil {
-			log.Printf("[账号刷新] 账号 ID:%d 刷新失败: %v", account.ID, err)
+			log.Printf("[WARN] [账号刷新] 账号 ID:%d 刷新失败: %v", account.ID, err)
 			failCount++
 		} else {
 			log.Printf("[账号刷新] 账号 ID:%d 刷新成功", account.ID)
@@ -704,7 +719,7 @@ func refreshAccountToken(account *model.Account) error {
 		if isAccountLockoutError(resp.StatusCode, string(body)) {
 			// 将账号标记为封禁状态
 			if markErr := markAccountAsBanned(account, "OAuth认证失败-用户被锁定: "+string(body)); markErr != nil {
-				log.Printf("[账号管理] 标记账号封禁状态失败: %v", markErr)
+				log.Printf("[WARN] [账号管理] 标记账号封禁状态失败: %v", markErr)
 			}
 			return &AccountLockoutError{
 				StatusCode: resp.StatusCode,
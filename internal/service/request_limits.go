@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"zencoder2api/internal/model"
+)
+
+// RequestLimitSettings 转发前在网关拦截的请求大小限制
+type RequestLimitSettings struct {
+	MaxBodyBytes     int `json:"max_body_bytes"`     // 请求体字节数上限，0 表示不限制
+	PromptTokenLimit int `json:"prompt_token_limit"` // Anthropic 模型本地估算的输入 token 上限，0 表示不检查
+}
+
+var (
+	requestLimitMu       sync.RWMutex
+	requestLimitSettings RequestLimitSettings
+	requestLimitOnce     sync.Once
+)
+
+// loadRequestLimitSettings 读取 MAX_REQUEST_BODY_BYTES / ANTHROPIC_PROMPT_TOKEN_LIMIT
+func loadRequestLimitSettings() {
+	requestLimitSettings = RequestLimitSettings{
+		MaxBodyBytes:     envNonNegativeInt("MAX_REQUEST_BODY_BYTES"),
+		PromptTokenLimit: envNonNegativeInt("ANTHROPIC_PROMPT_TOKEN_LIMIT"),
+	}
+}
+
+// GetRequestLimitSettings 获取请求体大小和输入 token 上限
+func GetRequestLimitSettings() RequestLimitSettings {
+	requestLimitOnce.Do(loadRequestLimitSettings)
+	requestLimitMu.RLock()
+	defer requestLimitMu.RUnlock()
+	return requestLimitSettings
+}
+
+// SetRequestLimitSettings 运行时修改请求限制（仅内存生效）
+func SetRequestLimitSettings(settings RequestLimitSettings) error {
+	if settings.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes 不能为负数")
+	}
+	if settings.PromptTokenLimit < 0 {
+		return fmt.Errorf("prompt_token_limit 不能为负数")
+	}
+	requestLimitOnce.Do(loadRequestLimitSettings)
+	requestLimitMu.Lock()
+	defer requestLimitMu.Unlock()
+	requestLimitSettings = settings
+	return nil
+}
+
+// PromptTooLongError 本地估算的输入 token 数超过上限，请求未发往上游
+type PromptTooLongError struct {
+	Model  string
+	Tokens int
+	Limit  int
+}
+
+func (e *PromptTooLongError) Error() string {
+	// 与上游的 "prompt is too long" 错误保持相同的格式，客户端可以按同样的方式处理
+	return fmt.Sprintf("prompt is too long: %d tokens > %d maximum (estimated by gateway)", e.Tokens, e.Limit)
+}
+
+// CheckPromptLength 估算发往 Anthropic 模型的请求（/v1/messages 或 Chat Completions 格式）的输入 token 数，
+// 超过 ANTHROPIC_PROMPT_TOKEN_LIMIT 时返回 *PromptTooLongError；其他服务商的模型或无法解析的请求体不检查
+func CheckPromptLength(body []byte) error {
+	limit := GetRequestLimitSettings().PromptTokenLimit
+	if limit <= 0 {
+		return nil
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.Model == "" {
+		return nil
+	}
+	zenModel, ok := model.GetZenModel(req.Model)
+	if !ok || zenModel.ProviderID != "anthropic" {
+		return nil
+	}
+	tokens, err := EstimateAnthropicTokens(body)
+	if err != nil || tokens <= limit {
+		return nil
+	}
+	return &PromptTooLongError{Model: req.Model, Tokens: tokens, Limit: limit}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckPromptLength(t *testing.T) {
+	t.Cleanup(func() { SetRequestLimitSettings(RequestLimitSettings{}) })
+	long := `{"model":"%s","messages":[{"role":"user","content":"` + strings.Repeat("x", 4000) + `"}]}`
+
+	// 未设置上限时不检查
+	if err := CheckPromptLength([]byte(strings.Replace(long, "%s", "claude-sonnet-4-5-20250929", 1))); err != nil {
+		t.Fatalf("no limit: %v", err)
+	}
+
+	if err := SetRequestLimitSettings(RequestLimitSettings{PromptTokenLimit: 500}); err != nil {
+		t.Fatal(err)
+	}
+	err := CheckPromptLength([]byte(strings.Replace(long, "%s", "claude-sonnet-4-5-20250929", 1)))
+	var tooLong *PromptTooLongError
+	if !errors.As(err, &tooLong) || tooLong.Tokens != 1000 || tooLong.Limit != 500 {
+		t.Fatalf("CheckPromptLength = %v, want PromptTooLongError 1000 > 500", err)
+	}
+	if !strings.HasPrefix(err.Error(), "prompt is too long: 1000 tokens > 500 maximum") {
+		t.Errorf("message = %q, want the upstream wording", err.Error())
+	}
+
+	// 只检查 Anthropic 模型，短请求和无法解析的请求放行
+	for _, body := range []string{
+		strings.Replace(long, "%s", "gpt-5.1-codex-mini", 1),
+		`{"model":"claude-sonnet-4-5-20250929","messages":[{"role":"user","content":"hi"}]}`,
+		`not json`,
+	} {
+		if err := CheckPromptLength([]byte(body)); err != nil {
+			t.Errorf("CheckPromptLength(%.40s) = %v, want nil", body, err)
+		}
+	}
+
+	if SetRequestLimitSettings(RequestLimitSettings{MaxBodyBytes: -1}) == nil {
+		t.Error("negative max_body_bytes accepted")
+	}
+}
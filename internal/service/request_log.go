@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// 用量统计的分组方式
+const (
+	UsageGroupDay     = "day"
+	UsageGroupModel   = "model"
+	UsageGroupAccount = "account"
+	UsageGroupKey     = "key"
+)
+
+// usageGroupColumns 各分组方式对应的列
+var usageGroupColumns = map[string]string{
+	UsageGroupDay:     "date",
+	UsageGroupModel:   "model",
+	UsageGroupAccount: "account_id",
+	UsageGroupKey:     "key_hash",
+}
+
+// requestLogBufferLimit 数据库不可用时内存中最多保留的请求日志条数，超出后丢弃最早的
+const requestLogBufferLimit = 10000
+
+// 请求日志查询条数
+const (
+	RequestLogDefaultLimit = 100
+	RequestLogMaxLimit     = 1000
+)
+
+const requestBytesContextKey contextKey = "request_bytes"
+
+// WithRequestBytes 记录客户端请求体的大小，写入该请求每次上游调用的请求日志
+func WithRequestBytes(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, requestBytesContextKey, int64(n))
+}
+
+// recordRequestLog 记录一次上游调用，随用量统计一起批量写入数据库
+// 有响应体时在响应体关闭后才写入，以记录响应大小和流的持续时间
+func recordRequestLog(ctx context.Context, modelID string, accountID uint, category string, start, now time.Time, resp *http.Response) {
+	entry := model.RequestLog{
+		CreatedAt: now,
+		Date:      now.Format(usageDateLayout),
+		Model:     modelID,
+		AccountID: accountID,
+		ErrorType: category,
+		LatencyMs: now.Sub(start).Milliseconds(),
+	}
+	entry.RequestBytes, _ = ctx.Value(requestBytesContextKey).(int64)
+	if resp != nil {
+		entry.StatusCode = resp.StatusCode
+		entry.Cost = parseFloat(resp.Header.Get("Zen-Request-Cost"))
+		entry.Stream = strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+		if entry.RequestBytes == 0 && resp.Request != nil && resp.Request.ContentLength > 0 {
+			entry.RequestBytes = resp.Request.ContentLength
+		}
+	}
+	if key := GetAPIKey(ctx); key != "" {
+		entry.KeyHash = HashAPIKey(key)
+		entry.KeyMasked = MaskAPIKey(key)
+	}
+
+	zenModel, known := model.GetZenModel(modelID)
+	logUpstreamRequest(ctx, zenModel.ProviderID, modelID, accountID, entry.StatusCode, category, now.Sub(start))
+
+	if resp != nil && resp.Body != nil {
+		body := &loggedBody{ReadCloser: resp.Body, entry: entry, start: start, done: trackOpenResponse(accountID)}
+		if known && zenModel.ProviderID == "anthropic" && resp.StatusCode == http.StatusOK {
+			// 从响应中读取 prompt 缓存的写入和命中用量
+			body.usage = &anthropicUsageScanner{stream: entry.Stream}
+		}
+		// 协议升级（WebSocket）的响应体可写，包装后需保留写入能力，日志在连接关闭时写入
+		if rw, ok := resp.Body.(io.ReadWriteCloser); ok {
+			resp.Body = &loggedUpgradeBody{loggedBody: body, w: rw}
+			return
+		}
+		resp.Body = body
+		return
+	}
+	entry.DurationMs = entry.LatencyMs
+	appendRequestLog(entry)
+}
+
+// loggedBody 统计读取的响应字节数，关闭时补全请求日志并写入
+// 流式转发时读取和关闭可能在不同协程中进行
+type loggedBody struct {
+	io.ReadCloser
+	entry model.RequestLog
+	start time.Time
+	done  func() // 从账号的进行中响应数中移除
+	n     atomic.Int64
+	once  sync.Once
+
+	usage       *anthropicUsageScanner // 只在读取的协程中使用
+	usageMu     sync.Mutex
+	parsedUsage *anthropicUsage
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	if b.usage != nil {
+		if usage, ok := b.usage.feed(p[:n]); ok {
+			b.setUsage(usage)
+		}
+		if err == io.EOF {
+			if usage, ok := b.usage.eof(); ok {
+				b.setUsage(usage)
+			}
+		}
+	}
+	return n, err
+}
+
+func (b *loggedBody) setUsage(usage anthropicUsage) {
+	b.usageMu.Lock()
+	b.parsedUsage = &usage
+	b.usageMu.Unlock()
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.entry.ResponseBytes = b.n.Load()
+		b.entry.DurationMs = time.Since(b.start).Milliseconds()
+		b.usageMu.Lock()
+		if u := b.parsedUsage; u != nil {
+			b.entry.InputTokens = int64(u.InputTokens)
+			b.entry.CacheCreationTokens = int64(u.CacheCreationInputTokens)
+			b.entry.CacheReadTokens = int64(u.CacheReadInputTokens)
+		}
+		b.usageMu.Unlock()
+		appendRequestLog(b.entry)
+		if b.done != nil {
+			b.done()
+		}
+	})
+	return err
+}
+
+// loggedUpgradeBody 协议升级后的双向连接，读取和关闭经 loggedBody 记录，写入直接转给上游连接
+type loggedUpgradeBody struct {
+	*loggedBody
+	w io.Writer
+}
+
+func (b *loggedUpgradeBody) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
+
+func appendRequestLog(entry model.RequestLog) {
+	usageStats.mu.Lock()
+	defer usageStats.mu.Unlock()
+	usageStats.logs = append(usageStats.logs, entry)
+	if n := len(usageStats.logs); n > requestLogBufferLimit {
+		usageStats.logs = usageStats.logs[n-requestLogBufferLimit:]
+	}
+}
+
+// UsageGroupRow 按分组归集的用量
+type UsageGroupRow struct {
+	Key            string  `json:"key"`
+	Label          string  `json:"label,omitempty"` // 按 Key 分组时为脱敏的 Key，后台创建的 Key 附带名称
+	Requests       int64   `json:"requests"`
+	Errors         int64   `json:"errors"`
+	StreamRequests int64   `json:"stream_requests"`
+	Cost           float64 `json:"cost"`
+	AvgLatencyMs   float64 `json:"avg_latency_ms"`
+
+	InputTokens         int64   `json:"input_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_input_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_input_tokens"`
+	CacheHitRate        float64 `json:"cache_hit_rate"` // 命中缓存的输入占全部输入的比例，没有 Anthropic 用量时为 0
+}
+
+// UsageSummary 最近 days 天（含今天）按 group_by 归集的用量
+type UsageSummary struct {
+	GroupBy string          `json:"group_by"`
+	From    string          `json:"from"`
+	To      string          `json:"to"`
+	Rows    []UsageGroupRow `json:"rows"`
+}
+
+// AggregateRequestLogs 按日期、模型、账号或 API Key 归集请求日志；按日期时按日期排序，其余按消耗降序
+func AggregateRequestLogs(groupBy string, days int, now time.Time) (*UsageSummary, error) {
+	column, ok := usageGroupColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("group_by must be one of day, model, account, key")
+	}
+	if days <= 0 {
+		days = UsageReportDefaultDays
+	}
+	if days > UsageReportMaxDays {
+		days = UsageReportMaxDays
+	}
+	FlushUsageStats()
+
+	summary := &UsageSummary{
+		GroupBy: groupBy,
+		From:    now.AddDate(0, 0, -(days - 1)).Format(usageDateLayout),
+		To:      now.Format(usageDateLayout),
+		Rows:    []UsageGroupRow{},
+	}
+	rows, err := database.GetReadDB().Model(&model.RequestLog{}).
+		Select(column+" AS group_key, COUNT(*), "+
+			"SUM(CASE WHEN error_type <> '' THEN 1 ELSE 0 END), "+
+			"SUM(CASE WHEN stream THEN 1 ELSE 0 END), "+
+			"SUM(cost), AVG(latency_ms), MAX(key_masked), "+
+			"SUM(input_tokens), SUM(cache_creation_tokens), SUM(cache_read_tokens)").
+		Where("date >= ? AND date <= ?", summary.From, summary.To).
+		Group(column).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r UsageGroupRow
+		var masked string
+		if err := rows.Scan(&r.Key, &r.Requests, &r.Errors, &r.StreamRequests, &r.Cost, &r.AvgLatencyMs, &masked,
+			&r.InputTokens, &r.CacheCreationTokens, &r.CacheReadTokens); err != nil {
+			return nil, err
+		}
+		r.AvgLatencyMs = math.Round(r.AvgLatencyMs)
+		if total := r.InputTokens + r.CacheCreationTokens + r.CacheReadTokens; total > 0 {
+			r.CacheHitRate = math.Round(float64(r.CacheReadTokens)/float64(total)*1000) / 1000
+		}
+		if groupBy == UsageGroupKey {
+			r.Label = masked
+		}
+		summary.Rows = append(summary.Rows, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if groupBy == UsageGroupKey {
+		labelManagedKeys(summary.Rows)
+	}
+	sort.SliceStable(summary.Rows, func(i, j int) bool {
+		a, b := summary.Rows[i], summary.Rows[j]
+		if groupBy == UsageGroupDay {
+			return a.Key < b.Key
+		}
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.Requests > b.Requests
+	})
+	return summary, nil
+}
+
+// labelManagedKeys 为后台创建的 Key 附上名称
+func labelManagedKeys(rows []UsageGroupRow) {
+	hashes := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if r.Key != "" {
+			hashes = append(hashes, r.Key)
+		}
+	}
+	if len(hashes) == 0 {
+		return
+	}
+	var keys []model.APIKey
+	if database.GetReadDB().Where("key_hash IN ?", hashes).Find(&keys).Error != nil {
+		return
+	}
+	names := make(map[string]string, len(keys))
+	for _, k := range keys {
+		names[k.KeyHash] = k.Name
+	}
+	for i := range rows {
+		if name := names[rows[i].Key]; name != "" {
+			rows[i].Label += " (" + name + ")"
+		}
+	}
+}
+
+// RequestLogFilter 查询请求日志的条件，零值表示不过滤
+type RequestLogFilter struct {
+	Model      string
+	AccountID  uint
+	ErrorsOnly bool
+	Limit      int
+}
+
+// ListRequestLogs 返回最近的请求日志，最新的在前
+func ListRequestLogs(filter RequestLogFilter) ([]model.RequestLog, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = RequestLogDefaultLimit
+	}
+	if filter.Limit > RequestLogMaxLimit {
+		filter.Limit = RequestLogMaxLimit
+	}
+	FlushUsageStats()
+
+	query := database.GetReadDB().Model(&model.RequestLog{})
+	if filter.Model != "" {
+		query = query.Where("model = ?", filter.Model)
+	}
+	if filter.AccountID != 0 {
+		query = query.Where("account_id = ?", filter.AccountID)
+	}
+	if filter.ErrorsOnly {
+		query = query.Where("error_type <> ''")
+	}
+	var logs []model.RequestLog
+	err := query.Order("id desc").Limit(filter.Limit).Find(&logs).Error
+	return logs, err
+}
+
+// RequestSizeRow 按模型或账号统计的请求体、响应体大小和流持续时间的分位数
+type RequestSizeRow struct {
+	Key                 string `json:"key"`
+	Requests            int    `json:"requests"`
+	StreamRequests      int    `json:"stream_requests"`
+	RequestBytesP50     int64  `json:"request_bytes_p50"`
+	RequestBytesP95     int64  `json:"request_bytes_p95"`
+	RequestBytesMax     int64  `json:"request_bytes_max"`
+	ResponseBytesP50    int64  `json:"response_bytes_p50"` // 只统计成功的调用
+	ResponseBytesP95    int64  `json:"response_bytes_p95"`
+	StreamDurationMsP50 int64  `json:"stream_duration_ms_p50"` // 只统计成功的流式调用
+	StreamDurationMsP95 int64  `json:"stream_duration_ms_p95"`
+}
+
+// RequestSizeStats 最近 days 天（含今天）按 group_by 统计的大小和耗时分布
+type RequestSizeStats struct {
+	GroupBy string           `json:"group_by"`
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Rows    []RequestSizeRow `json:"rows"`
+}
+
+// AggregateRequestSizes 按模型或账号统计请求日志中请求体、响应体大小和流持续时间的 P50/P95，
+// 用于配置超时和找出发送异常请求体的客户端
+func AggregateRequestSizes(groupBy string, days int, now time.Time) (*RequestSizeStats, error) {
+	if groupBy != UsageGroupModel && groupBy != UsageGroupAccount {
+		return nil, fmt.Errorf("group_by must be one of model, account")
+	}
+	if days <= 0 {
+		days = UsageReportDefaultDays
+	}
+	if days > UsageReportMaxDays {
+		days = UsageReportMaxDays
+	}
+	FlushUsageStats()
+
+	stats := &RequestSizeStats{
+		GroupBy: groupBy,
+		From:    now.AddDate(0, 0, -(days - 1)).Format(usageDateLayout),
+		To:      now.Format(usageDateLayout),
+	}
+	var logs []model.RequestLog
+	err := database.GetReadDB().
+		Select("model", "account_id", "stream", "error_type", "request_bytes", "response_bytes", "duration_ms").
+		Where("date >= ? AND date <= ?", stats.From, stats.To).
+		Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Rows = buildRequestSizeRows(groupBy, logs)
+	return stats, nil
+}
+
+// buildRequestSizeRows 按分组计算分位数，请求体 P95 大的在前
+func buildRequestSizeRows(groupBy string, logs []model.RequestLog) []RequestSizeRow {
+	type samples struct {
+		requests, responses, durations []int64
+		streams                        int
+	}
+	groups := make(map[string]*samples)
+	for _, l := range logs {
+		key := l.Model
+		if groupBy == UsageGroupAccount {
+			key = fmt.Sprint(l.AccountID)
+		}
+		g := groups[key]
+		if g == nil {
+			g = &samples{}
+			groups[key] = g
+		}
+		g.requests = append(g.requests, l.RequestBytes)
+		if l.Stream {
+			g.streams++
+		}
+		if l.ErrorType != "" {
+			continue
+		}
+		g.responses = append(g.responses, l.ResponseBytes)
+		if l.Stream {
+			g.durations = append(g.durations, l.DurationMs)
+		}
+	}
+
+	rows := make([]RequestSizeRow, 0, len(groups))
+	for key, g := range groups {
+		for _, s := range [][]int64{g.requests, g.responses, g.durations} {
+			sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		}
+		rows = append(rows, RequestSizeRow{
+			Key:                 key,
+			Requests:            len(g.requests),
+			StreamRequests:      g.streams,
+			RequestBytesP50:     percentile(g.requests, 0.50),
+			RequestBytesP95:     percentile(g.requests, 0.95),
+			RequestBytesMax:     percentile(g.requests, 1),
+			ResponseBytesP50:    percentile(g.responses, 0.50),
+			ResponseBytesP95:    percentile(g.responses, 0.95),
+			StreamDurationMsP50: percentile(g.durations, 0.50),
+			StreamDurationMsP95: percentile(g.durations, 0.95),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].RequestBytesP95 != rows[j].RequestBytesP95 {
+			return rows[i].RequestBytesP95 > rows[j].RequestBytesP95
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
+
+// percentile 已排序样本的最近秩分位数，没有样本时为 0
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
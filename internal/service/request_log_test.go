@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestRequestLogAggregation(t *testing.T) {
+	initTestDB(t, "usage.db")
+	usageStats.mu.Lock()
+	usageStats.logs = nil
+	usageStats.mu.Unlock()
+
+	key, plain, err := CreateAPIKey(model.APIKeyRequest{Name: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamCtx := WithAPIKey(context.Background(), plain)
+	now := time.Now()
+	ok := func(cost, contentType string) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Zen-Request-Cost": {cost}, "Content-Type": {contentType}}}
+	}
+
+	RecordUpstreamResult(teamCtx, "claude-sonnet-4-5-20250929", 1, now.Add(-200*time.Millisecond), ok("3", "text/event-stream"), nil)
+	RecordUpstreamResult(teamCtx, "claude-sonnet-4-5-20250929", 2, now.Add(-100*time.Millisecond), ok("3", "application/json"), nil)
+	RecordUpstreamResult(context.Background(), "gpt-5.1-codex", 1, now, nil, errors.New("connection reset"))
+
+	summary, err := AggregateRequestLogs(UsageGroupModel, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Rows) != 2 {
+		t.Fatalf("rows = %+v", summary.Rows)
+	}
+	sonnet := summary.Rows[0]
+	if sonnet.Key != "claude-sonnet-4-5-20250929" || sonnet.Requests != 2 || sonnet.Cost != 6 || sonnet.StreamRequests != 1 || sonnet.Errors != 0 {
+		t.Errorf("sonnet row = %+v", sonnet)
+	}
+	if codex := summary.Rows[1]; codex.Errors != 1 || codex.Cost != 0 {
+		t.Errorf("codex row = %+v", codex)
+	}
+
+	byKey, err := AggregateRequestLogs(UsageGroupKey, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byKey.Rows[0].Key != key.KeyHash || byKey.Rows[0].Label != MaskAPIKey(plain)+" (team-a)" {
+		t.Errorf("key rows = %+v", byKey.Rows)
+	}
+
+	byAccount, err := AggregateRequestLogs(UsageGroupAccount, 1, now)
+	if err != nil || len(byAccount.Rows) != 2 || byAccount.Rows[0].Key != "1" {
+		t.Errorf("account rows = %+v, %v", byAccount, err)
+	}
+	if _, err := AggregateRequestLogs("team", 1, now); err == nil {
+		t.Error("unknown group_by should be rejected")
+	}
+
+	logs, err := ListRequestLogs(RequestLogFilter{ErrorsOnly: true})
+	if err != nil || len(logs) != 1 || logs[0].Model != "gpt-5.1-codex" || logs[0].StatusCode != 0 || logs[0].ErrorType == "" {
+		t.Errorf("error logs = %+v, %v", logs, err)
+	}
+}
+
+func TestRequestLogRecordsSizesWhenBodyCloses(t *testing.T) {
+	usageStats.mu.Lock()
+	usageStats.logs = nil
+	usageStats.mu.Unlock()
+	takeLogs := func() []model.RequestLog {
+		usageStats.mu.Lock()
+		defer usageStats.mu.Unlock()
+		logs := usageStats.logs
+		usageStats.logs = nil
+		return logs
+	}
+
+	ctx := WithRequestBytes(context.Background(), 2048)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader("data: hello\n\n")),
+	}
+	RecordUpstreamResult(ctx, "claude-sonnet-4-5-20250929", 1, time.Now().Add(-50*time.Millisecond), resp, nil)
+	if logs := takeLogs(); len(logs) != 0 {
+		t.Fatalf("log written before the body was consumed: %+v", logs)
+	}
+
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body.Close()
+	logs := takeLogs()
+	if len(logs) != 1 {
+		t.Fatalf("logs = %+v", logs)
+	}
+	if l := logs[0]; l.RequestBytes != 2048 || l.ResponseBytes != 13 || l.DurationMs < 50 || !l.Stream {
+		t.Errorf("log = %+v", l)
+	}
+
+	// 没有客户端请求体大小时使用发往上游的请求体大小，网络错误立即写入
+	upstreamReq, _ := http.NewRequest("POST", "http://upstream", strings.NewReader("{}"))
+	RecordUpstreamResult(context.Background(), "gpt-5.1-codex", 1, time.Now(), &http.Response{StatusCode: http.StatusOK, Request: upstreamReq}, nil)
+	RecordUpstreamResult(ctx, "gpt-5.1-codex", 1, time.Now(), nil, errors.New("connection reset"))
+	logs = takeLogs()
+	if len(logs) != 2 || logs[0].RequestBytes != 2 || logs[1].RequestBytes != 2048 {
+		t.Errorf("logs = %+v", logs)
+	}
+}
+
+func TestRequestLogRecordsPromptCacheUsage(t *testing.T) {
+	usageStats.mu.Lock()
+	usageStats.logs = nil
+	usageStats.mu.Unlock()
+	takeLog := func() model.RequestLog {
+		t.Helper()
+		usageStats.mu.Lock()
+		defer usageStats.mu.Unlock()
+		logs := usageStats.logs
+		usageStats.logs = nil
+		if len(logs) != 1 {
+			t.Fatalf("logs = %+v", logs)
+		}
+		return logs[0]
+	}
+	record := func(modelID, contentType, body string) {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {contentType}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}
+		RecordUpstreamResult(context.Background(), modelID, 1, time.Now(), resp, nil)
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	record("claude-sonnet-4-5-20250929", "text/event-stream",
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"cache_creation_input_tokens\":300,\"cache_read_input_tokens\":4000}}}\n\n")
+	if l := takeLog(); l.InputTokens != 12 || l.CacheCreationTokens != 300 || l.CacheReadTokens != 4000 {
+		t.Errorf("stream log = %+v", l)
+	}
+
+	record("claude-sonnet-4-5-20250929", "application/json", `{"content":[],"usage":{"input_tokens":5,"cache_read_input_tokens":900,"output_tokens":3}}`)
+	if l := takeLog(); l.InputTokens != 5 || l.CacheCreationTokens != 0 || l.CacheReadTokens != 900 {
+		t.Errorf("json log = %+v", l)
+	}
+
+	// 非 Anthropic 模型不解析
+	record("gpt-5.1-codex", "application/json", `{"usage":{"input_tokens":5,"cache_read_input_tokens":900}}`)
+	if l := takeLog(); l.InputTokens != 0 || l.CacheReadTokens != 0 {
+		t.Errorf("openai log = %+v", l)
+	}
+}
+
+func TestBuildRequestSizeRows(t *testing.T) {
+	var logs []model.RequestLog
+	for i := int64(1); i <= 20; i++ {
+		logs = append(logs, model.RequestLog{Model: "sonnet", AccountID: 1, RequestBytes: i * 100, ResponseBytes: i * 10, DurationMs: i * 1000, Stream: i%2 == 0})
+	}
+	logs = append(logs,
+		model.RequestLog{Model: "haiku", AccountID: 2, RequestBytes: 50, ResponseBytes: 5, DurationMs: 10},
+		model.RequestLog{Model: "haiku", AccountID: 2, RequestBytes: 1 << 20, ErrorType: "timeout", Stream: true, DurationMs: 90000},
+	)
+
+	rows := buildRequestSizeRows(UsageGroupModel, logs)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	haiku, sonnet := rows[0], rows[1]
+	if haiku.Key != "haiku" || haiku.RequestBytesMax != 1<<20 || haiku.ResponseBytesP95 != 5 || haiku.StreamRequests != 1 || haiku.StreamDurationMsP95 != 0 {
+		t.Errorf("failed calls should only count toward request sizes: %+v", haiku)
+	}
+	if sonnet.RequestBytesP50 != 1000 || sonnet.RequestBytesP95 != 1900 || sonnet.ResponseBytesP95 != 190 ||
+		sonnet.StreamRequests != 10 || sonnet.StreamDurationMsP50 != 10000 || sonnet.StreamDurationMsP95 != 20000 {
+		t.Errorf("sonnet row = %+v", sonnet)
+	}
+
+	if byAccount := buildRequestSizeRows(UsageGroupAccount, logs); len(byAccount) != 2 || byAccount[0].Key != "2" {
+		t.Errorf("account rows = %+v", byAccount)
+	}
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 请求校验模式
+const (
+	RequestValidationLenient = "lenient" // 原样转发，由上游报错（默认，兼容带私有字段的客户端）
+	RequestValidationStrict  = "strict"  // 按接口 schema 校验，字段类型错误或参数名未知时直接返回 400，不占用账号
+)
+
+// 需要校验的请求格式
+const (
+	RequestSchemaAnthropicMessages = "anthropic_messages"
+	RequestSchemaChatCompletions   = "chat_completions"
+	RequestSchemaResponses         = "responses"
+)
+
+var (
+	requestValidationMu   sync.RWMutex
+	requestValidationMode string
+	requestValidationOnce sync.Once
+)
+
+func validRequestValidationMode(mode string) bool {
+	return mode == RequestValidationLenient || mode == RequestValidationStrict
+}
+
+// loadRequestValidation 从 REQUEST_VALIDATION 读取请求校验模式
+func loadRequestValidation() {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("REQUEST_VALIDATION")))
+	if mode == "" {
+		mode = RequestValidationLenient
+	} else if !validRequestValidationMode(mode) {
+		log.Printf("[WARN] 无效的 REQUEST_VALIDATION: %s，使用 %s", mode, RequestValidationLenient)
+		mode = RequestValidationLenient
+	}
+	requestValidationMode = mode
+}
+
+// GetRequestValidation 获取请求校验模式
+func GetRequestValidation() string {
+	requestValidationOnce.Do(loadRequestValidation)
+	requestValidationMu.RLock()
+	defer requestValidationMu.RUnlock()
+	return requestValidationMode
+}
+
+// SetRequestValidation 运行时修改请求校验模式（仅内存生效）
+func SetRequestValidation(mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if !validRequestValidationMode(mode) {
+		return fmt.Errorf("mode 只能为 lenient 或 strict")
+	}
+	requestValidationOnce.Do(loadRequestValidation)
+	requestValidationMu.Lock()
+	requestValidationMode = mode
+	requestValidationMu.Unlock()
+	log.Printf("[RequestValidation] 请求校验模式已调整为 %s", mode)
+	return nil
+}
+
+// jsonType JSON 值的类型，可按位组合
+type jsonType uint8
+
+const (
+	jsonString jsonType = 1 << iota
+	jsonNumber
+	jsonInteger
+	jsonBool
+	jsonObject
+	jsonArray
+)
+
+func (t jsonType) String() string {
+	var names []string
+	for _, n := range []struct {
+		t    jsonType
+		name string
+	}{{jsonString, "string"}, {jsonNumber, "number"}, {jsonInteger, "integer"}, {jsonBool, "boolean"}, {jsonObject, "object"}, {jsonArray, "array"}} {
+		if t&n.t != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// schema 请求字段的简化 JSON Schema；可选字段的 null 视为未传
+type schema struct {
+	types    jsonType
+	fields   map[string]*schema // 对象的已知字段
+	required []string
+	open     bool // 对象允许未知字段（如内容块、工具参数等各类型字段不同的对象）
+	items    *schema
+	enum     []string
+	min, max *float64
+}
+
+func field(types jsonType) *schema { return &schema{types: types} }
+
+func object(fields map[string]*schema, required ...string) *schema {
+	return &schema{types: jsonObject, fields: fields, required: required}
+}
+
+func openObject(required ...string) *schema {
+	return &schema{types: jsonObject, open: true, required: required}
+}
+
+func arrayOf(items *schema) *schema { return &schema{types: jsonArray, items: items} }
+
+func (s *schema) oneOf(values ...string) *schema {
+	s.enum = values
+	return s
+}
+
+func (s *schema) between(min, max float64) *schema {
+	s.min, s.max = &min, &max
+	return s
+}
+
+func (s *schema) atLeast(min float64) *schema {
+	s.min = &min
+	return s
+}
+
+func (s *schema) or(items *schema) *schema {
+	s.types |= jsonArray
+	s.items = items
+	return s
+}
+
+var (
+	anthropicMessagesSchema = object(map[string]*schema{
+		"model": field(jsonString),
+		"messages": arrayOf(object(map[string]*schema{
+			"role":    field(jsonString).oneOf("user", "assistant"),
+			"content": field(jsonString).or(openObject("type")),
+		}, "role", "content")),
+		"max_tokens":         field(jsonInteger).atLeast(1),
+		"system":             field(jsonString).or(openObject("type")),
+		"metadata":           openObject(),
+		"stop_sequences":     arrayOf(field(jsonString)),
+		"stream":             field(jsonBool),
+		"temperature":        field(jsonNumber).between(0, 1),
+		"top_p":              field(jsonNumber).between(0, 1),
+		"top_k":              field(jsonInteger).atLeast(0),
+		"tools":              arrayOf(openObject("name")),
+		"tool_choice":        openObject("type"),
+		"thinking":           openObject("type"),
+		"service_tier":       field(jsonString),
+		"container":          field(jsonString | jsonObject),
+		"mcp_servers":        arrayOf(openObject()),
+		"context_management": openObject(),
+	}, "model", "messages", "max_tokens")
+
+	chatCompletionsSchema = object(map[string]*schema{
+		"model": field(jsonString),
+		"messages": arrayOf(object(map[string]*schema{
+			"role":              field(jsonString).oneOf("system", "developer", "user", "assistant", "tool", "function"),
+			"content":           field(jsonString).or(openObject("type")),
+			"name":              field(jsonString),
+			"tool_calls":        arrayOf(openObject()),
+			"tool_call_id":      field(jsonString),
+			"function_call":     openObject(),
+			"refusal":           field(jsonString),
+			"audio":             openObject(),
+			"reasoning_content": field(jsonString),
+		}, "role")),
+		"frequency_penalty":     field(jsonNumber).between(-2, 2),
+		"presence_penalty":      field(jsonNumber).between(-2, 2),
+		"logit_bias":            openObject(),
+		"logprobs":              field(jsonBool),
+		"top_logprobs":          field(jsonInteger).between(0, 20),
+		"max_tokens":            field(jsonInteger).atLeast(1),
+		"max_completion_tokens": field(jsonInteger).atLeast(1),
+		"n":                     field(jsonInteger).atLeast(1),
+		"modalities":            arrayOf(field(jsonString)),
+		"prediction":            openObject(),
+		"audio":                 openObject(),
+		"reasoning_effort":      field(jsonString).oneOf("minimal", "low", "medium", "high"),
+		"verbosity":             field(jsonString).oneOf("low", "medium", "high"),
+		"response_format":       openObject("type"),
+		"seed":                  field(jsonInteger),
+		"service_tier":          field(jsonString),
+		"stop":                  field(jsonString).or(field(jsonString)),
+		"store":                 field(jsonBool),
+		"stream":                field(jsonBool),
+		"stream_options":        openObject(),
+		"temperature":           field(jsonNumber).between(0, 2),
+		"top_p":                 field(jsonNumber).between(0, 1),
+		"tools":                 arrayOf(openObject("type")),
+		"tool_choice":           field(jsonString | jsonObject),
+		"parallel_tool_calls":   field(jsonBool),
+		"functions":             arrayOf(openObject("name")),
+		"function_call":         field(jsonString | jsonObject),
+		"user":                  field(jsonString),
+		"metadata":              openObject(),
+		"web_search_options":    openObject(),
+		"prompt_cache_key":      field(jsonString),
+		"safety_identifier":     field(jsonString),
+	}, "model", "messages")
+
+	responsesSchema = object(map[string]*schema{
+		"model":                field(jsonString),
+		"input":                field(jsonString).or(openObject()),
+		"instructions":         field(jsonString),
+		"max_output_tokens":    field(jsonInteger).atLeast(1),
+		"max_tool_calls":       field(jsonInteger).atLeast(1),
+		"metadata":             openObject(),
+		"parallel_tool_calls":  field(jsonBool),
+		"previous_response_id": field(jsonString),
+		"conversation":         field(jsonString | jsonObject),
+		"reasoning":            openObject(),
+		"text":                 openObject(),
+		"store":                field(jsonBool),
+		"stream":               field(jsonBool),
+		"stream_options":       openObject(),
+		"background":           field(jsonBool),
+		"temperature":          field(jsonNumber).between(0, 2),
+		"top_p":                field(jsonNumber).between(0, 1),
+		"top_logprobs":         field(jsonInteger).between(0, 20),
+		"tools":                arrayOf(openObject("type")),
+		"tool_choice":          field(jsonString | jsonObject),
+		"truncation":           field(jsonString).oneOf("auto", "disabled"),
+		"include":              arrayOf(field(jsonString)),
+		"prompt":               openObject(),
+		"service_tier":         field(jsonString),
+		"user":                 field(jsonString),
+		"prompt_cache_key":     field(jsonString),
+		"safety_identifier":    field(jsonString),
+	}, "model")
+
+	requestSchemas = map[string]*schema{
+		RequestSchemaAnthropicMessages: anthropicMessagesSchema,
+		RequestSchemaChatCompletions:   chatCompletionsSchema,
+		RequestSchemaResponses:         responsesSchema,
+	}
+)
+
+// ValidateRequest 按 kind 对应的接口 schema 校验请求体，
+// 失败时返回带出错参数路径（如 messages.0.content）的 *InvalidRequestError
+func ValidateRequest(kind string, body []byte) error {
+	s, ok := requestSchemas[kind]
+	if !ok {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return &InvalidRequestError{Message: fmt.Sprintf("invalid JSON body: %v", err)}
+	}
+	return s.validate("", v)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func schemaError(path, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	return &InvalidRequestError{Message: msg, Param: path}
+}
+
+func typeOf(v interface{}) jsonType {
+	switch val := v.(type) {
+	case string:
+		return jsonString
+	case json.Number:
+		if _, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+			return jsonInteger | jsonNumber
+		}
+		return jsonNumber
+	case bool:
+		return jsonBool
+	case map[string]interface{}:
+		return jsonObject
+	case []interface{}:
+		return jsonArray
+	}
+	return 0
+}
+
+func (s *schema) validate(path string, v interface{}) error {
+	t := typeOf(v)
+	if t&s.types == 0 {
+		got := "null"
+		if t != 0 {
+			got = (t &^ jsonInteger).String()
+		}
+		return schemaError(path, "expected %s, got %s", s.types, got)
+	}
+
+	switch val := v.(type) {
+	case string:
+		if len(s.enum) > 0 && !containsString(s.enum, val) {
+			return schemaError(path, "must be one of %s, got %q", strings.Join(s.enum, ", "), val)
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if s.min != nil && f < *s.min {
+			return schemaError(path, "must be at least %v, got %v", *s.min, val)
+		}
+		if s.max != nil && f > *s.max {
+			return schemaError(path, "must be at most %v, got %v", *s.max, val)
+		}
+	case []interface{}:
+		if s.items == nil {
+			return nil
+		}
+		for i, item := range val {
+			if err := s.items.validate(joinPath(path, strconv.Itoa(i)), item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		return s.validateObject(path, val)
+	}
+	return nil
+}
+
+func (s *schema) validateObject(path string, obj map[string]interface{}) error {
+	for _, name := range s.required {
+		if v, ok := obj[name]; !ok || v == nil {
+			return schemaError(joinPath(path, name), "field required")
+		}
+	}
+	// 按字段名排序，同一请求总是报告同一个错误
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := obj[k]
+		fs, known := s.fields[k]
+		if !known {
+			if s.open {
+				continue
+			}
+			if hint := closestField(k, s.fields); hint != "" {
+				return schemaError(joinPath(path, k), "unknown parameter, did you mean %q?", hint)
+			}
+			return schemaError(joinPath(path, k), "unknown parameter")
+		}
+		if v == nil {
+			continue
+		}
+		if err := fs.validate(joinPath(path, k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closestField 返回与拼错的参数名编辑距离最近（不超过 2）的已知字段
+func closestField(name string, fields map[string]*schema) string {
+	best, bestDist := "", 3
+	for known := range fields {
+		if d := editDistance(name, known); d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		body      string
+		wantParam string // 为空表示校验通过
+		wantMsg   string
+	}{
+		{
+			name: "valid anthropic request",
+			kind: RequestSchemaAnthropicMessages,
+			body: `{"model":"claude-sonnet-4-5-20250929","max_tokens":1024,"system":[{"type":"text","text":"be brief"}],"messages":[{"role":"user","content":[{"type":"text","text":"hi","cache_control":{"type":"ephemeral"}}]}],"temperature":null}`,
+		},
+		{
+			name:      "misspelled anthropic parameter",
+			kind:      RequestSchemaAnthropicMessages,
+			body:      `{"model":"m","max_tokens":1,"messages":[],"temprature":0.5}`,
+			wantParam: "temprature",
+			wantMsg:   `temprature: unknown parameter, did you mean "temperature"?`,
+		},
+		{
+			name:      "max_tokens must be an integer",
+			kind:      RequestSchemaAnthropicMessages,
+			body:      `{"model":"m","max_tokens":"1024","messages":[]}`,
+			wantParam: "max_tokens",
+			wantMsg:   "max_tokens: expected integer, got string",
+		},
+		{
+			name:      "missing anthropic max_tokens",
+			kind:      RequestSchemaAnthropicMessages,
+			body:      `{"model":"m","messages":[]}`,
+			wantParam: "max_tokens",
+			wantMsg:   "max_tokens: field required",
+		},
+		{
+			name:      "anthropic rejects system role in messages",
+			kind:      RequestSchemaAnthropicMessages,
+			body:      `{"model":"m","max_tokens":1,"messages":[{"role":"user","content":"a"},{"role":"system","content":"b"}]}`,
+			wantParam: "messages.1.role",
+			wantMsg:   `messages.1.role: must be one of user, assistant, got "system"`,
+		},
+		{
+			name:      "anthropic temperature out of range",
+			kind:      RequestSchemaAnthropicMessages,
+			body:      `{"model":"m","max_tokens":1,"messages":[],"temperature":1.5}`,
+			wantParam: "temperature",
+			wantMsg:   "temperature: must be at most 1, got 1.5",
+		},
+		{
+			name: "valid chat completion with nulls and stop string",
+			kind: RequestSchemaChatCompletions,
+			body: `{"model":"gpt-5.1-codex","messages":[{"role":"system","content":"s"},{"role":"user","content":[{"type":"text","text":"hi"}]},{"role":"assistant","content":null,"tool_calls":[{"id":"1","type":"function","function":{"name":"f","arguments":"{}"}}]}],"stop":"END","max_tokens":null,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name:      "chat content block without type",
+			kind:      RequestSchemaChatCompletions,
+			body:      `{"model":"m","messages":[{"role":"user","content":[{"text":"hi"}]}]}`,
+			wantParam: "messages.0.content.0.type",
+			wantMsg:   "messages.0.content.0.type: field required",
+		},
+		{
+			name:      "chat stream must be boolean",
+			kind:      RequestSchemaChatCompletions,
+			body:      `{"model":"m","messages":[],"stream":"true"}`,
+			wantParam: "stream",
+			wantMsg:   "stream: expected boolean, got string",
+		},
+		{
+			name:      "unknown message field without a close match",
+			kind:      RequestSchemaChatCompletions,
+			body:      `{"model":"m","messages":[{"role":"user","content":"hi","priority":1}]}`,
+			wantParam: "messages.0.priority",
+			wantMsg:   "messages.0.priority: unknown parameter",
+		},
+		{
+			name:      "responses input must be string or array",
+			kind:      RequestSchemaResponses,
+			body:      `{"model":"m","input":{"role":"user"}}`,
+			wantParam: "input",
+			wantMsg:   "input: expected string or array, got object",
+		},
+		{
+			name: "valid responses request",
+			kind: RequestSchemaResponses,
+			body: `{"model":"m","input":[{"role":"user","content":"hi"}],"reasoning":{"effort":"low"},"max_output_tokens":100}`,
+		},
+		{
+			name:    "invalid JSON",
+			kind:    RequestSchemaResponses,
+			body:    `{"model":`,
+			wantMsg: "invalid JSON body: unexpected EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequest(tt.kind, []byte(tt.body))
+			if tt.wantMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var invalid *InvalidRequestError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want *InvalidRequestError", err)
+			}
+			if invalid.Message != tt.wantMsg || invalid.Param != tt.wantParam {
+				t.Errorf("got (%q, %q), want (%q, %q)", invalid.Param, invalid.Message, tt.wantParam, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestSetRequestValidation(t *testing.T) {
+	defer SetRequestValidation(RequestValidationLenient)
+	if err := SetRequestValidation("Strict"); err != nil || GetRequestValidation() != RequestValidationStrict {
+		t.Errorf("mode = %s, err = %v", GetRequestValidation(), err)
+	}
+	if err := SetRequestValidation("loose"); err == nil {
+		t.Error("unknown mode should be rejected")
+	}
+}
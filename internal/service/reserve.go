@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+var (
+	premiumReserveMu   sync.RWMutex
+	premiumReserve     int
+	premiumReserveOnce sync.Once
+)
+
+// loadPremiumReserve 从 PREMIUM_RESERVED_ACCOUNTS 读取预留给 PremiumOnly 模型的 Max 账号数
+func loadPremiumReserve() {
+	raw := strings.TrimSpace(os.Getenv("PREMIUM_RESERVED_ACCOUNTS"))
+	if raw == "" {
+		return
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("[WARN] 无效的 PREMIUM_RESERVED_ACCOUNTS: %s，已忽略", raw)
+		return
+	}
+	premiumReserve = n
+}
+
+// GetPremiumReserve 获取预留给 PremiumOnly 模型的 Max 账号数
+func GetPremiumReserve() int {
+	premiumReserveOnce.Do(loadPremiumReserve)
+	premiumReserveMu.RLock()
+	defer premiumReserveMu.RUnlock()
+	return premiumReserve
+}
+
+// SetPremiumReserve 运行时修改预留账号数（仅内存生效）
+func SetPremiumReserve(n int) error {
+	if n < 0 {
+		return fmt.Errorf("预留账号数不能为负数")
+	}
+	premiumReserveOnce.Do(loadPremiumReserve)
+	premiumReserveMu.Lock()
+	defer premiumReserveMu.Unlock()
+	premiumReserve = n
+	return nil
+}
+
+// isPremiumModel 判断模型是否仅限 Advanced/Max 使用
+func isPremiumModel(modelID string) bool {
+	zenModel, ok := model.GetZenModel(modelID)
+	return ok && zenModel.PremiumOnly
+}
+
+// reservedAccountIDs 选出预留给 PremiumOnly 模型的账号
+// 按 ID 取前 n 个可调度（未冷却、未冻结）的 Max 账号，账号状态不变时号池刷新前后预留的是同一批账号
+func reservedAccountIDs(accounts []*model.Account, n int, now time.Time) map[uint]bool {
+	if n <= 0 {
+		return nil
+	}
+	var ids []uint
+	statusMu.RLock()
+	for _, acc := range accounts {
+		if acc.PlanType == model.PlanMax && accountSchedulable(acc, now) {
+			ids = append(ids, acc.ID)
+		}
+	}
+	statusMu.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+
+	reserved := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		reserved[id] = true
+	}
+	return reserved
+}
+
+// accountSchedulable 判断账号当前是否可能被调度，冷却或冻结中的账号不占用预留名额，调用方需持有 statusMu 读锁
+func accountSchedulable(acc *model.Account, now time.Time) bool {
+	if acc.IsCooling || now.Before(acc.CoolingUntil) {
+		return false
+	}
+	if status, ok := accountStatuses[acc.ID]; ok && now.Before(status.FrozenUntil) {
+		return false
+	}
+	return true
+}
+
+// reservedForModel 返回本次请求不能使用的预留账号，PremiumOnly 模型可以使用全部账号
+// 未指定模型的请求按普通模型处理
+func reservedForModel(accounts []*model.Account, modelID string) map[uint]bool {
+	if isPremiumModel(modelID) {
+		return nil
+	}
+	return reservedAccountIDs(accounts, GetPremiumReserve(), time.Now())
+}
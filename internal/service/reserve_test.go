@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestReservedAccountIDs(t *testing.T) {
+	accounts := []*model.Account{
+		{ID: 5, PlanType: model.PlanMax},
+		{ID: 2, PlanType: model.PlanAdvanced},
+		{ID: 3, PlanType: model.PlanMax},
+		{ID: 9, PlanType: model.PlanMax},
+	}
+
+	if got := reservedAccountIDs(accounts, 0, time.Now()); len(got) != 0 {
+		t.Errorf("reserve 0: got %v", got)
+	}
+	got := reservedAccountIDs(accounts, 2, time.Now())
+	if len(got) != 2 || !got[3] || !got[5] {
+		t.Errorf("reserve 2: got %v, want lowest Max IDs 3 and 5", got)
+	}
+	if got := reservedAccountIDs(accounts, 10, time.Now()); len(got) != 3 || got[2] {
+		t.Errorf("reserve 10: got %v, want all Max accounts only", got)
+	}
+}
+
+func TestReservedAccountIDsSkipsUnschedulable(t *testing.T) {
+	now := time.Now()
+	accounts := []*model.Account{
+		{ID: 101, PlanType: model.PlanMax, IsCooling: true},
+		{ID: 102, PlanType: model.PlanMax},
+		{ID: 103, PlanType: model.PlanMax},
+		{ID: 104, PlanType: model.PlanMax},
+	}
+	statusMu.Lock()
+	accountStatuses[102] = &AccountStatus{FrozenUntil: now.Add(time.Minute)}
+	statusMu.Unlock()
+	defer func() {
+		statusMu.Lock()
+		delete(accountStatuses, 102)
+		statusMu.Unlock()
+	}()
+
+	got := reservedAccountIDs(accounts, 2, now)
+	if len(got) != 2 || !got[103] || !got[104] {
+		t.Errorf("reserved = %v, want schedulable accounts 103 and 104", got)
+	}
+}
+
+func TestReservedForModel(t *testing.T) {
+	defer SetPremiumReserve(0)
+	if err := SetPremiumReserve(1); err != nil {
+		t.Fatal(err)
+	}
+	accounts := []*model.Account{{ID: 1, PlanType: model.PlanMax}, {ID: 2, PlanType: model.PlanMax}}
+
+	if got := reservedForModel(accounts, "claude-opus-4-5-20251101-thinking"); len(got) != 0 {
+		t.Errorf("premium model should use all accounts, got reserved %v", got)
+	}
+	if got := reservedForModel(accounts, "claude-sonnet-4-5-20250929-thinking"); !got[1] || got[2] {
+		t.Errorf("regular model reserved = %v, want only account 1", got)
+	}
+
+	if got := reservedForModel(accounts, ""); !got[1] {
+		t.Errorf("request without model reserved = %v, want account 1 kept for premium models", got)
+	}
+
+	if err := SetPremiumReserve(-1); err == nil {
+		t.Error("expected error for negative reserve")
+	}
+}
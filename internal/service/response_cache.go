@@ -0,0 +1,96 @@
+package service
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ResponseCacheSettings 非流式响应缓存的有效期和容量
+type ResponseCacheSettings struct {
+	TTLSeconds int `json:"ttl_seconds"` // 缓存有效期，0 为不缓存
+	MaxEntries int `json:"max_entries"` // 最多缓存的响应数，超出时淘汰最久未命中的
+	MaxBytes   int `json:"max_bytes"`   // 超过该大小的响应不缓存
+}
+
+// CachedResponse 缓存的响应
+type CachedResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+}
+
+type responseCacheEntry struct {
+	key       string
+	resp      *CachedResponse
+	expiresAt time.Time
+}
+
+var (
+	responseCacheSettings     ResponseCacheSettings
+	responseCacheSettingsOnce sync.Once
+
+	responseCacheMu    sync.Mutex
+	responseCacheLRU   = list.New()
+	responseCacheIndex = make(map[string]*list.Element)
+)
+
+// GetResponseCacheSettings 读取 RESPONSE_CACHE_TTL / RESPONSE_CACHE_MAX_ENTRIES / RESPONSE_CACHE_MAX_BYTES
+func GetResponseCacheSettings() ResponseCacheSettings {
+	responseCacheSettingsOnce.Do(func() {
+		responseCacheSettings = ResponseCacheSettings{
+			TTLSeconds: envNonNegativeInt("RESPONSE_CACHE_TTL"),
+			MaxEntries: envPositiveInt("RESPONSE_CACHE_MAX_ENTRIES", 1000),
+			MaxBytes:   envPositiveInt("RESPONSE_CACHE_MAX_BYTES", 1<<20),
+		}
+	})
+	return responseCacheSettings
+}
+
+// LookupResponseCache 查找未过期的缓存响应，命中时移到最近使用的位置
+func LookupResponseCache(key string) *CachedResponse {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	elem, ok := responseCacheIndex[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		responseCacheLRU.Remove(elem)
+		delete(responseCacheIndex, key)
+		return nil
+	}
+	responseCacheLRU.MoveToFront(elem)
+	return entry.resp
+}
+
+// SaveResponseCache 缓存响应，超过条数上限时淘汰最久未命中的
+func SaveResponseCache(key string, status int, header http.Header, body []byte) {
+	settings := GetResponseCacheSettings()
+	if settings.TTLSeconds <= 0 || len(body) > settings.MaxBytes {
+		return
+	}
+	now := time.Now()
+	entry := &responseCacheEntry{
+		key:       key,
+		resp:      &CachedResponse{Status: status, Header: header, Body: body, StoredAt: now},
+		expiresAt: now.Add(time.Duration(settings.TTLSeconds) * time.Second),
+	}
+
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	if elem, ok := responseCacheIndex[key]; ok {
+		elem.Value = entry
+		responseCacheLRU.MoveToFront(elem)
+		return
+	}
+	responseCacheIndex[key] = responseCacheLRU.PushFront(entry)
+	for responseCacheLRU.Len() > settings.MaxEntries {
+		oldest := responseCacheLRU.Back()
+		responseCacheLRU.Remove(oldest)
+		delete(responseCacheIndex, oldest.Value.(*responseCacheEntry).key)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 上游响应头的转发策略
+const (
+	ResponseHeadersStandard = "standard" // 只转发标准响应头（默认）
+	ResponseHeadersStrip    = "strip"    // 转发除 Zen-* 以外的全部响应头
+	ResponseHeadersAll      = "all"      // 原样转发
+)
+
+// standardResponseHeaders standard 策略下转发的响应头
+var standardResponseHeaders = map[string]bool{
+	"Cache-Control":       true,
+	"Content-Disposition": true,
+	"Content-Encoding":    true,
+	"Content-Language":    true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+	"Date":                true,
+	"Etag":                true,
+	"Expires":             true,
+	"Last-Modified":       true,
+	"Request-Id":          true,
+	"Retry-After":         true,
+	"Vary":                true,
+	"X-Request-Id":        true,
+}
+
+// ResponseHeaderSettings 全局策略及按 API Key 的策略，Key 策略优先
+type ResponseHeaderSettings struct {
+	Policy string            `json:"policy"`
+	Keys   map[string]string `json:"keys"` // 按 API Key（已脱敏）的策略
+}
+
+var (
+	responseHeadersMu      sync.RWMutex
+	responseHeaderSettings ResponseHeaderSettings
+	responseHeadersOnce    sync.Once
+)
+
+const responseHeaderDebugContextKey contextKey = "response_header_debug"
+
+func validResponseHeaderPolicy(policy string) bool {
+	switch policy {
+	case ResponseHeadersStandard, ResponseHeadersStrip, ResponseHeadersAll:
+		return true
+	}
+	return false
+}
+
+// loadResponseHeaderSettings 从 RESPONSE_HEADER_POLICY 读取全局策略，按 Key 的策略只能通过设置接口修改
+func loadResponseHeaderSettings() {
+	policy := strings.ToLower(strings.TrimSpace(os.Getenv("RESPONSE_HEADER_POLICY")))
+	if policy == "" {
+		policy = ResponseHeadersStandard
+	} else if !validResponseHeaderPolicy(policy) {
+		log.Printf("[WARN] 无效的 RESPONSE_HEADER_POLICY: %s，使用默认值 standard", policy)
+		policy = ResponseHeadersStandard
+	}
+	responseHeaderSettings = ResponseHeaderSettings{Policy: policy, Keys: make(map[string]string)}
+}
+
+// GetResponseHeaderSettings 获取当前响应头策略副本
+func GetResponseHeaderSettings() ResponseHeaderSettings {
+	responseHeadersOnce.Do(loadResponseHeaderSettings)
+	responseHeadersMu.RLock()
+	defer responseHeadersMu.RUnlock()
+
+	result := ResponseHeaderSettings{Policy: responseHeaderSettings.Policy, Keys: make(map[string]string, len(responseHeaderSettings.Keys))}
+	for k, v := range responseHeaderSettings.Keys {
+		result.Keys[MaskAPIKey(k)] = v
+	}
+	return result
+}
+
+// SetResponseHeaderPolicy 运行时修改响应头策略（仅内存生效）
+// apiKey 为空时修改全局策略；否则修改该 Key 的策略，策略为空时删除
+func SetResponseHeaderPolicy(apiKey, policy string) error {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if (apiKey == "" || policy != "") && !validResponseHeaderPolicy(policy) {
+		return fmt.Errorf("policy 只能为 standard、strip 或 all")
+	}
+	responseHeadersOnce.Do(loadResponseHeaderSettings)
+	responseHeadersMu.Lock()
+	defer responseHeadersMu.Unlock()
+
+	switch {
+	case apiKey == "":
+		responseHeaderSettings.Policy = policy
+	case policy == "":
+		delete(responseHeaderSettings.Keys, apiKey)
+	default:
+		responseHeaderSettings.Keys[apiKey] = policy
+	}
+	return nil
+}
+
+// WithResponseHeaderDebug 标记请求由管理员调试，原样返回上游响应头
+func WithResponseHeaderDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, responseHeaderDebugContextKey, true)
+}
+
+// responseHeaderPolicyFor 返回请求适用的策略：管理员调试 > Key 策略 > 全局策略
+func responseHeaderPolicyFor(ctx context.Context) string {
+	if debug, _ := ctx.Value(responseHeaderDebugContextKey).(bool); debug {
+		return ResponseHeadersAll
+	}
+	responseHeadersOnce.Do(loadResponseHeaderSettings)
+	responseHeadersMu.RLock()
+	defer responseHeadersMu.RUnlock()
+
+	if policy, ok := responseHeaderSettings.Keys[GetAPIKey(ctx)]; ok {
+		return policy
+	}
+	return responseHeaderSettings.Policy
+}
+
+// allowResponseHeader 策略是否允许转发该响应头
+func allowResponseHeader(policy, name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	switch policy {
+	case ResponseHeadersAll:
+		return true
+	case ResponseHeadersStrip:
+		return !strings.HasPrefix(name, "Zen-")
+	default:
+		return standardResponseHeaders[name]
+	}
+}
+
+// copyUpstreamHeaders 按请求适用的策略把上游响应头复制给客户端，skip 中的响应头和网关自己的 X-Trace-Id 始终不复制
+func copyUpstreamHeaders(ctx context.Context, dst, src http.Header, skip ...string) {
+	policy := responseHeaderPolicyFor(ctx)
+	for k, v := range src {
+		if !allowResponseHeader(policy, k) || containsHeader(skip, k) || strings.EqualFold(k, TraceIDHeader) {
+			continue
+		}
+		for _, vv := range v {
+			dst.Add(k, vv)
+		}
+	}
+}
+
+func containsHeader(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
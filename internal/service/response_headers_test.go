@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func upstreamHeaders() http.Header {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", "42")
+	h.Set("Request-Id", "req_1")
+	h.Set("Zen-Quota-Remaining", "17")
+	h.Set("Zen-Account-Hint", "acc_9")
+	h.Set("X-Upstream-Node", "node-3")
+	return h
+}
+
+func TestCopyUpstreamHeaders(t *testing.T) {
+	defer SetResponseHeaderPolicy("", ResponseHeadersStandard)
+	defer SetResponseHeaderPolicy("vip", "")
+
+	if err := SetResponseHeaderPolicy("vip", ResponseHeadersStrip); err != nil {
+		t.Fatal(err)
+	}
+	other := WithAPIKey(context.Background(), "other")
+	vip := WithAPIKey(context.Background(), "vip")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		skip    []string
+		present []string
+		absent  []string
+	}{
+		{"global standard keeps allowlist only", other, nil,
+			[]string{"Content-Type", "Content-Length", "Request-Id"},
+			[]string{"Zen-Quota-Remaining", "Zen-Account-Hint", "X-Upstream-Node"}},
+		{"key strip drops only Zen-*", vip, nil,
+			[]string{"Content-Type", "X-Upstream-Node"},
+			[]string{"Zen-Quota-Remaining", "Zen-Account-Hint"}},
+		{"admin debug forwards all", WithResponseHeaderDebug(other), nil,
+			[]string{"Zen-Quota-Remaining", "Zen-Account-Hint", "X-Upstream-Node"},
+			nil},
+		{"skip applies even in debug", WithResponseHeaderDebug(vip), []string{"content-length"},
+			[]string{"Content-Type", "Zen-Account-Hint"},
+			[]string{"Content-Length"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := http.Header{}
+			copyUpstreamHeaders(tt.ctx, dst, upstreamHeaders(), tt.skip...)
+			for _, k := range tt.present {
+				if dst.Get(k) == "" {
+					t.Errorf("%s missing", k)
+				}
+			}
+			for _, k := range tt.absent {
+				if dst.Get(k) != "" {
+					t.Errorf("%s forwarded: %q", k, dst.Get(k))
+				}
+			}
+		})
+	}
+}
+
+func TestSetResponseHeaderPolicy(t *testing.T) {
+	defer SetResponseHeaderPolicy("", ResponseHeadersStandard)
+	defer SetResponseHeaderPolicy("vip", "")
+
+	if err := SetResponseHeaderPolicy("", ""); err == nil {
+		t.Error("empty global policy accepted")
+	}
+	if err := SetResponseHeaderPolicy("vip", "everything"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+	if err := SetResponseHeaderPolicy("", " ALL "); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetResponseHeaderPolicy("vip", ResponseHeadersStandard); err != nil {
+		t.Fatal(err)
+	}
+	settings := GetResponseHeaderSettings()
+	if settings.Policy != ResponseHeadersAll || settings.Keys[MaskAPIKey("vip")] != ResponseHeadersStandard {
+		t.Fatalf("settings = %+v", settings)
+	}
+
+	// 删除 Key 策略后回落到全局策略
+	if err := SetResponseHeaderPolicy("vip", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := responseHeaderPolicyFor(WithAPIKey(context.Background(), "vip")); got != ResponseHeadersAll {
+		t.Errorf("policy after delete = %q, want all", got)
+	}
+}
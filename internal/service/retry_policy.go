@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// 重试之间的退避方式
+const (
+	BackoffNone        = "none"        // 立即换号重试
+	BackoffFixed       = "fixed"       // 每次等待 backoffMs
+	BackoffExponential = "exponential" // 第 n 次重试等待 backoffMs * 2^(n-1)，不超过 maxBackoffMs
+)
+
+// retryPolicySettingKey 重试策略在 settings 表中的键
+const retryPolicySettingKey = "retry_policy"
+
+// retryPolicyMaxRetries 每个请求最多尝试的账号数上限
+const retryPolicyMaxRetries = 10
+
+// RetryPolicy 重试与账号冷却策略，服务商覆盖中的零值字段沿用默认策略
+type RetryPolicy struct {
+	MaxRetries          int    `json:"maxRetries,omitempty"` // 每个请求最多尝试的账号数
+	Backoff             string `json:"backoff,omitempty"`
+	BackoffMs           int    `json:"backoffMs,omitempty"`
+	MaxBackoffMs        int    `json:"maxBackoffMs,omitempty"`        // 0 表示不限
+	CoolingSeconds      int    `json:"coolingSeconds,omitempty"`      // 429 限流后账号冷却时长（积分耗尽时冷却到积分刷新）
+	ShortCoolingSeconds int    `json:"shortCoolingSeconds,omitempty"` // 短期限流的冷却时长
+	FreezeMinSeconds    int    `json:"freezeMinSeconds,omitempty"`    // 上游限速跟踪出错时随机冻结账号的下限
+	FreezeMaxSeconds    int    `json:"freezeMaxSeconds,omitempty"`
+}
+
+// RetryPolicySettings 默认策略及按服务商的覆盖
+type RetryPolicySettings struct {
+	Default   RetryPolicy            `json:"default"`
+	Providers map[string]RetryPolicy `json:"providers"`
+}
+
+// builtinRetryPolicy 未配置时的策略，与此前的硬编码行为一致
+var builtinRetryPolicy = RetryPolicy{
+	MaxRetries:          MaxRetries,
+	Backoff:             BackoffNone,
+	CoolingSeconds:      3600,
+	ShortCoolingSeconds: 5,
+	FreezeMinSeconds:    5,
+	FreezeMaxSeconds:    10,
+}
+
+var (
+	retryPolicyMu   sync.RWMutex
+	retryPolicy     RetryPolicySettings
+	retryPolicyOnce sync.Once
+)
+
+// merge 用 o 中的非零字段覆盖 p
+func (p RetryPolicy) merge(o RetryPolicy) RetryPolicy {
+	if o.MaxRetries != 0 {
+		p.MaxRetries = o.MaxRetries
+	}
+	if o.Backoff != "" {
+		p.Backoff = o.Backoff
+	}
+	if o.BackoffMs != 0 {
+		p.BackoffMs = o.BackoffMs
+	}
+	if o.MaxBackoffMs != 0 {
+		p.MaxBackoffMs = o.MaxBackoffMs
+	}
+	if o.CoolingSeconds != 0 {
+		p.CoolingSeconds = o.CoolingSeconds
+	}
+	if o.ShortCoolingSeconds != 0 {
+		p.ShortCoolingSeconds = o.ShortCoolingSeconds
+	}
+	if o.FreezeMinSeconds != 0 {
+		p.FreezeMinSeconds = o.FreezeMinSeconds
+	}
+	if o.FreezeMaxSeconds != 0 {
+		p.FreezeMaxSeconds = o.FreezeMaxSeconds
+	}
+	return p
+}
+
+func (p RetryPolicy) isZero() bool {
+	return p == RetryPolicy{}
+}
+
+// validate 校验合并后的完整策略
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxRetries < 1 || p.MaxRetries > retryPolicyMaxRetries:
+		return fmt.Errorf("maxRetries must be between 1 and %d", retryPolicyMaxRetries)
+	case p.Backoff != BackoffNone && p.Backoff != BackoffFixed && p.Backoff != BackoffExponential:
+		return fmt.Errorf("backoff must be one of none, fixed, exponential")
+	case p.BackoffMs < 0 || p.MaxBackoffMs < 0:
+		return fmt.Errorf("backoffMs and maxBackoffMs must not be negative")
+	case p.CoolingSeconds < 1 || p.ShortCoolingSeconds < 1:
+		return fmt.Errorf("coolingSeconds and shortCoolingSeconds must be positive")
+	case p.FreezeMinSeconds < 1 || p.FreezeMaxSeconds < p.FreezeMinSeconds:
+		return fmt.Errorf("freezeMinSeconds must be positive and not greater than freezeMaxSeconds")
+	}
+	return nil
+}
+
+// normalizeRetryPolicySettings 合并内置默认值并校验，无效的服务商覆盖返回错误
+func normalizeRetryPolicySettings(s RetryPolicySettings) (RetryPolicySettings, error) {
+	result := RetryPolicySettings{
+		Default:   builtinRetryPolicy.merge(s.Default),
+		Providers: make(map[string]RetryPolicy),
+	}
+	result.Default.Backoff = strings.ToLower(result.Default.Backoff)
+	if err := result.Default.validate(); err != nil {
+		return result, fmt.Errorf("default: %w", err)
+	}
+	for providerID, p := range s.Providers {
+		providerID = strings.ToLower(strings.TrimSpace(providerID))
+		if !knownProviders[providerID] {
+			return result, fmt.Errorf("unknown provider: %s", providerID)
+		}
+		if p.isZero() {
+			continue
+		}
+		p.Backoff = strings.ToLower(p.Backoff)
+		if err := result.Default.merge(p).validate(); err != nil {
+			return result, fmt.Errorf("%s: %w", providerID, err)
+		}
+		result.Providers[providerID] = p
+	}
+	return result, nil
+}
+
+// loadRetryPolicy 先读 RETRY_POLICY 环境变量，数据库中保存过管理后台的修改时以数据库为准
+func loadRetryPolicy() {
+	retryPolicy, _ = normalizeRetryPolicySettings(RetryPolicySettings{})
+
+	if raw := strings.TrimSpace(os.Getenv("RETRY_POLICY")); raw != "" {
+		if s, err := parseRetryPolicySettings(raw); err != nil {
+			log.Printf("[WARN] 无效的 RETRY_POLICY，使用默认重试策略: %v", err)
+		} else {
+			retryPolicy = s
+		}
+	}
+
+	if !database.Healthy() {
+		return
+	}
+	var setting model.Setting
+	err := database.GetDB().Where(&model.Setting{Key: retryPolicySettingKey}).Limit(1).Find(&setting).Error
+	if err != nil || setting.Key == "" {
+		return
+	}
+	if s, err := parseRetryPolicySettings(setting.Value); err != nil {
+		log.Printf("[WARN] 数据库中保存的重试策略无效，已忽略: %v", err)
+	} else {
+		retryPolicy = s
+		log.Printf("[INFO] 已加载数据库中保存的重试策略")
+	}
+}
+
+func parseRetryPolicySettings(raw string) (RetryPolicySettings, error) {
+	var s RetryPolicySettings
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return s, err
+	}
+	return normalizeRetryPolicySettings(s)
+}
+
+// GetRetryPolicySettings 获取默认策略及服务商覆盖的副本
+func GetRetryPolicySettings() RetryPolicySettings {
+	retryPolicyOnce.Do(loadRetryPolicy)
+	retryPolicyMu.RLock()
+	defer retryPolicyMu.RUnlock()
+
+	result := RetryPolicySettings{Default: retryPolicy.Default, Providers: make(map[string]RetryPolicy, len(retryPolicy.Providers))}
+	for k, v := range retryPolicy.Providers {
+		result.Providers[k] = v
+	}
+	return result
+}
+
+// GetRetryPolicy 返回服务商实际生效的策略
+func GetRetryPolicy(providerID string) RetryPolicy {
+	retryPolicyOnce.Do(loadRetryPolicy)
+	retryPolicyMu.RLock()
+	defer retryPolicyMu.RUnlock()
+	return retryPolicy.Default.merge(retryPolicy.Providers[providerID])
+}
+
+// SetRetryPolicy 运行时修改默认策略（providerID 为空）或服务商覆盖，并保存到数据库以便重启后保留
+// 修改默认策略时零值字段恢复内置默认值；服务商覆盖全部为零值时删除。策略无效时返回 *InvalidRequestError
+func SetRetryPolicy(providerID string, p RetryPolicy) error {
+	retryPolicyOnce.Do(loadRetryPolicy)
+	providerID = strings.ToLower(strings.TrimSpace(providerID))
+
+	retryPolicyMu.Lock()
+	next := RetryPolicySettings{Default: retryPolicy.Default, Providers: make(map[string]RetryPolicy, len(retryPolicy.Providers))}
+	for k, v := range retryPolicy.Providers {
+		next.Providers[k] = v
+	}
+	if providerID == "" {
+		next.Default = p
+	} else {
+		next.Providers[providerID] = p
+	}
+	normalized, err := normalizeRetryPolicySettings(next)
+	if err != nil {
+		retryPolicyMu.Unlock()
+		return &InvalidRequestError{Message: err.Error()}
+	}
+	retryPolicy = normalized
+	retryPolicyMu.Unlock()
+
+	// 未配置数据库时只在内存中生效
+	if database.GetDB() == nil {
+		return nil
+	}
+	value, _ := json.Marshal(normalized)
+	setting := model.Setting{Key: retryPolicySettingKey, Value: string(value), UpdatedAt: time.Now()}
+	return database.Exec("保存重试策略", func(db *gorm.DB) error {
+		return db.Save(&setting).Error
+	})
+}
+
+// EffectiveRetryPolicies 各服务商实际生效的策略
+func EffectiveRetryPolicies() map[string]RetryPolicy {
+	result := make(map[string]RetryPolicy, len(knownProviders))
+	for p := range knownProviders {
+		result[p] = GetRetryPolicy(p)
+	}
+	return result
+}
+
+// Delay 第 attempt 次重试（从 1 开始）前的等待时间
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt <= 0 || p.BackoffMs <= 0 {
+		return 0
+	}
+	var ms int
+	switch p.Backoff {
+	case BackoffFixed:
+		ms = p.BackoffMs
+	case BackoffExponential:
+		ms = p.BackoffMs
+		for i := 1; i < attempt && (p.MaxBackoffMs <= 0 || ms < p.MaxBackoffMs); i++ {
+			ms *= 2
+		}
+	default:
+		return 0
+	}
+	if p.MaxBackoffMs > 0 && ms > p.MaxBackoffMs {
+		ms = p.MaxBackoffMs
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Cooling 429 限流后的账号冷却时长
+func (p RetryPolicy) Cooling() time.Duration {
+	return time.Duration(p.CoolingSeconds) * time.Second
+}
+
+// ShortCooling 短期限流的账号冷却时长
+func (p RetryPolicy) ShortCooling() time.Duration {
+	return time.Duration(p.ShortCoolingSeconds) * time.Second
+}
+
+// FreezeDuration 在 [freezeMinSeconds, freezeMaxSeconds] 中随机取冻结时长，避免多个账号同时解冻
+func (p RetryPolicy) FreezeDuration() time.Duration {
+	seconds := p.FreezeMinSeconds
+	if p.FreezeMaxSeconds > p.FreezeMinSeconds {
+		seconds += rand.Intn(p.FreezeMaxSeconds - p.FreezeMinSeconds + 1)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// waitRetry 第 attempt 次尝试（从 0 开始）前按退避策略等待，客户端断开时提前返回
+func waitRetry(ctx context.Context, p RetryPolicy, attempt int) error {
+	delay := p.Delay(attempt)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
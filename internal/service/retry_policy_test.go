@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	exp := RetryPolicy{Backoff: BackoffExponential, BackoffMs: 100, MaxBackoffMs: 500}
+	want := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}
+	for attempt, w := range want {
+		if got := exp.Delay(attempt); got != w {
+			t.Errorf("exponential Delay(%d) = %v, want %v", attempt, got, w)
+		}
+	}
+	fixed := RetryPolicy{Backoff: BackoffFixed, BackoffMs: 250}
+	if fixed.Delay(0) != 0 || fixed.Delay(3) != 250*time.Millisecond {
+		t.Errorf("fixed delays = %v, %v", fixed.Delay(0), fixed.Delay(3))
+	}
+	if (RetryPolicy{Backoff: BackoffNone, BackoffMs: 250}).Delay(2) != 0 {
+		t.Error("none backoff should not wait")
+	}
+
+	freeze := RetryPolicy{FreezeMinSeconds: 5, FreezeMaxSeconds: 10}
+	for i := 0; i < 50; i++ {
+		if d := freeze.FreezeDuration(); d < 5*time.Second || d > 10*time.Second {
+			t.Fatalf("freeze duration %v out of range", d)
+		}
+	}
+}
+
+func TestRetryPolicySettings(t *testing.T) {
+	s, err := parseRetryPolicySettings(`{"default":{"maxRetries":5},"providers":{"XAI":{"backoff":"Fixed","backoffMs":200,"shortCoolingSeconds":30}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未配置的字段沿用内置默认值
+	if s.Default.MaxRetries != 5 || s.Default.CoolingSeconds != 3600 || s.Default.Backoff != BackoffNone {
+		t.Errorf("default = %+v", s.Default)
+	}
+	xai := s.Default.merge(s.Providers["xai"])
+	if xai.MaxRetries != 5 || xai.Backoff != BackoffFixed || xai.BackoffMs != 200 || xai.ShortCooling() != 30*time.Second {
+		t.Errorf("xai = %+v", xai)
+	}
+
+	for _, raw := range []string{
+		`{"default":{"maxRetries":11}}`,
+		`{"default":{"backoff":"linear"}}`,
+		`{"default":{"freezeMinSeconds":20}}`,
+		`{"providers":{"mistral":{"maxRetries":2}}}`,
+		`{"providers":{"openai":{"coolingSeconds":-1}}}`,
+	} {
+		if _, err := parseRetryPolicySettings(raw); err == nil {
+			t.Errorf("%s: expected error", raw)
+		}
+	}
+
+	before := GetRetryPolicySettings()
+	defer func() {
+		SetRetryPolicy("", before.Default)
+		SetRetryPolicy("gemini", before.Providers["gemini"])
+	}()
+	if err := SetRetryPolicy("gemini", RetryPolicy{MaxRetries: 2, CoolingSeconds: 600}); err != nil {
+		t.Fatal(err)
+	}
+	if p := GetRetryPolicy("gemini"); p.MaxRetries != 2 || p.Cooling() != 10*time.Minute || p.FreezeMinSeconds != before.Default.FreezeMinSeconds {
+		t.Errorf("gemini = %+v", p)
+	}
+	var invalid *InvalidRequestError
+	if err := SetRetryPolicy("gemini", RetryPolicy{MaxRetries: 99}); !errors.As(err, &invalid) {
+		t.Errorf("invalid policy err = %v", err)
+	}
+	if GetRetryPolicy("gemini").MaxRetries != 2 {
+		t.Error("rejected update should not change the policy")
+	}
+}
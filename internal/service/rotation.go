@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// errTokenRejected 新 access_token 被上游拒绝
+var errTokenRejected = errors.New("新 access_token 验证未通过")
+
+// accessTokenProbe 验证 access_token 是否可用，返回 errTokenRejected 表示确定无效，其他错误表示无法确认
+var accessTokenProbe = probeAccessToken
+
+// probeAccessToken 用新 token 请求上游 models 接口，401/403 视为无效
+func probeAccessToken(accessToken, proxy string) error {
+	req, err := http.NewRequest("GET", ZencoderModelsURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "zen-cli/0.9.0-SNAPSHOT_4c6ffdd-windows-x64")
+
+	client := createHTTPClient(proxy)
+	client.Timeout = 15 * time.Second
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: status %d", errTokenRejected, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("验证请求返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// refreshAccountWithRotation 刷新账号 token，并保证 refresh_token 轮换失败时可以恢复
+//  1. 当前 refresh_token 已失效而上次轮换的旧 token 仍在时，改用旧 token 刷新（自动回滚）
+//  2. 新 token 写库时把本次使用的 refresh_token 保存到 previous_refresh_token
+//  3. 用新 access_token 探测上游，确定无效时恢复旧 token 并保留新 refresh_token 备用；验证通过后才丢弃旧 token
+func refreshAccountWithRotation(account *model.Account) error {
+	usedToken := account.RefreshToken
+	tokenResp, err := RefreshAccessToken(usedToken, account.Proxy)
+	if err != nil && account.PreviousRefreshToken != "" && isRefreshTokenInvalid(err) {
+		log.Printf("[TokenRotation] 账号 %s (ID:%d) 当前 refresh_token 无效，回退到上一个 refresh_token", account.ClientID, account.ID)
+		usedToken = account.PreviousRefreshToken
+		tokenResp, err = RefreshAccessToken(usedToken, account.Proxy)
+	}
+	if err != nil {
+		return err
+	}
+	if tokenResp.AccessToken == "" {
+		return fmt.Errorf("刷新响应缺少 access_token")
+	}
+
+	newRefreshToken := tokenResp.RefreshToken
+	if newRefreshToken == "" {
+		// 上游未轮换 refresh_token，继续使用原来的
+		newRefreshToken = usedToken
+	}
+	expiry := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+
+	previous := ""
+	if newRefreshToken != usedToken {
+		previous = usedToken
+	}
+	if err := saveAccountTokens(account.ID, tokenResp.AccessToken, newRefreshToken, previous, expiry); err != nil {
+		return err
+	}
+
+	probeErr := accessTokenProbe(tokenResp.AccessToken, account.Proxy)
+	if errors.Is(probeErr, errTokenRejected) {
+		// 新 token 无效，恢复到刷新前的状态；refresh_token 可能是一次性的，
+		// 本次使用的已经失效，因此把新颁发的保存到 previous_refresh_token，下次刷新失败时仍可回退
+		log.Printf("[WARN] [TokenRotation] 账号 %s (ID:%d) 新 token 验证失败，已回滚: %v", account.ClientID, account.ID, probeErr)
+		fallback := ""
+		if newRefreshToken != usedToken {
+			fallback = newRefreshToken
+		}
+		if err := saveAccountTokens(account.ID, account.AccessToken, usedToken, fallback, account.TokenExpiry); err != nil {
+			log.Printf("[WARN] [TokenRotation] 账号 %s (ID:%d) 回滚失败: %v", account.ClientID, account.ID, err)
+		}
+		account.RefreshToken = usedToken
+		account.PreviousRefreshToken = fallback
+		return probeErr
+	}
+
+	if probeErr != nil {
+		// 无法确认新 token 是否可用，保留旧 refresh_token，下次刷新失败时回退
+		log.Printf("[TokenRotation] 账号 %s (ID:%d) 新 token 暂时无法验证，保留旧 refresh_token: %v", account.ClientID, account.ID, probeErr)
+	} else if previous != "" {
+		if err := database.GetDB().Model(&model.Account{}).
+			Where("id = ?", account.ID).
+			Update("previous_refresh_token", "").Error; err != nil {
+			log.Printf("[WARN] [TokenRotation] 账号 %s (ID:%d) 清除旧 refresh_token 失败: %v", account.ClientID, account.ID, err)
+		} else {
+			previous = ""
+		}
+	}
+
+	account.AccessToken = tokenResp.AccessToken
+	account.RefreshToken = newRefreshToken
+	account.PreviousRefreshToken = previous
+	account.TokenExpiry = expiry
+	return nil
+}
+
+// saveAccountTokens 写入账号 token 字段
+func saveAccountTokens(accountID uint, accessToken, refreshToken, previousRefreshToken string, expiry time.Time) error {
+	updates := map[string]interface{}{
+		"access_token":           accessToken,
+		"refresh_token":          refreshToken,
+		"previous_refresh_token": previousRefreshToken,
+		"token_expiry":           expiry,
+		"updated_at":             time.Now(),
+	}
+	if err := database.GetDB().Model(&model.Account{}).
+		Where("id = ?", accountID).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("更新数据库失败: %w", err)
+	}
+	return nil
+}
+
+// isRefreshTokenInvalid 判断 RefreshAccessToken 的错误是否为 refresh_token 失效
+func isRefreshTokenInvalid(err error) bool {
+	return strings.Contains(err.Error(), "refresh token expired or invalid")
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// fakeAuthServer 模拟认证接口：只接受 valid 中的 refresh_token，每次颁发新的 refresh_token
+type fakeAuthServer struct {
+	mu     sync.Mutex
+	valid  map[string]bool
+	issued int
+}
+
+func (s *fakeAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.valid[req.RefreshToken] {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"Refresh token is not valid"}`))
+		return
+	}
+	s.issued++
+	next := "rt-new"
+	json.NewEncoder(w).Encode(RefreshTokenResponse{AccessToken: "at-new", RefreshToken: next, ExpiresIn: 3600})
+}
+
+func setupRotationTest(t *testing.T, valid ...string) (*fakeAuthServer, *model.Account) {
+	t.Helper()
+	initTestDB(t, "rotation.db")
+	auth := &fakeAuthServer{valid: make(map[string]bool)}
+	for _, token := range valid {
+		auth.valid[token] = true
+	}
+	srv := httptest.NewServer(auth)
+	t.Cleanup(srv.Close)
+
+	origURL, origProbe := refreshTokenURL, accessTokenProbe
+	refreshTokenURL = srv.URL
+	t.Cleanup(func() { refreshTokenURL, accessTokenProbe = origURL, origProbe })
+
+	account := &model.Account{
+		ClientID: "rt-account", ClientSecret: "refresh-token-login", Status: "normal",
+		AccessToken: "at-old", RefreshToken: "rt-old", TokenExpiry: time.Now().Add(time.Minute),
+	}
+	if err := database.GetDB().Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+	return auth, account
+}
+
+func storedAccount(t *testing.T, id uint) model.Account {
+	t.Helper()
+	var acc model.Account
+	if err := database.GetDB().First(&acc, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+func TestRotationVerifiedDiscardsPrevious(t *testing.T) {
+	_, account := setupRotationTest(t, "rt-old")
+	accessTokenProbe = func(string, string) error { return nil }
+
+	if err := refreshAccountWithRotation(account); err != nil {
+		t.Fatal(err)
+	}
+	stored := storedAccount(t, account.ID)
+	if stored.RefreshToken != "rt-new" || stored.PreviousRefreshToken != "" || stored.AccessToken != "at-new" {
+		t.Errorf("stored = %q/%q/%q", stored.AccessToken, stored.RefreshToken, stored.PreviousRefreshToken)
+	}
+}
+
+func TestRotationRejectedRollsBack(t *testing.T) {
+	_, account := setupRotationTest(t, "rt-old")
+	accessTokenProbe = func(string, string) error { return errTokenRejected }
+
+	if err := refreshAccountWithRotation(account); !errors.Is(err, errTokenRejected) {
+		t.Fatalf("err = %v, want errTokenRejected", err)
+	}
+	stored := storedAccount(t, account.ID)
+	if stored.RefreshToken != "rt-old" || stored.AccessToken != "at-old" || stored.PreviousRefreshToken != "rt-new" {
+		t.Errorf("not rolled back: %q/%q/%q", stored.AccessToken, stored.RefreshToken, stored.PreviousRefreshToken)
+	}
+	if account.RefreshToken != "rt-old" || account.PreviousRefreshToken != "rt-new" {
+		t.Errorf("in-memory refresh tokens = %q/%q", account.RefreshToken, account.PreviousRefreshToken)
+	}
+}
+
+func TestRotationRejectedKeepsNewTokenForSingleUseRefresh(t *testing.T) {
+	auth, account := setupRotationTest(t, "rt-old")
+	accessTokenProbe = func(string, string) error { return errTokenRejected }
+	if err := refreshAccountWithRotation(account); !errors.Is(err, errTokenRejected) {
+		t.Fatalf("err = %v, want errTokenRejected", err)
+	}
+
+	// 一次性 refresh_token：rt-old 已被使用，只有新颁发的 rt-new 仍然有效
+	auth.mu.Lock()
+	auth.valid = map[string]bool{"rt-new": true}
+	auth.mu.Unlock()
+
+	accessTokenProbe = func(string, string) error { return nil }
+	stored := storedAccount(t, account.ID)
+	if err := refreshAccountWithRotation(&stored); err != nil {
+		t.Fatalf("account unrecoverable after rollback: %v", err)
+	}
+	if stored := storedAccount(t, account.ID); stored.AccessToken != "at-new" {
+		t.Errorf("after fallback access token = %q", stored.AccessToken)
+	}
+}
+
+func TestRotationUnverifiedKeepsPreviousForFallback(t *testing.T) {
+	auth, account := setupRotationTest(t, "rt-old")
+	accessTokenProbe = func(string, string) error { return errors.New("dial timeout") }
+
+	if err := refreshAccountWithRotation(account); err != nil {
+		t.Fatal(err)
+	}
+	stored := storedAccount(t, account.ID)
+	if stored.RefreshToken != "rt-new" || stored.PreviousRefreshToken != "rt-old" {
+		t.Fatalf("stored = %q/%q", stored.RefreshToken, stored.PreviousRefreshToken)
+	}
+
+	// 新 refresh_token 实际未生效，下次刷新回退到旧 token
+	accessTokenProbe = func(string, string) error { return nil }
+	if err := refreshAccountWithRotation(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if auth.issued != 2 {
+		t.Errorf("issued = %d, want 2", auth.issued)
+	}
+	if stored := storedAccount(t, account.ID); stored.PreviousRefreshToken != "" || stored.AccessToken != "at-new" {
+		t.Errorf("after fallback stored = %q/%q", stored.AccessToken, stored.PreviousRefreshToken)
+	}
+}
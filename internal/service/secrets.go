@@ -0,0 +1,230 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretNames 可以从外部密钥来源读取的配置项，未在外部来源中找到时使用同名环境变量
+var secretNames = []string{"ADMIN_PASSWORD", "ADMIN_VIEWER_PASSWORD", "AUTH_TOKEN", "DATABASE_URL", "DATABASE_READ_URL"}
+
+// restartSecrets 只在启动时使用的配置项，轮换后需要重启才能生效
+var restartSecrets = map[string]bool{"DATABASE_URL": true, "DATABASE_READ_URL": true}
+
+const (
+	defaultSecretsRefreshInterval = 300
+	vaultRequestTimeout           = 10 * time.Second
+	maxSecretFileBytes            = 64 << 10
+)
+
+var (
+	secretsMu      sync.RWMutex
+	secrets        map[string]string
+	secretsOnce    sync.Once
+	secretsLoadErr error
+
+	vaultHTTPClient = &http.Client{Timeout: vaultRequestTimeout}
+)
+
+// GetSecret 返回配置项的当前值：依次取 NAME_FILE 指向的文件、Vault 中的同名字段、环境变量 NAME
+// 配置了外部来源但首次读取失败时退出进程，不回退到环境变量（否则未设置 ADMIN_PASSWORD 时管理接口会失去保护）
+func GetSecret(name string) string {
+	if err := LoadSecrets(); err != nil {
+		log.Fatalf("[Secrets] 读取外部密钥失败: %v", err)
+	}
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return secretOrEnv(secrets, name)
+}
+
+// LoadSecrets 首次读取外部密钥，启动时调用，返回错误时调用方应退出
+func LoadSecrets() error {
+	secretsOnce.Do(func() {
+		secretsLoadErr = RefreshSecrets()
+	})
+	return secretsLoadErr
+}
+
+func secretOrEnv(values map[string]string, name string) string {
+	if v, ok := values[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// secretSourcesConfigured 是否配置了 Vault 或任一 NAME_FILE
+func secretSourcesConfigured() bool {
+	if vaultConfigured() {
+		return true
+	}
+	for _, name := range secretNames {
+		if os.Getenv(name+"_FILE") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func vaultConfigured() bool {
+	return os.Getenv("VAULT_ADDR") != "" && os.Getenv("VAULT_SECRET_PATH") != ""
+}
+
+// RefreshSecrets 重新读取外部密钥；某个来源失败时该来源提供的配置项沿用上一次读到的值，
+// 其余来源照常更新，返回所有失败来源的错误
+func RefreshSecrets() error {
+	secretsMu.RLock()
+	previous := secrets
+	secretsMu.RUnlock()
+
+	values := make(map[string]string)
+	var errs []error
+	if vaultConfigured() {
+		fields, err := readVaultSecret()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("vault: %w", err))
+			fields = previous
+		}
+		for _, name := range secretNames {
+			if v, ok := fields[name]; ok {
+				values[name] = v
+			}
+		}
+	}
+	for _, name := range secretNames {
+		path := os.Getenv(name + "_FILE")
+		if path == "" {
+			continue
+		}
+		v, err := readSecretFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_FILE: %w", name, err))
+			if prev, ok := previous[name]; ok {
+				values[name] = prev
+			}
+			continue
+		}
+		values[name] = v
+	}
+
+	secretsMu.Lock()
+	secrets = values
+	secretsMu.Unlock()
+
+	if previous != nil {
+		for _, name := range secretNames {
+			if previous[name] == values[name] {
+				continue
+			}
+			if restartSecrets[name] {
+				log.Printf("[WARN] [Secrets] %s 已变更，重启后生效", name)
+				continue
+			}
+			log.Printf("[Secrets] %s 已更新", name)
+			if name == "AUTH_TOKEN" {
+				rebindAuthToken(secretOrEnv(previous, name), secretOrEnv(values, name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readSecretFile 读取挂载的密钥文件，去掉末尾换行
+func readSecretFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSecretFileBytes))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readVaultSecret 读取 VAULT_SECRET_PATH 下的字段，兼容 KV v1 和 v2；
+// 令牌取 VAULT_TOKEN_FILE（如 Vault Agent 写出的令牌，每次重新读取）或 VAULT_TOKEN
+func readVaultSecret() (map[string]string, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if path := os.Getenv("VAULT_TOKEN_FILE"); path != "" {
+		v, err := readSecretFile(path)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(v)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN or VAULT_TOKEN_FILE is required")
+	}
+
+	url := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/") + "/v1/" + strings.TrimLeft(os.Getenv("VAULT_SECRET_PATH"), "/")
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := vaultHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSecretFileBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, truncateUTF8(strings.TrimSpace(string(body)), 200))
+	}
+	return parseVaultSecret(body)
+}
+
+// parseVaultSecret KV v2 的字段在 data.data 中，KV v1 直接在 data 中；只保留字符串字段
+func parseVaultSecret(body []byte) (map[string]string, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, v2 := data["metadata"]; v2 {
+			data = inner
+		}
+	}
+	fields := make(map[string]string, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			fields[k] = s
+		}
+	}
+	return fields, nil
+}
+
+// StartSecretsRefresher 配置了外部密钥来源时每隔 SECRETS_REFRESH_INTERVAL 秒（默认 300，0 为只在启动时读取）重新读取
+func StartSecretsRefresher() {
+	seconds := envNonNegativeIntDefault("SECRETS_REFRESH_INTERVAL", defaultSecretsRefreshInterval)
+	if seconds == 0 || !secretSourcesConfigured() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := RefreshSecrets(); err != nil {
+				log.Printf("[WARN] [Secrets] 重新读取外部密钥失败，沿用上次的值: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withSecrets 测试结束后恢复读取到的外部密钥
+func withSecrets(t *testing.T) {
+	t.Helper()
+	secretsOnce.Do(func() {})
+	secretsMu.Lock()
+	saved := secrets
+	secrets = nil
+	secretsMu.Unlock()
+	t.Cleanup(func() {
+		secretsMu.Lock()
+		secrets = saved
+		secretsMu.Unlock()
+	})
+}
+
+func TestSecretFileRotation(t *testing.T) {
+	withSecrets(t)
+	path := filepath.Join(t.TempDir(), "admin_password")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ADMIN_PASSWORD", "from-env")
+	t.Setenv("ADMIN_PASSWORD_FILE", path)
+	t.Setenv("AUTH_TOKEN", "env-token")
+
+	if err := RefreshSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetSecret("ADMIN_PASSWORD"); got != "first" {
+		t.Errorf("ADMIN_PASSWORD = %q", got)
+	}
+	// 没有外部来源的配置项使用环境变量
+	if got := GetSecret("AUTH_TOKEN"); got != "env-token" {
+		t.Errorf("AUTH_TOKEN = %q", got)
+	}
+
+	os.WriteFile(path, []byte("second\n"), 0o600)
+	if err := RefreshSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if !CheckAdminPassword("second") || CheckAdminPassword("first") {
+		t.Error("rotated admin password not applied")
+	}
+
+	// 文件读取失败时沿用上一次的值
+	os.Remove(path)
+	if err := RefreshSecrets(); err == nil {
+		t.Error("missing file accepted")
+	}
+	if got := GetSecret("ADMIN_PASSWORD"); got != "second" {
+		t.Errorf("ADMIN_PASSWORD after failure = %q", got)
+	}
+}
+
+func TestSecretFileFailureKeepsOtherSources(t *testing.T) {
+	withSecrets(t)
+	dir := t.TempDir()
+	adminPath, tokenPath := filepath.Join(dir, "admin_password"), filepath.Join(dir, "auth_token")
+	os.WriteFile(adminPath, []byte("admin-1"), 0o600)
+	os.WriteFile(tokenPath, []byte("token-1"), 0o600)
+	t.Setenv("ADMIN_PASSWORD_FILE", adminPath)
+	t.Setenv("AUTH_TOKEN_FILE", tokenPath)
+	t.Setenv("ADMIN_PASSWORD", "")
+	if err := RefreshSecrets(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 一个文件读取失败不影响另一个文件的轮换，也不回退到环境变量
+	os.Remove(adminPath)
+	os.WriteFile(tokenPath, []byte("token-2"), 0o600)
+	if err := RefreshSecrets(); err == nil {
+		t.Error("missing file accepted")
+	}
+	if got := GetSecret("ADMIN_PASSWORD"); got != "admin-1" {
+		t.Errorf("ADMIN_PASSWORD = %q", got)
+	}
+	if got := GetSecret("AUTH_TOKEN"); got != "token-2" {
+		t.Errorf("AUTH_TOKEN = %q", got)
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	withSecrets(t)
+	var gotToken, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken, gotPath = r.Header.Get("X-Vault-Token"), r.URL.Path
+		w.Write([]byte(`{"data":{"data":{"AUTH_TOKEN":"vault-token","DATABASE_URL":"postgres://u:p@db/zen","other":1},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("s.agent\n"), 0o600)
+	t.Setenv("VAULT_ADDR", server.URL+"/")
+	t.Setenv("VAULT_SECRET_PATH", "/secret/data/zencoder")
+	t.Setenv("VAULT_TOKEN_FILE", tokenFile)
+	t.Setenv("AUTH_TOKEN", "env-token")
+
+	if err := RefreshSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if gotToken != "s.agent" || gotPath != "/v1/secret/data/zencoder" {
+		t.Errorf("request token = %q path = %q", gotToken, gotPath)
+	}
+	if GetSecret("AUTH_TOKEN") != "vault-token" || GetSecret("DATABASE_URL") != "postgres://u:p@db/zen" {
+		t.Errorf("secrets = %v", secrets)
+	}
+	if _, ok := secrets["other"]; ok {
+		t.Error("unmanaged field kept")
+	}
+}
+
+func TestParseVaultSecretKVv1(t *testing.T) {
+	fields, err := parseVaultSecret([]byte(`{"data":{"ADMIN_PASSWORD":"pw","data":"not-nested"}}`))
+	if err != nil || fields["ADMIN_PASSWORD"] != "pw" || fields["data"] != "not-nested" {
+		t.Errorf("fields = %v, err = %v", fields, err)
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ServiceTierRule Anthropic service_tier 规则
+// Default 在客户端未指定时使用，Override 非空时强制覆盖客户端的值
+type ServiceTierRule struct {
+	Default  string `json:"default"`
+	Override string `json:"override"`
+}
+
+// ServiceTierSettings 全局规则及按 API Key 的规则，Key 规则优先
+type ServiceTierSettings struct {
+	ServiceTierRule
+	Keys   map[string]ServiceTierRule `json:"keys"`   // 按 API Key（已脱敏）的规则
+	Served map[string]uint64          `json:"served"` // 上游实际使用各 tier 处理的请求数
+}
+
+var (
+	serviceTierMu       sync.RWMutex
+	serviceTierSettings ServiceTierSettings
+	serviceTierOnce     sync.Once
+
+	servedTierMu     sync.Mutex
+	servedTierCounts = make(map[string]uint64)
+)
+
+// validServiceTier 检查 service_tier 取值，空字符串表示不设置
+func validServiceTier(tier string) bool {
+	switch tier {
+	case "", "auto", "standard_only":
+		return true
+	}
+	return false
+}
+
+func (r ServiceTierRule) valid() bool {
+	return validServiceTier(r.Default) && validServiceTier(r.Override)
+}
+
+func (r ServiceTierRule) empty() bool {
+	return r.Default == "" && r.Override == ""
+}
+
+// loadServiceTierSettings 从环境变量读取全局规则，按 Key 的规则只能通过设置接口修改
+func loadServiceTierSettings() {
+	rule := ServiceTierRule{
+		Default:  strings.TrimSpace(os.Getenv("ANTHROPIC_SERVICE_TIER_DEFAULT")),
+		Override: strings.TrimSpace(os.Getenv("ANTHROPIC_SERVICE_TIER_OVERRIDE")),
+	}
+	if !validServiceTier(rule.Default) {
+		log.Printf("[WARN] 无效的 ANTHROPIC_SERVICE_TIER_DEFAULT: %s，已忽略", rule.Default)
+		rule.Default = ""
+	}
+	if !validServiceTier(rule.Override) {
+		log.Printf("[WARN] 无效的 ANTHROPIC_SERVICE_TIER_OVERRIDE: %s，已忽略", rule.Override)
+		rule.Override = ""
+	}
+	serviceTierSettings = ServiceTierSettings{ServiceTierRule: rule, Keys: make(map[string]ServiceTierRule)}
+}
+
+// GetServiceTierSettings 获取当前 service_tier 设置副本
+func GetServiceTierSettings() ServiceTierSettings {
+	serviceTierOnce.Do(loadServiceTierSettings)
+	serviceTierMu.RLock()
+	defer serviceTierMu.RUnlock()
+
+	result := ServiceTierSettings{ServiceTierRule: serviceTierSettings.ServiceTierRule, Keys: make(map[string]ServiceTierRule, len(serviceTierSettings.Keys))}
+	for k, v := range serviceTierSettings.Keys {
+		result.Keys[MaskAPIKey(k)] = v
+	}
+	result.Served = GetServedTierCounts()
+	return result
+}
+
+// recordServedTier 累计上游实际使用的 service_tier，每个成功识别 tier 的请求计一次
+func recordServedTier(tier string) {
+	servedTierMu.Lock()
+	servedTierCounts[tier]++
+	servedTierMu.Unlock()
+}
+
+// GetServedTierCounts 返回上游实际使用各 service_tier 处理的请求数
+func GetServedTierCounts() map[string]uint64 {
+	servedTierMu.Lock()
+	defer servedTierMu.Unlock()
+	counts := make(map[string]uint64, len(servedTierCounts))
+	for k, v := range servedTierCounts {
+		counts[k] = v
+	}
+	return counts
+}
+
+func writeServiceTierMetrics(w io.Writer) {
+	counts := GetServedTierCounts()
+	tiers := make([]string, 0, len(counts))
+	for tier := range counts {
+		tiers = append(tiers, tier)
+	}
+	sort.Strings(tiers)
+
+	fmt.Fprintln(w, "# TYPE zencoder_anthropic_service_tier counter")
+	fmt.Fprintln(w, "# HELP zencoder_anthropic_service_tier Anthropic requests by the service_tier upstream reported serving them.")
+	for _, tier := range tiers {
+		fmt.Fprintf(w, "zencoder_anthropic_service_tier_total{tier=%q} %d\n", tier, counts[tier])
+	}
+}
+
+// SetServiceTierRule 运行时修改 service_tier 规则（仅内存生效）
+// apiKey 为空时修改全局规则；否则修改该 Key 的规则，规则为空时删除
+func SetServiceTierRule(apiKey string, rule ServiceTierRule) error {
+	if !rule.valid() {
+		return fmt.Errorf("service_tier 只能为 auto 或 standard_only")
+	}
+	serviceTierOnce.Do(loadServiceTierSettings)
+	serviceTierMu.Lock()
+	defer serviceTierMu.Unlock()
+
+	switch {
+	case apiKey == "":
+		serviceTierSettings.ServiceTierRule = rule
+	case rule.empty():
+		delete(serviceTierSettings.Keys, apiKey)
+	default:
+		serviceTierSettings.Keys[apiKey] = rule
+	}
+	return nil
+}
+
+// serviceTierRuleFor 返回请求所用 API Key 的规则，没有单独配置时使用全局规则
+func serviceTierRuleFor(ctx context.Context) ServiceTierRule {
+	serviceTierOnce.Do(loadServiceTierSettings)
+	serviceTierMu.RLock()
+	defer serviceTierMu.RUnlock()
+
+	if rule, ok := serviceTierSettings.Keys[GetAPIKey(ctx)]; ok {
+		return rule
+	}
+	return serviceTierSettings.ServiceTierRule
+}
+
+// applyServiceTier 按规则补充或覆盖请求体中的 service_tier，客户端的值默认原样透传
+func applyServiceTier(ctx context.Context, body []byte) []byte {
+	rule := serviceTierRuleFor(ctx)
+	if rule.empty() {
+		return body
+	}
+
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(body, &reqMap); err != nil {
+		return body
+	}
+
+	current, _ := reqMap["service_tier"].(string)
+	tier := current
+	if rule.Override != "" {
+		tier = rule.Override
+	} else if current == "" {
+		tier = rule.Default
+	}
+	if tier == current {
+		return body
+	}
+
+	reqMap["service_tier"] = tier
+	modified, err := json.Marshal(reqMap)
+	if err != nil {
+		return body
+	}
+	DebugLog(ctx, "[Anthropic] service_tier: %q -> %q", current, tier)
+	return modified
+}
+
+var servedTierPattern = regexp.MustCompile(`"service_tier"\s*:\s*"([a-z_]+)"`)
+
+const serviceTierSniffLimit = 16 * 1024
+
+// serviceTierSniffer 在不影响透传的前提下，从响应开头识别实际使用的 service_tier
+// 非流式响应位于 usage 中，流式响应位于 message_start 事件的 usage 中
+type serviceTierSniffer struct {
+	io.ReadCloser
+	ctx  context.Context
+	buf  []byte
+	done bool
+}
+
+func newServiceTierSniffer(ctx context.Context, body io.ReadCloser) *serviceTierSniffer {
+	return &serviceTierSniffer{ReadCloser: body, ctx: ctx}
+}
+
+func (r *serviceTierSniffer) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if !r.done && n > 0 {
+		r.buf = append(r.buf, p[:n]...)
+		if m := servedTierPattern.FindSubmatch(r.buf); m != nil {
+			r.record(string(m[1]))
+		} else if len(r.buf) > serviceTierSniffLimit {
+			r.done = true
+			r.buf = nil
+		}
+	}
+	return n, err
+}
+
+// record 把实际使用的 tier 写入请求记录并计入统计
+func (r *serviceTierSniffer) record(tier string) {
+	r.done = true
+	r.buf = nil
+	recordServedTier(tier)
+	if logger := GetLogger(r.ctx); logger != nil {
+		logger.SetServiceTier(tier)
+	}
+	DebugLog(r.ctx, "[Anthropic] 本次请求由 service_tier=%s 处理", tier)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func tierOf(t *testing.T, body []byte) string {
+	t.Helper()
+	var req struct {
+		ServiceTier string `json:"service_tier"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return req.ServiceTier
+}
+
+func TestApplyServiceTier(t *testing.T) {
+	defer SetServiceTierRule("", ServiceTierRule{})
+	defer SetServiceTierRule("vip", ServiceTierRule{})
+
+	const (
+		noTier   = `{"model":"m"}`
+		withAuto = `{"model":"m","service_tier":"auto"}`
+	)
+	vip := WithAPIKey(context.Background(), "vip")
+	other := WithAPIKey(context.Background(), "other")
+
+	// 没有任何规则时原样透传
+	if got := applyServiceTier(other, []byte(withAuto)); string(got) != withAuto {
+		t.Errorf("passthrough changed body: %s", got)
+	}
+
+	if err := SetServiceTierRule("", ServiceTierRule{Default: "standard_only"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetServiceTierRule("vip", ServiceTierRule{Override: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		body string
+		want string
+	}{
+		{"global default fills missing", other, noTier, "standard_only"},
+		{"global default keeps client value", other, withAuto, "auto"},
+		{"key override wins over client", vip, `{"model":"m","service_tier":"standard_only"}`, "auto"},
+		{"key override fills missing", vip, noTier, "auto"},
+		{"no key uses global", context.Background(), noTier, "standard_only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tierOf(t, applyServiceTier(tt.ctx, []byte(tt.body))); got != tt.want {
+				t.Errorf("service_tier = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := SetServiceTierRule("vip", ServiceTierRule{Override: "priority"}); err == nil {
+		t.Error("expected error for invalid tier")
+	}
+	if err := SetServiceTierRule("vip", ServiceTierRule{}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := GetServiceTierSettings().Keys; len(keys) != 0 {
+		t.Errorf("empty rule should delete key, got %v", keys)
+	}
+}
+
+func TestServiceTierSnifferRecordsServedTier(t *testing.T) {
+	logger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), logger)
+
+	stream := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":1,\"service_tier\":\"priority\"}}}\n\n"
+	body := newServiceTierSniffer(ctx, io.NopCloser(strings.NewReader(stream)))
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != stream {
+		t.Errorf("sniffer altered body")
+	}
+	if got := logger.ServiceTier(); got != "priority" {
+		t.Errorf("served tier = %q, want priority", got)
+	}
+	// 成功的请求同样计入统计，不依赖出错时才保存的 trace
+	if got := GetServedTierCounts()["priority"]; got != 1 {
+		t.Errorf("served count = %d, want 1", got)
+	}
+}
+
+func TestServiceTierSettingsMaskKeys(t *testing.T) {
+	const key = "sk-tier-secret-0001"
+	if err := SetServiceTierRule(key, ServiceTierRule{Default: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetServiceTierRule(key, ServiceTierRule{})
+
+	keys := GetServiceTierSettings().Keys
+	if _, ok := keys[key]; ok {
+		t.Fatalf("raw API key exposed: %v", keys)
+	}
+	if rule := keys[MaskAPIKey(key)]; rule.Default != "auto" {
+		t.Errorf("keys = %v, want rule under masked key", keys)
+	}
+}
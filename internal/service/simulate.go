@@ -0,0 +1,340 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// simulationMinSamples 某模型的历史请求少于该数时按模型倍率估算单价，不计上游限流率
+const simulationMinSamples = 20
+
+// SimulationAccounts 假设的某套餐账号数
+type SimulationAccounts struct {
+	Plan  model.PlanType `json:"plan"`
+	Count int            `json:"count"`
+}
+
+// SimulationLoad 假设的某模型平均请求速率
+type SimulationLoad struct {
+	Model             string  `json:"model"`
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+}
+
+// SimulationRequest 号池模拟的假设条件
+type SimulationRequest struct {
+	Accounts []SimulationAccounts `json:"accounts"`
+	Load     []SimulationLoad     `json:"load"`
+	Days     int                  `json:"days"` // 参考最近多少天的请求日志，默认 7
+}
+
+// SimulationModelResult 单个模型的模拟结果
+type SimulationModelResult struct {
+	Model             string  `json:"model"`
+	PremiumOnly       bool    `json:"premium_only"`
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	CreditsPerRequest float64 `json:"credits_per_request"`
+	CostSource        string  `json:"cost_source"` // history：请求日志中的平均 Zen-Request-Cost；multiplier：历史样本不足时的模型倍率
+	Samples           int64   `json:"samples"`
+	DailyRequests     float64 `json:"daily_requests"`
+	DailyCredits      float64 `json:"daily_credits"`
+	RejectRate        float64 `json:"reject_rate"`         // 号池积分耗尽后被拒绝的比例
+	UpstreamLimitRate float64 `json:"upstream_limit_rate"` // 历史上游限流（rate 分类）比例
+	Expected429Rate   float64 `json:"expected_429_rate"`
+}
+
+// SimulationHour 积分重置后第 Hour 个小时的积分供需
+type SimulationHour struct {
+	Hour             int     `json:"hour"`
+	DemandCredits    float64 `json:"demand_credits"`
+	ServedCredits    float64 `json:"served_credits"`
+	RemainingCredits float64 `json:"remaining_credits"`
+}
+
+// SimulationResult 号池模拟结果，按每日积分重置后的一个周期推演
+type SimulationResult struct {
+	HistoryFrom     string  `json:"history_from"`
+	HistoryTo       string  `json:"history_to"`
+	HistoryRequests int64   `json:"history_requests"`
+	HourlyShape     string  `json:"hourly_shape"` // history：按历史各小时请求占比分布；uniform：历史样本不足时均匀分布
+	DailyCapacity   float64 `json:"daily_capacity"`
+	PremiumCapacity float64 `json:"premium_capacity"` // Advanced/Max 账号的积分，PremiumOnly 模型只能使用这部分
+	DailyDemand     float64 `json:"daily_demand"`
+	Utilization     float64 `json:"utilization"`
+	// SaturationHours 积分重置后多少小时开始出现号池饱和，不饱和时为 null
+	SaturationHours *float64                `json:"saturation_hours"`
+	SaturationTime  string                  `json:"saturation_time,omitempty"` // 本地时间 HH:MM
+	UnmetCredits    float64                 `json:"unmet_credits"`
+	RejectRate      float64                 `json:"reject_rate"`
+	Expected429Rate float64                 `json:"expected_429_rate"`
+	Models          []SimulationModelResult `json:"models"`
+	Hourly          []SimulationHour        `json:"hourly"`
+}
+
+// simulationHistory 从请求日志中统计的历史分布
+type simulationHistory struct {
+	requests int64
+	hourly   [24]float64
+	models   map[string]*simulationModelHistory
+}
+
+type simulationModelHistory struct {
+	samples     int64   // 成功且返回了 Zen-Request-Cost 的请求数
+	cost        float64 // 上述请求的积分合计
+	requests    int64
+	rateLimited int64
+}
+
+// SimulatePool 按假设的账号和请求速率，结合最近 days 天请求日志中的单价、小时分布和上游限流率推演号池
+func SimulatePool(req SimulationRequest, now time.Time) (*SimulationResult, error) {
+	if err := validateSimulation(req); err != nil {
+		return nil, err
+	}
+	days := req.Days
+	if days <= 0 {
+		days = UsageReportDefaultDays
+	}
+	if days > UsageReportMaxDays {
+		days = UsageReportMaxDays
+	}
+	FlushUsageStats()
+
+	from := now.AddDate(0, 0, -(days - 1)).Format(usageDateLayout)
+	to := now.Format(usageDateLayout)
+	history, err := loadSimulationHistory(from, to)
+	if err != nil {
+		return nil, err
+	}
+	result := simulatePool(req, history, GetPremiumReserve())
+	result.HistoryFrom, result.HistoryTo = from, to
+	return result, nil
+}
+
+func validateSimulation(req SimulationRequest) error {
+	if len(req.Accounts) == 0 {
+		return invalidRequest("accounts: at least one plan is required")
+	}
+	for i, a := range req.Accounts {
+		if _, ok := model.PlanLimits[a.Plan]; !ok {
+			return invalidRequest("accounts[%d].plan: unknown plan %q", i, a.Plan)
+		}
+		if a.Count < 0 {
+			return invalidRequest("accounts[%d].count: must not be negative", i)
+		}
+	}
+	if len(req.Load) == 0 {
+		return invalidRequest("load: at least one model is required")
+	}
+	for i, l := range req.Load {
+		if _, ok := model.GetZenModel(l.Model); !ok {
+			return invalidRequest("load[%d].model: model %s does not exist", i, l.Model)
+		}
+		if l.RequestsPerMinute <= 0 {
+			return invalidRequest("load[%d].requests_per_minute: must be positive", i)
+		}
+	}
+	if req.Days < 0 || req.Days > UsageReportMaxDays {
+		return invalidRequest("days: must be between 1 and %d", UsageReportMaxDays)
+	}
+	return nil
+}
+
+// loadSimulationHistory 逐行扫描请求日志，小时按本地时间在内存中归集以兼容各数据库
+func loadSimulationHistory(from, to string) (*simulationHistory, error) {
+	history := &simulationHistory{models: make(map[string]*simulationModelHistory)}
+	rows, err := database.GetReadDB().Model(&model.RequestLog{}).
+		Select("created_at, model, error_type, cost").
+		Where("date >= ? AND date <= ?", from, to).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry model.RequestLog
+		if err := rows.Scan(&entry.CreatedAt, &entry.Model, &entry.ErrorType, &entry.Cost); err != nil {
+			return nil, err
+		}
+		history.add(entry)
+	}
+	return history, rows.Err()
+}
+
+func (h *simulationHistory) add(entry model.RequestLog) {
+	h.requests++
+	h.hourly[entry.CreatedAt.Local().Hour()]++
+	m := h.models[entry.Model]
+	if m == nil {
+		m = &simulationModelHistory{}
+		h.models[entry.Model] = m
+	}
+	m.requests++
+	if entry.ErrorType == UpstreamErrorRate {
+		m.rateLimited++
+	}
+	if entry.ErrorType == "" && entry.Cost > 0 {
+		m.samples++
+		m.cost += entry.Cost
+	}
+}
+
+// simulateLoad 推演中的单个模型
+type simulateLoad struct {
+	result   *SimulationModelResult
+	rejected float64
+}
+
+// simulatePool 从积分重置开始逐小时推演一个周期：
+// PremiumOnly 模型先用预留的 Max 账号，再用其余 Advanced/Max 账号；其他模型先用低档套餐，再用未预留的 Advanced/Max 账号。
+// 某类请求的积分不足时，该小时内剩余的请求均被拒绝，直到下次重置
+func simulatePool(req SimulationRequest, history *simulationHistory, reserve int) *SimulationResult {
+	result := &SimulationResult{
+		HistoryRequests: history.requests,
+		HourlyShape:     "uniform",
+		Models:          []SimulationModelResult{},
+		Hourly:          []SimulationHour{},
+	}
+
+	// 三个积分池：低档套餐、未预留的 Advanced/Max、预留给 PremiumOnly 模型的 Max
+	var general, shared, reserved float64
+	for _, a := range req.Accounts {
+		limit := float64(model.PlanLimits[a.Plan])
+		switch a.Plan {
+		case model.PlanMax:
+			n := a.Count
+			if reserve < n {
+				n = reserve
+			}
+			reserve -= n
+			reserved += limit * float64(n)
+			shared += limit * float64(a.Count-n)
+		case model.PlanAdvanced:
+			shared += limit * float64(a.Count)
+		default:
+			general += limit * float64(a.Count)
+		}
+	}
+	result.DailyCapacity = general + shared + reserved
+	result.PremiumCapacity = shared + reserved
+
+	shape := [24]float64{}
+	if history.requests >= simulationMinSamples {
+		result.HourlyShape = "history"
+		for i, n := range history.hourly {
+			shape[i] = n / float64(history.requests)
+		}
+	} else {
+		for i := range shape {
+			shape[i] = 1.0 / 24
+		}
+	}
+
+	loads := make([]*simulateLoad, 0, len(req.Load))
+	for _, l := range req.Load {
+		zenModel, _ := model.GetZenModel(l.Model)
+		r := &SimulationModelResult{
+			Model:             l.Model,
+			PremiumOnly:       zenModel.PremiumOnly,
+			RequestsPerMinute: l.RequestsPerMinute,
+			CreditsPerRequest: zenModel.Multiplier,
+			CostSource:        "multiplier",
+			DailyRequests:     l.RequestsPerMinute * 60 * 24,
+		}
+		if m := history.models[l.Model]; m != nil {
+			r.Samples = m.samples
+			if m.samples >= simulationMinSamples {
+				r.CreditsPerRequest = m.cost / float64(m.samples)
+				r.CostSource = "history"
+			}
+			if m.requests >= simulationMinSamples {
+				r.UpstreamLimitRate = float64(m.rateLimited) / float64(m.requests)
+			}
+		}
+		r.DailyCredits = r.DailyRequests * r.CreditsPerRequest
+		result.DailyDemand += r.DailyCredits
+		loads = append(loads, &simulateLoad{result: r})
+	}
+	if result.DailyCapacity > 0 {
+		result.Utilization = result.DailyDemand / result.DailyCapacity
+	}
+
+	for hour := 0; hour < 24; hour++ {
+		var premiumNeed, generalNeed float64
+		for _, l := range loads {
+			need := l.result.DailyCredits * shape[hour]
+			if l.result.PremiumOnly {
+				premiumNeed += need
+			} else {
+				generalNeed += need
+			}
+		}
+
+		// 各自的专属池先扣，共享池不足时按剩余需求比例分配
+		premiumServed := math.Min(premiumNeed, reserved)
+		reserved -= premiumServed
+		generalServed := math.Min(generalNeed, general)
+		general -= generalServed
+		premiumLeft, generalLeft := premiumNeed-premiumServed, generalNeed-generalServed
+		if left := premiumLeft + generalLeft; left > 0 && left <= shared {
+			premiumServed, generalServed = premiumNeed, generalNeed
+			shared -= left
+		} else if left > 0 {
+			premiumServed += shared * premiumLeft / left
+			generalServed += shared * generalLeft / left
+			shared = 0
+		}
+
+		premiumRatio, generalRatio := servedRatio(premiumServed, premiumNeed), servedRatio(generalServed, generalNeed)
+		for _, l := range loads {
+			ratio := generalRatio
+			if l.result.PremiumOnly {
+				ratio = premiumRatio
+			}
+			l.rejected += l.result.DailyRequests * shape[hour] * (1 - ratio)
+		}
+		if result.SaturationHours == nil && (premiumRatio < 1 || generalRatio < 1) {
+			// 小时内请求均匀到达，按可满足的比例估算饱和时刻
+			at := float64(hour) + math.Min(premiumRatio, generalRatio)
+			result.SaturationHours = &at
+			minutes := int(at * 60)
+			result.SaturationTime = fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+		}
+
+		demand := premiumNeed + generalNeed
+		served := premiumServed + generalServed
+		result.UnmetCredits += demand - served
+		result.Hourly = append(result.Hourly, SimulationHour{
+			Hour:             hour,
+			DemandCredits:    demand,
+			ServedCredits:    served,
+			RemainingCredits: general + shared + reserved,
+		})
+	}
+
+	var totalRequests, totalRejected, total429 float64
+	for _, l := range loads {
+		r := l.result
+		r.RejectRate = l.rejected / r.DailyRequests
+		r.Expected429Rate = r.RejectRate + (1-r.RejectRate)*r.UpstreamLimitRate
+		totalRequests += r.DailyRequests
+		totalRejected += l.rejected
+		total429 += r.DailyRequests * r.Expected429Rate
+		result.Models = append(result.Models, *r)
+	}
+	if totalRequests > 0 {
+		result.RejectRate = totalRejected / totalRequests
+		result.Expected429Rate = total429 / totalRequests
+	}
+	return result
+}
+
+func servedRatio(served, need float64) float64 {
+	if need <= 0 {
+		return 1
+	}
+	return served / need
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestSimulatePool(t *testing.T) {
+	const sonnet, opus = "claude-sonnet-4-5-20250929", "claude-opus-4-1-20250805"
+	// 每小时 2 次成功（单价 2）和 1 次上游限流，小时分布均匀
+	history := &simulationHistory{models: make(map[string]*simulationModelHistory)}
+	for hour := 0; hour < 24; hour++ {
+		at := time.Date(2026, 3, 10, hour, 30, 0, 0, time.Local)
+		history.add(model.RequestLog{CreatedAt: at, Model: sonnet, Cost: 2})
+		history.add(model.RequestLog{CreatedAt: at, Model: sonnet, Cost: 2})
+		history.add(model.RequestLog{CreatedAt: at, Model: sonnet, StatusCode: 429, ErrorType: UpstreamErrorRate})
+	}
+
+	req := SimulationRequest{
+		Accounts: []SimulationAccounts{{Plan: model.PlanStarter, Count: 1}, {Plan: model.PlanMax, Count: 1}},
+		Load: []SimulationLoad{
+			{Model: sonnet, RequestsPerMinute: 280.0 / 1440}, // 每天 280 次，560 积分
+			{Model: opus, RequestsPerMinute: 0.1},
+		},
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-6 }
+
+	// Max 账号预留给 PremiumOnly 模型，sonnet 只能用 Starter 的 280 积分，半天后饱和
+	result := simulatePool(req, history, 1)
+	if result.HourlyShape != "history" || result.DailyCapacity != 4480 || result.PremiumCapacity != 4200 {
+		t.Fatalf("result = %+v", result)
+	}
+	s, o := result.Models[0], result.Models[1]
+	if s.CostSource != "history" || !near(s.CreditsPerRequest, 2) || !near(s.UpstreamLimitRate, 1.0/3) {
+		t.Errorf("sonnet = %+v", s)
+	}
+	if !near(s.RejectRate, 0.5) || !near(s.Expected429Rate, 0.5+0.5/3) {
+		t.Errorf("sonnet reject=%v expected429=%v", s.RejectRate, s.Expected429Rate)
+	}
+	if o.CostSource != "multiplier" || o.CreditsPerRequest != 10 || o.RejectRate != 0 || o.Expected429Rate != 0 {
+		t.Errorf("opus = %+v", o)
+	}
+	if result.SaturationHours == nil || !near(*result.SaturationHours, 12) || result.SaturationTime != "12:00" {
+		t.Errorf("saturation = %v %q", result.SaturationHours, result.SaturationTime)
+	}
+	if !near(result.UnmetCredits, 280) || len(result.Hourly) != 24 {
+		t.Errorf("unmet = %v, hourly = %d", result.UnmetCredits, len(result.Hourly))
+	}
+
+	// 不预留时 Max 的积分也可用于 sonnet，全天不饱和
+	result = simulatePool(req, history, 0)
+	if result.SaturationHours != nil || result.RejectRate != 0 || !near(result.Models[0].Expected429Rate, 1.0/3) {
+		t.Errorf("unreserved result = %+v", result)
+	}
+
+	var invalid *InvalidRequestError
+	bad := SimulationRequest{Accounts: []SimulationAccounts{{Plan: "Gold", Count: 1}}, Load: req.Load}
+	if err := validateSimulation(bad); !errors.As(err, &invalid) {
+		t.Errorf("unknown plan err = %v", err)
+	}
+	bad = SimulationRequest{Accounts: req.Accounts, Load: []SimulationLoad{{Model: "no-such-model", RequestsPerMinute: 1}}}
+	if err := validateSimulation(bad); !errors.As(err, &invalid) {
+		t.Errorf("unknown model err = %v", err)
+	}
+}
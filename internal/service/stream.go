@@ -2,55 +2,232 @@ package service
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// StreamResponse 流式传输响应到客户端
-func StreamResponse(w http.ResponseWriter, resp *http.Response) error {
-	// 复制响应头
-	for k, v := range resp.Header {
-		for _, vv := range v {
-			w.Header().Add(k, vv)
+// StreamFallbackHeader 流式降级时附加的提示响应头
+const StreamFallbackHeader = "X-Stream-Fallback"
+
+// ErrClientDisconnected 客户端已断开，向其写入或刷新失败
+var ErrClientDisconnected = errors.New("client_disconnected")
+
+// SSEWriter 检查每次写入和刷新结果的流式写入器
+// 第一次失败（或请求 context 已取消）后记住错误，之后的写入直接返回该错误；
+// 调用方收到错误后应立即返回，由 defer 关闭上游响应体中断生成，避免继续消耗积分
+// 开启 KeepAlive 后写入和刷新会与后台的 ping 并发，均在锁内进行
+type SSEWriter struct {
+	ctx context.Context
+	w   io.Writer
+	rc  *http.ResponseController
+	err error
+
+	mu        sync.Mutex
+	lastWrite time.Time
+	tail      [2]byte // 最近写出的两个字节，用于判断是否处于事件边界
+}
+
+// NewSSEWriter 包装客户端 ResponseWriter，ctx 为客户端请求的 context
+func NewSSEWriter(ctx context.Context, w http.ResponseWriter) *SSEWriter {
+	return &SSEWriter{ctx: ctx, w: w, rc: http.NewResponseController(w), tail: [2]byte{'\n', '\n'}}
+}
+
+// fail 记录第一次失败，并在请求日志中标记 client_disconnected
+func (s *SSEWriter) fail(err error) error {
+	s.err = fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+	RecordClientDisconnected(s.ctx, err)
+	return s.err
+}
+
+func (s *SSEWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(p)
+}
+
+// write 调用方需持有锁
+func (s *SSEWriter) write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		return 0, s.fail(err)
+	}
+	n, err := s.w.Write(p)
+	if err != nil {
+		return n, s.fail(err)
+	}
+	s.lastWrite = time.Now()
+	switch {
+	case n >= 2:
+		s.tail = [2]byte{p[n-2], p[n-1]}
+	case n == 1:
+		s.tail = [2]byte{s.tail[1], p[0]}
+	}
+	return n, nil
+}
+
+// Printf 按格式写入，返回写入错误
+func (s *SSEWriter) Printf(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(s, format, args...)
+	return err
+}
+
+// Flush 把已写入的数据刷新给客户端
+func (s *SSEWriter) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+// flush 调用方需持有锁
+func (s *SSEWriter) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		return s.fail(err)
+	}
+	if err := s.rc.Flush(); err != nil {
+		return s.fail(err)
+	}
+	return nil
+}
+
+// Err 返回第一次写入或刷新失败的错误
+func (s *SSEWriter) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// KeepAlive 按 STREAM_KEEPALIVE_INTERVAL 在上游长时间没有数据时写入 SSE 注释帧，
+// 避免 Cloudflare、nginx 等中间层断开空闲连接；返回的函数停止发送并等待正在进行的发送完成，流结束时调用
+func (s *SSEWriter) KeepAlive() func() {
+	interval := time.Duration(GetStreamKeepAliveSettings().IntervalSeconds) * time.Second
+	if interval <= 0 {
+		return func() {}
+	}
+	s.mu.Lock()
+	s.lastWrite = time.Now()
+	s.mu.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-s.ctx.Done():
+				return
+			case <-timer.C:
+			}
+			// 定时器与 stop 同时就绪时 select 可能选中定时器
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			wait, err := s.ping(interval)
+			if err != nil {
+				return
+			}
+			timer.Reset(wait)
 		}
+	}()
+	var once sync.Once
+	// 等待后台协程退出，保证处理器返回后不再写入或刷新 ResponseWriter
+	return func() {
+		once.Do(func() { close(stop) })
+		<-done
 	}
-	w.WriteHeader(resp.StatusCode)
+}
+
+// ping 距上次写入已满 interval 时写入注释帧，返回距下次检查的时间
+// 处于事件中间时只写注释行，不写结束事件的空行
+func (s *SSEWriter) ping(interval time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	if wait := interval - time.Since(s.lastWrite); wait > 0 {
+		return wait, nil
+	}
+	frame := ": ping\n"
+	if s.tail == [2]byte{'\n', '\n'} {
+		frame += "\n"
+	}
+	if _, err := s.write([]byte(frame)); err != nil {
+		return 0, err
+	}
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+	streamKeepAlivePings.Add(1)
+	return interval, nil
+}
+
+// StreamResponse 流式传输响应到客户端，客户端断开或读取过慢被断开时返回 ErrClientDisconnected
+func StreamResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response) error {
+	// 按策略复制响应头
+	copyUpstreamHeaders(ctx, w.Header(), resp.Header)
 
 	// 获取Flusher接口
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		// 如果不支持Flusher，直接复制
+	if _, ok := w.(http.Flusher); !ok {
+		// 如果不支持Flusher，整体复制并提示客户端已降级
+		log.Printf("[WARN] ResponseWriter 不支持 Flush，流式响应降级为整体返回")
+		w.Header().Set(StreamFallbackHeader, "buffered")
+		w.WriteHeader(resp.StatusCode)
 		_, err := io.Copy(w, resp.Body)
+		if capErr, ok := err.(*StreamCreditCapError); ok {
+			_, err = io.WriteString(w, capErr.Event())
+		}
 		return err
 	}
+	w.WriteHeader(resp.StatusCode)
+
+	sse := NewSSEWriter(ctx, w)
+	defer sse.KeepAlive()()
+	if settings := GetStreamBackpressureSettings(); settings.MaxLagBytes > 0 {
+		// 经有界缓冲转发，慢客户端积压过多时断开
+		return streamWithBackpressure(ctx, w, sse, resp.Body, settings.limits())
+	}
 
 	// 使用bufio读取并逐行刷新
 	reader := bufio.NewReader(resp.Body)
 	for {
 		line, err := reader.ReadBytes('\n')
 		if len(line) > 0 {
-			_, writeErr := w.Write(line)
-			if writeErr != nil {
+			if _, writeErr := sse.Write(line); writeErr != nil {
 				return writeErr
 			}
-			flusher.Flush()
+			if flushErr := sse.Flush(); flushErr != nil {
+				return flushErr
+			}
 		}
 		if err != nil {
 			if err == io.EOF {
 				return nil
 			}
-			return err
+			return endStreamOnCreditCap(sse, err)
 		}
 	}
 }
 
 // CopyResponse 普通响应复制
-func CopyResponse(w http.ResponseWriter, resp *http.Response) error {
-	for k, v := range resp.Header {
-		for _, vv := range v {
-			w.Header().Add(k, vv)
-		}
-	}
+func CopyResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response) error {
+	copyUpstreamHeaders(ctx, w.Header(), resp.Header)
 	w.WriteHeader(resp.StatusCode)
 	_, err := io.Copy(w, resp.Body)
 	return err
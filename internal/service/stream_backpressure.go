@@ -0,0 +1,319 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamBackpressureSettings 流式响应向慢客户端转发时的积压上限
+// 客户端积压超过上限时断开连接，上游在后台读完以记录用量
+type StreamBackpressureSettings struct {
+	MaxLagBytes   int `json:"max_lag_bytes"`   // 已从上游读取、尚未写给客户端的字节上限，0 表示关闭缓冲（直接同步转发）
+	MaxLagSeconds int `json:"max_lag_seconds"` // 最早一段未写出数据的最长等待时间
+	DrainSeconds  int `json:"drain_seconds"`   // 断开慢客户端后继续读取上游的最长时间
+}
+
+const (
+	defaultStreamMaxLagBytes   = 1 << 20
+	defaultStreamMaxLagSeconds = 60
+	defaultStreamDrainSeconds  = 300
+)
+
+// 断开慢客户端的原因
+const (
+	SlowClientBytes = "bytes" // 积压字节超过上限
+	SlowClientTime  = "time"  // 积压时间超过上限
+)
+
+// ErrSlowClient 客户端读取过慢被主动断开，按客户端断开处理
+var ErrSlowClient = fmt.Errorf("%w: slow client", ErrClientDisconnected)
+
+var (
+	streamBackpressureMu       sync.RWMutex
+	streamBackpressureSettings StreamBackpressureSettings
+	streamBackpressureOnce     sync.Once
+
+	slowClientBytes atomic.Uint64
+	slowClientTime  atomic.Uint64
+)
+
+// loadStreamBackpressureSettings 读取 STREAM_CLIENT_MAX_LAG_BYTES / STREAM_CLIENT_MAX_LAG / STREAM_DRAIN_TIMEOUT
+func loadStreamBackpressureSettings() {
+	streamBackpressureSettings = StreamBackpressureSettings{
+		MaxLagBytes:   envNonNegativeIntDefault("STREAM_CLIENT_MAX_LAG_BYTES", defaultStreamMaxLagBytes),
+		MaxLagSeconds: envPositiveInt("STREAM_CLIENT_MAX_LAG", defaultStreamMaxLagSeconds),
+		DrainSeconds:  envPositiveInt("STREAM_DRAIN_TIMEOUT", defaultStreamDrainSeconds),
+	}
+}
+
+// GetStreamBackpressureSettings 获取慢客户端处理设置
+func GetStreamBackpressureSettings() StreamBackpressureSettings {
+	streamBackpressureOnce.Do(loadStreamBackpressureSettings)
+	streamBackpressureMu.RLock()
+	defer streamBackpressureMu.RUnlock()
+	return streamBackpressureSettings
+}
+
+// SetStreamBackpressureSettings 运行时修改慢客户端处理设置（仅内存生效），只影响之后开始的流
+func SetStreamBackpressureSettings(settings StreamBackpressureSettings) error {
+	if settings.MaxLagBytes < 0 {
+		return fmt.Errorf("max_lag_bytes 不能为负数")
+	}
+	if settings.MaxLagSeconds <= 0 || settings.DrainSeconds <= 0 {
+		return fmt.Errorf("max_lag_seconds 和 drain_seconds 必须大于 0")
+	}
+	streamBackpressureOnce.Do(loadStreamBackpressureSettings)
+	streamBackpressureMu.Lock()
+	defer streamBackpressureMu.Unlock()
+	streamBackpressureSettings = settings
+	return nil
+}
+
+// GetSlowClientCounts 返回按原因统计的慢客户端断开次数
+func GetSlowClientCounts() map[string]uint64 {
+	return map[string]uint64{
+		SlowClientBytes: slowClientBytes.Load(),
+		SlowClientTime:  slowClientTime.Load(),
+	}
+}
+
+func writeSlowClientMetrics(w io.Writer, counts map[string]uint64) {
+	fmt.Fprintln(w, "# TYPE zencoder_stream_slow_clients counter")
+	fmt.Fprintln(w, "# HELP zencoder_stream_slow_clients Streaming clients disconnected for reading too slowly, by the limit they exceeded.")
+	for _, reason := range []string{SlowClientBytes, SlowClientTime} {
+		fmt.Fprintf(w, "zencoder_stream_slow_clients_total{reason=%q} %d\n", reason, counts[reason])
+	}
+}
+
+// clientLagLimits 单个流使用的积压上限
+type clientLagLimits struct {
+	bytes int
+	lag   time.Duration
+	drain time.Duration
+}
+
+func (s StreamBackpressureSettings) limits() clientLagLimits {
+	return clientLagLimits{
+		bytes: s.MaxLagBytes,
+		lag:   time.Duration(s.MaxLagSeconds) * time.Second,
+		drain: time.Duration(s.DrainSeconds) * time.Second,
+	}
+}
+
+// clientLagBuffer 上游读取与客户端写入之间的有界缓冲
+type clientLagBuffer struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	lines     [][]byte
+	queued    int       // 已缓冲、尚未写出的字节数
+	oldest    time.Time // 最早一段未写出数据进入缓冲的时间
+	limit     int
+	err       error // 上游读取结束的原因，io.EOF 表示正常结束
+	done      bool
+	overflow  bool // 积压超过字节上限
+	abandoned bool // 不再向客户端写入，之后读到的数据直接丢弃
+	stopped   bool // 客户端自行断开，停止读取上游
+}
+
+func newClientLagBuffer(limit int) *clientLagBuffer {
+	b := &clientLagBuffer{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// push 缓冲一行上游数据，积压超过上限时返回 true（只返回一次）
+// 缓冲为空时单行超过上限也接受，避免大的事件（如图片）直接触发断开
+func (b *clientLagBuffer) push(line []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.abandoned {
+		return false
+	}
+	if b.queued > 0 && b.queued+len(line) > b.limit {
+		b.overflow, b.abandoned = true, true
+		b.lines, b.queued = nil, 0
+		b.cond.Broadcast()
+		return true
+	}
+	if b.queued == 0 {
+		b.oldest = time.Now()
+	}
+	b.lines = append(b.lines, line)
+	b.queued += len(line)
+	b.cond.Broadcast()
+	return false
+}
+
+// finish 记录上游读取结束
+func (b *clientLagBuffer) finish(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done, b.err = true, err
+	b.cond.Broadcast()
+}
+
+// next 等待并取出全部已缓冲数据，返回其中最早一段的入队时间
+// 积压超过上限时返回断开原因；上游结束且缓冲为空时返回读取结束的原因
+func (b *clientLagBuffer) next(lag time.Duration) (data []byte, since time.Time, slow string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.lines) == 0 && !b.done && !b.overflow {
+		b.cond.Wait()
+	}
+	switch {
+	case b.overflow:
+		return nil, time.Time{}, SlowClientBytes, nil
+	case len(b.lines) > 0 && time.Since(b.oldest) > lag:
+		b.abandoned = true
+		b.lines, b.queued = nil, 0
+		return nil, time.Time{}, SlowClientTime, nil
+	case len(b.lines) == 0:
+		return nil, time.Time{}, "", b.err
+	}
+	data, since = bytes.Join(b.lines, nil), b.oldest
+	b.lines, b.queued = nil, 0
+	return data, since, "", nil
+}
+
+// abandon 停止向客户端写入，之后读到的数据直接丢弃
+func (b *clientLagBuffer) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.abandoned = true
+	b.lines, b.queued = nil, 0
+}
+
+// stop 客户端自行断开时停止读取上游
+func (b *clientLagBuffer) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.abandoned, b.stopped = true, true
+	b.lines, b.queued = nil, 0
+}
+
+func (b *clientLagBuffer) isStopped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopped
+}
+
+func (b *clientLagBuffer) overflowed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.overflow
+}
+
+// streamWithBackpressure 在后台读取上游，经有界缓冲写给客户端
+// 客户端积压超过字节或时间上限时断开客户端，并在 drain 时间内继续读完上游，使 token 与积分统计完整；
+// 客户端自行断开时与同步转发一样立即返回并停止读取，由调用方关闭上游响应体中断生成
+func streamWithBackpressure(ctx context.Context, w http.ResponseWriter, sse *SSEWriter, body io.Reader, limits clientLagLimits) error {
+	rc := http.NewResponseController(w)
+	defer rc.SetWriteDeadline(time.Time{})
+
+	buf := newClientLagBuffer(limits.bytes)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 && buf.push(line) {
+				// 唤醒阻塞在写入中的转发循环
+				rc.SetWriteDeadline(time.Now())
+			}
+			if err != nil {
+				buf.finish(err)
+				return
+			}
+			if buf.isStopped() {
+				return
+			}
+		}
+	}()
+
+	for {
+		data, since, slow, err := buf.next(limits.lag)
+		if slow != "" {
+			return disconnectSlowClient(ctx, rc, slow, drained, limits.drain)
+		}
+		if data == nil {
+			if err == io.EOF {
+				return nil
+			}
+			return endStreamOnCreditCap(sse, err)
+		}
+
+		deadline := since.Add(limits.lag)
+		rc.SetWriteDeadline(deadline)
+		// 积压超限可能发生在取出数据之后，此时设置的截止时间会覆盖读取协程设置的过期时间
+		if buf.overflowed() {
+			return disconnectSlowClient(ctx, rc, SlowClientBytes, drained, limits.drain)
+		}
+		_, writeErr := sse.Write(data)
+		if writeErr == nil {
+			writeErr = sse.Flush()
+		}
+		if writeErr != nil {
+			if buf.overflowed() {
+				return disconnectSlowClient(ctx, rc, SlowClientBytes, drained, limits.drain)
+			}
+			if !time.Now().Before(deadline) {
+				buf.abandon()
+				return disconnectSlowClient(ctx, rc, SlowClientTime, drained, limits.drain)
+			}
+			buf.stop()
+			return writeErr
+		}
+		// 等待上游期间可能写入 keep-alive 注释帧，不能沿用这段数据的截止时间
+		rc.SetWriteDeadline(time.Time{})
+	}
+}
+
+// disconnectSlowClient 断开慢客户端并等待上游读完（最多 drain），HTTP/1.1 下直接关闭连接
+func disconnectSlowClient(ctx context.Context, rc *http.ResponseController, reason string, drained <-chan struct{}, drain time.Duration) error {
+	if reason == SlowClientBytes {
+		slowClientBytes.Add(1)
+	} else {
+		slowClientTime.Add(1)
+	}
+	if logger := GetLogger(ctx); logger != nil {
+		logger.MarkError()
+	}
+	logToContext(ctx, "[Stream] slow_client: 客户端积压超过%s上限，断开连接并在后台读完上游", map[string]string{SlowClientBytes: "字节", SlowClientTime: "时间"}[reason])
+
+	rc.SetWriteDeadline(time.Now())
+	closeClientConn(rc)
+
+	timer := time.NewTimer(drain)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		logToContext(ctx, "[Stream] 上游在 %v 内未结束，停止读取", drain)
+	}
+	return ErrSlowClient
+}
+
+// closeClientConn 尽量直接关闭 HTTP/1.1 连接；无法劫持时只依靠已过期的写入截止时间阻止继续写入
+func closeClientConn(rc *http.ResponseController) {
+	// gin 的 Hijack 在底层 ResponseWriter 不支持时会 panic
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Stream] 无法关闭慢客户端连接: %v", r)
+		}
+	}()
+	if conn, _, err := rc.Hijack(); err == nil {
+		conn.Close()
+	} else if !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("[Stream] 无法关闭慢客户端连接: %v", err)
+	}
+}
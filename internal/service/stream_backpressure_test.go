@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBody 每隔 delay 产生一行 SSE 数据，共 lines 行（为 0 时无限产生），统计读取次数和是否读到结尾
+type countingBody struct {
+	lines int
+	delay time.Duration
+	reads atomic.Int64
+	eof   atomic.Bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	time.Sleep(b.delay)
+	n := b.reads.Add(1)
+	if b.lines > 0 && n > int64(b.lines) {
+		b.eof.Store(true)
+		return 0, io.EOF
+	}
+	return copy(p, "data: {\"delta\":\""+strings.Repeat("x", 64)+"\"}\n\n"), nil
+}
+
+func (b *countingBody) Close() error { return nil }
+
+// stalledWriter 模拟第一次写入后不再读取的客户端：之后的写入一直阻塞到写入截止时间
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	mu       sync.Mutex
+	deadline time.Time
+	writes   int
+}
+
+func (w *stalledWriter) SetWriteDeadline(t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = t
+	return nil
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.writes++
+	first := w.writes == 1
+	w.mu.Unlock()
+	if first {
+		return w.ResponseRecorder.Write(p)
+	}
+	for {
+		w.mu.Lock()
+		deadline := w.deadline
+		w.mu.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamBackpressureForwardsStream(t *testing.T) {
+	withStreamBackpressure(t, StreamBackpressureSettings{MaxLagBytes: 1 << 20, MaxLagSeconds: 60, DrainSeconds: 300})
+	events := strings.Repeat("data: {\"delta\":\"x\"}\n\n", 200)
+	rec := httptest.NewRecorder()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(events))}
+
+	if err := StreamResponse(context.Background(), rec, resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.String() != events {
+		t.Errorf("forwarded %d bytes, want %d", rec.Body.Len(), len(events))
+	}
+}
+
+func TestStreamBackpressureStopsOnClientWriteError(t *testing.T) {
+	withStreamBackpressure(t, StreamBackpressureSettings{MaxLagBytes: 1 << 20, MaxLagSeconds: 60, DrainSeconds: 300})
+	body := &countingBody{delay: time.Millisecond}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder(), failAfter: 3}
+
+	err := StreamResponse(context.Background(), w, resp)
+	if !errors.Is(err, ErrClientDisconnected) || errors.Is(err, ErrSlowClient) {
+		t.Fatalf("err = %v, want client disconnect", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	reads := body.reads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if body.reads.Load() != reads {
+		t.Error("kept reading upstream after the client disconnected")
+	}
+}
+
+func TestStreamBackpressureDisconnectsSlowClient(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   *countingBody
+		limits clientLagLimits
+		reason string
+	}{
+		{"bytes", &countingBody{lines: 500}, clientLagLimits{bytes: 1024, lag: time.Minute, drain: time.Minute}, SlowClientBytes},
+		{"time", &countingBody{lines: 20, delay: 10 * time.Millisecond}, clientLagLimits{bytes: 1 << 20, lag: 50 * time.Millisecond, drain: time.Minute}, SlowClientTime},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := NewRequestLogger()
+			ctx := WithLogger(context.Background(), logger)
+			before := GetSlowClientCounts()[tc.reason]
+			body := tc.body
+			w := &stalledWriter{ResponseRecorder: httptest.NewRecorder()}
+
+			start := time.Now()
+			err := streamWithBackpressure(ctx, w, NewSSEWriter(ctx, w), body, tc.limits)
+			if !errors.Is(err, ErrSlowClient) || !errors.Is(err, ErrClientDisconnected) {
+				t.Fatalf("err = %v, want ErrSlowClient", err)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("took %v to disconnect", time.Since(start))
+			}
+			// 断开客户端后仍读完上游，用量统计完整
+			if !body.eof.Load() {
+				t.Error("upstream was not drained")
+			}
+			if GetSlowClientCounts()[tc.reason] != before+1 {
+				t.Errorf("slow client not counted as %s", tc.reason)
+			}
+			if !logger.hasError || !strings.Contains(strings.Join(logger.texts(), "\n"), "slow_client") {
+				t.Errorf("slow client not recorded: %v", logger.texts())
+			}
+		})
+	}
+}
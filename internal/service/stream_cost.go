@@ -0,0 +1,338 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// 流式响应的协议，决定如何估算 token 及超限时的错误事件格式
+const (
+	StreamProtocolAnthropic = "anthropic"        // /v1/messages
+	StreamProtocolChat      = "chat.completions" // /v1/chat/completions
+	StreamProtocolResponses = "responses"        // /v1/responses
+)
+
+// defaultStreamTokensPerCredit 倍率为 1 的模型每输出多少 token 计 1 积分
+const defaultStreamTokensPerCredit = 1000
+
+// StreamCreditSettings 流式请求的积分估算与上限
+type StreamCreditSettings struct {
+	Cap             float64 `json:"cap"`               // 单个流式请求的积分上限，0 表示不限制
+	TokensPerCredit int     `json:"tokens_per_credit"` // 倍率为 1 的模型每输出多少 token 计 1 积分
+}
+
+var (
+	streamCreditMu       sync.RWMutex
+	streamCreditSettings StreamCreditSettings
+	streamCreditOnce     sync.Once
+)
+
+// loadStreamCreditSettings 读取 STREAM_CREDIT_CAP / STREAM_TOKENS_PER_CREDIT
+func loadStreamCreditSettings() {
+	streamCreditSettings.TokensPerCredit = envPositiveInt("STREAM_TOKENS_PER_CREDIT", defaultStreamTokensPerCredit)
+	raw := strings.TrimSpace(os.Getenv("STREAM_CREDIT_CAP"))
+	if raw == "" {
+		return
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 {
+		log.Printf("[WARN] 无效的 STREAM_CREDIT_CAP: %s，已忽略", raw)
+		return
+	}
+	streamCreditSettings.Cap = v
+}
+
+// GetStreamCreditSettings 获取流式请求的积分上限和估算参数
+func GetStreamCreditSettings() StreamCreditSettings {
+	streamCreditOnce.Do(loadStreamCreditSettings)
+	streamCreditMu.RLock()
+	defer streamCreditMu.RUnlock()
+	return streamCreditSettings
+}
+
+// SetStreamCreditSettings 运行时修改积分上限（仅内存生效），只影响之后开始的流
+func SetStreamCreditSettings(settings StreamCreditSettings) error {
+	if settings.Cap < 0 {
+		return fmt.Errorf("积分上限不能为负数")
+	}
+	if settings.TokensPerCredit <= 0 {
+		return fmt.Errorf("tokens_per_credit 必须大于 0")
+	}
+	streamCreditOnce.Do(loadStreamCreditSettings)
+	streamCreditMu.Lock()
+	defer streamCreditMu.Unlock()
+	streamCreditSettings = settings
+	return nil
+}
+
+// StreamCreditCapError 流式响应的估算积分超过上限，上游已被中断
+type StreamCreditCapError struct {
+	Protocol string
+	Model    string
+	Credits  float64
+	Cap      float64
+}
+
+func (e *StreamCreditCapError) Error() string {
+	return fmt.Sprintf("stream credit cap exceeded: %.2f > %.2f credits", e.Credits, e.Cap)
+}
+
+// Event 按协议构造结束流的错误事件
+// 开头的空行结束可能未终止的上一个事件
+func (e *StreamCreditCapError) Event() string {
+	message := fmt.Sprintf("Stream stopped: estimated cost %.2f credits exceeded the per-request cap of %.2f credits", e.Credits, e.Cap)
+	switch e.Protocol {
+	case StreamProtocolChat:
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": message,
+				"type":    "insufficient_quota",
+				"code":    "stream_credit_cap_exceeded",
+				"param":   nil,
+			},
+		})
+		return fmt.Sprintf("\ndata: %s\n\ndata: [DONE]\n\n", data)
+	case StreamProtocolResponses:
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":    "error",
+			"code":    "stream_credit_cap_exceeded",
+			"message": message,
+			"param":   nil,
+		})
+		return fmt.Sprintf("\nevent: error\ndata: %s\n\n", data)
+	default:
+		return fmt.Sprintf("\nevent: error\ndata: %s\n\n", AnthropicErrorBody("billing_error", message))
+	}
+}
+
+// endStreamOnCreditCap 读取上游出错时调用：超出积分上限则写出协议错误事件并正常结束响应，其他错误原样返回
+func endStreamOnCreditCap(sse *SSEWriter, err error) error {
+	capErr, ok := err.(*StreamCreditCapError)
+	if !ok {
+		return err
+	}
+	log.Printf("[WARN] 流式请求 (%s) 估算积分 %.2f 超过上限 %.2f，已中断", capErr.Model, capErr.Credits, capErr.Cap)
+	if err := sse.Printf("%s", capErr.Event()); err != nil {
+		return err
+	}
+	return sse.Flush()
+}
+
+// ActiveStream 进行中的流式请求及其估算费用
+type ActiveStream struct {
+	ID           string    `json:"id"`
+	Model        string    `json:"model"`
+	Protocol     string    `json:"protocol"`
+	StartedAt    time.Time `json:"started_at"`
+	OutputTokens int       `json:"output_tokens"`
+	Credits      float64   `json:"credits"`
+	Cap          float64   `json:"cap,omitempty"`
+}
+
+var (
+	activeStreamsMu sync.Mutex
+	activeStreams   = make(map[string]*streamCostReader)
+	activeStreamSeq atomic.Uint64
+)
+
+// ListActiveStreams 返回进行中的流式请求，按开始时间排序
+func ListActiveStreams() []ActiveStream {
+	activeStreamsMu.Lock()
+	readers := make([]*streamCostReader, 0, len(activeStreams))
+	for _, r := range activeStreams {
+		readers = append(readers, r)
+	}
+	activeStreamsMu.Unlock()
+
+	streams := make([]ActiveStream, 0, len(readers))
+	for _, r := range readers {
+		streams = append(streams, r.snapshot())
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].StartedAt.Before(streams[j].StartedAt) })
+	return streams
+}
+
+// streamCostReader 在转发流式响应的同时估算已输出的 token 数和积分
+// 估算值超过上限时，截断到越限的那一行，之后的读取返回 *StreamCreditCapError
+type streamCostReader struct {
+	io.ReadCloser
+	id         string
+	model      string
+	protocol   string
+	startedAt  time.Time
+	multiplier float64
+	perCredit  int
+	cap        float64
+
+	buf       []byte
+	textBytes int // 增量文本的字节数，按 4 字节一个 token 估算
+	reported  int // 上游用量中报告的输出 token 数，优先于估算值
+	capErr    *StreamCreditCapError
+
+	mu      sync.Mutex
+	tokens  int
+	credits float64
+	closed  bool
+}
+
+// trackStreamCost 包装流式响应体，登记到进行中的流式请求列表，Close 时移除
+func trackStreamCost(body io.ReadCloser, modelID, protocol string) io.ReadCloser {
+	settings := GetStreamCreditSettings()
+	multiplier := 1.0
+	if zenModel, ok := model.GetZenModel(modelID); ok {
+		multiplier = zenModel.Multiplier
+	}
+	r := &streamCostReader{
+		ReadCloser: body,
+		id:         fmt.Sprintf("stream-%d", activeStreamSeq.Add(1)),
+		model:      modelID,
+		protocol:   protocol,
+		startedAt:  time.Now(),
+		multiplier: multiplier,
+		perCredit:  settings.TokensPerCredit,
+		cap:        settings.Cap,
+	}
+	activeStreamsMu.Lock()
+	activeStreams[r.id] = r
+	activeStreamsMu.Unlock()
+	return r
+}
+
+func (r *streamCostReader) Read(p []byte) (int, error) {
+	if r.capErr != nil {
+		return 0, r.capErr
+	}
+	n, err := r.ReadCloser.Read(p)
+	for i := 0; i < n; {
+		j := bytes.IndexByte(p[i:n], '\n')
+		if j < 0 {
+			r.buf = append(r.buf, p[i:n]...)
+			break
+		}
+		r.buf = append(r.buf, p[i:i+j]...)
+		r.observeLine(bytes.TrimSpace(r.buf))
+		r.buf = r.buf[:0]
+		i += j + 1
+		if r.capErr != nil {
+			return i, nil
+		}
+	}
+	return n, err
+}
+
+func (r *streamCostReader) Close() error {
+	r.mu.Lock()
+	alreadyClosed := r.closed
+	r.closed = true
+	r.mu.Unlock()
+	if !alreadyClosed {
+		activeStreamsMu.Lock()
+		delete(activeStreams, r.id)
+		activeStreamsMu.Unlock()
+	}
+	return r.ReadCloser.Close()
+}
+
+// observeLine 从一行 data 中累计输出文本或读取上游报告的输出 token 数
+func (r *streamCostReader) observeLine(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	var event struct {
+		Type  string          `json:"type"`
+		Delta json.RawMessage `json:"delta"`
+		Usage *struct {
+			OutputTokens     int `json:"output_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+		Response *struct {
+			Usage *struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		} `json:"response"`
+		Choices []struct {
+			Delta struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(data, &event) != nil {
+		return
+	}
+
+	switch {
+	case event.Type == "content_block_delta":
+		// Anthropic: text_delta / thinking_delta / input_json_delta
+		var delta struct {
+			Text        string `json:"text"`
+			Thinking    string `json:"thinking"`
+			PartialJSON string `json:"partial_json"`
+		}
+		if json.Unmarshal(event.Delta, &delta) == nil {
+			r.textBytes += len(delta.Text) + len(delta.Thinking) + len(delta.PartialJSON)
+		}
+	case strings.HasSuffix(event.Type, ".delta"):
+		// Responses API: response.output_text.delta 等
+		var delta string
+		if json.Unmarshal(event.Delta, &delta) == nil {
+			r.textBytes += len(delta)
+		}
+	}
+	for _, choice := range event.Choices {
+		r.textBytes += len(choice.Delta.Content) + len(choice.Delta.ReasoningContent)
+	}
+	if event.Usage != nil {
+		r.reported = max(r.reported, event.Usage.OutputTokens, event.Usage.CompletionTokens)
+	}
+	if event.Response != nil && event.Response.Usage != nil {
+		r.reported = max(r.reported, event.Response.Usage.OutputTokens)
+	}
+	r.update()
+}
+
+// update 刷新估算值，超过上限时记录错误
+func (r *streamCostReader) update() {
+	tokens := max(r.reported, (r.textBytes+3)/4)
+	credits := r.multiplier * float64(tokens) / float64(r.perCredit)
+
+	r.mu.Lock()
+	r.tokens = tokens
+	r.credits = credits
+	r.mu.Unlock()
+
+	if r.cap > 0 && credits > r.cap {
+		r.capErr = &StreamCreditCapError{Protocol: r.protocol, Model: r.model, Credits: credits, Cap: r.cap}
+	}
+}
+
+func (r *streamCostReader) snapshot() ActiveStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ActiveStream{
+		ID:           r.id,
+		Model:        r.model,
+		Protocol:     r.protocol,
+		StartedAt:    r.startedAt,
+		OutputTokens: r.tokens,
+		Credits:      r.credits,
+		Cap:          r.cap,
+	}
+}
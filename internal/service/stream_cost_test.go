@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withStreamCreditSettings 临时修改积分上限，测试结束后恢复
+func withStreamCreditSettings(t *testing.T, settings StreamCreditSettings) {
+	t.Helper()
+	prev := GetStreamCreditSettings()
+	if err := SetStreamCreditSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetStreamCreditSettings(prev) })
+}
+
+func anthropicTextDelta(text string) string {
+	return "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"" + text + "\"}}\n\n"
+}
+
+func TestStreamCreditCapTerminatesAnthropicStream(t *testing.T) {
+	// 每个 token 计 1 积分，上限 5 积分（约 20 字节文本）
+	withStreamCreditSettings(t, StreamCreditSettings{Cap: 5, TokensPerCredit: 1})
+
+	chunk := strings.Repeat("x", 12) // 3 token
+	upstream := anthropicTextDelta(chunk) + anthropicTextDelta(chunk) + anthropicTextDelta(chunk) +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	body := trackStreamCost(io.NopCloser(strings.NewReader(upstream)), "unknown-model", StreamProtocolAnthropic)
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}
+
+	if streams := ListActiveStreams(); len(streams) != 1 || streams[0].Protocol != StreamProtocolAnthropic {
+		t.Fatalf("active streams = %+v, want the tracked stream", streams)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := StreamResponse(context.Background(), rec, resp); err != nil {
+		t.Fatalf("StreamResponse: %v", err)
+	}
+	body.Close()
+
+	out := rec.Body.String()
+	if strings.Count(out, "text_delta") != 2 {
+		t.Errorf("want the two deltas up to the cap forwarded, got:\n%s", out)
+	}
+	if strings.Contains(out, "message_stop") {
+		t.Errorf("stream continued after cap:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "event: error\ndata: {\"error\":{\"message\":\"Stream stopped: estimated cost 6.00 credits exceeded the per-request cap of 5.00 credits\",\"type\":\"billing_error\"},\"type\":\"error\"}\n\n") {
+		t.Errorf("missing Anthropic error event at end:\n%s", out)
+	}
+	if streams := ListActiveStreams(); len(streams) != 0 {
+		t.Errorf("stream not removed after close: %+v", streams)
+	}
+}
+
+func TestStreamCreditCapEventPerProtocol(t *testing.T) {
+	err := &StreamCreditCapError{Credits: 6, Cap: 5}
+
+	err.Protocol = StreamProtocolChat
+	if event := err.Event(); !strings.Contains(event, `"code":"stream_credit_cap_exceeded"`) || !strings.HasSuffix(event, "data: [DONE]\n\n") {
+		t.Errorf("chat event = %q", event)
+	}
+	err.Protocol = StreamProtocolResponses
+	if event := err.Event(); !strings.Contains(event, "event: error\ndata: {\"code\":\"stream_credit_cap_exceeded\"") {
+		t.Errorf("responses event = %q", event)
+	}
+}
+
+func TestStreamCostPrefersReportedUsage(t *testing.T) {
+	withStreamCreditSettings(t, StreamCreditSettings{TokensPerCredit: 1000})
+
+	upstream := anthropicTextDelta("hi") +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":500}}\n\n"
+	body := trackStreamCost(io.NopCloser(strings.NewReader(upstream)), "unknown-model", StreamProtocolAnthropic)
+	defer body.Close()
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+
+	streams := ListActiveStreams()
+	if len(streams) != 1 || streams[0].OutputTokens != 500 || streams[0].Credits != 0.5 {
+		t.Fatalf("active streams = %+v, want 500 tokens / 0.5 credits", streams)
+	}
+}
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"zencoder2api/internal/model"
+)
+
+// StreamFailoverSettings 流式响应中途失败时换号续传的范围
+type StreamFailoverSettings struct {
+	MaxAttempts   int `json:"max_attempts"`   // 每个流最多续传的次数，0 表示关闭
+	MaxBytes      int `json:"max_bytes"`      // 已向客户端转发超过该字节数后不再续传
+	WindowSeconds int `json:"window_seconds"` // 流开始超过该时长后不再续传
+}
+
+const (
+	defaultStreamFailoverAttempts = 1
+	defaultStreamFailoverBytes    = 16384
+	defaultStreamFailoverWindow   = 30
+	// maxStreamFailoverAttempts 每个流续传次数的上限
+	maxStreamFailoverAttempts = 5
+)
+
+// streamFailoverContextKey 续传请求不使用缓存亲和，避免再次调度到刚中断的账号
+const streamFailoverContextKey contextKey = "stream_failover"
+
+// 续传结果
+const (
+	StreamFailoverResumed = "resumed" // 已换号续传
+	StreamFailoverFailed  = "failed"  // 续传请求失败，流以原来的错误结束
+	StreamFailoverSkipped = "skipped" // 超出续传范围或内容无法续传
+)
+
+var (
+	streamFailoverMu       sync.RWMutex
+	streamFailoverSettings StreamFailoverSettings
+	streamFailoverOnce     sync.Once
+
+	streamFailoverResumed atomic.Uint64
+	streamFailoverFailed  atomic.Uint64
+	streamFailoverSkipped atomic.Uint64
+)
+
+// loadStreamFailoverSettings 读取 STREAM_FAILOVER_ATTEMPTS / STREAM_FAILOVER_BYTES / STREAM_FAILOVER_WINDOW
+func loadStreamFailoverSettings() {
+	streamFailoverSettings = StreamFailoverSettings{
+		MaxAttempts:   envNonNegativeIntDefault("STREAM_FAILOVER_ATTEMPTS", defaultStreamFailoverAttempts),
+		MaxBytes:      envPositiveInt("STREAM_FAILOVER_BYTES", defaultStreamFailoverBytes),
+		WindowSeconds: envPositiveInt("STREAM_FAILOVER_WINDOW", defaultStreamFailoverWindow),
+	}
+	if streamFailoverSettings.MaxAttempts > maxStreamFailoverAttempts {
+		log.Printf("[WARN] STREAM_FAILOVER_ATTEMPTS 超过上限 %d，已按上限处理", maxStreamFailoverAttempts)
+		streamFailoverSettings.MaxAttempts = maxStreamFailoverAttempts
+	}
+}
+
+// GetStreamFailoverSettings 获取流式续传设置
+func GetStreamFailoverSettings() StreamFailoverSettings {
+	streamFailoverOnce.Do(loadStreamFailoverSettings)
+	streamFailoverMu.RLock()
+	defer streamFailoverMu.RUnlock()
+	return streamFailoverSettings
+}
+
+// SetStreamFailoverSettings 运行时修改流式续传设置（仅内存生效），只影响之后开始的流
+func SetStreamFailoverSettings(settings StreamFailoverSettings) error {
+	if settings.MaxAttempts < 0 || settings.MaxAttempts > maxStreamFailoverAttempts {
+		return fmt.Errorf("max_attempts 必须在 0 到 %d 之间", maxStreamFailoverAttempts)
+	}
+	if settings.MaxBytes <= 0 || settings.WindowSeconds <= 0 {
+		return fmt.Errorf("max_bytes 和 window_seconds 必须大于 0")
+	}
+	streamFailoverOnce.Do(loadStreamFailoverSettings)
+	streamFailoverMu.Lock()
+	defer streamFailoverMu.Unlock()
+	streamFailoverSettings = settings
+	return nil
+}
+
+// GetStreamFailoverCounts 返回各续传结果的累计次数
+func GetStreamFailoverCounts() map[string]uint64 {
+	return map[string]uint64{
+		StreamFailoverResumed: streamFailoverResumed.Load(),
+		StreamFailoverFailed:  streamFailoverFailed.Load(),
+		StreamFailoverSkipped: streamFailoverSkipped.Load(),
+	}
+}
+
+func writeStreamFailoverMetrics(w io.Writer, counts map[string]uint64) {
+	fmt.Fprintln(w, "# TYPE zencoder_stream_failover counter")
+	fmt.Fprintln(w, "# HELP zencoder_stream_failover Anthropic streams whose upstream failed mid-stream, by whether they were resumed on another account.")
+	for _, result := range []string{StreamFailoverResumed, StreamFailoverFailed, StreamFailoverSkipped} {
+		fmt.Fprintf(w, "zencoder_stream_failover_total{result=%q} %d\n", result, counts[result])
+	}
+}
+
+// withStreamFailover 为 /v1/messages 的流式响应启用中途失败续传，关闭时原样返回
+// 启用 thinking 时上游不接受 assistant 预填充，只在尚未输出内容时续传
+func (s *AnthropicService) withStreamFailover(ctx context.Context, upstream io.ReadCloser, body []byte, modelID string) io.ReadCloser {
+	settings := GetStreamFailoverSettings()
+	if settings.MaxAttempts == 0 {
+		return upstream
+	}
+	prefill := !requestsThinking(body)
+	if zenModel, ok := model.GetZenModel(modelID); ok && zenModel.Parameters != nil && zenModel.Parameters.Thinking != nil {
+		prefill = false
+	}
+	return newStreamFailover(ctx, upstream, settings, prefill, func(ctx context.Context, prefix string) (*http.Response, error) {
+		retryBody := body
+		if prefix != "" {
+			var err error
+			if retryBody, err = appendAssistantPrefix(body, prefix); err != nil {
+				return nil, err
+			}
+		}
+		return s.Messages(ctx, retryBody, true)
+	})
+}
+
+// requestsThinking 请求体是否启用了 thinking
+func requestsThinking(body []byte) bool {
+	var req struct {
+		Thinking map[string]interface{} `json:"thinking"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.Thinking == nil {
+		return false
+	}
+	enabled, _ := req.Thinking["enabled"].(bool)
+	return enabled || req.Thinking["type"] == "enabled"
+}
+
+// appendAssistantPrefix 把已输出的文本作为 assistant 预填充追加到请求末尾，请求本身以 assistant 消息结尾时接在其后
+func appendAssistantPrefix(body []byte, prefix string) ([]byte, error) {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(body, &reqMap); err != nil {
+		return nil, err
+	}
+	messages, _ := reqMap["messages"].([]interface{})
+	if n := len(messages); n > 0 {
+		if last, ok := messages[n-1].(map[string]interface{}); ok && last["role"] == "assistant" {
+			switch content := last["content"].(type) {
+			case string:
+				last["content"] = content + prefix
+				return json.Marshal(reqMap)
+			case []interface{}:
+				last["content"] = append(content, map[string]interface{}{"type": "text", "text": prefix})
+				return json.Marshal(reqMap)
+			}
+		}
+	}
+	reqMap["messages"] = append(messages, map[string]interface{}{"role": "assistant", "content": prefix})
+	return json.Marshal(reqMap)
+}
+
+// streamFailoverEvent 续传需要关心的 SSE 事件字段
+type streamFailoverEvent struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+	} `json:"content_block"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+}
+
+// streamFailover 按事件转发 Anthropic 流式响应，记录已输出的文本。上游在续传范围内中断
+// （读取出错、没有 message_stop 就结束或发来 error 事件）时，以已输出的文本作为预填充换号重新请求，
+// 丢弃新流的 message_start 并改写内容块下标，使客户端收到的仍是一条连续的流
+type streamFailover struct {
+	ctx      context.Context
+	settings StreamFailoverSettings
+	prefill  bool // 是否可以用 assistant 预填充续接已输出的文本
+	resume   func(ctx context.Context, prefix string) (*http.Response, error)
+
+	body    io.ReadCloser
+	reader  *bufio.Reader
+	pending []byte
+	err     error
+
+	started   time.Time
+	forwarded int
+	attempts  int
+
+	// 客户端已收到的内容
+	sawStart  bool
+	nextIndex int
+	openIndex int // 尚未结束的内容块，-1 表示没有
+	text      strings.Builder
+	resumable bool // 只输出过文本块且消息尚未结束
+	stopped   bool
+
+	// 续传流的内容块下标映射
+	resumed      bool
+	offset       int
+	continueOpen bool // 新流的第一个文本块接在未结束的文本块后面
+	trimLeading  bool // 预填充去掉了末尾空白，新流开头的空白不再重复输出
+}
+
+func newStreamFailover(ctx context.Context, body io.ReadCloser, settings StreamFailoverSettings, prefill bool,
+	resume func(ctx context.Context, prefix string) (*http.Response, error)) *streamFailover {
+	return &streamFailover{
+		ctx:       ctx,
+		settings:  settings,
+		prefill:   prefill,
+		resume:    resume,
+		body:      body,
+		reader:    bufio.NewReader(body),
+		started:   time.Now(),
+		openIndex: -1,
+		resumable: true,
+	}
+}
+
+func (f *streamFailover) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.next()
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func (f *streamFailover) Close() error {
+	return f.body.Close()
+}
+
+// next 读取并处理上游的下一个事件
+func (f *streamFailover) next() {
+	var event []byte
+	for {
+		line, err := f.reader.ReadBytes('\n')
+		event = append(event, line...)
+		if err != nil {
+			if f.stopped {
+				// 消息已完整结束，剩余内容原样转发
+				f.emit(event)
+				f.err = err
+				return
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			f.fail(err, nil)
+			return
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			break
+		}
+	}
+
+	ev, ok := parseStreamFailoverEvent(event)
+	if !ok {
+		f.emit(event)
+		return
+	}
+	if ev.Type == "error" && !f.stopped {
+		f.fail(fmt.Errorf("upstream error event: %s", bytes.TrimSpace(event)), event)
+		return
+	}
+	if f.resumed {
+		event = f.mapEvent(event, &ev)
+		if event == nil {
+			return
+		}
+	}
+	f.track(ev)
+	f.emit(event)
+}
+
+func parseStreamFailoverEvent(event []byte) (streamFailoverEvent, bool) {
+	var ev streamFailoverEvent
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+			return ev, json.Unmarshal(bytes.TrimSpace(data), &ev) == nil && ev.Type != ""
+		}
+	}
+	return ev, false
+}
+
+func (f *streamFailover) emit(event []byte) {
+	f.pending = append(f.pending, event...)
+	f.forwarded += len(event)
+}
+
+// track 按客户端收到的事件更新流状态
+func (f *streamFailover) track(ev streamFailoverEvent) {
+	switch ev.Type {
+	case "message_start":
+		f.sawStart = true
+	case "content_block_start":
+		f.openIndex = ev.Index
+		f.nextIndex = ev.Index + 1
+		if ev.ContentBlock.Type != "text" {
+			f.resumable = false
+		}
+	case "content_block_delta":
+		if ev.Delta.Type == "text_delta" {
+			f.text.WriteString(ev.Delta.Text)
+		}
+	case "content_block_stop":
+		f.openIndex = -1
+	case "message_delta":
+		f.resumable = false
+	case "message_stop":
+		f.stopped = true
+	}
+}
+
+// mapEvent 改写续传流的事件，返回 nil 表示丢弃
+func (f *streamFailover) mapEvent(event []byte, ev *streamFailoverEvent) []byte {
+	switch ev.Type {
+	case "message_start":
+		if f.sawStart {
+			return nil
+		}
+		return event
+	case "content_block_start":
+		if f.continueOpen {
+			f.continueOpen = false
+			if ev.Index == 0 && ev.ContentBlock.Type == "text" {
+				return nil
+			}
+			// 新流没有接着输出文本，先结束原来的文本块
+			stop := streamFailoverEvent{Type: "content_block_stop", Index: f.openIndex}
+			f.track(stop)
+			f.offset = f.nextIndex - ev.Index
+			ev.Index += f.offset
+			return append(sseEvent(stop.Type, map[string]interface{}{"type": stop.Type, "index": stop.Index}), f.rewrite(event, ev.Index, nil)...)
+		}
+	case "content_block_delta":
+		if f.trimLeading && ev.Delta.Type == "text_delta" {
+			f.trimLeading = false
+			text := strings.TrimLeftFunc(ev.Delta.Text, unicode.IsSpace)
+			ev.Delta.Text = text
+			ev.Index += f.offset
+			return f.rewrite(event, ev.Index, &text)
+		}
+	case "content_block_stop":
+	default:
+		return event
+	}
+	ev.Index += f.offset
+	return f.rewrite(event, ev.Index, nil)
+}
+
+// rewrite 改写事件的内容块下标，text 不为 nil 时同时替换增量文本
+func (f *streamFailover) rewrite(event []byte, index int, text *string) []byte {
+	var data map[string]interface{}
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		if raw, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+			if json.Unmarshal(bytes.TrimSpace(raw), &data) != nil {
+				return event
+			}
+			break
+		}
+	}
+	data["index"] = index
+	if delta, ok := data["delta"].(map[string]interface{}); ok && text != nil {
+		delta["text"] = *text
+	}
+	eventType, _ := data["type"].(string)
+	return sseEvent(eventType, data)
+}
+
+func sseEvent(eventType string, data interface{}) []byte {
+	payload, _ := json.Marshal(data)
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, payload))
+}
+
+// canResume 是否仍在续传范围内
+func (f *streamFailover) canResume() bool {
+	return f.ctx.Err() == nil &&
+		f.attempts < f.settings.MaxAttempts &&
+		f.resumable &&
+		f.forwarded <= f.settings.MaxBytes &&
+		time.Since(f.started) <= time.Duration(f.settings.WindowSeconds)*time.Second &&
+		(f.text.Len() == 0 || f.prefill)
+}
+
+// fail 处理上游中断：在续传范围内换号续传，否则以原来的错误结束，event 不为 nil 时把上游的 error 事件转发给客户端
+func (f *streamFailover) fail(cause error, event []byte) {
+	if !f.canResume() {
+		if f.ctx.Err() == nil {
+			streamFailoverSkipped.Add(1)
+		}
+	} else if err := f.resumeStream(cause); err != nil {
+		streamFailoverFailed.Add(1)
+		LogEvent(f.ctx, slog.LevelWarn, "Anthropic", "流式响应续传失败", slog.Int("attempt", f.attempts), logError(err))
+	} else {
+		streamFailoverResumed.Add(1)
+		return
+	}
+
+	if event != nil {
+		f.emit(event)
+		f.err = io.EOF
+		return
+	}
+	f.err = cause
+}
+
+func (f *streamFailover) resumeStream(cause error) error {
+	f.attempts++
+	text := f.text.String()
+	prefix := strings.TrimRightFunc(text, unicode.IsSpace)
+	LogEvent(f.ctx, slog.LevelWarn, "Anthropic", "流式响应中断，换号续传", slog.Int("forwarded_bytes", f.forwarded), slog.Int("attempt", f.attempts), logError(cause))
+
+	resp, err := f.resume(context.WithValue(f.ctx, streamFailoverContextKey, true), prefix)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return fmt.Errorf("upstream returned %d", resp.StatusCode)
+	}
+
+	f.body.Close()
+	f.body = resp.Body
+	f.reader = bufio.NewReader(resp.Body)
+	f.resumed = true
+	f.continueOpen = f.openIndex >= 0
+	f.offset = f.nextIndex
+	if f.continueOpen {
+		f.offset = f.openIndex
+	}
+	f.trimLeading = f.continueOpen && len(prefix) < len(text)
+	return nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const failoverMessageStart = "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":10}}}\n\n"
+
+func failoverEvent(eventType, data string) string {
+	return "event: " + eventType + "\ndata: " + data + "\n\n"
+}
+
+// brokenStream 输出 events 后以连接错误结束
+func brokenStream(events ...string) io.ReadCloser {
+	return io.NopCloser(io.MultiReader(strings.NewReader(strings.Join(events, "")), iotest.ErrReader(errors.New("connection reset by peer"))))
+}
+
+func failoverSettings() StreamFailoverSettings {
+	return StreamFailoverSettings{MaxAttempts: 1, MaxBytes: 16384, WindowSeconds: 30}
+}
+
+func readFailoverEvents(t *testing.T, r io.Reader) ([]streamFailoverEvent, error) {
+	t.Helper()
+	out, err := io.ReadAll(r)
+	var events []streamFailoverEvent
+	for _, raw := range strings.SplitAfter(string(out), "\n\n") {
+		if ev, ok := parseStreamFailoverEvent([]byte(raw)); ok {
+			events = append(events, ev)
+		}
+	}
+	return events, err
+}
+
+func TestStreamFailoverResumesTextWithPrefill(t *testing.T) {
+	first := brokenStream(
+		failoverMessageStart,
+		failoverEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`),
+		failoverEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello "}}`),
+	)
+	second := strings.Join([]string{
+		failoverMessageStart,
+		failoverEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`),
+		failoverEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`),
+		failoverEvent("content_block_stop", `{"type":"content_block_stop","index":0}`),
+		failoverEvent("content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"t1","name":"f","input":{}}}`),
+		failoverEvent("content_block_stop", `{"type":"content_block_stop","index":1}`),
+		failoverEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`),
+		failoverEvent("message_stop", `{"type":"message_stop"}`),
+	}, "")
+
+	var prefixes []string
+	f := newStreamFailover(context.Background(), first, failoverSettings(), true, func(ctx context.Context, prefix string) (*http.Response, error) {
+		if ctx.Value(streamFailoverContextKey) == nil {
+			t.Error("resume request should skip cache affinity")
+		}
+		prefixes = append(prefixes, prefix)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(second))}, nil
+	})
+
+	events, err := readFailoverEvents(t, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefixes) != 1 || prefixes[0] != "Hello" {
+		t.Fatalf("prefixes = %q", prefixes)
+	}
+
+	var text strings.Builder
+	starts := 0
+	var order []string
+	for _, ev := range events {
+		order = append(order, ev.Type)
+		switch ev.Type {
+		case "message_start":
+			starts++
+		case "content_block_delta":
+			text.WriteString(ev.Delta.Text)
+		}
+	}
+	if starts != 1 {
+		t.Errorf("got %d message_start events", starts)
+	}
+	if text.String() != "Hello world" {
+		t.Errorf("text = %q", text.String())
+	}
+	// 续传的文本接在原来的 0 号块后面，工具调用顺延为 1 号块
+	want := []string{"message_start", "content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_stop", "message_delta", "message_stop"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v", order)
+	}
+	if events[5].Index != 1 || events[5].ContentBlock.Type != "tool_use" || events[3].Index != 0 {
+		t.Errorf("indexes not continuous: %+v", events)
+	}
+}
+
+func TestStreamFailoverRetriesUpstreamErrorEvent(t *testing.T) {
+	errorEvent := failoverEvent("error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	first := io.NopCloser(strings.NewReader(failoverMessageStart + errorEvent))
+	second := failoverMessageStart +
+		failoverEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`) +
+		failoverEvent("content_block_stop", `{"type":"content_block_stop","index":0}`) +
+		failoverEvent("message_stop", `{"type":"message_stop"}`)
+
+	// 启用 thinking 的请求不能预填充，但尚未输出内容时可以直接重新请求
+	f := newStreamFailover(context.Background(), first, failoverSettings(), false, func(ctx context.Context, prefix string) (*http.Response, error) {
+		if prefix != "" {
+			t.Errorf("prefix = %q", prefix)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(second))}, nil
+	})
+	out, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("overloaded_error")) || bytes.Count(out, []byte("event: message_start")) != 1 || !bytes.Contains(out, []byte("message_stop")) {
+		t.Errorf("output = %s", out)
+	}
+}
+
+func TestStreamFailoverOutsideWindow(t *testing.T) {
+	toolStart := failoverEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"t1","name":"f","input":{}}}`)
+	textDelta := failoverEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"partial answer"}}`)
+	textStart := failoverEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`)
+
+	cases := []struct {
+		name     string
+		body     io.ReadCloser
+		settings StreamFailoverSettings
+		prefill  bool
+	}{
+		{"tool_use already streamed", brokenStream(failoverMessageStart, toolStart), failoverSettings(), true},
+		{"text cannot be prefilled", brokenStream(failoverMessageStart, textStart, textDelta), failoverSettings(), false},
+		{"byte budget exceeded", brokenStream(failoverMessageStart, textStart, textDelta), StreamFailoverSettings{MaxAttempts: 1, MaxBytes: 64, WindowSeconds: 30}, true},
+		{"disabled", brokenStream(failoverMessageStart), StreamFailoverSettings{MaxBytes: 16384, WindowSeconds: 30}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := GetStreamFailoverCounts()[StreamFailoverSkipped]
+			f := newStreamFailover(context.Background(), tc.body, tc.settings, tc.prefill, func(context.Context, string) (*http.Response, error) {
+				t.Error("should not resume")
+				return nil, errors.New("unexpected")
+			})
+			out, err := io.ReadAll(f)
+			if err == nil || !bytes.Contains(out, []byte("message_start")) {
+				t.Errorf("err = %v, output = %s", err, out)
+			}
+			if GetStreamFailoverCounts()[StreamFailoverSkipped] != before+1 {
+				t.Error("skip not counted")
+			}
+		})
+	}
+}
+
+func TestAppendAssistantPrefix(t *testing.T) {
+	cases := []struct {
+		body string
+		want string
+	}{
+		{`{"messages":[{"role":"user","content":"hi"}]}`, `[{"content":"hi","role":"user"},{"content":"Hello","role":"assistant"}]`},
+		{`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"Sure: "}]}`, `[{"content":"hi","role":"user"},{"content":"Sure: Hello","role":"assistant"}]`},
+		{`{"messages":[{"role":"assistant","content":[{"type":"text","text":"Sure"}]}]}`, `[{"content":[{"text":"Sure","type":"text"},{"text":"Hello","type":"text"}],"role":"assistant"}]`},
+	}
+	for _, tc := range cases {
+		out, err := appendAssistantPrefix([]byte(tc.body), "Hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Messages json.RawMessage `json:"messages"`
+		}
+		json.Unmarshal(out, &got)
+		if string(got.Messages) != tc.want {
+			t.Errorf("%s: messages = %s", tc.body, got.Messages)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultStreamKeepAliveInterval 默认在上游静默 15 秒后发送 ping，低于常见代理的空闲超时
+const defaultStreamKeepAliveInterval = 15
+
+// StreamKeepAliveSettings 流式响应的 keep-alive 注释帧
+type StreamKeepAliveSettings struct {
+	IntervalSeconds int `json:"interval_seconds"` // 上游静默超过该秒数时写入 ": ping"，0 表示关闭
+}
+
+var (
+	streamKeepAliveMu       sync.RWMutex
+	streamKeepAliveSettings StreamKeepAliveSettings
+	streamKeepAliveOnce     sync.Once
+
+	streamKeepAlivePings atomic.Uint64
+)
+
+// loadStreamKeepAliveSettings 读取 STREAM_KEEPALIVE_INTERVAL
+func loadStreamKeepAliveSettings() {
+	streamKeepAliveSettings = StreamKeepAliveSettings{
+		IntervalSeconds: envNonNegativeIntDefault("STREAM_KEEPALIVE_INTERVAL", defaultStreamKeepAliveInterval),
+	}
+}
+
+// GetStreamKeepAliveSettings 获取 keep-alive 设置
+func GetStreamKeepAliveSettings() StreamKeepAliveSettings {
+	streamKeepAliveOnce.Do(loadStreamKeepAliveSettings)
+	streamKeepAliveMu.RLock()
+	defer streamKeepAliveMu.RUnlock()
+	return streamKeepAliveSettings
+}
+
+// SetStreamKeepAliveSettings 运行时修改 keep-alive 间隔（仅内存生效），只影响之后开始的流
+func SetStreamKeepAliveSettings(settings StreamKeepAliveSettings) error {
+	if settings.IntervalSeconds < 0 {
+		return fmt.Errorf("interval_seconds 不能为负数")
+	}
+	streamKeepAliveOnce.Do(loadStreamKeepAliveSettings)
+	streamKeepAliveMu.Lock()
+	defer streamKeepAliveMu.Unlock()
+	streamKeepAliveSettings = settings
+	return nil
+}
+
+func writeStreamKeepAliveMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# TYPE zencoder_stream_keepalive_pings counter")
+	fmt.Fprintln(w, "# HELP zencoder_stream_keepalive_pings Keep-alive comment frames written to streaming clients while upstream was silent.")
+	fmt.Fprintf(w, "zencoder_stream_keepalive_pings_total %d\n", streamKeepAlivePings.Load())
+}
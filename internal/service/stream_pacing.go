@@ -0,0 +1,343 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxStreamPacingInterval 相邻文本增量的最大等待间隔，避免配置错误使流长时间停顿
+const maxStreamPacingInterval = 1000
+
+// StreamPacingRule 流式文本增量的平滑输出规则，两项都为 0 表示关闭
+type StreamPacingRule struct {
+	MaxChars      int `json:"max_chars"`       // 单个文本增量事件的最大字符数，超过时拆分为多个事件，0 表示不拆分
+	MinIntervalMs int `json:"min_interval_ms"` // 相邻两个文本增量事件的最小间隔（毫秒），0 表示不等待
+}
+
+func (r StreamPacingRule) enabled() bool {
+	return r.MaxChars > 0 || r.MinIntervalMs > 0
+}
+
+func (r StreamPacingRule) validate() error {
+	if r.MaxChars < 0 || r.MinIntervalMs < 0 {
+		return fmt.Errorf("max_chars 和 min_interval_ms 不能为负数")
+	}
+	if r.MinIntervalMs > maxStreamPacingInterval {
+		return fmt.Errorf("min_interval_ms 不能超过 %d", maxStreamPacingInterval)
+	}
+	return nil
+}
+
+// StreamPacingSettings 全局规则及按模型、按 API Key 的规则，优先级 Key > 模型 > 全局
+type StreamPacingSettings struct {
+	StreamPacingRule
+	Models map[string]StreamPacingRule `json:"models"`
+	Keys   map[string]StreamPacingRule `json:"keys"` // 按 API Key（已脱敏）的规则
+}
+
+var (
+	streamPacingMu       sync.RWMutex
+	streamPacingSettings StreamPacingSettings
+	streamPacingOnce     sync.Once
+)
+
+// loadStreamPacingSettings 读取 STREAM_PACING_MAX_CHARS / STREAM_PACING_MIN_INTERVAL_MS 作为全局规则，
+// 按模型和 Key 的规则只能通过设置接口修改
+func loadStreamPacingSettings() {
+	rule := StreamPacingRule{
+		MaxChars:      envNonNegativeInt("STREAM_PACING_MAX_CHARS"),
+		MinIntervalMs: envNonNegativeInt("STREAM_PACING_MIN_INTERVAL_MS"),
+	}
+	if rule.MinIntervalMs > maxStreamPacingInterval {
+		log.Printf("[WARN] STREAM_PACING_MIN_INTERVAL_MS 超过 %d，已按 %d 处理", maxStreamPacingInterval, maxStreamPacingInterval)
+		rule.MinIntervalMs = maxStreamPacingInterval
+	}
+	streamPacingSettings = StreamPacingSettings{
+		StreamPacingRule: rule,
+		Models:           make(map[string]StreamPacingRule),
+		Keys:             make(map[string]StreamPacingRule),
+	}
+}
+
+// GetStreamPacingSettings 获取当前平滑输出设置副本
+func GetStreamPacingSettings() StreamPacingSettings {
+	streamPacingOnce.Do(loadStreamPacingSettings)
+	streamPacingMu.RLock()
+	defer streamPacingMu.RUnlock()
+
+	result := StreamPacingSettings{
+		StreamPacingRule: streamPacingSettings.StreamPacingRule,
+		Models:           make(map[string]StreamPacingRule, len(streamPacingSettings.Models)),
+		Keys:             make(map[string]StreamPacingRule, len(streamPacingSettings.Keys)),
+	}
+	for m, rule := range streamPacingSettings.Models {
+		result.Models[m] = rule
+	}
+	for k, rule := range streamPacingSettings.Keys {
+		result.Keys[MaskAPIKey(k)] = rule
+	}
+	return result
+}
+
+// SetStreamPacingRule 运行时修改平滑输出规则（仅内存生效），只影响之后开始的流
+// apiKey 非空时修改该 Key 的规则，否则 modelID 非空时修改该模型的规则，都为空时修改全局规则；
+// Key 或模型的规则两项都为 0 时删除
+func SetStreamPacingRule(apiKey, modelID string, rule StreamPacingRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	streamPacingOnce.Do(loadStreamPacingSettings)
+	streamPacingMu.Lock()
+	defer streamPacingMu.Unlock()
+
+	switch {
+	case apiKey != "" && !rule.enabled():
+		delete(streamPacingSettings.Keys, apiKey)
+	case apiKey != "":
+		streamPacingSettings.Keys[apiKey] = rule
+	case modelID != "" && !rule.enabled():
+		delete(streamPacingSettings.Models, modelID)
+	case modelID != "":
+		streamPacingSettings.Models[modelID] = rule
+	default:
+		streamPacingSettings.StreamPacingRule = rule
+	}
+	return nil
+}
+
+// streamPacingRuleFor 返回请求适用的规则
+func streamPacingRuleFor(ctx context.Context, modelID string) StreamPacingRule {
+	streamPacingOnce.Do(loadStreamPacingSettings)
+	streamPacingMu.RLock()
+	defer streamPacingMu.RUnlock()
+
+	if rule, ok := streamPacingSettings.Keys[GetAPIKey(ctx)]; ok {
+		return rule
+	}
+	if rule, ok := streamPacingSettings.Models[modelID]; ok {
+		return rule
+	}
+	return streamPacingSettings.StreamPacingRule
+}
+
+// paceStream 按规则包装流式响应体：过长的文本增量拆分为多个事件，相邻文本增量之间至少间隔 MinIntervalMs；
+// 规则关闭时原样返回。只处理文本增量，工具调用参数等其他事件立即转发
+func paceStream(ctx context.Context, body io.ReadCloser, modelID, protocol string) io.ReadCloser {
+	rule := streamPacingRuleFor(ctx, modelID)
+	if !rule.enabled() {
+		return body
+	}
+	return &streamPacer{
+		ReadCloser: body,
+		ctx:        ctx,
+		protocol:   protocol,
+		rule:       rule,
+		reader:     bufio.NewReader(body),
+	}
+}
+
+// streamPacer 逐行读取上游 SSE，文本增量事件排队后按间隔逐个输出
+type streamPacer struct {
+	io.ReadCloser
+	ctx      context.Context
+	protocol string
+	rule     StreamPacingRule
+	reader   *bufio.Reader
+
+	out      []byte   // 正在返回的数据
+	pending  [][]byte // 等待按间隔输出的文本增量
+	event    []byte   // 当前事件的 event: 行，拆分出的事件沿用
+	last     time.Time
+	sequence int // Responses 事件因拆分增加的 sequence_number
+	err      error
+}
+
+func (r *streamPacer) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if len(r.pending) > 0 {
+			if err := r.wait(); err != nil {
+				return 0, err
+			}
+			r.out, r.pending = r.pending[0], r.pending[1:]
+			break
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		r.err = err
+		if len(line) > 0 {
+			r.handleLine(line)
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// wait 距离上一个文本增量不足 MinIntervalMs 时等待，客户端断开时返回错误
+func (r *streamPacer) wait() error {
+	interval := time.Duration(r.rule.MinIntervalMs) * time.Millisecond
+	if delay := time.Until(r.last.Add(interval)); interval > 0 && !r.last.IsZero() && delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-r.ctx.Done():
+			return fmt.Errorf("%w: %v", ErrClientDisconnected, r.ctx.Err())
+		case <-timer.C:
+		}
+	}
+	r.last = time.Now()
+	return nil
+}
+
+// handleLine 文本增量放入等待队列，其他行直接输出
+func (r *streamPacer) handleLine(line []byte) {
+	trimmed := bytes.TrimSpace(line)
+	switch {
+	case len(trimmed) == 0:
+		r.event = nil
+		r.out = line
+		return
+	case bytes.HasPrefix(trimmed, []byte("event:")):
+		r.event = append([]byte(nil), line...)
+		r.out = line
+		return
+	}
+
+	data, ok := bytes.CutPrefix(trimmed, []byte("data:"))
+	data = bytes.TrimSpace(data)
+	if !ok || len(data) == 0 || data[0] != '{' {
+		r.out = line
+		return
+	}
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&event) != nil {
+		r.out = line
+		return
+	}
+
+	text, setText := streamTextDelta(r.protocol, event)
+	if setText == nil {
+		if r.sequence > 0 && r.renumber(event) {
+			r.out = streamPacingLine(event)
+			return
+		}
+		r.out = line
+		return
+	}
+
+	pieces := splitStreamText(text, r.rule.MaxChars)
+	sequence := event["sequence_number"]
+	for i, piece := range pieces {
+		var chunk []byte
+		if i > 0 {
+			chunk = append(chunk, r.event...)
+			r.sequence++
+		}
+		setText(piece)
+		if sequence != nil {
+			event["sequence_number"] = sequence
+			r.renumber(event)
+		}
+		chunk = append(chunk, streamPacingLine(event)...)
+		// 最后一段的事件由上游的空行结束
+		if i < len(pieces)-1 {
+			chunk = append(chunk, '\n')
+		}
+		r.pending = append(r.pending, chunk)
+	}
+}
+
+// renumber 拆分 Responses 事件后顺延 sequence_number，保持单调递增
+func (r *streamPacer) renumber(event map[string]interface{}) bool {
+	if r.protocol != StreamProtocolResponses {
+		return false
+	}
+	seq, ok := event["sequence_number"].(json.Number)
+	if !ok {
+		return false
+	}
+	n, err := seq.Int64()
+	if err != nil {
+		return false
+	}
+	event["sequence_number"] = n + int64(r.sequence)
+	return true
+}
+
+// streamTextDelta 按协议取出事件中的文本增量，返回修改该文本的函数；不是文本增量时返回 nil
+func streamTextDelta(protocol string, event map[string]interface{}) (string, func(string)) {
+	switch protocol {
+	case StreamProtocolAnthropic:
+		delta, _ := event["delta"].(map[string]interface{})
+		if event["type"] != "content_block_delta" || delta == nil {
+			return "", nil
+		}
+		field := map[interface{}]string{"text_delta": "text", "thinking_delta": "thinking"}[delta["type"]]
+		if text, ok := delta[field].(string); ok && field != "" && text != "" {
+			return text, func(s string) { delta[field] = s }
+		}
+	case StreamProtocolChat:
+		// 带 finish_reason 或 usage 的增量不拆分，避免重复
+		choices, _ := event["choices"].([]interface{})
+		if len(choices) != 1 || event["usage"] != nil {
+			return "", nil
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		delta, _ := choice["delta"].(map[string]interface{})
+		if delta == nil || choice["finish_reason"] != nil || delta["tool_calls"] != nil {
+			return "", nil
+		}
+		if text, ok := delta["content"].(string); ok && text != "" {
+			return text, func(s string) { delta["content"] = s }
+		}
+	case StreamProtocolResponses:
+		if event["type"] != "response.output_text.delta" {
+			return "", nil
+		}
+		if text, ok := event["delta"].(string); ok && text != "" {
+			return text, func(s string) { event["delta"] = s }
+		}
+	}
+	return "", nil
+}
+
+// splitStreamText 按字符数拆分文本，max 为 0 时不拆分
+func splitStreamText(text string, max int) []string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return []string{text}
+	}
+	var pieces []string
+	for len(text) > 0 {
+		end, count := 0, 0
+		for end < len(text) && count < max {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+			count++
+		}
+		pieces = append(pieces, text[:end])
+		text = text[end:]
+	}
+	return pieces
+}
+
+// streamPacingLine 重新编码事件为 data: 行
+func streamPacingLine(event map[string]interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("data: ")
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(event) // Encode 以换行结尾
+	return buf.Bytes()
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withStreamPacingRule 临时修改平滑输出规则，测试结束后删除
+func withStreamPacingRule(t *testing.T, apiKey, modelID string, rule StreamPacingRule) {
+	t.Helper()
+	prev := GetStreamPacingSettings().StreamPacingRule
+	if err := SetStreamPacingRule(apiKey, modelID, rule); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if apiKey == "" && modelID == "" {
+			SetStreamPacingRule("", "", prev)
+			return
+		}
+		SetStreamPacingRule(apiKey, modelID, StreamPacingRule{})
+	})
+}
+
+func readPaced(t *testing.T, ctx context.Context, upstream, modelID, protocol string) string {
+	t.Helper()
+	body := paceStream(ctx, io.NopCloser(strings.NewReader(upstream)), modelID, protocol)
+	out, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(out)
+}
+
+func TestStreamPacingSplitsAnthropicTextDelta(t *testing.T) {
+	withStreamPacingRule(t, "", "pacing-model", StreamPacingRule{MaxChars: 4})
+
+	upstream := anthropicTextDelta("你好世界hello") + "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	out := readPaced(t, context.Background(), upstream, "pacing-model", StreamProtocolAnthropic)
+
+	events := strings.Split(strings.TrimSuffix(out, "\n\n"), "\n\n")
+	if len(events) != 4 {
+		t.Fatalf("want 3 deltas and message_stop, got:\n%s", out)
+	}
+	var text string
+	for _, event := range events[:3] {
+		lines := strings.Split(event, "\n")
+		if len(lines) != 2 || lines[0] != "event: content_block_delta" {
+			t.Fatalf("event = %q", event)
+		}
+		var data struct {
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &data); err != nil || data.Delta.Type != "text_delta" {
+			t.Fatalf("data = %q (%v)", lines[1], err)
+		}
+		text += data.Delta.Text
+	}
+	if text != "你好世界hello" || !strings.Contains(events[0], `"text":"你好世界"`) {
+		t.Errorf("pieces:\n%s", out)
+	}
+	if events[3] != "event: message_stop\ndata: {\"type\":\"message_stop\"}" {
+		t.Errorf("last event = %q", events[3])
+	}
+
+	// 其他模型不受影响
+	if out := readPaced(t, context.Background(), upstream, "other-model", StreamProtocolAnthropic); out != upstream {
+		t.Errorf("unpaced stream changed:\n%s", out)
+	}
+}
+
+func TestStreamPacingRenumbersResponsesEvents(t *testing.T) {
+	withStreamPacingRule(t, "", "pacing-model", StreamPacingRule{MaxChars: 2})
+
+	upstream := "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"sequence_number\":3,\"delta\":\"abcde\"}\n\n" +
+		"event: response.completed\ndata: {\"type\":\"response.completed\",\"sequence_number\":4}\n\n"
+	out := readPaced(t, context.Background(), upstream, "pacing-model", StreamProtocolResponses)
+
+	var sequences []int
+	var text string
+	for _, line := range strings.Split(out, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Sequence int    `json:"sequence_number"`
+			Delta    string `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		sequences = append(sequences, event.Sequence)
+		text += event.Delta
+	}
+	if text != "abcde" || len(sequences) != 4 || sequences[0] != 3 || sequences[3] != 6 {
+		t.Errorf("text=%q sequences=%v\n%s", text, sequences, out)
+	}
+	if strings.Count(out, "event: response.output_text.delta\n") != 3 {
+		t.Errorf("split events lack event lines:\n%s", out)
+	}
+}
+
+func TestStreamPacingKeyRuleSpacesDeltas(t *testing.T) {
+	const key = "sk-zen-pacing-0123456789"
+	withStreamPacingRule(t, "", "pacing-model", StreamPacingRule{MaxChars: 100})
+	withStreamPacingRule(t, key, "", StreamPacingRule{MaxChars: 1, MinIntervalMs: 20})
+
+	chunk := func(text string) string {
+		return "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"" + text + "\"},\"finish_reason\":null}]}\n\n"
+	}
+	upstream := chunk("abc") + "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" + "data: [DONE]\n\n"
+
+	start := time.Now()
+	out := readPaced(t, WithAPIKey(context.Background(), key), upstream, "pacing-model", StreamProtocolChat)
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 deltas took %v, want at least 2 intervals", elapsed)
+	}
+	if strings.Count(out, `"content":`) != 3 || !strings.HasSuffix(out, "data: [DONE]\n\n") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+func TestSetStreamPacingRuleValidates(t *testing.T) {
+	for _, rule := range []StreamPacingRule{{MaxChars: -1}, {MinIntervalMs: -1}, {MinIntervalMs: 5000}} {
+		if err := SetStreamPacingRule("", "", rule); err == nil {
+			t.Errorf("%+v accepted", rule)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingWriter 第 failAfter 次写入起返回错误，模拟客户端断开
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	writes    int
+	failAfter int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes >= w.failAfter {
+		return 0, errors.New("write: broken pipe")
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+// endlessBody 无限产生 SSE 事件并统计被读取的次数
+type endlessBody struct {
+	reads  int
+	closed bool
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	b.reads++
+	return copy(p, "data: {\"delta\":\"x\"}\n\n"), nil
+}
+
+func (b *endlessBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// withStreamBackpressure 在测试期间使用指定的慢客户端处理设置
+func withStreamBackpressure(t *testing.T, settings StreamBackpressureSettings) {
+	t.Helper()
+	before := GetStreamBackpressureSettings()
+	if err := SetStreamBackpressureSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetStreamBackpressureSettings(before) })
+}
+
+func TestStreamResponseStopsOnClientWriteError(t *testing.T) {
+	// 同步转发，缓冲模式见 TestStreamBackpressureStopsOnClientWriteError
+	withStreamBackpressure(t, StreamBackpressureSettings{MaxLagSeconds: 60, DrainSeconds: 300})
+	logger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), logger)
+	body := &endlessBody{}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder(), failAfter: 3}
+
+	err := StreamResponse(ctx, w, resp)
+	if !errors.Is(err, ErrClientDisconnected) {
+		t.Fatalf("err = %v, want ErrClientDisconnected", err)
+	}
+	if w.writes != 3 {
+		t.Errorf("writes = %d, want to stop at first failure", w.writes)
+	}
+	if body.reads > 3 {
+		t.Errorf("kept reading upstream after disconnect: %d reads", body.reads)
+	}
+	if !strings.Contains(strings.Join(logger.texts(), "\n"), "client_disconnected") || !logger.hasError {
+		t.Errorf("client_disconnected not recorded: %v", logger.texts())
+	}
+}
+
+func TestSSEWriterDetectsCancelledRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	sse := NewSSEWriter(ctx, rec)
+	if err := sse.Printf("data: %s\n\n", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sse.Flush(); err != nil || !rec.Flushed {
+		t.Fatalf("flush: %v, flushed=%v", err, rec.Flushed)
+	}
+
+	cancel()
+	if err := sse.Printf("data: %s\n\n", "b"); !errors.Is(err, ErrClientDisconnected) {
+		t.Fatalf("err = %v, want ErrClientDisconnected", err)
+	}
+	if err := sse.Flush(); !errors.Is(err, ErrClientDisconnected) || sse.Err() != err {
+		t.Errorf("later calls should keep returning the first error: %v", err)
+	}
+	if got := rec.Body.String(); got != "data: a\n\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestStreamResponseCompletes(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader("data: 1\n\ndata: 2\n\n")),
+	}
+	rec := httptest.NewRecorder()
+	if err := StreamResponse(context.Background(), rec, resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.String() != "data: 1\n\ndata: 2\n\n" || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected response: %q %v", rec.Body.String(), rec.Header())
+	}
+}
+
+func TestStreamResponseSendsKeepAlivePings(t *testing.T) {
+	before := GetStreamKeepAliveSettings()
+	if err := SetStreamKeepAliveSettings(StreamKeepAliveSettings{IntervalSeconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetStreamKeepAliveSettings(before) })
+
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "data: a\n\n")
+		time.Sleep(1300 * time.Millisecond)
+		io.WriteString(pw, "event: b\n")
+		time.Sleep(1300 * time.Millisecond)
+		io.WriteString(pw, "data: b\n\n")
+		pw.Close()
+	}()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: pr}
+	rec := httptest.NewRecorder()
+	pings := streamKeepAlivePings.Load()
+	if err := StreamResponse(context.Background(), rec, resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// 事件之间写入完整的注释帧，事件中间只写注释行
+	if got := rec.Body.String(); got != "data: a\n\n: ping\n\nevent: b\n: ping\ndata: b\n\n" {
+		t.Errorf("body = %q", got)
+	}
+	if n := streamKeepAlivePings.Load() - pings; n != 2 {
+		t.Errorf("pings = %d, want 2", n)
+	}
+}
+
+// blockingWriter 在写入时阻塞，直到 release 被关闭
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestKeepAliveStopWaitsForPing(t *testing.T) {
+	before := GetStreamKeepAliveSettings()
+	if err := SetStreamKeepAliveSettings(StreamKeepAliveSettings{IntervalSeconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetStreamKeepAliveSettings(before) })
+
+	w := &blockingWriter{ResponseRecorder: httptest.NewRecorder(), writing: make(chan struct{}), release: make(chan struct{})}
+	stop := NewSSEWriter(context.Background(), w).KeepAlive()
+	<-w.writing
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned while ping was still writing")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(w.release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop did not return after ping finished")
+	}
+	if w.Body.String() != ": ping\n" && w.Body.String() != ": ping\n\n" {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// SystemPromptOptOutHeader 允许跳过模板的 Key 带 X-System-Prompt: off 时不注入系统提示词
+const SystemPromptOptOutHeader = "X-System-Prompt"
+
+// maxSystemPromptTemplate 单个 Key 前缀与后缀模板的总长度上限
+const maxSystemPromptTemplate = 16 * 1024
+
+const systemPromptContextKey contextKey = "system_prompt_template"
+
+// systemPromptTemplate 请求所用 API Key 的系统提示词模板
+type systemPromptTemplate struct {
+	prefix, suffix, keyName string
+}
+
+// WithSystemPromptTemplate 把 Key 配置的系统提示词模板写入 context，optOut 为 true 且 Key 允许时跳过
+func WithSystemPromptTemplate(ctx context.Context, key *model.APIKey, optOut bool) context.Context {
+	if key == nil || (key.SystemPromptPrefix == "" && key.SystemPromptSuffix == "") {
+		return ctx
+	}
+	if optOut {
+		if key.SystemPromptOptOut {
+			DebugLog(ctx, "[SystemPrompt] Key %s 跳过系统提示词模板", key.Prefix)
+			return ctx
+		}
+		DebugLog(ctx, "[SystemPrompt] Key %s 不允许跳过系统提示词模板，忽略 %s 头", key.Prefix, SystemPromptOptOutHeader)
+	}
+	return context.WithValue(ctx, systemPromptContextKey, systemPromptTemplate{
+		prefix:  key.SystemPromptPrefix,
+		suffix:  key.SystemPromptSuffix,
+		keyName: key.Name,
+	})
+}
+
+// renderSystemPrompt 替换模板中的 {date} 和 {key_name}，其余内容原样保留
+func renderSystemPrompt(tmpl, keyName string, now time.Time) string {
+	if tmpl == "" {
+		return ""
+	}
+	return strings.NewReplacer("{date}", now.Format("2006-01-02"), "{key_name}", keyName).Replace(tmpl)
+}
+
+// applySystemPromptTemplate 把 Key 的前缀和后缀注入 Anthropic 请求的 system：
+// 字符串形式用空行拼接，内容块形式在首尾各插入一个 text 块
+func applySystemPromptTemplate(ctx context.Context, body []byte) []byte {
+	tmpl, ok := ctx.Value(systemPromptContextKey).(systemPromptTemplate)
+	if !ok {
+		return body
+	}
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(body, &reqMap); err != nil {
+		return body
+	}
+
+	now := time.Now()
+	prefix := renderSystemPrompt(tmpl.prefix, tmpl.keyName, now)
+	suffix := renderSystemPrompt(tmpl.suffix, tmpl.keyName, now)
+
+	switch system := reqMap["system"].(type) {
+	case []interface{}:
+		blocks := make([]interface{}, 0, len(system)+2)
+		if prefix != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": prefix})
+		}
+		blocks = append(blocks, system...)
+		if suffix != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": suffix})
+		}
+		reqMap["system"] = blocks
+	default:
+		text, _ := system.(string)
+		var parts []string
+		for _, part := range []string{prefix, text, suffix} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		reqMap["system"] = strings.Join(parts, "\n\n")
+	}
+
+	modified, err := json.Marshal(reqMap)
+	if err != nil {
+		return body
+	}
+	DebugLog(ctx, "[SystemPrompt] 已注入 Key %s 的系统提示词模板", tmpl.keyName)
+	return modified
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestApplySystemPromptTemplate(t *testing.T) {
+	key := &model.APIKey{Name: "team-a", SystemPromptPrefix: "Policy for {key_name} on {date}.", SystemPromptSuffix: "Be brief."}
+	ctx := WithSystemPromptTemplate(context.Background(), key, false)
+	date := time.Now().Format("2006-01-02")
+
+	cases := []struct {
+		body string
+		want interface{}
+	}{
+		{`{"messages":[]}`, "Policy for team-a on " + date + ".\n\nBe brief."},
+		{`{"system":"You are helpful.","messages":[]}`, "Policy for team-a on " + date + ".\n\nYou are helpful.\n\nBe brief."},
+		{`{"system":[{"type":"text","text":"You are helpful.","cache_control":{"type":"ephemeral"}}],"messages":[]}`, []interface{}{
+			map[string]interface{}{"type": "text", "text": "Policy for team-a on " + date + "."},
+			map[string]interface{}{"type": "text", "text": "You are helpful.", "cache_control": map[string]interface{}{"type": "ephemeral"}},
+			map[string]interface{}{"type": "text", "text": "Be brief."},
+		}},
+	}
+	for _, tc := range cases {
+		var got map[string]interface{}
+		if err := json.Unmarshal(applySystemPromptTemplate(ctx, []byte(tc.body)), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got["system"], tc.want) {
+			t.Errorf("%s: system = %#v", tc.body, got["system"])
+		}
+	}
+
+	// 未配置模板或 Key 允许跳过时请求体不变
+	body := `{"system":"x","messages":[]}`
+	if out := applySystemPromptTemplate(context.Background(), []byte(body)); string(out) != body {
+		t.Errorf("no template: %s", out)
+	}
+	key.SystemPromptOptOut = true
+	if out := applySystemPromptTemplate(WithSystemPromptTemplate(context.Background(), key, true), []byte(body)); string(out) != body {
+		t.Errorf("opted out: %s", out)
+	}
+	// 不允许跳过的 Key 忽略请求头
+	key.SystemPromptOptOut = false
+	if out := applySystemPromptTemplate(WithSystemPromptTemplate(context.Background(), key, true), []byte(body)); string(out) == body {
+		t.Error("opt-out should be ignored for untrusted keys")
+	}
+}
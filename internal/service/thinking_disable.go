@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/model"
+)
+
+// 客户端明确关闭 thinking（thinking.type 为 disabled）而模型配置强制开启时的处理方式
+const (
+	ThinkingDisableClient = "client" // 客户端优先：改用同名的非 thinking 模型，没有时仍按模型配置开启并记录日志（默认）
+	ThinkingDisableStrict = "strict" // 与 client 相同，但没有非 thinking 模型时返回 400
+	ThinkingDisableModel  = "model"  // 模型配置优先：始终强制开启
+)
+
+var (
+	thinkingDisableMu     sync.RWMutex
+	thinkingDisablePolicy string
+	thinkingDisableOnce   sync.Once
+)
+
+func validThinkingDisablePolicy(policy string) bool {
+	switch policy {
+	case ThinkingDisableClient, ThinkingDisableStrict, ThinkingDisableModel:
+		return true
+	}
+	return false
+}
+
+// loadThinkingDisablePolicy 读取 THINKING_DISABLE_POLICY
+func loadThinkingDisablePolicy() {
+	policy := strings.ToLower(strings.TrimSpace(os.Getenv("THINKING_DISABLE_POLICY")))
+	if policy == "" {
+		policy = ThinkingDisableClient
+	} else if !validThinkingDisablePolicy(policy) {
+		log.Printf("[WARN] 无效的 THINKING_DISABLE_POLICY: %s，使用 %s", policy, ThinkingDisableClient)
+		policy = ThinkingDisableClient
+	}
+	thinkingDisablePolicy = policy
+}
+
+// GetThinkingDisablePolicy 获取客户端关闭 thinking 时的处理方式
+func GetThinkingDisablePolicy() string {
+	thinkingDisableOnce.Do(loadThinkingDisablePolicy)
+	thinkingDisableMu.RLock()
+	defer thinkingDisableMu.RUnlock()
+	return thinkingDisablePolicy
+}
+
+// SetThinkingDisablePolicy 运行时修改客户端关闭 thinking 时的处理方式（仅内存生效）
+func SetThinkingDisablePolicy(policy string) error {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if !validThinkingDisablePolicy(policy) {
+		return fmt.Errorf("policy 只能为 client、strict 或 model")
+	}
+	thinkingDisableOnce.Do(loadThinkingDisablePolicy)
+	thinkingDisableMu.Lock()
+	thinkingDisablePolicy = policy
+	thinkingDisableMu.Unlock()
+	log.Printf("[ThinkingDisable] 客户端关闭 thinking 的处理方式已调整为 %s", policy)
+	return nil
+}
+
+// clientDisablesThinking 请求中是否明确关闭了 thinking，未传 thinking 不算
+func clientDisablesThinking(thinking map[string]interface{}) bool {
+	if thinking == nil {
+		return false
+	}
+	if thinkingType, ok := thinking["type"].(string); ok && thinkingType == "disabled" {
+		return true
+	}
+	enabled, ok := thinking["enabled"].(bool)
+	return ok && !enabled
+}
+
+// modelForcesThinking 模型配置是否强制开启 thinking
+func modelForcesThinking(zenModel model.ZenModel) bool {
+	return zenModel.Parameters != nil && zenModel.Parameters.Thinking != nil
+}
+
+// resolveThinkingDisabled 客户端明确关闭 thinking 而模型强制开启时，按策略返回实际使用的模型：
+// 优先改用去掉 -thinking 后缀的非 thinking 模型；strict 策略下没有可用的模型时返回 *InvalidRequestError
+func resolveThinkingDisabled(modelID string, thinking map[string]interface{}) (string, error) {
+	if !clientDisablesThinking(thinking) {
+		return modelID, nil
+	}
+	zenModel, ok := model.GetZenModel(modelID)
+	if !ok || !modelForcesThinking(zenModel) {
+		return modelID, nil
+	}
+	policy := GetThinkingDisablePolicy()
+	if policy == ThinkingDisableModel {
+		return modelID, nil
+	}
+
+	if base := strings.TrimSuffix(modelID, "-thinking"); base != modelID {
+		if baseModel, ok := model.GetZenModel(base); ok && !modelForcesThinking(baseModel) {
+			log.Printf("[Anthropic] 客户端关闭了 thinking，%s 改用非 thinking 模型 %s", modelID, base)
+			return base, nil
+		}
+	}
+	if policy == ThinkingDisableStrict {
+		return "", &InvalidRequestError{
+			Message: fmt.Sprintf("thinking: model %s requires extended thinking and has no non-thinking variant; remove thinking.type=disabled or choose another model", modelID),
+			Param:   "thinking",
+		}
+	}
+	log.Printf("[Anthropic] 客户端关闭了 thinking，但 %s 没有非 thinking 模型，仍按模型配置开启", modelID)
+	return modelID, nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveThinkingDisabled(t *testing.T) {
+	t.Cleanup(func() { SetThinkingDisablePolicy(ThinkingDisableClient) })
+	disabled := map[string]interface{}{"type": "disabled"}
+
+	tests := []struct {
+		policy   string
+		model    string
+		thinking map[string]interface{}
+		want     string
+		invalid  bool
+	}{
+		// 客户端优先：改用非 thinking 模型
+		{ThinkingDisableClient, "claude-sonnet-4-5-20250929-thinking", disabled, "claude-sonnet-4-5-20250929", false},
+		{ThinkingDisableClient, "claude-sonnet-4-5-20250929-thinking", map[string]interface{}{"enabled": false}, "claude-sonnet-4-5-20250929", false},
+		// 未传或开启 thinking 时不改
+		{ThinkingDisableClient, "claude-sonnet-4-5-20250929-thinking", nil, "claude-sonnet-4-5-20250929-thinking", false},
+		{ThinkingDisableClient, "claude-sonnet-4-5-20250929-thinking", map[string]interface{}{"type": "enabled"}, "claude-sonnet-4-5-20250929-thinking", false},
+		// 非 thinking 版本同样强制 thinking 时无法满足
+		{ThinkingDisableClient, "claude-haiku-4-5-20251001-thinking", disabled, "claude-haiku-4-5-20251001-thinking", false},
+		{ThinkingDisableStrict, "claude-haiku-4-5-20251001-thinking", disabled, "", true},
+		{ThinkingDisableStrict, "claude-sonnet-4-5-20250929-thinking", disabled, "claude-sonnet-4-5-20250929", false},
+		// 模型本身不强制 thinking
+		{ThinkingDisableStrict, "claude-sonnet-4-5-20250929", disabled, "claude-sonnet-4-5-20250929", false},
+		// 模型配置优先
+		{ThinkingDisableModel, "claude-sonnet-4-5-20250929-thinking", disabled, "claude-sonnet-4-5-20250929-thinking", false},
+	}
+	for _, tc := range tests {
+		if err := SetThinkingDisablePolicy(tc.policy); err != nil {
+			t.Fatal(err)
+		}
+		got, err := resolveThinkingDisabled(tc.model, tc.thinking)
+		var invalid *InvalidRequestError
+		if tc.invalid != errors.As(err, &invalid) || got != tc.want {
+			t.Errorf("%s %s %v: got %q, %v; want %q (invalid=%v)", tc.policy, tc.model, tc.thinking, got, err, tc.want, tc.invalid)
+		}
+	}
+
+	if SetThinkingDisablePolicy("always") == nil {
+		t.Error("invalid policy accepted")
+	}
+}
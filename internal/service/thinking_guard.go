@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/model"
+)
+
+// ThinkingGuardHeader 思考过长被截断、以较小预算重试时带此头，值为重试使用的 budget_tokens
+const ThinkingGuardHeader = "X-Thinking-Truncated"
+
+// thinkingBudgetContextKey 重试时 thinking.budget_tokens 的上限
+const thinkingBudgetContextKey contextKey = "thinking_budget"
+
+// minThinkingBudget Anthropic 要求的最小 budget_tokens
+const minThinkingBudget = 1024
+
+var (
+	thinkingLimitsMu   sync.RWMutex
+	thinkingLimits     map[string]int
+	thinkingLimitsOnce sync.Once
+)
+
+func loadThinkingLimits() {
+	thinkingLimits = parseThinkingLimits(os.Getenv("THINKING_TOKEN_LIMITS"))
+}
+
+// parseThinkingLimits 解析每个模型允许的最大思考 token 数
+// 格式: model=tokens，逗号分隔，例如 claude-opus-4-1-20250805-thinking=16000
+func parseThinkingLimits(raw string) map[string]int {
+	result := make(map[string]int)
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return result
+	}
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			log.Printf("[WARN] THINKING_TOKEN_LIMITS 中的配置无效，已忽略: %s", item)
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || n <= 0 {
+			log.Printf("[WARN] THINKING_TOKEN_LIMITS 中 %s 的值无效: %s", parts[0], parts[1])
+			continue
+		}
+		result[strings.TrimSpace(parts[0])] = n
+	}
+	return result
+}
+
+// ThinkingTokenLimit 返回模型流式响应中允许的最大思考 token 数，0 表示不限制
+// 未单独配置 -thinking 模型时使用原模型的配置
+func ThinkingTokenLimit(modelID string) int {
+	thinkingLimitsOnce.Do(loadThinkingLimits)
+	thinkingLimitsMu.RLock()
+	defer thinkingLimitsMu.RUnlock()
+	if n, ok := thinkingLimits[modelID]; ok {
+		return n
+	}
+	return thinkingLimits[strings.TrimSuffix(modelID, "-thinking")]
+}
+
+// GetThinkingTokenLimits 返回按模型配置的最大思考 token 数副本
+func GetThinkingTokenLimits() map[string]int {
+	thinkingLimitsOnce.Do(loadThinkingLimits)
+	thinkingLimitsMu.RLock()
+	defer thinkingLimitsMu.RUnlock()
+
+	result := make(map[string]int, len(thinkingLimits))
+	for k, v := range thinkingLimits {
+		result[k] = v
+	}
+	return result
+}
+
+// SetThinkingTokenLimit 运行时修改模型的最大思考 token 数（仅内存生效，重启后以环境变量为准），0 时删除
+func SetThinkingTokenLimit(modelID string, limit int) error {
+	if _, ok := model.GetZenModel(modelID); !ok {
+		return fmt.Errorf("unknown model: %s", modelID)
+	}
+	if limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+
+	thinkingLimitsOnce.Do(loadThinkingLimits)
+	thinkingLimitsMu.Lock()
+	defer thinkingLimitsMu.Unlock()
+	if limit == 0 {
+		delete(thinkingLimits, modelID)
+		return nil
+	}
+	thinkingLimits[modelID] = limit
+	return nil
+}
+
+// capThinkingBudget 重试时把 thinking.budget_tokens 降到上下文中的上限
+func capThinkingBudget(ctx context.Context, body []byte) []byte {
+	budget, ok := ctx.Value(thinkingBudgetContextKey).(int)
+	if !ok {
+		return body
+	}
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(body, &reqMap); err != nil {
+		return body
+	}
+	thinking, ok := reqMap["thinking"].(map[string]interface{})
+	if !ok {
+		return body
+	}
+	if current, ok := thinking["budget_tokens"].(float64); ok && int(current) <= budget {
+		return body
+	}
+	thinking["budget_tokens"] = budget
+	if modified, err := json.Marshal(reqMap); err == nil {
+		return modified
+	}
+	return body
+}
+
+// guardThinkingStream 缓冲流式响应开头的 thinking 块，思考 token 数（按 4 字节一个 token 估算）
+// 超过模型的上限时中断该请求，以一半的预算（不低于 1024）重试一次，并在响应头中提示客户端
+// 出现非 thinking 的内容块后写出缓冲内容，之后照常透传；未配置上限时原样返回
+func (s *AnthropicService) guardThinkingStream(ctx context.Context, w http.ResponseWriter, resp *http.Response, body []byte, modelID string) (*http.Response, error) {
+	limit := ThinkingTokenLimit(modelID)
+	if limit <= 0 {
+		return resp, nil
+	}
+
+	var buf bytes.Buffer
+	reader := bufio.NewReader(resp.Body)
+	thinkingBytes := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		buf.Write(line)
+		if err != nil {
+			break
+		}
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type         string `json:"type"`
+			ContentBlock struct {
+				Type string `json:"type"`
+			} `json:"content_block"`
+			Delta struct {
+				Thinking string `json:"thinking"`
+			} `json:"delta"`
+		}
+		if json.Unmarshal(bytes.TrimSpace(data), &event) != nil {
+			continue
+		}
+
+		if event.Type == "content_block_start" {
+			if t := event.ContentBlock.Type; t != "thinking" && t != "redacted_thinking" {
+				break
+			}
+			continue
+		}
+		if event.Type == "message_delta" || event.Type == "message_stop" {
+			break
+		}
+		if event.Type != "content_block_delta" {
+			continue
+		}
+		thinkingBytes += len(event.Delta.Thinking)
+		if (thinkingBytes+3)/4 <= limit {
+			continue
+		}
+
+		resp.Body.Close()
+		budget := max(minThinkingBudget, limit/2)
+		log.Printf("[Anthropic] 模型 %s 思考超过 %d token，中断并以 budget_tokens=%d 重试", modelID, limit, budget)
+		retried, err := s.Messages(context.WithValue(ctx, thinkingBudgetContextKey, budget), body, true)
+		if err != nil {
+			return nil, err
+		}
+		if retried.StatusCode < 400 {
+			w.Header().Set(ThinkingGuardHeader, strconv.Itoa(budget))
+			w.Header().Add("Warning", fmt.Sprintf(`199 - "thinking exceeded %d tokens, retried with budget_tokens=%d"`, limit, budget))
+		}
+		return retried, nil
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&buf, reader), resp.Body}
+	return resp, nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+// knownProviders 支持配置超时的服务商
+var knownProviders = map[string]bool{
+	"anthropic": true,
+	"gemini":    true,
+	"openai":    true,
+	"xai":       true,
+}
+
+var (
+	providerTimeoutsMu    sync.RWMutex
+	providerTimeouts      map[string]model.TimeoutConfig
+	providerTimeoutsOnce  sync.Once
+	modelTimeoutOverrides = make(map[string]model.TimeoutConfig)
+)
+
+// loadProviderTimeouts 从 PROVIDER_TIMEOUTS 读取服务商默认超时
+func loadProviderTimeouts() {
+	providerTimeouts = parseProviderTimeouts(os.Getenv("PROVIDER_TIMEOUTS"))
+	if len(providerTimeouts) > 0 {
+		log.Printf("[INFO] 已加载 %d 个服务商超时配置", len(providerTimeouts))
+	}
+}
+
+// parseProviderTimeouts 解析服务商超时配置
+// 格式: provider=connect/ttfb/total (秒)，逗号分隔，例如 xai=5/20/120,anthropic=10/300/1200
+func parseProviderTimeouts(raw string) map[string]model.TimeoutConfig {
+	result := make(map[string]model.TimeoutConfig)
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return result
+	}
+
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		providerID := strings.ToLower(strings.TrimSpace(parts[0]))
+		if !knownProviders[providerID] {
+			log.Printf("[WARN] PROVIDER_TIMEOUTS 中的服务商未知，已忽略: %s", parts[0])
+			continue
+		}
+		values := strings.Split(parts[1], "/")
+		seconds := make([]int, 3)
+		for i := 0; i < len(values) && i < 3; i++ {
+			n, err := strconv.Atoi(strings.TrimSpace(values[i]))
+			if err != nil || n < 0 {
+				log.Printf("[WARN] PROVIDER_TIMEOUTS 中 %s 的值无效: %s", parts[0], parts[1])
+				n = 0
+			}
+			seconds[i] = n
+		}
+		result[providerID] = model.TimeoutConfig{
+			ConnectSeconds: seconds[0],
+			TTFBSeconds:    seconds[1],
+			TotalSeconds:   seconds[2],
+		}
+	}
+	return result
+}
+
+// GetProviderTimeouts 返回服务商默认超时配置副本
+func GetProviderTimeouts() map[string]model.TimeoutConfig {
+	providerTimeoutsOnce.Do(loadProviderTimeouts)
+	providerTimeoutsMu.RLock()
+	defer providerTimeoutsMu.RUnlock()
+
+	result := make(map[string]model.TimeoutConfig, len(providerTimeouts))
+	for k, v := range providerTimeouts {
+		result[k] = v
+	}
+	return result
+}
+
+// SetProviderTimeouts 运行时修改服务商默认超时，全部为0时删除该配置
+func SetProviderTimeouts(providerID string, cfg model.TimeoutConfig) error {
+	providerID = strings.ToLower(strings.TrimSpace(providerID))
+	if !knownProviders[providerID] {
+		return fmt.Errorf("unknown provider: %s", providerID)
+	}
+
+	providerTimeoutsOnce.Do(loadProviderTimeouts)
+	providerTimeoutsMu.Lock()
+	defer providerTimeoutsMu.Unlock()
+
+	if isZeroTimeouts(cfg) {
+		delete(providerTimeouts, providerID)
+		return nil
+	}
+	providerTimeouts[providerID] = cfg
+	return nil
+}
+
+// SetModelTimeouts 运行时修改单个模型的超时，全部为0时恢复模型默认值
+// 覆盖会在每次模型同步后重新应用
+func SetModelTimeouts(modelID string, cfg model.TimeoutConfig) error {
+	if _, ok := model.GetZenModel(modelID); !ok {
+		return fmt.Errorf("unknown model: %s", modelID)
+	}
+
+	providerTimeoutsMu.Lock()
+	if isZeroTimeouts(cfg) {
+		delete(modelTimeoutOverrides, modelID)
+	} else {
+		modelTimeoutOverrides[modelID] = cfg
+	}
+	providerTimeoutsMu.Unlock()
+
+	defaults := model.DefaultZenModels()
+	model.UpdateZenModels(func(models map[string]model.ZenModel) {
+		m, ok := models[modelID]
+		if !ok {
+			return
+		}
+		if isZeroTimeouts(cfg) {
+			m.Timeouts = nil
+			if tpl, ok := defaults[modelID]; ok {
+				m.Timeouts = tpl.Timeouts
+			}
+		} else {
+			m.Timeouts = &cfg
+		}
+		models[modelID] = m
+	})
+	return nil
+}
+
+// applyModelTimeoutOverrides 把运行时的模型超时覆盖应用到新同步的模型集
+func applyModelTimeoutOverrides(models map[string]model.ZenModel) {
+	providerTimeoutsMu.RLock()
+	defer providerTimeoutsMu.RUnlock()
+
+	for modelID, cfg := range modelTimeoutOverrides {
+		if m, ok := models[modelID]; ok {
+			cfg := cfg
+			m.Timeouts = &cfg
+			models[modelID] = m
+		}
+	}
+}
+
+func isZeroTimeouts(cfg model.TimeoutConfig) bool {
+	return cfg.ConnectSeconds == 0 && cfg.TTFBSeconds == 0 && cfg.TotalSeconds == 0
+}
+
+func toProviderTimeouts(cfg model.TimeoutConfig) provider.Timeouts {
+	return provider.Timeouts{
+		Connect: time.Duration(cfg.ConnectSeconds) * time.Second,
+		TTFB:    time.Duration(cfg.TTFBSeconds) * time.Second,
+		Total:   time.Duration(cfg.TotalSeconds) * time.Second,
+	}
+}
+
+// ResolveTimeouts 计算模型的实际超时：模型配置 > 服务商默认 > 全局默认
+func ResolveTimeouts(modelID string) provider.Timeouts {
+	zenModel, exists := model.GetZenModel(modelID)
+	if !exists {
+		return provider.Timeouts{}
+	}
+	return resolveZenModelTimeouts(zenModel)
+}
+
+func resolveZenModelTimeouts(zenModel model.ZenModel) provider.Timeouts {
+	var result provider.Timeouts
+	if cfg, ok := GetProviderTimeouts()[zenModel.ProviderID]; ok {
+		result = toProviderTimeouts(cfg)
+	}
+	if zenModel.Timeouts != nil {
+		result = result.Merge(toProviderTimeouts(*zenModel.Timeouts))
+	}
+	return result
+}
+
+// newUpstreamClient 按模型超时配置创建上游HTTP客户端
+func newUpstreamClient(proxy string, zenModel model.ZenModel) *http.Client {
+	return provider.NewHTTPClientWithTimeouts(proxy, resolveZenModelTimeouts(zenModel))
+}
+
+// newUpstreamProxyClient 使用指定代理创建带模型超时的客户端
+func newUpstreamProxyClient(proxyURL string, zenModel model.ZenModel) (*http.Client, error) {
+	timeouts := resolveZenModelTimeouts(zenModel)
+	client, err := provider.NewHTTPClientWithProxy(proxyURL, timeouts.Total)
+	if err != nil {
+		return nil, err
+	}
+	return provider.ApplyTimeouts(client, timeouts), nil
+}
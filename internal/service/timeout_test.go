@@ -0,0 +1,132 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+func TestParseProviderTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want map[string]model.TimeoutConfig
+	}{
+		{"empty", "", map[string]model.TimeoutConfig{}},
+		{"single", "xai=5/20/120", map[string]model.TimeoutConfig{
+			"xai": {ConnectSeconds: 5, TTFBSeconds: 20, TotalSeconds: 120},
+		}},
+		{"multiple with spaces and case", " xai=5/20/120 , Anthropic = 10/300/1200", map[string]model.TimeoutConfig{
+			"xai":       {ConnectSeconds: 5, TTFBSeconds: 20, TotalSeconds: 120},
+			"anthropic": {ConnectSeconds: 10, TTFBSeconds: 300, TotalSeconds: 1200},
+		}},
+		{"partial values", "gemini=3", map[string]model.TimeoutConfig{
+			"gemini": {ConnectSeconds: 3},
+		}},
+		{"invalid values become zero", "openai=a/-1/60", map[string]model.TimeoutConfig{
+			"openai": {TotalSeconds: 60},
+		}},
+		{"unknown provider and malformed items skipped", "foo=1/2/3,=1/2/3,xai,openai=1/2/3", map[string]model.TimeoutConfig{
+			"openai": {ConnectSeconds: 1, TTFBSeconds: 2, TotalSeconds: 3},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseProviderTimeouts(tt.raw)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %+v, want %+v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveTimeoutsPrecedence(t *testing.T) {
+	defer model.ResetZenModelsToDefault()
+	defer func() {
+		for id := range knownProviders {
+			SetProviderTimeouts(id, model.TimeoutConfig{})
+		}
+	}()
+
+	if err := SetProviderTimeouts("xai", model.TimeoutConfig{ConnectSeconds: 1, TTFBSeconds: 2, TotalSeconds: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProviderTimeouts("anthropic", model.TimeoutConfig{ConnectSeconds: 4, TTFBSeconds: 5, TotalSeconds: 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	// grok-code-fast-1 自带完整超时，模型配置优先
+	if got, want := ResolveTimeouts("grok-code-fast-1"), (provider.Timeouts{Connect: 5 * time.Second, TTFB: 20 * time.Second, Total: 120 * time.Second}); got != want {
+		t.Errorf("grok-code-fast-1 = %+v, want %+v", got, want)
+	}
+	// opus thinking 只配置了 TTFB/Total，连接超时回落到服务商默认
+	if got, want := ResolveTimeouts("claude-opus-4-5-20251101-thinking"), (provider.Timeouts{Connect: 4 * time.Second, TTFB: 300 * time.Second, Total: 1800 * time.Second}); got != want {
+		t.Errorf("opus thinking = %+v, want %+v", got, want)
+	}
+	// 没有模型配置时使用服务商默认
+	if got, want := ResolveTimeouts("claude-sonnet-4-5-20250929"), (provider.Timeouts{Connect: 4 * time.Second, TTFB: 5 * time.Second, Total: 6 * time.Second}); got != want {
+		t.Errorf("sonnet = %+v, want %+v", got, want)
+	}
+	// 未知模型使用全局默认
+	if got := ResolveTimeouts("no-such-model"); got != (provider.Timeouts{}) {
+		t.Errorf("unknown model = %+v, want zero", got)
+	}
+
+	if err := SetProviderTimeouts("nope", model.TimeoutConfig{TotalSeconds: 1}); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+func TestSetModelTimeoutsSurvivesSync(t *testing.T) {
+	defer model.ResetZenModelsToDefault()
+	const id = "claude-sonnet-4-5-20250929"
+	defer SetModelTimeouts(id, model.TimeoutConfig{})
+
+	if err := SetModelTimeouts(id, model.TimeoutConfig{TotalSeconds: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ResolveTimeouts(id).Total; got != 42*time.Second {
+		t.Fatalf("Total = %s, want 42s", got)
+	}
+
+	// 模拟模型同步：新模型集来自默认模板，覆盖需要重新应用
+	synced := model.DefaultZenModels()
+	applyModelTimeoutOverrides(synced)
+	model.ReplaceZenModels(synced)
+	if got := ResolveTimeouts(id).Total; got != 42*time.Second {
+		t.Errorf("after sync Total = %s, want 42s", got)
+	}
+
+	if err := SetModelTimeouts(id, model.TimeoutConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := model.GetZenModel(id); m.Timeouts != nil {
+		t.Errorf("reset left timeouts %+v", m.Timeouts)
+	}
+	if err := SetModelTimeouts("no-such-model", model.TimeoutConfig{TotalSeconds: 1}); err == nil {
+		t.Error("expected error for unknown model")
+	}
+}
+
+func TestBuildThinkingAliasTimeouts(t *testing.T) {
+	base := model.ZenModel{ID: "claude-new-1", DisplayName: "Claude New", Model: "claude-new-1", ProviderID: "anthropic"}
+
+	alias := buildThinkingAlias("claude-new-1", map[string]model.ZenModel{}, base)
+	if alias.Timeouts == nil || *alias.Timeouts != *model.ThinkingTimeouts() {
+		t.Errorf("alias timeouts = %+v, want thinking timeouts", alias.Timeouts)
+	}
+
+	base.Timeouts = &model.TimeoutConfig{TotalSeconds: 99}
+	alias = buildThinkingAlias("claude-new-1", map[string]model.ZenModel{}, base)
+	if alias.Timeouts == nil || alias.Timeouts.TotalSeconds != 99 {
+		t.Errorf("alias should inherit base timeouts, got %+v", alias.Timeouts)
+	}
+}
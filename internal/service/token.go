@@ -10,7 +10,6 @@ import (
 	"strings"
 	"time"
 
-	"zencoder2api/internal/database"
 	"zencoder2api/internal/model"
 )
 
@@ -81,7 +80,7 @@ func RefreshToken(account *model.Account) (string, error) {
 		if isAccountLockoutError(resp.StatusCode, string(body)) {
 			// 将账号标记为封禁状态
 			if markErr := markAccountAsBanned(account, "OAuth认证失败-用户被锁定: "+string(body)); markErr != nil {
-				log.Printf("[账号管理] 标记账号封禁状态失败: %v", markErr)
+				log.Printf("[WARN] [账号管理] 标记账号封禁状态失败: %v", markErr)
 			}
 			return "", &AccountLockoutError{
 				StatusCode: resp.StatusCode,
@@ -102,7 +101,7 @@ func RefreshToken(account *model.Account) (string, error) {
 
 	// 只有已存在的账号才保存到数据库
 	if account.ID > 0 {
-		database.GetDB().Save(account)
+		saveAccount(account)
 	}
 
 	// 显式关闭传输层，确保连接被清理
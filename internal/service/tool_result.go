@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	toolResultMaxBytes     int
+	toolResultMaxBytesOnce sync.Once
+)
+
+// GetToolResultMaxBytes 读取 TOOL_RESULT_MAX_BYTES，0 表示不截断（默认）
+func GetToolResultMaxBytes() int {
+	toolResultMaxBytesOnce.Do(func() {
+		raw := strings.TrimSpace(os.Getenv("TOOL_RESULT_MAX_BYTES"))
+		if raw == "" {
+			return
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			log.Printf("[WARN] 无效的 TOOL_RESULT_MAX_BYTES: %s，已忽略", raw)
+			return
+		}
+		toolResultMaxBytes = n
+	})
+	return toolResultMaxBytes
+}
+
+// applyToolResultLimit 按配置截断过大的 tool_result，避免整个请求因 413 失败
+func applyToolResultLimit(ctx context.Context, body []byte) []byte {
+	limit := GetToolResultMaxBytes()
+	if limit <= 0 {
+		return body
+	}
+	modified, truncated := truncateToolResults(body, limit)
+	if truncated > 0 {
+		DebugLog(ctx, "[Anthropic] tool_result 超过 %d 字节，共截断 %d 字节", limit, truncated)
+	}
+	return modified
+}
+
+// truncateToolResults 把每个 tool_result 的文本内容截断到 limit 字节，并追加 "[truncated N bytes]" 标记
+// 返回修改后的请求体和总共截断的字节数，无需截断时原样返回
+func truncateToolResults(body []byte, limit int) ([]byte, int) {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(body, &reqMap); err != nil {
+		return body, 0
+	}
+	messages, ok := reqMap["messages"].([]interface{})
+	if !ok {
+		return body, 0
+	}
+
+	total := 0
+	for _, msg := range messages {
+		msgMap, ok := msg.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		blocks, ok := msgMap["content"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, block := range blocks {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok || blockMap["type"] != "tool_result" {
+				continue
+			}
+			total += truncateToolResultContent(blockMap, limit)
+		}
+	}
+	if total == 0 {
+		return body, 0
+	}
+
+	modified, err := json.Marshal(reqMap)
+	if err != nil {
+		return body, 0
+	}
+	return modified, total
+}
+
+// truncateToolResultContent 截断单个 tool_result，content 可以是字符串或内容块数组
+// 数组中的文本块共享 limit，超出部分的文本块被丢弃，图片等其他块保留
+func truncateToolResultContent(block map[string]interface{}, limit int) int {
+	switch content := block["content"].(type) {
+	case string:
+		if len(content) <= limit {
+			return 0
+		}
+		kept := truncateUTF8(content, limit)
+		dropped := len(content) - len(kept)
+		block["content"] = kept + truncatedMarker(dropped)
+		return dropped
+
+	case []interface{}:
+		remaining := limit
+		dropped := 0
+		var marked map[string]interface{}
+		result := make([]interface{}, 0, len(content))
+		for _, item := range content {
+			itemMap, ok := item.(map[string]interface{})
+			text, isText := itemMap["text"].(string)
+			if !ok || itemMap["type"] != "text" || !isText {
+				result = append(result, item)
+				continue
+			}
+			if marked != nil {
+				dropped += len(text)
+				continue
+			}
+			if len(text) <= remaining {
+				remaining -= len(text)
+				result = append(result, item)
+				continue
+			}
+			kept := truncateUTF8(text, remaining)
+			dropped += len(text) - len(kept)
+			itemMap["text"] = kept
+			marked = itemMap
+			result = append(result, item)
+		}
+		if marked == nil {
+			return 0
+		}
+		marked["text"] = marked["text"].(string) + truncatedMarker(dropped)
+		block["content"] = result
+		return dropped
+	}
+	return 0
+}
+
+// truncateUTF8 截断到不超过 n 字节，且不切断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func truncatedMarker(n int) string {
+	return fmt.Sprintf("\n[truncated %d bytes]", n)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decodeToolResult(t *testing.T, body []byte) interface{} {
+	t.Helper()
+	var req struct {
+		Messages []struct {
+			Content []map[string]interface{} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return req.Messages[0].Content[0]["content"]
+}
+
+func TestTruncateToolResultsString(t *testing.T) {
+	body := `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"` + strings.Repeat("a", 100) + `"}]}]}`
+
+	got, n := truncateToolResults([]byte(body), 40)
+	if n != 60 {
+		t.Fatalf("truncated = %d, want 60", n)
+	}
+	want := strings.Repeat("a", 40) + "\n[truncated 60 bytes]"
+	if content := decodeToolResult(t, got); content != want {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestTruncateToolResultsBlocks(t *testing.T) {
+	body := `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[` +
+		`{"type":"text","text":"` + strings.Repeat("a", 30) + `"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"x"}},` +
+		`{"type":"text","text":"` + strings.Repeat("b", 30) + `"},` +
+		`{"type":"text","text":"` + strings.Repeat("c", 30) + `"}]}]}]}`
+
+	got, n := truncateToolResults([]byte(body), 40)
+	if n != 50 {
+		t.Fatalf("truncated = %d, want 50", n)
+	}
+	blocks := decodeToolResult(t, got).([]interface{})
+	if len(blocks) != 3 {
+		t.Fatalf("blocks = %d, want 3 (text, image, truncated text)", len(blocks))
+	}
+	last := blocks[2].(map[string]interface{})["text"]
+	if last != strings.Repeat("b", 10)+"\n[truncated 50 bytes]" {
+		t.Errorf("last text = %q", last)
+	}
+}
+
+func TestTruncateToolResultsUnchanged(t *testing.T) {
+	body := `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"short"},{"type":"text","text":"` + strings.Repeat("x", 100) + `"}]}]}`
+
+	got, n := truncateToolResults([]byte(body), 40)
+	if n != 0 || string(got) != body {
+		t.Errorf("expected body untouched, truncated %d", n)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	if got := truncateUTF8("你好世界", 4); got != "你" {
+		t.Errorf("got %q, want 你", got)
+	}
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InvalidRequestError 请求本身有误，应以 400 返回给客户端而不是重试
+type InvalidRequestError struct {
+	Message string
+	Param   string // 出错的参数路径，如 messages.0.content，未知时为空
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Message
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return &InvalidRequestError{Message: fmt.Sprintf(format, args...)}
+}
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// jsonSchemaTypes JSON Schema 允许的 type 取值
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// ToolLimits 工具定义的大小限制，0 表示不限制
+type ToolLimits struct {
+	MaxBytes            int // tools 数组序列化后的总大小
+	MaxDescriptionBytes int // schema 内的 description 超过该大小时删除，工具本身的 description 截断
+}
+
+var (
+	toolLimits     ToolLimits
+	toolLimitsOnce sync.Once
+)
+
+// GetToolLimits 读取 ANTHROPIC_TOOLS_MAX_BYTES 和 ANTHROPIC_TOOL_DESCRIPTION_MAX_BYTES
+func GetToolLimits() ToolLimits {
+	toolLimitsOnce.Do(func() {
+		toolLimits.MaxBytes = envNonNegativeInt("ANTHROPIC_TOOLS_MAX_BYTES")
+		toolLimits.MaxDescriptionBytes = envNonNegativeInt("ANTHROPIC_TOOL_DESCRIPTION_MAX_BYTES")
+	})
+	return toolLimits
+}
+
+func envNonNegativeInt(name string) int {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("[WARN] 无效的 %s: %s，已忽略", name, raw)
+		return 0
+	}
+	return n
+}
+
+// applyToolValidation 转发前检查 tools 定义，出错时返回指向具体工具的 InvalidRequestError
+func applyToolValidation(ctx context.Context, body []byte) ([]byte, error) {
+	modified, trimmed, err := validateTools(body, GetToolLimits())
+	if err != nil {
+		DebugLog(ctx, "[Anthropic] tools 校验失败: %v", err)
+		return nil, err
+	}
+	if trimmed > 0 {
+		DebugLog(ctx, "[Anthropic] 精简了 %d 个过大的 tools description", trimmed)
+	}
+	return modified, nil
+}
+
+// validateTools 校验 tools 数组：名称、重名、input_schema 结构及总大小
+// 配置了 MaxDescriptionBytes 时精简过大的 description，返回被精简的数量
+func validateTools(body []byte, limits ToolLimits) ([]byte, int, error) {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(body, &reqMap); err != nil {
+		return body, 0, nil
+	}
+	rawTools, exists := reqMap["tools"]
+	if !exists || rawTools == nil {
+		return body, 0, nil
+	}
+	tools, ok := rawTools.([]interface{})
+	if !ok {
+		return nil, 0, invalidRequest("tools: must be an array")
+	}
+
+	names := make(map[string]int, len(tools))
+	for i, rawTool := range tools {
+		tool, ok := rawTool.(map[string]interface{})
+		if !ok {
+			return nil, 0, invalidRequest("tools[%d]: must be an object", i)
+		}
+		name, _ := tool["name"].(string)
+		if !toolNamePattern.MatchString(name) {
+			return nil, 0, invalidRequest("tools[%d].name: %q must match %s", i, name, toolNamePattern)
+		}
+		if prev, dup := names[name]; dup {
+			return nil, 0, invalidRequest("tools[%d].name: %q duplicates tools[%d]", i, name, prev)
+		}
+		names[name] = i
+
+		// 服务端工具（如 web_search_20250305）没有 input_schema
+		if toolType, _ := tool["type"].(string); toolType != "" && toolType != "custom" {
+			continue
+		}
+		schema, ok := tool["input_schema"].(map[string]interface{})
+		if !ok {
+			return nil, 0, invalidRequest("tools[%d] (%s).input_schema: required object", i, name)
+		}
+		if schema["type"] != "object" {
+			return nil, 0, invalidRequest("tools[%d] (%s).input_schema.type: must be \"object\"", i, name)
+		}
+		if err := checkSchema(schema, fmt.Sprintf("tools[%d] (%s).input_schema", i, name)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	trimmed := 0
+	if limits.MaxDescriptionBytes > 0 {
+		for _, rawTool := range tools {
+			tool := rawTool.(map[string]interface{})
+			if desc, ok := tool["description"].(string); ok && len(desc) > limits.MaxDescriptionBytes {
+				tool["description"] = truncateUTF8(desc, limits.MaxDescriptionBytes)
+				trimmed++
+			}
+			if schema, ok := tool["input_schema"].(map[string]interface{}); ok {
+				trimmed += stripSchemaDescriptions(schema, limits.MaxDescriptionBytes)
+			}
+		}
+	}
+
+	if limits.MaxBytes > 0 {
+		encoded, _ := json.Marshal(tools)
+		if len(encoded) > limits.MaxBytes {
+			largest, largestSize := 0, 0
+			for i, tool := range tools {
+				b, _ := json.Marshal(tool)
+				if len(b) > largestSize {
+					largest, largestSize = i, len(b)
+				}
+			}
+			return nil, 0, invalidRequest("tools: total size %d bytes exceeds limit %d (largest is tools[%d] (%s) with %d bytes)",
+				len(encoded), limits.MaxBytes, largest, tools[largest].(map[string]interface{})["name"], largestSize)
+		}
+	}
+
+	if trimmed == 0 {
+		return body, 0, nil
+	}
+	modified, err := json.Marshal(reqMap)
+	if err != nil {
+		return body, 0, nil
+	}
+	return modified, trimmed, nil
+}
+
+// checkSchema 检查 JSON Schema 的基本结构，path 用于错误信息定位
+func checkSchema(schema map[string]interface{}, path string) error {
+	if rawType, exists := schema["type"]; exists {
+		switch t := rawType.(type) {
+		case string:
+			if !jsonSchemaTypes[t] {
+				return invalidRequest("%s.type: unknown type %q", path, t)
+			}
+		case []interface{}:
+			for _, item := range t {
+				if s, ok := item.(string); !ok || !jsonSchemaTypes[s] {
+					return invalidRequest("%s.type: unknown type %v", path, item)
+				}
+			}
+		default:
+			return invalidRequest("%s.type: must be a string or array of strings", path)
+		}
+	}
+
+	var properties map[string]interface{}
+	if rawProps, exists := schema["properties"]; exists {
+		props, ok := rawProps.(map[string]interface{})
+		if !ok {
+			return invalidRequest("%s.properties: must be an object", path)
+		}
+		properties = props
+		for name, rawProp := range props {
+			prop, ok := rawProp.(map[string]interface{})
+			if !ok {
+				return invalidRequest("%s.properties.%s: must be an object", path, name)
+			}
+			if err := checkSchema(prop, path+".properties."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if rawRequired, exists := schema["required"]; exists {
+		required, ok := rawRequired.([]interface{})
+		if !ok {
+			return invalidRequest("%s.required: must be an array of strings", path)
+		}
+		for _, item := range required {
+			name, ok := item.(string)
+			if !ok {
+				return invalidRequest("%s.required: must be an array of strings", path)
+			}
+			if properties != nil {
+				if _, defined := properties[name]; !defined {
+					return invalidRequest("%s.required: %q is not defined in properties", path, name)
+				}
+			}
+		}
+	}
+
+	if rawItems, exists := schema["items"]; exists {
+		switch items := rawItems.(type) {
+		case map[string]interface{}:
+			if err := checkSchema(items, path+".items"); err != nil {
+				return err
+			}
+		case bool:
+		default:
+			return invalidRequest("%s.items: must be a schema object", path)
+		}
+	}
+	return nil
+}
+
+// stripSchemaDescriptions 删除 schema 中超过 limit 的 description，返回删除的数量
+func stripSchemaDescriptions(v interface{}, limit int) int {
+	count := 0
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if desc, ok := val["description"].(string); ok && len(desc) > limit {
+			delete(val, "description")
+			count++
+		}
+		for key, item := range val {
+			// properties 的键是参数名，可能恰好叫 description
+			if key == "description" {
+				if _, isString := item.(string); isString {
+					continue
+				}
+			}
+			count += stripSchemaDescriptions(item, limit)
+		}
+	case []interface{}:
+		for _, item := range val {
+			count += stripSchemaDescriptions(item, limit)
+		}
+	}
+	return count
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateToolsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools string
+		want  string
+	}{
+		{"bad name", `[{"name":"read file","input_schema":{"type":"object"}}]`, "tools[0].name"},
+		{"duplicate", `[{"name":"a","input_schema":{"type":"object"}},{"name":"a","input_schema":{"type":"object"}}]`, "tools[1].name: \"a\" duplicates tools[0]"},
+		{"missing schema", `[{"name":"a"}]`, "tools[0] (a).input_schema: required"},
+		{"non-object schema", `[{"name":"a","input_schema":{"type":"string"}}]`, "input_schema.type"},
+		{"unknown type", `[{"name":"a","input_schema":{"type":"object","properties":{"p":{"type":"str"}}}}]`, "tools[0] (a).input_schema.properties.p.type"},
+		{"required undefined", `[{"name":"a","input_schema":{"type":"object","properties":{"p":{"type":"string"}},"required":["q"]}}]`, "\"q\" is not defined"},
+		{"bad items", `[{"name":"a","input_schema":{"type":"object","properties":{"p":{"type":"array","items":{"type":"nope"}}}}}]`, "properties.p.items.type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := validateTools([]byte(`{"model":"m","tools":`+tt.tools+`}`), ToolLimits{})
+			var invalid *InvalidRequestError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want InvalidRequestError", err)
+			}
+			if !strings.Contains(invalid.Message, tt.want) {
+				t.Errorf("message %q does not contain %q", invalid.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateToolsAccepts(t *testing.T) {
+	body := `{"model":"m","tools":[` +
+		`{"name":"get_weather","description":"weather","input_schema":{"type":"object","properties":{"city":{"type":["string","null"]}},"required":["city"]}},` +
+		`{"type":"web_search_20250305","name":"web_search","max_uses":3}]}`
+
+	got, trimmed, err := validateTools([]byte(body), ToolLimits{})
+	if err != nil || trimmed != 0 || string(got) != body {
+		t.Errorf("valid tools rejected or modified: err=%v trimmed=%d", err, trimmed)
+	}
+
+	if got, _, err := validateTools([]byte(`{"model":"m"}`), ToolLimits{}); err != nil || string(got) != `{"model":"m"}` {
+		t.Errorf("request without tools: err=%v", err)
+	}
+}
+
+func TestValidateToolsLimits(t *testing.T) {
+	long := strings.Repeat("d", 100)
+	body := `{"tools":[{"name":"a","description":"` + long + `","input_schema":{"type":"object","properties":{` +
+		`"p":{"type":"string","description":"` + long + `"},"description":{"type":"string","description":"short"}}}}]}`
+
+	got, trimmed, err := validateTools([]byte(body), ToolLimits{MaxDescriptionBytes: 10})
+	if err != nil || trimmed != 2 {
+		t.Fatalf("trimmed = %d, err = %v", trimmed, err)
+	}
+	var req struct {
+		Tools []struct {
+			Description string `json:"description"`
+			InputSchema struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"input_schema"`
+		} `json:"tools"`
+	}
+	json.Unmarshal(got, &req)
+	tool := req.Tools[0]
+	if tool.Description != long[:10] {
+		t.Errorf("tool description = %q", tool.Description)
+	}
+	if _, ok := tool.InputSchema.Properties["p"]["description"]; ok {
+		t.Error("long property description not removed")
+	}
+	if tool.InputSchema.Properties["description"]["description"] != "short" {
+		t.Error("property named description was altered")
+	}
+
+	_, _, err = validateTools([]byte(body), ToolLimits{MaxBytes: 50})
+	if err == nil || !strings.Contains(err.Error(), "largest is tools[0] (a)") {
+		t.Errorf("size limit err = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTraceCapacity = 500
+	defaultTraceTTL      = time.Hour
+)
+
+// TraceIDHeader 每个经过 LoggerMiddleware 的响应都带上本次请求的 traceid
+const TraceIDHeader = "X-Trace-Id"
+
+// Trace 一次返回了 traceid 的请求的完整日志
+type Trace struct {
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ServiceTier string    `json:"service_tier,omitempty"`
+	Logs        []string  `json:"logs"`
+}
+
+// traceStore 固定容量的环形缓冲，写满后覆盖最旧的记录，过期记录不再返回
+type traceStore struct {
+	mu      sync.Mutex
+	entries []Trace
+	index   map[string]int
+	next    int
+	ttl     time.Duration
+}
+
+func newTraceStore(capacity int, ttl time.Duration) *traceStore {
+	return &traceStore{
+		entries: make([]Trace, capacity),
+		index:   make(map[string]int, capacity),
+		ttl:     ttl,
+	}
+}
+
+func (s *traceStore) put(trace Trace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old := s.entries[s.next]; old.ID != "" {
+		delete(s.index, old.ID)
+	}
+	s.entries[s.next] = trace
+	s.index[trace.ID] = s.next
+	s.next = (s.next + 1) % len(s.entries)
+}
+
+func (s *traceStore) get(id string, now time.Time) (Trace, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot, ok := s.index[id]
+	if !ok {
+		return Trace{}, false
+	}
+	trace := s.entries[slot]
+	if now.Sub(trace.CreatedAt) > s.ttl {
+		return Trace{}, false
+	}
+	return trace, true
+}
+
+var (
+	traces     *traceStore
+	tracesOnce sync.Once
+)
+
+// getTraceStore 按 DEBUG_TRACE_CAPACITY（条数）和 DEBUG_TRACE_TTL（秒）创建全局存储
+func getTraceStore() *traceStore {
+	tracesOnce.Do(func() {
+		capacity := defaultTraceCapacity
+		if v, err := strconv.Atoi(os.Getenv("DEBUG_TRACE_CAPACITY")); err == nil && v > 0 {
+			capacity = v
+		}
+		ttl := defaultTraceTTL
+		if v, err := strconv.Atoi(os.Getenv("DEBUG_TRACE_TTL")); err == nil && v > 0 {
+			ttl = time.Duration(v) * time.Second
+		}
+		traces = newTraceStore(capacity, ttl)
+	})
+	return traces
+}
+
+// NewTraceID 生成一个随机的 traceid
+func NewTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RecordTraceID 把返回给客户端的 traceid 关联到当前请求，请求结束时保存其日志
+func RecordTraceID(ctx context.Context, traceID string) {
+	if logger := GetLogger(ctx); logger != nil {
+		logger.SetTraceID(traceID)
+	}
+}
+
+// ErrorTraceID 返回写入错误响应的 traceid：与响应头 X-Trace-Id 相同，并保存本次请求的日志；
+// 未经过 LoggerMiddleware 时生成一个新的
+func ErrorTraceID(ctx context.Context) string {
+	logger := GetLogger(ctx)
+	if logger == nil {
+		return NewTraceID()
+	}
+	logger.MarkError()
+	return logger.TraceID()
+}
+
+// GetTrace 按 traceid 查找请求日志，不存在或已过期时返回 false
+func GetTrace(traceID string) (Trace, bool) {
+	return getTraceStore().get(traceID, time.Now())
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTraceStoreEvictsOldest(t *testing.T) {
+	store := newTraceStore(2, time.Hour)
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		store.put(Trace{ID: fmt.Sprintf("t%d", i), CreatedAt: now})
+	}
+
+	if _, ok := store.get("t1", now); ok {
+		t.Error("t1 should have been evicted")
+	}
+	for _, id := range []string{"t2", "t3"} {
+		if _, ok := store.get(id, now); !ok {
+			t.Errorf("%s missing", id)
+		}
+	}
+}
+
+func TestTraceStoreExpires(t *testing.T) {
+	store := newTraceStore(4, time.Minute)
+	now := time.Now()
+	store.put(Trace{ID: "old", CreatedAt: now.Add(-2 * time.Minute)})
+
+	if _, ok := store.get("old", now); ok {
+		t.Error("expired trace returned")
+	}
+}
+
+func TestRequestLoggerSavesTrace(t *testing.T) {
+	logger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), logger)
+	DebugLog(ctx, "selected account %d", 7)
+	RecordTraceID(ctx, "trace-abc")
+	logger.Flush()
+
+	trace, ok := GetTrace("trace-abc")
+	if !ok {
+		t.Fatal("trace not saved")
+	}
+	if len(trace.Logs) != 1 || trace.Logs[0] != "[DEBUG] selected account 7" {
+		t.Errorf("logs = %q", trace.Logs)
+	}
+
+	// 没有 traceid 的请求不保存
+	NewRequestLogger().Flush()
+}
+
+func TestErrorTraceIDMatchesRequestTraceID(t *testing.T) {
+	logger := NewRequestLogger()
+	ctx := WithLogger(context.Background(), logger)
+	id := logger.TraceID()
+	if len(id) != 32 {
+		t.Fatalf("trace id = %q", id)
+	}
+	// 成功的请求不保存日志
+	DebugLog(ctx, "ok")
+	logger.Flush()
+	if _, ok := GetTrace(id); ok {
+		t.Fatal("successful request saved")
+	}
+
+	logger = NewRequestLogger()
+	ctx = WithLogger(context.Background(), logger)
+	DebugLog(ctx, "upstream failed")
+	if got := ErrorTraceID(ctx); got != logger.TraceID() {
+		t.Errorf("ErrorTraceID = %q, want %q", got, logger.TraceID())
+	}
+	logger.Flush()
+	if trace, ok := GetTrace(logger.TraceID()); !ok || len(trace.Logs) != 1 {
+		t.Errorf("trace = %+v, ok = %v", trace, ok)
+	}
+
+	if ErrorTraceID(context.Background()) == "" {
+		t.Error("empty trace id without logger")
+	}
+}
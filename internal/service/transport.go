@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+var (
+	upstreamTransportsMu   sync.RWMutex
+	upstreamTransports     map[string]string // 服务商或模型 -> 发送方式
+	upstreamTransportsOnce sync.Once
+)
+
+// loadUpstreamTransports 从 UPSTREAM_TRANSPORT 读取上游请求的发送方式
+func loadUpstreamTransports() {
+	upstreamTransports = parseUpstreamTransports(os.Getenv("UPSTREAM_TRANSPORT"))
+	if len(upstreamTransports) > 0 {
+		log.Printf("[INFO] 已加载 %d 个上游发送方式配置", len(upstreamTransports))
+	}
+}
+
+// parseUpstreamTransports 解析上游发送方式配置
+// 格式: 服务商或上游模型名=http|sdk，逗号分隔，模型优先于服务商，例如 anthropic=sdk,claude-haiku-4-5-20251001=http
+func parseUpstreamTransports(raw string) map[string]string {
+	result := make(map[string]string)
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return result
+	}
+
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		if knownProviders[strings.ToLower(key)] {
+			key = strings.ToLower(key)
+		}
+		mode, err := validateTransport(key, parts[1])
+		if err != nil {
+			log.Printf("[WARN] UPSTREAM_TRANSPORT 中 %s 的值无效，已忽略: %v", key, err)
+			continue
+		}
+		result[key] = mode
+	}
+	return result
+}
+
+// validateTransport 检查发送方式，服务商没有官方 SDK 时不能设为 sdk
+func validateTransport(key, mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case provider.TransportHTTP:
+	case provider.TransportSDK:
+		if knownProviders[key] && !provider.SupportsSDKTransport(key) {
+			return "", fmt.Errorf("provider %s has no SDK transport", key)
+		}
+	default:
+		return "", fmt.Errorf("unknown transport: %s", mode)
+	}
+	return mode, nil
+}
+
+// GetUpstreamTransports 返回按服务商和模型配置的发送方式副本
+func GetUpstreamTransports() map[string]string {
+	upstreamTransportsOnce.Do(loadUpstreamTransports)
+	upstreamTransportsMu.RLock()
+	defer upstreamTransportsMu.RUnlock()
+
+	result := make(map[string]string, len(upstreamTransports))
+	for k, v := range upstreamTransports {
+		result[k] = v
+	}
+	return result
+}
+
+// SetUpstreamTransport 运行时修改服务商或模型的发送方式（仅内存生效，重启后以环境变量为准），mode 为空时删除该配置
+func SetUpstreamTransport(key, mode string) error {
+	key = strings.TrimSpace(key)
+	if knownProviders[strings.ToLower(key)] {
+		key = strings.ToLower(key)
+	} else if !isUpstreamModel(key) {
+		return fmt.Errorf("unknown provider or model: %s", key)
+	}
+
+	if strings.TrimSpace(mode) != "" {
+		var err error
+		if mode, err = validateTransport(key, mode); err != nil {
+			return err
+		}
+	}
+
+	upstreamTransportsOnce.Do(loadUpstreamTransports)
+	upstreamTransportsMu.Lock()
+	defer upstreamTransportsMu.Unlock()
+	if strings.TrimSpace(mode) == "" {
+		delete(upstreamTransports, key)
+		return nil
+	}
+	upstreamTransports[key] = mode
+	return nil
+}
+
+// isUpstreamModel 是否为模型表中的上游模型名（thinking 等别名与原模型共用同一个上游模型名）
+func isUpstreamModel(name string) bool {
+	for _, m := range model.ListZenModels() {
+		if m.Model == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveTransport 计算模型实际使用的发送方式：模型配置 > 服务商配置 > http，
+// 服务商没有官方 SDK 时始终为 http
+func ResolveTransport(zenModel model.ZenModel) string {
+	if !provider.SupportsSDKTransport(zenModel.ProviderID) {
+		return provider.TransportHTTP
+	}
+	upstreamTransportsOnce.Do(loadUpstreamTransports)
+	upstreamTransportsMu.RLock()
+	defer upstreamTransportsMu.RUnlock()
+
+	if mode, ok := upstreamTransports[zenModel.Model]; ok {
+		return mode
+	}
+	if mode, ok := upstreamTransports[zenModel.ProviderID]; ok {
+		return mode
+	}
+	return provider.TransportHTTP
+}
+
+// withUpstreamTransport 模型配置为 sdk 时改由官方 SDK 发送请求
+func withUpstreamTransport(client *http.Client, zenModel model.ZenModel) *http.Client {
+	if ResolveTransport(zenModel) != provider.TransportSDK {
+		return client
+	}
+	return provider.NewSDKClient(client, zenModel.ProviderID)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"zencoder2api/internal/model"
+	"zencoder2api/internal/service/provider"
+)
+
+func TestParseUpstreamTransports(t *testing.T) {
+	got := parseUpstreamTransports("Anthropic=SDK, claude-haiku-4-5-20251001=http, xai=sdk, openai=grpc, broken")
+	want := map[string]string{"anthropic": "sdk", "claude-haiku-4-5-20251001": "http"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestResolveTransport(t *testing.T) {
+	model.ResetZenModelsToDefault()
+	upstreamTransportsOnce.Do(loadUpstreamTransports)
+	upstreamTransportsMu.Lock()
+	saved := upstreamTransports
+	upstreamTransports = map[string]string{"anthropic": "sdk", "claude-haiku-4-5-20251001": "http", "grok-code-fast-1": "sdk"}
+	upstreamTransportsMu.Unlock()
+	defer func() {
+		upstreamTransportsMu.Lock()
+		upstreamTransports = saved
+		upstreamTransportsMu.Unlock()
+	}()
+
+	tests := []struct {
+		modelID string
+		want    string
+	}{
+		{"claude-sonnet-4-5-20250929", provider.TransportSDK},
+		{"claude-sonnet-4-5-20250929-thinking", provider.TransportSDK},
+		{"claude-haiku-4-5-20251001", provider.TransportHTTP},
+		{"gpt-5.1-codex", provider.TransportHTTP},
+		{"grok-code-fast-1", provider.TransportHTTP}, // xAI 没有官方 SDK
+	}
+	for _, tt := range tests {
+		zenModel, ok := model.GetZenModel(tt.modelID)
+		if !ok {
+			t.Fatalf("unknown model %s", tt.modelID)
+		}
+		if got := ResolveTransport(zenModel); got != tt.want {
+			t.Errorf("ResolveTransport(%s) = %q, want %q", tt.modelID, got, tt.want)
+		}
+	}
+
+	sonnet, _ := model.GetZenModel("claude-sonnet-4-5-20250929")
+	haiku, _ := model.GetZenModel("claude-haiku-4-5-20251001")
+	sdkClient, httpClient := httpUpstream{}.Client("", sonnet), httpUpstream{}.Client("", haiku)
+	if fmt.Sprintf("%T", sdkClient.Transport) == fmt.Sprintf("%T", httpClient.Transport) {
+		t.Errorf("sdk model got %T, same as the http model", sdkClient.Transport)
+	}
+}
+
+func TestSetUpstreamTransport(t *testing.T) {
+	model.ResetZenModelsToDefault()
+	if err := SetUpstreamTransport("no-such-model", "sdk"); err == nil {
+		t.Error("unknown model accepted")
+	}
+	if err := SetUpstreamTransport("gemini", "sdk"); err == nil {
+		t.Error("sdk accepted for a provider without an SDK")
+	}
+	if err := SetUpstreamTransport("gpt-5.1-codex", "SDK"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetUpstreamTransport("gpt-5.1-codex", "")
+	if got := GetUpstreamTransports()["gpt-5.1-codex"]; got != provider.TransportSDK {
+		t.Errorf("transport = %q, want sdk", got)
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// DefaultUpstreamBase Zencoder 上游API默认根地址
+const DefaultUpstreamBase = "https://api.zencoder.ai"
+
+// SetUpstreamBase 把各服务商的上游地址切换到 base（用于压测或本地模拟上游）
+// 只应在启动阶段、处理请求之前调用
+func SetUpstreamBase(base string) {
+	base = strings.TrimRight(base, "/")
+	AnthropicBaseURL = base + "/anthropic"
+	GeminiBaseURL = base + "/gemini"
+	GrokBaseURL = base + "/xai"
+	OpenAIBaseURL = base + "/openai"
+}
+
+// InitUpstreamBase 读取 ZENCODER_API_BASE 覆盖上游地址
+func InitUpstreamBase() {
+	base := strings.TrimSpace(os.Getenv("ZENCODER_API_BASE"))
+	if base == "" {
+		return
+	}
+	SetUpstreamBase(base)
+	log.Printf("[INFO] 上游API地址已覆盖为 %s", base)
+}
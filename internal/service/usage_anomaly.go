@@ -0,0 +1,184 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+// 用量异常类型
+const (
+	UsageAnomalyJump = "jump" // 上游报告的当日用量比网关预期多出超过阈值，账号可能在网关之外被使用
+	UsageAnomalyDrop = "drop" // 同一计费周期内当日用量下降超过阈值，上游用量被重置或与其他来源共享
+)
+
+const (
+	// usageAnomalyMaxEvents 保留的异常事件条数
+	usageAnomalyMaxEvents = 100
+	// defaultUsageAnomalyThreshold 默认相差 20 积分视为异常，容纳同一账号并发请求的响应先后到达造成的偏差
+	defaultUsageAnomalyThreshold = 20
+)
+
+// UsageAnomalySettings 账号用量异常检测配置
+type UsageAnomalySettings struct {
+	Threshold         float64 `json:"threshold"`          // 上游报告的当日用量比预期多出或比上次减少超过该积分数时视为异常，0 表示关闭
+	QuarantineMinutes int     `json:"quarantine_minutes"` // 发现异常后把账号移出轮询的时长，0 表示只记录
+}
+
+// UsageAnomaly 一次用量异常事件
+type UsageAnomaly struct {
+	AccountID   uint       `json:"account_id"`
+	Email       string     `json:"email,omitempty"`
+	Kind        string     `json:"kind"`
+	Previous    float64    `json:"previous"` // 上一次响应头报告的当日用量
+	Expected    float64    `json:"expected"` // 加上本次请求费用后的预期用量
+	Reported    float64    `json:"reported"` // 本次响应头报告的当日用量
+	Quarantined bool       `json:"quarantined"`
+	Until       *time.Time `json:"until,omitempty"` // 隔离到期时间
+	At          time.Time  `json:"at"`
+}
+
+// usageObservation 账号最近一次响应头中的用量
+type usageObservation struct {
+	periodCost float64
+	periodEnd  string
+}
+
+var (
+	usageAnomalyMu       sync.RWMutex
+	usageAnomalySettings UsageAnomalySettings
+	usageAnomalyOnce     sync.Once
+
+	usageObservationMu sync.Mutex
+	usageObservations  = make(map[uint]usageObservation)
+
+	usageAnomalyEventsMu sync.Mutex
+	usageAnomalyEvents   []UsageAnomaly
+	usageAnomalyCounts   = make(map[string]uint64)
+)
+
+// loadUsageAnomalySettings 读取 USAGE_ANOMALY_THRESHOLD / USAGE_ANOMALY_QUARANTINE_MINUTES
+func loadUsageAnomalySettings() {
+	usageAnomalySettings = UsageAnomalySettings{
+		Threshold:         float64(envNonNegativeIntDefault("USAGE_ANOMALY_THRESHOLD", defaultUsageAnomalyThreshold)),
+		QuarantineMinutes: envNonNegativeInt("USAGE_ANOMALY_QUARANTINE_MINUTES"),
+	}
+}
+
+// GetUsageAnomalySettings 获取用量异常检测配置
+func GetUsageAnomalySettings() UsageAnomalySettings {
+	usageAnomalyOnce.Do(loadUsageAnomalySettings)
+	usageAnomalyMu.RLock()
+	defer usageAnomalyMu.RUnlock()
+	return usageAnomalySettings
+}
+
+// SetUsageAnomalySettings 运行时修改用量异常检测配置（仅内存生效）
+func SetUsageAnomalySettings(settings UsageAnomalySettings) error {
+	if settings.Threshold < 0 || settings.QuarantineMinutes < 0 {
+		return fmt.Errorf("threshold 和 quarantine_minutes 不能为负数")
+	}
+	usageAnomalyOnce.Do(loadUsageAnomalySettings)
+	usageAnomalyMu.Lock()
+	defer usageAnomalyMu.Unlock()
+	usageAnomalySettings = settings
+	return nil
+}
+
+// detectUsageAnomaly 比对本次响应头报告的当日用量与上一次报告加本次请求费用，记录本次报告作为下次比对的基准。
+// 计费周期结束时间变化说明进入了新周期，用量重置不算异常
+func detectUsageAnomaly(accountID uint, reported, requestCost float64, periodEnd string, threshold float64) (UsageAnomaly, bool) {
+	usageObservationMu.Lock()
+	prev, ok := usageObservations[accountID]
+	usageObservations[accountID] = usageObservation{periodCost: reported, periodEnd: periodEnd}
+	usageObservationMu.Unlock()
+
+	if !ok || threshold <= 0 || prev.periodEnd != periodEnd {
+		return UsageAnomaly{}, false
+	}
+	anomaly := UsageAnomaly{AccountID: accountID, Previous: prev.periodCost, Expected: prev.periodCost + requestCost, Reported: reported}
+	switch {
+	case prev.periodCost-reported > threshold:
+		anomaly.Kind = UsageAnomalyDrop
+	case reported-anomaly.Expected > threshold:
+		anomaly.Kind = UsageAnomalyJump
+	default:
+		return UsageAnomaly{}, false
+	}
+	return anomaly, true
+}
+
+// checkAccountUsage 由 UpdateAccountCreditsFromResponse 在写入上游报告的当日用量之前调用；
+// 发现异常时记录事件，按配置把账号移入冷却分组隔离，之后由冷却恢复流程放回号池
+func checkAccountUsage(account *model.Account, reported, requestCost float64, periodEnd string) {
+	settings := GetUsageAnomalySettings()
+	anomaly, found := detectUsageAnomaly(account.ID, reported, requestCost, periodEnd, settings.Threshold)
+	if !found {
+		return
+	}
+	now := time.Now()
+	anomaly.Email = account.Email
+	anomaly.At = now
+	if settings.QuarantineMinutes > 0 {
+		until := now.Add(time.Duration(settings.QuarantineMinutes) * time.Minute).UTC()
+		anomaly.Quarantined = true
+		anomaly.Until = &until
+		quarantineAccount(account, anomaly, until)
+	}
+	recordUsageAnomaly(anomaly)
+	log.Printf("[WARN] [UsageAnomaly] 账号 %s (ID:%d) 用量异常 (%s): 上次 %.2f，预期 %.2f，上游报告 %.2f，隔离=%v",
+		account.Email, account.ID, anomaly.Kind, anomaly.Previous, anomaly.Expected, anomaly.Reported, anomaly.Quarantined)
+}
+
+// quarantineAccount 把账号移入冷却分组直到 until，并立即停止向它调度新请求；
+// 账号由调用方随积分信息一起保存
+func quarantineAccount(account *model.Account, anomaly UsageAnomaly, until time.Time) {
+	account.IsCooling = true
+	account.IsActive = false
+	account.Status = "cooling"
+	account.Category = "cooling"
+	account.CoolingUntil = until
+	account.BanReason = fmt.Sprintf("Usage anomaly (%s): reported %.2f, expected %.2f", anomaly.Kind, anomaly.Reported, anomaly.Expected)
+
+	statusMu.Lock()
+	if status, ok := accountStatuses[account.ID]; ok && status.FrozenUntil.Before(until) {
+		status.FrozenUntil = until
+	}
+	statusMu.Unlock()
+}
+
+func recordUsageAnomaly(anomaly UsageAnomaly) {
+	usageAnomalyEventsMu.Lock()
+	defer usageAnomalyEventsMu.Unlock()
+	usageAnomalyCounts[anomaly.Kind]++
+	usageAnomalyEvents = append(usageAnomalyEvents, anomaly)
+	if len(usageAnomalyEvents) > usageAnomalyMaxEvents {
+		usageAnomalyEvents = usageAnomalyEvents[len(usageAnomalyEvents)-usageAnomalyMaxEvents:]
+	}
+}
+
+// ListUsageAnomalies 返回最近的用量异常事件，最新的在前
+func ListUsageAnomalies() []UsageAnomaly {
+	usageAnomalyEventsMu.Lock()
+	defer usageAnomalyEventsMu.Unlock()
+	events := make([]UsageAnomaly, len(usageAnomalyEvents))
+	for i, e := range usageAnomalyEvents {
+		events[len(usageAnomalyEvents)-1-i] = e
+	}
+	return events
+}
+
+func writeUsageAnomalyMetrics(w io.Writer) {
+	usageAnomalyEventsMu.Lock()
+	jump, drop := usageAnomalyCounts[UsageAnomalyJump], usageAnomalyCounts[UsageAnomalyDrop]
+	usageAnomalyEventsMu.Unlock()
+
+	fmt.Fprintln(w, "# TYPE zencoder_usage_anomalies counter")
+	fmt.Fprintln(w, "# HELP zencoder_usage_anomalies Accounts whose upstream-reported daily usage diverged from what this gateway spent.")
+	fmt.Fprintf(w, "zencoder_usage_anomalies_total{kind=%q} %d\n", UsageAnomalyJump, jump)
+	fmt.Fprintf(w, "zencoder_usage_anomalies_total{kind=%q} %d\n", UsageAnomalyDrop, drop)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zencoder2api/internal/model"
+)
+
+func TestDetectUsageAnomaly(t *testing.T) {
+	const id, end = 9101, "2026-10-17T00:00:00Z"
+	steps := []struct {
+		reported, cost float64
+		periodEnd      string
+		want           string
+	}{
+		{100, 2, end, ""},                  // 第一次只记录基准
+		{103, 2, end, ""},                  // 并发请求造成的小偏差
+		{140, 2, end, UsageAnomalyJump},    // 多出 35
+		{100, 2, end, UsageAnomalyDrop},    // 同一周期内减少 40
+		{1, 1, "2026-10-18T00:00:00Z", ""}, // 新周期，用量重置
+		{90, 1, "2026-10-18T00:00:00Z", UsageAnomalyJump},
+	}
+	for i, step := range steps {
+		anomaly, found := detectUsageAnomaly(id, step.reported, step.cost, step.periodEnd, 20)
+		if got := map[bool]string{true: anomaly.Kind}[found]; got != step.want {
+			t.Errorf("step %d: kind = %q, want %q (%+v)", i, got, step.want, anomaly)
+		}
+	}
+
+	// 阈值为 0 时关闭
+	detectUsageAnomaly(9102, 10, 1, end, 0)
+	if _, found := detectUsageAnomaly(9102, 500, 1, end, 0); found {
+		t.Error("disabled detection flagged an anomaly")
+	}
+}
+
+func TestCheckAccountUsageQuarantines(t *testing.T) {
+	prev := GetUsageAnomalySettings()
+	SetUsageAnomalySettings(UsageAnomalySettings{Threshold: 10, QuarantineMinutes: 30})
+	defer SetUsageAnomalySettings(prev)
+
+	account := &model.Account{ID: 9103, Email: "shared@example.com", Status: "normal", IsActive: true}
+	defer swapAccountStatuses(map[uint]*AccountStatus{9103: {}})()
+
+	checkAccountUsage(account, 50, 1, "")
+	checkAccountUsage(account, 80, 1, "")
+
+	if account.Status != "cooling" || !account.IsCooling || account.BanReason == "" {
+		t.Fatalf("account not quarantined: %+v", account)
+	}
+	if d := time.Until(account.CoolingUntil); d < 29*time.Minute || d > 31*time.Minute {
+		t.Errorf("cooling until %v", account.CoolingUntil)
+	}
+	statusMu.RLock()
+	frozen := accountStatuses[9103].FrozenUntil
+	statusMu.RUnlock()
+	if !frozen.Equal(account.CoolingUntil) {
+		t.Errorf("in-memory freeze = %v, want %v", frozen, account.CoolingUntil)
+	}
+
+	events := ListUsageAnomalies()
+	if len(events) == 0 || events[0].AccountID != 9103 || events[0].Kind != UsageAnomalyJump || !events[0].Quarantined || events[0].Expected != 51 {
+		t.Errorf("events = %+v", events)
+	}
+}
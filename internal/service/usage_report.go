@@ -0,0 +1,339 @@
+package service
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+// usageDateLayout 与每日积分重置相同，按本地日期统计
+const usageDateLayout = "2006-01-02"
+
+// 报表统计天数，默认一周
+const (
+	UsageReportDefaultDays = 7
+	UsageReportMaxDays     = 90
+	usageRetentionDays     = UsageReportMaxDays
+)
+
+type usageKey struct {
+	date      string
+	accountID uint
+}
+
+type rejectionKey struct {
+	date  string
+	model string
+}
+
+type usageDelta struct {
+	credits  float64
+	requests int
+}
+
+// usageRecorder 在内存中累计用量、拒绝次数和请求日志，随号池刷新定期写入数据库，避免每个请求多一次写库
+type usageRecorder struct {
+	mu         sync.Mutex
+	usage      map[usageKey]usageDelta
+	rejections map[rejectionKey]int
+	logs       []model.RequestLog
+	lastPrune  string
+}
+
+var usageStats = &usageRecorder{
+	usage:      make(map[usageKey]usageDelta),
+	rejections: make(map[rejectionKey]int),
+}
+
+// recordAccountUsage 累计账号一次请求消耗的积分
+func recordAccountUsage(accountID uint, credits float64, now time.Time) {
+	usageStats.mu.Lock()
+	defer usageStats.mu.Unlock()
+	key := usageKey{date: now.Format(usageDateLayout), accountID: accountID}
+	d := usageStats.usage[key]
+	d.credits += credits
+	d.requests++
+	usageStats.usage[key] = d
+}
+
+// recordPoolRejection 累计因号池饱和被拒绝的请求
+func recordPoolRejection(modelID string, now time.Time) {
+	usageStats.mu.Lock()
+	defer usageStats.mu.Unlock()
+	usageStats.rejections[rejectionKey{date: now.Format(usageDateLayout), model: modelID}]++
+}
+
+// FlushUsageStats 把内存中累计的用量、拒绝次数和请求日志写入数据库，并清理超过保留期的记录
+func FlushUsageStats() {
+	// 数据库降级期间保留在内存中，恢复后一并写入
+	if !database.Healthy() {
+		return
+	}
+	usageStats.mu.Lock()
+	usage, rejections, logs := usageStats.usage, usageStats.rejections, usageStats.logs
+	usageStats.usage = make(map[usageKey]usageDelta)
+	usageStats.rejections = make(map[rejectionKey]int)
+	usageStats.logs = nil
+	today := time.Now().Format(usageDateLayout)
+	prune := usageStats.lastPrune != today
+	usageStats.lastPrune = today
+	usageStats.mu.Unlock()
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		for key, d := range usage {
+			res := tx.Model(&model.AccountUsageDaily{}).
+				Where("date = ? AND account_id = ?", key.date, key.accountID).
+				Updates(map[string]interface{}{
+					"credits":  gorm.Expr("credits + ?", d.credits),
+					"requests": gorm.Expr("requests + ?", d.requests),
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				row := model.AccountUsageDaily{Date: key.date, AccountID: key.accountID, Credits: d.credits, Requests: d.requests}
+				if err := tx.Create(&row).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for key, n := range rejections {
+			res := tx.Model(&model.PoolRejectionDaily{}).
+				Where("date = ? AND model = ?", key.date, key.model).
+				Update("count", gorm.Expr("count + ?", n))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				row := model.PoolRejectionDaily{Date: key.date, Model: key.model, Count: n}
+				if err := tx.Create(&row).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if len(logs) > 0 {
+			if err := tx.CreateInBatches(logs, 200).Error; err != nil {
+				return err
+			}
+		}
+		if prune {
+			cutoff := time.Now().AddDate(0, 0, -usageRetentionDays).Format(usageDateLayout)
+			if err := tx.Where("date < ?", cutoff).Delete(&model.AccountUsageDaily{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("date < ?", cutoff).Delete(&model.RequestLog{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("date < ?", cutoff).Delete(&model.PoolRejectionDaily{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[WARN] [UsageReport] 写入用量统计失败: %v", err)
+	}
+}
+
+// AccountUsageRow 报表中的单个账号
+type AccountUsageRow struct {
+	Rank            int            `json:"rank"`
+	AccountID       uint           `json:"account_id"`
+	Email           string         `json:"email"`
+	PlanType        model.PlanType `json:"plan_type"`
+	Status          string         `json:"status"`
+	DailyLimit      int            `json:"daily_limit"`
+	Credits         float64        `json:"credits"` // 统计期内消耗的积分
+	Requests        int            `json:"requests"`
+	AvgDailyCredits float64        `json:"avg_daily_credits"`
+	Utilization     float64        `json:"utilization"` // 日均消耗 / 每日限额
+	TodayUsed       float64        `json:"today_used"`
+	// HoursToExhaustion 按日均消耗速度用完当日剩余积分所需的小时数，没有消耗时为 null
+	HoursToExhaustion *float64 `json:"hours_to_exhaustion"`
+}
+
+// ModelRejectionRow 统计期内某模型因号池饱和被拒绝的请求数
+type ModelRejectionRow struct {
+	Model    string `json:"model"`
+	Rejected int    `json:"rejected"`
+}
+
+// UsageReport 容量规划报表：按利用率排序的账号、各模型的饱和拒绝次数及建议新增的账号数
+type UsageReport struct {
+	From                 string              `json:"from"`
+	To                   string              `json:"to"`
+	Days                 int                 `json:"days"`
+	GeneratedAt          time.Time           `json:"generated_at"`
+	Accounts             []AccountUsageRow   `json:"accounts"`
+	Rejections           []ModelRejectionRow `json:"rejections"`
+	AvgCreditsPerRequest float64             `json:"avg_credits_per_request"`
+	// UnmetCreditsPerDay 被拒绝的请求按平均单价折算的每日积分缺口
+	UnmetCreditsPerDay float64 `json:"unmet_credits_per_day"`
+	// SuggestedAccounts 补足积分缺口需要新增的各套餐账号数（任选其一）
+	SuggestedAccounts map[model.PlanType]int `json:"suggested_accounts"`
+}
+
+// BuildUsageReport 生成最近 days 天（含今天）的用量报表
+func BuildUsageReport(days int, now time.Time) (*UsageReport, error) {
+	if days <= 0 {
+		days = UsageReportDefaultDays
+	}
+	if days > UsageReportMaxDays {
+		days = UsageReportMaxDays
+	}
+	FlushUsageStats()
+
+	from := now.AddDate(0, 0, -(days - 1)).Format(usageDateLayout)
+	to := now.Format(usageDateLayout)
+	db := database.GetReadDB()
+
+	var accounts []model.Account
+	if err := db.Order("id").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	var usage []model.AccountUsageDaily
+	if err := db.Where("date >= ? AND date <= ?", from, to).Find(&usage).Error; err != nil {
+		return nil, err
+	}
+	var rejections []model.PoolRejectionDaily
+	if err := db.Where("date >= ? AND date <= ?", from, to).Find(&rejections).Error; err != nil {
+		return nil, err
+	}
+	return buildUsageReport(accounts, usage, rejections, days, now), nil
+}
+
+func buildUsageReport(accounts []model.Account, usage []model.AccountUsageDaily, rejections []model.PoolRejectionDaily, days int, now time.Time) *UsageReport {
+	report := &UsageReport{
+		From:              now.AddDate(0, 0, -(days - 1)).Format(usageDateLayout),
+		To:                now.Format(usageDateLayout),
+		Days:              days,
+		GeneratedAt:       now,
+		Accounts:          []AccountUsageRow{},
+		Rejections:        []ModelRejectionRow{},
+		SuggestedAccounts: map[model.PlanType]int{},
+	}
+
+	totals := make(map[uint]usageDelta)
+	var totalCredits float64
+	var totalRequests int
+	for _, u := range usage {
+		d := totals[u.AccountID]
+		d.credits += u.Credits
+		d.requests += u.Requests
+		totals[u.AccountID] = d
+		totalCredits += u.Credits
+		totalRequests += u.Requests
+	}
+
+	for _, acc := range accounts {
+		limit := model.PlanLimits[acc.PlanType]
+		d := totals[acc.ID]
+		row := AccountUsageRow{
+			AccountID:       acc.ID,
+			Email:           acc.Email,
+			PlanType:        acc.PlanType,
+			Status:          acc.Status,
+			DailyLimit:      limit,
+			Credits:         d.credits,
+			Requests:        d.requests,
+			AvgDailyCredits: d.credits / float64(days),
+			TodayUsed:       acc.DailyUsed,
+		}
+		if limit > 0 {
+			row.Utilization = row.AvgDailyCredits / float64(limit)
+		}
+		if row.AvgDailyCredits > 0 {
+			hours := math.Max(float64(limit)-acc.DailyUsed, 0) / (row.AvgDailyCredits / 24)
+			row.HoursToExhaustion = &hours
+		}
+		report.Accounts = append(report.Accounts, row)
+	}
+	// 利用率高的在前，相同时先耗尽的在前
+	sort.SliceStable(report.Accounts, func(i, j int) bool {
+		a, b := report.Accounts[i], report.Accounts[j]
+		if a.Utilization != b.Utilization {
+			return a.Utilization > b.Utilization
+		}
+		if (a.HoursToExhaustion == nil) != (b.HoursToExhaustion == nil) {
+			return a.HoursToExhaustion != nil
+		}
+		return a.HoursToExhaustion != nil && *a.HoursToExhaustion < *b.HoursToExhaustion
+	})
+	for i := range report.Accounts {
+		report.Accounts[i].Rank = i + 1
+	}
+
+	byModel := make(map[string]int)
+	var totalRejected int
+	for _, r := range rejections {
+		byModel[r.Model] += r.Count
+		totalRejected += r.Count
+	}
+	for id, n := range byModel {
+		report.Rejections = append(report.Rejections, ModelRejectionRow{Model: id, Rejected: n})
+	}
+	sort.Slice(report.Rejections, func(i, j int) bool {
+		if report.Rejections[i].Rejected != report.Rejections[j].Rejected {
+			return report.Rejections[i].Rejected > report.Rejections[j].Rejected
+		}
+		return report.Rejections[i].Model < report.Rejections[j].Model
+	})
+
+	if totalRequests > 0 {
+		report.AvgCreditsPerRequest = totalCredits / float64(totalRequests)
+	}
+	report.UnmetCreditsPerDay = float64(totalRejected) / float64(days) * report.AvgCreditsPerRequest
+	if report.UnmetCreditsPerDay > 0 {
+		for plan, limit := range model.PlanLimits {
+			if plan == model.PlanFree || limit <= 0 {
+				continue
+			}
+			report.SuggestedAccounts[plan] = int(math.Ceil(report.UnmetCreditsPerDay / float64(limit)))
+		}
+	}
+	return report
+}
+
+func formatReportFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// WriteUsageReportCSV 以 CSV 输出报表：先是按排名的账号，空行后是各模型的饱和拒绝次数
+func WriteUsageReportCSV(w io.Writer, report *UsageReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"rank", "account_id", "email", "plan_type", "status", "daily_limit", "credits", "requests", "avg_daily_credits", "utilization", "today_used", "hours_to_exhaustion"})
+	for _, row := range report.Accounts {
+		hours := ""
+		if row.HoursToExhaustion != nil {
+			hours = formatReportFloat(*row.HoursToExhaustion)
+		}
+		cw.Write([]string{
+			strconv.Itoa(row.Rank),
+			strconv.FormatUint(uint64(row.AccountID), 10),
+			row.Email,
+			string(row.PlanType),
+			row.Status,
+			strconv.Itoa(row.DailyLimit),
+			formatReportFloat(row.Credits),
+			strconv.Itoa(row.Requests),
+			formatReportFloat(row.AvgDailyCredits),
+			formatReportFloat(row.Utilization),
+			formatReportFloat(row.TodayUsed),
+			hours,
+		})
+	}
+	cw.Write(nil)
+	cw.Write([]string{"model", "rejected_requests"})
+	for _, r := range report.Rejections {
+		cw.Write([]string{r.Model, strconv.Itoa(r.Rejected)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zencoder2api/internal/database"
+	"zencoder2api/internal/model"
+)
+
+func TestBuildUsageReportRanksAccounts(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	accounts := []model.Account{
+		{ID: 1, Email: "idle@example.com", PlanType: model.PlanMax, Status: "normal"},
+		{ID: 2, Email: "busy@example.com", PlanType: model.PlanStarter, Status: "normal", DailyUsed: 140},
+		{ID: 3, Email: "half@example.com", PlanType: model.PlanStarter, Status: "normal", DailyUsed: 0},
+	}
+	usage := []model.AccountUsageDaily{
+		{Date: "2026-03-09", AccountID: 2, Credits: 1400, Requests: 700},
+		{Date: "2026-03-10", AccountID: 2, Credits: 560, Requests: 280},
+		{Date: "2026-03-10", AccountID: 3, Credits: 1040, Requests: 20},
+	}
+	rejections := []model.PoolRejectionDaily{
+		{Date: "2026-03-09", Model: "gpt-5", Count: 70},
+		{Date: "2026-03-10", Model: "claude-sonnet-4-5-20250929", Count: 140},
+	}
+
+	report := buildUsageReport(accounts, usage, rejections, 7, now)
+	if report.From != "2026-03-04" || report.To != "2026-03-10" {
+		t.Errorf("range = %s..%s", report.From, report.To)
+	}
+	ids := []uint{report.Accounts[0].AccountID, report.Accounts[1].AccountID, report.Accounts[2].AccountID}
+	if ids[0] != 2 || ids[1] != 3 || ids[2] != 1 {
+		t.Fatalf("ranking = %v, want [2 3 1]", ids)
+	}
+	busy := report.Accounts[0]
+	if busy.Rank != 1 || busy.AvgDailyCredits != 280 || busy.Utilization != 1 {
+		t.Errorf("busy row = %+v", busy)
+	}
+	// 日均 280，当日剩余 140，约 12 小时耗尽
+	if busy.HoursToExhaustion == nil || *busy.HoursToExhaustion != 12 {
+		t.Errorf("hours to exhaustion = %v", busy.HoursToExhaustion)
+	}
+	if report.Accounts[2].HoursToExhaustion != nil {
+		t.Error("idle account should have no exhaustion estimate")
+	}
+
+	if len(report.Rejections) != 2 || report.Rejections[0].Model != "claude-sonnet-4-5-20250929" || report.Rejections[0].Rejected != 140 {
+		t.Errorf("rejections = %+v", report.Rejections)
+	}
+	// 平均每请求 3 积分，每天拒绝 30 次，缺口 90 积分
+	if report.AvgCreditsPerRequest != 3 || report.UnmetCreditsPerDay != 90 {
+		t.Errorf("avg=%v unmet=%v", report.AvgCreditsPerRequest, report.UnmetCreditsPerDay)
+	}
+	if report.SuggestedAccounts[model.PlanStarter] != 1 || report.SuggestedAccounts[model.PlanMax] != 1 {
+		t.Errorf("suggested = %v", report.SuggestedAccounts)
+	}
+
+	var csvOut strings.Builder
+	if err := WriteUsageReportCSV(&csvOut, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"rank,account_id,email,plan_type",
+		"1,2,busy@example.com,Starter,normal,280,1960.00,980,280.00,1.00,140.00,12.00",
+		"\n\nmodel,rejected_requests\n",
+		"gpt-5,70",
+	} {
+		if !strings.Contains(csvOut.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, csvOut.String())
+		}
+	}
+}
+
+func TestFlushUsageStatsAccumulates(t *testing.T) {
+	initTestDB(t, "usage.db")
+	// 丢弃之前的测试在未配置数据库时累计的统计
+	usageStats.mu.Lock()
+	usageStats.usage = make(map[usageKey]usageDelta)
+	usageStats.rejections = make(map[rejectionKey]int)
+	usageStats.logs = nil
+	usageStats.mu.Unlock()
+	now := time.Now()
+	recordAccountUsage(5, 2, now)
+	recordPoolRejection("gpt-5", now)
+	FlushUsageStats()
+	recordAccountUsage(5, 3, now)
+	recordPoolRejection("gpt-5", now)
+	FlushUsageStats()
+
+	var usage []model.AccountUsageDaily
+	database.GetDB().Find(&usage)
+	if len(usage) != 1 || usage[0].Credits != 5 || usage[0].Requests != 2 {
+		t.Errorf("usage = %+v", usage)
+	}
+	var rejections []model.PoolRejectionDaily
+	database.GetDB().Find(&rejections)
+	if len(rejections) != 1 || rejections[0].Count != 2 {
+		t.Errorf("rejections = %+v", rejections)
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 const (
 	ZencoderChatURL = "https://api.zencoder.ai/v1/chat/completions"
-	MaxRetries      = 3
+	MaxRetries      = 3 // 默认每个请求最多尝试的账号数，可通过 RETRY_POLICY 或 /api/settings/retry-policy 调整
 	ZencoderVersion = "3.24.0"
 )
 
@@ -46,8 +46,10 @@ func (s *ZencoderService) Chat(req *model.ChatCompletionRequest) (*model.ChatCom
 		return nil, ErrNoAvailableAccount
 	}
 
+	policy := GetRetryPolicy(zenModel.ProviderID)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
+	for i := 0; i < policy.MaxRetries; i++ {
+		time.Sleep(policy.Delay(i))
 		account, err := GetNextAccountForModel(req.Model)
 		if err != nil {
 			return nil, err
@@ -126,8 +128,10 @@ func (s *ZencoderService) ChatStream(req *model.ChatCompletionRequest, writer ht
 		return ErrNoAvailableAccount
 	}
 
+	policy := GetRetryPolicy(zenModel.ProviderID)
 	var lastErr error
-	for i := 0; i < MaxRetries; i++ {
+	for i := 0; i < policy.MaxRetries; i++ {
+		time.Sleep(policy.Delay(i))
 		account, err := GetNextAccountForModel(req.Model)
 		if err != nil {
 			return err
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -18,27 +23,75 @@ func main() {
 		log.Println("No .env file found or error loading it, using system environment variables or defaults")
 	}
 
+	// 按 LOG_LEVEL / LOG_FORMAT 输出日志，并按 EMAIL_REDACTION 脱敏日志中的邮箱
+	service.ConfigureLogging(service.NewRedactingLogWriter(os.Stderr))
+	if service.JSONLogging() {
+		// gin 的访问日志同样以 JSON 输出
+		gin.DefaultWriter = service.LogWriter()
+		gin.DefaultErrorWriter = service.LogWriter()
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "7860" // 默认使用7860端口，兼容Huggingface Spaces
 	}
 
+	// 管理密码、AUTH_TOKEN 和数据库连接串可以来自挂载的密钥文件或 Vault，定期重新读取；
+	// 配置的来源读取失败时退出，避免回退到环境变量后以无管理密码或本地 SQLite 启动
+	if err := service.LoadSecrets(); err != nil {
+		log.Fatalf("[Secrets] 读取外部密钥失败: %v", err)
+	}
+	service.StartSecretsRefresher()
+
 	// 数据库初始化
 	dbType := os.Getenv("DB_TYPE")
-	dbDSN := os.Getenv("DATABASE_URL")
+	dbDSN := service.GetSecret("DATABASE_URL")
 
-	// 向后兼容：如果没有设置 DB_TYPE 和 DATABASE_URL，使用 DB_PATH
+	// 向后兼容：如果没有设置 DB_TYPE 和 DATABASE_URL，使用 DB_PATH，其次是初始化向导保存的数据库设置
 	if dbType == "" && dbDSN == "" {
 		dbType = "sqlite"
 		dbDSN = os.Getenv("DB_PATH")
 		if dbDSN == "" {
-			dbDSN = "data.db"
+			if t, dsn, ok := service.LoadBootstrapDatabase(); ok {
+				dbType, dbDSN = t, dsn
+			} else {
+				dbDSN = "data.db"
+			}
 		}
 	}
 
-	if err := database.Init(dbType, dbDSN); err != nil {
+	if err := database.InitWithRetry(dbType, dbDSN); err != nil {
 		log.Fatal("Failed to init database:", err)
 	}
+	// 后台列表和统计查询使用只读副本
+	if readDSN := service.GetSecret("DATABASE_READ_URL"); readDSN != "" {
+		if err := database.InitReadReplica(dbType, readDSN); err != nil {
+			log.Printf("[WARN] [Database] 只读副本连接失败，后台查询使用主库: %v", err)
+		}
+	}
+	// 运行中连接中断时进入降级模式，恢复后回放暂存的写操作
+	database.StartHealthMonitor()
+
+	// 应用初始化向导保存的全局限制
+	service.LoadBootstrapSettings()
+
+	// 加载数据库中的模型注册表，表为空时使用编译时的默认模型表
+	if err := service.LoadModelRegistry(); err != nil {
+		log.Printf("[WARN] [ModelRegistry] 加载模型注册表失败，使用默认模型表: %v", err)
+	}
+
+	// 加载模型别名
+	if err := service.LoadModelAliases(); err != nil {
+		log.Printf("[WARN] [ModelAlias] 加载模型别名失败: %v", err)
+	}
+
+	// 加载运行时添加的代理
+	if err := service.LoadPoolProxies(); err != nil {
+		log.Printf("[WARN] [ProxyPool] 加载代理失败: %v", err)
+	}
+
+	// 上游地址覆盖（压测/本地模拟）
+	service.InitUpstreamBase()
 
 	// 启动积分重置定时任务
 	service.StartCreditResetScheduler()
@@ -46,6 +99,12 @@ func main() {
 	// 启动Token刷新定时任务
 	service.StartTokenRefreshScheduler()
 
+	// 启动账号身份探测（IDENTITY_PROBE_INTERVAL 为 0 时不探测）
+	service.StartIdentityProbeScheduler()
+
+	// 启动代理健康检查（PROXY_HEALTH_CHECK_INTERVAL 为 0 时不检查）
+	service.StartProxyHealthScheduler()
+
 	// 初始化账号池
 	service.InitAccountPool()
 
@@ -55,13 +114,32 @@ func main() {
 	// 初始化自动生成服务
 	service.InitAutoGenerationService()
 
+	// 启动后台批量任务，继续上次未完成的任务
+	service.StartAdminJobRunner()
+
 	r := gin.Default()
 	setupRoutes(r)
 
-	log.Printf("Server starting on :%s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal(err)
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Server starting on :%s", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// 收到退出信号后等待进行中的请求结束，再保存号池状态供下一个实例恢复
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[WARN] 等待请求结束超时: %v", err)
 	}
+	service.StopAccountPool()
 }
 
 func setupRoutes(r *gin.Engine) {
@@ -72,20 +150,78 @@ func setupRoutes(r *gin.Engine) {
 		c.HTML(200, "index.html", nil)
 	})
 
-	// Anthropic API - /v1/messages
+	// 相同请求合并和响应缓存在各协议间共享
+	responseCache := middleware.ResponseCacheMiddleware()
+	coalesce := middleware.CoalesceMiddleware()
+	compression := middleware.ContextCompressionMiddleware()
+	modelAlias := middleware.ModelAliasMiddleware()
+	modelRouter := middleware.ModelRouterMiddleware()
+	providerHint := middleware.ProviderHintMiddleware()
+	deprecation := middleware.ModelDeprecationMiddleware()
+	canary := middleware.ModelCanaryMiddleware()
+	federation := middleware.FederationMiddleware()
+	keyGuard := middleware.KeyGuardMiddleware()
+	reservation := middleware.PoolReservationMiddleware()
+	deadLetter := middleware.DeadLetterMiddleware()
+	dbRequired := middleware.DatabaseMiddleware()
+	endUser := middleware.EndUserMiddleware()
+	idempotency := middleware.IdempotencyMiddleware()
+	latencyBudget := middleware.LatencyBudgetMiddleware()
+	bodyLimit := middleware.BodyLimitMiddleware()
+	promptLimit := middleware.PromptLimitMiddleware()
+
+	// Anthropic API - /v1/messages, /v1/messages/count_tokens, /anthropic/v1/models (/v1/models 带 anthropic-version 头时同样返回 Anthropic 格式)
 	anthropicHandler := handler.NewAnthropicHandler()
-	r.POST("/v1/messages", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), anthropicHandler.Messages)
+	r.POST("/v1/messages", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, keyGuard, reservation, deadLetter, latencyBudget, middleware.RequestValidationMiddleware(service.RequestSchemaAnthropicMessages), endUser, idempotency, middleware.ModerationMiddleware(), modelRouter, modelAlias, providerHint, deprecation, canary, responseCache, coalesce, compression, promptLimit, middleware.StreamFallbackMiddleware(), federation, anthropicHandler.Messages)
+	r.POST("/v1/messages/count_tokens", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), keyGuard, reservation, modelRouter, modelAlias, anthropicHandler.CountTokens)
+	r.GET("/anthropic/v1/models", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), anthropicHandler.Models)
 
-	// OpenAI API - /v1/chat/completions, /v1/responses
+	// OpenAI API - /v1/chat/completions, /v1/responses, /v1/embeddings, /v1/realtime
 	openaiHandler := handler.NewOpenAIHandler()
 	r.GET("/v1/models", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), openaiHandler.Models)
 	r.GET("/v1/models/status", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), openaiHandler.ModelSyncStatus)
-	r.POST("/v1/chat/completions", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), openaiHandler.ChatCompletions)
-	r.POST("/v1/responses", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), openaiHandler.Responses)
+	r.GET("/v1/models/:id", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), openaiHandler.Model)
+	r.GET("/v1/models/:id/availability", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), openaiHandler.ModelAvailability)
+	r.POST("/v1/chat/completions", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, keyGuard, reservation, deadLetter, latencyBudget, middleware.RequestValidationMiddleware(service.RequestSchemaChatCompletions), idempotency, middleware.ModerationMiddleware(), modelRouter, modelAlias, providerHint, deprecation, canary, responseCache, coalesce, compression, promptLimit, middleware.StreamFallbackMiddleware(), federation, openaiHandler.ChatCompletions)
+	r.POST("/v1/responses", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, keyGuard, reservation, deadLetter, latencyBudget, middleware.RequestValidationMiddleware(service.RequestSchemaResponses), middleware.ModerationMiddleware(), modelRouter, modelAlias, providerHint, deprecation, canary, responseCache, coalesce, middleware.StreamFallbackMiddleware(), federation, openaiHandler.Responses)
+	r.POST("/v1/embeddings", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, keyGuard, reservation, deadLetter, latencyBudget, modelAlias, deprecation, responseCache, coalesce, openaiHandler.Embeddings)
+	// WebSocket 透传 - /v1/realtime?model=...，握手经号池注入账号凭证，连接期间占用账号
+	r.GET("/v1/realtime", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), keyGuard, reservation, openaiHandler.Realtime)
+
+	// Ollama 兼容接口 - /api/chat, /api/generate, /api/tags，请求转换为 OpenAI 格式后走 /v1/chat/completions 的处理链
+	ollamaHandler := handler.NewOllamaHandler()
+	r.GET("/api/tags", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), ollamaHandler.Tags)
+	r.POST("/api/chat", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, ollamaHandler.Chat, keyGuard, reservation, latencyBudget, middleware.ModerationMiddleware(), modelRouter, modelAlias, providerHint, deprecation, canary, responseCache, coalesce, compression, promptLimit, middleware.StreamFallbackMiddleware(), openaiHandler.ChatCompletions)
+	r.POST("/api/generate", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, ollamaHandler.Generate, keyGuard, reservation, latencyBudget, middleware.ModerationMiddleware(), modelRouter, modelAlias, providerHint, deprecation, canary, responseCache, coalesce, compression, promptLimit, middleware.StreamFallbackMiddleware(), openaiHandler.ChatCompletions)
 
-	// Gemini API - /v1beta/models/*path
+	// 离峰批处理 - /v1/batch-lite，在号池空闲时逐个执行 chat 请求
+	batchHandler := handler.NewBatchHandler(r)
+	r.POST("/v1/batch-lite", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), keyGuard, dbRequired, batchHandler.Create)
+	r.GET("/v1/batch-lite/:id", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), dbRequired, batchHandler.Get)
+	r.GET("/v1/batch-lite/:id/results", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), dbRequired, batchHandler.Results)
+	r.POST("/v1/batch-lite/:id/cancel", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), dbRequired, batchHandler.Cancel)
+	service.StartBatchScheduler(batchHandler.Execute)
+
+	// Gemini API - /v1beta/models, /v1beta/models/*path (generateContent / streamGenerateContent / countTokens)
 	geminiHandler := handler.NewGeminiHandler()
-	r.POST("/v1beta/models/*path", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), geminiHandler.HandleRequest)
+	r.GET("/v1beta/models", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), geminiHandler.Models)
+	r.GET("/v1beta/models/*path", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), geminiHandler.Model)
+	r.POST("/v1beta/models/*path", middleware.LoggerMiddleware(), middleware.AuthMiddleware(), bodyLimit, keyGuard, reservation, deadLetter, latencyBudget, middleware.ModerationMiddleware(), modelRouter, modelAlias, providerHint, deprecation, canary, responseCache, coalesce, middleware.StreamFallbackMiddleware(), federation, geminiHandler.HandleRequest)
+
+	// 号池指标 - 使用后台管理密码验证
+	metricsHandler := handler.NewMetricsHandler()
+	r.GET("/metrics", middleware.AdminAuthMiddleware(), metricsHandler.Metrics)
+
+	// 实时状态面板 - 使用后台管理密码验证，只读内存状态，数据库不可用时同样可用
+	dashboardHandler := handler.NewDashboardHandler()
+	dashboard := r.Group("/api/dashboard", middleware.AdminAuthMiddleware())
+	{
+		dashboard.GET("", dashboardHandler.Overview)
+		dashboard.GET("/accounts", dashboardHandler.Accounts)
+		dashboard.GET("/streams", dashboardHandler.Streams)
+		dashboard.GET("/proxies", dashboardHandler.Proxies)
+		dashboard.GET("/errors", dashboardHandler.Errors)
+	}
 
 	// OAuth处理器 - 不需要管理密码验证（公开访问）
 	oauthHandler := handler.NewOAuthHandler()
@@ -93,26 +229,59 @@ func setupRoutes(r *gin.Engine) {
 	r.GET("/api/oauth/callback-rt", oauthHandler.CallbackOAuthForRT)
 	r.POST("/api/oauth/exchange", oauthHandler.ManualExchange)
 
+	// 管理面板 OIDC 登录 - 公开访问，登录成功后签发管理会话
+	oidcHandler := handler.NewOIDCHandler()
+	r.GET("/api/admin/oidc/config", oidcHandler.Config)
+	r.GET("/api/admin/oidc/login", oidcHandler.Login)
+	r.GET("/api/admin/oidc/callback", oidcHandler.Callback)
+
+	// 首次部署初始化向导 - 公开访问，设置管理员后关闭
+	bootstrapHandler := handler.NewBootstrapHandler()
+	r.GET("/api/bootstrap", bootstrapHandler.Status)
+	r.POST("/api/bootstrap", bootstrapHandler.Bootstrap)
+
 	// External API - 用于注册机提交OAuth token（公开访问）
 	externalHandler := handler.NewExternalHandler()
-	r.POST("/api/external/submit-tokens", externalHandler.SubmitTokens)
+	r.POST("/api/external/submit-tokens", dbRequired, externalHandler.SubmitTokens)
 
 	// Account management API - 需要后台管理密码验证
 	accountHandler := handler.NewAccountHandler()
+	adminJobHandler := handler.NewAdminJobHandler()
 	tokenHandler := handler.NewTokenHandler()
+	apiKeyHandler := handler.NewAPIKeyHandler()
+	modelAliasHandler := handler.NewModelAliasHandler()
+	proxyHandler := handler.NewProxyHandler()
+	deadLetterHandler := handler.NewDeadLetterHandler(r)
+	modelRegistryHandler := handler.NewModelRegistryHandler()
+	settingsHandler := handler.NewSettingsHandler()
+	debugHandler := handler.NewDebugHandler()
+	reportHandler := handler.NewReportHandler()
 	api := r.Group("/api")
 	api.Use(middleware.AdminAuthMiddleware()) // 应用后台管理密码验证中间件
+	api.Use(dbRequired)                       // 数据库不可用时返回 503
 	{
 		// 账号管理
 		api.GET("/accounts", accountHandler.List)
 		api.POST("/accounts", accountHandler.Create)
+		api.PATCH("/accounts/:id", accountHandler.Update)
 		api.PUT("/accounts/:id", accountHandler.Update)
 		api.DELETE("/accounts/:id", accountHandler.Delete)
 		api.POST("/accounts/:id/toggle", accountHandler.Toggle)
+		api.POST("/accounts/:id/rotate-credential", accountHandler.RotateCredential)
+		api.GET("/accounts/:id/drain", accountHandler.DrainStatus)
+		api.POST("/accounts/:id/drain", accountHandler.Drain)
+		api.DELETE("/accounts/:id/drain", accountHandler.Resume)
+		api.POST("/accounts/identity-probe", accountHandler.IdentityProbe)
+		api.GET("/accounts/identity-alerts", accountHandler.IdentityAlerts)
+		api.POST("/accounts/proxy-health-check", accountHandler.ProxyHealthCheck)
+		api.GET("/accounts/usage-anomalies", accountHandler.UsageAnomalies)
 		api.POST("/accounts/batch/category", accountHandler.BatchUpdateCategory)
 		api.POST("/accounts/batch/move-all", accountHandler.BatchMoveAll)
 		api.POST("/accounts/batch/refresh-token", accountHandler.BatchRefreshToken)
 		api.POST("/accounts/batch/delete", accountHandler.BatchDelete)
+		api.GET("/jobs", adminJobHandler.List)
+		api.GET("/jobs/:id", adminJobHandler.Get)
+		api.POST("/jobs/:id/cancel", adminJobHandler.Cancel)
 
 		// Token记录管理
 		api.GET("/tokens", tokenHandler.ListTokenRecords)
@@ -122,5 +291,113 @@ func setupRoutes(r *gin.Engine) {
 		api.POST("/tokens/:id/refresh", tokenHandler.RefreshTokenRecord)
 		api.GET("/tokens/tasks", tokenHandler.GetGenerationTasks)
 		api.GET("/tokens/pool-status", tokenHandler.GetPoolStatus)
+
+		// 客户端 API Key 管理
+		api.GET("/keys", apiKeyHandler.List)
+		api.POST("/keys", apiKeyHandler.Create)
+		api.PUT("/keys/:id", apiKeyHandler.Update)
+		api.DELETE("/keys/:id", apiKeyHandler.Delete)
+		api.GET("/keys/reservations", apiKeyHandler.Reservations)
+		api.PUT("/keys/:id/reservation", apiKeyHandler.SetReservation)
+
+		// 模型别名
+		api.GET("/model-aliases", modelAliasHandler.List)
+		api.POST("/model-aliases", modelAliasHandler.Create)
+		api.PUT("/model-aliases/:id", modelAliasHandler.Update)
+		api.DELETE("/model-aliases/:id", modelAliasHandler.Delete)
+
+		// 代理池
+		api.GET("/proxies", proxyHandler.List)
+		api.POST("/proxies", proxyHandler.Create)
+		api.POST("/proxies/test", proxyHandler.Test)
+		api.DELETE("/proxies/:id", proxyHandler.Delete)
+
+		api.GET("/upstream-errors", metricsHandler.UpstreamErrors)
+		api.GET("/streams/active", metricsHandler.ActiveStreams)
+		api.GET("/reports/usage", reportHandler.Usage)
+		api.GET("/usage", reportHandler.UsageSummary)
+		api.GET("/usage/logs", reportHandler.RequestLogs)
+		api.GET("/usage/sizes", reportHandler.RequestSizes)
+
+		// 重试用尽后仍失败的请求
+		api.GET("/dead-letters", deadLetterHandler.List)
+		api.GET("/dead-letters/:id", deadLetterHandler.Get)
+		api.POST("/dead-letters/:id/replay", deadLetterHandler.Replay)
+		api.DELETE("/dead-letters/:id", deadLetterHandler.Delete)
+
+		// 运行时设置
+		api.GET("/settings/timeouts", settingsHandler.GetTimeouts)
+		api.PUT("/settings/timeouts", settingsHandler.UpdateTimeouts)
+		api.GET("/settings/service-tier", settingsHandler.GetServiceTier)
+		api.PUT("/settings/service-tier", settingsHandler.UpdateServiceTier)
+		api.GET("/settings/premium-reserve", settingsHandler.GetPremiumReserve)
+		api.PUT("/settings/premium-reserve", settingsHandler.UpdatePremiumReserve)
+		api.GET("/settings/account-concurrency", settingsHandler.GetAccountConcurrency)
+		api.PUT("/settings/account-concurrency", settingsHandler.UpdateAccountConcurrency)
+		api.GET("/settings/retry-policy", settingsHandler.GetRetryPolicy)
+		api.PUT("/settings/retry-policy", settingsHandler.UpdateRetryPolicy)
+		api.GET("/settings/stream-credit-cap", settingsHandler.GetStreamCreditCap)
+		api.PUT("/settings/stream-credit-cap", settingsHandler.UpdateStreamCreditCap)
+		api.GET("/settings/request-limits", settingsHandler.GetRequestLimits)
+		api.PUT("/settings/request-limits", settingsHandler.UpdateRequestLimits)
+		api.GET("/settings/stream-failover", settingsHandler.GetStreamFailover)
+		api.PUT("/settings/stream-failover", settingsHandler.UpdateStreamFailover)
+		api.GET("/settings/stream-backpressure", settingsHandler.GetStreamBackpressure)
+		api.PUT("/settings/stream-backpressure", settingsHandler.UpdateStreamBackpressure)
+		api.GET("/settings/stream-keepalive", settingsHandler.GetStreamKeepAlive)
+		api.PUT("/settings/stream-keepalive", settingsHandler.UpdateStreamKeepAlive)
+		api.GET("/settings/stream-pacing", settingsHandler.GetStreamPacing)
+		api.PUT("/settings/stream-pacing", settingsHandler.UpdateStreamPacing)
+		api.GET("/settings/moderation", settingsHandler.GetModeration)
+		api.PUT("/settings/moderation", settingsHandler.UpdateModeration)
+		api.GET("/settings/key-guard", settingsHandler.GetKeyGuard)
+		api.PUT("/settings/key-guard", settingsHandler.UpdateKeyGuard)
+		api.GET("/settings/transport", settingsHandler.GetTransport)
+		api.PUT("/settings/transport", settingsHandler.UpdateTransport)
+		api.GET("/settings/end-user-limit", settingsHandler.GetEndUserLimit)
+		api.PUT("/settings/end-user-limit", settingsHandler.UpdateEndUserLimit)
+		api.GET("/settings/federation", settingsHandler.GetFederation)
+		api.GET("/settings/email-redaction", settingsHandler.GetEmailRedaction)
+		api.PUT("/settings/email-redaction", settingsHandler.UpdateEmailRedaction)
+		api.GET("/settings/request-validation", settingsHandler.GetRequestValidation)
+		api.PUT("/settings/request-validation", settingsHandler.UpdateRequestValidation)
+		api.GET("/settings/response-headers", settingsHandler.GetResponseHeaders)
+		api.PUT("/settings/response-headers", settingsHandler.UpdateResponseHeaders)
+		api.GET("/settings/thinking-guard", settingsHandler.GetThinkingGuard)
+		api.PUT("/settings/thinking-guard", settingsHandler.UpdateThinkingGuard)
+		api.GET("/settings/thinking-disable", settingsHandler.GetThinkingDisable)
+		api.PUT("/settings/thinking-disable", settingsHandler.UpdateThinkingDisable)
+		api.GET("/settings/identity-probe", settingsHandler.GetIdentityProbe)
+		api.PUT("/settings/identity-probe", settingsHandler.UpdateIdentityProbe)
+		api.GET("/settings/proxy-health", settingsHandler.GetProxyHealth)
+		api.PUT("/settings/proxy-health", settingsHandler.UpdateProxyHealth)
+		api.GET("/settings/usage-anomaly", settingsHandler.GetUsageAnomaly)
+		api.PUT("/settings/usage-anomaly", settingsHandler.UpdateUsageAnomaly)
+		api.GET("/settings/anthropic-beta", settingsHandler.GetAnthropicBeta)
+		api.PUT("/settings/anthropic-beta", settingsHandler.UpdateAnthropicBeta)
+		api.GET("/settings/model-router", settingsHandler.GetModelRouter)
+		api.PUT("/settings/model-router", settingsHandler.UpdateModelRouter)
+
+		// 模型注册表
+		api.GET("/models", modelRegistryHandler.List)
+		api.POST("/models", modelRegistryHandler.Create)
+		api.POST("/models/reload", modelRegistryHandler.Reload)
+		api.PUT("/models/:id", modelRegistryHandler.Update)
+		api.DELETE("/models/:id", modelRegistryHandler.Delete)
+		api.GET("/models/:id/override", settingsHandler.GetModelOverride)
+		api.PUT("/models/:id/override", settingsHandler.UpdateModelOverride)
+		api.DELETE("/models/:id/override", settingsHandler.DeleteModelOverride)
+		api.GET("/models/deprecations", settingsHandler.ListModelDeprecations)
+		api.PUT("/models/:id/deprecation", settingsHandler.UpdateModelDeprecation)
+		api.DELETE("/models/:id/deprecation", settingsHandler.DeleteModelDeprecation)
+		api.GET("/models/canaries", settingsHandler.ListModelCanaries)
+		api.PUT("/models/:id/canary", settingsHandler.UpdateModelCanary)
+		api.DELETE("/models/:id/canary", settingsHandler.DeleteModelCanary)
+		api.GET("/admin/config/export", settingsHandler.ExportConfig)
+		api.POST("/admin/config/import", settingsHandler.ImportConfig)
+		api.POST("/admin/simulate", reportHandler.Simulate)
+
+		// 请求日志查询
+		api.GET("/debug/traces/:id", debugHandler.GetTrace)
 	}
 }
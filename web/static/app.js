@@ -67,6 +67,20 @@ function showAdminLogin() {
     document.getElementById('adminPasswordModal').classList.remove('hidden');
     document.getElementById('mainApp').classList.add('hidden');
     document.getElementById('adminPassword').focus();
+    showOIDCLoginIfEnabled();
+}
+
+// 启用 OIDC 时在登录框中显示 SSO 登录按钮
+async function showOIDCLoginIfEnabled() {
+    try {
+        const response = await fetch(`${API_BASE}/admin/oidc/config`);
+        const data = await response.json();
+        if (data.enabled) {
+            document.getElementById('oidcLoginBtn').classList.remove('hidden');
+        }
+    } catch (e) {
+        console.log('Failed to load OIDC config:', e);
+    }
 }
 
 function hideAdminLogin() {
@@ -627,6 +641,11 @@ function renderAccounts(accounts) {
                             : '<svg xmlns="http://www.w3.org/2000/svg" class="h-5 w-5" fill="none" viewBox="0 0 24 24" stroke="currentColor"><path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M14.752 11.168l-3.197-2.132A1 1 0 0010 9.87v4.263a1 1 0 001.555.832l3.197-2.132a1 1 0 000-1.664z" /><path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M21 12a9 9 0 11-18 0 9 9 0 0118 0z" /></svg>'
                         }
                     </button>
+                    <button onclick="rotateCredential(${acc.id})" class="text-gray-500 hover:text-primary transition-colors" title="轮换凭证">
+                        <svg xmlns="http://www.w3.org/2000/svg" class="h-5 w-5" fill="none" viewBox="0 0 24 24" stroke="currentColor">
+                            <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M15 7a2 2 0 012 2m4 0a6 6 0 01-7.743 5.743L11 17H9v2H7v2H4a1 1 0 01-1-1v-2.586a1 1 0 01.293-.707l5.964-5.964A6 6 0 1121 9z" />
+                        </svg>
+                    </button>
                     <button onclick="deleteAccount(${acc.id})" class="text-red-500 hover:text-red-700 transition-colors" title="删除">
                         <svg xmlns="http://www.w3.org/2000/svg" class="h-5 w-5" fill="none" viewBox="0 0 24 24" stroke="currentColor">
                             <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M19 7l-.867 12.142A2 2 0 0116.138 21H7.862a2 2 0 01-1.995-1.858L5 7m5 4v6m4-6v6m1-10V4a1 1 0 00-1-1h-4a1 1 0 00-1 1v3M4 7h16" />
@@ -787,6 +806,11 @@ async function oneClickMove(targetCategory) {
         if (!resp.ok) throw new Error('One-click move failed');
         
         const result = await resp.json();
+        if (resp.status === 202) {
+            await waitAdminJob(result.job, '移动');
+            loadAccounts();
+            return;
+        }
         alert(`成功移动 ${result.moved_count || 0} 个账号`);
         
         // 刷新当前页面
@@ -872,7 +896,11 @@ async function batchDelete(deleteAll = false) {
         }
         
         const result = await resp.json();
-        alert(`成功删除 ${result.deleted_count || 0} 个账号`);
+        if (resp.status === 202) {
+            await waitAdminJob(result.job, '删除');
+        } else {
+            alert(`成功删除 ${result.deleted_count || 0} 个账号`);
+        }
         
         // 清空选择并刷新页面
         currentState.selectedIds.clear();
@@ -920,6 +948,28 @@ async function batchRefreshToken(refreshAll = false) {
             throw new Error(err.error || 'Unknown error');
         }
 
+        // 账号较多时服务端转为后台任务，改为轮询进度
+        if (resp.status === 202) {
+            const { job } = await resp.json();
+            addRefreshProgressLog(`账号较多，已转为后台任务 ${job.id}，关闭弹窗不影响执行`, 'info');
+            document.getElementById('refreshProgressCloseBtn').classList.remove('hidden');
+            let logged = 0;
+            const final = await pollAdminJob(job.id, (j) => {
+                updateRefreshProgress(j.processed, j.total, '后台刷新中');
+                // 失败记录只保留最近若干条，按失败总数补记新增的部分
+                const fresh = Math.min(j.failed - logged, j.errors.length);
+                j.errors.slice(j.errors.length - fresh).forEach(e => {
+                    addRefreshProgressLog(`✗ ${e.message} (ID:${e.account_id})`, 'error');
+                });
+                logged = j.failed;
+            });
+            const text = final.status === 'cancelled' ? '已取消' : '完成';
+            updateRefreshProgress(final.processed, final.total, text);
+            addRefreshProgressLog(`批量刷新${text}！成功 ${final.succeeded} 个，失败 ${final.failed} 个`, 'info');
+            showRefreshProgressSummary(final.succeeded, final.failed);
+            return true;
+        }
+
         // 处理流式响应
         const reader = resp.body.getReader();
         const decoder = new TextDecoder();
@@ -982,6 +1032,26 @@ async function batchRefreshToken(refreshAll = false) {
     }
 }
 
+// 轮询后台任务进度，任务结束后返回最终状态
+async function pollAdminJob(jobId, onProgress) {
+    while (true) {
+        const resp = await fetch(`${API_BASE}/jobs/${jobId}`, { headers: getAuthHeaders() });
+        if (!resp.ok) throw new Error('获取后台任务进度失败');
+        const job = await resp.json();
+        if (onProgress) onProgress(job);
+        if (job.finished_at) return job;
+        await new Promise(resolve => setTimeout(resolve, 2000));
+    }
+}
+
+// 等待删除、移动等后台任务结束并提示结果
+async function waitAdminJob(job, action) {
+    alert(`账号较多，已转为后台${action}任务 (共 ${job.total} 个)，完成后会提示`);
+    const final = await pollAdminJob(job.id);
+    const text = final.status === 'cancelled' ? '已取消' : '已完成';
+    alert(`后台${action}任务${text}：成功 ${final.succeeded} 个，失败 ${final.failed} 个`);
+}
+
 // 刷新进度弹窗管理
 function showRefreshProgressModal() {
     document.getElementById('refreshProgressModal').classList.remove('hidden');
@@ -1198,6 +1268,27 @@ async function deleteAccount(id) {
     }
 }
 
+async function rotateCredential(id) {
+    if (!confirm('确定要为此账号生成新凭证并吊销旧凭证吗？')) return;
+    try {
+        const resp = await fetch(`${API_BASE}/accounts/${id}/rotate-credential`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        const data = await resp.json();
+        if (!resp.ok) {
+            alert('轮换失败: ' + (data.error || resp.status));
+            return;
+        }
+        alert(data.revoked
+            ? `凭证已轮换: ${data.new_client_id}`
+            : `凭证已轮换: ${data.new_client_id}，但旧凭证吊销失败: ${data.revoke_error}`);
+        loadAccounts();
+    } catch (e) {
+        alert('轮换失败');
+    }
+}
+
 async function toggleAccount(id) {
     try {
         await fetch(`${API_BASE}/accounts/${id}/toggle`, {
@@ -1298,6 +1389,7 @@ document.getElementById('addForm').addEventListener('submit', async (e) => {
         const accessToken = document.getElementById('credential_access_token').value.trim();
         const refreshToken = document.getElementById('credential_refresh_token').value.trim();
         const proxy = document.getElementById('proxy').value.trim();
+        const proxyRegion = document.getElementById('proxy_region').value.trim();
 
         if (!accessToken && !refreshToken) {
             alert('请填写 Access Token 或 Refresh Token（至少一个）');
@@ -1306,6 +1398,7 @@ document.getElementById('addForm').addEventListener('submit', async (e) => {
 
         data = {
             proxy: proxy,
+            proxy_region: proxyRegion,
             generate_mode: false
         };
 
@@ -1320,6 +1413,7 @@ document.getElementById('addForm').addEventListener('submit', async (e) => {
         const masterAccessToken = document.getElementById('generate_access_token').value.trim();
         const masterRefreshToken = document.getElementById('generate_refresh_token').value.trim();
         const proxy = document.getElementById('proxy').value.trim();
+        const proxyRegion = document.getElementById('proxy_region').value.trim();
 
         if (!masterAccessToken && !masterRefreshToken) {
             alert('请填写 Master Access Token 或 Master Refresh Token（至少一个）');
@@ -1328,6 +1422,7 @@ document.getElementById('addForm').addEventListener('submit', async (e) => {
 
         data = {
             proxy: proxy,
+            proxy_region: proxyRegion,
             generate_mode: true
         };
 